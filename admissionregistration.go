@@ -0,0 +1,115 @@
+package extension
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// AdmissionRegistrationAPI is the version of the admissionregistration.k8s.io API the webhook configurations
+// are created with
+type AdmissionRegistrationAPI string
+
+const (
+	// AdmissionRegistrationV1Beta1 creates v1beta1 configurations, which Kubernetes 1.22 removed
+	AdmissionRegistrationV1Beta1 AdmissionRegistrationAPI = "v1beta1"
+	// AdmissionRegistrationV1 creates v1 configurations, which Kubernetes serves since 1.16
+	AdmissionRegistrationV1 AdmissionRegistrationAPI = "v1"
+	// AdmissionRegistrationAuto creates v1 configurations if the cluster serves the v1 API, and v1beta1 ones
+	// otherwise. It is the default.
+	AdmissionRegistrationAuto AdmissionRegistrationAPI = "auto"
+
+	// v1WebhookTimeoutSeconds is the timeout of the v1 webhooks without PolicyExtension timeout, the default
+	// of the v1beta1 API, so that the webhooks keep their timeout when the configurations are migrated
+	v1WebhookTimeoutSeconds int32 = 30
+)
+
+// resolveAdmissionRegistrationAPI sets the API version of the webhook configurations, detecting whether the
+// cluster serves the v1 API with AdmissionRegistrationAuto
+func (m *DefaultExtensionManager) resolveAdmissionRegistrationAPI() error {
+	api := m.Options.AdmissionRegistrationAPI
+	if api == "" || api == AdmissionRegistrationAuto {
+		api = AdmissionRegistrationV1Beta1
+		// Without a mapper, e.g. with a fake kubernetes manager, the API supported up to Kubernetes 1.21 is used
+		if mapper := m.KubeManager.GetRESTMapper(); mapper != nil {
+			gk := schema.GroupKind{Group: admissionregistrationv1.GroupName, Kind: "MutatingWebhookConfiguration"}
+			_, err := mapper.RESTMapping(gk, admissionregistrationv1.SchemeGroupVersion.Version)
+			if err != nil && !meta.IsNoMatchError(err) {
+				return errors.Wrap(err, "detecting the admissionregistration API versions")
+			}
+			if err == nil {
+				api = AdmissionRegistrationV1
+			}
+		}
+		m.Logger.Infof("Registering the webhooks with the %s admissionregistration API", api)
+	}
+
+	m.WebhookConfig.APIVersion = api
+	for _, g := range m.webhookGroups {
+		g.config.APIVersion = api
+	}
+	return nil
+}
+
+// versioned returns the configuration in the API version of the WebhookConfig, the v1beta1 one by default
+func (f *WebhookConfig) versioned(config runtime.Object) (runtime.Object, error) {
+	if f.APIVersion != AdmissionRegistrationV1 {
+		return config, nil
+	}
+
+	// The v1 configurations have the same fields as the v1beta1 ones, a few of them being required
+	var v1Config runtime.Object
+	switch config.(type) {
+	case *admissionregistrationv1beta1.MutatingWebhookConfiguration:
+		v1Config = &admissionregistrationv1.MutatingWebhookConfiguration{}
+	case *admissionregistrationv1beta1.ValidatingWebhookConfiguration:
+		v1Config = &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	default:
+		return nil, errors.Errorf("Unsupported webhook configuration %T", config)
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "converting the webhook configuration to v1")
+	}
+	if err := json.Unmarshal(data, v1Config); err != nil {
+		return nil, errors.Wrap(err, "converting the webhook configuration to v1")
+	}
+
+	switch c := v1Config.(type) {
+	case *admissionregistrationv1.MutatingWebhookConfiguration:
+		for i := range c.Webhooks {
+			setV1Defaults(&c.Webhooks[i].SideEffects, &c.Webhooks[i].AdmissionReviewVersions, &c.Webhooks[i].MatchPolicy, &c.Webhooks[i].TimeoutSeconds)
+		}
+	case *admissionregistrationv1.ValidatingWebhookConfiguration:
+		for i := range c.Webhooks {
+			setV1Defaults(&c.Webhooks[i].SideEffects, &c.Webhooks[i].AdmissionReviewVersions, &c.Webhooks[i].MatchPolicy, &c.Webhooks[i].TimeoutSeconds)
+		}
+	}
+	return v1Config, nil
+}
+
+// setV1Defaults sets the fields required by the v1 API, and keeps the defaults of the v1beta1 one
+func setV1Defaults(sideEffects **admissionregistrationv1.SideEffectClass, reviewVersions *[]string, matchPolicy **admissionregistrationv1.MatchPolicyType, timeout **int32) {
+	if *sideEffects == nil {
+		// The extensions must not have side effects on the dry-run requests, e.g. the reachability probes
+		s := admissionregistrationv1.SideEffectClassNoneOnDryRun
+		*sideEffects = &s
+	}
+	if len(*reviewVersions) == 0 {
+		// The webhook server speaks the v1beta1 AdmissionReview, which the API servers still send when asked to
+		*reviewVersions = []string{admissionregistrationv1beta1.SchemeGroupVersion.Version}
+	}
+	if *matchPolicy == nil {
+		p := admissionregistrationv1.Exact
+		*matchPolicy = &p
+	}
+	if *timeout == nil {
+		t := v1WebhookTimeoutSeconds
+		*timeout = &t
+	}
+}
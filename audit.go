@@ -0,0 +1,311 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	defaultAuditBufferSize = 1000
+	// auditSendTimeout bounds the delivery of an event to a sink
+	auditSendTimeout = 5 * time.Second
+	// auditFlushTimeout bounds the delivery of the queued events when the Manager stops
+	auditFlushTimeout = 10 * time.Second
+
+	// syslogFacility is the local0 facility of the syslog messages
+	syslogFacility = 16
+)
+
+// AuditOptions stream a structured event for each admission decision to the sinks, e.g. to fold them into
+// the logging pipeline of the platform without scraping the container logs. The events are delivered
+// asynchronously: the admissions are never slowed down by a sink, and the events are dropped (and counted in
+// the eirinix_audit_events_dropped_total metric) while the buffer is full.
+type AuditOptions struct {
+	// Sinks receive the events, see NewSyslogAuditSink, NewPublisherAuditSink and AuditSinkFunc
+	Sinks []AuditSink
+
+	// BufferSize is the number of events queued for the sinks. Optional, defaults to 1000
+	BufferSize int
+}
+
+func (o *AuditOptions) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if len(o.Sinks) == 0 {
+		errs = append(errs, field.Required(path.Child("sinks"), "at least one sink is required"))
+	}
+	for i, s := range o.Sinks {
+		if s == nil {
+			errs = append(errs, field.Required(path.Child("sinks").Index(i), "must not be nil"))
+		}
+	}
+	if o.BufferSize < 0 {
+		errs = append(errs, field.Invalid(path.Child("bufferSize"), o.BufferSize, "must not be negative"))
+	}
+	return errs
+}
+
+// AuditEvent is the structured record of an admission decision
+type AuditEvent struct {
+	Time time.Time `json:"time"`
+	// Operator is the OperatorFingerprint of the Manager
+	Operator  string `json:"operator"`
+	Extension string `json:"extension"`
+	Webhook   string `json:"webhook"`
+
+	UID       string `json:"uid"`
+	Operation string `json:"operation"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	User      string `json:"user,omitempty"`
+	DryRun    bool   `json:"dryRun,omitempty"`
+	// SourceAddress is the address of the client, resolved behind the front proxy, see FrontProxyOptions
+	SourceAddress string `json:"sourceAddress,omitempty"`
+	// AppGUID is the GUID of the Eirini app of the pod, if any
+	AppGUID string `json:"appGUID,omitempty"`
+
+	// Result is allowed, denied or errored
+	Result string `json:"result"`
+	// Code and Message are the ones of the response status, if any
+	Code    int32  `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	// PatchOperations is the number of operations of the patch
+	PatchOperations  int               `json:"patchOperations,omitempty"`
+	AuditAnnotations map[string]string `json:"auditAnnotations,omitempty"`
+	LatencySeconds   float64           `json:"latencySeconds"`
+}
+
+// AuditSink delivers the audit events. Send is called from a single goroutine, in the order of the decisions.
+type AuditSink interface {
+	Send(ctx context.Context, event AuditEvent) error
+}
+
+// AuditSinkFunc adapts a function to an AuditSink
+type AuditSinkFunc func(ctx context.Context, event AuditEvent) error
+
+// Send calls the function
+func (f AuditSinkFunc) Send(ctx context.Context, event AuditEvent) error {
+	return f(ctx, event)
+}
+
+// auditLog queues the events of the webhooks, and delivers them to the sinks
+type auditLog struct {
+	operator string
+	sinks    []AuditSink
+	events   chan AuditEvent
+	logger   *zap.SugaredLogger
+}
+
+func newAuditLog(opts AuditOptions, operator string, logger *zap.SugaredLogger) *auditLog {
+	size := opts.BufferSize
+	if size == 0 {
+		size = defaultAuditBufferSize
+	}
+	return &auditLog{operator: operator, sinks: opts.Sinks, events: make(chan AuditEvent, size), logger: logger}
+}
+
+// record queues the event, or drops it if the buffer is full
+func (a *auditLog) record(e AuditEvent) {
+	if a == nil {
+		return
+	}
+	e.Operator = a.operator
+	select {
+	case a.events <- e:
+	default:
+		auditEventsDropped.WithLabelValues().Inc()
+	}
+}
+
+// NeedLeaderElection makes every replica deliver the events of the requests it served
+func (a *auditLog) NeedLeaderElection() bool {
+	return false
+}
+
+// Start delivers the events until the stop channel is closed, then the queued ones for up to 10 seconds
+func (a *auditLog) Start(stop <-chan struct{}) error {
+	for {
+		select {
+		case <-stop:
+			a.flush(auditFlushTimeout)
+			return nil
+		case e := <-a.events:
+			a.send(context.Background(), e)
+		}
+	}
+}
+
+// flush delivers the queued events until the timeout expires, the remaining ones are dropped
+func (a *auditLog) flush(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		if ctx.Err() != nil {
+			if dropped := len(a.events); dropped > 0 {
+				auditEventsDropped.WithLabelValues().Add(float64(dropped))
+				a.logger.Warnf("Dropping %d audit events not delivered in %s", dropped, timeout)
+			}
+			return
+		}
+		select {
+		case e := <-a.events:
+			a.send(ctx, e)
+		default:
+			return
+		}
+	}
+}
+
+func (a *auditLog) send(ctx context.Context, e AuditEvent) {
+	for _, s := range a.sinks {
+		sendCtx, cancel := context.WithTimeout(ctx, auditSendTimeout)
+		err := s.Send(sendCtx, e)
+		cancel()
+		if err != nil {
+			sink := fmt.Sprintf("%T", s)
+			auditSinkErrors.WithLabelValues(sink).Inc()
+			a.logger.Warnf("Sending the audit event of %s to %s: %s", e.UID, sink, err)
+		}
+	}
+}
+
+// auditEvent returns the event of the decision of the webhook
+func (w *DefaultMutatingWebhook) auditEvent(ctx context.Context, req admission.Request, res admission.Response, start time.Time, latency time.Duration) AuditEvent {
+	e := AuditEvent{
+		Time:             start,
+		Extension:        extensionName(w.EiriniExtension),
+		Webhook:          w.Name,
+		UID:              string(req.UID),
+		Operation:        string(req.Operation),
+		Kind:             req.Kind.Kind,
+		Namespace:        req.Namespace,
+		Name:             req.Name,
+		User:             req.UserInfo.Username,
+		DryRun:           req.DryRun != nil && *req.DryRun,
+		SourceAddress:    SourceAddressFromContext(ctx),
+		Result:           admissionResult(res),
+		AuditAnnotations: res.AuditAnnotations,
+		LatencySeconds:   latency.Seconds(),
+	}
+	if res.Result != nil {
+		e.Code = res.Result.Code
+		e.Message = res.Result.Message
+	}
+	if ops, err := podwebhook.ResponsePatches(res); err == nil {
+		e.PatchOperations = len(ops)
+	}
+
+	// Only the labels of the object are decoded
+	var object struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	if len(req.Object.Raw) > 0 && json.Unmarshal(req.Object.Raw, &object) == nil {
+		layout := w.EiriniLayout
+		if layout.Release == "" {
+			layout = legacyLayout
+		}
+		e.AppGUID = object.Metadata.Labels[layout.LabelAppGUID]
+	}
+	return e
+}
+
+// NewPublisherAuditSink returns an AuditSink publishing the JSON events to a subject or topic of a message
+// broker, e.g. with the Publish method of a NATS connection:
+//
+//	eirinix.NewPublisherAuditSink("cf.audit.admission", nc.Publish)
+func NewPublisherAuditSink(subject string, publish func(subject string, data []byte) error) AuditSink {
+	return AuditSinkFunc(func(_ context.Context, e AuditEvent) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return publish(subject, data)
+	})
+}
+
+// NewSyslogAuditSink returns an AuditSink sending the events as RFC 5424 syslog messages, with the JSON event
+// as message, to a syslog server over udp or tcp (with the octet counting framing of RFC 6587). The connection
+// is established with the first event, and again after a failure.
+func NewSyslogAuditSink(network, address, appName string) AuditSink {
+	hostname, _ := os.Hostname()
+	return &syslogAuditSink{
+		network:  network,
+		address:  address,
+		appName:  appName,
+		hostname: hostname,
+		dialer:   &net.Dialer{},
+	}
+}
+
+type syslogAuditSink struct {
+	network, address  string
+	appName, hostname string
+	dialer            *net.Dialer
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (s *syslogAuditSink) Send(ctx context.Context, e AuditEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	msg := s.format(e, data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := s.dialer.DialContext(ctx, s.network, s.address)
+		if err != nil {
+			return errors.Wrapf(err, "connecting to the syslog server %s", s.address)
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+	if _, err := s.conn.Write(msg); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return errors.Wrap(err, "writing the syslog message")
+	}
+	return nil
+}
+
+// format returns the RFC 5424 message, framed for tcp
+func (s *syslogAuditSink) format(e AuditEvent, data []byte) []byte {
+	severity := 6 // informational
+	switch e.Result {
+	case "denied":
+		severity = 4 // warning
+	case "errored":
+		severity = 3 // error
+	}
+	hostname, appName := s.hostname, s.appName
+	if hostname == "" {
+		hostname = "-"
+	}
+	if appName == "" {
+		appName = "-"
+	}
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d admission - %s", syslogFacility*8+severity,
+		e.Time.UTC().Format(time.RFC3339Nano), hostname, appName, os.Getpid(), data)
+	if s.network == "udp" || s.network == "udp4" || s.network == "udp6" {
+		return []byte(msg)
+	}
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
@@ -0,0 +1,260 @@
+package extension_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var _ = Describe("Audit", func() {
+	Context("with a manager", func() {
+		var (
+			eiriniManager *DefaultExtensionManager
+			events        chan AuditEvent
+		)
+
+		BeforeEach(func() {
+			events = make(chan AuditEvent, 10)
+			registerWebhooks := false
+			m, err := NewManager(ManagerOptions{
+				Namespace:       "eirini",
+				Host:            "127.0.0.1",
+				Port:            4545,
+				RegisterWebHook: &registerWebhooks,
+				// No decoder is injected, so the webhooks error
+				DecodeErrorPolicy: DecodeErrorDeny,
+				Audit: &AuditOptions{Sinks: []AuditSink{AuditSinkFunc(func(_ context.Context, e AuditEvent) error {
+					events <- e
+					return nil
+				})}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			eiriniManager = m.(*DefaultExtensionManager)
+			eiriniManager.KubeManager = &cfakes.FakeManager{}
+			eiriniManager.WebhookServer = &webhook.Server{}
+		})
+
+		It("streams the decisions of the webhooks to the sinks", func() {
+			Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			// The audit log is the only runnable named after it
+			fakeManager := eiriniManager.KubeManager.(*cfakes.FakeManager)
+			var audit manager.Runnable
+			for i := 0; i < fakeManager.AddCallCount(); i++ {
+				if r := fakeManager.AddArgsForCall(i); fmt.Sprintf("%T", r) == "*extension.auditLog" {
+					audit = r
+				}
+			}
+			Expect(audit).ToNot(BeNil())
+			stop := make(chan struct{})
+			defer close(stop)
+			go audit.Start(stop)
+
+			// No decoder is injected, so the webhook errors
+			req := httptest.NewRequest(http.MethodPost, "/0", bytes.NewReader(reviewBody()))
+			req.Header.Set("Content-Type", "application/json")
+			eiriniManager.WebhookServer.WebhookMux.ServeHTTP(httptest.NewRecorder(), req)
+
+			var e AuditEvent
+			Eventually(events).Should(Receive(&e))
+			Expect(e.Operator).To(Equal("eirini-x"))
+			Expect(e.Extension).To(Equal("*testing.EditEnvExtension"))
+			Expect(e.Webhook).To(Equal("0.eirini-x.org"))
+			Expect(e.UID).To(Equal(string(podRequest().UID)))
+			Expect(e.Operation).To(Equal("CREATE"))
+			Expect(e.Kind).To(Equal("Pod"))
+			Expect(e.Result).To(Equal("errored"))
+			Expect(e.Message).To(ContainSubstring("No decoder injected"))
+		})
+
+		It("delivers the queued events when stopping", func() {
+			Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			fakeManager := eiriniManager.KubeManager.(*cfakes.FakeManager)
+			var audit manager.Runnable
+			for i := 0; i < fakeManager.AddCallCount(); i++ {
+				if r := fakeManager.AddArgsForCall(i); fmt.Sprintf("%T", r) == "*extension.auditLog" {
+					audit = r
+				}
+			}
+			Expect(audit).ToNot(BeNil())
+
+			// The events are queued before the audit log starts, and it is stopped right away
+			for i := 0; i < 3; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/0", bytes.NewReader(reviewBody()))
+				req.Header.Set("Content-Type", "application/json")
+				eiriniManager.WebhookServer.WebhookMux.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			stop := make(chan struct{})
+			close(stop)
+			Expect(audit.Start(stop)).To(Succeed())
+			Expect(events).To(HaveLen(3))
+		})
+	})
+
+	Context("behind a front proxy", func() {
+		var (
+			eiriniManager *DefaultExtensionManager
+			events        chan AuditEvent
+			stop          chan struct{}
+			addr          string
+		)
+
+		BeforeEach(func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			port := listener.Addr().(*net.TCPAddr).Port
+			Expect(listener.Close()).To(Succeed())
+			addr = fmt.Sprintf("127.0.0.1:%d", port)
+
+			events = make(chan AuditEvent, 10)
+			registerWebhooks := false
+			m, err := NewManager(ManagerOptions{
+				Namespace:            "eirini",
+				Host:                 "127.0.0.1",
+				Port:                 int32(port),
+				RegisterWebHook:      &registerWebhooks,
+				SetupCertificateName: "test-audit-proxy",
+				FrontProxy:           &FrontProxyOptions{ProxyProtocol: true, TrustedCIDRs: []string{"127.0.0.1/32"}},
+				Audit: &AuditOptions{Sinks: []AuditSink{AuditSinkFunc(func(_ context.Context, e AuditEvent) error {
+					events <- e
+					return nil
+				})}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			eiriniManager = m.(*DefaultExtensionManager)
+			eiriniManager.Context = catalog.NewContext()
+			eiriniManager.Credsgen = NewCredentialGenerator()
+			stop = make(chan struct{})
+		})
+
+		AfterEach(func() {
+			close(stop)
+			os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+		})
+
+		It("records the client address advertised by the proxy", func() {
+			kubeManager := &cfakes.FakeManager{}
+			kubeManager.GetClientReturns(&cfakes.FakeClient{})
+			eiriniManager.KubeManager = kubeManager
+			Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+			for i := 0; i < kubeManager.AddCallCount(); i++ {
+				go kubeManager.AddArgsForCall(i).Start(stop)
+			}
+
+			// Every connection starts with the PROXY header of the client
+			client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint:gosec
+				DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+					if err != nil {
+						return nil, err
+					}
+					if _, err := conn.Write([]byte("PROXY TCP4 10.1.2.3 10.0.0.1 4242 443\r\n")); err != nil {
+						conn.Close()
+						return nil, err
+					}
+					return conn, nil
+				},
+			}}
+			Eventually(func() error {
+				res, err := client.Post("https://"+addr+"/0", "application/json", bytes.NewReader(reviewBody()))
+				if err == nil {
+					res.Body.Close()
+				}
+				return err
+			}).Should(Succeed())
+
+			var e AuditEvent
+			Eventually(events).Should(Receive(&e))
+			Expect(e.UID).To(Equal(string(podRequest().UID)))
+			Expect(e.SourceAddress).To(Equal("10.1.2.3:4242"))
+		})
+	})
+
+	It("rejects the options without sinks", func() {
+		opts := ManagerOptions{Namespace: "eirini", Host: "127.0.0.1", Port: 4545, Audit: &AuditOptions{BufferSize: -1}}
+		err := opts.Validate()
+		Expect(err).To(MatchError(ContainSubstring("audit.sinks")))
+		Expect(err).To(MatchError(ContainSubstring("audit.bufferSize")))
+	})
+
+	It("publishes the JSON events", func() {
+		var subject string
+		var data []byte
+		sink := NewPublisherAuditSink("cf.audit.admission", func(s string, d []byte) error {
+			subject, data = s, d
+			return nil
+		})
+		Expect(sink.Send(context.Background(), AuditEvent{UID: "uid", Result: "allowed"})).To(Succeed())
+		Expect(subject).To(Equal("cf.audit.admission"))
+
+		var e AuditEvent
+		Expect(json.Unmarshal(data, &e)).To(Succeed())
+		Expect(e.UID).To(Equal("uid"))
+	})
+
+	It("sends RFC 5424 messages over udp", func() {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		sink := NewSyslogAuditSink("udp", conn.LocalAddr().String(), "eirinix")
+		Expect(sink.Send(context.Background(), AuditEvent{UID: "uid", Result: "denied", Time: time.Unix(0, 0)})).To(Succeed())
+
+		buf := make([]byte, 4096)
+		Expect(conn.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+		n, _, err := conn.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+		msg := string(buf[:n])
+		Expect(msg).To(HavePrefix("<132>1 1970-01-01T00:00:00Z "))
+		Expect(msg).To(ContainSubstring(" eirinix "))
+		Expect(msg).To(ContainSubstring(` admission - {"time":`))
+	})
+
+	It("frames the messages with their length over tcp", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+		received := make(chan string, 1)
+		go func() {
+			defer GinkgoRecover()
+			conn, err := l.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			buf := make([]byte, 4096)
+			n, _ := conn.Read(buf)
+			received <- string(buf[:n])
+		}()
+
+		sink := NewSyslogAuditSink("tcp", l.Addr().String(), "eirinix")
+		Expect(sink.Send(context.Background(), AuditEvent{UID: "uid", Result: "allowed"})).To(Succeed())
+
+		var msg string
+		Eventually(received, 5*time.Second).Should(Receive(&msg))
+		parts := strings.SplitN(msg, " ", 2)
+		Expect(parts[0]).To(Equal(fmt.Sprint(len(parts[1]))))
+		Expect(parts[1]).To(HavePrefix("<134>1 "))
+	})
+})
@@ -0,0 +1,189 @@
+package extension
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultTargetSaturation     = 0.7
+	autoscalerReconcileInterval = time.Minute
+
+	// saturationMetric is the per-pod metric the HorizontalPodAutoscaler scales on, see BackpressureOptions
+	saturationMetric = "eirinix_admission_saturation_ratio"
+)
+
+var hpaGVK = schema.GroupVersionKind{Group: "autoscaling", Version: "v2beta2", Kind: "HorizontalPodAutoscaler"}
+
+// AutoscalingOptions make the Manager own a HorizontalPodAutoscaler scaling the operator Deployment on the
+// saturation of its webhook servers, the eirinix_admission_saturation_ratio metric exported with Backpressure.
+//
+// The metric must be served to the custom metrics API of the cluster, e.g. by the prometheus adapter.
+type AutoscalingOptions struct {
+	// Deployment is the name of the operator Deployment
+	Deployment string
+
+	// Namespace is the namespace of the Deployment. Optional, defaults to WebhookNamespace
+	Namespace string
+
+	// MinReplicas and MaxReplicas bound the replicas of the Deployment. MinReplicas is optional, defaults to 1
+	MinReplicas int32
+	MaxReplicas int32
+
+	// TargetSaturation is the average saturation of the replicas the autoscaler aims for, between 0 and 1.
+	// Optional, defaults to 0.7
+	TargetSaturation float64
+}
+
+func (a *AutoscalingOptions) validate(path *field.Path, o *ManagerOptions) field.ErrorList {
+	var errs field.ErrorList
+	if a.Deployment == "" {
+		errs = append(errs, field.Required(path.Child("deployment"), ""))
+	}
+	if a.Namespace == "" && o.WebhookNamespace == "" {
+		errs = append(errs, field.Required(path.Child("namespace"), "required when webhookNamespace is not set"))
+	}
+	if a.MinReplicas < 0 {
+		errs = append(errs, field.Invalid(path.Child("minReplicas"), a.MinReplicas, "must not be negative"))
+	}
+	if a.MaxReplicas < 1 || a.MaxReplicas < a.MinReplicas {
+		errs = append(errs, field.Invalid(path.Child("maxReplicas"), a.MaxReplicas, "must be positive and not less than minReplicas"))
+	}
+	if a.TargetSaturation < 0 || a.TargetSaturation > 1 {
+		errs = append(errs, field.Invalid(path.Child("targetSaturation"), a.TargetSaturation, "must be between 0 and 1"))
+	}
+	if o.Backpressure == nil {
+		errs = append(errs, field.Required(field.NewPath("backpressure"), "required when autoscaling is set, to export the saturation"))
+	}
+	return errs
+}
+
+func (m *DefaultExtensionManager) autoscalerKey() machinerytypes.NamespacedName {
+	opts := m.Options.Autoscaling
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = m.Options.WebhookNamespace
+	}
+	return machinerytypes.NamespacedName{Name: opts.Deployment, Namespace: namespace}
+}
+
+// desiredAutoscalerSpec returns the spec of the HorizontalPodAutoscaler
+func (m *DefaultExtensionManager) desiredAutoscalerSpec() map[string]interface{} {
+	opts := m.Options.Autoscaling
+	minReplicas := opts.MinReplicas
+	if minReplicas == 0 {
+		minReplicas = 1
+	}
+	target := opts.TargetSaturation
+	if target == 0 {
+		target = defaultTargetSaturation
+	}
+
+	return map[string]interface{}{
+		"scaleTargetRef": map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"name":       opts.Deployment,
+		},
+		"minReplicas": int64(minReplicas),
+		"maxReplicas": int64(opts.MaxReplicas),
+		"metrics": []interface{}{map[string]interface{}{
+			"type": "Pods",
+			"pods": map[string]interface{}{
+				"metric": map[string]interface{}{"name": saturationMetric},
+				"target": map[string]interface{}{
+					"type":         "AverageValue",
+					"averageValue": resource.NewMilliQuantity(int64(target*1000), resource.DecimalSI).String(),
+				},
+			},
+		}},
+	}
+}
+
+// reconcileAutoscaler creates the HorizontalPodAutoscaler of the operator Deployment, or brings it back to
+// the desired state. The behavior of the autoscaler is kept as it is, so that it can be tuned by hand
+func (m *DefaultExtensionManager) reconcileAutoscaler(ctx context.Context) error {
+	c := m.KubeManager.GetClient()
+	key := m.autoscalerKey()
+
+	hpa := &unstructured.Unstructured{}
+	hpa.SetGroupVersionKind(hpaGVK)
+	err := c.Get(ctx, key, hpa)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "getting the operator autoscaler")
+	}
+	create := apierrors.IsNotFound(err)
+	if create {
+		hpa = &unstructured.Unstructured{Object: map[string]interface{}{}}
+		hpa.SetGroupVersionKind(hpaGVK)
+		hpa.SetName(key.Name)
+		hpa.SetNamespace(key.Namespace)
+	}
+	before := hpa.DeepCopy()
+
+	labels := hpa.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[LabelManagedBy] = m.Options.OperatorFingerprint
+	hpa.SetLabels(labels)
+
+	spec, _, _ := unstructured.NestedMap(hpa.Object, "spec")
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	for k, v := range m.desiredAutoscalerSpec() {
+		spec[k] = v
+	}
+	if err := unstructured.SetNestedMap(hpa.Object, spec, "spec"); err != nil {
+		return errors.Wrap(err, "setting the operator autoscaler spec")
+	}
+
+	if create {
+		return errors.Wrap(c.Create(ctx, hpa), "creating the operator autoscaler")
+	}
+	if reflect.DeepEqual(before.Object, hpa.Object) {
+		return nil
+	}
+	return errors.Wrap(c.Update(ctx, hpa), "updating the operator autoscaler")
+}
+
+// autoscalerReconciler periodically reconciles the HorizontalPodAutoscaler, restoring it if it was changed
+// or deleted
+type autoscalerReconciler struct {
+	manager *DefaultExtensionManager
+	logger  *zap.SugaredLogger
+}
+
+// NeedLeaderElection makes the reconciler run on the leader only
+func (r *autoscalerReconciler) NeedLeaderElection() bool {
+	return true
+}
+
+// Start reconciles the HorizontalPodAutoscaler until the stop channel is closed
+func (r *autoscalerReconciler) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	wait.Until(func() {
+		if err := r.manager.reconcileAutoscaler(ctx); err != nil {
+			r.logger.Errorf("Reconciling the operator autoscaler: %s", err.Error())
+		}
+	}, autoscalerReconcileInterval, stop)
+	return nil
+}
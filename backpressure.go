@@ -0,0 +1,115 @@
+package extension
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// defaultRetryAfter is the Retry-After of the throttled requests when BackpressureOptions.RetryAfter is omitted
+const defaultRetryAfter = time.Second
+
+// BackpressureOptions limit the admission requests served concurrently by a replica. The requests above the
+// limit are answered with a 429 and a Retry-After header, which the kube api server honours by retrying the
+// call until the webhook timeout, instead of piling up on an overloaded replica. The in-flight requests and the
+// saturation of the replicas are exported as metrics, to scale the operator on them.
+type BackpressureOptions struct {
+	// MaxInFlight is the maximum number of admission requests served concurrently
+	MaxInFlight int
+
+	// MaxWait is how long a request above the limit waits for a slot before being throttled. Optional,
+	// defaults to throttling immediately
+	MaxWait time.Duration
+
+	// RetryAfter is the delay advertised to the throttled clients. Optional, defaults to one second
+	RetryAfter time.Duration
+}
+
+func (o *BackpressureOptions) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if o.MaxInFlight <= 0 {
+		errs = append(errs, field.Invalid(path.Child("maxInFlight"), o.MaxInFlight, "must be positive"))
+	}
+	if o.MaxWait < 0 {
+		errs = append(errs, field.Invalid(path.Child("maxWait"), o.MaxWait.String(), "must not be negative"))
+	}
+	if o.RetryAfter < 0 {
+		errs = append(errs, field.Invalid(path.Child("retryAfter"), o.RetryAfter.String(), "must not be negative"))
+	}
+	return errs
+}
+
+// retryAfterSeconds returns the Retry-After header value, which is a whole number of seconds
+func (o *BackpressureOptions) retryAfterSeconds() string {
+	retryAfter := o.RetryAfter
+	if retryAfter == 0 {
+		retryAfter = defaultRetryAfter
+	}
+	return strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+}
+
+// NewBackpressureHandler returns an http.Handler serving at most opts.MaxInFlight requests concurrently with
+// next, and answering the others with a 429 once they waited opts.MaxWait
+func NewBackpressureHandler(next http.Handler, opts BackpressureOptions) http.Handler {
+	admissionMaxInFlight.WithLabelValues().Set(float64(opts.MaxInFlight))
+	return &backpressureHandler{
+		next:       next,
+		opts:       opts,
+		slots:      make(chan struct{}, opts.MaxInFlight),
+		retryAfter: opts.retryAfterSeconds(),
+	}
+}
+
+type backpressureHandler struct {
+	next       http.Handler
+	opts       BackpressureOptions
+	slots      chan struct{}
+	retryAfter string
+}
+
+func (h *backpressureHandler) acquire(r *http.Request) bool {
+	select {
+	case h.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if h.opts.MaxWait == 0 {
+		return false
+	}
+
+	timer := time.NewTimer(h.opts.MaxWait)
+	defer timer.Stop()
+	select {
+	case h.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (h *backpressureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.acquire(r) {
+		admissionThrottled.WithLabelValues().Inc()
+		w.Header().Set("Retry-After", h.retryAfter)
+		http.Error(w, "Too many admission requests in flight", http.StatusTooManyRequests)
+		return
+	}
+	h.observe()
+	defer func() {
+		<-h.slots
+		h.observe()
+	}()
+
+	h.next.ServeHTTP(w, r)
+}
+
+func (h *backpressureHandler) observe() {
+	inFlight := len(h.slots)
+	admissionInFlight.WithLabelValues().Set(float64(inFlight))
+	admissionSaturation.WithLabelValues().Set(float64(inFlight) / float64(h.opts.MaxInFlight))
+}
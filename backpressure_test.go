@@ -0,0 +1,76 @@
+package extension_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backpressure", func() {
+	var (
+		release chan struct{}
+		started chan struct{}
+		next    http.Handler
+	)
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+		started = make(chan struct{}, 10)
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-release
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	serve := func(h http.Handler) chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+			done <- rec
+		}()
+		return done
+	}
+
+	It("throttles the requests above the limit", func() {
+		h := NewBackpressureHandler(next, BackpressureOptions{MaxInFlight: 1, RetryAfter: 1500 * time.Millisecond})
+		first := serve(h)
+		Eventually(started).Should(Receive())
+
+		var rec *httptest.ResponseRecorder
+		Eventually(serve(h)).Should(Receive(&rec))
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("2"))
+
+		close(release)
+		Eventually(first).Should(Receive(&rec))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+
+	It("waits for a slot up to MaxWait", func() {
+		h := NewBackpressureHandler(next, BackpressureOptions{MaxInFlight: 1, MaxWait: time.Minute})
+		first := serve(h)
+		Eventually(started).Should(Receive())
+		second := serve(h)
+		Consistently(second, 50*time.Millisecond).ShouldNot(Receive())
+
+		close(release)
+		var rec *httptest.ResponseRecorder
+		Eventually(first).Should(Receive(&rec))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Eventually(second).Should(Receive(&rec))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+
+	It("rejects invalid options", func() {
+		opts := ManagerOptions{Backpressure: &BackpressureOptions{MaxWait: -time.Second}}
+		err := opts.Validate()
+		Expect(err).To(MatchError(ContainSubstring("backpressure.maxInFlight")))
+		Expect(err).To(MatchError(ContainSubstring("backpressure.maxWait")))
+	})
+})
@@ -0,0 +1,162 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	defaultBudgetTripCooldown = 30 * time.Second
+
+	budgetResourceCPU    = "cpu"
+	budgetResourceMemory = "memory"
+)
+
+// BudgetOptions bound the resources the handler of each extension may use per admission request, protecting the
+// operator from a runaway extension. The overruns are logged and counted in the
+// eirinix_extension_budget_exceeded_total metric and, with a TripThreshold, open the circuit breaker of the
+// extension, whose webhook then admits the pods unchanged until the TripCooldown expired.
+//
+// The CPU time is the one of the goroutine handling the request, measured on Linux only: the goroutines started
+// by the handler are not accounted. The allocations are the heap bytes allocated by the process while the
+// handler runs, which include the ones of the requests served concurrently: the memory budget catches runaway
+// extensions rather than accounting them precisely, and reading them briefly stops the world.
+type BudgetOptions struct {
+	// CPUTime is the CPU time the handler of an extension may use per request. Optional, defaults to no limit
+	CPUTime time.Duration
+
+	// AllocatedBytes is the heap memory the handler of an extension may allocate per request. Optional,
+	// defaults to no limit
+	AllocatedBytes uint64
+
+	// Extensions overrides the budget of some extensions, indexed by their name in the metrics, e.g.
+	// "*sidecar.Extension". Optional
+	Extensions map[string]ExtensionBudget
+
+	// TripThreshold is the number of consecutive requests over budget opening the circuit breaker of an
+	// extension. Optional, defaults to never opening it
+	TripThreshold int
+
+	// TripCooldown is the time the circuit stays open before a request is let through the extension again.
+	// Optional, defaults to 30s
+	TripCooldown time.Duration
+}
+
+// ExtensionBudget is the budget of an extension handler per request, zero values meaning no limit
+type ExtensionBudget struct {
+	CPUTime        time.Duration
+	AllocatedBytes uint64
+}
+
+func (o *BudgetOptions) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if o.CPUTime < 0 {
+		errs = append(errs, field.Invalid(path.Child("cpuTime"), o.CPUTime.String(), "must not be negative"))
+	}
+	for name, b := range o.Extensions {
+		if b.CPUTime < 0 {
+			errs = append(errs, field.Invalid(path.Child("extensions").Key(name).Child("cpuTime"), b.CPUTime.String(), "must not be negative"))
+		}
+	}
+	if o.TripThreshold < 0 {
+		errs = append(errs, field.Invalid(path.Child("tripThreshold"), o.TripThreshold, "must not be negative"))
+	}
+	if o.TripCooldown < 0 {
+		errs = append(errs, field.Invalid(path.Child("tripCooldown"), o.TripCooldown.String(), "must not be negative"))
+	}
+	return errs
+}
+
+// budgetEnforcer measures the handler of an extension against its budget
+type budgetEnforcer struct {
+	extension string
+	budget    ExtensionBudget
+	// breaker is nil without TripThreshold
+	breaker *circuitBreaker
+}
+
+func newBudgetEnforcer(opts BudgetOptions, extension string) *budgetEnforcer {
+	budget := ExtensionBudget{CPUTime: opts.CPUTime, AllocatedBytes: opts.AllocatedBytes}
+	if b, ok := opts.Extensions[extension]; ok {
+		budget = b
+	}
+	e := &budgetEnforcer{extension: extension, budget: budget}
+	if opts.TripThreshold > 0 {
+		cooldown := opts.TripCooldown
+		if cooldown == 0 {
+			cooldown = defaultBudgetTripCooldown
+		}
+		e.breaker = &circuitBreaker{threshold: opts.TripThreshold, cooldown: cooldown}
+	}
+	return e
+}
+
+// handleBudgeted handles the request measuring the resources used by the extension, see ManagerOptions.Budget.
+// The request is admitted unchanged while the circuit of the extension is open.
+func (w *DefaultMutatingWebhook) handleBudgeted(ctx context.Context, req admission.Request) admission.Response {
+	b := w.budget
+	if b == nil {
+		return w.handleProfiled(ctx, req)
+	}
+	if b.breaker != nil && !b.breaker.allow() {
+		return admission.Allowed("the extension exceeded its resource budget")
+	}
+
+	// The goroutine is locked to its thread, so that the CPU time of the thread is the one of the handler
+	runtime.LockOSThread()
+	cpuStart, cpuOK := threadCPUTime()
+	var allocStart uint64
+	if b.budget.AllocatedBytes > 0 {
+		allocStart = totalAlloc()
+	}
+
+	res := w.handleProfiled(ctx, req)
+
+	var cpu time.Duration
+	if cpuEnd, ok := threadCPUTime(); cpuOK && ok {
+		cpu = cpuEnd - cpuStart
+	}
+	runtime.UnlockOSThread()
+	var allocated uint64
+	if b.budget.AllocatedBytes > 0 {
+		allocated = totalAlloc() - allocStart
+	}
+
+	extensionCPUSeconds.WithLabelValues(b.extension).Add(cpu.Seconds())
+	var exceeded []string
+	if b.budget.CPUTime > 0 && cpu > b.budget.CPUTime {
+		exceeded = append(exceeded, fmt.Sprintf("%s of CPU time (budget %s)", cpu, b.budget.CPUTime))
+		extensionBudgetExceeded.WithLabelValues(b.extension, budgetResourceCPU).Inc()
+	}
+	if b.budget.AllocatedBytes > 0 && allocated > b.budget.AllocatedBytes {
+		exceeded = append(exceeded, fmt.Sprintf("%d allocated bytes (budget %d)", allocated, b.budget.AllocatedBytes))
+		extensionBudgetExceeded.WithLabelValues(b.extension, budgetResourceMemory).Inc()
+	}
+	if len(exceeded) > 0 {
+		ctxlog.Warnf(ctx, "The extension %s exceeded its resource budget: %s", b.extension, strings.Join(exceeded, ", "))
+	}
+
+	if b.breaker != nil {
+		if b.breaker.record(len(exceeded) == 0) {
+			ctxlog.Errorf(ctx, "The extension %s exceeded its resource budget too many times, admitting the pods unchanged for %s", b.extension, b.breaker.cooldown)
+			extensionBudgetTripped.WithLabelValues(b.extension).Set(1)
+		} else {
+			extensionBudgetTripped.WithLabelValues(b.extension).Set(0)
+		}
+	}
+	return res
+}
+
+// totalAlloc returns the cumulative heap bytes allocated by the process
+func totalAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.TotalAlloc
+}
@@ -0,0 +1,18 @@
+package extension
+
+import (
+	"syscall"
+	"time"
+)
+
+// rusageThread is the RUSAGE_THREAD of getrusage, reporting the usage of the calling thread
+const rusageThread = 1
+
+// threadCPUTime returns the user and system CPU time of the calling thread
+func threadCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package extension
+
+import "time"
+
+// threadCPUTime is only supported on Linux, the CPU budgets are not enforced on the other platforms
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
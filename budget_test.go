@@ -0,0 +1,97 @@
+package extension_test
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// greedyExtension allocates a MiB, or spins for 50ms, on each request
+type greedyExtension struct {
+	spin  bool
+	calls int
+	sink  []byte
+}
+
+func (e *greedyExtension) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	e.calls++
+	if e.spin {
+		for start := time.Now(); time.Since(start) < 50*time.Millisecond; {
+		}
+	} else {
+		e.sink = make([]byte, 1<<20)
+	}
+	return admission.Allowed("")
+}
+
+var _ = Describe("Extension budgets", func() {
+	var failurePolicy = admissionregistrationv1beta1.Fail
+
+	budgetedWebhook := func(e Extension, budget BudgetOptions) MutatingWebhook {
+		c := catalog.NewCatalog()
+		w := NewWebhook(e, c.SimpleManager())
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+			ID:             "budget",
+			ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, Budget: &budget},
+		})).To(Succeed())
+		injectDecoder(w)
+		return w
+	}
+
+	It("trips the circuit breaker of the extensions exceeding their memory budget", func() {
+		e := &greedyExtension{}
+		w := budgetedWebhook(e, BudgetOptions{AllocatedBytes: 1 << 10, TripThreshold: 2, TripCooldown: time.Hour})
+
+		for i := 0; i < 3; i++ {
+			Expect(w.Handle(context.Background(), podRequest()).Allowed).To(BeTrue())
+		}
+		Expect(e.calls).To(Equal(2))
+		res := w.Handle(context.Background(), podRequest())
+		Expect(string(res.Result.Reason)).To(ContainSubstring("exceeded its resource budget"))
+	})
+
+	It("uses the budget of the extension", func() {
+		e := &greedyExtension{}
+		w := budgetedWebhook(e, BudgetOptions{
+			AllocatedBytes: 1 << 10,
+			Extensions:     map[string]ExtensionBudget{"*extension_test.greedyExtension": {AllocatedBytes: 1 << 30}},
+			TripThreshold:  1,
+		})
+
+		for i := 0; i < 3; i++ {
+			w.Handle(context.Background(), podRequest())
+		}
+		Expect(e.calls).To(Equal(3))
+	})
+
+	It("measures the CPU time of the handlers", func() {
+		if runtime.GOOS != "linux" {
+			Skip("the CPU time is only measured on Linux")
+		}
+		e := &greedyExtension{spin: true}
+		w := budgetedWebhook(e, BudgetOptions{CPUTime: time.Millisecond, TripThreshold: 1})
+
+		w.Handle(context.Background(), podRequest())
+		w.Handle(context.Background(), podRequest())
+		Expect(e.calls).To(Equal(1))
+	})
+
+	It("rejects negative budgets", func() {
+		opts := ManagerOptions{Namespace: "eirini", Host: "127.0.0.1", Port: 4545, Budget: &BudgetOptions{
+			CPUTime:       -time.Second,
+			TripThreshold: -1,
+		}}
+		err := opts.Validate()
+		Expect(err).To(MatchError(ContainSubstring("budget.cpuTime")))
+		Expect(err).To(MatchError(ContainSubstring("budget.tripThreshold")))
+	})
+})
@@ -0,0 +1,55 @@
+package extension
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CABundleKey is the key of the CA bundle in the ConfigMap published by the Manager
+const CABundleKey = "ca.crt"
+
+// GetCABundle returns the PEM encoded CA certificate the webhook server certificate is signed with,
+// which is the CA bundle of the generated MutatingWebhookConfiguration
+func (m *DefaultExtensionManager) GetCABundle() ([]byte, error) {
+	if m.WebhookConfig == nil || len(m.WebhookConfig.CaCertificate) == 0 {
+		return nil, errors.New("The webhook CA bundle is not available, the certificate is not set up yet")
+	}
+	return m.WebhookConfig.CaCertificate, nil
+}
+
+func (o *ManagerOptions) getCABundleConfigMapName() string {
+	return o.resourceName(NamedCABundle, "")
+}
+
+// publishCABundle stores the CA bundle in a ConfigMap, so that other components calling the webhook can trust it
+func (m *DefaultExtensionManager) publishCABundle(ctx context.Context) error {
+	caBundle, err := m.GetCABundle()
+	if err != nil {
+		return err
+	}
+
+	namespace := m.Options.WebhookNamespace
+	if namespace == "" {
+		namespace = m.Options.Namespace
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      m.Options.getCABundleConfigMapName(),
+			Namespace: namespace,
+		},
+		Data: map[string]string{CABundleKey: string(caBundle)},
+	}
+
+	// The cache of the kubernetes manager is not started yet, so the ConfigMap is updated
+	// unconditionally instead of being read first
+	c := m.KubeManager.GetClient()
+	err = c.Create(ctx, configMap)
+	if k8serrors.IsAlreadyExists(err) {
+		err = c.Update(ctx, configMap)
+	}
+	return err
+}
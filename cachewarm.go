@@ -0,0 +1,98 @@
+package extension
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+var errCacheNotWarm = errors.New("The cache is not warmed up yet")
+
+// CacheWarmingExtension can be implemented by Extensions, Watchers and Reconcilers reading objects from the
+// shared cache of the kubernetes manager, so that those objects are listed before the Manager reports ready
+// and the first admission requests don't wait for a cold cache.
+type CacheWarmingExtension interface {
+	// CachedObjects returns an empty object of each type read from the cache, e.g. &corev1.ConfigMap{}
+	CachedObjects() []runtime.Object
+}
+
+// prewarmedObjects are the types listed when ManagerOptions.PrewarmCache is set
+func prewarmedObjects() []runtime.Object {
+	return []runtime.Object{&corev1.Namespace{}, &corev1.Secret{}, &appsv1.StatefulSet{}}
+}
+
+func prewarmPermissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"namespaces", "secrets"}, Verbs: []string{"list", "watch"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"statefulsets"}, Verbs: []string{"list", "watch"}},
+	}
+}
+
+// cachedObjects returns the types to list into the cache before reporting ready
+func (m *DefaultExtensionManager) cachedObjects() []runtime.Object {
+	var objects []runtime.Object
+	if m.Options.PrewarmCache {
+		objects = append(objects, prewarmedObjects()...)
+	}
+	for _, e := range m.allExtensions() {
+		if w, ok := e.(CacheWarmingExtension); ok {
+			objects = append(objects, w.CachedObjects()...)
+		}
+	}
+	return objects
+}
+
+// cacheWarmer starts the informers of the cached objects and waits for them to be synced
+type cacheWarmer struct {
+	cache   cache.Cache
+	objects []runtime.Object
+	logger  *zap.SugaredLogger
+
+	mu   sync.RWMutex
+	warm bool
+}
+
+// NeedLeaderElection makes every replica warm its own cache
+func (w *cacheWarmer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start lists the objects into the cache, and marks the cache warm once the informers are synced
+func (w *cacheWarmer) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	start := time.Now()
+	for _, o := range w.objects {
+		if _, err := w.cache.GetInformer(ctx, o); err != nil {
+			return errors.Wrapf(err, "starting the informer for %T", o)
+		}
+	}
+	if !w.cache.WaitForCacheSync(stop) {
+		return nil
+	}
+
+	w.mu.Lock()
+	w.warm = true
+	w.mu.Unlock()
+	w.logger.Infof("Cache warmed up in %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (w *cacheWarmer) isWarm() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.warm
+}
@@ -0,0 +1,102 @@
+package extension_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+type configMapCacher struct {
+	catalog.EditEnvExtension
+}
+
+func (e *configMapCacher) CachedObjects() []runtime.Object {
+	return []runtime.Object{&corev1.ConfigMap{}}
+}
+
+var _ = Describe("Cache warm up", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+		informers     *cfakes.FakeCache
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		registerWebhooks := false
+		eiriniManager.Options.RegisterWebHook = &registerWebhooks
+		eiriniManager.WebhookServer = &webhook.Server{}
+
+		informers = &cfakes.FakeCache{}
+		informers.WaitForCacheSyncReturns(true)
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetCacheReturns(informers)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	warmer := func() manager.Runnable {
+		for i := 0; i < kubeManager.AddCallCount(); i++ {
+			if r := kubeManager.AddArgsForCall(i); fmt.Sprintf("%T", r) == "*extension.cacheWarmer" {
+				return r
+			}
+		}
+		return nil
+	}
+
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		eiriniManager.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	It("reports ready without warm up by default", func() {
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(warmer()).To(BeNil())
+		Expect(readyz()).To(Equal(http.StatusOK))
+	})
+
+	It("reports ready once the cache is warm", func() {
+		eiriniManager.Options.PrewarmCache = true
+		Expect(eiriniManager.AddExtension(&configMapCacher{})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(readyz()).To(Equal(http.StatusServiceUnavailable))
+
+		w := warmer()
+		Expect(w).ToNot(BeNil())
+		stop := make(chan struct{})
+		defer close(stop)
+		Expect(w.Start(stop)).To(Succeed())
+
+		Expect(readyz()).To(Equal(http.StatusOK))
+		var started []runtime.Object
+		for i := 0; i < informers.GetInformerCallCount(); i++ {
+			_, o := informers.GetInformerArgsForCall(i)
+			started = append(started, o)
+		}
+		Expect(started).To(ContainElement(&corev1.Namespace{}))
+		Expect(started).To(ContainElement(&corev1.Secret{}))
+		Expect(started).To(ContainElement(&corev1.ConfigMap{}))
+	})
+
+	It("declares the permissions to list the prewarmed objects", func() {
+		eiriniManager.Options.PrewarmCache = true
+		var resources []string
+		for _, rule := range eiriniManager.RequiredPermissions() {
+			resources = append(resources, rule.Resources...)
+		}
+		Expect(resources).To(ContainElement("namespaces"))
+		Expect(resources).To(ContainElement("secrets"))
+		Expect(resources).To(ContainElement("statefulsets"))
+	})
+})
@@ -0,0 +1,198 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// caResyncInterval is the minimum interval between two re-syncs of the CA bundle of a webhook
+	// configuration, as the API server keeps failing the handshakes until the re-sync is observed
+	caResyncInterval = time.Minute
+
+	// caResyncTimeout is the maximum time spent re-syncing the CA bundle of a webhook configuration
+	caResyncTimeout = 10 * time.Second
+
+	tlsRejectedUnknownAuthority = "unknown-authority"
+	tlsRejectedBadCertificate   = "bad-certificate"
+	tlsRejectedExpired          = "expired-certificate"
+)
+
+// tlsRejectionAlerts are the TLS alerts sent by the clients not trusting the webhook server certificate, e.g.
+// when the CA bundle of the webhook configuration doesn't match it, by reason
+var tlsRejectionAlerts = map[string]string{
+	"remote error: tls: unknown certificate authority": tlsRejectedUnknownAuthority,
+	"remote error: tls: bad certificate":               tlsRejectedBadCertificate,
+	"remote error: tls: expired certificate":           tlsRejectedExpired,
+}
+
+// tlsErrorWriter is the error log of a webhook server. It counts the TLS handshakes failed by the clients
+// rejecting the server certificate, and calls onRejected for them.
+type tlsErrorWriter struct {
+	logger      *zap.SugaredLogger
+	certificate string
+	onRejected  func(reason string)
+}
+
+// Write receives a line logged by the http server
+func (w *tlsErrorWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	if !strings.Contains(msg, "TLS handshake error") {
+		w.logger.Error(msg)
+		return len(p), nil
+	}
+	for alert, reason := range tlsRejectionAlerts {
+		if !strings.HasSuffix(msg, alert) {
+			continue
+		}
+		webhookCertificateRejected.WithLabelValues(w.certificate, reason).Inc()
+		w.logger.Warnf("The webhook server certificate %s was rejected by a client (%s): %s", w.certificate, reason, msg)
+		if w.onRejected != nil {
+			w.onRejected(reason)
+		}
+		return len(p), nil
+	}
+	// e.g. the TCP probes of the kubelet
+	w.logger.Debug(msg)
+	return len(p), nil
+}
+
+// caResync rate-limits the re-syncs of the CA bundle of a webhook configuration
+type caResync struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// start returns true if the CA bundle wasn't re-synced within caResyncInterval, and records the re-sync
+func (r *caResync) start(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.last.IsZero() && now.Sub(r.last) < caResyncInterval {
+		return false
+	}
+	r.last = now
+	return true
+}
+
+// certificateRejected returns the callback of the webhook server of the group, re-syncing its CA bundle in the
+// background when the API server rejects the server certificate
+func (m *DefaultExtensionManager) certificateRejected(g *webhookGroup) func(reason string) {
+	resync := &caResync{}
+	return func(reason string) {
+		if !resync.start(time.Now()) {
+			return
+		}
+		go func() {
+			if err := m.resyncCABundle(g); err != nil {
+				caBundleResyncs.WithLabelValues(g.config.setupCertificateName, "failure").Inc()
+				m.Logger.Errorf("Failed re-syncing the CA bundle of the webhook configuration %s: %s", g.config.ConfigName, err.Error())
+				return
+			}
+			caBundleResyncs.WithLabelValues(g.config.setupCertificateName, "success").Inc()
+		}()
+	}
+}
+
+// resyncCABundle reloads the certificate of the webhook server of the group from its secret, regenerating it if
+// the secret was deleted or the certificate expired, and sets its CA in the CA bundle of the live webhook configurations, e.g. after the
+// secret or the configurations were edited by hand. The configurations are only patched by the Manager which
+// registered them.
+func (m *DefaultExtensionManager) resyncCABundle(g *webhookGroup) error {
+	ctx := m.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, caResyncTimeout)
+	defer cancel()
+
+	// The configurations aren't registered again meanwhile, see registerWebhookConfigurations
+	m.failurePolicyMu.Lock()
+	defer m.failurePolicyMu.Unlock()
+
+	if m.Options.SetupCertificate == nil || *m.Options.SetupCertificate {
+		if err := g.config.setupCertificate(ctx); err != nil {
+			return errors.Wrap(err, "reloading the webhook server certificate")
+		}
+		// The provided certificates are renewed by the operator, see TLSOptions
+		if expiry, err := g.config.certificateExpiry(); err == nil && time.Now().After(expiry) && g.config.providedTLS == nil {
+			m.Logger.Warnf("Renewing the webhook server certificate %s, expired at %s", g.config.setupCertificateName, expiry.UTC().Format(time.RFC3339))
+			if err := g.config.renewCertificate(ctx); err != nil {
+				return errors.Wrap(err, "renewing the webhook server certificate")
+			}
+		}
+		m.exportCertificateExpiry(g.config)
+		if m.Options.PublishCABundle && g.config == m.WebhookConfig {
+			if err := m.publishCABundle(ctx); err != nil {
+				return errors.Wrap(err, "publishing the webhook CA bundle")
+			}
+		}
+	}
+
+	if !m.webhooksConfigured {
+		return nil
+	}
+	if err := g.config.patchCABundle(ctx, g.webhooks); err != nil {
+		return err
+	}
+	m.Logger.Infof("Re-synced the CA bundle of the webhook configuration %s", g.config.ConfigName)
+	return nil
+}
+
+// patchCABundle sets the CA bundle of the webhooks of the live mutating and validating configurations
+func (f *WebhookConfig) patchCABundle(ctx context.Context, webhooks []MutatingWebhook) error {
+	mutating, validating := splitWebhooks(webhooks)
+	if f.ValidatingConfigName == "" {
+		mutating, validating = webhooks, nil
+	}
+
+	for _, c := range []struct {
+		config runtime.Object
+		count  int
+	}{
+		{&admissionregistrationv1beta1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: f.ConfigName}}, len(mutating)},
+		{&admissionregistrationv1beta1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: f.ValidatingConfigName}}, len(validating)},
+	} {
+		if c.count == 0 {
+			continue
+		}
+		ops := make([]map[string]interface{}, 0, c.count)
+		for i := 0; i < c.count; i++ {
+			// add replaces the CA bundle, and sets it if it was removed
+			ops = append(ops, map[string]interface{}{"op": "add", "path": fmt.Sprintf("/webhooks/%d/clientConfig/caBundle", i), "value": f.CaCertificate})
+		}
+		patch, err := json.Marshal(ops)
+		if err != nil {
+			return err
+		}
+		config, err := f.versioned(c.config)
+		if err != nil {
+			return err
+		}
+		if err := f.client.Patch(ctx, config, client.RawPatch(machinerytypes.JSONPatchType, patch)); err != nil {
+			return errors.Wrap(err, "patching the CA bundle of the webhook configuration")
+		}
+	}
+	return nil
+}
+
+// watchCertificateRejections makes the webhook server of the group re-sync its CA bundle when the server
+// certificate is rejected
+func (m *DefaultExtensionManager) watchCertificateRejections(s *admissionServer, g *webhookGroup) {
+	if g.config == nil {
+		return
+	}
+	s.certificate = g.config.setupCertificateName
+	s.onCertificateRejected = m.certificateRejected(g)
+}
@@ -0,0 +1,109 @@
+package extension_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var _ = Describe("CA bundle re-sync", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+		client        *cfakes.FakeClient
+		addr          string
+	)
+
+	BeforeEach(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		port := listener.Addr().(*net.TCPAddr).Port
+		Expect(listener.Close()).To(Succeed())
+		addr = net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.Port = int32(port)
+		eiriniManager.Options.SetupCertificateName = "test-caresync-setupcert"
+		eiriniManager.Credsgen = NewCredentialGenerator()
+		Expect(eiriniManager.AddExtension(c.SimpleExtension())).To(Succeed())
+
+		client = &cfakes.FakeClient{}
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+	})
+
+	// reject makes a TLS handshake with the webhook server, rejecting its certificate as an API server
+	// configured with another CA bundle
+	reject := func() error {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: x509.NewCertPool(), ServerName: "127.0.0.1"})
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	It("re-syncs the CA bundle when the API server rejects the webhook server certificate", func() {
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go kubeManager.AddArgsForCall(0).Start(stop)
+		Eventually(reject).Should(MatchError(ContainSubstring("certificate")))
+
+		Eventually(client.PatchCallCount).Should(Equal(1))
+		_, object, patch, _ := client.PatchArgsForCall(0)
+		config := object.(*admissionregistrationv1beta1.MutatingWebhookConfiguration)
+		Expect(config.Name).To(Equal(eiriniManager.WebhookConfig.ConfigName))
+		data, err := patch.Data(object)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"path":"/webhooks/0/clientConfig/caBundle"`))
+		Expect(string(data)).To(ContainSubstring(base64.StdEncoding.EncodeToString(eiriniManager.WebhookConfig.CaCertificate)))
+
+		rec := httptest.NewRecorder()
+		promhttp.HandlerFor(crmetrics.Registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(rec.Body.String()).To(ContainSubstring(`eirinix_webhook_certificate_rejected_total{certificate="test-caresync-setupcert"`))
+		Expect(rec.Body.String()).To(ContainSubstring(`eirinix_webhook_ca_bundle_resyncs_total{certificate="test-caresync-setupcert",result="success"}`))
+
+		// The re-syncs are rate-limited
+		Expect(reject()).ToNot(Succeed())
+		Consistently(client.PatchCallCount, 500*time.Millisecond).Should(Equal(1))
+	})
+
+	It("doesn't patch the webhook configuration registered by another binary", func() {
+		disabled := false
+		eiriniManager.Options.RegisterWebHook = &disabled
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go kubeManager.AddArgsForCall(0).Start(stop)
+		Eventually(reject).Should(MatchError(ContainSubstring("certificate")))
+
+		Consistently(client.PatchCallCount, 500*time.Millisecond).Should(Equal(0))
+	})
+})
@@ -0,0 +1,309 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// AnnotationInjectCAFrom is set on the webhook configurations when the certificates are issued by
+	// cert-manager, so that its CA injector keeps their CA bundle in sync with the CA of the Certificate
+	AnnotationInjectCAFrom = "cert-manager.io/inject-ca-from"
+
+	// IssuerKindIssuer and IssuerKindClusterIssuer are the kinds of the cert-manager issuers
+	IssuerKindIssuer        = "Issuer"
+	IssuerKindClusterIssuer = "ClusterIssuer"
+
+	defaultCertManagerTimeout = 2 * time.Minute
+
+	// certManagerPollInterval is the interval between the checks for the issued secret at startup
+	certManagerPollInterval = 2 * time.Second
+
+	// certManagerSyncInterval is the interval between the reloads of the secrets renewed by cert-manager
+	certManagerSyncInterval = time.Minute
+)
+
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// CertManagerOptions delegate the issuance of the webhook server certificates to cert-manager, instead of
+// generating them with the CredentialGenerator: the Manager creates a Certificate per webhook server, named
+// and stored in the secret of SetupCertificateName, waits for cert-manager to issue it, and annotates the
+// webhook configurations with AnnotationInjectCAFrom. The renewed certificates are reloaded by the webhook
+// servers, and the CA bundles are rotated by the CA injector of cert-manager.
+//
+// The issuer must set the ca.crt key of the secret, e.g. a CA issuer or a self-signed one.
+type CertManagerOptions struct {
+	// IssuerName is the name of the Issuer or ClusterIssuer signing the certificates
+	IssuerName string
+
+	// IssuerKind is IssuerKindIssuer, in the webhook namespace, or IssuerKindClusterIssuer. Optional, defaults
+	// to IssuerKindIssuer
+	IssuerKind string
+
+	// Duration is the lifetime of the certificates. Optional, defaults to the cert-manager default, 90 days
+	Duration time.Duration
+
+	// Timeout is the maximum time to wait for the secret to be issued. Optional, defaults to 2 minutes
+	Timeout time.Duration
+}
+
+func (c *CertManagerOptions) validate(path *field.Path, o *ManagerOptions) field.ErrorList {
+	var errs field.ErrorList
+	if c.IssuerName == "" {
+		errs = append(errs, field.Required(path.Child("issuerName"), ""))
+	}
+	switch c.IssuerKind {
+	case "", IssuerKindIssuer, IssuerKindClusterIssuer:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("issuerKind"), c.IssuerKind, []string{IssuerKindIssuer, IssuerKindClusterIssuer}))
+	}
+	if c.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("duration"), c.Duration.String(), "must not be negative"))
+	}
+	if c.Timeout < 0 {
+		errs = append(errs, field.Invalid(path.Child("timeout"), c.Timeout.String(), "must not be negative"))
+	}
+	if o.WebhookNamespace == "" {
+		errs = append(errs, field.Required(field.NewPath("webhookNamespace"), "required when certManager is set, for the Certificate"))
+	}
+	if o.SetupCertificate != nil && !*o.SetupCertificate {
+		errs = append(errs, field.Forbidden(path, "not supported with setupCertificate disabled"))
+	}
+	return errs
+}
+
+// useCertManager makes the configuration get its certificate from cert-manager, if enabled
+func (m *DefaultExtensionManager) useCertManager(f *WebhookConfig) {
+	if m.Options.CertManager == nil {
+		return
+	}
+	f.certManager = m.Options.CertManager
+	if f.Annotations == nil {
+		f.Annotations = map[string]string{}
+	}
+	f.Annotations[AnnotationInjectCAFrom] = fmt.Sprintf("%s/%s", f.webhookNamespace, f.setupCertificateName)
+}
+
+// desiredCertificateSpec returns the spec of the cert-manager Certificate of the webhook server
+func (f *WebhookConfig) desiredCertificateSpec(serverName string) map[string]interface{} {
+	kind := f.certManager.IssuerKind
+	if kind == "" {
+		kind = IssuerKindIssuer
+	}
+	spec := map[string]interface{}{
+		"secretName": f.setupCertificateName,
+		"commonName": serverName,
+		"issuerRef": map[string]interface{}{
+			"name":  f.certManager.IssuerName,
+			"kind":  kind,
+			"group": certificateGVK.Group,
+		},
+		// The replicas present the certificate to their own webhook server in the handover self check
+		"usages": []interface{}{"digital signature", "key encipherment", "server auth", "client auth"},
+	}
+	if net.ParseIP(serverName) != nil {
+		spec["ipAddresses"] = []interface{}{serverName}
+	} else {
+		spec["dnsNames"] = []interface{}{serverName}
+	}
+	if f.certManager.Duration > 0 {
+		spec["duration"] = f.certManager.Duration.String()
+	}
+	return spec
+}
+
+// reconcileCertificate creates the cert-manager Certificate of the webhook server, or brings it back to the
+// desired state
+func (f *WebhookConfig) reconcileCertificate(ctx context.Context) error {
+	serverName, err := f.serverName()
+	if err != nil {
+		return err
+	}
+	key := machinerytypes.NamespacedName{Name: f.setupCertificateName, Namespace: f.webhookNamespace}
+
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certificateGVK)
+	err = f.client.Get(ctx, key, certificate)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "getting the cert-manager certificate")
+	}
+	create := apierrors.IsNotFound(err) || certificate.GetName() == ""
+	if create {
+		certificate = &unstructured.Unstructured{Object: map[string]interface{}{}}
+		certificate.SetGroupVersionKind(certificateGVK)
+		certificate.SetName(key.Name)
+		certificate.SetNamespace(key.Namespace)
+		certificate.SetAnnotations(f.certificateAnnotations())
+	}
+	before := certificate.DeepCopy()
+
+	spec, _, _ := unstructured.NestedMap(certificate.Object, "spec")
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	for k, v := range f.desiredCertificateSpec(serverName) {
+		spec[k] = v
+	}
+	if err := unstructured.SetNestedMap(certificate.Object, spec, "spec"); err != nil {
+		return errors.Wrap(err, "setting the cert-manager certificate spec")
+	}
+
+	if create {
+		err := f.client.Create(ctx, certificate)
+		if apierrors.IsAlreadyExists(err) {
+			// Another replica created the certificate meanwhile
+			return nil
+		}
+		return errors.Wrap(err, "creating the cert-manager certificate")
+	}
+	if reflect.DeepEqual(before.Object, certificate.Object) {
+		return nil
+	}
+	return errors.Wrap(f.client.Update(ctx, certificate), "updating the cert-manager certificate")
+}
+
+// certificateAnnotations returns the annotations of the Certificate, the ones of the configuration but the
+// CA injection
+func (f *WebhookConfig) certificateAnnotations() map[string]string {
+	annotations := map[string]string{}
+	for k, v := range f.Annotations {
+		if k != AnnotationInjectCAFrom {
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
+
+// loadIssuedCertificate reads the certificate issued by cert-manager from its secret, and returns false if it
+// is not issued yet
+func (f *WebhookConfig) loadIssuedCertificate(ctx context.Context) (bool, error) {
+	secret := &unstructured.Unstructured{}
+	secret.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Secret"})
+	key := machinerytypes.NamespacedName{Name: f.setupCertificateName, Namespace: f.webhookNamespace}
+	if err := f.client.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "data")
+	decoded := map[string][]byte{}
+	for _, k := range []string{"tls.crt", "tls.key", "ca.crt"} {
+		if data[k] == "" {
+			return false, nil
+		}
+		v, err := base64.StdEncoding.DecodeString(data[k])
+		if err != nil {
+			return false, errors.Wrapf(err, "decoding the %s key of the certificate secret", k)
+		}
+		decoded[k] = v
+	}
+
+	f.Certificate = decoded["tls.crt"]
+	f.Key = decoded["tls.key"]
+	f.CaCertificate = decoded["ca.crt"]
+	f.CaKey = nil
+	return true, nil
+}
+
+// setupIssuedCertificate reconciles the cert-manager Certificate of the webhook server, and waits for its
+// secret to be issued
+func (f *WebhookConfig) setupIssuedCertificate(ctx context.Context) error {
+	if err := f.reconcileCertificate(ctx); err != nil {
+		return err
+	}
+
+	timeout := f.certManager.Timeout
+	if timeout == 0 {
+		timeout = defaultCertManagerTimeout
+	}
+	err := wait.PollImmediate(certManagerPollInterval, timeout, func() (bool, error) {
+		return f.loadIssuedCertificate(ctx)
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("The certificate secret %s/%s was not issued by cert-manager within %s", f.webhookNamespace, f.setupCertificateName, timeout)
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading the certificate secret issued by cert-manager")
+	}
+
+	if err := f.writeSecretFiles(); err != nil {
+		return errors.Wrap(err, "writing webhook certificate files to disk")
+	}
+	return nil
+}
+
+// issuedCertificateSync reloads the certificates renewed by cert-manager, so that the webhook servers serve them
+type issuedCertificateSync struct {
+	manager *DefaultExtensionManager
+	logger  *zap.SugaredLogger
+}
+
+// NeedLeaderElection makes every replica reload its certificates
+func (s *issuedCertificateSync) NeedLeaderElection() bool {
+	return false
+}
+
+// Start reloads the certificates until the stop channel is closed
+func (s *issuedCertificateSync) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	wait.Until(func() {
+		configs := []*WebhookConfig{s.manager.WebhookConfig}
+		for _, g := range s.manager.webhookGroups {
+			configs = append(configs, g.config)
+		}
+		for _, config := range configs {
+			if err := s.manager.reloadIssuedCertificate(ctx, config); err != nil {
+				s.logger.Errorf("Reloading the webhook server certificate %s: %s", config.setupCertificateName, err.Error())
+			}
+		}
+	}, certManagerSyncInterval, stop)
+	return nil
+}
+
+// reloadIssuedCertificate writes the certificate of the configuration to disk if cert-manager renewed it, where
+// the webhook server picks it up
+func (m *DefaultExtensionManager) reloadIssuedCertificate(ctx context.Context, config *WebhookConfig) error {
+	// The certificates aren't reloaded while the CA bundles are re-synced, see resyncCABundle
+	m.failurePolicyMu.Lock()
+	defer m.failurePolicyMu.Unlock()
+
+	previous, previousCA := config.Certificate, config.CaCertificate
+	issued, err := config.loadIssuedCertificate(ctx)
+	if err != nil || !issued || bytes.Equal(previous, config.Certificate) {
+		return err
+	}
+	if err := config.writeSecretFiles(); err != nil {
+		return errors.Wrap(err, "writing webhook certificate files to disk")
+	}
+	m.exportCertificateExpiry(config)
+	m.Logger.Infof("Reloaded the webhook server certificate %s renewed by cert-manager", config.setupCertificateName)
+
+	if m.Options.PublishCABundle && config == m.WebhookConfig && !bytes.Equal(previousCA, config.CaCertificate) {
+		if err := m.publishCABundle(ctx); err != nil {
+			return errors.Wrap(err, "publishing the webhook CA bundle")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("cert-manager certificates", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		client        *cfakes.FakeClient
+		issued        map[string]interface{}
+		created       []runtime.Object
+		ca            Certificate
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.SetupCertificateName = "test-certmanager-setupcert"
+		eiriniManager.Options.WebhookNamespace = "eirini"
+		eiriniManager.Options.CertManager = &CertManagerOptions{IssuerName: "eirini-ca", Timeout: 10 * time.Millisecond}
+		eiriniManager.Credsgen = &cfakes.FakeCredentialGenerator{}
+
+		generator := NewCredentialGenerator()
+		var err error
+		ca, err = generator.GenerateCertificate("ca", CertificateRequest{CommonName: "eirini CA", IsCA: true})
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := generator.GenerateCertificate("cert", CertificateRequest{CommonName: "127.0.0.1", CA: Certificate{IsCA: true, PrivateKey: ca.PrivateKey, Certificate: ca.Certificate}})
+		Expect(err).ToNot(HaveOccurred())
+		issued = map[string]interface{}{
+			"tls.crt": base64.StdEncoding.EncodeToString(cert.Certificate),
+			"tls.key": base64.StdEncoding.EncodeToString(cert.PrivateKey),
+			"ca.crt":  base64.StdEncoding.EncodeToString(ca.Certificate),
+		}
+
+		client = &cfakes.FakeClient{}
+		created = nil
+		client.GetCalls(func(_ context.Context, key crc.ObjectKey, object runtime.Object) error {
+			u, ok := object.(*unstructured.Unstructured)
+			if !ok || u.GetKind() == "Namespace" {
+				return nil
+			}
+			if u.GetKind() != "Secret" || issued == nil {
+				return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			u.SetName(key.Name)
+			u.Object["data"] = issued
+			return nil
+		})
+		client.CreateCalls(func(_ context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+			created = append(created, object)
+			return nil
+		})
+		kubeManager := &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+	})
+
+	It("creates a Certificate and serves the issued secret", func() {
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.Credsgen.(*cfakes.FakeCredentialGenerator).GenerateCertificateCallCount()).To(Equal(0))
+		Expect(eiriniManager.WebhookConfig.CaCertificate).To(Equal(ca.Certificate))
+
+		Expect(created).To(HaveLen(1))
+		certificate := created[0].(*unstructured.Unstructured)
+		Expect(certificate.GetKind()).To(Equal("Certificate"))
+		Expect(certificate.GetNamespace()).To(Equal("eirini"))
+		Expect(certificate.GetName()).To(Equal("test-certmanager-setupcert"))
+		spec := certificate.Object["spec"].(map[string]interface{})
+		Expect(spec["secretName"]).To(Equal("test-certmanager-setupcert"))
+		Expect(spec["ipAddresses"]).To(Equal([]interface{}{"127.0.0.1"}))
+		Expect(spec["issuerRef"]).To(Equal(map[string]interface{}{"name": "eirini-ca", "kind": IssuerKindIssuer, "group": "cert-manager.io"}))
+
+		crt, err := ioutil.ReadFile(filepath.Join(eiriniManager.WebhookConfig.CertDir, "tls.crt"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(base64.StdEncoding.EncodeToString(crt)).To(Equal(issued["tls.crt"]))
+	})
+
+	It("annotates the webhook configuration for the CA injection", func() {
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		Expect(created).To(HaveLen(2))
+		config := created[1].(*admissionregistrationv1beta1.MutatingWebhookConfiguration)
+		Expect(config.Annotations).To(HaveKeyWithValue(AnnotationInjectCAFrom, "eirini/test-certmanager-setupcert"))
+		Expect(created[0].(*unstructured.Unstructured).GetAnnotations()).ToNot(HaveKey(AnnotationInjectCAFrom))
+	})
+
+	It("fails if the certificate is not issued in time", func() {
+		issued = nil
+		err := eiriniManager.OperatorSetup()
+		Expect(err).To(MatchError(ContainSubstring("was not issued by cert-manager within 10ms")))
+	})
+
+	It("validates the issuer", func() {
+		opts := ManagerOptions{Namespace: "eirini", CertManager: &CertManagerOptions{IssuerKind: "Vault"}}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("certManager.issuerName: Required value"))
+		Expect(err.Error()).To(ContainSubstring("certManager.issuerKind: Unsupported value"))
+		Expect(err.Error()).To(ContainSubstring("webhookNamespace: Required value"))
+	})
+})
@@ -0,0 +1,83 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var errChaosDecodeFailure = errors.New("Decode failure injected by the chaos mode")
+
+// ChaosOptions configure the chaos mode, which injects faults into the webhook path so that platform teams can
+// rehearse the behaviour of the failure policy and their alerting before production incidents. It is meant for
+// test clusters only.
+//
+// Each fault is injected into the admission requests with its probability, between 0 and 1.
+type ChaosOptions struct {
+	// Latency delays the admission requests, by up to LatencyJitter more
+	Latency       time.Duration
+	LatencyJitter time.Duration
+	// LatencyProbability is the probability of delaying a request
+	LatencyProbability float64
+
+	// DecodeFailureProbability is the probability of failing to decode the pod, which is then handled according
+	// to the DecodeErrorPolicy (with pass-through, only the NonPodHandlers are called, with a nil pod)
+	DecodeFailureProbability float64
+
+	// PanicProbability is the probability of panicking while handling the request
+	PanicProbability float64
+}
+
+func (c *ChaosOptions) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if c.Latency < 0 {
+		errs = append(errs, field.Invalid(path.Child("latency"), c.Latency.String(), "must not be negative"))
+	}
+	if c.LatencyJitter < 0 {
+		errs = append(errs, field.Invalid(path.Child("latencyJitter"), c.LatencyJitter.String(), "must not be negative"))
+	}
+	for name, p := range map[string]float64{
+		"latencyProbability":       c.LatencyProbability,
+		"decodeFailureProbability": c.DecodeFailureProbability,
+		"panicProbability":         c.PanicProbability,
+	} {
+		if p < 0 || p > 1 {
+			errs = append(errs, field.Invalid(path.Child(name), p, "must be between 0 and 1"))
+		}
+	}
+	return errs
+}
+
+// inject delays the request or panics, and returns true if the decoding of the pod must fail
+func (c *ChaosOptions) inject(ctx context.Context, extension string) bool {
+	if c == nil {
+		return false
+	}
+
+	if c.LatencyProbability > 0 && rand.Float64() < c.LatencyProbability { // nolint:gosec
+		delay := c.Latency
+		if c.LatencyJitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(c.LatencyJitter))) // nolint:gosec
+		}
+		chaosInjections.WithLabelValues(extension, "latency").Inc()
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+
+	if c.PanicProbability > 0 && rand.Float64() < c.PanicProbability { // nolint:gosec
+		chaosInjections.WithLabelValues(extension, "panic").Inc()
+		panic(fmt.Sprintf("panic injected by the chaos mode in %s", extension))
+	}
+
+	if c.DecodeFailureProbability > 0 && rand.Float64() < c.DecodeFailureProbability { // nolint:gosec
+		chaosInjections.WithLabelValues(extension, "decode_failure").Inc()
+		return true
+	}
+	return false
+}
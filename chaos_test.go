@@ -0,0 +1,81 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Chaos mode", func() {
+	var req admission.Request
+
+	newWebhook := func(opts ManagerOptions) *DefaultMutatingWebhook {
+		failurePolicy := admissionregistrationv1beta1.Fail
+		opts.FailurePolicy = &failurePolicy
+		c := catalog.NewCatalog()
+		w := NewWebhook(&catalog.EditEnvExtension{}, c.SimpleManager()).(*DefaultMutatingWebhook)
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: "chaos", ManagerOptions: opts})).To(Succeed())
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+		return w
+	}
+
+	BeforeEach(func() {
+		review := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(reviewBody(), &review)).To(Succeed())
+		req = admission.Request{AdmissionRequest: *review.Request}
+	})
+
+	It("delays the requests", func() {
+		w := newWebhook(ManagerOptions{Chaos: &ChaosOptions{Latency: 50 * time.Millisecond, LatencyProbability: 1}})
+		start := time.Now()
+		Expect(w.Handle(context.Background(), req).Allowed).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	It("stops delaying when the request is cancelled", func() {
+		w := newWebhook(ManagerOptions{Chaos: &ChaosOptions{Latency: time.Hour, LatencyProbability: 1}})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(w.Handle(ctx, req).Allowed).To(BeTrue())
+	})
+
+	It("injects decoding failures handled by the decode error policy", func() {
+		w := newWebhook(ManagerOptions{
+			DecodeErrorPolicy: DecodeErrorDeny,
+			Chaos:             &ChaosOptions{DecodeFailureProbability: 1},
+		})
+		res := w.Handle(context.Background(), req)
+		Expect(res.Allowed).To(BeFalse())
+		Expect(res.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+	})
+
+	It("panics", func() {
+		w := newWebhook(ManagerOptions{Chaos: &ChaosOptions{PanicProbability: 1}})
+		Expect(func() { w.Handle(context.Background(), req) }).To(Panic())
+	})
+
+	It("doesn't inject faults with zero probabilities", func() {
+		w := newWebhook(ManagerOptions{Chaos: &ChaosOptions{Latency: time.Hour}})
+		Expect(w.Handle(context.Background(), req).Allowed).To(BeTrue())
+	})
+
+	It("rejects invalid options", func() {
+		opts := ManagerOptions{Chaos: &ChaosOptions{Latency: -time.Second, PanicProbability: 2}}
+		err := opts.Validate()
+		Expect(err).To(MatchError(ContainSubstring("chaos.latency")))
+		Expect(err).To(MatchError(ContainSubstring("chaos.panicProbability")))
+	})
+})
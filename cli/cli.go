@@ -0,0 +1,100 @@
+// Package cli contains subcommands which can be embedded in the binaries running Eirini extensions,
+// e.g. to validate the extensions against pod manifests during development or in GitOps pipelines.
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"code.cloudfoundry.org/eirinix/util/grafana"
+	"github.com/pkg/errors"
+)
+
+// Usage describes the available subcommands
+const Usage = `Available subcommands:
+  dry-run <pod.yaml|->   prints the patches the extensions would apply to the pod
+  grafana-dashboard      prints a Grafana dashboard of the eirinix metrics
+  list-extensions        prints the name, version and description of the extensions
+`
+
+// Run runs the subcommand in args (program name excluded) against the extensions added to the Manager
+func Run(m eirinix.Manager, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("No subcommand given\n" + Usage)
+	}
+
+	switch args[0] {
+	case "dry-run":
+		return DryRun(m, args[1:], os.Stdin, out)
+	case "grafana-dashboard":
+		return GrafanaDashboard(out)
+	case "list-extensions":
+		return ListExtensions(m, out)
+	default:
+		return errors.Errorf("Unknown subcommand '%s'\n%s", args[0], Usage)
+	}
+}
+
+// DryRun reads the pod manifest from the file in args, or from the given reader if the file is "-",
+// and prints the patches returned by Manager.RunOffline as JSON
+func DryRun(m eirinix.Manager, args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("dry-run expects exactly one pod manifest")
+	}
+
+	var manifest []byte
+	var err error
+	if args[0] == "-" {
+		manifest, err = ioutil.ReadAll(in)
+	} else {
+		manifest, err = ioutil.ReadFile(args[0])
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading the pod manifest")
+	}
+
+	patches, err := m.RunOffline(manifest)
+	if err != nil {
+		return err
+	}
+	if patches == nil {
+		patches = []eirinix.Patch{}
+	}
+
+	b, err := json.MarshalIndent(patches, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(b))
+	return err
+}
+
+// GrafanaDashboard prints the JSON of a Grafana dashboard of the eirinix metrics
+func GrafanaDashboard(out io.Writer) error {
+	b, err := grafana.Generate("EiriniX")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(b))
+	return err
+}
+
+// ListExtensions prints a table of the extensions added to the Manager, see Manager.Describe
+func ListExtensions(m eirinix.Manager, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tVERSION\tREQUIRES\tDESCRIPTION")
+	for _, meta := range m.Describe() {
+		version := meta.Version
+		if version == "" {
+			version = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", meta.Name, meta.Kind, version, strings.Join(meta.Requires, ","), meta.Description)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,253 @@
+package extension
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// clientCAReloadInterval is the minimum time between two checks of the CA files for changes
+	clientCAReloadInterval = 10 * time.Second
+
+	clientCertificateUntrusted = "untrusted"
+	clientCertificateName      = "name"
+)
+
+// clusterAuthentication is the ConfigMap where the API server publishes the CAs of the client certificates
+// it accepts, see ClientCertificateOptions.ClusterClientCA
+var clusterAuthentication = machinerytypes.NamespacedName{Namespace: "kube-system", Name: "extension-apiserver-authentication"}
+
+// ClientCertificateOptions makes the webhook servers require a client certificate, so that only the API server
+// (configured to present a certificate to the webhooks in its admission configuration) or a front proxy can
+// invoke the webhooks. At least one source of CAs is required.
+//
+// The CA of the webhook server certificate is always trusted, as the replicas present that certificate to
+// their own webhook server in the handover self check, see HandoverOptions.
+type ClientCertificateOptions struct {
+	// CABundles are PEM encoded bundles of the CAs the client certificates are verified against. Optional
+	CABundles [][]byte
+
+	// CAFiles are paths of PEM encoded CA bundles, e.g. mounted from a ConfigMap, which are read again when
+	// they change. Optional
+	CAFiles []string
+
+	// ClusterClientCA trusts the client CAs published by the API server in the
+	// kube-system/extension-apiserver-authentication ConfigMap, read at startup. Optional, defaults to false
+	ClusterClientCA bool
+
+	// AllowedNames restricts the clients to the certificates with one of these common names or DNS names,
+	// e.g. kube-apiserver. Optional, defaults to every certificate signed by the CAs
+	AllowedNames []string
+}
+
+func (o *ClientCertificateOptions) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if len(o.CABundles) == 0 && len(o.CAFiles) == 0 && !o.ClusterClientCA {
+		errs = append(errs, field.Required(path, "a CA bundle, a CA file or the cluster client CA is required"))
+	}
+	for i, bundle := range o.CABundles {
+		if !x509.NewCertPool().AppendCertsFromPEM(bundle) {
+			errs = append(errs, field.Invalid(path.Child("caBundles").Index(i), "<PEM>", "must contain a PEM encoded certificate"))
+		}
+	}
+	for i, file := range o.CAFiles {
+		if file == "" {
+			errs = append(errs, field.Required(path.Child("caFiles").Index(i), "must not be empty"))
+		}
+	}
+	return errs
+}
+
+// clientAuthenticator verifies the client certificates of a webhook server against the CAs of the
+// ClientCertificateOptions and the CA of the webhook server certificate
+type clientAuthenticator struct {
+	bundles      [][]byte
+	files        []string
+	webhookCA    string
+	allowedNames map[string]bool
+	logger       *zap.SugaredLogger
+
+	mu         sync.Mutex
+	pool       *x509.CertPool
+	webhookCAs *x509.CertPool
+	modTimes   map[string]time.Time
+	checked    time.Time
+}
+
+// newClientAuthenticator returns the authenticator of the webhook server serving the certificate of certDir,
+// or nil without RequireClientCertificate
+func (m *DefaultExtensionManager) newClientAuthenticator(certDir string) (*clientAuthenticator, error) {
+	opts := m.Options.RequireClientCertificate
+	if opts == nil {
+		return nil, nil
+	}
+
+	a := &clientAuthenticator{
+		bundles:      append([][]byte{}, opts.CABundles...),
+		files:        opts.CAFiles,
+		webhookCA:    filepath.Join(certDir, "ca-cert.pem"),
+		allowedNames: map[string]bool{},
+		logger:       m.Logger,
+	}
+	for _, name := range opts.AllowedNames {
+		a.allowedNames[name] = true
+	}
+	if opts.ClusterClientCA {
+		bundles, err := m.clusterClientCAs(m.Context)
+		if err != nil {
+			return nil, err
+		}
+		a.bundles = append(a.bundles, bundles...)
+	}
+	if _, _, err := a.certPools(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// clusterClientCAs returns the client CAs published by the API server, see ClientCertificateOptions.ClusterClientCA
+func (m *DefaultExtensionManager) clusterClientCAs(ctx context.Context) ([][]byte, error) {
+	cm := &corev1.ConfigMap{}
+	if err := m.KubeManager.GetAPIReader().Get(ctx, clusterAuthentication, cm); err != nil {
+		return nil, errors.Wrapf(err, "reading the cluster client CA from %s", clusterAuthentication)
+	}
+	var bundles [][]byte
+	for _, key := range []string{"client-ca-file", "requestheader-client-ca-file"} {
+		if bundle := strings.TrimSpace(cm.Data[key]); bundle != "" {
+			bundles = append(bundles, []byte(bundle))
+		}
+	}
+	if len(bundles) == 0 {
+		return nil, errors.Errorf("No client CA found in %s", clusterAuthentication)
+	}
+	return bundles, nil
+}
+
+// certPools returns the pool of the trusted CAs and the one of the webhook server CA, reading the CA files
+// again if they changed since the last check
+func (a *clientAuthenticator) certPools() (*x509.CertPool, *x509.CertPool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pool != nil && time.Since(a.checked) < clientCAReloadInterval {
+		return a.pool, a.webhookCAs, nil
+	}
+	a.checked = time.Now()
+
+	modTimes := map[string]time.Time{}
+	for _, file := range append([]string{a.webhookCA}, a.files...) {
+		info, err := os.Stat(file)
+		if os.IsNotExist(err) && file == a.webhookCA {
+			// The webhook server certificate is provided, without its CA
+			continue
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "reading the client CA %s", file)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	if a.pool != nil && sameModTimes(a.modTimes, modTimes) {
+		return a.pool, a.webhookCAs, nil
+	}
+
+	pool, webhookCAs := x509.NewCertPool(), x509.NewCertPool()
+	for _, bundle := range a.bundles {
+		pool.AppendCertsFromPEM(bundle)
+	}
+	for file := range modTimes {
+		bundle, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "reading the client CA %s", file)
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, nil, errors.Errorf("No PEM encoded certificate found in the client CA %s", file)
+		}
+		if file == a.webhookCA {
+			webhookCAs.AppendCertsFromPEM(bundle)
+		}
+	}
+	if a.pool != nil {
+		a.logger.Info("Reloaded the client CAs of the webhook server")
+	}
+	a.pool, a.webhookCAs, a.modTimes = pool, webhookCAs, modTimes
+	return pool, webhookCAs, nil
+}
+
+func sameModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, t := range a {
+		if !b[file].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// tlsConfig returns the server TLS configuration requiring a client certificate verified by the authenticator
+func (a *clientAuthenticator) tlsConfig(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	// The chain is verified by verifyPeerCertificate, against the CAs of the time of the handshake
+	config.ClientAuth = tls.RequireAnyClientCert
+	config.VerifyPeerCertificate = a.verifyPeerCertificate
+	return config
+}
+
+func (a *clientAuthenticator) verifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	pool, webhookCAs, err := a.certPools()
+	if err != nil {
+		a.logger.Errorf("Rejecting the admission client: %s", err.Error())
+		return err
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			admissionClientRejected.WithLabelValues(clientCertificateUntrusted).Inc()
+			return errors.Wrap(err, "parsing the client certificate")
+		}
+		certs = append(certs, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	leaf := certs[0]
+	opts := x509.VerifyOptions{Roots: pool, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	if _, err := leaf.Verify(opts); err != nil {
+		admissionClientRejected.WithLabelValues(clientCertificateUntrusted).Inc()
+		return errors.Wrapf(err, "verifying the client certificate of %s", leaf.Subject.CommonName)
+	}
+	if len(a.allowedNames) == 0 {
+		return nil
+	}
+
+	// The replicas of the operator present the webhook server certificate
+	opts.Roots = webhookCAs
+	if _, err := leaf.Verify(opts); err == nil {
+		return nil
+	}
+	for _, name := range append([]string{leaf.Subject.CommonName}, leaf.DNSNames...) {
+		if a.allowedNames[name] {
+			return nil
+		}
+	}
+	admissionClientRejected.WithLabelValues(clientCertificateName).Inc()
+	return errors.Errorf("The client certificate of %s is not allowed", leaf.Subject.CommonName)
+}
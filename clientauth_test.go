@@ -0,0 +1,132 @@
+package extension_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client certificates", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		generator     CredentialGenerator
+		apiServerCA   Certificate
+		stop          chan struct{}
+		addr          string
+	)
+
+	// clientCert returns a client certificate signed by the CA
+	clientCert := func(ca Certificate, commonName string) *tls.Certificate {
+		cert, err := generator.GenerateCertificate(commonName, CertificateRequest{CommonName: commonName, CA: ca})
+		Expect(err).ToNot(HaveOccurred())
+		pair, err := tls.X509KeyPair(cert.Certificate, cert.PrivateKey)
+		Expect(err).ToNot(HaveOccurred())
+		return &pair
+	}
+
+	// get sends a request to the webhook server, presenting the client certificate if any
+	get := func(cert *tls.Certificate) error {
+		config := &tls.Config{InsecureSkipVerify: true} // nolint:gosec
+		if cert != nil {
+			config.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}, Timeout: 5 * time.Second}
+		res, err := client.Get("https://" + addr + "/")
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+
+	BeforeEach(func() {
+		generator = NewCredentialGenerator()
+		var err error
+		apiServerCA, err = generator.GenerateCertificate("apiserver-ca", CertificateRequest{CommonName: "apiserver-ca", IsCA: true})
+		Expect(err).ToNot(HaveOccurred())
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		port := listener.Addr().(*net.TCPAddr).Port
+		Expect(listener.Close()).To(Succeed())
+		addr = fmt.Sprintf("127.0.0.1:%d", port)
+
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.Port = int32(port)
+		eiriniManager.Options.SetupCertificateName = "test-client-auth"
+		eiriniManager.Options.RequireClientCertificate = &ClientCertificateOptions{CABundles: [][]byte{apiServerCA.Certificate}}
+		eiriniManager.Credsgen = generator
+		stop = make(chan struct{})
+	})
+
+	AfterEach(func() {
+		close(stop)
+		os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+	})
+
+	// serve starts the webhook server of the manager
+	serve := func() {
+		kubeManager := &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(&cfakes.FakeClient{})
+		eiriniManager.KubeManager = kubeManager
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		server := kubeManager.AddArgsForCall(0)
+		go server.Start(stop)
+		Eventually(func() error {
+			conn, err := net.Dial("tcp", addr)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}).Should(Succeed())
+	}
+
+	It("only serves the clients with a certificate signed by the CAs", func() {
+		serve()
+
+		Expect(get(nil)).ToNot(Succeed())
+		Expect(get(clientCert(apiServerCA, "kube-apiserver"))).To(Succeed())
+
+		otherCA, err := generator.GenerateCertificate("other-ca", CertificateRequest{CommonName: "other-ca", IsCA: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(get(clientCert(otherCA, "kube-apiserver"))).ToNot(Succeed())
+	})
+
+	It("only serves the allowed names, and the replicas of the operator", func() {
+		eiriniManager.Options.RequireClientCertificate.AllowedNames = []string{"kube-apiserver"}
+		serve()
+
+		Expect(get(clientCert(apiServerCA, "kube-apiserver"))).To(Succeed())
+		Expect(get(clientCert(apiServerCA, "tenant"))).ToNot(Succeed())
+
+		certDir := eiriniManager.WebhookServer.CertDir
+		replica, err := tls.LoadX509KeyPair(filepath.Join(certDir, "tls.crt"), filepath.Join(certDir, "tls.key"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(get(&replica)).To(Succeed())
+	})
+
+	It("requires a source of CAs", func() {
+		opts := ManagerOptions{Namespace: "eirini", RequireClientCertificate: &ClientCertificateOptions{}}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("requireClientCertificate: Required value"))
+
+		opts.RequireClientCertificate.CABundles = [][]byte{[]byte("not a certificate")}
+		err = opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("requireClientCertificate.caBundles[0]: Invalid value"))
+	})
+})
@@ -0,0 +1,147 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ComparisonResult is the outcome of running the current and the candidate implementations
+// of an extension against the same admission request
+type ComparisonResult struct {
+	Time      time.Time `json:"time"`
+	Extension string    `json:"extension"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+
+	// CurrentAllowed and CandidateAllowed are the admission decisions of the two implementations
+	CurrentAllowed   bool `json:"currentAllowed"`
+	CandidateAllowed bool `json:"candidateAllowed"`
+
+	// OnlyCurrent and OnlyCandidate are the patch operations returned by only one of the implementations
+	OnlyCurrent   []Patch `json:"onlyCurrent,omitempty"`
+	OnlyCandidate []Patch `json:"onlyCandidate,omitempty"`
+
+	// Error is set if the patches of an implementation couldn't be decoded
+	Error string `json:"error,omitempty"`
+}
+
+// Match returns true if both implementations returned the same decision and patches
+func (r ComparisonResult) Match() bool {
+	return r.Error == "" && r.CurrentAllowed == r.CandidateAllowed && len(r.OnlyCurrent) == 0 && len(r.OnlyCandidate) == 0
+}
+
+// ComparisonRecorder receives the results of the comparisons
+type ComparisonRecorder func(ComparisonResult)
+
+// NewJSONLinesRecorder returns a ComparisonRecorder writing the mismatching results as JSON lines,
+// for offline analysis
+func NewJSONLinesRecorder(w io.Writer) ComparisonRecorder {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(r ComparisonResult) {
+		if r.Match() {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(r) // nolint:errcheck
+	}
+}
+
+// NewComparison returns an Extension running both the current and the candidate implementations of an
+// extension. The admission response is the one of the current implementation, while the candidate runs
+// asynchronously on a copy of the pod, with a dry-run request, and the differences between the two
+// outputs are passed to the recorder. This allows to validate a new implementation on real traffic
+// before switching to it.
+func NewComparison(current, candidate Extension, recorder ComparisonRecorder) Extension {
+	return &comparison{current: current, candidate: candidate, recorder: recorder}
+}
+
+type comparison struct {
+	current   Extension
+	candidate Extension
+	recorder  ComparisonRecorder
+}
+
+// Handle returns the response of the current implementation, and compares it with the candidate one
+func (c *comparison) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	var podCopy *corev1.Pod
+	if pod != nil {
+		podCopy = pod.DeepCopy()
+	}
+
+	res := c.current.Handle(ctx, m, pod, req)
+
+	dryRun := true
+	candidateReq := admission.Request{AdmissionRequest: *req.AdmissionRequest.DeepCopy()}
+	candidateReq.DryRun = &dryRun
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				m.GetLogger().Errorf("Candidate implementation of %s panicked: %v", extensionName(c.current), r)
+			}
+		}()
+		candidateRes := c.candidate.Handle(context.Background(), m, podCopy, candidateReq)
+		c.record(req, res, candidateRes)
+	}()
+
+	return res
+}
+
+func (c *comparison) record(req admission.Request, current, candidate admission.Response) {
+	result := ComparisonResult{
+		Time:             time.Now(),
+		Extension:        extensionName(c.current),
+		Namespace:        req.Namespace,
+		Name:             req.Name,
+		CurrentAllowed:   current.Allowed,
+		CandidateAllowed: candidate.Allowed,
+	}
+
+	currentOps, err := podwebhook.ResponsePatches(current)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	candidateOps, err := podwebhook.ResponsePatches(candidate)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.OnlyCurrent = patchesDifference(currentOps, candidateOps)
+	result.OnlyCandidate = patchesDifference(candidateOps, currentOps)
+
+	outcome := "match"
+	if !result.Match() {
+		outcome = "mismatch"
+	}
+	comparisonResults.WithLabelValues(result.Extension, outcome).Inc()
+
+	if c.recorder != nil {
+		c.recorder(result)
+	}
+}
+
+// patchesDifference returns the operations of a which are not in b
+func patchesDifference(a, b []Patch) []Patch {
+	var diff []Patch
+	for _, opA := range a {
+		found := false
+		for _, opB := range b {
+			if opA.Operation == opB.Operation && opA.Path == opB.Path && reflect.DeepEqual(opA.Value, opB.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, opA)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,66 @@
+package extension_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Extension comparison", func() {
+	var (
+		eirinixcatalog catalog.Catalog
+		m              Manager
+		results        chan ComparisonResult
+	)
+
+	BeforeEach(func() {
+		eirinixcatalog = catalog.NewCatalog()
+		m = eirinixcatalog.SimpleManager()
+		results = make(chan ComparisonResult, 1)
+	})
+
+	It("records matching implementations", func() {
+		e := NewComparison(&catalog.EditEnvExtension{}, &catalog.EditEnvExtension{}, func(r ComparisonResult) { results <- r })
+		Expect(m.AddExtension(e)).To(Succeed())
+
+		_, err := m.RunOffline(eirinixcatalog.EiriniAppYaml())
+		Expect(err).ToNot(HaveOccurred())
+
+		var r ComparisonResult
+		Eventually(results).Should(Receive(&r))
+		Expect(r.Match()).To(BeTrue())
+	})
+
+	It("applies the current implementation and records the differences", func() {
+		e := NewComparison(&catalog.EditEnvExtension{}, eirinixcatalog.SimpleExtension(), func(r ComparisonResult) { results <- r })
+		Expect(m.AddExtension(e)).To(Succeed())
+
+		patches, err := m.RunOffline(eirinixcatalog.EiriniAppYaml())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(patches).To(HaveLen(1))
+
+		var r ComparisonResult
+		Eventually(results).Should(Receive(&r))
+		Expect(r.Match()).To(BeFalse())
+		Expect(r.OnlyCurrent).To(HaveLen(1))
+		Expect(r.OnlyCurrent[0].Path).To(Equal("/spec/containers/0/env/1"))
+		Expect(r.OnlyCandidate).To(BeEmpty())
+	})
+
+	It("writes the mismatches as JSON lines", func() {
+		out := &bytes.Buffer{}
+		record := NewJSONLinesRecorder(out)
+
+		record(ComparisonResult{Extension: "a", CurrentAllowed: true, CandidateAllowed: true})
+		record(ComparisonResult{Extension: "b", CurrentAllowed: true})
+		Expect(bytes.Count(out.Bytes(), []byte("\n"))).To(Equal(1))
+
+		var r ComparisonResult
+		Expect(json.Unmarshal(out.Bytes(), &r)).To(Succeed())
+		Expect(r.Extension).To(Equal("b"))
+	})
+})
@@ -0,0 +1,235 @@
+package extension
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// EiriniCompatibility selects the Eirini release the Manager works with, which defines the labels
+// of the app pods and the layout of their containers
+type EiriniCompatibility string
+
+const (
+	// EiriniCompatibilityLegacy matches the Eirini releases labeling the app pods with the cloudfoundry.org
+	// labels. It is the default.
+	EiriniCompatibilityLegacy EiriniCompatibility = "legacy"
+	// EiriniCompatibilityController matches eirini-controller, labeling the app pods with the
+	// workloads.cloudfoundry.org labels
+	EiriniCompatibilityController EiriniCompatibility = "eirini-controller"
+	// EiriniCompatibilityAuto detects the release from the StatefulSets of the Eirini namespace when the
+	// Manager starts, falling back to EiriniCompatibilityLegacy if there are none
+	EiriniCompatibilityAuto EiriniCompatibility = "auto"
+)
+
+// EiriniLayout describes the app pods created by an Eirini release
+type EiriniLayout struct {
+	Release EiriniCompatibility
+
+	LabelGUID        string
+	LabelVersion     string
+	LabelAppGUID     string
+	LabelProcessType string
+	LabelSourceType  string
+
+	AnnotationAppName   string
+	AnnotationSpaceName string
+	AnnotationSpaceGUID string
+	AnnotationOrgName   string
+
+	// SourceTypeApp and SourceTypeStaging are the values of LabelSourceType on the app and staging pods
+	SourceTypeApp     string
+	SourceTypeStaging string
+
+	// AppContainerName is the name of the container running the app
+	AppContainerName string
+}
+
+var (
+	legacyLayout = EiriniLayout{
+		Release:          EiriniCompatibilityLegacy,
+		LabelGUID:        LabelGUID,
+		LabelVersion:     LabelVersion,
+		LabelAppGUID:     LabelAppGUID,
+		LabelProcessType: LabelProcessType,
+		LabelSourceType:  LabelSourceType,
+
+		AnnotationAppName:   "cloudfoundry.org/application_name",
+		AnnotationSpaceName: "cloudfoundry.org/space_name",
+		AnnotationSpaceGUID: "cloudfoundry.org/space_guid",
+		AnnotationOrgName:   "cloudfoundry.org/org_name",
+
+		SourceTypeApp:     "APP",
+		SourceTypeStaging: "STG",
+		AppContainerName:  "opi",
+	}
+
+	controllerLayout = EiriniLayout{
+		Release:          EiriniCompatibilityController,
+		LabelGUID:        "workloads.cloudfoundry.org/guid",
+		LabelVersion:     "workloads.cloudfoundry.org/version",
+		LabelAppGUID:     "workloads.cloudfoundry.org/app_guid",
+		LabelProcessType: "workloads.cloudfoundry.org/process_type",
+		LabelSourceType:  "workloads.cloudfoundry.org/source_type",
+
+		AnnotationAppName:   "workloads.cloudfoundry.org/app_name",
+		AnnotationSpaceName: "workloads.cloudfoundry.org/space_name",
+		AnnotationSpaceGUID: "workloads.cloudfoundry.org/space_guid",
+		AnnotationOrgName:   "workloads.cloudfoundry.org/org_name",
+
+		SourceTypeApp:     "APP",
+		SourceTypeStaging: "STG",
+		AppContainerName:  "opi",
+	}
+
+	// eiriniLayouts are the supported releases, the most recent first
+	eiriniLayouts = []EiriniLayout{controllerLayout, legacyLayout}
+)
+
+// EiriniLayoutFor returns the layout of an Eirini release. The empty compatibility is the legacy one,
+// while EiriniCompatibilityAuto can only be resolved by a running Manager, see Manager.EiriniLayout.
+func EiriniLayoutFor(c EiriniCompatibility) (EiriniLayout, error) {
+	if c == "" {
+		return legacyLayout, nil
+	}
+	for _, l := range eiriniLayouts {
+		if l.Release == c {
+			return l, nil
+		}
+	}
+	return EiriniLayout{}, errors.Errorf("No layout for the Eirini compatibility %q", c)
+}
+
+// DetectEiriniLayout returns the layout of the release which created the pod, from its labels
+func DetectEiriniLayout(pod *corev1.Pod) (EiriniLayout, bool) {
+	if pod == nil {
+		return EiriniLayout{}, false
+	}
+	for _, l := range eiriniLayouts {
+		if _, ok := pod.GetLabels()[l.LabelSourceType]; ok {
+			return l, true
+		}
+	}
+	return EiriniLayout{}, false
+}
+
+// AppSelector returns the labels selecting the app pods
+func (l EiriniLayout) AppSelector() map[string]string {
+	return map[string]string{l.LabelSourceType: l.SourceTypeApp}
+}
+
+// IsApp returns true if the pod is an app instance
+func (l EiriniLayout) IsApp(pod *corev1.Pod) bool {
+	return pod != nil && pod.GetLabels()[l.LabelSourceType] == l.SourceTypeApp
+}
+
+// IsStaging returns true if the pod is a staging task
+func (l EiriniLayout) IsStaging(pod *corev1.Pod) bool {
+	return pod != nil && pod.GetLabels()[l.LabelSourceType] == l.SourceTypeStaging
+}
+
+// AppGUID returns the guid of the app the pod belongs to, or an empty string
+func (l EiriniLayout) AppGUID(pod *corev1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+	return pod.GetLabels()[l.LabelAppGUID]
+}
+
+// ProcessType returns the process type of the app instance, e.g. "web", or an empty string
+func (l EiriniLayout) ProcessType(pod *corev1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+	return pod.GetLabels()[l.LabelProcessType]
+}
+
+// AppName returns the name of the app the pod belongs to, or an empty string
+func (l EiriniLayout) AppName(pod *corev1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+	return pod.GetAnnotations()[l.AnnotationAppName]
+}
+
+// SpaceGUID returns the guid of the space of the app, or an empty string
+func (l EiriniLayout) SpaceGUID(pod *corev1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+	return pod.GetAnnotations()[l.AnnotationSpaceGUID]
+}
+
+// SpaceName returns the name of the space of the app, or an empty string
+func (l EiriniLayout) SpaceName(pod *corev1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+	return pod.GetAnnotations()[l.AnnotationSpaceName]
+}
+
+// OrgName returns the name of the org of the app, or an empty string
+func (l EiriniLayout) OrgName(pod *corev1.Pod) string {
+	if pod == nil {
+		return ""
+	}
+	return pod.GetAnnotations()[l.AnnotationOrgName]
+}
+
+// AppContainer returns the container running the app, or nil
+func (l EiriniLayout) AppContainer(pod *corev1.Pod) *corev1.Container {
+	if pod == nil {
+		return nil
+	}
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == l.AppContainerName {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+// EiriniLayout returns the layout of the app pods of the Eirini release set with EiriniCompatibility,
+// or detected by OperatorSetup
+func (m *DefaultExtensionManager) EiriniLayout() EiriniLayout {
+	if m.eiriniLayout != nil {
+		return *m.eiriniLayout
+	}
+	if l, err := EiriniLayoutFor(m.Options.EiriniCompatibility); err == nil {
+		return l
+	}
+	return legacyLayout
+}
+
+// resolveEiriniLayout detects the Eirini release with EiriniCompatibilityAuto, looking for the
+// StatefulSets labeled by each of the supported releases
+func (m *DefaultExtensionManager) resolveEiriniLayout(ctx context.Context) error {
+	if m.Options.EiriniCompatibility != EiriniCompatibilityAuto {
+		return nil
+	}
+
+	for _, l := range eiriniLayouts {
+		statefulSets := &appsv1.StatefulSetList{}
+		opts := []client.ListOption{client.HasLabels{l.LabelSourceType}, client.Limit(1)}
+		if ns := m.Options.watchNamespace(); ns != "" {
+			opts = append(opts, client.InNamespace(ns))
+		}
+		if err := m.KubeManager.GetAPIReader().List(ctx, statefulSets, opts...); err != nil {
+			return errors.Wrap(err, "listing the eirini statefulsets")
+		}
+		if len(statefulSets.Items) > 0 {
+			m.Logger.Infof("Detected the %s Eirini release", l.Release)
+			layout := l
+			m.eiriniLayout = &layout
+			return nil
+		}
+	}
+
+	m.Logger.Infof("No Eirini app found, defaulting to the %s Eirini release", legacyLayout.Release)
+	layout := legacyLayout
+	m.eiriniLayout = &layout
+	return nil
+}
@@ -0,0 +1,144 @@
+package extension_test
+
+import (
+	"context"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("Eirini compatibility", func() {
+	fixture := func(release EiriniCompatibility) *corev1.Pod {
+		c := catalog.NewCatalog()
+		pod := &corev1.Pod{}
+		Expect(yaml.Unmarshal(c.EiriniReleaseAppYaml(release), pod)).To(Succeed())
+		return pod
+	}
+
+	fixtureLayout := func(release EiriniCompatibility) EiriniLayout {
+		layout, err := EiriniLayoutFor(release)
+		Expect(err).ToNot(HaveOccurred())
+		return layout
+	}
+
+	for _, r := range []EiriniCompatibility{EiriniCompatibilityLegacy, EiriniCompatibilityController} {
+		release := r
+
+		Context("with the fixture pods of the "+string(release)+" release", func() {
+			It("detects the release", func() {
+				layout, ok := DetectEiriniLayout(fixture(release))
+				Expect(ok).To(BeTrue())
+				Expect(layout.Release).To(Equal(release))
+			})
+
+			It("reads the app labels and container", func() {
+				layout := fixtureLayout(release)
+				pod := fixture(release)
+				Expect(layout.IsApp(pod)).To(BeTrue())
+				Expect(layout.IsStaging(pod)).To(BeFalse())
+				Expect(layout.AppGUID(pod)).To(Equal("9a7a2c4e-7a4e-4bde-8e2e-d4a0d1a4a6f2"))
+				Expect(layout.ProcessType(pod)).To(Equal("web"))
+				Expect(layout.AppName(pod)).To(Equal("dora"))
+				Expect(layout.SpaceName(pod)).To(Equal("space"))
+				Expect(layout.SpaceGUID(pod)).To(Equal("5e1f7b4c-2f44-4c3e-bb0c-7a1b6f3d9e21"))
+				Expect(layout.AppContainer(pod)).ToNot(BeNil())
+				Expect(layout.AppContainer(pod).Image).To(Equal("eirini/dorini"))
+			})
+		})
+	}
+
+	It("doesn't mix the labels of the releases", func() {
+		legacy := fixtureLayout(EiriniCompatibilityLegacy)
+		controller := fixtureLayout(EiriniCompatibilityController)
+
+		Expect(legacy.IsApp(fixture(EiriniCompatibilityController))).To(BeFalse())
+		Expect(controller.IsApp(fixture(EiriniCompatibilityLegacy))).To(BeFalse())
+		Expect(controller.AppGUID(fixture(EiriniCompatibilityLegacy))).To(BeEmpty())
+	})
+
+	It("defaults to the legacy release", func() {
+		layout, err := EiriniLayoutFor("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(layout.Release).To(Equal(EiriniCompatibilityLegacy))
+		Expect(layout.AppSelector()).To(Equal(map[string]string{LabelSourceType: "APP"}))
+
+		_, err = EiriniLayoutFor(EiriniCompatibilityAuto)
+		Expect(err).To(HaveOccurred())
+		_, ok := DetectEiriniLayout(&corev1.Pod{})
+		Expect(ok).To(BeFalse())
+	})
+
+	Context("with a Manager", func() {
+		var (
+			eiriniManager *DefaultExtensionManager
+			kubeManager   *cfakes.FakeManager
+			reader        *cfakes.FakeClient
+		)
+
+		BeforeEach(func() {
+			kubeManager = &cfakes.FakeManager{}
+			kubeManager.GetClientReturns(&cfakes.FakeClient{})
+			reader = &cfakes.FakeClient{}
+			kubeManager.GetAPIReaderReturns(reader)
+
+			c := catalog.NewCatalog()
+			eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+			eiriniManager.KubeManager = kubeManager
+			eiriniManager.WebhookServer = &webhook.Server{}
+			disabled := false
+			eiriniManager.Options.RegisterWebHook = &disabled
+			eiriniManager.Options.SetupCertificate = &disabled
+			eiriniManager.Options.Namespace = ""
+		})
+
+		It("uses the explicit release", func() {
+			eiriniManager.Options.EiriniCompatibility = EiriniCompatibilityController
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.EiriniLayout().Release).To(Equal(EiriniCompatibilityController))
+			Expect(reader.ListCallCount()).To(Equal(0))
+		})
+
+		It("detects the release from the statefulsets", func() {
+			reader.ListStub = func(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+				listOpts := &client.ListOptions{}
+				listOpts.ApplyOptions(opts)
+				if listOpts.LabelSelector.String() == "workloads.cloudfoundry.org/source_type" {
+					list.(*appsv1.StatefulSetList).Items = []appsv1.StatefulSet{{}}
+				}
+				return nil
+			}
+			eiriniManager.Options.EiriniCompatibility = EiriniCompatibilityAuto
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.EiriniLayout().Release).To(Equal(EiriniCompatibilityController))
+		})
+
+		It("falls back to the legacy release without statefulsets", func() {
+			eiriniManager.Options.EiriniCompatibility = EiriniCompatibilityAuto
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.EiriniLayout().Release).To(Equal(EiriniCompatibilityLegacy))
+			Expect(reader.ListCallCount()).To(Equal(2))
+		})
+
+		It("filters the app pods of the release in the webhooks", func() {
+			failurePolicy := admissionregistrationv1beta1.Fail
+			w := NewWebhook(&catalog.EditEnvExtension{}, eiriniManager)
+			Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+				ID:             "env",
+				ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, Namespace: "eirini", OperatorFingerprint: "eirini-x"},
+				EiriniLayout:   fixtureLayout(EiriniCompatibilityController),
+			})).To(Succeed())
+
+			Expect(w.GetLabelSelector().MatchLabels).To(Equal(map[string]string{"workloads.cloudfoundry.org/source_type": "APP"}))
+		})
+	})
+})
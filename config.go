@@ -0,0 +1,248 @@
+package extension
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ConfigSchema is a JSON schema (the subset used by OpenAPI v3) describing the configuration of an Extension
+type ConfigSchema struct {
+	Type                 string                   `json:"type,omitempty"`
+	Description          string                   `json:"description,omitempty"`
+	Properties           map[string]*ConfigSchema `json:"properties,omitempty"`
+	Required             []string                 `json:"required,omitempty"`
+	AdditionalProperties *bool                    `json:"additionalProperties,omitempty"`
+	Items                *ConfigSchema            `json:"items,omitempty"`
+	Enum                 []interface{}            `json:"enum,omitempty"`
+	Minimum              *float64                 `json:"minimum,omitempty"`
+	Maximum              *float64                 `json:"maximum,omitempty"`
+	Default              interface{}              `json:"default,omitempty"`
+}
+
+// ConfigurableExtension is implemented by the extensions (Extensions, Watchers or Reconcilers) which accept a configuration.
+//
+// The configuration is read from ManagerOptions.ExtensionConfig, validated against the schema and passed to Configure
+// before the extensions are registered.
+type ConfigurableExtension interface {
+	// ConfigKey is the key of the extension configuration in ManagerOptions.ExtensionConfig
+	ConfigKey() string
+	// ConfigSchema returns the schema of the configuration
+	ConfigSchema() *ConfigSchema
+	// Configure receives the validated JSON configuration
+	Configure(config []byte) error
+}
+
+// Validate checks that the JSON document satisfies the schema, and returns all the violations found
+func (s *ConfigSchema) Validate(config []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(config, &v); err != nil {
+		return errors.Wrap(err, "decoding the configuration")
+	}
+	return utilerrors.NewAggregate(s.validate("", v))
+}
+
+func (s *ConfigSchema) validate(path string, v interface{}) []error {
+	if s == nil {
+		return nil
+	}
+	field := path
+	if field == "" {
+		field = "<root>"
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(normalizeJSON(e), v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []error{errors.Errorf("%s: value %v is not one of %v", field, v, s.Enum)}
+		}
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return []error{errors.Errorf("%s: expected an object", field)}
+		}
+		return s.validateObject(path, obj)
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return []error{errors.Errorf("%s: expected an array", field)}
+		}
+		var errs []error
+		for i, item := range arr {
+			errs = append(errs, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+		return errs
+	case "string":
+		if _, ok := v.(string); !ok {
+			return []error{errors.Errorf("%s: expected a string", field)}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []error{errors.Errorf("%s: expected a boolean", field)}
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok {
+			return []error{errors.Errorf("%s: expected a number", field)}
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			return []error{errors.Errorf("%s: expected an integer", field)}
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return []error{errors.Errorf("%s: %v is lower than the minimum %v", field, n, *s.Minimum)}
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return []error{errors.Errorf("%s: %v is greater than the maximum %v", field, n, *s.Maximum)}
+		}
+	default:
+		return []error{errors.Errorf("%s: unsupported schema type '%s'", field, s.Type)}
+	}
+	return nil
+}
+
+func (s *ConfigSchema) validateObject(path string, obj map[string]interface{}) []error {
+	var errs []error
+	for _, r := range s.Required {
+		if _, ok := obj[r]; !ok {
+			errs = append(errs, errors.Errorf("%s: missing required field", joinConfigPath(path, r)))
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		prop, ok := s.Properties[k]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				errs = append(errs, errors.Errorf("%s: unknown field", joinConfigPath(path, k)))
+			}
+			continue
+		}
+		errs = append(errs, prop.validate(joinConfigPath(path, k), obj[k])...)
+	}
+	return errs
+}
+
+func joinConfigPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// normalizeJSON converts a Go value to its representation once decoded from JSON, e.g. ints to float64
+func normalizeJSON(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var n interface{}
+	if err := json.Unmarshal(b, &n); err != nil {
+		return v
+	}
+	return n
+}
+
+// configurableExtensions returns all the extensions, watchers and reconcilers accepting a configuration
+func (m *DefaultExtensionManager) configurableExtensions() []ConfigurableExtension {
+	var configurable []ConfigurableExtension
+	for _, e := range m.allExtensions() {
+		if c, ok := e.(ConfigurableExtension); ok {
+			configurable = append(configurable, c)
+		}
+	}
+	return configurable
+}
+
+// ConfigSchema returns the schema of the whole ManagerOptions.ExtensionConfig, merging the schemas of the
+// configurable extensions. It returns nil if no extension accepts a configuration.
+func (m *DefaultExtensionManager) ConfigSchema() *ConfigSchema {
+	configurable := m.configurableExtensions()
+	if len(configurable) == 0 {
+		return nil
+	}
+
+	schema := &ConfigSchema{Type: "object", Properties: map[string]*ConfigSchema{}}
+	for _, c := range configurable {
+		schema.Properties[c.ConfigKey()] = c.ConfigSchema()
+	}
+	return schema
+}
+
+// ConfigureExtensions validates the configuration of each configurable extension against its schema
+// and passes it to the extension. An empty object is validated when no configuration is supplied.
+func (m *DefaultExtensionManager) ConfigureExtensions() error {
+	var errs []error
+	for _, c := range m.configurableExtensions() {
+		config := configFor(m.Options.ExtensionConfig, c)
+		if err := c.ConfigSchema().Validate(config); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid configuration for '%s'", c.ConfigKey()))
+			continue
+		}
+		if err := c.Configure(config); err != nil {
+			errs = append(errs, errors.Wrapf(err, "configuring '%s'", c.ConfigKey()))
+		}
+	}
+	if err := m.validateScopedConfig(m.Options.ExtensionConfig); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Reconfigure replaces the configuration of the extensions while the Manager is running. The whole
+// configuration is validated first, and nothing is changed if it is invalid. Once the extensions are
+// configured, the config generation is bumped and the ConfigChangeHooks are run, see InvalidateCaches.
+// The ScopedConfig overrides are kept, and must remain valid once applied to the new configuration.
+func (m *DefaultExtensionManager) Reconfigure(extensionConfig map[string]json.RawMessage) error {
+	var errs []error
+	for _, c := range m.configurableExtensions() {
+		config := configFor(extensionConfig, c)
+		if err := c.ConfigSchema().Validate(config); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid configuration for '%s'", c.ConfigKey()))
+		}
+	}
+	if err := m.validateScopedConfig(extensionConfig); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	m.Options.ExtensionConfig = extensionConfig
+	for _, c := range m.configurableExtensions() {
+		if err := c.Configure(configFor(extensionConfig, c)); err != nil {
+			errs = append(errs, errors.Wrapf(err, "configuring '%s'", c.ConfigKey()))
+		}
+	}
+	m.InvalidateCaches()
+	return utilerrors.NewAggregate(errs)
+}
+
+// configFor returns the configuration of the extension, or an empty object if none is supplied
+func configFor(extensionConfig map[string]json.RawMessage, c ConfigurableExtension) []byte {
+	config := []byte(extensionConfig[c.ConfigKey()])
+	if len(config) == 0 {
+		config = []byte("{}")
+	}
+	return config
+}
@@ -0,0 +1,203 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type sidecarExtension struct {
+	config []byte
+}
+
+func (e *sidecarExtension) Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response {
+	return admission.Allowed("")
+}
+
+func (e *sidecarExtension) ConfigKey() string {
+	return "sidecar"
+}
+
+func (e *sidecarExtension) ConfigSchema() *ConfigSchema {
+	max := float64(10)
+	return &ConfigSchema{
+		Type:     "object",
+		Required: []string{"image"},
+		Properties: map[string]*ConfigSchema{
+			"image":    {Type: "string"},
+			"replicas": {Type: "integer", Maximum: &max},
+			"mode":     {Type: "string", Enum: []interface{}{"strict", "lenient"}},
+		},
+	}
+}
+
+func (e *sidecarExtension) Configure(config []byte) error {
+	e.config = config
+	return nil
+}
+
+var _ = Describe("Extensions configuration", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		ext           *sidecarExtension
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		ext = &sidecarExtension{}
+		Expect(eiriniManager.AddExtension(ext)).To(Succeed())
+	})
+
+	It("validates and passes the configuration to the extensions", func() {
+		eiriniManager.Options.ExtensionConfig = map[string]json.RawMessage{
+			"sidecar": json.RawMessage(`{"image": "busybox", "replicas": 2, "mode": "strict"}`),
+		}
+		Expect(eiriniManager.ConfigureExtensions()).To(Succeed())
+		Expect(string(ext.config)).To(ContainSubstring("busybox"))
+	})
+
+	It("reports all the violations", func() {
+		eiriniManager.Options.ExtensionConfig = map[string]json.RawMessage{
+			"sidecar": json.RawMessage(`{"replicas": 20, "mode": "other"}`),
+		}
+		err := eiriniManager.ConfigureExtensions()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("image: missing required field"))
+		Expect(err.Error()).To(ContainSubstring("replicas: 20 is greater than the maximum 10"))
+		Expect(err.Error()).To(ContainSubstring("mode: value other is not one of"))
+		Expect(ext.config).To(BeNil())
+	})
+
+	It("validates an empty configuration if none is supplied", func() {
+		Expect(eiriniManager.ConfigureExtensions()).ToNot(Succeed())
+	})
+
+	Context("when the configuration changes", func() {
+		var generations []int64
+
+		BeforeEach(func() {
+			generations = nil
+			eiriniManager.OnConfigChange(func(generation int64) {
+				generations = append(generations, generation)
+			})
+		})
+
+		It("reconfigures the extensions and bumps the generation", func() {
+			Expect(eiriniManager.ConfigGeneration()).To(Equal(int64(0)))
+			Expect(eiriniManager.Reconfigure(map[string]json.RawMessage{
+				"sidecar": json.RawMessage(`{"image": "alpine"}`),
+			})).To(Succeed())
+			Expect(string(ext.config)).To(ContainSubstring("alpine"))
+			Expect(eiriniManager.ConfigGeneration()).To(Equal(int64(1)))
+			Expect(generations).To(Equal([]int64{1}))
+
+			eiriniManager.InvalidateCaches()
+			Expect(generations).To(Equal([]int64{1, 2}))
+		})
+
+		It("keeps the current configuration when the new one is invalid", func() {
+			Expect(eiriniManager.Reconfigure(map[string]json.RawMessage{
+				"sidecar": json.RawMessage(`{"replicas": 20}`),
+			})).ToNot(Succeed())
+			Expect(ext.config).To(BeNil())
+			Expect(eiriniManager.ConfigGeneration()).To(Equal(int64(0)))
+			Expect(generations).To(BeEmpty())
+		})
+
+		It("records the generation in the audit annotations", func() {
+			eiriniManager.InvalidateCaches()
+			w := NewWebhook(ext, eiriniManager)
+			res := w.Handle(context.Background(), admission.Request{})
+			Expect(res.AuditAnnotations).To(HaveKeyWithValue(AnnotationConfigGeneration, "1"))
+		})
+	})
+
+	It("exposes the merged schema in the status", func() {
+		schema := eiriniManager.ConfigSchema()
+		Expect(schema.Properties).To(HaveKey("sidecar"))
+
+		rec := httptest.NewRecorder()
+		eiriniManager.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		var status Status
+		Expect(json.Unmarshal(rec.Body.Bytes(), &status)).To(Succeed())
+		Expect(status.Extensions).To(HaveLen(1))
+		Expect(status.ConfigSchema.Properties["sidecar"].Required).To(Equal([]string{"image"}))
+	})
+
+	Context("with org and space overrides", func() {
+		var pod *corev1.Pod
+
+		BeforeEach(func() {
+			eiriniManager.Options.ExtensionConfig = map[string]json.RawMessage{
+				"sidecar": json.RawMessage(`{"image": "busybox", "replicas": 1, "mode": "strict"}`),
+			}
+			eiriniManager.Options.ScopedConfig = &ScopedExtensionConfig{
+				Orgs: map[string]map[string]json.RawMessage{
+					"system": {"sidecar": json.RawMessage(`{"replicas": 2, "mode": null}`)},
+				},
+				Spaces: map[string]map[string]json.RawMessage{
+					"space-guid": {"sidecar": json.RawMessage(`{"replicas": 3}`)},
+				},
+			}
+			pod = &corev1.Pod{}
+			pod.Annotations = map[string]string{
+				"cloudfoundry.org/org_name":   "system",
+				"cloudfoundry.org/space_guid": "other-space-guid",
+			}
+		})
+
+		resolve := func() map[string]interface{} {
+			config, err := eiriniManager.ResolveConfig("sidecar", pod)
+			Expect(err).ToNot(HaveOccurred())
+			resolved := map[string]interface{}{}
+			Expect(json.Unmarshal(config, &resolved)).To(Succeed())
+			return resolved
+		}
+
+		It("overrides the global configuration with the one of the org", func() {
+			Expect(resolve()).To(Equal(map[string]interface{}{"image": "busybox", "replicas": float64(2)}))
+		})
+
+		It("overrides the configuration of the org with the one of the space", func() {
+			pod.Annotations["cloudfoundry.org/space_guid"] = "space-guid"
+			Expect(resolve()).To(HaveKeyWithValue("replicas", float64(3)))
+		})
+
+		It("overrides the configuration of the space with the annotation of the app", func() {
+			pod.Annotations["cloudfoundry.org/space_guid"] = "space-guid"
+			pod.Annotations[AnnotationConfigPrefix+"sidecar"] = `{"replicas": 4, "image": "alpine"}`
+			Expect(resolve()).To(Equal(map[string]interface{}{"image": "alpine", "replicas": float64(4)}))
+		})
+
+		It("uses the global configuration for the pods out of the scopes", func() {
+			pod = nil
+			Expect(resolve()).To(HaveKeyWithValue("mode", "strict"))
+		})
+
+		It("validates the resolved configuration", func() {
+			pod.Annotations[AnnotationConfigPrefix+"sidecar"] = `{"replicas": 20}`
+			_, err := eiriniManager.ResolveConfig("sidecar", pod)
+			Expect(err).To(MatchError(ContainSubstring("replicas: 20 is greater than the maximum 10")))
+
+			_, err = eiriniManager.ResolveConfig("unknown", pod)
+			Expect(err).To(MatchError(ContainSubstring("No extension accepts the configuration 'unknown'")))
+		})
+
+		It("validates the overrides with the configuration", func() {
+			eiriniManager.Options.ScopedConfig.Spaces["space-guid"]["sidecar"] = json.RawMessage(`{"mode": "other"}`)
+			err := eiriniManager.ConfigureExtensions()
+			Expect(err).To(MatchError(ContainSubstring("invalid configuration for 'sidecar' in the space space-guid")))
+		})
+	})
+})
@@ -0,0 +1,126 @@
+package extension
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	jsonpatchapply "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// AnnotationConfigHashPrefix prefixes the annotations stamped on the pods mutated by a ConfigurableExtension,
+	// holding the hash of the configuration the extension mutated the pod with, e.g.
+	// config-hash.eirinix.cloudfoundry.org/sidecar: 5f2b1c0d9e8a7b6c. See ManagerOptions.AnnotateConfigHash
+	AnnotationConfigHashPrefix = "config-hash.eirinix.cloudfoundry.org/"
+
+	configHashLength = 16
+)
+
+// ConfigHash returns the hash of a JSON configuration, which doesn't depend on its formatting nor on the
+// order of its fields
+func ConfigHash(config []byte) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(config, &v); err != nil {
+		return "", errors.Wrap(err, "decoding the configuration")
+	}
+	// Maps are marshaled with sorted keys
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:])[:configHashLength], nil
+}
+
+// ConfigStale returns true if the pod was mutated by the extension with the config key with another
+// configuration than its current one for the app, e.g. so that a reconciler restarts the app. The pods
+// without the AnnotationConfigHashPrefix annotation of the extension are not stale.
+func (m *DefaultExtensionManager) ConfigStale(key string, pod *corev1.Pod) (bool, error) {
+	if pod == nil {
+		return false, nil
+	}
+	stamped, ok := pod.GetAnnotations()[AnnotationConfigHashPrefix+key]
+	if !ok {
+		return false, nil
+	}
+	config, err := m.ResolveConfig(key, pod)
+	if err != nil {
+		return false, err
+	}
+	hash, err := ConfigHash(config)
+	if err != nil {
+		return false, err
+	}
+	return hash != stamped, nil
+}
+
+// annotateConfigHash adds the operation stamping the hash of the configuration of the extension to the patch
+// of the response, if the extension is configurable and mutated the pod
+func (w *DefaultMutatingWebhook) annotateConfigHash(ctx context.Context, req admission.Request, res admission.Response) admission.Response {
+	c, ok := w.EiriniExtension.(ConfigurableExtension)
+	if !ok || w.EiriniExtensionManager == nil || !res.Allowed || (len(res.Patches) == 0 && len(res.Patch) == 0) {
+		return res
+	}
+	if (req.Kind.Kind != "" && req.Kind.Kind != "Pod") || len(req.Object.Raw) == 0 {
+		return res
+	}
+
+	op, err := configHashOperation(w.EiriniExtensionManager, c.ConfigKey(), req.Object.Raw, res)
+	if err != nil {
+		ctxlog.Debugf(ctx, "Not stamping the configuration hash of %s: %s", w.Name, err)
+		return res
+	}
+	ops, _ := podwebhook.ResponsePatches(res)
+	res.Patches = append(ops, op)
+	res.Patch = nil
+	return res
+}
+
+// configHashOperation returns the operation setting the annotation of the configuration hash, once the patch
+// of the response is applied to the pod
+func configHashOperation(m Manager, key string, raw []byte, res admission.Response) (jsonpatch.JsonPatchOperation, error) {
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(raw, pod); err != nil {
+		return jsonpatch.JsonPatchOperation{}, errors.Wrap(err, "decoding the pod")
+	}
+	config, err := m.ResolveConfig(key, pod)
+	if err != nil {
+		return jsonpatch.JsonPatchOperation{}, err
+	}
+	hash, err := ConfigHash(config)
+	if err != nil {
+		return jsonpatch.JsonPatchOperation{}, err
+	}
+
+	// The patch may add the annotations of the pod
+	ops, err := podwebhook.ResponsePatches(res)
+	if err != nil {
+		return jsonpatch.JsonPatchOperation{}, err
+	}
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return jsonpatch.JsonPatchOperation{}, err
+	}
+	p, err := jsonpatchapply.DecodePatch(patch)
+	if err != nil {
+		return jsonpatch.JsonPatchOperation{}, errors.Wrap(err, "decoding the patch")
+	}
+	patched, err := p.Apply(raw)
+	if err != nil {
+		return jsonpatch.JsonPatchOperation{}, errors.Wrap(err, "applying the patch")
+	}
+	mutated := &corev1.Pod{}
+	if err := json.Unmarshal(patched, mutated); err != nil {
+		return jsonpatch.JsonPatchOperation{}, errors.Wrap(err, "decoding the mutated pod")
+	}
+
+	return podwebhook.AnnotationPatch(mutated, AnnotationConfigHashPrefix+key, hash)
+}
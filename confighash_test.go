@@ -0,0 +1,109 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// labelingSidecarExtension is a configurable extension mutating the pods
+type labelingSidecarExtension struct {
+	sidecarExtension
+}
+
+func (e *labelingSidecarExtension) Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response {
+	return admission.Patched("", jsonpatch.NewOperation("add", "/metadata/labels", map[string]string{"sidecar": "true"}))
+}
+
+var _ = Describe("Configuration hash", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		ext           *labelingSidecarExtension
+		pod           *corev1.Pod
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Options.ExtensionConfig = map[string]json.RawMessage{
+			"sidecar": json.RawMessage(`{"image": "busybox", "replicas": 1}`),
+		}
+		ext = &labelingSidecarExtension{}
+		Expect(eiriniManager.AddExtension(ext)).To(Succeed())
+		pod = &corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: "app-0", Namespace: "eirini"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "opi", Image: "eirini/dora"}}},
+		}
+	})
+
+	handle := func() admission.Response {
+		failurePolicy := admissionregistrationv1beta1.Fail
+		w := NewWebhook(ext, eiriniManager)
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+			ID:             "0",
+			ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, AnnotateConfigHash: true},
+		})).To(Succeed())
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+
+		req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Operation: admissionv1beta1.Create,
+		}}
+		req.Object.Raw, _ = json.Marshal(pod)
+		return w.Handle(context.Background(), req)
+	}
+
+	It("doesn't depend on the formatting of the configuration", func() {
+		a, err := ConfigHash([]byte(`{"image": "busybox", "replicas": 1}`))
+		Expect(err).ToNot(HaveOccurred())
+		b, err := ConfigHash([]byte(`{"replicas":1,"image":"busybox"}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a).To(Equal(b))
+		Expect(a).To(HaveLen(16))
+	})
+
+	It("stamps the mutated pods with the hash of the configuration", func() {
+		hash, err := ConfigHash(eiriniManager.Options.ExtensionConfig["sidecar"])
+		Expect(err).ToNot(HaveOccurred())
+
+		res := handle()
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Patches).To(HaveLen(2))
+		Expect(res.Patches[1]).To(Equal(jsonpatch.NewOperation("add", "/metadata/annotations",
+			map[string]string{AnnotationConfigHashPrefix + "sidecar": hash})))
+
+		pod.Annotations = map[string]string{"cloudfoundry.org/org_name": "system"}
+		res = handle()
+		Expect(res.Patches[1]).To(Equal(jsonpatch.NewOperation("add",
+			"/metadata/annotations/config-hash.eirinix.cloudfoundry.org~1sidecar", hash)))
+	})
+
+	It("tells the pods mutated with a stale configuration", func() {
+		hash, err := ConfigHash(eiriniManager.Options.ExtensionConfig["sidecar"])
+		Expect(err).ToNot(HaveOccurred())
+		pod.Annotations = map[string]string{AnnotationConfigHashPrefix + "sidecar": hash}
+		Expect(eiriniManager.ConfigStale("sidecar", pod)).To(BeFalse())
+
+		eiriniManager.Options.ExtensionConfig["sidecar"] = json.RawMessage(`{"image": "alpine"}`)
+		Expect(eiriniManager.ConfigStale("sidecar", pod)).To(BeTrue())
+
+		delete(pod.Annotations, AnnotationConfigHashPrefix+"sidecar")
+		Expect(eiriniManager.ConfigStale("sidecar", pod)).To(BeFalse())
+	})
+})
@@ -0,0 +1,218 @@
+// Package antiaffinity contains an Eirini extension spreading the instances of each CF app across nodes and
+// zones, so that losing a node or a zone doesn't take down every instance of an app.
+//
+// The instances of an app prefer not to share a node, with a preferred pod anti-affinity on their app GUID,
+// and are spread across zones with a topology spread constraint. The policy can be changed per space.
+package antiaffinity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"code.cloudfoundry.org/eirinix/util/affinity"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ConfigKey is the key of the extension configuration in the ExtensionConfig of the ManagerOptions
+const ConfigKey = "anti-affinity"
+
+// Policy is how the instances of the apps of a space are spread
+type Policy struct {
+	// Disabled leaves the pods unchanged
+	Disabled bool `json:"disabled,omitempty"`
+
+	// HostWeight is the weight, between 1 and 100, of the preference for instances of the same app not to
+	// share a node. 0 disables the anti-affinity.
+	HostWeight int32 `json:"hostWeight"`
+
+	// ZoneMaxSkew is the maximum difference of the number of instances of an app between two zones.
+	// 0 disables the zone spread.
+	ZoneMaxSkew int32 `json:"zoneMaxSkew"`
+
+	// RequireZoneSpread keeps the instances pending rather than breaking the zone spread
+	RequireZoneSpread bool `json:"requireZoneSpread,omitempty"`
+}
+
+// DefaultPolicy prefers spreading the instances over nodes, and keeps them balanced across zones
+// when possible
+func DefaultPolicy() Policy {
+	return Policy{HostWeight: 100, ZoneMaxSkew: 1}
+}
+
+func (p Policy) validate() error {
+	if p.HostWeight < 0 || p.HostWeight > 100 {
+		return errors.Errorf("hostWeight %d must be between 0 and 100", p.HostWeight)
+	}
+	if p.ZoneMaxSkew < 0 {
+		return errors.Errorf("zoneMaxSkew %d must not be negative", p.ZoneMaxSkew)
+	}
+	return nil
+}
+
+// Extension spreads the instances of the Eirini apps with the policy of their space
+type Extension struct {
+	mu sync.RWMutex
+
+	// Default is the policy of the spaces without their own
+	Default Policy
+	// Spaces are the policies of the spaces, by space GUID or space name
+	Spaces map[string]Policy
+}
+
+// NewExtension returns an Extension applying the DefaultPolicy to every space
+func NewExtension() *Extension {
+	return &Extension{Default: DefaultPolicy()}
+}
+
+// SetSpacePolicy sets the policy of a space, by GUID or name
+func (e *Extension) SetSpacePolicy(space string, p Policy) error {
+	if err := p.validate(); err != nil {
+		return errors.Wrapf(err, "policy of space %s", space)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Spaces == nil {
+		e.Spaces = map[string]Policy{}
+	}
+	e.Spaces[space] = p
+	return nil
+}
+
+// PolicyFor returns the policy of the space, looked up by GUID and then by name
+func (e *Extension) PolicyFor(spaceGUID, spaceName string) Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, key := range []string{spaceGUID, spaceName} {
+		if p, ok := e.Spaces[key]; ok && key != "" {
+			return p
+		}
+	}
+	return e.Default
+}
+
+// Inject adds the anti-affinity and the zone spread of the app of the pod, and returns false if the pod
+// is not an app instance or the policy of its space leaves it unchanged
+func (e *Extension) Inject(pod *corev1.Pod, layout eirinix.EiriniLayout) bool {
+	guid := layout.AppGUID(pod)
+	if guid == "" {
+		return false
+	}
+	p := e.PolicyFor(layout.SpaceGUID(pod), layout.SpaceName(pod))
+	if p.Disabled || (p.HostWeight == 0 && p.ZoneMaxSkew == 0) {
+		return false
+	}
+
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{layout.LabelAppGUID: guid}}
+	if p.HostWeight > 0 {
+		affinity.AddPreferredPodAntiAffinity(pod, corev1.WeightedPodAffinityTerm{
+			Weight: p.HostWeight,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: selector,
+				TopologyKey:   affinity.TopologyHostname,
+			},
+		})
+	}
+	if p.ZoneMaxSkew > 0 {
+		when := corev1.ScheduleAnyway
+		if p.RequireZoneSpread {
+			when = corev1.DoNotSchedule
+		}
+		affinity.AddTopologySpreadConstraint(pod, corev1.TopologySpreadConstraint{
+			MaxSkew:           p.ZoneMaxSkew,
+			TopologyKey:       affinity.TopologyZone,
+			WhenUnsatisfiable: when,
+			LabelSelector:     selector,
+		})
+	}
+	return true
+}
+
+// Handle spreads the Eirini app pods, and admits the other pods unchanged
+func (e *Extension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if pod == nil {
+		return admission.Errored(http.StatusBadRequest, errors.New("No pod could be decoded from the request"))
+	}
+
+	podCopy := pod.DeepCopy()
+	if !e.Inject(podCopy, eiriniManager.EiriniLayout()) {
+		return admission.Allowed("")
+	}
+	return eiriniManager.PatchFromPod(req, podCopy)
+}
+
+// config is the JSON configuration of the extension. The fields missing from the policies of the spaces
+// are the ones of the default policy, and the fields missing from the default policy the DefaultPolicy ones.
+type config struct {
+	Default json.RawMessage            `json:"default,omitempty"`
+	Spaces  map[string]json.RawMessage `json:"spaces,omitempty"`
+}
+
+func decodePolicy(data json.RawMessage, base Policy) (Policy, error) {
+	p := base
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &p); err != nil {
+			return p, err
+		}
+	}
+	return p, p.validate()
+}
+
+// ConfigKey is the key of the extension configuration
+func (e *Extension) ConfigKey() string {
+	return ConfigKey
+}
+
+// ConfigSchema returns the schema of the extension configuration
+func (e *Extension) ConfigSchema() *eirinix.ConfigSchema {
+	min, maxWeight := float64(0), float64(100)
+	policy := &eirinix.ConfigSchema{
+		Type: "object",
+		Properties: map[string]*eirinix.ConfigSchema{
+			"disabled":          {Type: "boolean"},
+			"hostWeight":        {Type: "integer", Minimum: &min, Maximum: &maxWeight, Default: 100},
+			"zoneMaxSkew":       {Type: "integer", Minimum: &min, Default: 1},
+			"requireZoneSpread": {Type: "boolean"},
+		},
+	}
+	return &eirinix.ConfigSchema{
+		Type: "object",
+		Properties: map[string]*eirinix.ConfigSchema{
+			"default": policy,
+			"spaces": {
+				Type:        "object",
+				Description: "Policies by space GUID or name, with the same fields as the default one",
+			},
+		},
+	}
+}
+
+// Configure replaces the policies with the ones of the configuration
+func (e *Extension) Configure(data []byte) error {
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return errors.Wrap(err, "decoding the anti-affinity configuration")
+	}
+
+	def, err := decodePolicy(c.Default, DefaultPolicy())
+	if err != nil {
+		return errors.Wrap(err, "default policy")
+	}
+	spaces := map[string]Policy{}
+	for space, data := range c.Spaces {
+		if spaces[space], err = decodePolicy(data, def); err != nil {
+			return errors.Wrapf(err, "policy of space %s", space)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Default = def
+	e.Spaces = spaces
+	return nil
+}
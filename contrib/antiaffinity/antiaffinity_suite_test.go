@@ -0,0 +1,13 @@
+package antiaffinity_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAntiAffinity(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "AntiAffinity Suite")
+}
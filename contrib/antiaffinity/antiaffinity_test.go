@@ -0,0 +1,105 @@
+package antiaffinity_test
+
+import (
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/contrib/antiaffinity"
+	"code.cloudfoundry.org/eirinix/util/affinity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Anti-affinity extension", func() {
+	var (
+		layout eirinix.EiriniLayout
+		pod    *corev1.Pod
+		ext    *Extension
+	)
+
+	BeforeEach(func() {
+		var err error
+		layout, err = eirinix.EiriniLayoutFor(eirinix.EiriniCompatibilityLegacy)
+		Expect(err).ToNot(HaveOccurred())
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:   "dora-space-0",
+			Labels: map[string]string{layout.LabelAppGUID: "guid", layout.LabelSourceType: "APP"},
+			Annotations: map[string]string{
+				layout.AnnotationSpaceGUID: "space-guid",
+				layout.AnnotationSpaceName: "space",
+			},
+		}}
+		ext = NewExtension()
+	})
+
+	It("spreads the instances of the app across nodes and zones", func() {
+		Expect(ext.Inject(pod, layout)).To(BeTrue())
+
+		selector := &metav1.LabelSelector{MatchLabels: map[string]string{layout.LabelAppGUID: "guid"}}
+		Expect(pod.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution).To(Equal([]corev1.WeightedPodAffinityTerm{{
+			Weight: 100,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: selector,
+				TopologyKey:   affinity.TopologyHostname,
+			},
+		}}))
+		Expect(pod.Spec.TopologySpreadConstraints).To(Equal([]corev1.TopologySpreadConstraint{{
+			MaxSkew:           1,
+			TopologyKey:       affinity.TopologyZone,
+			WhenUnsatisfiable: corev1.ScheduleAnyway,
+			LabelSelector:     selector,
+		}}))
+	})
+
+	It("is idempotent", func() {
+		Expect(ext.Inject(pod, layout)).To(BeTrue())
+		injected := pod.DeepCopy()
+		Expect(ext.Inject(pod, layout)).To(BeTrue())
+		Expect(pod).To(Equal(injected))
+	})
+
+	It("leaves the pods which are not app instances unchanged", func() {
+		delete(pod.Labels, layout.LabelAppGUID)
+		Expect(ext.Inject(pod, layout)).To(BeFalse())
+		Expect(pod.Spec.Affinity).To(BeNil())
+		Expect(pod.Spec.TopologySpreadConstraints).To(BeEmpty())
+	})
+
+	It("applies the policy of the space, by guid before name", func() {
+		Expect(ext.SetSpacePolicy("space", Policy{Disabled: true})).To(Succeed())
+		Expect(ext.SetSpacePolicy("space-guid", Policy{ZoneMaxSkew: 2, RequireZoneSpread: true})).To(Succeed())
+
+		Expect(ext.Inject(pod, layout)).To(BeTrue())
+		Expect(pod.Spec.Affinity).To(BeNil())
+		Expect(pod.Spec.TopologySpreadConstraints).To(HaveLen(1))
+		Expect(pod.Spec.TopologySpreadConstraints[0].MaxSkew).To(Equal(int32(2)))
+		Expect(pod.Spec.TopologySpreadConstraints[0].WhenUnsatisfiable).To(Equal(corev1.DoNotSchedule))
+	})
+
+	It("leaves the pods of the disabled spaces unchanged", func() {
+		Expect(ext.SetSpacePolicy("space", Policy{Disabled: true})).To(Succeed())
+		Expect(ext.Inject(pod, layout)).To(BeFalse())
+		Expect(pod.Spec.Affinity).To(BeNil())
+	})
+
+	It("rejects the invalid policies", func() {
+		Expect(ext.SetSpacePolicy("space", Policy{HostWeight: 101})).ToNot(Succeed())
+		Expect(ext.SetSpacePolicy("space", Policy{ZoneMaxSkew: -1})).ToNot(Succeed())
+	})
+
+	Context("configured", func() {
+		It("completes the policies of the spaces with the default one", func() {
+			Expect(ext.Configure([]byte(`{"default":{"hostWeight":50},"spaces":{"space":{"requireZoneSpread":true}}}`))).To(Succeed())
+
+			Expect(ext.PolicyFor("other", "other")).To(Equal(Policy{HostWeight: 50, ZoneMaxSkew: 1}))
+			Expect(ext.PolicyFor("", "space")).To(Equal(Policy{HostWeight: 50, ZoneMaxSkew: 1, RequireZoneSpread: true}))
+		})
+
+		It("fails on invalid configurations", func() {
+			Expect(ext.Configure([]byte(`{"default":{"hostWeight":500}}`))).ToNot(Succeed())
+			Expect(ext.Configure([]byte(`{"spaces":{"space":{"zoneMaxSkew":-1}}}`))).ToNot(Succeed())
+			Expect(ext.Configure([]byte(`[]`))).ToNot(Succeed())
+			Expect(ext.PolicyFor("", "space")).To(Equal(DefaultPolicy()))
+		})
+	})
+})
@@ -0,0 +1,103 @@
+// Package deletioncost contains an Eirini extension setting the eviction preferences of the app instances.
+//
+// When a node is drained or the cluster is scaled down, the first instances of an app (the lowest CF
+// instance indexes) should be the last ones to go, so that an app with few instances keeps serving.
+package deletioncost
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// AnnotationDeletionCost is the pod annotation ordering the pods deleted first when their controller scales down
+	AnnotationDeletionCost = "controller.kubernetes.io/pod-deletion-cost"
+	// AnnotationSafeToEvict is the pod annotation telling the cluster autoscaler whether it can evict the pod
+	AnnotationSafeToEvict = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+	labelPodName = "statefulset.kubernetes.io/pod-name"
+)
+
+// CostFunc returns the deletion cost of the instance with the given CF instance index
+type CostFunc func(index int) int32
+
+// DefaultCost gives the highest cost to the first instance, so that the instances are evicted in the
+// reverse order of their index
+func DefaultCost(index int) int32 {
+	return int32(-index)
+}
+
+// Extension annotates the app pods with a deletion cost derived from their CF instance index, and protects
+// the first instances from the evictions of the cluster autoscaler
+type Extension struct {
+	// Cost computes the deletion cost of an instance. Optional, defaults to DefaultCost
+	Cost CostFunc
+
+	// ProtectedInstances is the number of first instances annotated as not safe to evict. Optional,
+	// the annotation isn't set if 0
+	ProtectedInstances int
+}
+
+// NewExtension returns an Extension with the default cost, protecting the given number of first instances
+func NewExtension(protectedInstances int) *Extension {
+	return &Extension{ProtectedInstances: protectedInstances}
+}
+
+// InstanceIndex returns the CF instance index of an app pod, which is the ordinal of the pod in the Eirini
+// StatefulSet. It returns false if the pod has no ordinal.
+func InstanceIndex(pod *corev1.Pod) (int, bool) {
+	name := pod.Name
+	if name == "" {
+		name = pod.Labels[labelPodName]
+	}
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return 0, false
+	}
+	index, err := strconv.Atoi(name[i+1:])
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+// Inject sets the eviction annotations on the pod, and returns false if the pod has no instance index
+func (e *Extension) Inject(pod *corev1.Pod) bool {
+	index, ok := InstanceIndex(pod)
+	if !ok {
+		return false
+	}
+
+	cost := e.Cost
+	if cost == nil {
+		cost = DefaultCost
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[AnnotationDeletionCost] = strconv.Itoa(int(cost(index)))
+	if e.ProtectedInstances > 0 {
+		pod.Annotations[AnnotationSafeToEvict] = strconv.FormatBool(index >= e.ProtectedInstances)
+	}
+	return true
+}
+
+// Handle annotates the Eirini app pods, and admits the other pods unchanged
+func (e *Extension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if pod == nil {
+		return admission.Errored(http.StatusBadRequest, errors.New("No pod could be decoded from the request"))
+	}
+
+	podCopy := pod.DeepCopy()
+	if _, ok := podCopy.Labels[eirinix.LabelAppGUID]; !ok || !e.Inject(podCopy) {
+		return admission.Allowed("")
+	}
+	return eiriniManager.PatchFromPod(req, podCopy)
+}
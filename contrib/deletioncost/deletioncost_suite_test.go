@@ -0,0 +1,13 @@
+package deletioncost_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDeletionCost(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DeletionCost Suite")
+}
@@ -0,0 +1,64 @@
+package deletioncost_test
+
+import (
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/contrib/deletioncost"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Deletion cost extension", func() {
+	newPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{eirinix.LabelAppGUID: "guid"},
+		}}
+	}
+
+	It("reads the instance index from the pod name", func() {
+		index, ok := InstanceIndex(newPod("dora-space-a1b2c3-12"))
+		Expect(ok).To(BeTrue())
+		Expect(index).To(Equal(12))
+
+		_, ok = InstanceIndex(newPod("dora"))
+		Expect(ok).To(BeFalse())
+		_, ok = InstanceIndex(newPod("dora-web"))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("falls back to the statefulset pod name label", func() {
+		pod := newPod("")
+		pod.Labels["statefulset.kubernetes.io/pod-name"] = "dora-3"
+		index, ok := InstanceIndex(pod)
+		Expect(ok).To(BeTrue())
+		Expect(index).To(Equal(3))
+	})
+
+	It("evicts the last instances first", func() {
+		first, last := newPod("dora-0"), newPod("dora-4")
+		e := NewExtension(2)
+		Expect(e.Inject(first)).To(BeTrue())
+		Expect(e.Inject(last)).To(BeTrue())
+
+		Expect(first.Annotations).To(HaveKeyWithValue(AnnotationDeletionCost, "0"))
+		Expect(last.Annotations).To(HaveKeyWithValue(AnnotationDeletionCost, "-4"))
+		Expect(first.Annotations).To(HaveKeyWithValue(AnnotationSafeToEvict, "false"))
+		Expect(last.Annotations).To(HaveKeyWithValue(AnnotationSafeToEvict, "true"))
+	})
+
+	It("uses a custom cost", func() {
+		pod := newPod("dora-2")
+		e := &Extension{Cost: func(index int) int32 { return int32(1000 - 10*index) }}
+		Expect(e.Inject(pod)).To(BeTrue())
+		Expect(pod.Annotations).To(HaveKeyWithValue(AnnotationDeletionCost, "980"))
+		Expect(pod.Annotations).ToNot(HaveKey(AnnotationSafeToEvict))
+	})
+
+	It("leaves the pods without index unchanged", func() {
+		pod := newPod("dora")
+		Expect(NewExtension(1).Inject(pod)).To(BeFalse())
+		Expect(pod.Annotations).To(BeEmpty())
+	})
+})
@@ -0,0 +1,159 @@
+// Package dnsconfig contains an Eirini extension which tunes the DNS configuration of the app pods.
+//
+// With the kubernetes default of ndots:5, every lookup of an external hostname is first tried against
+// each cluster search domain, which adds noticeable latency to the apps calling external services.
+package dnsconfig
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// AnnotationNdots can be set on a namespace (a CF space) to override the ndots option of its apps
+	AnnotationNdots = "eirinix.cloudfoundry.org/dns-ndots"
+	// AnnotationSearches can be set on a namespace to add search domains to its apps, as a comma separated list
+	AnnotationSearches = "eirinix.cloudfoundry.org/dns-searches"
+
+	optionNdots = "ndots"
+)
+
+// Extension sets the DNS policy, the ndots option and additional search domains on the app pods
+type Extension struct {
+	// Policy is the DNS policy of the pods. Optional, the pod policy is kept if empty
+	Policy corev1.DNSPolicy
+
+	// Ndots, if set, replaces the ndots resolver option
+	Ndots *int
+
+	// Searches are appended to the search domains of the pods
+	Searches []string
+
+	// Options are additional resolver options, e.g. single-request-reopen
+	Options []corev1.PodDNSConfigOption
+
+	// PerNamespace enables the overrides from the namespace annotations
+	PerNamespace bool
+}
+
+// NewExtension returns an Extension setting the ndots option of the app pods
+func NewExtension(ndots int) *Extension {
+	return &Extension{Ndots: &ndots}
+}
+
+// RequiredPermissions returns the permissions needed to read the namespace annotations, if PerNamespace is set
+func (e *Extension) RequiredPermissions() []rbacv1.PolicyRule {
+	if !e.PerNamespace {
+		return nil
+	}
+	return []rbacv1.PolicyRule{{
+		APIGroups: []string{""},
+		Resources: []string{"namespaces"},
+		Verbs:     []string{"get", "list", "watch"},
+	}}
+}
+
+// ForNamespace returns a copy of the extension with the overrides of the namespace annotations applied
+func (e *Extension) ForNamespace(ns *corev1.Namespace) (*Extension, error) {
+	c := *e
+	c.Searches = append([]string{}, e.Searches...)
+
+	if v, ok := ns.Annotations[AnnotationNdots]; ok {
+		ndots, err := strconv.Atoi(v)
+		if err != nil || ndots < 0 {
+			return nil, errors.Errorf("Invalid %s annotation on namespace %s: %q", AnnotationNdots, ns.Name, v)
+		}
+		c.Ndots = &ndots
+	}
+	for _, s := range strings.Split(ns.Annotations[AnnotationSearches], ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			c.Searches = append(c.Searches, s)
+		}
+	}
+	return &c, nil
+}
+
+// Inject merges the DNS configuration into the pod. Search domains and options already set on the pod are kept,
+// except ndots which is replaced.
+func (e *Extension) Inject(pod *corev1.Pod) {
+	if e.Policy != "" {
+		pod.Spec.DNSPolicy = e.Policy
+	}
+	if e.Ndots == nil && len(e.Searches) == 0 && len(e.Options) == 0 {
+		return
+	}
+	if pod.Spec.DNSConfig == nil {
+		pod.Spec.DNSConfig = &corev1.PodDNSConfig{}
+	}
+	config := pod.Spec.DNSConfig
+
+	for _, s := range e.Searches {
+		if !contains(config.Searches, s) {
+			config.Searches = append(config.Searches, s)
+		}
+	}
+
+	options := e.Options
+	if e.Ndots != nil {
+		ndots := strconv.Itoa(*e.Ndots)
+		options = append(append([]corev1.PodDNSConfigOption{}, options...), corev1.PodDNSConfigOption{Name: optionNdots, Value: &ndots})
+	}
+	for _, o := range options {
+		setOption(config, o)
+	}
+}
+
+func setOption(config *corev1.PodDNSConfig, option corev1.PodDNSConfigOption) {
+	for i, o := range config.Options {
+		if o.Name == option.Name {
+			config.Options[i] = option
+			return
+		}
+	}
+	config.Options = append(config.Options, option)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle injects the DNS configuration in the Eirini app pods
+func (e *Extension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if pod == nil {
+		return admission.Errored(http.StatusBadRequest, errors.New("No pod could be decoded from the request"))
+	}
+
+	ext := e
+	if e.PerNamespace {
+		namespace := req.Namespace
+		if pod.Namespace != "" {
+			namespace = pod.Namespace
+		}
+		ns := &corev1.Namespace{}
+		if err := eiriniManager.GetKubeManager().GetClient().Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+			return admission.Errored(http.StatusInternalServerError, errors.Wrapf(err, "getting namespace %s", namespace))
+		}
+		var err error
+		if ext, err = e.ForNamespace(ns); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+
+	podCopy := pod.DeepCopy()
+	ext.Inject(podCopy)
+	return eiriniManager.PatchFromPod(req, podCopy)
+}
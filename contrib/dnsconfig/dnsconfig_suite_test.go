@@ -0,0 +1,13 @@
+package dnsconfig_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDNSConfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DNS Config Extension Suite")
+}
@@ -0,0 +1,59 @@
+package dnsconfig_test
+
+import (
+	. "code.cloudfoundry.org/eirinix/contrib/dnsconfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("DNS config extension", func() {
+	var (
+		pod *corev1.Pod
+		ext *Extension
+	)
+
+	BeforeEach(func() {
+		five := "5"
+		pod = &corev1.Pod{Spec: corev1.PodSpec{DNSConfig: &corev1.PodDNSConfig{
+			Searches: []string{"example.com"},
+			Options:  []corev1.PodDNSConfigOption{{Name: "ndots", Value: &five}, {Name: "timeout"}},
+		}}}
+		ext = NewExtension(1)
+		ext.Searches = []string{"example.com", "apps.internal"}
+	})
+
+	It("replaces ndots and merges the search domains", func() {
+		ext.Inject(pod)
+		Expect(pod.Spec.DNSConfig.Searches).To(Equal([]string{"example.com", "apps.internal"}))
+		Expect(pod.Spec.DNSConfig.Options).To(HaveLen(2))
+		Expect(pod.Spec.DNSConfig.Options[0].Name).To(Equal("ndots"))
+		Expect(*pod.Spec.DNSConfig.Options[0].Value).To(Equal("1"))
+		Expect(pod.Spec.DNSConfig.Options[1].Name).To(Equal("timeout"))
+	})
+
+	It("is idempotent", func() {
+		ext.Inject(pod)
+		injected := pod.DeepCopy()
+		ext.Inject(pod)
+		Expect(pod).To(Equal(injected))
+	})
+
+	It("applies the namespace overrides", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "space", Annotations: map[string]string{
+			AnnotationNdots:    "2",
+			AnnotationSearches: "space.internal, ",
+		}}}
+		nsExt, err := ext.ForNamespace(ns)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*nsExt.Ndots).To(Equal(2))
+		Expect(nsExt.Searches).To(Equal([]string{"example.com", "apps.internal", "space.internal"}))
+		Expect(*ext.Ndots).To(Equal(1))
+		Expect(ext.Searches).To(HaveLen(2))
+
+		ns.Annotations[AnnotationNdots] = "many"
+		_, err = ext.ForNamespace(ns)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,219 @@
+// Package egressproxy contains an Eirini extension which routes the egress traffic of the apps through an
+// HTTP proxy, setting the proxy environment variables on their containers and, for proxies intercepting TLS,
+// mounting the proxy CA bundle.
+//
+// The proxy settings are platform wide, and can be overridden per space with namespace annotations.
+package egressproxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"code.cloudfoundry.org/eirinix/contrib/truststore"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// AnnotationHTTPProxy can be set on a namespace (a CF space) to override the proxy of the HTTP requests,
+	// "none" disabling the proxy
+	AnnotationHTTPProxy = "eirinix.cloudfoundry.org/http-proxy"
+	// AnnotationHTTPSProxy can be set on a namespace to override the proxy of the HTTPS requests, "none"
+	// disabling the proxy
+	AnnotationHTTPSProxy = "eirinix.cloudfoundry.org/https-proxy"
+	// AnnotationNoProxy can be set on a namespace to add hosts reached without proxy, as a comma separated list
+	AnnotationNoProxy = "eirinix.cloudfoundry.org/no-proxy"
+	// AnnotationCAConfigMap can be set on a namespace to override the ConfigMap holding the proxy CA bundle
+	AnnotationCAConfigMap = "eirinix.cloudfoundry.org/proxy-ca-configmap"
+
+	// EnvHTTPProxy, EnvHTTPSProxy and EnvNoProxy are the proxy environment variables. They are also set in
+	// lower case, which some tools only honor.
+	EnvHTTPProxy  = "HTTP_PROXY"
+	EnvHTTPSProxy = "HTTPS_PROXY"
+	EnvNoProxy    = "NO_PROXY"
+
+	// annotationValueNone disables a proxy in a namespace annotation
+	annotationValueNone = "none"
+)
+
+// DefaultNoProxy are the hosts of the cluster, which are always reached without proxy
+var DefaultNoProxy = []string{"localhost", "127.0.0.1", ".svc", ".cluster.local"}
+
+// Extension sets the proxy environment variables on the containers of the app pods
+type Extension struct {
+	// HTTPProxy and HTTPSProxy are the proxy URLs, e.g. http://proxy.corp:3128. Optional, the variable is not
+	// set if empty
+	HTTPProxy  string
+	HTTPSProxy string
+
+	// NoProxy are the hosts, domains (e.g. .corp) and CIDRs reached without proxy, in addition to DefaultNoProxy
+	NoProxy []string
+
+	// CAConfigMap, if set, is the ConfigMap of the app namespace holding the CA bundle of a proxy intercepting
+	// TLS. It is mounted in the containers with SSL_CERT_FILE pointing to it, see truststore.Extension.
+	CAConfigMap string
+
+	// CAKey is the key of the CA bundle in the ConfigMap. Optional, defaults to ca.crt
+	CAKey string
+
+	// PerNamespace enables the overrides from the namespace annotations
+	PerNamespace bool
+}
+
+// NewExtension returns an Extension routing the HTTP and HTTPS requests of the apps through the proxy
+func NewExtension(proxy string) *Extension {
+	return &Extension{HTTPProxy: proxy, HTTPSProxy: proxy}
+}
+
+// RequiredPermissions returns the permissions needed to read the namespace annotations, if PerNamespace is set
+func (e *Extension) RequiredPermissions() []rbacv1.PolicyRule {
+	if !e.PerNamespace {
+		return nil
+	}
+	return []rbacv1.PolicyRule{{
+		APIGroups: []string{""},
+		Resources: []string{"namespaces"},
+		Verbs:     []string{"get", "list", "watch"},
+	}}
+}
+
+// Validate checks the proxy URLs
+func (e *Extension) Validate() error {
+	for _, proxy := range []string{e.HTTPProxy, e.HTTPSProxy} {
+		if proxy == "" {
+			continue
+		}
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.Errorf("Invalid proxy URL %q, must be http(s)://host[:port]", proxy)
+		}
+	}
+	return nil
+}
+
+// ForNamespace returns a copy of the extension with the overrides of the namespace annotations applied
+func (e *Extension) ForNamespace(ns *corev1.Namespace) (*Extension, error) {
+	c := *e
+	c.NoProxy = append([]string{}, e.NoProxy...)
+
+	for annotation, proxy := range map[string]*string{AnnotationHTTPProxy: &c.HTTPProxy, AnnotationHTTPSProxy: &c.HTTPSProxy} {
+		v, ok := ns.Annotations[annotation]
+		switch {
+		case !ok:
+		case v == annotationValueNone:
+			*proxy = ""
+		default:
+			*proxy = strings.TrimSpace(v)
+		}
+	}
+	for _, h := range strings.Split(ns.Annotations[AnnotationNoProxy], ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			c.NoProxy = append(c.NoProxy, h)
+		}
+	}
+	if v, ok := ns.Annotations[AnnotationCAConfigMap]; ok {
+		c.CAConfigMap = strings.TrimSpace(v)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "proxy annotations of namespace %s", ns.Name)
+	}
+	return &c, nil
+}
+
+// noProxy returns the NO_PROXY value, without duplicates
+func (e *Extension) noProxy() string {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, h := range append(append([]string{}, DefaultNoProxy...), e.NoProxy...) {
+		if !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+	return strings.Join(hosts, ",")
+}
+
+// Inject sets the proxy variables on the containers of the pod, and mounts the proxy CA bundle. It returns
+// false if no proxy is set. The variables already set by the apps are kept.
+func (e *Extension) Inject(pod *corev1.Pod) bool {
+	if e.HTTPProxy == "" && e.HTTPSProxy == "" {
+		return false
+	}
+
+	env := map[string]string{EnvNoProxy: e.noProxy()}
+	if e.HTTPProxy != "" {
+		env[EnvHTTPProxy] = e.HTTPProxy
+	}
+	if e.HTTPSProxy != "" {
+		env[EnvHTTPSProxy] = e.HTTPSProxy
+	}
+	for i := range pod.Spec.InitContainers {
+		injectContainer(&pod.Spec.InitContainers[i], env)
+	}
+	for i := range pod.Spec.Containers {
+		injectContainer(&pod.Spec.Containers[i], env)
+	}
+
+	if e.CAConfigMap != "" {
+		trust := truststore.NewExtension(e.CAConfigMap)
+		trust.Key = e.CAKey
+		trust.Inject(pod)
+	}
+	return true
+}
+
+func injectContainer(c *corev1.Container, env map[string]string) {
+	set := map[string]bool{}
+	for _, v := range c.Env {
+		set[v.Name] = true
+	}
+	for _, name := range []string{EnvHTTPProxy, EnvHTTPSProxy, EnvNoProxy} {
+		value, ok := env[name]
+		if !ok {
+			continue
+		}
+		// An app setting either case keeps its own value
+		if set[name] || set[strings.ToLower(name)] {
+			continue
+		}
+		c.Env = append(c.Env,
+			corev1.EnvVar{Name: name, Value: value},
+			corev1.EnvVar{Name: strings.ToLower(name), Value: value})
+	}
+}
+
+// Handle sets the proxy of the Eirini app pods
+func (e *Extension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if pod == nil {
+		return admission.Errored(http.StatusBadRequest, errors.New("No pod could be decoded from the request"))
+	}
+
+	ext := e
+	if e.PerNamespace {
+		namespace := req.Namespace
+		if pod.Namespace != "" {
+			namespace = pod.Namespace
+		}
+		ns := &corev1.Namespace{}
+		if err := eiriniManager.GetKubeManager().GetClient().Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+			return admission.Errored(http.StatusInternalServerError, errors.Wrapf(err, "getting namespace %s", namespace))
+		}
+		var err error
+		if ext, err = e.ForNamespace(ns); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+
+	podCopy := pod.DeepCopy()
+	if !ext.Inject(podCopy) {
+		return admission.Allowed("")
+	}
+	return eiriniManager.PatchFromPod(req, podCopy)
+}
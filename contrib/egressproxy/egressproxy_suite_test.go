@@ -0,0 +1,13 @@
+package egressproxy_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestEgressProxy(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Egress Proxy Extension Suite")
+}
@@ -0,0 +1,90 @@
+package egressproxy_test
+
+import (
+	. "code.cloudfoundry.org/eirinix/contrib/egressproxy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Egress proxy extension", func() {
+	var (
+		pod *corev1.Pod
+		ext *Extension
+	)
+
+	env := func(c corev1.Container) map[string]string {
+		values := map[string]string{}
+		for _, v := range c.Env {
+			values[v.Name] = v.Value
+		}
+		return values
+	}
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "opi"},
+			{Name: "sidecar", Env: []corev1.EnvVar{{Name: "https_proxy", Value: "http://own.proxy:8080"}}},
+		}}}
+		ext = NewExtension("http://proxy.corp:3128")
+		ext.NoProxy = []string{".corp", "localhost"}
+	})
+
+	It("sets the proxy variables, keeping the ones of the apps", func() {
+		Expect(ext.Inject(pod)).To(BeTrue())
+
+		app := env(pod.Spec.Containers[0])
+		Expect(app).To(HaveKeyWithValue("HTTP_PROXY", "http://proxy.corp:3128"))
+		Expect(app).To(HaveKeyWithValue("https_proxy", "http://proxy.corp:3128"))
+		Expect(app).To(HaveKeyWithValue("NO_PROXY", "localhost,127.0.0.1,.svc,.cluster.local,.corp"))
+
+		sidecar := env(pod.Spec.Containers[1])
+		Expect(sidecar).To(HaveKeyWithValue("https_proxy", "http://own.proxy:8080"))
+		Expect(sidecar).ToNot(HaveKey("HTTPS_PROXY"))
+		Expect(sidecar).To(HaveKey("HTTP_PROXY"))
+	})
+
+	It("is idempotent", func() {
+		ext.CAConfigMap = "proxy-ca"
+		ext.Inject(pod)
+		injected := pod.DeepCopy()
+		ext.Inject(pod)
+		Expect(pod).To(Equal(injected))
+	})
+
+	It("mounts the proxy CA bundle", func() {
+		ext.CAConfigMap = "proxy-ca"
+		ext.Inject(pod)
+		Expect(pod.Spec.Volumes).To(HaveLen(1))
+		Expect(pod.Spec.Volumes[0].ConfigMap.Name).To(Equal("proxy-ca"))
+		Expect(env(pod.Spec.Containers[0])).To(HaveKey("SSL_CERT_FILE"))
+	})
+
+	It("applies the namespace overrides", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "space", Annotations: map[string]string{
+			AnnotationHTTPProxy:   "none",
+			AnnotationHTTPSProxy:  "http://space.proxy:3128",
+			AnnotationNoProxy:     "db.space, ",
+			AnnotationCAConfigMap: "space-ca",
+		}}}
+		nsExt, err := ext.ForNamespace(ns)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nsExt.HTTPProxy).To(BeEmpty())
+		Expect(nsExt.HTTPSProxy).To(Equal("http://space.proxy:3128"))
+		Expect(nsExt.NoProxy).To(Equal([]string{".corp", "localhost", "db.space"}))
+		Expect(nsExt.CAConfigMap).To(Equal("space-ca"))
+		Expect(ext.HTTPProxy).To(Equal("http://proxy.corp:3128"))
+		Expect(ext.NoProxy).To(HaveLen(2))
+
+		ns.Annotations[AnnotationHTTPSProxy] = "proxy.corp:3128"
+		_, err = ext.ForNamespace(ns)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("leaves the pods unchanged without proxy", func() {
+		ext = &Extension{}
+		Expect(ext.Inject(pod)).To(BeFalse())
+		Expect(pod.Spec.Containers[0].Env).To(BeEmpty())
+	})
+})
@@ -0,0 +1,335 @@
+// Package mesh contains an Eirini extension onboarding the CF apps in a service mesh, Istio or Linkerd, by
+// setting the sidecar injection label or annotation of the mesh on their pods. The mesh is chosen per space.
+//
+// The staging pods of the spaces in a mesh are explicitly excluded from it, even when the injection is enabled
+// for the whole namespace: a proxy sidecar would keep them running once the staging completed, and the
+// buildpacks would be downloaded before the proxy is ready.
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ConfigKey is the key of the extension configuration in the ExtensionConfig of the ManagerOptions
+const ConfigKey = "mesh"
+
+// Mesh is a service mesh the apps are onboarded in
+type Mesh string
+
+const (
+	// Istio injects its proxy in the pods labeled with LabelIstioInject
+	Istio Mesh = "istio"
+	// Linkerd injects its proxy in the pods annotated with AnnotationLinkerdInject
+	Linkerd Mesh = "linkerd"
+)
+
+const (
+	// LabelIstioInject enables or disables the Istio sidecar injection of a pod, "true" or "false"
+	LabelIstioInject = "sidecar.istio.io/inject"
+	// AnnotationIstioExcludeInboundPorts are the ports the Istio proxy doesn't intercept the inbound traffic of
+	AnnotationIstioExcludeInboundPorts = "traffic.sidecar.istio.io/excludeInboundPorts"
+	// AnnotationIstioExcludeOutboundPorts are the ports the Istio proxy doesn't intercept the outbound traffic to
+	AnnotationIstioExcludeOutboundPorts = "traffic.sidecar.istio.io/excludeOutboundPorts"
+	// AnnotationIstioProxyConfig overrides the Istio proxy configuration of a pod
+	AnnotationIstioProxyConfig = "proxy.istio.io/config"
+
+	// AnnotationLinkerdInject enables or disables the Linkerd proxy injection of a pod, "enabled" or "disabled"
+	AnnotationLinkerdInject = "linkerd.io/inject"
+	// AnnotationLinkerdSkipInboundPorts are the ports the Linkerd proxy doesn't handle the inbound traffic of
+	AnnotationLinkerdSkipInboundPorts = "config.linkerd.io/skip-inbound-ports"
+	// AnnotationLinkerdSkipOutboundPorts are the ports the Linkerd proxy doesn't handle the outbound traffic to
+	AnnotationLinkerdSkipOutboundPorts = "config.linkerd.io/skip-outbound-ports"
+	// AnnotationLinkerdProxyAwait makes the app container wait for the Linkerd proxy to be ready
+	AnnotationLinkerdProxyAwait = "config.linkerd.io/proxy-await"
+)
+
+// conventions are how a mesh is told to onboard a pod
+type conventions struct {
+	// inject enables or disables the proxy injection of the pod
+	inject func(pod *corev1.Pod, enabled bool)
+	// skipInbound and skipOutbound are the annotations of the ports the proxy doesn't handle
+	skipInbound, skipOutbound string
+	// waitForProxy makes the app container start once the proxy is ready
+	waitForProxy func(pod *corev1.Pod)
+}
+
+var meshes = map[Mesh]conventions{
+	Istio: {
+		inject: func(pod *corev1.Pod, enabled bool) {
+			setLabel(pod, LabelIstioInject, strconv.FormatBool(enabled))
+		},
+		skipInbound:  AnnotationIstioExcludeInboundPorts,
+		skipOutbound: AnnotationIstioExcludeOutboundPorts,
+		waitForProxy: func(pod *corev1.Pod) {
+			setProxyConfig(pod, "holdApplicationUntilProxyStarts", true)
+		},
+	},
+	Linkerd: {
+		inject: func(pod *corev1.Pod, enabled bool) {
+			value := "disabled"
+			if enabled {
+				value = "enabled"
+			}
+			setAnnotation(pod, AnnotationLinkerdInject, value)
+		},
+		skipInbound:  AnnotationLinkerdSkipInboundPorts,
+		skipOutbound: AnnotationLinkerdSkipOutboundPorts,
+		waitForProxy: func(pod *corev1.Pod) {
+			setAnnotation(pod, AnnotationLinkerdProxyAwait, "enabled")
+		},
+	},
+}
+
+// Policy is how the apps of a space are onboarded in the mesh
+type Policy struct {
+	// Mesh is the mesh of the space. Empty leaves the pods of the space unchanged
+	Mesh Mesh `json:"mesh,omitempty"`
+
+	// Disabled explicitly excludes the app pods of the space from the mesh, e.g. when the injection is enabled
+	// for the whole namespace
+	Disabled bool `json:"disabled,omitempty"`
+
+	// SkipInboundPorts and SkipOutboundPorts are the ports the proxy doesn't handle the traffic of, added to
+	// the ones already set on the pod, e.g. the ports of the databases using their own TLS
+	SkipInboundPorts  []int32 `json:"skipInboundPorts,omitempty"`
+	SkipOutboundPorts []int32 `json:"skipOutboundPorts,omitempty"`
+
+	// WaitForProxy starts the app container once the proxy is ready, so that the app can connect to its
+	// services right away
+	WaitForProxy bool `json:"waitForProxy,omitempty"`
+}
+
+func (p Policy) validate() error {
+	if _, ok := meshes[p.Mesh]; !ok && p.Mesh != "" {
+		return errors.Errorf("unsupported mesh %q, must be %s or %s", p.Mesh, Istio, Linkerd)
+	}
+	for _, port := range append(append([]int32{}, p.SkipInboundPorts...), p.SkipOutboundPorts...) {
+		if port <= 0 || port > 65535 {
+			return errors.Errorf("port %d must be between 1 and 65535", port)
+		}
+	}
+	return nil
+}
+
+// Extension onboards the Eirini apps in the mesh of their space
+type Extension struct {
+	mu sync.RWMutex
+
+	// Default is the policy of the spaces without their own
+	Default Policy
+	// Spaces are the policies of the spaces, by space GUID or space name
+	Spaces map[string]Policy
+}
+
+// NewExtension returns an Extension onboarding the apps of every space in the mesh
+func NewExtension(mesh Mesh) *Extension {
+	return &Extension{Default: Policy{Mesh: mesh}}
+}
+
+// SetSpacePolicy sets the policy of a space, by GUID or name
+func (e *Extension) SetSpacePolicy(space string, p Policy) error {
+	if err := p.validate(); err != nil {
+		return errors.Wrapf(err, "policy of space %s", space)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Spaces == nil {
+		e.Spaces = map[string]Policy{}
+	}
+	e.Spaces[space] = p
+	return nil
+}
+
+// PolicyFor returns the policy of the space, looked up by GUID and then by name
+func (e *Extension) PolicyFor(spaceGUID, spaceName string) Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, key := range []string{spaceGUID, spaceName} {
+		if p, ok := e.Spaces[key]; ok && key != "" {
+			return p
+		}
+	}
+	return e.Default
+}
+
+// Inject onboards the app pod in the mesh of its space, or excludes it from the mesh if it is a staging pod or
+// the policy of its space is disabled. It returns false if the pod is not an Eirini pod or its space has no mesh.
+func (e *Extension) Inject(pod *corev1.Pod, layout eirinix.EiriniLayout) bool {
+	staging := layout.IsStaging(pod)
+	if !staging && !layout.IsApp(pod) {
+		return false
+	}
+	p := e.PolicyFor(layout.SpaceGUID(pod), layout.SpaceName(pod))
+	c, ok := meshes[p.Mesh]
+	if !ok {
+		return false
+	}
+
+	if staging || p.Disabled {
+		c.inject(pod, false)
+		return true
+	}
+	c.inject(pod, true)
+	addPorts(pod, c.skipInbound, p.SkipInboundPorts)
+	addPorts(pod, c.skipOutbound, p.SkipOutboundPorts)
+	if p.WaitForProxy {
+		c.waitForProxy(pod)
+	}
+	return true
+}
+
+// Handle onboards the Eirini pods in the mesh, and admits the other pods unchanged
+func (e *Extension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if pod == nil {
+		return admission.Errored(http.StatusBadRequest, errors.New("No pod could be decoded from the request"))
+	}
+
+	podCopy := pod.DeepCopy()
+	if !e.Inject(podCopy, eiriniManager.EiriniLayout()) {
+		return admission.Allowed("")
+	}
+	return eiriniManager.PatchFromPod(req, podCopy)
+}
+
+func setLabel(pod *corev1.Pod, key, value string) {
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[key] = value
+}
+
+func setAnnotation(pod *corev1.Pod, key, value string) {
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[key] = value
+}
+
+// addPorts adds the ports to the comma separated list of the annotation, keeping the ones already set
+func addPorts(pod *corev1.Pod, annotation string, ports []int32) {
+	if len(ports) == 0 {
+		return
+	}
+	var list []string
+	for _, p := range strings.Split(pod.Annotations[annotation], ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	for _, port := range ports {
+		p := strconv.Itoa(int(port))
+		if !contains(list, p) {
+			list = append(list, p)
+		}
+	}
+	setAnnotation(pod, annotation, strings.Join(list, ","))
+}
+
+// setProxyConfig sets a field of the Istio proxy configuration of the pod, keeping the other ones. A
+// configuration which isn't JSON, e.g. YAML set by the app, is left unchanged.
+func setProxyConfig(pod *corev1.Pod, field string, value interface{}) {
+	config := map[string]interface{}{}
+	if current := pod.Annotations[AnnotationIstioProxyConfig]; current != "" {
+		if err := json.Unmarshal([]byte(current), &config); err != nil {
+			return
+		}
+	}
+	config[field] = value
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	setAnnotation(pod, AnnotationIstioProxyConfig, string(data))
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// config is the JSON configuration of the extension. The fields missing from the policies of the spaces
+// are the ones of the default policy.
+type config struct {
+	Default json.RawMessage            `json:"default,omitempty"`
+	Spaces  map[string]json.RawMessage `json:"spaces,omitempty"`
+}
+
+func decodePolicy(data json.RawMessage, base Policy) (Policy, error) {
+	p := base
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &p); err != nil {
+			return p, err
+		}
+	}
+	return p, p.validate()
+}
+
+// ConfigKey is the key of the extension configuration
+func (e *Extension) ConfigKey() string {
+	return ConfigKey
+}
+
+// ConfigSchema returns the schema of the extension configuration
+func (e *Extension) ConfigSchema() *eirinix.ConfigSchema {
+	minPort, maxPort := float64(1), float64(65535)
+	ports := &eirinix.ConfigSchema{Type: "array", Items: &eirinix.ConfigSchema{Type: "integer", Minimum: &minPort, Maximum: &maxPort}}
+	policy := &eirinix.ConfigSchema{
+		Type: "object",
+		Properties: map[string]*eirinix.ConfigSchema{
+			"mesh":              {Type: "string", Enum: []interface{}{"", string(Istio), string(Linkerd)}},
+			"disabled":          {Type: "boolean"},
+			"skipInboundPorts":  ports,
+			"skipOutboundPorts": ports,
+			"waitForProxy":      {Type: "boolean"},
+		},
+	}
+	return &eirinix.ConfigSchema{
+		Type: "object",
+		Properties: map[string]*eirinix.ConfigSchema{
+			"default": policy,
+			"spaces": {
+				Type:        "object",
+				Description: "Policies by space GUID or name, with the same fields as the default one",
+			},
+		},
+	}
+}
+
+// Configure replaces the policies with the ones of the configuration
+func (e *Extension) Configure(data []byte) error {
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return errors.Wrap(err, "decoding the mesh configuration")
+	}
+
+	def, err := decodePolicy(c.Default, Policy{})
+	if err != nil {
+		return errors.Wrap(err, "default policy")
+	}
+	spaces := map[string]Policy{}
+	for space, data := range c.Spaces {
+		if spaces[space], err = decodePolicy(data, def); err != nil {
+			return errors.Wrapf(err, "policy of space %s", space)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Default = def
+	e.Spaces = spaces
+	return nil
+}
@@ -0,0 +1,123 @@
+package mesh_test
+
+import (
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/contrib/mesh"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Mesh extension", func() {
+	var (
+		layout eirinix.EiriniLayout
+		pod    *corev1.Pod
+	)
+
+	eiriniPod := func(sourceType string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:   "dora-space-0",
+			Labels: map[string]string{layout.LabelAppGUID: "guid", layout.LabelSourceType: sourceType},
+			Annotations: map[string]string{
+				layout.AnnotationSpaceGUID: "space-guid",
+				layout.AnnotationSpaceName: "space",
+			},
+		}}
+	}
+
+	BeforeEach(func() {
+		var err error
+		layout, err = eirinix.EiriniLayoutFor(eirinix.EiriniCompatibilityLegacy)
+		Expect(err).ToNot(HaveOccurred())
+		pod = eiriniPod(layout.SourceTypeApp)
+	})
+
+	Context("with Istio", func() {
+		var ext *Extension
+
+		BeforeEach(func() {
+			ext = NewExtension(Istio)
+		})
+
+		It("labels the app pods for the sidecar injection", func() {
+			Expect(ext.Inject(pod, layout)).To(BeTrue())
+			Expect(pod.Labels).To(HaveKeyWithValue(LabelIstioInject, "true"))
+		})
+
+		It("excludes the staging pods", func() {
+			staging := eiriniPod(layout.SourceTypeStaging)
+			Expect(ext.Inject(staging, layout)).To(BeTrue())
+			Expect(staging.Labels).To(HaveKeyWithValue(LabelIstioInject, "false"))
+		})
+
+		It("excludes the ports and holds the app until the proxy starts", func() {
+			pod.Annotations[AnnotationIstioExcludeOutboundPorts] = "5432"
+			pod.Annotations[AnnotationIstioProxyConfig] = `{"concurrency":2}`
+			Expect(ext.SetSpacePolicy("space", Policy{Mesh: Istio, SkipOutboundPorts: []int32{5432, 3306}, WaitForProxy: true})).To(Succeed())
+
+			Expect(ext.Inject(pod, layout)).To(BeTrue())
+			Expect(pod.Annotations).To(HaveKeyWithValue(AnnotationIstioExcludeOutboundPorts, "5432,3306"))
+			Expect(pod.Annotations).ToNot(HaveKey(AnnotationIstioExcludeInboundPorts))
+			Expect(pod.Annotations[AnnotationIstioProxyConfig]).To(MatchJSON(`{"concurrency":2,"holdApplicationUntilProxyStarts":true}`))
+		})
+
+		It("is idempotent", func() {
+			Expect(ext.SetSpacePolicy("space-guid", Policy{Mesh: Istio, SkipInboundPorts: []int32{9090}, WaitForProxy: true})).To(Succeed())
+			Expect(ext.Inject(pod, layout)).To(BeTrue())
+			injected := pod.DeepCopy()
+			Expect(ext.Inject(pod, layout)).To(BeTrue())
+			Expect(pod).To(Equal(injected))
+		})
+	})
+
+	Context("with Linkerd", func() {
+		var ext *Extension
+
+		BeforeEach(func() {
+			ext = NewExtension(Linkerd)
+		})
+
+		It("annotates the app pods for the proxy injection", func() {
+			Expect(ext.SetSpacePolicy("space", Policy{Mesh: Linkerd, SkipInboundPorts: []int32{8081}, WaitForProxy: true})).To(Succeed())
+			Expect(ext.Inject(pod, layout)).To(BeTrue())
+			Expect(pod.Annotations).To(HaveKeyWithValue(AnnotationLinkerdInject, "enabled"))
+			Expect(pod.Annotations).To(HaveKeyWithValue(AnnotationLinkerdSkipInboundPorts, "8081"))
+			Expect(pod.Annotations).To(HaveKeyWithValue(AnnotationLinkerdProxyAwait, "enabled"))
+			Expect(pod.Labels).ToNot(HaveKey(LabelIstioInject))
+		})
+
+		It("excludes the staging pods", func() {
+			staging := eiriniPod(layout.SourceTypeStaging)
+			Expect(ext.Inject(staging, layout)).To(BeTrue())
+			Expect(staging.Annotations).To(HaveKeyWithValue(AnnotationLinkerdInject, "disabled"))
+		})
+	})
+
+	Context("per space", func() {
+		It("excludes the apps of the disabled spaces and leaves the spaces without mesh unchanged", func() {
+			ext := NewExtension("")
+			Expect(ext.Inject(pod, layout)).To(BeFalse())
+
+			Expect(ext.SetSpacePolicy("space-guid", Policy{Mesh: Linkerd, Disabled: true})).To(Succeed())
+			Expect(ext.Inject(pod, layout)).To(BeTrue())
+			Expect(pod.Annotations).To(HaveKeyWithValue(AnnotationLinkerdInject, "disabled"))
+		})
+
+		It("leaves the pods which aren't Eirini pods unchanged", func() {
+			other := &corev1.Pod{}
+			Expect(NewExtension(Istio).Inject(other, layout)).To(BeFalse())
+			Expect(other.Labels).To(BeEmpty())
+		})
+
+		It("reads the policies from the configuration", func() {
+			ext := NewExtension("")
+			Expect(ext.Configure([]byte(`{"default":{"mesh":"istio","skipOutboundPorts":[5432]},"spaces":{"space":{"disabled":true}}}`))).To(Succeed())
+			Expect(ext.PolicyFor("other-guid", "other")).To(Equal(Policy{Mesh: Istio, SkipOutboundPorts: []int32{5432}}))
+			Expect(ext.PolicyFor("space-guid", "space")).To(Equal(Policy{Mesh: Istio, Disabled: true, SkipOutboundPorts: []int32{5432}}))
+
+			Expect(ext.Configure([]byte(`{"default":{"mesh":"consul"}}`))).To(MatchError(ContainSubstring(`unsupported mesh "consul"`)))
+			Expect(ext.Configure([]byte(`{"spaces":{"space":{"mesh":"istio","skipInboundPorts":[0]}}}`))).To(MatchError(ContainSubstring("policy of space space")))
+		})
+	})
+})
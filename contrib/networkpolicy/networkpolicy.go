@@ -0,0 +1,159 @@
+// Package networkpolicy contains an Eirini extension which creates NetworkPolicies for
+// Eirini apps, restricting the container to container traffic like Cloud Foundry does.
+package networkpolicy
+
+import (
+	"context"
+	"fmt"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Scope defines which pods a generated NetworkPolicy isolates
+type Scope string
+
+const (
+	// ScopeApp generates a NetworkPolicy for each app: instances of the same app can reach each other
+	ScopeApp Scope = "app"
+	// ScopeSpace generates a NetworkPolicy for each namespace: all the apps of the space can reach each other
+	ScopeSpace Scope = "space"
+
+	// LabelManagedBy is set on the generated NetworkPolicies
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+)
+
+// Extension creates or updates a NetworkPolicy for each admitted Eirini app pod.
+// The policies are applied asynchronously, through the Manager side effects queue.
+type Extension struct {
+	// Scope is the isolation scope of the policies. Optional, defaults to ScopeApp
+	Scope Scope
+
+	// AllowedIngress are the peers which can always reach the app pods (e.g. the router namespace)
+	AllowedIngress []networkingv1.NetworkPolicyPeer
+
+	// Name is set as managed-by label on the generated policies. Optional, defaults to eirinix-networkpolicy
+	Name string
+}
+
+// NewExtension returns an Extension creating NetworkPolicies with the given scope
+func NewExtension(scope Scope, allowedIngress ...networkingv1.NetworkPolicyPeer) *Extension {
+	return &Extension{Scope: scope, AllowedIngress: allowedIngress}
+}
+
+func (e *Extension) managedBy() string {
+	if e.Name == "" {
+		return "eirinix-networkpolicy"
+	}
+	return e.Name
+}
+
+// Policy returns the NetworkPolicy for the given app pod, or nil if the pod isn't an Eirini app
+func (e *Extension) Policy(namespace string, pod *corev1.Pod, layout eirinix.EiriniLayout) *networkingv1.NetworkPolicy {
+	if !layout.IsApp(pod) {
+		return nil
+	}
+
+	var policy *networkingv1.NetworkPolicy
+	switch e.Scope {
+	case ScopeSpace:
+		policy = NewSpacePolicy(namespace, e.AllowedIngress, layout)
+	default:
+		guid := layout.AppGUID(pod)
+		if guid == "" {
+			return nil
+		}
+		policy = NewAppPolicy(namespace, guid, e.AllowedIngress, layout)
+	}
+	policy.Labels = map[string]string{LabelManagedBy: e.managedBy()}
+	return policy
+}
+
+// RequiredPermissions returns the permissions needed to manage the NetworkPolicies
+func (e *Extension) RequiredPermissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{{
+		APIGroups: []string{networkingv1.GroupName},
+		Resources: []string{"networkpolicies"},
+		Verbs:     []string{"get", "create", "update"},
+	}}
+}
+
+// Handle enqueues the creation of the NetworkPolicy of the app and admits the pod untouched. Nothing is
+// enqueued for the dry-run requests, which must not have side effects.
+func (e *Extension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if req.DryRun != nil && *req.DryRun {
+		return admission.Allowed("")
+	}
+
+	namespace := req.Namespace
+	if pod != nil && pod.Namespace != "" {
+		namespace = pod.Namespace
+	}
+
+	policy := e.Policy(namespace, pod, eiriniManager.EiriniLayout())
+	if policy == nil {
+		return admission.Allowed("")
+	}
+
+	eiriniManager.EnqueueSideEffect(fmt.Sprintf("networkpolicy/%s/%s", policy.Namespace, policy.Name), func(ctx context.Context) error {
+		return ApplyPolicy(ctx, eiriniManager.GetKubeManager().GetClient(), policy)
+	})
+	return admission.Allowed("")
+}
+
+// NewAppPolicy returns a policy isolating the instances of an app: only the other instances
+// of the same app and the allowed peers can reach them.
+func NewAppPolicy(namespace, appGUID string, allowed []networkingv1.NetworkPolicyPeer, layout eirinix.EiriniLayout) *networkingv1.NetworkPolicy {
+	selector := metav1.LabelSelector{MatchLabels: layout.AppSelector()}
+	selector.MatchLabels[layout.LabelAppGUID] = appGUID
+	return newPolicy(namespace, fmt.Sprintf("eirini-app-%s", appGUID), selector, allowed)
+}
+
+// NewSpacePolicy returns a policy isolating the apps of a namespace: only the apps in the
+// same namespace and the allowed peers can reach them.
+func NewSpacePolicy(namespace string, allowed []networkingv1.NetworkPolicyPeer, layout eirinix.EiriniLayout) *networkingv1.NetworkPolicy {
+	selector := metav1.LabelSelector{MatchLabels: layout.AppSelector()}
+	return newPolicy(namespace, "eirini-space", selector, allowed)
+}
+
+func newPolicy(namespace, name string, selector metav1.LabelSelector, allowed []networkingv1.NetworkPolicyPeer) *networkingv1.NetworkPolicy {
+	peers := append([]networkingv1.NetworkPolicyPeer{{PodSelector: selector.DeepCopy()}}, allowed...)
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: selector,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: peers}},
+		},
+	}
+}
+
+// ApplyPolicy creates the policy, or updates the spec and labels of an existing one
+func ApplyPolicy(ctx context.Context, c client.Client, policy *networkingv1.NetworkPolicy) error {
+	existing := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      policy.Name,
+			Namespace: policy.Namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, c, existing, func() error {
+		if existing.Labels == nil {
+			existing.Labels = map[string]string{}
+		}
+		for k, v := range policy.Labels {
+			existing.Labels[k] = v
+		}
+		existing.Spec = policy.Spec
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,108 @@
+package networkpolicy_test
+
+import (
+	"context"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/contrib/networkpolicy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// sideEffectsManager records the keys of the enqueued side effects
+type sideEffectsManager struct {
+	eirinix.Manager
+	layout eirinix.EiriniLayout
+	keys   []string
+}
+
+func (m *sideEffectsManager) EiriniLayout() eirinix.EiriniLayout {
+	return m.layout
+}
+
+func (m *sideEffectsManager) EnqueueSideEffect(key string, _ eirinix.SideEffect) {
+	m.keys = append(m.keys, key)
+}
+
+var _ = Describe("NetworkPolicy extension", func() {
+	var (
+		pod    *corev1.Pod
+		router networkingv1.NetworkPolicyPeer
+		layout eirinix.EiriniLayout
+	)
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "app-0",
+			Labels: map[string]string{
+				eirinix.LabelSourceType: "APP",
+				eirinix.LabelAppGUID:    "guid",
+			},
+		}}
+		router = networkingv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"name": "router"},
+		}}
+		var err error
+		layout, err = eirinix.EiriniLayoutFor(eirinix.EiriniCompatibilityLegacy)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("generates a policy per app", func() {
+		policy := NewExtension(ScopeApp, router).Policy("eirini", pod, layout)
+		Expect(policy).ToNot(BeNil())
+		Expect(policy.Name).To(Equal("eirini-app-guid"))
+		Expect(policy.Namespace).To(Equal("eirini"))
+		Expect(policy.Labels[LabelManagedBy]).To(Equal("eirinix-networkpolicy"))
+		Expect(policy.Spec.PodSelector.MatchLabels).To(HaveKeyWithValue(eirinix.LabelAppGUID, "guid"))
+		Expect(policy.Spec.Ingress).To(HaveLen(1))
+		Expect(policy.Spec.Ingress[0].From).To(HaveLen(2))
+		Expect(policy.Spec.Ingress[0].From[0].PodSelector.MatchLabels).To(HaveKeyWithValue(eirinix.LabelAppGUID, "guid"))
+		Expect(policy.Spec.Ingress[0].From[1]).To(Equal(router))
+	})
+
+	It("generates a policy per space", func() {
+		policy := NewExtension(ScopeSpace).Policy("eirini", pod, layout)
+		Expect(policy).ToNot(BeNil())
+		Expect(policy.Name).To(Equal("eirini-space"))
+		Expect(policy.Spec.PodSelector.MatchLabels).ToNot(HaveKey(eirinix.LabelAppGUID))
+		Expect(policy.Spec.Ingress[0].From).To(HaveLen(1))
+	})
+
+	It("ignores pods which are not Eirini apps", func() {
+		delete(pod.Labels, eirinix.LabelSourceType)
+		Expect(NewExtension(ScopeApp).Policy("eirini", pod, layout)).To(BeNil())
+		Expect(NewExtension(ScopeApp).Policy("eirini", nil, layout)).To(BeNil())
+	})
+
+	It("selects the pods with the labels of the Eirini release", func() {
+		layout, err := eirinix.EiriniLayoutFor(eirinix.EiriniCompatibilityController)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(NewExtension(ScopeApp).Policy("eirini", pod, layout)).To(BeNil())
+
+		pod.Labels = map[string]string{layout.LabelSourceType: layout.SourceTypeApp, layout.LabelAppGUID: "guid"}
+		policy := NewExtension(ScopeApp).Policy("eirini", pod, layout)
+		Expect(policy).ToNot(BeNil())
+		Expect(policy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{
+			layout.LabelSourceType: layout.SourceTypeApp,
+			layout.LabelAppGUID:    "guid",
+		}))
+	})
+
+	It("enqueues no side effect for the dry-run requests", func() {
+		m := &sideEffectsManager{layout: layout}
+		dryRun := true
+		req := admission.Request{}
+		req.Namespace = "eirini"
+		req.DryRun = &dryRun
+		Expect(NewExtension(ScopeApp).Handle(context.Background(), m, pod, req).Allowed).To(BeTrue())
+		Expect(m.keys).To(BeEmpty())
+
+		dryRun = false
+		Expect(NewExtension(ScopeApp).Handle(context.Background(), m, pod, req).Allowed).To(BeTrue())
+		Expect(m.keys).To(Equal([]string{"networkpolicy/eirini/eirini-app-guid"}))
+	})
+})
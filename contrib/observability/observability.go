@@ -0,0 +1,202 @@
+// Package observability contains an Eirini extension which stamps the OpenTelemetry resource attributes
+// of the CF apps on their pods, so that the traces, metrics and logs of an app are correlated by the APM
+// tools without any change to the app.
+//
+// The attributes are set as the OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES environment variables of
+// the containers, read by the OpenTelemetry SDKs, and the service name and the environment as pod labels.
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// EnvServiceName is the environment variable with the service name read by the OpenTelemetry SDKs
+	EnvServiceName = "OTEL_SERVICE_NAME"
+	// EnvResourceAttributes is the environment variable with the resource attributes read by the
+	// OpenTelemetry SDKs, as a comma separated list of key=value
+	EnvResourceAttributes = "OTEL_RESOURCE_ATTRIBUTES"
+
+	// AttributeServiceName is set to the app name
+	AttributeServiceName = "service.name"
+	// AttributeDeploymentEnvironment is set to the space name
+	AttributeDeploymentEnvironment = "deployment.environment"
+	// AttributeAppID is set to the app GUID
+	AttributeAppID = "cloudfoundry.app.id"
+	// AttributeSpaceID is set to the space GUID
+	AttributeSpaceID = "cloudfoundry.space.id"
+	// AttributeOrgName is set to the org name
+	AttributeOrgName = "cloudfoundry.org.name"
+	// AttributeProcessType is set to the process type of the instance, e.g. web
+	AttributeProcessType = "cloudfoundry.process.type"
+
+	// LabelServiceName is the default label set to the app name
+	LabelServiceName = "app.kubernetes.io/name"
+	// LabelEnvironment is the default label set to the space name
+	LabelEnvironment = "eirinix.cloudfoundry.org/environment"
+
+	maxLabelValueLength = 63
+)
+
+// Extension sets the OpenTelemetry resource attributes of the app pods. The values already set by the apps
+// are kept.
+type Extension struct {
+	// Attributes are additional resource attributes set on every app, e.g. the name of the cluster
+	Attributes map[string]string
+
+	// ServiceNameLabel is the label set to the app name. Optional, no label is set if empty
+	ServiceNameLabel string
+	// EnvironmentLabel is the label set to the space name. Optional, no label is set if empty
+	EnvironmentLabel string
+}
+
+// NewExtension returns an Extension setting the resource attributes and the default labels
+func NewExtension() *Extension {
+	return &Extension{ServiceNameLabel: LabelServiceName, EnvironmentLabel: LabelEnvironment}
+}
+
+// ResourceAttributes returns the resource attributes of the app running in the pod, without the empty ones
+func (e *Extension) ResourceAttributes(pod *corev1.Pod, layout eirinix.EiriniLayout) map[string]string {
+	attributes := map[string]string{}
+	for k, v := range e.Attributes {
+		attributes[k] = v
+	}
+	for k, v := range map[string]string{
+		AttributeServiceName:           layout.AppName(pod),
+		AttributeDeploymentEnvironment: layout.SpaceName(pod),
+		AttributeAppID:                 layout.AppGUID(pod),
+		AttributeSpaceID:               layout.SpaceGUID(pod),
+		AttributeOrgName:               pod.GetAnnotations()[layout.AnnotationOrgName],
+		AttributeProcessType:           layout.ProcessType(pod),
+	} {
+		if v != "" {
+			attributes[k] = v
+		}
+	}
+	return attributes
+}
+
+// Inject sets the resource attributes on the containers and the labels of the pod, and returns false if the
+// pod is not an app instance
+func (e *Extension) Inject(pod *corev1.Pod, layout eirinix.EiriniLayout) bool {
+	attributes := e.ResourceAttributes(pod, layout)
+	serviceName := attributes[AttributeServiceName]
+	if serviceName == "" {
+		return false
+	}
+
+	for i := range pod.Spec.Containers {
+		injectEnv(&pod.Spec.Containers[i], serviceName, attributes)
+	}
+
+	for label, value := range map[string]string{
+		e.ServiceNameLabel: serviceName,
+		e.EnvironmentLabel: attributes[AttributeDeploymentEnvironment],
+	} {
+		if value = labelValue(value); label == "" || value == "" {
+			continue
+		}
+		if pod.Labels == nil {
+			pod.Labels = map[string]string{}
+		}
+		if _, ok := pod.Labels[label]; !ok {
+			pod.Labels[label] = value
+		}
+	}
+	return true
+}
+
+// injectEnv sets the service name and merges the resource attributes into the ones of the container, which
+// take precedence
+func injectEnv(container *corev1.Container, serviceName string, attributes map[string]string) {
+	if envIndex(container, EnvServiceName) < 0 {
+		container.Env = append(container.Env, corev1.EnvVar{Name: EnvServiceName, Value: serviceName})
+	}
+
+	i := envIndex(container, EnvResourceAttributes)
+	if i < 0 {
+		container.Env = append(container.Env, corev1.EnvVar{Name: EnvResourceAttributes, Value: encodeAttributes(attributes)})
+		return
+	}
+	if container.Env[i].ValueFrom != nil {
+		return
+	}
+
+	merged := map[string]string{}
+	for k, v := range attributes {
+		merged[k] = v
+	}
+	for _, pair := range strings.Split(container.Env[i].Value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			continue
+		}
+		if v, err := url.PathUnescape(strings.TrimSpace(kv[1])); err == nil {
+			merged[strings.TrimSpace(kv[0])] = v
+		}
+	}
+	container.Env[i].Value = encodeAttributes(merged)
+}
+
+func envIndex(container *corev1.Container, name string) int {
+	for i, env := range container.Env {
+		if env.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// encodeAttributes returns the attributes as the value of OTEL_RESOURCE_ATTRIBUTES, sorted by key
+// to keep the pod spec stable
+func encodeAttributes(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+url.PathEscape(attributes[k]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// labelValue turns a CF name into a valid label value, replacing the characters not allowed in labels
+func labelValue(name string) string {
+	value := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, name)
+	if len(value) > maxLabelValueLength {
+		value = value[:maxLabelValueLength]
+	}
+	return strings.Trim(value, "-_.")
+}
+
+// Handle stamps the resource attributes on the Eirini app pods, and admits the other pods unchanged
+func (e *Extension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if pod == nil {
+		return admission.Errored(http.StatusBadRequest, errors.New("No pod could be decoded from the request"))
+	}
+
+	podCopy := pod.DeepCopy()
+	if !e.Inject(podCopy, eiriniManager.EiriniLayout()) {
+		return admission.Allowed("")
+	}
+	return eiriniManager.PatchFromPod(req, podCopy)
+}
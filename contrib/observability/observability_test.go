@@ -0,0 +1,89 @@
+package observability_test
+
+import (
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/contrib/observability"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Observability extension", func() {
+	var (
+		layout eirinix.EiriniLayout
+		pod    *corev1.Pod
+		ext    *Extension
+	)
+
+	BeforeEach(func() {
+		var err error
+		layout, err = eirinix.EiriniLayoutFor(eirinix.EiriniCompatibilityController)
+		Expect(err).ToNot(HaveOccurred())
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "dora-space-0",
+				Labels: map[string]string{layout.LabelAppGUID: "app-guid", layout.LabelProcessType: "web"},
+				Annotations: map[string]string{
+					layout.AnnotationAppName:   "dora",
+					layout.AnnotationSpaceName: "my space",
+					layout.AnnotationSpaceGUID: "space-guid",
+					layout.AnnotationOrgName:   "org",
+				},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "opi"}}},
+		}
+		ext = NewExtension()
+	})
+
+	It("sets the resource attributes of the app", func() {
+		Expect(ext.Inject(pod, layout)).To(BeTrue())
+
+		Expect(pod.Spec.Containers[0].Env).To(ConsistOf(
+			corev1.EnvVar{Name: EnvServiceName, Value: "dora"},
+			corev1.EnvVar{
+				Name:  EnvResourceAttributes,
+				Value: "cloudfoundry.app.id=app-guid,cloudfoundry.org.name=org,cloudfoundry.process.type=web,cloudfoundry.space.id=space-guid,deployment.environment=my%20space,service.name=dora",
+			},
+		))
+		Expect(pod.Labels).To(HaveKeyWithValue(LabelServiceName, "dora"))
+		Expect(pod.Labels).To(HaveKeyWithValue(LabelEnvironment, "my-space"))
+	})
+
+	It("keeps the values set by the app", func() {
+		pod.Spec.Containers[0].Env = []corev1.EnvVar{
+			{Name: EnvServiceName, Value: "checkout"},
+			{Name: EnvResourceAttributes, Value: "service.name=checkout, team=payments"},
+		}
+		pod.Labels[LabelServiceName] = "checkout"
+		ext.Attributes = map[string]string{"k8s.cluster.name": "eu-1"}
+
+		Expect(ext.Inject(pod, layout)).To(BeTrue())
+
+		env := pod.Spec.Containers[0].Env
+		Expect(env).To(HaveLen(2))
+		Expect(env[0]).To(Equal(corev1.EnvVar{Name: EnvServiceName, Value: "checkout"}))
+		Expect(env[1].Value).To(ContainSubstring("service.name=checkout,team=payments"))
+		Expect(env[1].Value).To(ContainSubstring("k8s.cluster.name=eu-1"))
+		Expect(pod.Labels).To(HaveKeyWithValue(LabelServiceName, "checkout"))
+	})
+
+	It("is idempotent", func() {
+		Expect(ext.Inject(pod, layout)).To(BeTrue())
+		injected := pod.DeepCopy()
+		Expect(ext.Inject(pod, layout)).To(BeTrue())
+		Expect(pod).To(Equal(injected))
+	})
+
+	It("doesn't set the disabled labels", func() {
+		ext.EnvironmentLabel = ""
+		Expect(ext.Inject(pod, layout)).To(BeTrue())
+		Expect(pod.Labels).ToNot(HaveKey(LabelEnvironment))
+	})
+
+	It("leaves the pods without an app name unchanged", func() {
+		delete(pod.Annotations, layout.AnnotationAppName)
+		Expect(ext.Inject(pod, layout)).To(BeFalse())
+		Expect(pod.Spec.Containers[0].Env).To(BeEmpty())
+	})
+})
@@ -0,0 +1,221 @@
+// Package ownership tracks the Secrets and ConfigMaps that extensions create for Eirini apps,
+// and garbage collects them once the app they belong to is gone.
+package ownership
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// LabelOwnerAppGUID is set on the resources owned by an Eirini app
+	LabelOwnerAppGUID = "eirinix.cloudfoundry.org/owner-app-guid"
+
+	defaultGracePeriod = 10 * time.Minute
+)
+
+// SetAppOwner marks the object (typically a Secret or a ConfigMap) as owned by the Eirini app with the given guid
+func SetAppOwner(obj metav1.Object, appGUID string) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[LabelOwnerAppGUID] = appGUID
+	obj.SetLabels(labels)
+}
+
+// AppOwner returns the guid of the Eirini app owning the object, if any
+func AppOwner(obj metav1.Object) (string, bool) {
+	guid, ok := obj.GetLabels()[LabelOwnerAppGUID]
+	return guid, ok && guid != ""
+}
+
+// StatefulSetOwner returns the reference to the StatefulSet owning the pod. The app pods are created with it
+// by the StatefulSet controller, so it is set on the pods being admitted.
+func StatefulSetOwner(pod *corev1.Pod) (metav1.OwnerReference, bool) {
+	for _, ref := range pod.GetOwnerReferences() {
+		if ref.Kind == "StatefulSet" && strings.HasPrefix(ref.APIVersion, appsv1.GroupName+"/") {
+			return ref, true
+		}
+	}
+	return metav1.OwnerReference{}, false
+}
+
+// SetStatefulSetOwner makes the StatefulSet of the pod an owner of the object (typically a Secret or a ConfigMap
+// created for the pod by an extension), so that the kubernetes garbage collector deletes the object together
+// with the app, without running the GarbageCollector.
+//
+// namespace is the namespace of the pod, the request namespace at admission, as the pods being created may
+// have none. Owner references can't cross namespaces, the garbage collector deleting such objects right away,
+// so an object of another namespace is refused, and an object without namespace is put in the pod one.
+func SetStatefulSetOwner(obj metav1.Object, pod *corev1.Pod, namespace string) error {
+	if pod.Namespace != "" {
+		namespace = pod.Namespace
+	}
+	if namespace == "" {
+		return errors.Errorf("The namespace of pod %s is unknown", pod.Name)
+	}
+	switch obj.GetNamespace() {
+	case "":
+		obj.SetNamespace(namespace)
+	case namespace:
+	default:
+		return errors.Errorf("Cannot set the owner of %s/%s to the statefulset of pod %s/%s, owner references can't cross namespaces",
+			obj.GetNamespace(), obj.GetName(), namespace, pod.Name)
+	}
+
+	owner, ok := StatefulSetOwner(pod)
+	if !ok {
+		return errors.Errorf("Pod %s/%s is not owned by a statefulset", namespace, pod.Name)
+	}
+	// The object is a companion, not controlled by the StatefulSet, and doesn't block its deletion, which
+	// would require the permission to update the StatefulSet finalizers
+	ref := metav1.OwnerReference{APIVersion: owner.APIVersion, Kind: owner.Kind, Name: owner.Name, UID: owner.UID}
+
+	refs := obj.GetOwnerReferences()
+	for i := range refs {
+		if refs[i].UID == ref.UID {
+			refs[i] = ref
+			obj.SetOwnerReferences(refs)
+			return nil
+		}
+	}
+	obj.SetOwnerReferences(append(refs, ref))
+	return nil
+}
+
+// GarbageCollector is a Reconciler deleting the Secrets and ConfigMaps owned by Eirini apps
+// whose StatefulSets don't exist anymore. The StatefulSets are selected by the app guid label of the
+// Eirini release of the Manager, see Manager.EiriniLayout.
+type GarbageCollector struct {
+	// GracePeriod is the minimum age of a resource before it's collected, so that resources created
+	// before the app StatefulSet (e.g. during staging) are not deleted. Optional, defaults to 10 minutes
+	GracePeriod time.Duration
+
+	mgr eirinix.Manager
+}
+
+// NewGarbageCollector returns a GarbageCollector with the default grace period
+func NewGarbageCollector() *GarbageCollector {
+	return &GarbageCollector{GracePeriod: defaultGracePeriod}
+}
+
+// RequiredPermissions returns the permissions needed by the garbage collector
+func (gc *GarbageCollector) RequiredPermissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets", "configmaps"}, Verbs: []string{"list", "watch", "delete", "deletecollection"}},
+		{APIGroups: []string{appsv1.GroupName}, Resources: []string{"statefulsets"}, Verbs: []string{"list", "watch"}},
+	}
+}
+
+// Reconcile collects the resources of the app whose guid is the request name
+func (gc *GarbageCollector) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx, cancel := context.WithTimeout(gc.mgr.GetContext(), 30*time.Second)
+	defer cancel()
+
+	c := gc.mgr.GetKubeManager().GetClient()
+	guid := request.Name
+
+	layout := gc.mgr.EiriniLayout()
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := c.List(ctx, statefulSets, client.InNamespace(request.Namespace), client.MatchingLabels{layout.LabelAppGUID: guid}); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "listing the statefulsets of app %s", guid)
+	}
+	if len(statefulSets.Items) > 0 {
+		return reconcile.Result{}, nil
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.InNamespace(request.Namespace), client.MatchingLabels{LabelOwnerAppGUID: guid}); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "listing the secrets of app %s", guid)
+	}
+	configMaps := &corev1.ConfigMapList{}
+	if err := c.List(ctx, configMaps, client.InNamespace(request.Namespace), client.MatchingLabels{LabelOwnerAppGUID: guid}); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "listing the configmaps of app %s", guid)
+	}
+
+	var objects []runtime.Object
+	var youngest time.Duration
+	collect := func(obj runtime.Object, meta metav1.Object) {
+		age := time.Since(meta.GetCreationTimestamp().Time)
+		if age < gc.GracePeriod {
+			if remaining := gc.GracePeriod - age; youngest == 0 || remaining < youngest {
+				youngest = remaining
+			}
+			return
+		}
+		objects = append(objects, obj)
+	}
+	for i := range secrets.Items {
+		collect(&secrets.Items[i], &secrets.Items[i])
+	}
+	for i := range configMaps.Items {
+		collect(&configMaps.Items[i], &configMaps.Items[i])
+	}
+
+	for _, obj := range objects {
+		if err := c.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "deleting a resource of app %s", guid)
+		}
+	}
+	if len(objects) > 0 {
+		gc.mgr.GetLogger().Infof("Deleted %d orphaned resources of app %s/%s", len(objects), request.Namespace, guid)
+	}
+
+	return reconcile.Result{RequeueAfter: youngest}, nil
+}
+
+// Register adds the garbage collector controller, triggered by the StatefulSets of the apps and by the owned resources
+func (gc *GarbageCollector) Register(m eirinix.Manager) error {
+	gc.mgr = m
+	if gc.GracePeriod == 0 {
+		gc.GracePeriod = defaultGracePeriod
+	}
+
+	c, err := controller.New("eirinix-ownership-gc", m.GetKubeManager(), controller.Options{Reconciler: gc})
+	if err != nil {
+		return errors.Wrap(err, "adding the ownership garbage collector to the manager")
+	}
+
+	// The label of the app guid is looked up on each event, as the Eirini release is detected once the
+	// Manager starts
+	toApp := func(label func() string) handler.EventHandler {
+		return &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				guid := a.Meta.GetLabels()[label()]
+				if guid == "" {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: guid, Namespace: a.Meta.GetNamespace()}}}
+			}),
+		}
+	}
+
+	appGUID := func() string { return m.EiriniLayout().LabelAppGUID }
+	ownerAppGUID := func() string { return LabelOwnerAppGUID }
+	if err := c.Watch(&source.Kind{Type: &appsv1.StatefulSet{}}, toApp(appGUID)); err != nil {
+		return errors.Wrap(err, "watching statefulsets")
+	}
+	if err := c.Watch(&source.Kind{Type: &corev1.Secret{}}, toApp(ownerAppGUID)); err != nil {
+		return errors.Wrap(err, "watching secrets")
+	}
+	if err := c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, toApp(ownerAppGUID)); err != nil {
+		return errors.Wrap(err, "watching configmaps")
+	}
+	return nil
+}
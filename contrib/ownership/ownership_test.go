@@ -0,0 +1,163 @@
+package ownership_test
+
+import (
+	"context"
+	"time"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/contrib/ownership"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Ownership", func() {
+	var (
+		pod    *corev1.Pod
+		secret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		controller := true
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "dora-0",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "StatefulSet",
+				Name:       "dora",
+				UID:        "sts-uid",
+				Controller: &controller,
+			}},
+		}}
+		secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "dora-credentials"}}
+	})
+
+	It("sets the statefulset of the pod as owner", func() {
+		Expect(SetStatefulSetOwner(secret, pod, "space")).To(Succeed())
+		Expect(secret.Namespace).To(Equal("space"))
+		Expect(secret.OwnerReferences).To(Equal([]metav1.OwnerReference{{
+			APIVersion: "apps/v1",
+			Kind:       "StatefulSet",
+			Name:       "dora",
+			UID:        "sts-uid",
+		}}))
+
+		Expect(SetStatefulSetOwner(secret, pod, "space")).To(Succeed())
+		Expect(secret.OwnerReferences).To(HaveLen(1))
+	})
+
+	It("refuses owners of another namespace", func() {
+		secret.Namespace = "other-space"
+		Expect(SetStatefulSetOwner(secret, pod, "space")).To(MatchError(ContainSubstring("can't cross namespaces")))
+		Expect(secret.OwnerReferences).To(BeEmpty())
+	})
+
+	It("refuses the pods without statefulset", func() {
+		pod.OwnerReferences = nil
+		Expect(SetStatefulSetOwner(secret, pod, "space")).To(MatchError(ContainSubstring("not owned by a statefulset")))
+	})
+})
+
+var _ = Describe("GarbageCollector", func() {
+	var (
+		eiriniManager *eirinix.DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+		kubeClient    *cfakes.FakeClient
+		gc            *GarbageCollector
+		statefulSets  []appsv1.StatefulSet
+		secrets       []corev1.Secret
+		configMaps    []corev1.ConfigMap
+		selectors     []labels.Selector
+		request       = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "space", Name: "app-guid"}}
+	)
+
+	owned := func(name string, age time.Duration) metav1.ObjectMeta {
+		meta := metav1.ObjectMeta{Name: name, Namespace: "space", CreationTimestamp: metav1.NewTime(time.Now().Add(-age))}
+		SetAppOwner(&meta, "app-guid")
+		return meta
+	}
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*eirinix.DefaultExtensionManager)
+		eiriniManager.Context = context.Background()
+
+		statefulSets = nil
+		secrets = []corev1.Secret{{ObjectMeta: owned("old-secret", time.Hour)}, {ObjectMeta: owned("new-secret", time.Minute)}}
+		configMaps = []corev1.ConfigMap{{ObjectMeta: owned("old-configmap", time.Hour)}}
+		selectors = nil
+
+		kubeClient = &cfakes.FakeClient{}
+		kubeClient.ListCalls(func(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+			listOpts := &client.ListOptions{}
+			listOpts.ApplyOptions(opts)
+			Expect(listOpts.Namespace).To(Equal("space"))
+			selectors = append(selectors, listOpts.LabelSelector)
+			switch l := list.(type) {
+			case *appsv1.StatefulSetList:
+				l.Items = statefulSets
+			case *corev1.SecretList:
+				l.Items = secrets
+			case *corev1.ConfigMapList:
+				l.Items = configMaps
+			}
+			return nil
+		})
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(kubeClient)
+		kubeManager.GetLoggerReturns(eiriniManager.GetLogr())
+		eiriniManager.KubeManager = kubeManager
+
+		gc = NewGarbageCollector()
+		Expect(gc.Register(eiriniManager)).To(Succeed())
+	})
+
+	deleted := func() []string {
+		var names []string
+		for i := 0; i < kubeClient.DeleteCallCount(); i++ {
+			_, obj, _ := kubeClient.DeleteArgsForCall(i)
+			names = append(names, obj.(metav1.Object).GetName())
+		}
+		return names
+	}
+
+	It("adds its controller to the manager", func() {
+		Expect(kubeManager.AddCallCount()).To(Equal(1))
+	})
+
+	It("deletes the resources of the apps without statefulset once the grace period elapsed", func() {
+		res, err := gc.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deleted()).To(Equal([]string{"old-secret", "old-configmap"}))
+		Expect(res.RequeueAfter).To(BeNumerically("~", 9*time.Minute, time.Second))
+
+		Expect(selectors[0].String()).To(Equal(eirinix.LabelAppGUID + "=app-guid"))
+		Expect(selectors[1].String()).To(Equal(LabelOwnerAppGUID + "=app-guid"))
+	})
+
+	It("keeps the resources of the running apps", func() {
+		statefulSets = []appsv1.StatefulSet{{ObjectMeta: metav1.ObjectMeta{Name: "dora", Namespace: "space"}}}
+
+		res, err := gc.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeClient.DeleteCallCount()).To(Equal(0))
+		Expect(res.RequeueAfter).To(BeZero())
+	})
+
+	It("selects the statefulsets with the labels of the Eirini release", func() {
+		eiriniManager.Options.EiriniCompatibility = eirinix.EiriniCompatibilityController
+
+		_, err := gc.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selectors[0].String()).To(Equal("workloads.cloudfoundry.org/app_guid=app-guid"))
+	})
+})
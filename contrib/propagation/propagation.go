@@ -0,0 +1,304 @@
+// Package propagation copies Secrets managed by the operator (e.g. registry credentials or CA bundles)
+// from the operator namespace into the namespaces of the Eirini apps, and keeps the copies in sync.
+package propagation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// AnnotationPropagatedFrom is set on the copies to the <namespace>/<name> of the source Secret. It is an
+	// annotation rather than a label, as the names of a namespace and a Secret don't fit in a label value.
+	AnnotationPropagatedFrom = "eirinix.cloudfoundry.org/propagated-from"
+
+	defaultResyncPeriod = 5 * time.Minute
+)
+
+// SecretPropagator is a Reconciler copying the designated Secrets of the source namespace into the namespaces
+// managed by the operator: the watched namespaces of the Manager (see ManagerOptions.WatchedNamespaces), or in
+// all-namespaces mode the namespaces labeled with the namespace label of the Manager (see
+// ManagerOptions.NamespaceLabel). The copies in the namespaces which aren't managed anymore are deleted.
+//
+// The copies are updated when the source Secrets change, restored when they are changed or deleted, and
+// deleted when the source Secrets are. As the source namespace may be outside the cache of the Manager,
+// the source Secrets are read directly from the API server and all the copies are resynced periodically.
+type SecretPropagator struct {
+	// SourceNamespace is the namespace of the source Secrets, typically the operator namespace
+	SourceNamespace string
+
+	// Names are the names of the Secrets to propagate
+	Names []string
+
+	// ResyncPeriod is the maximum time before a change of a source Secret is propagated. Optional, defaults to 5 minutes
+	ResyncPeriod time.Duration
+
+	mgr eirinix.Manager
+}
+
+// NewSecretPropagator returns a SecretPropagator copying the named Secrets of the source namespace
+func NewSecretPropagator(sourceNamespace string, names ...string) *SecretPropagator {
+	return &SecretPropagator{SourceNamespace: sourceNamespace, Names: names, ResyncPeriod: defaultResyncPeriod}
+}
+
+// RequiredPermissions returns the permissions needed to read the source Secrets and manage the copies
+func (p *SecretPropagator) RequiredPermissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list", "watch", "create", "update", "delete"}},
+		{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"list", "watch"}},
+	}
+}
+
+func (p *SecretPropagator) propagatedFrom(name string) string {
+	return fmt.Sprintf("%s/%s", p.SourceNamespace, name)
+}
+
+func (p *SecretPropagator) isSource(namespace, name string) bool {
+	return namespace == p.SourceNamespace && p.propagates(name)
+}
+
+func (p *SecretPropagator) propagates(name string) bool {
+	for _, n := range p.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// managesNamespace returns true if the Secrets are copied into the namespace with the labels
+func (p *SecretPropagator) managesNamespace(namespace string, labels map[string]string) bool {
+	if namespace == p.SourceNamespace {
+		return false
+	}
+	opts := p.mgr.GetManagerOptions()
+	if len(opts.WatchedNamespaces()) > 0 {
+		return opts.WatchesNamespace(namespace)
+	}
+	_, ok := labels[opts.NamespaceLabel()]
+	return ok
+}
+
+// isTarget returns true if the Secrets are copied into the namespace
+func (p *SecretPropagator) isTarget(ctx context.Context, c client.Client, namespace string) (bool, error) {
+	opts := p.mgr.GetManagerOptions()
+	if len(opts.WatchedNamespaces()) > 0 {
+		return p.managesNamespace(namespace, nil), nil
+	}
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return false, errors.Wrapf(client.IgnoreNotFound(err), "getting the namespace %s", namespace)
+	}
+	return p.managesNamespace(ns.Name, ns.Labels) && ns.Status.Phase != corev1.NamespaceTerminating, nil
+}
+
+// targetNamespaces returns the namespaces the Secrets are copied into
+func (p *SecretPropagator) targetNamespaces(ctx context.Context) ([]string, error) {
+	opts := p.mgr.GetManagerOptions()
+	if namespaces := opts.WatchedNamespaces(); len(namespaces) > 0 {
+		var targets []string
+		for _, ns := range namespaces {
+			if p.managesNamespace(ns, nil) {
+				targets = append(targets, ns)
+			}
+		}
+		return targets, nil
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := p.mgr.GetKubeManager().GetClient().List(ctx, namespaces, client.HasLabels{opts.NamespaceLabel()}); err != nil {
+		return nil, errors.Wrap(err, "listing the namespaces")
+	}
+	var targets []string
+	for _, ns := range namespaces.Items {
+		if p.managesNamespace(ns.Name, ns.Labels) && ns.Status.Phase != corev1.NamespaceTerminating {
+			targets = append(targets, ns.Name)
+		}
+	}
+	return targets, nil
+}
+
+// Reconcile syncs the copy of the Secret named after the request, in the request namespace
+func (p *SecretPropagator) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx, cancel := context.WithTimeout(p.mgr.GetContext(), 30*time.Second)
+	defer cancel()
+
+	resync := reconcile.Result{RequeueAfter: p.ResyncPeriod}
+	if !p.propagates(request.Name) || request.Namespace == p.SourceNamespace {
+		return reconcile.Result{}, nil
+	}
+	c := p.mgr.GetKubeManager().GetClient()
+
+	target, err := p.isTarget(ctx, c, request.Namespace)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !target {
+		return reconcile.Result{}, p.deleteCopy(ctx, c, request.NamespacedName)
+	}
+
+	src := &corev1.Secret{}
+	err = p.mgr.GetKubeManager().GetAPIReader().Get(ctx, types.NamespacedName{Namespace: p.SourceNamespace, Name: request.Name}, src)
+	if apierrors.IsNotFound(err) {
+		return reconcile.Result{}, p.deleteCopy(ctx, c, request.NamespacedName)
+	}
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "getting the source secret %s", p.propagatedFrom(request.Name))
+	}
+
+	dst := &corev1.Secret{}
+	err = c.Get(ctx, request.NamespacedName, dst)
+	if apierrors.IsNotFound(err) {
+		return resync, p.create(ctx, c, src, request.Namespace)
+	}
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "getting the secret %s", request.NamespacedName)
+	}
+	if dst.Annotations[AnnotationPropagatedFrom] != p.propagatedFrom(src.Name) {
+		p.mgr.GetLogger().Warnf("Not propagating secret %s to %s: a secret not managed by eirinix already exists", p.propagatedFrom(src.Name), request.Namespace)
+		return resync, nil
+	}
+
+	if dst.Type != src.Type {
+		// The type of a Secret is immutable
+		if err := c.Delete(ctx, dst); client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "deleting the secret %s", request.NamespacedName)
+		}
+		return resync, p.create(ctx, c, src, request.Namespace)
+	}
+	if secretDataEqual(dst.Data, src.Data) {
+		return resync, nil
+	}
+	dst.Data = src.Data
+	if err := c.Update(ctx, dst); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "updating the secret %s", request.NamespacedName)
+	}
+	p.mgr.GetLogger().Infof("Updated secret %s/%s from %s", dst.Namespace, dst.Name, p.propagatedFrom(src.Name))
+	return resync, nil
+}
+
+func (p *SecretPropagator) create(ctx context.Context, c client.Client, src *corev1.Secret, namespace string) error {
+	dst := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        src.Name,
+			Namespace:   namespace,
+			Annotations: map[string]string{AnnotationPropagatedFrom: p.propagatedFrom(src.Name)},
+		},
+		Type: src.Type,
+		Data: src.Data,
+	}
+	if err := c.Create(ctx, dst); err != nil {
+		return errors.Wrapf(err, "creating the secret %s/%s", namespace, src.Name)
+	}
+	p.mgr.GetLogger().Infof("Propagated secret %s to %s", p.propagatedFrom(src.Name), namespace)
+	return nil
+}
+
+// deleteCopy deletes the copy of a source Secret which doesn't exist anymore
+func (p *SecretPropagator) deleteCopy(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	dst := &corev1.Secret{}
+	if err := c.Get(ctx, key, dst); err != nil {
+		return errors.Wrapf(client.IgnoreNotFound(err), "getting the secret %s", key)
+	}
+	if dst.Annotations[AnnotationPropagatedFrom] != p.propagatedFrom(key.Name) {
+		return nil
+	}
+	if err := c.Delete(ctx, dst); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "deleting the secret %s", key)
+	}
+	return nil
+}
+
+func secretDataEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || string(v) != string(w) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestsForAllTargets returns a request for the Secret in each target namespace
+func (p *SecretPropagator) requestsForAllTargets(name string) []reconcile.Request {
+	ctx, cancel := context.WithTimeout(p.mgr.GetContext(), 30*time.Second)
+	defer cancel()
+
+	targets, err := p.targetNamespaces(ctx)
+	if err != nil {
+		p.mgr.GetLogger().Errorf("Failed propagating secret %s: %s", p.propagatedFrom(name), err.Error())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(targets))
+	for _, ns := range targets {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: ns, Name: name}})
+	}
+	return requests
+}
+
+// Register adds the propagation controller, triggered by the source Secrets, by the copies and by the namespaces
+func (p *SecretPropagator) Register(m eirinix.Manager) error {
+	p.mgr = m
+	if p.ResyncPeriod == 0 {
+		p.ResyncPeriod = defaultResyncPeriod
+	}
+
+	c, err := controller.New("eirinix-secret-propagation", m.GetKubeManager(), controller.Options{Reconciler: p})
+	if err != nil {
+		return errors.Wrap(err, "adding the secret propagation controller to the manager")
+	}
+
+	secrets := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			if p.isSource(a.Meta.GetNamespace(), a.Meta.GetName()) {
+				return p.requestsForAllTargets(a.Meta.GetName())
+			}
+			if from := a.Meta.GetAnnotations()[AnnotationPropagatedFrom]; strings.HasPrefix(from, p.SourceNamespace+"/") {
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: a.Meta.GetNamespace(), Name: a.Meta.GetName()}}}
+			}
+			return nil
+		}),
+	}
+	if err := c.Watch(&source.Kind{Type: &corev1.Secret{}}, secrets); err != nil {
+		return errors.Wrap(err, "watching secrets")
+	}
+
+	// Namespaces are cluster scoped, so they are watched even when the cache is restricted to the
+	// watched namespaces: the initial sync of each target namespace starts with its first event, and the
+	// copies are deleted when a namespace loses the namespace label
+	opts := m.GetManagerOptions()
+	namespaces := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			ns := a.Meta.GetName()
+			if ns == p.SourceNamespace || !opts.WatchesNamespace(ns) {
+				return nil
+			}
+			requests := make([]reconcile.Request, 0, len(p.Names))
+			for _, name := range p.Names {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: ns, Name: name}})
+			}
+			return requests
+		}),
+	}
+	if err := c.Watch(&source.Kind{Type: &corev1.Namespace{}}, namespaces); err != nil {
+		return errors.Wrap(err, "watching namespaces")
+	}
+	return nil
+}
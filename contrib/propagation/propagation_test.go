@@ -0,0 +1,199 @@
+package propagation_test
+
+import (
+	"context"
+	"time"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/contrib/propagation"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("SecretPropagator", func() {
+	var (
+		eiriniManager *eirinix.DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+		kubeClient    *cfakes.FakeClient
+		apiReader     *cfakes.FakeClient
+		propagator    *SecretPropagator
+		source        *corev1.Secret
+		existing      map[types.NamespacedName]runtime.Object
+		request       = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "space", Name: "registry"}}
+		notFound      = func(name string) error {
+			return apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+		}
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*eirinix.DefaultExtensionManager)
+		eiriniManager.Context = context.Background()
+		eiriniManager.Options.Namespace = "space"
+
+		source = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "eirinix"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+		}
+		existing = map[types.NamespacedName]runtime.Object{}
+
+		apiReader = &cfakes.FakeClient{}
+		apiReader.GetCalls(func(_ context.Context, key types.NamespacedName, obj runtime.Object) error {
+			if source == nil || key.Namespace != source.Namespace || key.Name != source.Name {
+				return notFound(key.Name)
+			}
+			source.DeepCopyInto(obj.(*corev1.Secret))
+			return nil
+		})
+		kubeClient = &cfakes.FakeClient{}
+		kubeClient.GetCalls(func(_ context.Context, key types.NamespacedName, obj runtime.Object) error {
+			o, ok := existing[key]
+			if !ok {
+				return notFound(key.Name)
+			}
+			switch o := o.(type) {
+			case *corev1.Secret:
+				o.DeepCopyInto(obj.(*corev1.Secret))
+			case *corev1.Namespace:
+				o.DeepCopyInto(obj.(*corev1.Namespace))
+			}
+			return nil
+		})
+
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(kubeClient)
+		kubeManager.GetAPIReaderReturns(apiReader)
+		kubeManager.GetLoggerReturns(eiriniManager.GetLogr())
+		eiriniManager.KubeManager = kubeManager
+
+		propagator = NewSecretPropagator("eirinix", "registry")
+		Expect(propagator.Register(eiriniManager)).To(Succeed())
+	})
+
+	copyOf := func(namespace string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "registry",
+				Namespace:   namespace,
+				Annotations: map[string]string{AnnotationPropagatedFrom: "eirinix/registry"},
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"old":{}}}`)},
+		}
+	}
+
+	It("adds its controller to the manager", func() {
+		Expect(kubeManager.AddCallCount()).To(Equal(1))
+	})
+
+	It("copies the source secret into the watched namespaces", func() {
+		res, err := propagator.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.RequeueAfter).To(Equal(5 * time.Minute))
+
+		Expect(kubeClient.CreateCallCount()).To(Equal(1))
+		_, obj, _ := kubeClient.CreateArgsForCall(0)
+		secret := obj.(*corev1.Secret)
+		Expect(secret.Namespace).To(Equal("space"))
+		Expect(secret.Name).To(Equal("registry"))
+		Expect(secret.Annotations).To(HaveKeyWithValue(AnnotationPropagatedFrom, "eirinix/registry"))
+		Expect(secret.Labels).To(BeEmpty())
+		Expect(secret.Type).To(Equal(corev1.SecretTypeDockerConfigJson))
+		Expect(secret.Data).To(Equal(source.Data))
+	})
+
+	It("ignores the secrets which aren't propagated", func() {
+		_, err := propagator.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "space", Name: "other"}})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = propagator.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "eirinix", Name: "registry"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeClient.GetCallCount()).To(Equal(0))
+		Expect(kubeClient.CreateCallCount()).To(Equal(0))
+	})
+
+	It("updates the outdated copies", func() {
+		existing[request.NamespacedName] = copyOf("space")
+
+		_, err := propagator.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeClient.UpdateCallCount()).To(Equal(1))
+		_, obj, _ := kubeClient.UpdateArgsForCall(0)
+		Expect(obj.(*corev1.Secret).Data).To(Equal(source.Data))
+	})
+
+	It("doesn't overwrite the secrets it didn't create", func() {
+		secret := copyOf("space")
+		secret.Annotations = nil
+		existing[request.NamespacedName] = secret
+
+		_, err := propagator.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeClient.UpdateCallCount()).To(Equal(0))
+		Expect(kubeClient.DeleteCallCount()).To(Equal(0))
+	})
+
+	It("deletes the copies of the deleted source secrets", func() {
+		source = nil
+		existing[request.NamespacedName] = copyOf("space")
+
+		_, err := propagator.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeClient.DeleteCallCount()).To(Equal(1))
+		_, obj, _ := kubeClient.DeleteArgsForCall(0)
+		Expect(obj.(*corev1.Secret).Namespace).To(Equal("space"))
+	})
+
+	It("deletes the copies in the namespaces which aren't watched", func() {
+		key := types.NamespacedName{Namespace: "kube-system", Name: "registry"}
+		existing[key] = copyOf("kube-system")
+
+		_, err := propagator.Reconcile(reconcile.Request{NamespacedName: key})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeClient.CreateCallCount()).To(Equal(0))
+		Expect(kubeClient.DeleteCallCount()).To(Equal(1))
+	})
+
+	Context("when the Manager watches all the namespaces", func() {
+		var label string
+
+		BeforeEach(func() {
+			eiriniManager.Options.AllNamespaces = true
+			label = eiriniManager.Options.NamespaceLabel()
+			existing[types.NamespacedName{Name: "space"}] = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "space",
+				Labels: map[string]string{label: "space"},
+			}}
+			existing[types.NamespacedName{Name: "kube-system"}] = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}}
+		})
+
+		It("copies the source secret into the labeled namespaces only", func() {
+			_, err := propagator.Reconcile(request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kubeClient.CreateCallCount()).To(Equal(1))
+
+			_, err = propagator.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "kube-system", Name: "registry"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kubeClient.CreateCallCount()).To(Equal(1))
+		})
+
+		It("deletes the copies in the namespaces which lost the label", func() {
+			existing[types.NamespacedName{Name: "space"}].(*corev1.Namespace).Labels = nil
+			existing[request.NamespacedName] = copyOf("space")
+
+			_, err := propagator.Reconcile(request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kubeClient.CreateCallCount()).To(Equal(0))
+			Expect(kubeClient.DeleteCallCount()).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,128 @@
+// Package registry contains an Eirini extension which denies the app pods running images
+// from registries which are not on an allowlist.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// AnnotationAllowedRegistries can be set on a namespace (a CF space) to allow additional registries
+	// for its apps, as a comma separated list. "*" allows any registry.
+	AnnotationAllowedRegistries = "eirinix.cloudfoundry.org/allowed-registries"
+
+	// MessageUntrustedImages is the id of the denial message in the eirinix.MessageCatalog. The template
+	// is passed the comma separated .Images and the .Namespace of the pod
+	MessageUntrustedImages = "registry.untrusted-images"
+
+	defaultUntrustedImagesMessage = "images from untrusted registries: {{.Images}}"
+	defaultRegistry               = "docker.io"
+	allowAll                      = "*"
+)
+
+// Extension denies the pods with containers whose image is not on the allowlist
+type Extension struct {
+	// Allowed are the allowed registries (e.g. "registry.example.com") or repository prefixes
+	// (e.g. "docker.io/cloudfoundry")
+	Allowed []string
+}
+
+// NewExtension returns an Extension allowing the given registries
+func NewExtension(allowed ...string) *Extension {
+	return &Extension{Allowed: allowed}
+}
+
+// RequiredPermissions returns the permissions needed to read the namespace annotations
+func (e *Extension) RequiredPermissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{{
+		APIGroups: []string{""},
+		Resources: []string{"namespaces"},
+		Verbs:     []string{"get", "list", "watch"},
+	}}
+}
+
+// Repository returns the fully qualified repository of an image reference, without tag or digest,
+// following the docker conventions (e.g. "busybox" is "docker.io/library/busybox")
+func Repository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i:], "/") {
+		image = image[:i]
+	}
+
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return fmt.Sprintf("%s/library/%s", defaultRegistry, image)
+	}
+	if !strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost" {
+		return fmt.Sprintf("%s/%s", defaultRegistry, image)
+	}
+	return image
+}
+
+// Allowed returns true if the image matches one of the allowed registries or repository prefixes
+func Allowed(image string, allowed []string) bool {
+	repository := Repository(image)
+	for _, a := range allowed {
+		a = strings.TrimSuffix(strings.TrimSpace(a), "/")
+		if a == allowAll || repository == a || strings.HasPrefix(repository, a+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// DeniedImages returns the images of the pod which are not allowed
+func (e *Extension) DeniedImages(pod *corev1.Pod, extraAllowed []string) []string {
+	allowed := append(append([]string{}, e.Allowed...), extraAllowed...)
+
+	var denied []string
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if !Allowed(c.Image, allowed) {
+			denied = append(denied, c.Image)
+		}
+	}
+	return denied
+}
+
+// Handle denies the pod if one of its images comes from a registry which is not allowed, globally
+// or for the namespace of the pod
+func (e *Extension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if pod == nil {
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("no pod could be decoded from the request"))
+	}
+
+	namespace := req.Namespace
+	if pod.Namespace != "" {
+		namespace = pod.Namespace
+	}
+
+	var extraAllowed []string
+	if len(e.DeniedImages(pod, nil)) > 0 && namespace != "" {
+		ns := &corev1.Namespace{}
+		if err := eiriniManager.GetKubeManager().GetClient().Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if annotation := ns.Annotations[AnnotationAllowedRegistries]; annotation != "" {
+			extraAllowed = strings.Split(annotation, ",")
+		}
+	}
+
+	if denied := e.DeniedImages(pod, extraAllowed); len(denied) > 0 {
+		return admission.Denied(eiriniManager.Message(MessageUntrustedImages, defaultUntrustedImagesMessage, struct {
+			Images    string
+			Namespace string
+		}{strings.Join(denied, ", "), namespace}))
+	}
+	return admission.Allowed("")
+}
@@ -0,0 +1,38 @@
+package registry_test
+
+import (
+	. "code.cloudfoundry.org/eirinix/contrib/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Registry extension", func() {
+	It("normalizes image references", func() {
+		Expect(Repository("busybox")).To(Equal("docker.io/library/busybox"))
+		Expect(Repository("busybox:1.32")).To(Equal("docker.io/library/busybox"))
+		Expect(Repository("cloudfoundry/diego-ssh@sha256:abcd")).To(Equal("docker.io/cloudfoundry/diego-ssh"))
+		Expect(Repository("registry.example.com:5000/team/app:v1")).To(Equal("registry.example.com:5000/team/app"))
+		Expect(Repository("localhost/app")).To(Equal("localhost/app"))
+	})
+
+	It("matches registries and repository prefixes", func() {
+		allowed := []string{"registry.example.com", "docker.io/cloudfoundry/"}
+		Expect(Allowed("registry.example.com/team/app", allowed)).To(BeTrue())
+		Expect(Allowed("cloudfoundry/eirini", allowed)).To(BeTrue())
+		Expect(Allowed("cloudfoundry-evil/eirini", allowed)).To(BeFalse())
+		Expect(Allowed("registry.example.com.evil.io/app", allowed)).To(BeFalse())
+		Expect(Allowed("busybox", allowed)).To(BeFalse())
+		Expect(Allowed("busybox", []string{"*"})).To(BeTrue())
+	})
+
+	It("lists the denied images of a pod", func() {
+		pod := &corev1.Pod{Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Image: "busybox"}},
+			Containers:     []corev1.Container{{Image: "registry.example.com/app"}, {Image: "quay.io/sidecar"}},
+		}}
+		e := NewExtension("registry.example.com")
+		Expect(e.DeniedImages(pod, nil)).To(Equal([]string{"busybox", "quay.io/sidecar"}))
+		Expect(e.DeniedImages(pod, []string{"quay.io", "docker.io/library"})).To(BeEmpty())
+	})
+})
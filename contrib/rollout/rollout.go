@@ -0,0 +1,194 @@
+// Package rollout restarts the Eirini app StatefulSets whose pods were mutated with an outdated configuration
+// of the extensions, e.g. an older sidecar image, so that the running apps pick up the new one.
+package rollout
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// AnnotationRestartedAt is set on the pod template of the restarted StatefulSets, like kubectl rollout
+	// restart does, so that the StatefulSet controller recreates the pods
+	AnnotationRestartedAt = "eirinix.cloudfoundry.org/restartedAt"
+
+	defaultInterval = 10 * time.Second
+)
+
+// Restarter is a Reconciler restarting the app StatefulSets with a pod stamped with an outdated configuration
+// hash (see ManagerOptions.AnnotateConfigHash and Manager.ConfigStale) by one of the extensions, so that the
+// webhooks mutate the recreated pods with the current configuration. Every StatefulSet is checked when the
+// configuration changes (see Manager.Reconfigure), and when its pods are updated.
+type Restarter struct {
+	// Keys are the ConfigKeys of the extensions whose configuration changes restart the apps
+	Keys []string
+
+	// Interval is the minimum time between the restarts of two StatefulSets, spreading the rollouts. Optional,
+	// defaults to 10s
+	Interval time.Duration
+
+	mgr    eirinix.Manager
+	events chan event.GenericEvent
+
+	mu          sync.Mutex
+	lastRestart time.Time
+}
+
+// NewRestarter returns a Restarter for the extensions with the config keys
+func NewRestarter(keys ...string) *Restarter {
+	return &Restarter{Keys: keys, Interval: defaultInterval}
+}
+
+// RequiredPermissions returns the permissions needed by the restarter
+func (r *Restarter) RequiredPermissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{APIGroups: []string{appsv1.GroupName}, Resources: []string{"statefulsets"}, Verbs: []string{"get", "list", "watch", "patch"}},
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list", "watch"}},
+	}
+}
+
+// Reconcile restarts the StatefulSet of the request if one of its pods is stale
+func (r *Restarter) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx, cancel := context.WithTimeout(r.mgr.GetContext(), 30*time.Second)
+	defer cancel()
+
+	c := r.mgr.GetKubeManager().GetClient()
+	sts := &appsv1.StatefulSet{}
+	if err := c.Get(ctx, request.NamespacedName, sts); err != nil {
+		return reconcile.Result{}, errors.Wrapf(client.IgnoreNotFound(err), "getting the statefulset %s", request)
+	}
+	layout := r.mgr.EiriniLayout()
+	if sts.Labels[layout.LabelSourceType] != layout.SourceTypeApp || sts.Spec.Selector == nil {
+		return reconcile.Result{}, nil
+	}
+	if sts.Status.UpdateRevision != sts.Status.CurrentRevision {
+		// The StatefulSet is rolling, it is checked again once its pods are updated
+		return reconcile.Result{}, nil
+	}
+
+	stale, err := r.stalePod(ctx, c, sts)
+	if err != nil || stale == "" {
+		return reconcile.Result{}, err
+	}
+
+	if wait := r.reserveRestart(); wait > 0 {
+		return reconcile.Result{RequeueAfter: wait}, nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{AnnotationRestartedAt: time.Now().UTC().Format(time.RFC3339)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if err := c.Patch(ctx, sts, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return reconcile.Result{}, errors.Wrapf(client.IgnoreNotFound(err), "restarting the statefulset %s", request)
+	}
+	r.mgr.GetLogger().Infof("Restarted the statefulset %s, the pod %s has an outdated configuration", request, stale)
+	return reconcile.Result{}, nil
+}
+
+// stalePod returns the name of a pod of the StatefulSet with an outdated configuration, if any
+func (r *Restarter) stalePod(ctx context.Context, c client.Client, sts *appsv1.StatefulSet) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return "", errors.Wrapf(err, "parsing the selector of the statefulset %s/%s", sts.Namespace, sts.Name)
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(sts.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return "", errors.Wrapf(err, "listing the pods of the statefulset %s/%s", sts.Namespace, sts.Name)
+	}
+	for i := range pods.Items {
+		for _, key := range r.Keys {
+			stale, err := r.mgr.ConfigStale(key, &pods.Items[i])
+			if err != nil {
+				return "", errors.Wrapf(err, "checking the configuration '%s' of the pod %s/%s", key, sts.Namespace, pods.Items[i].Name)
+			}
+			if stale {
+				return pods.Items[i].Name, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// reserveRestart returns how long to wait before the next restart, or reserves the restart if the Interval
+// elapsed since the previous one
+func (r *Restarter) reserveRestart() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if wait := r.Interval - time.Since(r.lastRestart); wait > 0 {
+		return wait
+	}
+	r.lastRestart = time.Now()
+	return 0
+}
+
+// enqueueAll checks every StatefulSet, once the configuration changed
+func (r *Restarter) enqueueAll() {
+	ctx, cancel := context.WithTimeout(r.mgr.GetContext(), 30*time.Second)
+	defer cancel()
+
+	layout := r.mgr.EiriniLayout()
+	statefulSets := &appsv1.StatefulSetList{}
+	err := r.mgr.GetKubeManager().GetClient().List(ctx, statefulSets, client.MatchingLabels{layout.LabelSourceType: layout.SourceTypeApp})
+	if err != nil {
+		r.mgr.GetLogger().Errorf("Listing the statefulsets to restart: %s", err)
+		return
+	}
+	for i := range statefulSets.Items {
+		sts := &statefulSets.Items[i]
+		r.events <- event.GenericEvent{Meta: sts, Object: sts}
+	}
+}
+
+// Register adds the restarter controller, triggered by the configuration changes, the StatefulSets of the
+// apps and their pods
+func (r *Restarter) Register(m eirinix.Manager) error {
+	r.mgr = m
+	if r.Interval == 0 {
+		r.Interval = defaultInterval
+	}
+	r.events = make(chan event.GenericEvent)
+
+	// A single worker, so that the restarts are spread by the Interval
+	c, err := controller.New("eirinix-rollout", m.GetKubeManager(), controller.Options{Reconciler: r, MaxConcurrentReconciles: 1})
+	if err != nil {
+		return errors.Wrap(err, "adding the rollout restarter to the manager")
+	}
+
+	if err := c.Watch(&source.Kind{Type: &appsv1.StatefulSet{}}, &handler.EnqueueRequestForObject{}); err != nil {
+		return errors.Wrap(err, "watching statefulsets")
+	}
+	if err := c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestForOwner{OwnerType: &appsv1.StatefulSet{}, IsController: true}); err != nil {
+		return errors.Wrap(err, "watching pods")
+	}
+	if err := c.Watch(&source.Channel{Source: r.events}, &handler.EnqueueRequestForObject{}); err != nil {
+		return errors.Wrap(err, "watching the configuration changes")
+	}
+
+	// The hooks run with the configuration lock held
+	m.OnConfigChange(func(int64) { go r.enqueueAll() })
+	return nil
+}
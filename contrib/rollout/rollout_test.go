@@ -0,0 +1,118 @@
+package rollout_test
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/contrib/rollout"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// sidecarExtension is a configurable extension
+type sidecarExtension struct{}
+
+func (e *sidecarExtension) Handle(context.Context, eirinix.Manager, *corev1.Pod, admission.Request) admission.Response {
+	return admission.Allowed("")
+}
+
+func (e *sidecarExtension) ConfigKey() string { return "sidecar" }
+
+func (e *sidecarExtension) ConfigSchema() *eirinix.ConfigSchema {
+	return &eirinix.ConfigSchema{Type: "object"}
+}
+
+func (e *sidecarExtension) Configure([]byte) error { return nil }
+
+var _ = Describe("Restarter", func() {
+	var (
+		eiriniManager *eirinix.DefaultExtensionManager
+		kubeClient    *cfakes.FakeClient
+		kubeManager   *cfakes.FakeManager
+		restarter     *Restarter
+		stampedHash   string
+		request       = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "space", Name: "dora"}}
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*eirinix.DefaultExtensionManager)
+		eiriniManager.Context = context.Background()
+		eiriniManager.Options.ExtensionConfig = map[string]json.RawMessage{"sidecar": json.RawMessage(`{"image": "sidecar:v2"}`)}
+		Expect(eiriniManager.AddExtension(&sidecarExtension{})).To(Succeed())
+
+		kubeClient = &cfakes.FakeClient{}
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(kubeClient)
+		// controller.New logs through the logger of the manager
+		kubeManager.GetLoggerReturns(eiriniManager.GetLogr())
+		eiriniManager.KubeManager = kubeManager
+
+		kubeClient.GetCalls(func(_ context.Context, key types.NamespacedName, obj runtime.Object) error {
+			sts := obj.(*appsv1.StatefulSet)
+			sts.Name, sts.Namespace = key.Name, key.Namespace
+			sts.Labels = map[string]string{eirinix.LabelSourceType: "APP"}
+			sts.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "dora"}}
+			return nil
+		})
+		kubeClient.ListCalls(func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+			list.(*corev1.PodList).Items = []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{
+				Name:        "dora-0",
+				Namespace:   "space",
+				Annotations: map[string]string{eirinix.AnnotationConfigHashPrefix + "sidecar": stampedHash},
+			}}}
+			return nil
+		})
+
+		restarter = NewRestarter("sidecar")
+		restarter.Interval = time.Hour
+		Expect(restarter.Register(eiriniManager)).To(Succeed())
+	})
+
+	It("adds its controller to the manager", func() {
+		Expect(kubeManager.AddCallCount()).To(Equal(1))
+		Expect(kubeManager.SetFieldsArgsForCall(0)).To(Equal(restarter))
+	})
+
+	It("restarts the statefulsets of the stale pods", func() {
+		var err error
+		stampedHash, err = eirinix.ConfigHash([]byte(`{"image": "sidecar:v1"}`))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = restarter.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeClient.PatchCallCount()).To(Equal(1))
+		_, _, patch, _ := kubeClient.PatchArgsForCall(0)
+		data, err := patch.Data(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(AnnotationRestartedAt))
+
+		// The next restart waits for the interval
+		res, err := restarter.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.RequeueAfter).To(BeNumerically(">", 59*time.Minute))
+		Expect(kubeClient.PatchCallCount()).To(Equal(1))
+	})
+
+	It("doesn't restart the up-to-date statefulsets", func() {
+		var err error
+		stampedHash, err = eirinix.ConfigHash([]byte(`{"image": "sidecar:v2"}`))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = restarter.Reconcile(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeClient.PatchCallCount()).To(Equal(0))
+	})
+})
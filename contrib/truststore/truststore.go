@@ -0,0 +1,178 @@
+// Package truststore contains an Eirini extension which mounts a platform CA bundle into the
+// app containers, and points SSL_CERT_FILE to it, so that apps trust the platform certificates.
+package truststore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// EnvSSLCertFile is the environment variable pointing to the CA bundle, honored by OpenSSL and Go
+	EnvSSLCertFile = "SSL_CERT_FILE"
+
+	defaultKey       = "ca.crt"
+	defaultMountPath = "/etc/ssl/certs/eirinix"
+	defaultFileName  = "ca-certificates.crt"
+	volumeName       = "eirinix-trust-store"
+)
+
+// Extension mounts the CA bundle stored in a ConfigMap into every container of the app pods.
+//
+// The bundle replaces the system one for the apps honoring SSL_CERT_FILE, so it should contain
+// the public CAs as well as the platform ones.
+type Extension struct {
+	// ConfigMapName is the name of the ConfigMap containing the CA bundle, in the app namespace
+	ConfigMapName string
+
+	// Key is the key of the CA bundle in the ConfigMap. Optional, defaults to ca.crt
+	Key string
+
+	// SourceNamespace, if set, is the namespace the ConfigMap is copied from into the app namespaces
+	SourceNamespace string
+
+	// MountPath is the directory the bundle is mounted in. Optional, defaults to /etc/ssl/certs/eirinix
+	MountPath string
+}
+
+// NewExtension returns an Extension mounting the CA bundle of the ConfigMap
+func NewExtension(configMapName string) *Extension {
+	return &Extension{ConfigMapName: configMapName}
+}
+
+func (e *Extension) key() string {
+	if e.Key == "" {
+		return defaultKey
+	}
+	return e.Key
+}
+
+func (e *Extension) mountPath() string {
+	if e.MountPath == "" {
+		return defaultMountPath
+	}
+	return e.MountPath
+}
+
+// CertFile returns the path of the CA bundle in the containers
+func (e *Extension) CertFile() string {
+	return path.Join(e.mountPath(), defaultFileName)
+}
+
+// RequiredPermissions returns the permissions needed to copy the ConfigMap, if SourceNamespace is set
+func (e *Extension) RequiredPermissions() []rbacv1.PolicyRule {
+	if e.SourceNamespace == "" {
+		return nil
+	}
+	return []rbacv1.PolicyRule{{
+		APIGroups: []string{""},
+		Resources: []string{"configmaps"},
+		Verbs:     []string{"get", "create", "update"},
+	}}
+}
+
+// Inject adds the CA bundle volume to the pod, mounts it in all the containers and sets SSL_CERT_FILE,
+// unless the containers already define it
+func (e *Extension) Inject(pod *corev1.Pod) {
+	found := false
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == volumeName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: e.ConfigMapName},
+					Items:                []corev1.KeyToPath{{Key: e.key(), Path: defaultFileName}},
+				},
+			},
+		})
+	}
+
+	for i := range pod.Spec.InitContainers {
+		e.injectContainer(&pod.Spec.InitContainers[i])
+	}
+	for i := range pod.Spec.Containers {
+		e.injectContainer(&pod.Spec.Containers[i])
+	}
+}
+
+func (e *Extension) injectContainer(c *corev1.Container) {
+	mounted := false
+	for _, m := range c.VolumeMounts {
+		if m.Name == volumeName {
+			mounted = true
+			break
+		}
+	}
+	if !mounted {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: e.mountPath(),
+			ReadOnly:  true,
+		})
+	}
+
+	for _, env := range c.Env {
+		if env.Name == EnvSSLCertFile {
+			return
+		}
+	}
+	c.Env = append(c.Env, corev1.EnvVar{Name: EnvSSLCertFile, Value: e.CertFile()})
+}
+
+// Handle injects the CA bundle in the Eirini app pods
+func (e *Extension) Handle(ctx context.Context, eiriniManager eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if pod == nil {
+		return admission.Errored(http.StatusBadRequest, errors.New("No pod could be decoded from the request"))
+	}
+
+	namespace := req.Namespace
+	if pod.Namespace != "" {
+		namespace = pod.Namespace
+	}
+	if e.SourceNamespace != "" && namespace != e.SourceNamespace {
+		eiriniManager.EnqueueSideEffect(fmt.Sprintf("truststore/%s/%s", namespace, e.ConfigMapName), func(ctx context.Context) error {
+			return CopyConfigMap(ctx, eiriniManager.GetKubeManager().GetClient(), e.ConfigMapName, e.SourceNamespace, namespace)
+		})
+	}
+
+	podCopy := pod.DeepCopy()
+	e.Inject(podCopy)
+	return eiriniManager.PatchFromPod(req, podCopy)
+}
+
+// CopyConfigMap creates or updates the ConfigMap in the target namespace with the data of the one in the source namespace
+func CopyConfigMap(ctx context.Context, c client.Client, name, sourceNamespace, targetNamespace string) error {
+	source := &corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: sourceNamespace}, source); err != nil {
+		return errors.Wrapf(err, "getting the trust store configmap %s/%s", sourceNamespace, name)
+	}
+
+	target := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: targetNamespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, c, target, func() error {
+		target.Data = source.Data
+		target.BinaryData = source.BinaryData
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "copying the trust store configmap to %s", targetNamespace)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package truststore_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTrustStore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TrustStore Extension Suite")
+}
@@ -0,0 +1,62 @@
+package truststore_test
+
+import (
+	. "code.cloudfoundry.org/eirinix/contrib/truststore"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("TrustStore extension", func() {
+	var pod *corev1.Pod
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "setup"}},
+			Containers: []corev1.Container{
+				{Name: "opi"},
+				{Name: "custom", Env: []corev1.EnvVar{{Name: EnvSSLCertFile, Value: "/custom.pem"}}},
+			},
+		}}
+	})
+
+	It("mounts the CA bundle in all the containers", func() {
+		e := NewExtension("platform-ca")
+		e.Inject(pod)
+
+		Expect(pod.Spec.Volumes).To(HaveLen(1))
+		Expect(pod.Spec.Volumes[0].ConfigMap.Name).To(Equal("platform-ca"))
+		Expect(pod.Spec.Volumes[0].ConfigMap.Items[0].Key).To(Equal("ca.crt"))
+
+		for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+			Expect(c.VolumeMounts).To(HaveLen(1))
+			Expect(c.VolumeMounts[0].MountPath).To(Equal("/etc/ssl/certs/eirinix"))
+			Expect(c.VolumeMounts[0].ReadOnly).To(BeTrue())
+		}
+		Expect(pod.Spec.Containers[0].Env).To(ConsistOf(corev1.EnvVar{Name: EnvSSLCertFile, Value: e.CertFile()}))
+		Expect(e.CertFile()).To(Equal("/etc/ssl/certs/eirinix/ca-certificates.crt"))
+	})
+
+	It("keeps the SSL_CERT_FILE set by the app", func() {
+		NewExtension("platform-ca").Inject(pod)
+		Expect(pod.Spec.Containers[1].Env).To(ConsistOf(corev1.EnvVar{Name: EnvSSLCertFile, Value: "/custom.pem"}))
+	})
+
+	It("is idempotent", func() {
+		e := &Extension{ConfigMapName: "platform-ca", MountPath: "/certs"}
+		e.Inject(pod)
+		e.Inject(pod)
+
+		Expect(pod.Spec.Volumes).To(HaveLen(1))
+		Expect(pod.Spec.Containers[0].VolumeMounts).To(HaveLen(1))
+		Expect(pod.Spec.Containers[0].Env).To(HaveLen(1))
+		Expect(e.CertFile()).To(Equal("/certs/ca-certificates.crt"))
+	})
+
+	It("requires permissions only to copy the ConfigMap", func() {
+		e := NewExtension("platform-ca")
+		Expect(e.RequiredPermissions()).To(BeEmpty())
+		e.SourceNamespace = "cf-system"
+		Expect(e.RequiredPermissions()).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,140 @@
+package extension
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultCertificateValidity = 365 * 24 * time.Hour
+	certificateKeyBits         = 2048
+)
+
+// Certificate is a PEM encoded certificate and its private key
+type Certificate struct {
+	IsCA        bool
+	PrivateKey  []byte
+	Certificate []byte
+}
+
+// CertificateRequest describes the certificate to generate. Leaf certificates are signed by CA,
+// while CA certificates are self-signed
+type CertificateRequest struct {
+	CommonName       string
+	AlternativeNames []string
+	IsCA             bool
+	CA               Certificate
+}
+
+// CredentialGenerator generates the certificates of the webhook server
+type CredentialGenerator interface {
+	GenerateCertificate(name string, request CertificateRequest) (Certificate, error)
+}
+
+// NewCredentialGenerator returns the default CredentialGenerator, which generates RSA certificates
+// in memory with the standard library
+func NewCredentialGenerator() CredentialGenerator {
+	return &inMemoryGenerator{validity: defaultCertificateValidity}
+}
+
+type inMemoryGenerator struct {
+	validity time.Duration
+}
+
+// GenerateCertificate generates a certificate and its private key, PEM encoded
+func (g *inMemoryGenerator) GenerateCertificate(name string, request CertificateRequest) (Certificate, error) {
+	key, err := rsa.GenerateKey(rand.Reader, certificateKeyBits)
+	if err != nil {
+		return Certificate{}, errors.Wrapf(err, "generating the private key of %s", name)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return Certificate{}, errors.Wrapf(err, "generating the serial number of %s", name)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: request.CommonName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(g.validity),
+		BasicConstraintsValid: true,
+		IsCA:                  request.IsCA,
+	}
+	// The common name is part of the alternative names, as clients ignore it when verifying the host
+	for _, host := range append([]string{request.CommonName}, request.AlternativeNames...) {
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	parent, signer := template, key
+	if request.IsCA {
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+		// The webhook server certificate also authenticates the replicas, see RequireClientCertificate
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+		if parent, signer, err = parseCA(request.CA); err != nil {
+			return Certificate{}, errors.Wrapf(err, "parsing the CA of %s", name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return Certificate{}, errors.Wrapf(err, "signing %s", name)
+	}
+
+	return Certificate{
+		IsCA:        request.IsCA,
+		Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}, nil
+}
+
+func parseCA(ca Certificate) (*x509.Certificate, *rsa.PrivateKey, error) {
+	if !ca.IsCA {
+		return nil, nil, errors.New("The signing certificate is not a CA")
+	}
+
+	certBlock, _ := pem.Decode(ca.Certificate)
+	if certBlock == nil {
+		return nil, nil, errors.New("No PEM data found in the CA certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parsing the CA certificate")
+	}
+
+	keyBlock, _ := pem.Decode(ca.PrivateKey)
+	if keyBlock == nil {
+		return nil, nil, errors.New("No PEM data found in the CA private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes); err == nil {
+		return cert, key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parsing the CA private key")
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("The CA private key is not an RSA key")
+	}
+	return cert, key, nil
+}
@@ -0,0 +1,66 @@
+package extension_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+
+	. "code.cloudfoundry.org/eirinix"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Credential generator", func() {
+	var generator CredentialGenerator
+
+	parse := func(c Certificate) *x509.Certificate {
+		block, _ := pem.Decode(c.Certificate)
+		Expect(block).ToNot(BeNil())
+		cert, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).ToNot(HaveOccurred())
+		return cert
+	}
+
+	BeforeEach(func() {
+		generator = NewCredentialGenerator()
+	})
+
+	It("generates a self-signed CA", func() {
+		ca, err := generator.GenerateCertificate("ca", CertificateRequest{CommonName: "SCF CA", IsCA: true, AlternativeNames: []string{"127.0.0.1"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ca.IsCA).To(BeTrue())
+		Expect(string(ca.PrivateKey)).To(ContainSubstring("RSA PRIVATE KEY"))
+
+		cert := parse(ca)
+		Expect(cert.IsCA).To(BeTrue())
+		Expect(cert.Subject.CommonName).To(Equal("SCF CA"))
+		Expect(cert.CheckSignatureFrom(cert)).To(Succeed())
+	})
+
+	It("generates a server certificate signed by the CA", func() {
+		ca, err := generator.GenerateCertificate("ca", CertificateRequest{CommonName: "SCF CA", IsCA: true})
+		Expect(err).ToNot(HaveOccurred())
+
+		leaf, err := generator.GenerateCertificate("cert", CertificateRequest{
+			CommonName:       "eirini-x.namespace.svc",
+			AlternativeNames: []string{"10.0.0.1"},
+			CA:               ca,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		cert := parse(leaf)
+		Expect(cert.IsCA).To(BeFalse())
+		Expect(cert.DNSNames).To(ConsistOf("eirini-x.namespace.svc"))
+		Expect(cert.IPAddresses).To(HaveLen(1))
+		Expect(cert.IPAddresses[0].String()).To(Equal("10.0.0.1"))
+
+		roots := x509.NewCertPool()
+		roots.AddCert(parse(ca))
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: "eirini-x.namespace.svc", Roots: roots})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("fails without a CA for a leaf certificate", func() {
+		_, err := generator.GenerateCertificate("cert", CertificateRequest{CommonName: "host"})
+		Expect(err).To(MatchError(ContainSubstring("not a CA")))
+	})
+})
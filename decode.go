@@ -0,0 +1,13 @@
+package extension
+
+// DecodeErrorPolicy is what the webhooks do with the admission requests whose pod can't be decoded
+type DecodeErrorPolicy string
+
+const (
+	// DecodeErrorPassThrough calls the extension with the pod as far as it was decoded
+	DecodeErrorPassThrough DecodeErrorPolicy = "pass-through"
+	// DecodeErrorAllow admits the pod unchanged, without calling the extension
+	DecodeErrorAllow DecodeErrorPolicy = "allow"
+	// DecodeErrorDeny rejects the pod, without calling the extension
+	DecodeErrorDeny DecodeErrorPolicy = "deny"
+)
@@ -0,0 +1,149 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Pod decoding", func() {
+	var (
+		w   *DefaultMutatingWebhook
+		req admission.Request
+	)
+
+	newWebhook := func(opts ManagerOptions) *DefaultMutatingWebhook {
+		failurePolicy := admissionregistrationv1beta1.Fail
+		opts.FailurePolicy = &failurePolicy
+		c := catalog.NewCatalog()
+		w := NewWebhook(&catalog.EditEnvExtension{}, c.SimpleManager()).(*DefaultMutatingWebhook)
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: "decode", ManagerOptions: opts})).To(Succeed())
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+		return w
+	}
+
+	BeforeEach(func() {
+		review := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(reviewBody(), &review)).To(Succeed())
+		var pod map[string]interface{}
+		Expect(json.Unmarshal(review.Request.Object.Raw, &pod)).To(Succeed())
+		pod["spec"].(map[string]interface{})["newField"] = true
+		raw, err := json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+		review.Request.Object.Raw = raw
+		req = admission.Request{AdmissionRequest: *review.Request}
+	})
+
+	It("ignores unknown fields by default", func() {
+		w = newWebhook(ManagerOptions{})
+		pod, err := w.GetPod(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pod.Name).To(Equal("app-0"))
+		Expect(w.Handle(context.Background(), req).Allowed).To(BeTrue())
+	})
+
+	It("fails on unknown fields when strict", func() {
+		w = newWebhook(ManagerOptions{StrictDecoding: true})
+		_, err := w.GetPod(req)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("newField"))
+	})
+
+	It("admits the pod unchanged with the allow policy", func() {
+		w = newWebhook(ManagerOptions{StrictDecoding: true, DecodeErrorPolicy: DecodeErrorAllow})
+		res := w.Handle(context.Background(), req)
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Patches).To(BeEmpty())
+	})
+
+	It("rejects the pod with the deny policy", func() {
+		w = newWebhook(ManagerOptions{StrictDecoding: true, DecodeErrorPolicy: DecodeErrorDeny})
+		res := w.Handle(context.Background(), req)
+		Expect(res.Allowed).To(BeFalse())
+		Expect(res.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+	})
+
+	It("rejects unknown policies", func() {
+		opts := ManagerOptions{DecodeErrorPolicy: "retry"}
+		Expect(opts.Validate()).To(MatchError(ContainSubstring("decodeErrorPolicy")))
+	})
+
+	Context("when the extension can't be passed a pod", func() {
+		var ext *bindingObserver
+
+		handle := func(req admission.Request, decoder bool) admission.Response {
+			failurePolicy := admissionregistrationv1beta1.Fail
+			c := catalog.NewCatalog()
+			w := NewWebhook(ext, c.SimpleManager())
+			Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+				ID:             "nonpods",
+				ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy},
+			})).To(Succeed())
+			if decoder {
+				injectDecoder(w)
+			}
+			return w.Handle(context.Background(), req)
+		}
+
+		BeforeEach(func() {
+			ext = &bindingObserver{}
+		})
+
+		It("admits the requests whose object is not a pod unchanged", func() {
+			req.Kind = metav1.GroupVersionKind{Version: "v1", Kind: "Binding"}
+			res := handle(req, true)
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Result.Reason).To(BeEquivalentTo("the request object is not a pod"))
+			Expect(ext.pods).To(BeEmpty())
+		})
+
+		It("admits the requests without object unchanged", func() {
+			req.Operation = admissionv1beta1.Delete
+			req.Object.Raw = nil
+			res := handle(req, true)
+			Expect(res.Allowed).To(BeTrue())
+			Expect(res.Result.Reason).To(BeEquivalentTo("the request has no pod"))
+			Expect(ext.pods).To(BeEmpty())
+		})
+
+		It("admits the pods which can't be decoded at all unchanged", func() {
+			res := handle(req, false)
+			Expect(res.Allowed).To(BeTrue())
+			Expect(ext.pods).To(BeEmpty())
+		})
+
+		It("passes the malformed pods as far as they could be decoded", func() {
+			for _, raw := range []string{`{"metadata": {"name": "app-0"}, "spec": []}`, `[]`, `{`} {
+				req.Object.Raw = []byte(raw)
+				Expect(handle(req, true).Allowed).To(BeTrue())
+			}
+			Expect(ext.pods).To(HaveLen(3))
+			for _, pod := range ext.pods {
+				Expect(pod).ToNot(BeNil())
+			}
+		})
+
+		It("calls the extensions handling the non-pods with no pod", func() {
+			ext.nonPods = true
+			req.Kind = metav1.GroupVersionKind{Version: "v1", Kind: "Binding"}
+			handle(req, true)
+			req.Kind = metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}
+			handle(req, false)
+			Expect(ext.pods).To(Equal([]*corev1.Pod{nil, nil}))
+		})
+	})
+})
@@ -0,0 +1,190 @@
+package extension
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Capabilities provided by the Manager options, which extensions can require
+const (
+	// CapabilityCacheWarmup is provided when ManagerOptions.PrewarmCache is set, with namespaces, secrets
+	// and statefulsets listed into the cache before the Manager reports ready
+	CapabilityCacheWarmup = "cache-warmup"
+	// CapabilityStatusServer is provided when ManagerOptions.StatusBindAddress is set
+	CapabilityStatusServer = "status-server"
+	// CapabilityMetricsServer is provided when ManagerOptions.MetricsBindAddress is set
+	CapabilityMetricsServer = "metrics-server"
+	// CapabilityCABundle is provided when ManagerOptions.PublishCABundle is set
+	CapabilityCABundle = "ca-bundle"
+	// CapabilityWebhookService is provided when the Manager reconciles the webhook service, see ManagerOptions.Service
+	CapabilityWebhookService = "webhook-service"
+	// CapabilityHandover is provided when ManagerOptions.Handover is set
+	CapabilityHandover = "handover"
+)
+
+// DependentExtension can be implemented by Extensions, Watchers and Reconcilers depending on other extensions
+// or on capabilities, e.g. "sidecar-injector" or CapabilityCacheWarmup. The Manager fails to start if a
+// requirement is missing, and registers the extensions after the ones they depend on, so that the webhooks
+// of the required extensions mutate the pods first.
+type DependentExtension interface {
+	// Requires returns the capabilities the extension depends on
+	Requires() []string
+}
+
+// ProvidingExtension can be implemented by extensions to provide capabilities to the others. Every extension
+// also provides its type (e.g. "*sidecar.Extension"), the name it declares if it is a NamedExtension or a
+// DescribedExtension and, if it is a ConfigurableExtension, its ConfigKey.
+type ProvidingExtension interface {
+	// Provides returns the capabilities of the extension
+	Provides() []string
+}
+
+// optionCapabilities returns the capabilities provided by the Manager options
+func (o *ManagerOptions) optionCapabilities() map[string]bool {
+	return map[string]bool{
+		CapabilityCacheWarmup:    o.PrewarmCache,
+		CapabilityStatusServer:   o.StatusBindAddress != "" && o.StatusBindAddress != "0",
+		CapabilityMetricsServer:  o.MetricsBindAddress != "" && o.MetricsBindAddress != "0",
+		CapabilityCABundle:       o.PublishCABundle,
+		CapabilityWebhookService: o.ServiceName != "" && o.Service != nil,
+		CapabilityHandover:       o.Handover != nil,
+	}
+}
+
+// providedCapabilities returns the capabilities of an extension
+func providedCapabilities(e interface{}) []string {
+	capabilities := []string{fmt.Sprintf("%T", e)}
+	if name, ok := declaredName(e); ok {
+		capabilities = append(capabilities, name)
+	}
+	if c, ok := e.(ConfigurableExtension); ok {
+		capabilities = append(capabilities, c.ConfigKey())
+	}
+	if p, ok := e.(ProvidingExtension); ok {
+		capabilities = append(capabilities, p.Provides()...)
+	}
+	return capabilities
+}
+
+// requirements returns the capabilities an extension depends on, see DependentExtension and DescribedExtension
+func requirements(e interface{}) []string {
+	var required []string
+	if d, ok := e.(DependentExtension); ok {
+		required = append(required, d.Requires()...)
+	}
+	if d, ok := e.(DescribedExtension); ok {
+		required = append(required, d.Metadata().Requires...)
+	}
+	return required
+}
+
+// orderExtensions checks the requirements of the extensions, and sorts the Extensions, Watchers and
+// Reconcilers so that each comes after the ones it depends on. The order is otherwise the one they were
+// added in.
+func (m *DefaultExtensionManager) orderExtensions() error {
+	if m.extensionsOrdered {
+		return nil
+	}
+	all := m.allExtensions()
+
+	providers := map[string][]int{}
+	for i, e := range all {
+		for _, c := range providedCapabilities(e) {
+			providers[c] = append(providers[c], i)
+		}
+	}
+
+	options := m.Options.optionCapabilities()
+	dependencies := make([][]int, len(all))
+	var missing []string
+	for i, e := range all {
+		for _, required := range requirements(e) {
+			if p, ok := providers[required]; ok {
+				for _, j := range p {
+					if j != i {
+						dependencies[i] = append(dependencies[i], j)
+					}
+				}
+				continue
+			}
+			if !options[required] {
+				missing = append(missing, fmt.Sprintf("%s requires %q", extensionName(e), required))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("Missing extension dependencies: %s", strings.Join(missing, ", "))
+	}
+
+	order, err := dependencyOrder(all, dependencies)
+	if err != nil {
+		return err
+	}
+
+	// allExtensions lists the Extensions, then the Watchers, then the Reconcilers
+	extensions, watchers, reconcilers := m.Extensions, m.Watchers, m.Reconcilers
+	m.Extensions, m.Watchers, m.Reconcilers = nil, nil, nil
+	for _, i := range order {
+		switch {
+		case i < len(extensions):
+			m.Extensions = append(m.Extensions, extensions[i])
+		case i < len(extensions)+len(watchers):
+			m.Watchers = append(m.Watchers, watchers[i-len(extensions)])
+		default:
+			m.Reconcilers = append(m.Reconcilers, reconcilers[i-len(extensions)-len(watchers)])
+		}
+	}
+	m.extensionsOrdered = true
+	return nil
+}
+
+// dependencyOrder returns the indexes of the extensions with the dependencies first, and an error
+// naming the extensions of a dependency cycle
+func dependencyOrder(all []interface{}, dependencies [][]int) ([]int, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(all))
+	order := make([]int, 0, len(all))
+	var path []int
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			var names []string
+			for k := len(path) - 1; k >= 0; k-- {
+				names = append([]string{extensionName(all[path[k]])}, names...)
+				if path[k] == i {
+					break
+				}
+			}
+			return errors.Errorf("Dependency cycle between the extensions: %s -> %s", strings.Join(names, " -> "), extensionName(all[i]))
+		}
+
+		state[i] = visiting
+		path = append(path, i)
+		for _, j := range dependencies[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		order = append(order, i)
+		return nil
+	}
+
+	for i := range all {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,98 @@
+package extension_test
+
+import (
+	"context"
+
+	. "code.cloudfoundry.org/eirinix"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type dependentExtension struct {
+	name     string
+	requires []string
+	provides []string
+}
+
+func (e *dependentExtension) Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response {
+	return admission.Allowed("")
+}
+
+func (e *dependentExtension) Requires() []string { return e.requires }
+
+func (e *dependentExtension) Provides() []string { return append([]string{e.name}, e.provides...) }
+
+type dependentReconciler struct {
+	provides []string
+}
+
+func (r *dependentReconciler) Provides() []string { return r.provides }
+
+func (r *dependentReconciler) Reconcile(reconcile.Request) (reconcile.Result, error) {
+	return reconcile.Result{}, nil
+}
+
+func (r *dependentReconciler) Register(Manager) error { return nil }
+
+var _ = Describe("Extension dependencies", func() {
+	var m Manager
+
+	BeforeEach(func() {
+		var err error
+		m, err = NewManager(ManagerOptions{Namespace: "eirini", KubeConfig: "/nonexistent/kubeconfig"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	names := func(extensions []Extension) []string {
+		var names []string
+		for _, e := range extensions {
+			names = append(names, e.(*dependentExtension).name)
+		}
+		return names
+	}
+
+	It("registers the extensions after their dependencies", func() {
+		Expect(m.AddExtension(&dependentExtension{name: "env", requires: []string{"sidecar-injector"}})).To(Succeed())
+		Expect(m.AddExtension(&dependentExtension{name: "volumes"})).To(Succeed())
+		Expect(m.AddExtension(&dependentExtension{name: "sidecar-injector", requires: []string{"secrets"}})).To(Succeed())
+		Expect(m.AddExtension(&dependentReconciler{provides: []string{"secrets"}})).To(Succeed())
+
+		err := m.Start()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).ToNot(ContainSubstring("dependencies"))
+		Expect(names(m.ListExtensions())).To(Equal([]string{"sidecar-injector", "env", "volumes"}))
+		Expect(m.ListReconcilers()).To(HaveLen(1))
+	})
+
+	It("accepts the capabilities of the options", func() {
+		m, err := NewManager(ManagerOptions{Namespace: "eirini", KubeConfig: "/nonexistent/kubeconfig", PrewarmCache: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.AddExtension(&dependentExtension{name: "secrets-reader", requires: []string{CapabilityCacheWarmup}})).To(Succeed())
+
+		err = m.Start()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).ToNot(ContainSubstring("dependencies"))
+	})
+
+	It("fails to start with missing dependencies", func() {
+		Expect(m.AddExtension(&dependentExtension{name: "env", requires: []string{"sidecar-injector", CapabilityCacheWarmup}})).To(Succeed())
+
+		err := m.Start()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`Missing extension dependencies`))
+		Expect(err.Error()).To(ContainSubstring(`requires "sidecar-injector"`))
+		Expect(err.Error()).To(ContainSubstring(`requires "cache-warmup"`))
+	})
+
+	It("fails to start with a dependency cycle", func() {
+		Expect(m.AddExtension(&dependentExtension{name: "a", requires: []string{"b"}})).To(Succeed())
+		Expect(m.AddExtension(&dependentExtension{name: "b", requires: []string{"a"}})).To(Succeed())
+
+		err := m.Start()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Dependency cycle between the extensions"))
+	})
+})
@@ -0,0 +1,56 @@
+package extension
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDrainTimeout is the time the webhook server waits for the in-flight admission requests when stopping,
+// when ManagerOptions.DrainTimeout is omitted. It fits in the default termination grace period of the pods.
+const DefaultDrainTimeout = 25 * time.Second
+
+// DrainingHandler counts the requests being served by next, so that a server can be shut down gracefully:
+// Drain stops accepting connections, lets the in-flight requests finish until a deadline, and then closes
+// the connections left, reporting the requests it dropped.
+type DrainingHandler struct {
+	next     http.Handler
+	inFlight int64
+}
+
+// NewDrainingHandler returns a DrainingHandler serving the requests with next
+func NewDrainingHandler(next http.Handler) *DrainingHandler {
+	return &DrainingHandler{next: next}
+}
+
+// ServeHTTP serves the request with the next handler, counting it as in-flight until it returns
+func (h *DrainingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&h.inFlight, 1)
+	defer atomic.AddInt64(&h.inFlight, -1)
+	h.next.ServeHTTP(w, r)
+}
+
+// InFlight returns the number of requests being served
+func (h *DrainingHandler) InFlight() int {
+	return int(atomic.LoadInt64(&h.inFlight))
+}
+
+// Drain shuts the server serving the handler down. The server stops accepting connections and closes the idle
+// keep-alive ones, asking the HTTP/2 clients to go away, then waits up to timeout for the in-flight requests.
+// The connections still open after the timeout are closed, and the number of requests dropped is returned
+// together with the shutdown error.
+func (h *DrainingHandler) Drain(srv *http.Server, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err == nil {
+		return 0, nil
+	}
+	dropped := h.InFlight()
+	if closeErr := srv.Close(); closeErr != nil {
+		return dropped, closeErr
+	}
+	return dropped, err
+}
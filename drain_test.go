@@ -0,0 +1,74 @@
+package extension_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Draining", func() {
+	var (
+		release  chan struct{}
+		draining *DrainingHandler
+		server   *httptest.Server
+	)
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+		draining = NewDrainingHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusOK)
+		}))
+		server = httptest.NewServer(draining)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	request := func() chan error {
+		done := make(chan error, 1)
+		go func() {
+			resp, err := http.Post(server.URL, "application/json", nil)
+			if err == nil {
+				resp.Body.Close()
+			}
+			done <- err
+		}()
+		return done
+	}
+
+	It("finishes the in-flight requests", func() {
+		done := request()
+		Eventually(draining.InFlight).Should(Equal(1))
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+		}()
+		dropped, err := draining.Drain(server.Config, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dropped).To(Equal(0))
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("drops the requests still running after the timeout", func() {
+		defer close(release)
+		done := request()
+		Eventually(draining.InFlight).Should(Equal(1))
+
+		dropped, err := draining.Drain(server.Config, 50*time.Millisecond)
+		Expect(err).To(HaveOccurred())
+		Expect(dropped).To(Equal(1))
+		Eventually(done).Should(Receive(HaveOccurred()))
+	})
+
+	It("rejects a negative drain timeout", func() {
+		opts := ManagerOptions{Namespace: "eirini", Host: "127.0.0.1", Port: 4545, DrainTimeout: -time.Second}
+		Expect(opts.Validate()).To(MatchError(ContainSubstring("drainTimeout")))
+	})
+})
@@ -0,0 +1,108 @@
+package extension
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AllTopics can be used to subscribe to all the events published on the EventBus
+const AllTopics = "*"
+
+const eventBusBufferSize = 128
+
+// Event is a domain event published by an extension or a watcher, e.g. "app first seen"
+// or "sidecar injected"
+type Event struct {
+	// Topic identifies the kind of event
+	Topic string
+	// Source is the name of the publisher. Optional
+	Source string
+	// Payload is the event data, its type is agreed between publishers and subscribers of the topic
+	Payload interface{}
+	// Time is the time the event was published, set by the bus if empty
+	Time time.Time
+}
+
+// EventHandler is called with the events of the topics it subscribed to
+type EventHandler func(Event)
+
+// EventBus is a lightweight in-process publish/subscribe bus, used by extensions and watchers
+// of the same operator to react to each other's events without polling.
+//
+// Publishing never blocks: each subscriber has its own buffered queue, processed in order by a
+// dedicated goroutine, and events are dropped for subscribers whose queue is full.
+type EventBus struct {
+	logger *zap.SugaredLogger
+
+	mu            sync.RWMutex
+	subscriptions map[string]map[*subscription]struct{}
+}
+
+type subscription struct {
+	events  chan Event
+	handler EventHandler
+}
+
+// NewEventBus returns an empty EventBus
+func NewEventBus(logger *zap.SugaredLogger) *EventBus {
+	return &EventBus{
+		logger:        logger,
+		subscriptions: map[string]map[*subscription]struct{}{},
+	}
+}
+
+// Subscribe registers the handler for the events of the topic, or of all topics with AllTopics.
+// It returns a function that cancels the subscription.
+func (b *EventBus) Subscribe(topic string, handler EventHandler) func() {
+	s := &subscription{
+		events:  make(chan Event, eventBusBufferSize),
+		handler: handler,
+	}
+
+	b.mu.Lock()
+	if b.subscriptions[topic] == nil {
+		b.subscriptions[topic] = map[*subscription]struct{}{}
+	}
+	b.subscriptions[topic][s] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		for e := range s.events {
+			s.handler(e)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscriptions[topic], s)
+			b.mu.Unlock()
+			close(s.events)
+		})
+	}
+}
+
+// Publish delivers the event to the subscribers of its topic
+func (b *EventBus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, topic := range []string{e.Topic, AllTopics} {
+		for s := range b.subscriptions[topic] {
+			select {
+			case s.events <- e:
+			default:
+				if b.logger != nil {
+					b.logger.Warnf("Dropping event %s from %s: subscriber queue is full", e.Topic, e.Source)
+				}
+			}
+		}
+	}
+}
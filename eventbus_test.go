@@ -0,0 +1,54 @@
+package extension_test
+
+import (
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Event bus", func() {
+	var bus *EventBus
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		bus = c.SimpleManager().Events()
+	})
+
+	It("delivers the events of a topic in order", func() {
+		received := make(chan Event, 10)
+		unsubscribe := bus.Subscribe("app-seen", func(e Event) { received <- e })
+		defer unsubscribe()
+
+		bus.Publish(Event{Topic: "app-seen", Payload: "first"})
+		bus.Publish(Event{Topic: "other", Payload: "ignored"})
+		bus.Publish(Event{Topic: "app-seen", Payload: "second"})
+
+		var e Event
+		Eventually(received).Should(Receive(&e))
+		Expect(e.Payload).To(Equal("first"))
+		Expect(e.Time.IsZero()).To(BeFalse())
+		Eventually(received).Should(Receive(&e))
+		Expect(e.Payload).To(Equal("second"))
+		Consistently(received).ShouldNot(Receive())
+	})
+
+	It("delivers all the events to AllTopics subscribers", func() {
+		received := make(chan Event, 10)
+		defer bus.Subscribe(AllTopics, func(e Event) { received <- e })()
+
+		bus.Publish(Event{Topic: "a"})
+		bus.Publish(Event{Topic: "b"})
+		Eventually(received).Should(HaveLen(2))
+	})
+
+	It("stops delivering events after unsubscribing", func() {
+		received := make(chan Event, 10)
+		unsubscribe := bus.Subscribe("a", func(e Event) { received <- e })
+		unsubscribe()
+		unsubscribe()
+
+		bus.Publish(Event{Topic: "a"})
+		Consistently(received).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,79 @@
+package extension
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// traceParentHeader is the W3C trace context header, sent by the API servers with tracing enabled
+	traceParentHeader = "traceparent"
+	// exemplarTraceIDLabel is the exemplar label holding the trace ID, as expected by Grafana
+	exemplarTraceIDLabel = "trace_id"
+	// exemplarMetricsPath is the path of the metrics served with their exemplars by the status server
+	exemplarMetricsPath = "/metrics"
+)
+
+type traceIDKey struct{}
+
+// ContextWithTraceID returns a context carrying the trace ID of the admission request, which is attached as an
+// exemplar to the latency metrics of the extensions. The Manager webhook server sets it from the traceparent
+// header when ManagerOptions.Exemplars is set.
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceIDFromContext returns the trace ID of the admission request, or an empty string
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
+
+// parseTraceParent returns the trace ID of a W3C traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceParent(header string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", false
+	}
+	traceID := parts[1]
+	if strings.Trim(traceID, "0") == "" || strings.Trim(traceID, "0123456789abcdef") != "" {
+		return "", false
+	}
+	return traceID, true
+}
+
+// traceIDHandler stores the trace ID of the traced requests in their context
+func traceIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if traceID, ok := parseTraceParent(r.Header.Get(traceParentHeader)); ok {
+			r = r.WithContext(ContextWithTraceID(r.Context(), traceID))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// observeDuration observes the duration, with the trace ID of the context as exemplar if there is one
+func observeDuration(ctx context.Context, o prometheus.Observer, seconds float64) {
+	if traceID := TraceIDFromContext(ctx); traceID != "" {
+		if e, ok := o.(prometheus.ExemplarObserver); ok {
+			e.ObserveWithExemplar(seconds, prometheus.Labels{exemplarTraceIDLabel: traceID})
+			return
+		}
+	}
+	o.Observe(seconds)
+}
+
+// exemplarMetricsHandler serves the metrics of the controller-runtime registry in the OpenMetrics format,
+// the only one carrying the exemplars
+func exemplarMetricsHandler() http.Handler {
+	return promhttp.HandlerFor(crmetrics.Registry, promhttp.HandlerOpts{
+		ErrorHandling:     promhttp.HTTPErrorOnError,
+		EnableOpenMetrics: true,
+	})
+}
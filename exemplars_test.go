@@ -0,0 +1,54 @@
+package extension_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exemplars", func() {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	metrics := func(eiriniManager *DefaultExtensionManager) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+		rec := httptest.NewRecorder()
+		eiriniManager.StatusHandler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("attaches the trace ID of the request to the latency", func() {
+		ctx := ContextWithTraceID(context.Background(), traceID)
+		Expect(TraceIDFromContext(ctx)).To(Equal(traceID))
+
+		req := httptest.NewRequest(http.MethodPost, "/review", bytes.NewReader(reviewBody())).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		AdmissionReviewHandler(newReviewWebhook(false)).ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		c := catalog.NewCatalog()
+		eiriniManager := c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Options.Exemplars = true
+		rec = metrics(eiriniManager)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring(`eirinix_admission_duration_seconds_bucket`))
+		Expect(rec.Body.String()).To(ContainSubstring(`trace_id="` + traceID + `"`))
+	})
+
+	It("serves the metrics only with exemplars enabled", func() {
+		c := catalog.NewCatalog()
+		eiriniManager := c.SimpleManager().(*DefaultExtensionManager)
+		Expect(metrics(eiriniManager).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("has no trace ID for untraced requests", func() {
+		Expect(TraceIDFromContext(context.Background())).To(BeEmpty())
+	})
+})
@@ -0,0 +1,23 @@
+package extension
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// NewHandoverForTest returns the Start function and the preStop hook of the handover of a replica, which
+// serves the admission requests right away
+func NewHandoverForTest(opts HandoverOptions, leases coordinationv1client.LeaseInterface) (func(<-chan struct{}) error, http.HandlerFunc) {
+	opts.setDefaults("eirini-x-handover")
+	h := &handover{
+		opts:      opts,
+		namespace: "eirini",
+		leases:    leases,
+		logger:    zap.NewNop().Sugar(),
+		check:     func(context.Context) error { return nil },
+	}
+	return h.Start, h.preStopHandler
+}
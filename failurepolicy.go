@@ -0,0 +1,56 @@
+package extension
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+)
+
+// SetFailurePolicy changes the failure policy of the webhooks of an extension, in the live webhook
+// configuration and in the one the Manager registers next, so that runbooks can flip a misbehaving
+// extension to Ignore during an incident without redeploying. The extension is identified by its name,
+// e.g. "*volume.Extension", or by the name of its webhook. The policy of the extension (see PolicyExtension)
+// or of the ManagerOptions is restored when the operator restarts.
+func (m *DefaultExtensionManager) SetFailurePolicy(extension string, policy admissionregistrationv1beta1.FailurePolicyType) error {
+	switch policy {
+	case admissionregistrationv1beta1.Fail, admissionregistrationv1beta1.Ignore:
+	default:
+		return errors.Errorf("Unsupported failure policy %q, must be %s or %s", policy, admissionregistrationv1beta1.Fail, admissionregistrationv1beta1.Ignore)
+	}
+
+	m.failurePolicyMu.Lock()
+	defer m.failurePolicyMu.Unlock()
+
+	ctx := m.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	found := false
+	for _, g := range m.groups {
+		// The webhooks are indexed in their mutating or validating configuration
+		mutating, validating := splitWebhooks(g.webhooks)
+		for _, webhooks := range [][]MutatingWebhook{mutating, validating} {
+			for i, w := range webhooks {
+				dw, ok := w.(*DefaultMutatingWebhook)
+				if !ok || (extensionName(dw.EiriniExtension) != extension && dw.GetName() != extension) {
+					continue
+				}
+				found = true
+				dw.FailurePolicy = policy
+
+				if m.webhooksConfigured {
+					if err := g.config.patchFailurePolicy(ctx, dw.Validating, i, dw.GetName(), policy); err != nil {
+						return errors.Wrapf(err, "setting the failure policy of %s", dw.GetName())
+					}
+				}
+				m.Logger.Infof("Failure policy of the webhook %s of %s set to %s", dw.GetName(), extension, policy)
+			}
+		}
+	}
+	if !found {
+		return errors.Errorf("No webhook registered for the extension %s", extension)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package extension
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// AnnotationConfigGeneration is the audit annotation recording the config generation an admission request
+// was handled with
+const AnnotationConfigGeneration = "eirinix.cloudfoundry.org/config-generation"
+
+// ConfigChangeHook is run with the new config generation when the configuration of the extensions changes.
+// Extensions caching admission decisions or idempotency keys register one to flush them, so that the new
+// settings take effect immediately.
+type ConfigChangeHook func(generation int64)
+
+// OnConfigChange registers a hook run after each Reconfigure or InvalidateCaches
+func (m *DefaultExtensionManager) OnConfigChange(hook ConfigChangeHook) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	m.configHooks = append(m.configHooks, hook)
+}
+
+// ConfigGeneration returns the config generation, starting at 0 and bumped on every configuration change
+func (m *DefaultExtensionManager) ConfigGeneration() int64 {
+	return atomic.LoadInt64(&m.configGeneration)
+}
+
+// InvalidateCaches bumps the config generation and runs the ConfigChangeHooks. It is called by Reconfigure,
+// and can be called by the extensions reading their settings from another source when those change.
+func (m *DefaultExtensionManager) InvalidateCaches() {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	generation := atomic.AddInt64(&m.configGeneration, 1)
+	for _, hook := range m.configHooks {
+		hook(generation)
+	}
+	m.Logger.Infof("Configuration changed, now at generation %d", generation)
+}
+
+// annotateGeneration records the config generation in the audit annotations of the response
+func annotateGeneration(res *admission.Response, generation int64) {
+	if res.AuditAnnotations == nil {
+		res.AuditAnnotations = map[string]string{}
+	}
+	res.AuditAnnotations[AnnotationConfigGeneration] = strconv.FormatInt(generation, 10)
+}
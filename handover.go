@@ -0,0 +1,431 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	handoverPreStopPath = "/prestop"
+	// handoverCheckUID is the UID of the dry-run admission request of the self check
+	handoverCheckUID = "eirinix-handover-check"
+
+	handoverCheckInterval = time.Second
+)
+
+var errAdmissionNotVerified = errors.New("The admission server is not verified yet")
+
+// HandoverOptions configures the handover between the replicas of the operator during upgrades, so
+// that fail-closed webhooks never go unserved: a new replica reports ready only once it verified that
+// it serves admission requests, and then takes the handover Lease. The preStop hook of the old replica
+// releases the Lease and blocks until another replica took it over.
+//
+// The endpoints are served by the status server, so StatusBindAddress is required.
+type HandoverOptions struct {
+	// LeaseName is the name of the Lease coordinating the handover. Optional, defaults to the NamedHandoverLease
+	// name of the NamingStrategy, <OperatorFingerprint>-handover
+	LeaseName string
+
+	// Identity identifies the replica in the Lease. Optional, defaults to the POD_NAME environment variable or the hostname
+	Identity string
+
+	// PreStopTimeout is the maximum time the preStop hook waits for another replica to take over,
+	// e.g. when scaling down. Optional, defaults to 60 seconds
+	PreStopTimeout time.Duration
+
+	// PreStopDelay is the time the preStop hook waits after the handover, so that the service endpoints
+	// stop routing to the old replica. Optional, defaults to 5 seconds
+	PreStopDelay time.Duration
+}
+
+func (o *HandoverOptions) setDefaults(leaseName string) {
+	if o.LeaseName == "" {
+		o.LeaseName = leaseName
+	}
+	if o.Identity == "" {
+		o.Identity = os.Getenv("POD_NAME")
+	}
+	if o.Identity == "" {
+		o.Identity, _ = os.Hostname()
+	}
+	if o.PreStopTimeout == 0 {
+		o.PreStopTimeout = 60 * time.Second
+	}
+	if o.PreStopDelay == 0 {
+		o.PreStopDelay = 5 * time.Second
+	}
+}
+
+// HandoverProbes returns the readiness probe and the preStop hook to set on the operator container,
+// given the port of StatusBindAddress. The pod terminationGracePeriodSeconds must be greater than
+// PreStopTimeout plus PreStopDelay.
+func HandoverProbes(statusPort int) (*corev1.Probe, *corev1.Lifecycle) {
+	readiness := &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{Path: readyPath, Port: intstr.FromInt(statusPort)},
+		},
+		PeriodSeconds: 2,
+	}
+	lifecycle := &corev1.Lifecycle{
+		PreStop: &corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{Path: handoverPreStopPath, Port: intstr.FromInt(statusPort)},
+		},
+	}
+	return readiness, lifecycle
+}
+
+// handover verifies that the replica serves admission requests, then takes the handover Lease
+type handover struct {
+	opts      HandoverOptions
+	namespace string
+	leases    coordinationv1client.LeaseInterface
+	logger    *zap.SugaredLogger
+
+	// check verifies that the admission server answers
+	check func(ctx context.Context) error
+
+	mu    sync.RWMutex
+	ready bool
+	// stopping is set once the preStop hook is called, the replica doesn't take the Lease anymore
+	stopping bool
+}
+
+func (m *DefaultExtensionManager) newHandover(webhooks []MutatingWebhook) (*handover, error) {
+	opts := *m.Options.Handover
+	opts.setDefaults(m.Options.resourceName(NamedHandoverLease, ""))
+
+	namespace := m.Options.WebhookNamespace
+	if namespace == "" {
+		namespace = m.Options.Namespace
+	}
+
+	kubeConn, err := m.GetKubeConnection()
+	if err != nil {
+		return nil, err
+	}
+	leases, err := coordinationv1client.NewForConfig(kubeConn)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating the coordination client")
+	}
+
+	path := ""
+	if len(webhooks) > 0 {
+		path = webhooks[0].GetPath()
+	}
+
+	clientCertDir := ""
+	if m.Options.RequireClientCertificate != nil {
+		clientCertDir = m.WebhookServer.CertDir
+	}
+	check := admissionSelfCheck(m.Options.Host, int(m.Options.Port), path, clientCertDir)
+	if warmer := m.cacheWarmer; warmer != nil {
+		// The replica takes over only once it can serve the admission requests without cold cache misses
+		selfCheck := check
+		check = func(ctx context.Context) error {
+			if !warmer.isWarm() {
+				return errCacheNotWarm
+			}
+			return selfCheck(ctx)
+		}
+	}
+
+	return &handover{
+		opts:      opts,
+		namespace: namespace,
+		leases:    leases.Leases(namespace),
+		logger:    m.Logger,
+		check:     check,
+	}, nil
+}
+
+// admissionSelfCheck returns a check sending a dry-run admission review to the local webhook server, which
+// the webhooks answer without calling the extensions, see handoverCheck.
+// The certificate is not verified: the check is only about the server answering admission requests.
+// With a clientCertDir, the check presents the webhook server certificate of the directory as client
+// certificate, see RequireClientCertificate.
+func admissionSelfCheck(host string, port int, path, clientCertDir string) func(ctx context.Context) error {
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	url := fmt.Sprintf("https://%s%s", net.JoinHostPort(host, strconv.Itoa(port)), path)
+	config := &tls.Config{InsecureSkipVerify: true} // nolint:gosec
+	if clientCertDir != "" {
+		// The certificate is read for every connection, as it may be renewed
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(filepath.Join(clientCertDir, "tls.crt"), filepath.Join(clientCertDir, "tls.key"))
+			if err != nil {
+				return nil, errors.Wrap(err, "loading the client certificate of the admission self check")
+			}
+			return &cert, nil
+		}
+	}
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: config},
+		Timeout:   5 * time.Second,
+	}
+
+	return func(ctx context.Context) error {
+		dryRun := true
+		uid := types.UID(handoverCheckUID)
+		pod, err := json.Marshal(&corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: handoverCheckUID},
+		})
+		if err != nil {
+			return err
+		}
+		review := admissionv1beta1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1beta1", Kind: "AdmissionReview"},
+			Request: &admissionv1beta1.AdmissionRequest{
+				UID:       uid,
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+				Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+				Operation: admissionv1beta1.Create,
+				DryRun:    &dryRun,
+			},
+		}
+		review.Request.Object.Raw = pod
+		body, err := json.Marshal(review)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		res, err := client.Do(req)
+		if err != nil {
+			return errors.Wrap(err, "sending the admission self check")
+		}
+		defer res.Body.Close()
+
+		if path == "" {
+			// No webhook registered: the TLS server answering is all we can check
+			return nil
+		}
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("admission self check returned status %d", res.StatusCode)
+		}
+		response := admissionv1beta1.AdmissionReview{}
+		if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+			return errors.Wrap(err, "decoding the admission self check response")
+		}
+		if response.Response == nil || response.Response.UID != uid {
+			return errors.New("Admission self check returned an invalid response")
+		}
+		return nil
+	}
+}
+
+// handoverCheck admits the dry-run request of the admission self check without calling the extension, as it
+// only checks that the webhook server answers. It returns false for the other requests.
+func (w *DefaultMutatingWebhook) handoverCheck(req admission.Request) (admission.Response, bool) {
+	if req.UID != handoverCheckUID || req.DryRun == nil || !*req.DryRun {
+		return admission.Response{}, false
+	}
+	return admission.Allowed(""), true
+}
+
+// NeedLeaderElection makes every replica take part in the handover
+func (h *handover) NeedLeaderElection() bool {
+	return false
+}
+
+// Start waits for the admission server to answer, then marks the replica ready and takes the Lease
+func (h *handover) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(handoverCheckInterval)
+	defer ticker.Stop()
+	for {
+		err := h.check(ctx)
+		if err == nil {
+			break
+		}
+		h.logger.Debugf("Admission self check failed: %s", err.Error())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	h.mu.Lock()
+	h.ready = true
+	h.mu.Unlock()
+	h.logger.Infof("Admission self check succeeded, taking over lease %s/%s as %s", h.namespace, h.opts.LeaseName, h.opts.Identity)
+
+	if !h.isStopping() {
+		if err := h.acquire(ctx); err != nil {
+			return errors.Wrap(err, "taking over the handover lease")
+		}
+	}
+
+	// The Lease is taken again when a stopping replica releases it
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if h.isStopping() {
+			continue
+		}
+		if err := h.acquireReleased(ctx); err != nil {
+			h.logger.Debugf("Failed taking over the released handover lease: %s", err.Error())
+		}
+	}
+}
+
+func (h *handover) acquire(ctx context.Context) error {
+	now := metav1.NewMicroTime(time.Now())
+	identity := h.opts.Identity
+
+	lease, err := h.leases.Get(ctx, h.opts.LeaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = h.leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: h.opts.LeaseName, Namespace: h.namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity: &identity,
+				AcquireTime:    &now,
+				RenewTime:      &now,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != identity {
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.RenewTime = &now
+	_, err = h.leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// acquireReleased takes the Lease if no replica holds it
+func (h *handover) acquireReleased(ctx context.Context) error {
+	lease, err := h.leases.Get(ctx, h.opts.LeaseName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "" {
+		return nil
+	}
+	h.logger.Infof("Taking over released lease %s/%s as %s", h.namespace, h.opts.LeaseName, h.opts.Identity)
+	return h.acquire(ctx)
+}
+
+// release clears the holder of the Lease, so that the ready replicas take it again
+func (h *handover) release(ctx context.Context) error {
+	lease, err := h.leases.Get(ctx, h.opts.LeaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lease.Spec.HolderIdentity = nil
+	_, err = h.leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+func (h *handover) isReady() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.ready
+}
+
+func (h *handover) isStopping() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.stopping
+}
+
+// heldByOther returns true if another replica took the Lease after the given time. A Lease acquired before,
+// e.g. by another replica which is stopping as well, isn't a handover.
+func (h *handover) heldByOther(ctx context.Context, since time.Time) bool {
+	lease, err := h.leases.Get(ctx, h.opts.LeaseName, metav1.GetOptions{})
+	if err != nil {
+		h.logger.Debugf("Failed getting the handover lease: %s", err.Error())
+		return false
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || *lease.Spec.HolderIdentity == h.opts.Identity {
+		return false
+	}
+	return lease.Spec.AcquireTime != nil && lease.Spec.AcquireTime.After(since)
+}
+
+// preStopHandler releases the Lease and blocks until another replica took it over, or until the timeout
+// expires
+func (h *handover) preStopHandler(w http.ResponseWriter, r *http.Request) {
+	since := time.Now()
+	h.mu.Lock()
+	h.stopping = true
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.opts.PreStopTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(handoverCheckInterval)
+	defer ticker.Stop()
+	released := false
+	for !h.heldByOther(ctx, since) {
+		if !released {
+			// The Lease is released even if another replica holds it, so that the handover happens after now
+			if err := h.release(ctx); err != nil {
+				h.logger.Debugf("Failed releasing the handover lease: %s", err.Error())
+			} else {
+				released = true
+			}
+		}
+		select {
+		case <-ctx.Done():
+			h.logger.Infof("No replica took over lease %s/%s, stopping anyway", h.namespace, h.opts.LeaseName)
+			w.WriteHeader(http.StatusOK)
+			return
+		case <-ticker.C:
+		}
+	}
+
+	h.logger.Infof("Lease %s/%s taken over, stopping in %s", h.namespace, h.opts.LeaseName, h.opts.PreStopDelay)
+	time.Sleep(h.opts.PreStopDelay)
+	w.WriteHeader(http.StatusOK)
+}
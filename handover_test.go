@@ -0,0 +1,104 @@
+package extension_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// countingExtension counts the pods it handles
+type countingExtension struct {
+	calls int
+}
+
+func (e *countingExtension) Handle(_ context.Context, _ Manager, _ *corev1.Pod, _ admission.Request) admission.Response {
+	e.calls++
+	return admission.Denied("counted")
+}
+
+var _ = Describe("Handover", func() {
+	It("returns the probes served by the status server", func() {
+		readiness, lifecycle := HandoverProbes(8081)
+		Expect(readiness.HTTPGet.Path).To(Equal("/readyz"))
+		Expect(readiness.HTTPGet.Port.IntValue()).To(Equal(8081))
+		Expect(lifecycle.PreStop.HTTPGet.Path).To(Equal("/prestop"))
+	})
+
+	It("requires the lease permissions", func() {
+		c := catalog.NewCatalog()
+		eiriniManager := c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Options.Handover = &HandoverOptions{}
+
+		Expect(eiriniManager.RequiredPermissions()).To(ContainElement(
+			rbacv1.PolicyRule{APIGroups: []string{"coordination.k8s.io"}, Resources: []string{"leases"}, Verbs: []string{"create", "get", "update"}},
+		))
+	})
+
+	It("answers the admission self check without calling the extension", func() {
+		c := catalog.NewCatalog()
+		ext := &countingExtension{}
+		w := NewWebhook(ext, c.SimpleManager())
+		injectDecoder(w)
+
+		req := podRequest()
+		req.UID = "eirinix-handover-check"
+		dryRun := true
+		req.DryRun = &dryRun
+		Expect(w.Handle(context.Background(), req).Allowed).To(BeTrue())
+		Expect(ext.calls).To(Equal(0))
+
+		dryRun = false
+		Expect(w.Handle(context.Background(), req).Allowed).To(BeFalse())
+		Expect(ext.calls).To(Equal(1))
+	})
+
+	It("only hands over to a replica taking the lease after the preStop hook started", func() {
+		leases := fake.NewSimpleClientset().CoordinationV1().Leases("eirini")
+		stop := make(chan struct{})
+		defer close(stop)
+
+		holder := func() string {
+			lease, err := leases.Get(context.Background(), "eirini-x-handover", metav1.GetOptions{})
+			if err != nil || lease.Spec.HolderIdentity == nil {
+				return ""
+			}
+			return *lease.Spec.HolderIdentity
+		}
+		replica := func(identity string) http.HandlerFunc {
+			start, preStop := NewHandoverForTest(HandoverOptions{Identity: identity, PreStopDelay: time.Millisecond}, leases)
+			go start(stop)
+			Eventually(holder).Should(Equal(identity))
+			return preStop
+		}
+		stopped := func(preStop http.HandlerFunc) chan struct{} {
+			done := make(chan struct{})
+			go func() {
+				preStop(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/prestop", nil))
+				close(done)
+			}()
+			return done
+		}
+
+		// Both old replicas are stopping: none of them takes the lease of the other one
+		old := []http.HandlerFunc{replica("old-0"), replica("old-1")}
+		oldStopped := []chan struct{}{stopped(old[0]), stopped(old[1])}
+		Consistently(oldStopped[0], 2*time.Second).ShouldNot(BeClosed())
+		Expect(oldStopped[1]).ToNot(BeClosed())
+
+		replica("new-0")
+		Eventually(oldStopped[0], 5*time.Second).Should(BeClosed())
+		Eventually(oldStopped[1], 5*time.Second).Should(BeClosed())
+		Expect(holder()).To(Equal("new-0"))
+	})
+})
@@ -0,0 +1,253 @@
+package extension
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// ErrCircuitOpen is returned by the HTTP clients of the Manager when too many consecutive
+// requests failed, and the remote service is not contacted until the cooldown expires
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// HTTPClientOptions configures the HTTP clients returned by Manager.HTTPClient
+type HTTPClientOptions struct {
+	// Name identifies the client in metrics and logs. Optional, defaults to "default"
+	Name string
+
+	// Timeout is the timeout of a single attempt. Optional, defaults to 5 seconds
+	Timeout time.Duration
+
+	// MaxRetries is the number of retries of idempotent requests failing with a network error,
+	// a 5xx or a 429 status. Optional, defaults to 2. Set to a negative value to disable retries
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, doubled at each retry. Optional, defaults to 100ms
+	RetryBackoff time.Duration
+
+	// RateLimit is the maximum number of requests per second. Optional, defaults to no limit
+	RateLimit float64
+	// Burst is the number of requests allowed to exceed the rate limit. Optional, defaults to 1
+	Burst int
+
+	// CircuitBreakerThreshold is the number of consecutive failed requests opening the circuit. Optional, defaults to 5
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is the time the circuit stays open before a new request is let through.
+	// Optional, defaults to 30 seconds
+	CircuitBreakerCooldown time.Duration
+
+	// Transport is the underlying transport. Optional, defaults to http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+func (o *HTTPClientOptions) setDefaults() {
+	if o.Name == "" {
+		o.Name = "default"
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 2
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.RetryBackoff == 0 {
+		o.RetryBackoff = 100 * time.Millisecond
+	}
+	if o.Burst == 0 {
+		o.Burst = 1
+	}
+	if o.CircuitBreakerThreshold == 0 {
+		o.CircuitBreakerThreshold = 5
+	}
+	if o.CircuitBreakerCooldown == 0 {
+		o.CircuitBreakerCooldown = 30 * time.Second
+	}
+	if o.Transport == nil {
+		o.Transport = http.DefaultTransport
+	}
+}
+
+// HTTPClient returns an HTTP client suited for calling external services from the admission path:
+// requests have a timeout, idempotent requests are retried, and the client is rate limited and
+// protected by a circuit breaker. Requests are instrumented with prometheus metrics.
+func (m *DefaultExtensionManager) HTTPClient(opts HTTPClientOptions) *http.Client {
+	return NewHTTPClient(opts)
+}
+
+// NewHTTPClient returns the client described in Manager.HTTPClient
+func NewHTTPClient(opts HTTPClientOptions) *http.Client {
+	opts.setDefaults()
+
+	t := &resilientTransport{
+		opts:    opts,
+		breaker: &circuitBreaker{threshold: opts.CircuitBreakerThreshold, cooldown: opts.CircuitBreakerCooldown},
+	}
+	if opts.RateLimit > 0 {
+		t.limiter = rate.NewLimiter(rate.Limit(opts.RateLimit), opts.Burst)
+	}
+	return &http.Client{Transport: t}
+}
+
+type resilientTransport struct {
+	opts    HTTPClientOptions
+	limiter *rate.Limiter
+	breaker *circuitBreaker
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+func isRetryable(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+}
+
+// RoundTrip executes the request, with retries, rate limiting and circuit breaking
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := t.opts.Name
+	if !t.breaker.allow() {
+		httpClientCircuitOpen.WithLabelValues(name).Set(1)
+		return nil, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	defer func() {
+		httpClientDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}()
+
+	retries := 0
+	if isIdempotent(req) {
+		retries = t.opts.MaxRetries
+	}
+
+	backoff := t.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		if t.limiter != nil {
+			if err := t.limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+
+		res, err := t.attempt(req, attempt)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(res.StatusCode)
+		}
+		httpClientRequests.WithLabelValues(name, code).Inc()
+
+		if !isRetryable(res, err) || attempt >= retries {
+			failed := isRetryable(res, err)
+			if t.breaker.record(!failed) {
+				httpClientCircuitOpen.WithLabelValues(name).Set(1)
+			} else {
+				httpClientCircuitOpen.WithLabelValues(name).Set(0)
+			}
+			return res, err
+		}
+
+		if res != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (t *resilientTransport) attempt(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.opts.Timeout)
+	r := req.Clone(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		r.Body = body
+	}
+
+	res, err := t.opts.Transport.RoundTrip(r)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The attempt context must outlive RoundTrip, until the body is consumed
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// circuitBreaker opens after a number of consecutive failures, and lets a single trial request
+// through once the cooldown expired (half-open state)
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Since(b.openedAt) < b.cooldown || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record registers the outcome of a request, and returns true if the circuit is open
+func (b *circuitBreaker) record(success bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package extension_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP client", func() {
+	var (
+		server   *httptest.Server
+		calls    int32
+		failures int32
+	)
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&calls, 0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) <= atomic.LoadInt32(&failures) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("retries idempotent requests", func() {
+		atomic.StoreInt32(&failures, 2)
+		client := NewHTTPClient(HTTPClientOptions{Name: "test", RetryBackoff: time.Millisecond})
+
+		res, err := client.Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(3)))
+	})
+
+	It("doesn't retry non idempotent requests", func() {
+		atomic.StoreInt32(&failures, 1)
+		client := NewHTTPClient(HTTPClientOptions{Name: "test", RetryBackoff: time.Millisecond})
+
+		res, err := client.Post(server.URL, "text/plain", strings.NewReader("data"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+	})
+
+	It("opens the circuit after consecutive failures", func() {
+		atomic.StoreInt32(&failures, 100)
+		client := NewHTTPClient(HTTPClientOptions{
+			Name:                    "test",
+			MaxRetries:              -1,
+			CircuitBreakerThreshold: 2,
+			CircuitBreakerCooldown:  time.Hour,
+		})
+
+		for i := 0; i < 2; i++ {
+			res, err := client.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			res.Body.Close()
+		}
+
+		_, err := client.Get(server.URL)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(ErrCircuitOpen.Error()))
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(2)))
+	})
+})
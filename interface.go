@@ -2,11 +2,14 @@ package extension
 
 import (
 	"context"
+	"net/http"
 
+	"github.com/go-logr/logr"
 	"go.uber.org/zap"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -67,6 +70,9 @@ type MutatingWebhook interface {
 	GetPath() string
 	GetRules() []admissionregistrationv1beta1.RuleWithOperations
 	GetFailurePolicy() admissionregistrationv1beta1.FailurePolicyType
+	GetTimeoutSeconds() *int32
+	GetReinvocationPolicy() *admissionregistrationv1beta1.ReinvocationPolicyType
+	GetMatchConditions() []MatchCondition
 	GetNamespaceSelector() *metav1.LabelSelector
 	GetLabelSelector() *metav1.LabelSelector
 	GetHandler() admission.Handler
@@ -83,6 +89,16 @@ type Manager interface {
 	// The manager later on, will register the Extension when Start() is being called.
 	AddExtension(v interface{}) error
 
+	// AddRegisteredExtensions adds the extensions registered with Register by name, or all of them without names
+	AddRegisteredExtensions(names ...string) error
+
+	// Describe returns the metadata of the extensions added to the Manager, see DescribedExtension
+	Describe() []ExtensionMetadata
+
+	// AddReadyCheck registers a check keeping the Manager not ready on the status endpoint while it fails,
+	// e.g. until an external service the extension depends on can be reached
+	AddReadyCheck(name string, check ReadyCheck) error
+
 	// AddReconciler adds a Reconciler Extension to the manager
 	//
 	// The manager later on, will register the Extension when Start() is being called.
@@ -96,6 +112,15 @@ type Manager interface {
 	// Returns error in case of failure.
 	Start() error
 
+	// StartContext starts the manager, and stops it like Stop once the context is done. It is the preferred
+	// entry point, Start being StartContext with a context which is never done.
+	// It returns once the manager stopped.
+	StartContext(ctx context.Context) error
+
+	// WaitForReady blocks until the Manager started by Start serves the extensions: the webhooks are
+	// registered, the certificate is installed and the cache is synced. It returns when the context is done.
+	WaitForReady(ctx context.Context) error
+
 	// ListExtensions returns a list of the current loaded Extension
 	ListExtensions() []Extension
 
@@ -119,10 +144,46 @@ type Manager interface {
 	// Returns the kubernetes interface.
 	GetKubeClient() (corev1client.CoreV1Interface, error)
 
+	// GetClient returns the client of the kubernetes manager, reading from its cache, to read objects such as
+	// ConfigMaps and Secrets or create companion resources without building a clientset. It is nil until the
+	// Manager is started.
+	GetClient() client.Client
+
+	// GetScheme returns the scheme of the kubernetes manager, e.g. to set owner references. It is nil until the
+	// Manager is started.
+	GetScheme() *runtime.Scheme
+
+	// EiriniLayout returns the labels and the container layout of the app pods of the Eirini release
+	// the Manager works with, see EiriniCompatibility
+	EiriniLayout() EiriniLayout
+
+	// GetCABundle returns the CA certificate trusted by the kube api server to call the webhooks
+	GetCABundle() ([]byte, error)
+
+	// SetFailurePolicy changes the failure policy of the webhooks of an extension in the live webhook configuration
+	SetFailurePolicy(extension string, policy admissionregistrationv1beta1.FailurePolicyType) error
+
+	// Ledger returns the ledger of the one-time actions performed for each app, surviving operator restarts
+	Ledger() *Ledger
+
+	// Events returns the event bus used by extensions and watchers to publish and subscribe to domain events
+	Events() *EventBus
+
+	// HTTPClient returns an HTTP client with timeouts, retries, rate limiting, circuit breaking and metrics,
+	// for extensions calling external services from the admission path
+	HTTPClient(opts HTTPClientOptions) *http.Client
+
+	// Message renders a message surfaced to the developers, e.g. a denial reason, which can be overridden
+	// per deployment with the MessageCatalog of the ManagerOptions
+	Message(id, defaultText string, data interface{}) string
+
 	// GetLogger returns the logger of the application. It can be passed an already existing one
 	// by using NewManager()
 	GetLogger() *zap.SugaredLogger
 
+	// GetLogr returns the logger of the application as a logr.Logger
+	GetLogr() logr.Logger
+
 	// Watch starts the main loop for the registered watchers
 	Watch() error
 
@@ -135,7 +196,8 @@ type Manager interface {
 	// Register Extensions to the kubernetes cluster.
 	RegisterExtensions() error
 
-	// Stop stops the manager execution
+	// Stop stops the manager execution, and returns once the webhook servers drained their in-flight
+	// admission requests
 	Stop()
 
 	// SetManagerOptions it is a setter for the ManagerOptions
@@ -143,4 +205,29 @@ type Manager interface {
 
 	// GetManagerOptions returns current ManagerOptions
 	GetManagerOptions() ManagerOptions
+
+	// EnqueueSideEffect schedules a side effect (e.g. creating a resource related to the admitted pod)
+	// to be run asynchronously, so that it doesn't delay the admission response. The side effects of the
+	// dry-run requests are dropped.
+	EnqueueSideEffect(key string, effect SideEffect)
+
+	// RunOffline runs the Extensions against a pod manifest without a cluster, and returns the resulting patches
+	RunOffline(pod []byte) ([]Patch, error)
+
+	// ConfigGeneration returns the generation of the extensions configuration, bumped on every change
+	ConfigGeneration() int64
+
+	// ResolveConfig returns the configuration of an extension for the app of the pod, resolved from the global
+	// configuration overridden by the ones of its org, its space and its annotations, see ScopedExtensionConfig
+	ResolveConfig(key string, pod *corev1.Pod) ([]byte, error)
+
+	// ConfigStale returns true if the pod was mutated by an extension with another configuration than its current
+	// one, see ManagerOptions.AnnotateConfigHash
+	ConfigStale(key string, pod *corev1.Pod) (bool, error)
+
+	// OnConfigChange registers a hook flushing the caches of an extension when the configuration changes
+	OnConfigChange(hook ConfigChangeHook)
+
+	// Status returns a snapshot of the Manager state, including the extensions configuration schema
+	Status() Status
 }
@@ -0,0 +1,110 @@
+// Package certwatcher serves a TLS certificate loaded from a certificate and a key file, and reloads it when
+// the files change, e.g. when the Manager renews the certificate or the kubelet updates a mounted secret.
+//
+// The files are polled rather than watched with inotify: the kubelet updates the mounted secrets by swapping
+// symlinks, which the file watches don't follow.
+package certwatcher
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DefaultInterval is the interval between the checks of the files
+const DefaultInterval = time.Second
+
+// CertWatcher serves the certificate of the certificate and key files, reloaded when they change
+type CertWatcher struct {
+	mu      sync.RWMutex
+	current *tls.Certificate
+	stamp   string
+
+	certPath string
+	keyPath  string
+
+	// Interval is the interval between the checks of the files, DefaultInterval if zero
+	Interval time.Duration
+	// OnError is called when the changed files can't be loaded. The previous certificate is served meanwhile
+	OnError func(err error)
+}
+
+// New returns a CertWatcher serving the certificate of the files, or an error if they can't be loaded
+func New(certPath, keyPath string) (*CertWatcher, error) {
+	cw := &CertWatcher{certPath: certPath, keyPath: keyPath}
+	if err := cw.ReadCertificate(); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// GetCertificate returns the current certificate, to be used as tls.Config GetCertificate
+func (cw *CertWatcher) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cw.mu.RLock()
+	defer cw.mu.RUnlock()
+	return cw.current, nil
+}
+
+// Start checks the files until the stop channel is closed
+func (cw *CertWatcher) Start(stop <-chan struct{}) error {
+	interval := cw.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	wait.Until(func() {
+		if err := cw.reloadIfChanged(); err != nil && cw.OnError != nil {
+			cw.OnError(err)
+		}
+	}, interval, stop)
+	return nil
+}
+
+// ReadCertificate loads the certificate and key files
+func (cw *CertWatcher) ReadCertificate() error {
+	stamp, err := cw.fileStamp()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cw.certPath, cw.keyPath)
+	if err != nil {
+		return errors.Wrap(err, "loading the certificate files")
+	}
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.current = &cert
+	cw.stamp = stamp
+	return nil
+}
+
+func (cw *CertWatcher) reloadIfChanged() error {
+	stamp, err := cw.fileStamp()
+	if err != nil {
+		return err
+	}
+	cw.mu.RLock()
+	changed := stamp != cw.stamp
+	cw.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	return cw.ReadCertificate()
+}
+
+// fileStamp identifies the content of the files by their size and modification time
+func (cw *CertWatcher) fileStamp() (string, error) {
+	stamp := ""
+	for _, path := range []string{cw.certPath, cw.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", errors.Wrapf(err, "reading the certificate file %s", path)
+		}
+		stamp += fmt.Sprintf("%d/%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
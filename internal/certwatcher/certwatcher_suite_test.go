@@ -0,0 +1,13 @@
+package certwatcher_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCertwatcher(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Certwatcher Suite")
+}
@@ -0,0 +1,113 @@
+package certwatcher_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix/internal/certwatcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CertWatcher", func() {
+	var (
+		dir      string
+		certPath string
+		keyPath  string
+	)
+
+	// writeCertificate writes a self-signed certificate and its key with the serial number
+	writeCertificate := func(commonName string, serial int64) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: commonName},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).ToNot(HaveOccurred())
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)).To(Succeed())
+	}
+
+	servedSerial := func(cw *CertWatcher) func() int64 {
+		return func() int64 {
+			cert, err := cw.GetCertificate(nil)
+			Expect(err).ToNot(HaveOccurred())
+			parsed, err := x509.ParseCertificate(cert.Certificate[0])
+			Expect(err).ToNot(HaveOccurred())
+			return parsed.SerialNumber.Int64()
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "certwatcher")
+		Expect(err).ToNot(HaveOccurred())
+		certPath = filepath.Join(dir, "tls.crt")
+		keyPath = filepath.Join(dir, "tls.key")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("serves the certificate of the files", func() {
+		writeCertificate("eirinix", 1)
+		cw, err := New(certPath, keyPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(servedSerial(cw)()).To(Equal(int64(1)))
+	})
+
+	It("fails without certificate files", func() {
+		_, err := New(certPath, keyPath)
+		Expect(err).To(MatchError(ContainSubstring("reading the certificate file")))
+	})
+
+	It("reloads the certificate when the files change", func() {
+		writeCertificate("eirinix", 1)
+		cw, err := New(certPath, keyPath)
+		Expect(err).ToNot(HaveOccurred())
+		cw.Interval = 10 * time.Millisecond
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go cw.Start(stop)
+
+		// The modification times of the files may not change within the resolution of the filesystem
+		time.Sleep(20 * time.Millisecond)
+		writeCertificate("eirinix", 12345)
+		Eventually(servedSerial(cw)).Should(Equal(int64(12345)))
+	})
+
+	It("keeps serving the previous certificate when the files are invalid", func() {
+		writeCertificate("eirinix", 1)
+		cw, err := New(certPath, keyPath)
+		Expect(err).ToNot(HaveOccurred())
+		cw.Interval = 10 * time.Millisecond
+		errs := make(chan error, 100)
+		cw.OnError = func(err error) { errs <- err }
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go cw.Start(stop)
+
+		Expect(ioutil.WriteFile(keyPath, []byte("not a key, and a different size"), 0600)).To(Succeed())
+		Eventually(errs).Should(Receive(MatchError(ContainSubstring("loading the certificate files"))))
+		Expect(servedSerial(cw)()).To(Equal(int64(1)))
+	})
+})
@@ -0,0 +1,51 @@
+package extension
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ConfigChecker checks the kubernetes connection before the Manager starts using it
+type ConfigChecker interface {
+	Check(config *rest.Config) error
+}
+
+// NewConfigChecker returns the default ConfigChecker, which asks the API server for its version
+func NewConfigChecker() ConfigChecker {
+	return serverVersionChecker{}
+}
+
+type serverVersionChecker struct{}
+
+// Check returns an error if the API server can't be reached with the configuration
+func (serverVersionChecker) Check(config *rest.Config) error {
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "creating the discovery client")
+	}
+	if _, err := client.ServerVersion(); err != nil {
+		return errors.Wrapf(err, "checking the connection to %s", config.Host)
+	}
+	return nil
+}
+
+// loadKubeConfig returns the configuration of the kubeconfig at path. Without a path, the in-cluster
+// configuration is used when running in a pod, and the default kubeconfig loading rules otherwise.
+func loadKubeConfig(path string) (*rest.Config, error) {
+	if path != "" {
+		config, err := clientcmd.BuildConfigFromFlags("", path)
+		return config, errors.Wrapf(err, "loading the kubeconfig %s", path)
+	}
+
+	if config, err := rest.InClusterConfig(); err == nil {
+		return config, nil
+	}
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{},
+	).ClientConfig()
+	return config, errors.Wrap(err, "loading the default kubeconfig")
+}
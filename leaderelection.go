@@ -0,0 +1,60 @@
+package extension
+
+import (
+	"go.uber.org/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// leaderElectionNamespace returns the namespace of the leader election lock, the webhook namespace or the
+// operator namespace
+func (o *ManagerOptions) leaderElectionNamespace() string {
+	if o.WebhookNamespace != "" {
+		return o.WebhookNamespace
+	}
+	return o.Namespace
+}
+
+// setLeaderElection enables the leader election of the kubernetes manager, see EnableLeaderElection. The
+// runnables needing leader election, like the reconcilers and the leaderSetup, then only start on the leader.
+func (o *ManagerOptions) setLeaderElection(opts *manager.Options) {
+	if !o.EnableLeaderElection {
+		return
+	}
+	opts.LeaderElection = true
+	opts.LeaderElectionID = o.resourceName(NamedLeaderElection, "")
+	opts.LeaderElectionNamespace = o.leaderElectionNamespace()
+}
+
+// leaderSetup performs the setup the replicas would race on, once elected: it labels the namespaces,
+// registers the webhook configurations and starts the Watchers
+type leaderSetup struct {
+	manager *DefaultExtensionManager
+	logger  *zap.SugaredLogger
+}
+
+// NeedLeaderElection makes the setup run on the leader only
+func (s *leaderSetup) NeedLeaderElection() bool {
+	return true
+}
+
+// Start sets up the operator once the replica is elected. The manager stops on error, and the replica
+// loses the leadership.
+func (s *leaderSetup) Start(stop <-chan struct{}) error {
+	s.logger.Info("Elected leader, labeling the namespaces and registering the webhook configurations")
+	leader.WithLabelValues().Set(1)
+	defer leader.WithLabelValues().Set(0)
+
+	m := s.manager
+	if err := m.labelNamespaces(); err != nil {
+		return err
+	}
+	if err := m.registerWebhookConfigurations(); err != nil {
+		return err
+	}
+	if len(m.Watchers) > 0 {
+		go m.Watch()
+	}
+
+	<-stop
+	return nil
+}
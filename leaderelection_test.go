@@ -0,0 +1,130 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var _ = Describe("Leader election", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+		client        *cfakes.FakeClient
+		created       []runtime.Object
+		labeled       []string
+	)
+
+	// leaderRunnables returns the runnables added to the kubernetes manager which only run on the leader
+	leaderRunnables := func() []manager.Runnable {
+		var runnables []manager.Runnable
+		for i := 0; i < kubeManager.AddCallCount(); i++ {
+			r := kubeManager.AddArgsForCall(i)
+			if l, ok := r.(manager.LeaderElectionRunnable); ok && l.NeedLeaderElection() {
+				runnables = append(runnables, r)
+			}
+		}
+		return runnables
+	}
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.EnableLeaderElection = true
+		eiriniManager.Options.SetupCertificateName = "test-leader-setupcert"
+		eiriniManager.Credsgen = NewCredentialGenerator()
+
+		client = &cfakes.FakeClient{}
+		created, labeled = nil, nil
+		client.CreateCalls(func(_ context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+			created = append(created, object)
+			return nil
+		})
+		client.UpdateCalls(func(_ context.Context, object runtime.Object, _ ...crc.UpdateOption) error {
+			labeled = append(labeled, object.(*unstructured.Unstructured).GetLabels()["eirini-x-ns"])
+			return nil
+		})
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+	})
+
+	It("leaves the namespace labels and the webhook configuration to the leader", func() {
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		// Every replica sets up the certificate it serves with
+		Expect(created).To(HaveLen(1))
+		Expect(labeled).To(BeEmpty())
+
+		runnables := leaderRunnables()
+		Expect(runnables).To(HaveLen(1))
+
+		stop := make(chan struct{})
+		done := make(chan error)
+		go func() { done <- runnables[0].Start(stop) }()
+		Eventually(func() int { return client.CreateCallCount() }).Should(Equal(2))
+		close(stop)
+		Eventually(done).Should(Receive(BeNil()))
+
+		Expect(labeled).To(Equal([]string{"namespace"}))
+		Expect(created[1]).To(BeAssignableToTypeOf(&admissionregistrationv1beta1.MutatingWebhookConfiguration{}))
+	})
+
+	It("reuses the certificate created meanwhile by another replica", func() {
+		secret := map[string]interface{}{
+			"ca_private_key": base64.StdEncoding.EncodeToString([]byte("the-ca-key")),
+			"ca_certificate": base64.StdEncoding.EncodeToString([]byte("the-ca-cert")),
+			"private_key":    base64.StdEncoding.EncodeToString([]byte("the-key")),
+			"certificate":    base64.StdEncoding.EncodeToString([]byte("the-cert")),
+		}
+		client.CreateReturns(apierrors.NewAlreadyExists(schema.GroupResource{Resource: "secrets"}, "test-leader-setupcert"))
+		client.GetCalls(func(_ context.Context, key crc.ObjectKey, object runtime.Object) error {
+			if client.GetCallCount() == 1 {
+				return apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, key.Name)
+			}
+			u := object.(*unstructured.Unstructured)
+			u.SetName(key.Name)
+			u.Object["data"] = secret
+			return nil
+		})
+
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(client.CreateCallCount()).To(Equal(1))
+		Expect(string(eiriniManager.WebhookConfig.Certificate)).To(Equal("the-cert"))
+		Expect(string(eiriniManager.WebhookConfig.CaCertificate)).To(Equal("the-ca-cert"))
+	})
+
+	It("requires the permissions of the lock", func() {
+		Expect(eiriniManager.RequiredPermissions()).To(ContainElement(
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"create", "get", "update"}},
+		))
+	})
+
+	It("is not supported in watcher mode", func() {
+		opts := ManagerOptions{Namespace: "eirini", WatcherMode: true, EnableLeaderElection: true}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("enableLeaderElection: Forbidden: not supported in watcher mode"))
+	})
+})
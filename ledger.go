@@ -0,0 +1,358 @@
+package extension
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ledgerGroup    = "eirinix.cloudfoundry.org"
+	ledgerResource = "ledgerentries"
+
+	// ledgerStorageName is the name of the ledger in ManagerOptions.Storage
+	ledgerStorageName = "ledger"
+
+	ledgerPhasePending = "Pending"
+	ledgerPhaseDone    = "Done"
+
+	// ledgerClaimTimeout is the time after which a pending entry is considered abandoned, e.g. by a
+	// replica which crashed while running the action, and can be claimed again
+	ledgerClaimTimeout = 10 * time.Minute
+)
+
+// ErrLedgerActionPending is returned by Ledger.Once when the action is being run by another replica
+var ErrLedgerActionPending = errors.New("The action is being run by another replica")
+
+var ledgerEntryGVK = schema.GroupVersionKind{Group: ledgerGroup, Version: "v1alpha1", Kind: "LedgerEntry"}
+
+// LedgerCRD is the manifest of the LedgerEntry CustomResourceDefinition, installed by the Manager with InstallLedgerCRD
+const LedgerCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: ledgerentries.eirinix.cloudfoundry.org
+spec:
+  group: eirinix.cloudfoundry.org
+  scope: Namespaced
+  names:
+    kind: LedgerEntry
+    listKind: LedgerEntryList
+    plural: ledgerentries
+    singular: ledgerentry
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    additionalPrinterColumns:
+    - name: App
+      type: string
+      jsonPath: .spec.appGUID
+    - name: Action
+      type: string
+      jsonPath: .spec.action
+    - name: Phase
+      type: string
+      jsonPath: .status.phase
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              appGUID:
+                type: string
+              action:
+                type: string
+          status:
+            type: object
+            properties:
+              phase:
+                type: string
+              holder:
+                type: string
+              updated:
+                type: string
+                format: date-time
+`
+
+// LedgerPermissions returns the permissions needed by the extensions using the Ledger
+func LedgerPermissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{{
+		APIGroups: []string{ledgerGroup},
+		Resources: []string{ledgerResource},
+		Verbs:     []string{"get", "create", "update", "delete"},
+	}}
+}
+
+// Ledger records the one-time actions performed for each app (e.g. creating a database user, or registering
+// the app in an APM) in LedgerEntry custom resources, so that they run once even across operator restarts and
+// replicas.
+type Ledger struct {
+	store     ledgerStore
+	namespace string
+	holder    string
+
+	mu   sync.Mutex
+	done map[string]bool
+}
+
+// Ledger returns the ledger of the one-time actions, stored in the webhook namespace, or in ManagerOptions.Storage
+// if set
+func (m *DefaultExtensionManager) Ledger() *Ledger {
+	m.ledgerOnce.Do(func() {
+		namespace := m.Options.WebhookNamespace
+		if namespace == "" {
+			namespace = m.Options.Namespace
+		}
+		var store ledgerStore = storageLedgerStore{storage: m.Storage(ledgerStorageName)}
+		if m.Options.Storage == nil {
+			store = clientLedgerStore{client: m.KubeManager.GetClient()}
+		}
+		m.ledger = newLedger(store, namespace, m.Options.OperatorFingerprint)
+	})
+	return m.ledger
+}
+
+func newLedger(store ledgerStore, namespace, holder string) *Ledger {
+	return &Ledger{store: store, namespace: namespace, holder: holder, done: map[string]bool{}}
+}
+
+// ledgerEntryName returns a valid object name for the action of the app
+func ledgerEntryName(appGUID, action string) string {
+	sum := sha256.Sum256([]byte(action + "/" + appGUID))
+	return "app-" + hex.EncodeToString(sum[:16])
+}
+
+// Once runs the action for the app, unless it already ran successfully. It returns true if the action ran.
+// If the action fails, it's not recorded and runs again on the next call. ErrLedgerActionPending is returned
+// if another replica is running the action.
+func (l *Ledger) Once(ctx context.Context, appGUID, action string, f func(ctx context.Context) error) (bool, error) {
+	name := ledgerEntryName(appGUID, action)
+
+	l.mu.Lock()
+	done := l.done[name]
+	l.mu.Unlock()
+	if done {
+		return false, nil
+	}
+
+	entry, err := l.claim(ctx, name, appGUID, action)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		l.markDone(name)
+		return false, nil
+	}
+
+	if err := f(ctx); err != nil {
+		if err := l.store.delete(ctx, entry); client.IgnoreNotFound(err) != nil {
+			return true, errors.Wrapf(err, "releasing the ledger entry of action %s for app %s", action, appGUID)
+		}
+		return true, err
+	}
+
+	setLedgerStatus(entry, ledgerPhaseDone, l.holder)
+	if err := l.store.update(ctx, entry); err != nil {
+		return true, errors.Wrapf(err, "recording action %s for app %s", action, appGUID)
+	}
+	l.markDone(name)
+	return true, nil
+}
+
+// Done returns true if the action was done for the app, without running it
+func (l *Ledger) Done(ctx context.Context, appGUID, action string) (bool, error) {
+	name := ledgerEntryName(appGUID, action)
+	l.mu.Lock()
+	done := l.done[name]
+	l.mu.Unlock()
+	if done {
+		return true, nil
+	}
+
+	entry := &unstructured.Unstructured{}
+	entry.SetGroupVersionKind(ledgerEntryGVK)
+	err := l.store.get(ctx, machinerytypes.NamespacedName{Namespace: l.namespace, Name: name}, entry)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "getting the ledger entry of action %s for app %s", action, appGUID)
+	}
+	phase, _, _ := unstructured.NestedString(entry.Object, "status", "phase")
+	return phase == ledgerPhaseDone, nil
+}
+
+func (l *Ledger) markDone(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.done[name] = true
+}
+
+// claim records the action as pending, and returns the entry. It returns a nil entry if the action is done.
+func (l *Ledger) claim(ctx context.Context, name, appGUID, action string) (*unstructured.Unstructured, error) {
+	entry := &unstructured.Unstructured{}
+	entry.SetGroupVersionKind(ledgerEntryGVK)
+	err := l.store.get(ctx, machinerytypes.NamespacedName{Namespace: l.namespace, Name: name}, entry)
+
+	if apierrors.IsNotFound(err) {
+		entry = &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"appGUID": appGUID, "action": action},
+		}}
+		entry.SetGroupVersionKind(ledgerEntryGVK)
+		entry.SetName(name)
+		entry.SetNamespace(l.namespace)
+		setLedgerStatus(entry, ledgerPhasePending, l.holder)
+
+		err = l.store.create(ctx, entry)
+		if apierrors.IsAlreadyExists(err) {
+			return nil, ErrLedgerActionPending
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "claiming action %s for app %s", action, appGUID)
+		}
+		return entry, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting the ledger entry of action %s for app %s", action, appGUID)
+	}
+
+	phase, _, _ := unstructured.NestedString(entry.Object, "status", "phase")
+	if phase == ledgerPhaseDone {
+		return nil, nil
+	}
+	updated, _, _ := unstructured.NestedString(entry.Object, "status", "updated")
+	if t, err := time.Parse(time.RFC3339, updated); err == nil && time.Since(t) < ledgerClaimTimeout {
+		return nil, ErrLedgerActionPending
+	}
+
+	// The claim was abandoned: take it over, the resource version making sure only one replica does
+	setLedgerStatus(entry, ledgerPhasePending, l.holder)
+	err = l.store.update(ctx, entry)
+	if apierrors.IsConflict(err) {
+		return nil, ErrLedgerActionPending
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "claiming action %s for app %s", action, appGUID)
+	}
+	return entry, nil
+}
+
+func setLedgerStatus(entry *unstructured.Unstructured, phase, holder string) {
+	entry.Object["status"] = map[string]interface{}{
+		"phase":   phase,
+		"holder":  holder,
+		"updated": time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// ledgerStore persists the ledger entries, returning the errors of the API server
+type ledgerStore interface {
+	get(ctx context.Context, key machinerytypes.NamespacedName, entry *unstructured.Unstructured) error
+	create(ctx context.Context, entry *unstructured.Unstructured) error
+	update(ctx context.Context, entry *unstructured.Unstructured) error
+	delete(ctx context.Context, entry *unstructured.Unstructured) error
+}
+
+// clientLedgerStore stores the entries as LedgerEntry custom resources
+type clientLedgerStore struct {
+	client client.Client
+}
+
+func (s clientLedgerStore) get(ctx context.Context, key machinerytypes.NamespacedName, entry *unstructured.Unstructured) error {
+	return s.client.Get(ctx, key, entry)
+}
+
+func (s clientLedgerStore) create(ctx context.Context, entry *unstructured.Unstructured) error {
+	return s.client.Create(ctx, entry)
+}
+
+func (s clientLedgerStore) update(ctx context.Context, entry *unstructured.Unstructured) error {
+	return s.client.Update(ctx, entry)
+}
+
+func (s clientLedgerStore) delete(ctx context.Context, entry *unstructured.Unstructured) error {
+	return s.client.Delete(ctx, entry)
+}
+
+// storageLedgerStore stores the entries as JSON objects of a Storage. The storages don't detect conflicting
+// updates, so two replicas can take over the same abandoned claim.
+type storageLedgerStore struct {
+	storage Storage
+}
+
+var ledgerGroupResource = schema.GroupResource{Group: ledgerGroup, Resource: ledgerResource}
+
+func (s storageLedgerStore) get(ctx context.Context, key machinerytypes.NamespacedName, entry *unstructured.Unstructured) error {
+	data, err := s.storage.Get(ctx, key.Name)
+	if IsStorageObjectNotFound(err) {
+		return apierrors.NewNotFound(ledgerGroupResource, key.Name)
+	}
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(entry.UnmarshalJSON(data), "decoding the ledger entry %s", key.Name)
+}
+
+func (s storageLedgerStore) create(ctx context.Context, entry *unstructured.Unstructured) error {
+	data, err := entry.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	err = s.storage.Create(ctx, entry.GetName(), data)
+	if IsStorageObjectExists(err) {
+		return apierrors.NewAlreadyExists(ledgerGroupResource, entry.GetName())
+	}
+	return err
+}
+
+func (s storageLedgerStore) update(ctx context.Context, entry *unstructured.Unstructured) error {
+	data, err := entry.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return s.storage.Put(ctx, entry.GetName(), data)
+}
+
+func (s storageLedgerStore) delete(ctx context.Context, entry *unstructured.Unstructured) error {
+	return s.storage.Delete(ctx, entry.GetName())
+}
+
+// installLedgerCRD creates or updates the LedgerEntry CustomResourceDefinition
+func (m *DefaultExtensionManager) installLedgerCRD(ctx context.Context) error {
+	return m.installCRD(ctx, LedgerCRD)
+}
+
+// installCRD creates or updates a CustomResourceDefinition from its manifest
+func (m *DefaultExtensionManager) installCRD(ctx context.Context, manifest string) error {
+	crd := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(manifest), &crd.Object); err != nil {
+		return errors.Wrap(err, "decoding the CRD")
+	}
+
+	c := m.KubeManager.GetClient()
+	err := c.Create(ctx, crd)
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(crd.GroupVersionKind())
+	if err := c.Get(ctx, machinerytypes.NamespacedName{Name: crd.GetName()}, existing); err != nil {
+		return err
+	}
+	crd.SetResourceVersion(existing.GetResourceVersion())
+	return c.Update(ctx, crd)
+}
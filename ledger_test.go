@@ -0,0 +1,130 @@
+package extension_test
+
+import (
+	"context"
+	"errors"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fakeLedgerStore backs a FakeClient with an in-memory store of unstructured objects
+func fakeLedgerStore(client *cfakes.FakeClient) map[string]*unstructured.Unstructured {
+	store := map[string]*unstructured.Unstructured{}
+	gr := schema.GroupResource{Group: "eirinix.cloudfoundry.org", Resource: "ledgerentries"}
+
+	client.GetCalls(func(_ context.Context, key types.NamespacedName, obj runtime.Object) error {
+		stored, ok := store[key.String()]
+		if !ok {
+			return apierrors.NewNotFound(gr, key.Name)
+		}
+		stored.DeepCopyInto(obj.(*unstructured.Unstructured))
+		return nil
+	})
+	client.CreateCalls(func(_ context.Context, obj runtime.Object, _ ...crc.CreateOption) error {
+		u := obj.(*unstructured.Unstructured)
+		key := types.NamespacedName{Namespace: u.GetNamespace(), Name: u.GetName()}.String()
+		if _, ok := store[key]; ok {
+			return apierrors.NewAlreadyExists(gr, u.GetName())
+		}
+		store[key] = u.DeepCopy()
+		return nil
+	})
+	client.UpdateCalls(func(_ context.Context, obj runtime.Object, _ ...crc.UpdateOption) error {
+		u := obj.(*unstructured.Unstructured)
+		store[types.NamespacedName{Namespace: u.GetNamespace(), Name: u.GetName()}.String()] = u.DeepCopy()
+		return nil
+	})
+	client.DeleteCalls(func(_ context.Context, obj runtime.Object, _ ...crc.DeleteOption) error {
+		u := obj.(*unstructured.Unstructured)
+		delete(store, types.NamespacedName{Namespace: u.GetNamespace(), Name: u.GetName()}.String())
+		return nil
+	})
+	return store
+}
+
+var _ = Describe("Ledger", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		client        *cfakes.FakeClient
+		store         map[string]*unstructured.Unstructured
+		ctx           = context.Background()
+		runs          int
+		action        = func(context.Context) error { runs++; return nil }
+	)
+
+	BeforeEach(func() {
+		runs = 0
+		client = &cfakes.FakeClient{}
+		store = fakeLedgerStore(client)
+		kubeManager := &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	It("runs an action once per app", func() {
+		ran, err := eiriniManager.Ledger().Once(ctx, "guid-1", "create-db-user", action)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ran).To(BeTrue())
+
+		ran, err = eiriniManager.Ledger().Once(ctx, "guid-1", "create-db-user", action)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ran).To(BeFalse())
+
+		ran, err = eiriniManager.Ledger().Once(ctx, "guid-2", "create-db-user", action)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ran).To(BeTrue())
+		Expect(runs).To(Equal(2))
+		Expect(store).To(HaveLen(2))
+	})
+
+	It("remembers the actions across restarts", func() {
+		_, err := eiriniManager.Ledger().Once(ctx, "guid-1", "create-db-user", action)
+		Expect(err).ToNot(HaveOccurred())
+
+		c := catalog.NewCatalog()
+		restarted := c.SimpleManager().(*DefaultExtensionManager)
+		restarted.KubeManager = eiriniManager.KubeManager
+		ran, err := restarted.Ledger().Once(ctx, "guid-1", "create-db-user", action)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ran).To(BeFalse())
+		Expect(runs).To(Equal(1))
+	})
+
+	It("runs a failed action again", func() {
+		failure := errors.New("database unavailable")
+		ran, err := eiriniManager.Ledger().Once(ctx, "guid-1", "create-db-user", func(context.Context) error { return failure })
+		Expect(ran).To(BeTrue())
+		Expect(err).To(Equal(failure))
+		Expect(store).To(BeEmpty())
+
+		ran, err = eiriniManager.Ledger().Once(ctx, "guid-1", "create-db-user", action)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ran).To(BeTrue())
+	})
+
+	It("doesn't run an action claimed by another replica", func() {
+		c := catalog.NewCatalog()
+		other := c.SimpleManager().(*DefaultExtensionManager)
+		other.KubeManager = eiriniManager.KubeManager
+		_, err := other.Ledger().Once(ctx, "guid-1", "create-db-user", func(ctx context.Context) error {
+			_, err := eiriniManager.Ledger().Once(ctx, "guid-1", "create-db-user", action)
+			Expect(err).To(Equal(ErrLedgerActionPending))
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(runs).To(Equal(0))
+	})
+})
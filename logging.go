@@ -0,0 +1,140 @@
+package extension
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLogrFromZap returns a logr.Logger writing to the zap logger. logr verbosity levels map to
+// zap levels below Info: V(1) is Debug.
+func NewLogrFromZap(l *zap.SugaredLogger) logr.Logger {
+	return &zapLogr{l: l.Desugar().WithOptions(zap.AddCallerSkip(1))}
+}
+
+// NewZapFromLogr returns a zap logger writing to the logr.Logger, so that the Manager and the
+// extensions can log through a logr implementation (e.g. the controller-runtime one)
+func NewZapFromLogr(l logr.Logger) *zap.SugaredLogger {
+	return zap.New(&logrCore{l: l}).Sugar()
+}
+
+// GetLogr returns the logger of the application as a logr.Logger
+func (m *DefaultExtensionManager) GetLogr() logr.Logger {
+	if m.Options.LogrLogger != nil {
+		return m.Options.LogrLogger
+	}
+	return NewLogrFromZap(m.Logger)
+}
+
+type zapLogr struct {
+	l     *zap.Logger
+	level int
+}
+
+func (z *zapLogr) zapLevel() zapcore.Level {
+	return zapcore.InfoLevel - zapcore.Level(z.level)
+}
+
+func (z *zapLogr) Enabled() bool {
+	return z.l.Core().Enabled(z.zapLevel())
+}
+
+func (z *zapLogr) Info(msg string, keysAndValues ...interface{}) {
+	if ce := z.l.Check(z.zapLevel(), msg); ce != nil {
+		ce.Write(zapFields(keysAndValues)...)
+	}
+}
+
+func (z *zapLogr) Error(err error, msg string, keysAndValues ...interface{}) {
+	z.l.Error(msg, append(zapFields(keysAndValues), zap.Error(err))...)
+}
+
+func (z *zapLogr) V(level int) logr.Logger {
+	return &zapLogr{l: z.l, level: z.level + level}
+}
+
+func (z *zapLogr) WithValues(keysAndValues ...interface{}) logr.Logger {
+	return &zapLogr{l: z.l.With(zapFields(keysAndValues)...), level: z.level}
+}
+
+func (z *zapLogr) WithName(name string) logr.Logger {
+	return &zapLogr{l: z.l.Named(name), level: z.level}
+}
+
+func zapFields(keysAndValues []interface{}) []zap.Field {
+	fields := make([]zap.Field, 0, len(keysAndValues)/2+1)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 == len(keysAndValues) {
+			fields = append(fields, zap.Any("ignored", keysAndValues[i]))
+			break
+		}
+		fields = append(fields, zap.Any(fmt.Sprint(keysAndValues[i]), keysAndValues[i+1]))
+	}
+	return fields
+}
+
+// logrCore is a zapcore.Core writing to a logr.Logger
+type logrCore struct {
+	l logr.Logger
+}
+
+func (c *logrCore) logger(level zapcore.Level) logr.Logger {
+	if level < zapcore.InfoLevel {
+		return c.l.V(int(zapcore.InfoLevel - level))
+	}
+	return c.l
+}
+
+func (c *logrCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel || c.logger(level).Enabled()
+}
+
+func (c *logrCore) With(fields []zapcore.Field) zapcore.Core {
+	return &logrCore{l: c.l.WithValues(keysAndValues(fields)...)}
+}
+
+func (c *logrCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *logrCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	kv := keysAndValues(fields)
+	if entry.LoggerName != "" {
+		kv = append(kv, "logger", entry.LoggerName)
+	}
+	if entry.Level >= zapcore.ErrorLevel {
+		c.l.Error(nil, entry.Message, kv...)
+		return nil
+	}
+	c.logger(entry.Level).Info(entry.Message, kv...)
+	return nil
+}
+
+func (c *logrCore) Sync() error {
+	return nil
+}
+
+func keysAndValues(fields []zapcore.Field) []interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kv := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		kv = append(kv, k, enc.Fields[k])
+	}
+	return kv
+}
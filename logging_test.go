@@ -0,0 +1,113 @@
+package extension_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "code.cloudfoundry.org/eirinix"
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ctxLoggingExtension logs with the logger of the context
+type ctxLoggingExtension struct{}
+
+func (e *ctxLoggingExtension) Handle(ctx context.Context, _ Manager, _ *corev1.Pod, _ admission.Request) admission.Response {
+	ctxlog.Info(ctx, "handled")
+	return admission.Allowed("")
+}
+
+// recordingLogr is a logr.Logger recording the logged lines
+type recordingLogr struct {
+	lines  *[]string
+	level  int
+	values []interface{}
+}
+
+func (r *recordingLogr) Enabled() bool { return r.level <= 1 }
+
+func (r *recordingLogr) Info(msg string, kv ...interface{}) {
+	*r.lines = append(*r.lines, fmt.Sprintf("info(%d) %s %v", r.level, msg, append(r.values, kv...)))
+}
+
+func (r *recordingLogr) Error(err error, msg string, kv ...interface{}) {
+	*r.lines = append(*r.lines, fmt.Sprintf("error %s %v", msg, append(r.values, kv...)))
+}
+
+func (r *recordingLogr) V(level int) logr.Logger {
+	return &recordingLogr{lines: r.lines, level: r.level + level, values: r.values}
+}
+
+func (r *recordingLogr) WithValues(kv ...interface{}) logr.Logger {
+	return &recordingLogr{lines: r.lines, level: r.level, values: append(r.values, kv...)}
+}
+
+func (r *recordingLogr) WithName(string) logr.Logger { return r }
+
+var _ = Describe("Logging", func() {
+	It("logs through a logr.Logger", func() {
+		lines := []string{}
+		m, err := NewManager(ManagerOptions{Namespace: "eirini", LogrLogger: &recordingLogr{lines: &lines}})
+		Expect(err).ToNot(HaveOccurred())
+
+		log := m.GetLogger().With("app", "dora")
+		log.Infow("started", "port", 8080)
+		log.Debug("details")
+		log.Error("failed")
+
+		Expect(lines).To(Equal([]string{
+			"info(0) started [app dora port 8080]",
+			"info(1) details [app dora]",
+			"error failed [app dora]",
+		}))
+		Expect(m.GetLogr()).To(BeAssignableToTypeOf(&recordingLogr{}))
+	})
+
+	It("adapts a zap logger to logr", func() {
+		core, logs := observer.New(zapcore.DebugLevel)
+		l := NewLogrFromZap(zap.New(core).Sugar()).WithName("ext").WithValues("app", "dora")
+
+		l.Info("started", "port", 8080)
+		l.V(1).Info("details")
+		l.V(2).Info("ignored")
+		l.Error(errors.New("boom"), "failed")
+
+		entries := logs.AllUntimed()
+		Expect(entries).To(HaveLen(3))
+		Expect(entries[0].LoggerName).To(Equal("ext"))
+		Expect(entries[0].ContextMap()).To(Equal(map[string]interface{}{"app": "dora", "port": int64(8080)}))
+		Expect(entries[1].Level).To(Equal(zapcore.DebugLevel))
+		Expect(entries[2].Level).To(Equal(zapcore.ErrorLevel))
+		Expect(entries[2].ContextMap()).To(HaveKeyWithValue("error", "boom"))
+	})
+	It("passes a logger scoped to the admission request to the extensions", func() {
+		core, logs := observer.New(zapcore.InfoLevel)
+		m, err := NewManager(ManagerOptions{Namespace: "eirini", Logger: zap.New(core).Sugar()})
+		Expect(err).ToNot(HaveOccurred())
+		w := NewWebhook(&ctxLoggingExtension{}, m)
+		injectDecoder(w)
+
+		req := podRequest()
+		req.UID = "b3b4c6a1"
+		req.Namespace = "space"
+		req.Name = "dora-0"
+		w.Handle(context.Background(), req)
+
+		entries := logs.FilterMessage("handled").AllUntimed()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].LoggerName).To(Equal("*extension_test.ctxLoggingExtension"))
+		Expect(entries[0].ContextMap()).To(Equal(map[string]interface{}{
+			ctxlog.KeyNamespace: "space",
+			ctxlog.KeyPod:       "dora-0",
+			ctxlog.KeyUID:       "b3b4c6a1",
+		}))
+	})
+})
@@ -3,20 +3,18 @@ package extension
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"net/http"
-	"strconv"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/eirinix/util/ctxlog"
-	"code.cloudfoundry.org/quarks-utils/pkg/credsgen"
-	inmemorycredgen "code.cloudfoundry.org/quarks-utils/pkg/credsgen/in_memory_generator"
-	kubeConfig "code.cloudfoundry.org/quarks-utils/pkg/kubeconfig"
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 	"go.uber.org/zap"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -24,11 +22,14 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	watchtools "k8s.io/client-go/tools/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -80,8 +81,9 @@ type DefaultExtensionManager struct {
 	// WebhookServer is the webhook server where the Manager registers the Extensions to.
 	WebhookServer *webhook.Server
 
-	// Credsgen is the credential generator implementation used for generating certificates
-	Credsgen credsgen.Generator
+	// Credsgen is the credential generator implementation used for generating certificates.
+	// Defaults to NewCredentialGenerator
+	Credsgen CredentialGenerator
 
 	// Options are the manager options
 	Options ManagerOptions
@@ -90,8 +92,52 @@ type DefaultExtensionManager struct {
 	kubeClient     corev1client.CoreV1Interface
 
 	stopChannel chan struct{}
+	stopOnce    sync.Once
+
+	// running is closed once Start returns, see Stop
+	runningMu sync.Mutex
+	running   chan struct{}
 
 	watcher watch.Interface
+
+	watcherQueuesOnce sync.Once
+	queues            []*watcherQueue
+
+	sideEffects *sideEffectQueue
+
+	events *EventBus
+
+	handover *handover
+
+	cacheWarmer *cacheWarmer
+
+	readyChecks  readyChecks
+	registration registration
+
+	extensionsLoaded   bool
+	extensionsOrdered  bool
+	webhooksConfigured bool
+
+	// webhookGroups are the WebhookGroups of the options, and groups the default group followed by them
+	// once the extensions are loaded, with their webhooks in the order of their webhook configuration
+	webhookGroups   []*webhookGroup
+	groups          []*webhookGroup
+	failurePolicyMu sync.Mutex
+
+	// admissionServers are the webhook servers added to the kubernetes manager, see the health probes
+	admissionServers []*admissionServer
+
+	eiriniLayout *EiriniLayout
+
+	slo   *sloTracker
+	audit *auditLog
+
+	configMu         sync.Mutex
+	configGeneration int64
+	configHooks      []ConfigChangeHook
+
+	ledgerOnce sync.Once
+	ledger     *Ledger
 }
 
 // ManagerOptions represent the Runtime manager options
@@ -100,6 +146,14 @@ type ManagerOptions struct {
 	// Namespace is the namespace where pods will trigger the extension. Use empty to trigger on all namespaces.
 	Namespace string
 
+	// Namespaces are additional namespaces where pods will trigger the extension, see WatchedNamespaces.
+	// Optional
+	Namespaces []string
+
+	// AllNamespaces makes the pods of all namespaces trigger the extension, Namespace then only holding the
+	// resources of the operator. Optional, defaults to false
+	AllNamespaces bool
+
 	// Host is the listening host address for the Manager
 	Host string
 
@@ -109,39 +163,262 @@ type ManagerOptions struct {
 	// Context is the context to be used for Kube requests. Leave it empty for automatic generation
 	Context *context.Context
 
+	// Scheme is the scheme of the kubernetes manager. Optional, defaults to a new scheme per Manager, see NewScheme
+	Scheme *runtime.Scheme
+
 	// KubeConfig is the kubeconfig path. Optional, omit for in-cluster connection
 	KubeConfig string
 
+	// ConfigChecker checks the kubernetes connection before it's used. Optional, defaults to NewConfigChecker
+	ConfigChecker ConfigChecker
+
 	// Logger is the default logger. Optional, if omitted a new one will be created
 	Logger *zap.SugaredLogger
 
+	// LogrLogger is used when Logger is omitted, for operators standardized on logr. Optional
+	LogrLogger logr.Logger
+
 	// FailurePolicy default failure policy for the webhook server.  Optional, defaults to fail
 	FailurePolicy *admissionregistrationv1beta1.FailurePolicyType
 
 	// FilterEiriniApps enables or disables Eirini apps filters.  Optional, defaults to true
 	FilterEiriniApps *bool
 
+	// EiriniCompatibility is the Eirini release whose app pods are filtered and handled. Optional, defaults
+	// to EiriniCompatibilityLegacy, see EiriniCompatibilityAuto to detect it
+	EiriniCompatibility EiriniCompatibility
+
+	// AdmissionRegistrationAPI is the version of the admissionregistration.k8s.io API the webhook
+	// configurations are created with. Optional, defaults to AdmissionRegistrationAuto
+	AdmissionRegistrationAPI AdmissionRegistrationAPI
+
 	// OperatorFingerprint is a unique string identifiying the Manager.  Optional, defaults to eirini-x
 	OperatorFingerprint string
 
+	// OperatorVersion is the version of the operator embedding eirinix, stamped with the eirinix version on the
+	// generated webhook configuration and secrets, and exported in the eirinix_build_info metric. Optional
+	OperatorVersion string
+
 	// SetupCertificateName is the name of the generated certificates.  Optional, defaults uses OperatorFingerprint to generate a new one
 	SetupCertificateName string
 
+	// NamingStrategy names the generated webhook configuration, certificate secret, labels and other resources.
+	// Optional, defaults to a DefaultNamingStrategy deriving the names from OperatorFingerprint
+	NamingStrategy NamingStrategy
+
 	// RegisterWebHook enables or disables automatic registering of webhooks. Defaults to true
 	RegisterWebHook *bool
 
 	// SetupCertificate enables or disables automatic certificate generation. Defaults to true
 	SetupCertificate *bool
 
+	// CertManager makes cert-manager issue the webhook server certificates instead of the Credsgen of the
+	// Manager, see CertManagerOptions. Optional
+	CertManager *CertManagerOptions
+
+	// CertificateRotation renews the generated webhook server certificates before they expire, without restarting
+	// the operator, see CertificateRotationOptions. Optional, the certificates are only renewed once expired by
+	// default
+	CertificateRotation *CertificateRotationOptions
+
+	// TLS makes the webhook servers serve a certificate provided by the operator instead of generating one, see
+	// TLSOptions. Optional
+	TLS *TLSOptions
+
 	// ServiceName registers the Extension as a MutatingWebhook reachable by a service
 	ServiceName string
 
 	// WebhookNamespace, when ServiceName is supplied, a WebhookNamespace is required to indicate in which namespace the webhook service runs on
 	WebhookNamespace string
 
+	// Service makes the Manager create and reconcile the ServiceName Service, see ServiceOptions. Optional,
+	// the Service is expected to exist if omitted
+	Service *ServiceOptions
+
+	// OperatorPodLabels are the labels of the operator pods, excluded from the webhooks so that the operator
+	// never mutates itself. Optional, defaults to the Selector of Service
+	OperatorPodLabels map[string]string
+
+	// OperatorServiceAccount is the service account of the operator pods, which are admitted unchanged by the
+	// webhooks. Pods are only matched in the WebhookNamespace, if set. Optional
+	OperatorServiceAccount string
+
 	// WatcherStartRV is the starting ResourceVersion of the PodList which is being watched (see Kubernetes #74022).
 	// If omitted, it will start watching from the current RV.
 	WatcherStartRV string
+
+	// WatcherMode runs only the Watchers, without the webhook server, the certificate and the webhook
+	// configuration, for the operators observing the Eirini pods without mutating them. Extensions and
+	// Reconcilers can't be added. Optional, defaults to false
+	WatcherMode bool
+
+	// FrontProxy configures the webhook server to run behind a front proxy or load balancer. Optional
+	FrontProxy *FrontProxyOptions
+
+	// RequireClientCertificate makes the webhook servers only serve the clients presenting a certificate
+	// signed by the CAs of the ClientCertificateOptions, e.g. the API server. Optional, defaults to serving
+	// every client
+	RequireClientCertificate *ClientCertificateOptions
+
+	// Backpressure limits the admission requests served concurrently, see BackpressureOptions. Optional,
+	// defaults to no limit
+	Backpressure *BackpressureOptions
+
+	// Budget bounds the CPU time and the memory the handler of each extension may use per admission request,
+	// see BudgetOptions. Optional, defaults to no limit
+	Budget *BudgetOptions
+
+	// Audit streams a structured event for each admission decision to the audit sinks, see AuditOptions.
+	// Optional
+	Audit *AuditOptions
+
+	// WatcherQueue hands the events to each Watcher through a bounded queue, see WatcherQueueOptions.
+	// Optional, defaults to handing the events to the Watchers one after the other as they are received
+	WatcherQueue *WatcherQueueOptions
+
+	// Autoscaling makes the Manager create and reconcile a HorizontalPodAutoscaler for the operator Deployment,
+	// see AutoscalingOptions. Optional
+	Autoscaling *AutoscalingOptions
+
+	// RBACCheck controls the check of the service account permissions against the ones declared by the
+	// Manager and the extensions (see PermissionedExtension). Optional, defaults to no check
+	RBACCheck RBACCheckMode
+
+	// StrictPermissions reviews, before setting up the operator, every permission required by the Manager
+	// features and the extensions (see RequiredPermissions), and refuses to start with the list of the ones the
+	// service account lacks. Optional, defaults to false
+	StrictPermissions bool
+
+	// ExtensionConfig contains the JSON configuration of the extensions implementing ConfigurableExtension,
+	// indexed by their ConfigKey. Optional
+	ExtensionConfig map[string]json.RawMessage
+
+	// AnnotateConfigHash stamps the pods mutated by the ConfigurableExtensions with the hash of the configuration
+	// they were mutated with, see AnnotationConfigHashPrefix and Manager.ConfigStale. Optional, defaults to false
+	AnnotateConfigHash bool
+
+	// ScopedConfig overrides the ExtensionConfig for the apps of some orgs and spaces, see
+	// ScopedExtensionConfig and Manager.ResolveConfig. Optional
+	ScopedConfig *ScopedExtensionConfig
+
+	// StatusBindAddress is the address of the HTTP endpoint serving the Manager status. Optional, the
+	// endpoint is disabled if omitted
+	StatusBindAddress string
+
+	// MetricsBindAddress is the address of the HTTP endpoint serving the prometheus metrics of eirinix and of the
+	// kubernetes manager on /metrics, e.g. :8080: the admission requests, patch operations and latency by
+	// extension and operation, and the webhook certificates expiry. Optional, the endpoint is disabled if omitted
+	MetricsBindAddress string
+
+	// HealthProbeBindAddress is the address of the HTTP endpoint serving the /healthz liveness probe and the
+	// /readyz readiness probe, e.g. :8081. The replica is ready once the webhook server certificates are
+	// generated, the webhook configurations are registered, the webhook servers serve TLS and the checks of
+	// the status server readiness pass, see AddReadyCheck. Optional, the endpoint is disabled if omitted
+	HealthProbeBindAddress string
+
+	// CleanupOnStop removes the webhook configurations when Stop is called, before the webhook servers drain,
+	// so that the API server stops calling them, and the operator namespace label of the watched namespaces
+	// once the Manager stopped. It is meant for the programs and tests embedding a Manager temporarily, not for
+	// the operators whose replicas are replaced in rolling updates. Not supported with EnableLeaderElection.
+	// Optional, defaults to false
+	CleanupOnStop bool
+
+	// PublishCABundle publishes the CA bundle of the webhook server to the <OperatorFingerprint>-ca-bundle
+	// ConfigMap, in the webhook namespace. Optional, defaults to false
+	PublishCABundle bool
+
+	// NamespaceWaitTimeout makes the Manager wait for Namespace to be created at startup, instead of failing,
+	// e.g. when the operator is deployed before Eirini. Optional, defaults to no wait
+	NamespaceWaitTimeout time.Duration
+
+	// ReusePodObjects makes the webhooks decode the admitted pods into pooled objects, reducing allocations.
+	// Extensions must not retain the pod passed to Handle (or its fields) after returning, and should use
+	// pod.DeepCopy() instead. Optional, defaults to false
+	ReusePodObjects bool
+
+	// StrictDecoding makes the webhooks fail to decode the pods with fields unknown to the operator,
+	// e.g. when the cluster is newer than the kubernetes types it was built with. Optional, defaults to false
+	StrictDecoding bool
+
+	// DecodeErrorPolicy is what the webhooks do when a pod can't be decoded: pass-through calls the extension
+	// with the partially decoded pod, allow admits the pod unchanged and deny rejects it. Optional, defaults to pass-through
+	DecodeErrorPolicy DecodeErrorPolicy
+
+	// MinimizePatches drops the patch operations of the extensions which don't change the admitted object,
+	// e.g. the ones of helpers setting defaults unconditionally, reducing the work of the API server and the
+	// reinvocations of the other webhooks. Optional, defaults to false
+	MinimizePatches bool
+
+	// WebhookGroups serve groups of extensions on separate webhook servers, with their own port, certificate,
+	// failure policy and webhook configuration, see WebhookGroup. Optional
+	WebhookGroups []WebhookGroup
+
+	// Chaos injects faults into the webhooks, for rehearsing incidents on test clusters, see ChaosOptions. Optional
+	Chaos *ChaosOptions
+
+	// Handover enables zero-downtime upgrades of the operator, see HandoverOptions. Optional
+	Handover *HandoverOptions
+
+	// EnableLeaderElection elects a leader among the replicas of the operator, which alone labels the
+	// namespaces, registers the webhook configurations, runs the Watchers and the reconcilers, while every
+	// replica serves the admission requests. The lock is the ConfigMap named after NamedLeaderElection in the
+	// webhook namespace, controller-runtime v0.6 having no Lease lock. Optional, defaults to false
+	EnableLeaderElection bool
+
+	// Messages overrides the messages surfaced to the developers by the extensions, see MessageCatalog. Optional
+	Messages *MessageCatalog
+
+	// Locale is the locale of the messages, e.g. fr-CA. Optional
+	Locale string
+
+	// InstallLedgerCRD installs the CustomResourceDefinition of the Ledger entries at startup, see Ledger.
+	// Optional, defaults to false
+	InstallLedgerCRD bool
+
+	// Storage stores the operational data: the ledger of the one-time actions, instead of LedgerEntry resources,
+	// and the recordings written to Manager.Storage(name). See NewFileStorage, NewCRDStorage and NewS3Storage.
+	// Optional
+	Storage Storage
+
+	// InstallStorageCRD installs the CustomResourceDefinition of the StorageObjects used by NewCRDStorage at
+	// startup. Optional, defaults to false
+	InstallStorageCRD bool
+
+	// ReportStatus installs the CustomResourceDefinition of EirinixStatus at startup, and reports the conditions
+	// of the extensions in an EirinixStatus named after the OperatorFingerprint. Optional, defaults to false
+	ReportStatus bool
+
+	// Exemplars attaches the trace ID of the admission requests traced by the API server (from their W3C
+	// traceparent header) as exemplars of the eirinix_admission_duration_seconds histogram, so that a latency
+	// spike links to the traces of the slow requests. The exemplars are only exposed in the OpenMetrics format,
+	// served on the /metrics path of the status server. Optional, defaults to false
+	Exemplars bool
+
+	// SLO enables the availability and latency SLIs of the extensions, and their burn rates, see SLOOptions. Optional
+	SLO *SLOOptions
+
+	// ProfilingLabels tags the goroutines handling the admission requests with the "extension" and "namespace"
+	// pprof labels, so that the CPU profiles captured under load attribute the time to the extensions.
+	// Optional, defaults to false
+	ProfilingLabels bool
+
+	// DrainTimeout is the maximum time the webhook server waits for the in-flight admission requests when the
+	// Manager stops, after it stopped accepting connections. The requests still running are then dropped, and
+	// counted by the eirinix_admission_dropped_in_flight_total metric. Optional, defaults to DefaultDrainTimeout
+	DrainTimeout time.Duration
+
+	// PrewarmCache lists the namespaces, secrets and statefulsets into the shared cache before the Manager
+	// reports ready on the status endpoint, see also CacheWarmingExtension. Optional, defaults to false
+	PrewarmCache bool
+
+	// VerifyReachability makes the Manager create a probe pod with a dry-run request once the webhooks are
+	// registered, to verify the API server reaches them. While it doesn't, the Manager reports not ready
+	// after a grace period of one minute and records WebhookUnreachable events. Optional, defaults to false
+	VerifyReachability bool
+
+	// PluginDir is a directory of Go plugins (.so files) exporting a NewExtension function, whose extensions
+	// are added to the Manager when it starts, see LoadPlugins. Optional
+	PluginDir string
 }
 
 // Config controls the behaviour of different controllers
@@ -157,19 +434,53 @@ type Config struct {
 
 var addToSchemes = runtime.SchemeBuilder{}
 
+// namespaceWaitInterval is the interval between the checks for the existence of the namespace, see NamespaceWaitTimeout
+const namespaceWaitInterval = 2 * time.Second
+
 // AddToScheme adds all Resources to the Scheme
 func AddToScheme(s *runtime.Scheme) error {
 	return addToSchemes.AddToScheme(s)
 }
 
+// NewScheme returns a new scheme with the kubernetes types and the Resources added by AddToScheme. Each Manager
+// uses its own scheme, so that several Managers can run in the same process.
+func NewScheme() (*runtime.Scheme, error) {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		return nil, err
+	}
+	if err := AddToScheme(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// setupContext sets the context of the Manager if it isn't set yet, from the ManagerOptions or with the
+// Manager logger
+func (m *DefaultExtensionManager) setupContext() {
+	if m.Context != nil {
+		return
+	}
+	if m.Options.Context != nil {
+		m.Context = *m.Options.Context
+		return
+	}
+	m.Context = ctxlog.NewManagerContext(m.Logger)
+}
+
 // NewManager returns a manager for the kubernetes cluster.
-// the kubeconfig file and the logger are optional
-func NewManager(opts ManagerOptions) Manager {
+// the kubeconfig file and the logger are optional. It returns an error, without panicking, if the options are
+// invalid (see ManagerOptions.Validate) or the default logger can't be created
+func NewManager(opts ManagerOptions) (Manager, error) {
+
+	if opts.Logger == nil && opts.LogrLogger != nil {
+		opts.Logger = NewZapFromLogr(opts.LogrLogger)
+	}
 
 	if opts.Logger == nil {
-		z, e := zap.NewProduction()
-		if e != nil {
-			panic(errors.New("Cannot create logger"))
+		z, err := zap.NewProduction()
+		if err != nil {
+			return nil, errors.Wrap(err, "creating the logger")
 		}
 		defer z.Sync() // flushes buffer, if any
 		sugar := z.Sugar()
@@ -185,6 +496,10 @@ func NewManager(opts ManagerOptions) Manager {
 		opts.OperatorFingerprint = "eirini-x"
 	}
 
+	if opts.NamingStrategy == nil {
+		opts.NamingStrategy = DefaultNamingStrategy{}
+	}
+
 	if len(opts.SetupCertificateName) == 0 {
 		opts.SetupCertificateName = opts.getSetupCertificateName()
 	}
@@ -204,12 +519,30 @@ func NewManager(opts ManagerOptions) Manager {
 		opts.SetupCertificate = &setupCertificate
 	}
 
-	return &DefaultExtensionManager{Options: opts, Logger: opts.Logger, stopChannel: make(chan struct{})}
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid manager options")
+	}
+
+	m := &DefaultExtensionManager{
+		Options:     opts,
+		Logger:      opts.Logger,
+		stopChannel: make(chan struct{}),
+		sideEffects: newSideEffectQueue(opts.Logger),
+		events:      NewEventBus(opts.Logger),
+	}
+	if opts.SLO != nil {
+		m.slo = newSLOTracker(*opts.SLO)
+	}
+	if opts.Audit != nil {
+		m.audit = newAuditLog(*opts.Audit, opts.OperatorFingerprint, opts.Logger)
+	}
+	return m, nil
 }
 
 // AddExtension adds an Eirini extension to the manager.
 // It accepts Eirinix.Watcher, Eirinix.Reconciler and Eirinix.Extension types.
 func (m *DefaultExtensionManager) AddExtension(v interface{}) error {
+	m.extensionsOrdered = false
 	switch v.(type) {
 	case Extension:
 		m.Extensions = append(m.Extensions, v.(Extension))
@@ -223,6 +556,21 @@ func (m *DefaultExtensionManager) AddExtension(v interface{}) error {
 	return nil
 }
 
+// allExtensions returns the Extensions, Watchers and Reconcilers added to the Manager
+func (m *DefaultExtensionManager) allExtensions() []interface{} {
+	var extensions []interface{}
+	for _, e := range m.Extensions {
+		extensions = append(extensions, e)
+	}
+	for _, w := range m.Watchers {
+		extensions = append(extensions, w)
+	}
+	for _, r := range m.Reconcilers {
+		extensions = append(extensions, r)
+	}
+	return extensions
+}
+
 // ListExtensions returns the list of the Extensions added to the Manager
 func (m *DefaultExtensionManager) ListExtensions() []Extension {
 	return m.Extensions
@@ -230,6 +578,7 @@ func (m *DefaultExtensionManager) ListExtensions() []Extension {
 
 // AddWatcher adds an Erini watcher Extension to the manager
 func (m *DefaultExtensionManager) AddWatcher(w Watcher) {
+	m.extensionsOrdered = false
 	m.Watchers = append(m.Watchers, w)
 }
 
@@ -240,6 +589,7 @@ func (m *DefaultExtensionManager) ListWatchers() []Watcher {
 
 // AddReconciler adds an Erini reconciler Extension to the manager
 func (m *DefaultExtensionManager) AddReconciler(r Reconciler) {
+	m.extensionsOrdered = false
 	m.Reconcilers = append(m.Reconcilers, r)
 }
 
@@ -278,23 +628,47 @@ func (m *DefaultExtensionManager) GetKubeClient() (corev1client.CoreV1Interface,
 	return m.kubeClient, nil
 }
 
-func (m *DefaultExtensionManager) PatchFromPod(req admission.Request, pod *corev1.Pod) admission.Response {
-	marshaledPod, err := json.Marshal(pod)
-	if err != nil {
-		return admission.Errored(http.StatusInternalServerError, err)
+// GetClient returns the client of the kubernetes manager, reading from its cache
+func (m *DefaultExtensionManager) GetClient() client.Client {
+	if m.KubeManager == nil {
+		return nil
 	}
+	return m.KubeManager.GetClient()
+}
+
+// GetScheme returns the scheme of the kubernetes manager
+func (m *DefaultExtensionManager) GetScheme() *runtime.Scheme {
+	if m.KubeManager == nil {
+		return nil
+	}
+	return m.KubeManager.GetScheme()
+}
 
-	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
+// PatchFromPod returns a response admitting the request with the patch turning its pod into the given one
+func (m *DefaultExtensionManager) PatchFromPod(req admission.Request, pod *corev1.Pod) admission.Response {
+	return podwebhook.PatchFromPod(req, pod)
+}
+
+// EnqueueSideEffect schedules a side effect to be run asynchronously, outside of the admission request.
+// Side effects enqueued with the same key before being processed are deduplicated: only the latest one runs.
+func (m *DefaultExtensionManager) EnqueueSideEffect(key string, effect SideEffect) {
+	m.sideEffects.add(key, effect)
+}
+
+// Events returns the event bus shared by the extensions and watchers of the manager
+func (m *DefaultExtensionManager) Events() *EventBus {
+	return m.events
 }
 
 // GenWatcher generates a watcher from a corev1client interface
 func (m *DefaultExtensionManager) GenWatcher(client corev1client.CoreV1Interface) (watch.Interface, error) {
-	podInterface := client.Pods(m.Options.Namespace)
+	namespace := m.Options.watchNamespace()
+	podInterface := client.Pods(namespace)
 
 	startResourceVersion := m.Options.WatcherStartRV
 
 	if startResourceVersion == "" {
-		lw := cache.NewListWatchFromClient(client.RESTClient(), "pods", m.Options.Namespace, fields.Everything())
+		lw := cache.NewListWatchFromClient(client.RESTClient(), "pods", namespace, fields.Everything())
 		list, err := lw.List(metav1.ListOptions{})
 		if err != nil {
 			return nil, err
@@ -308,16 +682,21 @@ func (m *DefaultExtensionManager) GenWatcher(client corev1client.CoreV1Interface
 		startResourceVersion = metaObj.GetResourceVersion()
 	}
 
-	return watchtools.NewRetryWatcher(startResourceVersion, &cache.ListWatch{
+	watcher, err := watchtools.NewRetryWatcher(startResourceVersion, &cache.ListWatch{
 		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
 			options.Watch = true
 
 			if m.Options.FilterEiriniApps != nil && *m.Options.FilterEiriniApps {
-				options.LabelSelector = LabelSourceType + "=APP"
+				layout := m.EiriniLayout()
+				options.LabelSelector = layout.LabelSourceType + "=" + layout.SourceTypeApp
 			}
 
 			return podInterface.Watch(m.Context, options)
 		}})
+	if err != nil {
+		return nil, err
+	}
+	return m.Options.filterNamespaces(watcher), nil
 }
 
 // GetLogger returns the Manager injected logger
@@ -331,11 +710,15 @@ func (m *DefaultExtensionManager) GetManagerOptions() ManagerOptions {
 }
 
 func (m *DefaultExtensionManager) kubeSetup() error {
-	restConfig, err := kubeConfig.NewGetter(m.Logger).Get(m.Options.KubeConfig)
+	restConfig, err := loadKubeConfig(m.Options.KubeConfig)
 	if err != nil {
 		return err
 	}
-	if err := kubeConfig.NewChecker(m.Logger).Check(restConfig); err != nil {
+	checker := m.Options.ConfigChecker
+	if checker == nil {
+		checker = NewConfigChecker()
+	}
+	if err := checker.Check(restConfig); err != nil {
 		return err
 	}
 	m.kubeConnection = restConfig
@@ -358,33 +741,80 @@ func (m *DefaultExtensionManager) GenWebHookServer() {
 			Fs:                afero.NewOsFs(),
 		},
 		m.Credsgen,
-		fmt.Sprintf("%s-mutating-hook", m.Options.OperatorFingerprint),
+		m.Options.resourceName(NamedWebhookConfiguration, ""),
 		m.Options.SetupCertificateName,
 		m.Options.ServiceName,
 		m.Options.WebhookNamespace)
-
-	hookServer := m.KubeManager.GetWebhookServer()
-	hookServer.CertDir = m.WebhookConfig.CertDir
-	hookServer.Port = int(m.Options.Port)
-	hookServer.Host = m.Options.Host
-	m.WebhookServer = hookServer
+	m.WebhookConfig.ValidatingConfigName = m.Options.resourceName(NamedValidatingWebhookConfiguration, "")
+	m.WebhookConfig.Annotations = m.Options.versionAnnotations()
+	m.useCertManager(m.WebhookConfig)
+	m.useProvidedTLS(m.WebhookConfig)
+
+	// The webhook server only holds the registered webhooks, it is served by the admissionServer
+	// which is added to the kubernetes manager in LoadExtensions
+	m.WebhookServer = &webhook.Server{
+		CertDir: m.WebhookConfig.CertDir,
+		Port:    int(m.Options.Port),
+		Host:    m.Options.Host,
+	}
+	m.genWebhookGroups()
 }
 
 // OperatorSetup prepares the webhook server, generates certificates and configuration.
 // It also setups the namespace label for the operator
 func (m *DefaultExtensionManager) OperatorSetup() error {
 
-	if m.GetManagerOptions().Context == nil {
-		m.Context = ctxlog.NewManagerContext(m.Logger)
-	} else {
-		m.Context = *m.GetManagerOptions().Context
-	}
+	m.setupContext()
 
 	m.GenWebHookServer()
+	buildInfo.WithLabelValues(Version(), m.Options.operatorVersion()).Set(1)
+
+	if m.Options.Chaos != nil {
+		m.Logger.Warnf("Chaos mode enabled, faults are injected into the webhooks: %+v", *m.Options.Chaos)
+	}
+
+	if m.Options.ServiceName != "" && m.Options.Service != nil {
+		if err := m.reconcileService(m.Context); err != nil {
+			return errors.Wrap(err, "setting up the webhook service")
+		}
+	}
+
+	if err := m.resolveEiriniLayout(m.Context); err != nil {
+		return errors.Wrap(err, "detecting the eirini release")
+	}
+
+	if err := m.resolveAdmissionRegistrationAPI(); err != nil {
+		return err
+	}
+
+	if m.Options.Autoscaling != nil {
+		if err := m.reconcileAutoscaler(m.Context); err != nil {
+			return errors.Wrap(err, "setting up the operator autoscaler")
+		}
+	}
+
+	if m.Options.InstallLedgerCRD {
+		if err := m.installLedgerCRD(m.Context); err != nil {
+			return errors.Wrap(err, "installing the ledger CRD")
+		}
+	}
+
+	if m.Options.InstallStorageCRD {
+		if err := m.installCRD(m.Context, StorageObjectCRD); err != nil {
+			return errors.Wrap(err, "installing the storage CRD")
+		}
+	}
 
-	if m.Options.Namespace != "" {
-		if err := m.setOperatorNamespaceLabel(); err != nil {
-			return errors.Wrap(err, "setting the operator namespace label")
+	if m.Options.ReportStatus {
+		if err := m.installCRD(m.Context, StatusCRD); err != nil {
+			return errors.Wrap(err, "installing the eirinix status CRD")
+		}
+	}
+
+	// With leader election, the namespaces are labeled by the leader, see leaderSetup
+	if !m.Options.EnableLeaderElection {
+		if err := m.labelNamespaces(); err != nil {
+			return err
 		}
 	}
 
@@ -392,11 +822,33 @@ func (m *DefaultExtensionManager) OperatorSetup() error {
 		if err := m.WebhookConfig.setupCertificate(m.Context); err != nil {
 			return errors.Wrap(err, "setting up the webhook server certificate")
 		}
+		m.exportCertificateExpiry(m.WebhookConfig)
+		for _, g := range m.webhookGroups {
+			if err := g.config.setupCertificate(m.Context); err != nil {
+				return errors.Wrapf(err, "setting up the webhook server certificate of the group %s", g.Name)
+			}
+			m.exportCertificateExpiry(g.config)
+		}
+		if m.Options.PublishCABundle {
+			if err := m.publishCABundle(m.Context); err != nil {
+				return errors.Wrap(err, "publishing the webhook CA bundle")
+			}
+		}
 	}
 	return nil
 }
 
-func (m *DefaultExtensionManager) setOperatorNamespaceLabel() error {
+// labelNamespaces sets the operator namespace label on the watched namespaces, selecting them in the webhooks
+func (m *DefaultExtensionManager) labelNamespaces() error {
+	for _, namespace := range m.Options.WatchedNamespaces() {
+		if err := m.setOperatorNamespaceLabel(namespace); err != nil {
+			return errors.Wrapf(err, "setting the operator namespace label of %s", namespace)
+		}
+	}
+	return nil
+}
+
+func (m *DefaultExtensionManager) setOperatorNamespaceLabel(namespace string) error {
 	c := m.KubeManager.GetClient()
 	ctx := m.Context
 	ns := &unstructured.Unstructured{}
@@ -405,7 +857,20 @@ func (m *DefaultExtensionManager) setOperatorNamespaceLabel() error {
 		Kind:    "Namespace",
 		Version: "v1",
 	})
-	err := c.Get(ctx, machinerytypes.NamespacedName{Name: m.Options.Namespace}, ns)
+	err := c.Get(ctx, machinerytypes.NamespacedName{Name: namespace}, ns)
+	if apierrors.IsNotFound(err) && m.Options.NamespaceWaitTimeout > 0 {
+		m.Logger.Infof("Namespace %s doesn't exist yet, waiting up to %s for its creation", namespace, m.Options.NamespaceWaitTimeout)
+		err = wait.PollImmediate(namespaceWaitInterval, m.Options.NamespaceWaitTimeout, func() (bool, error) {
+			err := c.Get(ctx, machinerytypes.NamespacedName{Name: namespace}, ns)
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return err == nil, err
+		})
+		if err == wait.ErrWaitTimeout {
+			err = errors.Errorf("namespace %s was not created within %s", namespace, m.Options.NamespaceWaitTimeout)
+		}
+	}
 
 	if err != nil {
 		return errors.Wrap(err, "getting the namespace object")
@@ -415,7 +880,7 @@ func (m *DefaultExtensionManager) setOperatorNamespaceLabel() error {
 	if labels == nil {
 		labels = map[string]string{}
 	}
-	labels[m.Options.getDefaultNamespaceLabel()] = m.Options.Namespace
+	labels[m.Options.getDefaultNamespaceLabel()] = namespace
 	ns.SetLabels(labels)
 	err = c.Update(ctx, ns)
 
@@ -453,14 +918,33 @@ func (m *DefaultExtensionManager) SetManagerOptions(o ManagerOptions) {
 
 // RegisterExtensions generates the manager and the operator setup, and loads the extensions to the webhook server
 func (m *DefaultExtensionManager) RegisterExtensions() error {
+	// RegisterExtensions can be called without Start, the permission checks need the context
+	m.setupContext()
+
+	if err := m.orderExtensions(); err != nil {
+		return err
+	}
+
+	if err := m.ConfigureExtensions(); err != nil {
+		return err
+	}
+
 	if err := m.generateManager(); err != nil {
 		return err
 	}
 
+	if err := m.checkRequiredPermissions(); err != nil {
+		return err
+	}
+
 	if err := m.OperatorSetup(); err != nil {
 		return err
 	}
 
+	if err := m.checkPermissions(); err != nil {
+		return err
+	}
+
 	// Setup Scheme for all resources
 	if err := AddToScheme(m.KubeManager.GetScheme()); err != nil {
 		return err
@@ -471,25 +955,170 @@ func (m *DefaultExtensionManager) RegisterExtensions() error {
 
 // LoadExtensions generates and register webhooks from the Extensions added to the Manager
 func (m *DefaultExtensionManager) LoadExtensions() error {
+	if err := validateExtensionNames(m.allExtensions()); err != nil {
+		return err
+	}
+	if err := m.addExtensionSchemes(); err != nil {
+		return err
+	}
 
+	groups := m.servingGroups()
 	var webhooks []MutatingWebhook
 	for k, e := range m.Extensions {
+		group, err := extensionGroup(groups, e)
+		if err != nil {
+			return err
+		}
+		opts := m.Options
+		if group.FailurePolicy != nil {
+			opts.FailurePolicy = group.FailurePolicy
+		}
+
 		w := NewWebhook(e, m)
-		err := w.RegisterAdmissionWebHook(m.WebhookServer,
+		err = w.RegisterAdmissionWebHook(group.server,
 			WebhookOptions{
-				ID:             strconv.Itoa(k),
+				ID:             extensionID(k, e),
 				Manager:        m.KubeManager,
-				ManagerOptions: m.Options,
+				ManagerOptions: opts,
+				EiriniLayout:   m.EiriniLayout(),
+				slo:            m.slo,
+				audit:          m.audit,
 			})
 		if err != nil {
 			return err
 		}
+		group.webhooks = append(group.webhooks, w)
 		webhooks = append(webhooks, w)
 	}
+	m.groups = groups
+
+	// The default webhook server is always served, for the handover and the probes
+	server := newAdmissionServer(m.WebhookServer, groups[0].webhooks, m.Options, m.Logger)
+	clientAuth, err := m.newClientAuthenticator(server.certDir)
+	if err != nil {
+		return errors.Wrap(err, "setting up the client authentication of the webhook server")
+	}
+	server.clientAuth = clientAuth
+	m.watchCertificateRejections(server, groups[0])
+	if err := m.KubeManager.Add(server); err != nil {
+		return errors.Wrap(err, "adding the webhook server to the manager")
+	}
+	m.admissionServers = []*admissionServer{server}
+	for _, g := range groups[1:] {
+		if len(g.webhooks) == 0 {
+			continue
+		}
+		server := newAdmissionServer(g.server, g.webhooks, m.Options, m.Logger)
+		if server.clientAuth, err = m.newClientAuthenticator(server.certDir); err != nil {
+			return errors.Wrapf(err, "setting up the client authentication of the webhook server of the group %s", g.Name)
+		}
+		m.watchCertificateRejections(server, g)
+		if err := m.KubeManager.Add(server); err != nil {
+			return errors.Wrapf(err, "adding the webhook server of the group %s to the manager", g.Name)
+		}
+		m.admissionServers = append(m.admissionServers, server)
+	}
+
+	if err := m.KubeManager.Add(m.sideEffects); err != nil {
+		return errors.Wrap(err, "adding the side effects queue to the manager")
+	}
+
+	if m.Options.ServiceName != "" && m.Options.Service != nil {
+		if err := m.KubeManager.Add(&serviceReconciler{manager: m, logger: m.Logger}); err != nil {
+			return errors.Wrap(err, "adding the webhook service reconciler to the manager")
+		}
+	}
+
+	if m.slo != nil {
+		if err := m.KubeManager.Add(&sloReporter{tracker: m.slo, logger: m.Logger}); err != nil {
+			return errors.Wrap(err, "adding the SLO reporter to the manager")
+		}
+	}
+
+	if m.audit != nil {
+		if err := m.KubeManager.Add(m.audit); err != nil {
+			return errors.Wrap(err, "adding the audit log to the manager")
+		}
+	}
+
+	if m.Options.Autoscaling != nil {
+		if err := m.KubeManager.Add(&autoscalerReconciler{manager: m, logger: m.Logger}); err != nil {
+			return errors.Wrap(err, "adding the operator autoscaler reconciler to the manager")
+		}
+	}
+
+	if objects := m.cachedObjects(); len(objects) > 0 {
+		m.cacheWarmer = &cacheWarmer{cache: m.KubeManager.GetCache(), objects: objects, logger: m.Logger}
+		if err := m.KubeManager.Add(m.cacheWarmer); err != nil {
+			return errors.Wrap(err, "adding the cache warmer to the manager")
+		}
+	}
+
+	if m.Options.Handover != nil {
+		// The handover checks the default webhook server
+		h, err := m.newHandover(groups[0].webhooks)
+		if err != nil {
+			return errors.Wrap(err, "setting up the handover")
+		}
+		m.handover = h
+		if err := m.KubeManager.Add(h); err != nil {
+			return errors.Wrap(err, "adding the handover to the manager")
+		}
+	}
+
+	if m.Options.StatusBindAddress != "" && m.Options.StatusBindAddress != "0" {
+		status := &statusServer{addr: m.Options.StatusBindAddress, handler: m.StatusHandler(), logger: m.Logger}
+		if err := m.KubeManager.Add(status); err != nil {
+			return errors.Wrap(err, "adding the status server to the manager")
+		}
+	}
+
+	if m.Options.HealthProbeBindAddress != "" && m.Options.HealthProbeBindAddress != "0" {
+		if err := m.addHealthProbes(); err != nil {
+			return errors.Wrap(err, "adding the health probes to the manager")
+		}
+	}
+
+	if m.Options.ReportStatus {
+		if err := m.KubeManager.Add(&statusReporter{manager: m, logger: m.Logger}); err != nil {
+			return errors.Wrap(err, "adding the status reporter to the manager")
+		}
+	}
+
+	if m.Options.CertManager != nil {
+		if err := m.KubeManager.Add(&issuedCertificateSync{manager: m, logger: m.Logger}); err != nil {
+			return errors.Wrap(err, "adding the certificate reloader to the manager")
+		}
+	}
+
+	if m.Options.CertificateRotation != nil {
+		if err := m.KubeManager.Add(&certificateRotator{manager: m, options: m.Options.CertificateRotation, logger: m.Logger}); err != nil {
+			return errors.Wrap(err, "adding the certificate rotator to the manager")
+		}
+	}
+
+	if m.Options.TLS != nil && m.Options.TLS.CertDir != "" {
+		if err := m.KubeManager.Add(&providedCertificateSync{manager: m, logger: m.Logger}); err != nil {
+			return errors.Wrap(err, "adding the provided certificate reloader to the manager")
+		}
+	}
 
-	if m.Options.RegisterWebHook == nil || m.Options.RegisterWebHook != nil && *m.Options.RegisterWebHook {
-		if err := m.WebhookConfig.registerWebhooks(m.Context, webhooks); err != nil {
-			return errors.Wrap(err, "generating the webhook server configuration")
+	if m.Options.EnableLeaderElection {
+		if err := m.KubeManager.Add(&leaderSetup{manager: m, logger: m.Logger}); err != nil {
+			return errors.Wrap(err, "adding the leader setup to the manager")
+		}
+	} else if err := m.registerWebhookConfigurations(); err != nil {
+		return err
+	}
+
+	// The webhooks may be registered by another binary, see RegisterWebHook
+	if m.Options.VerifyReachability {
+		prober := m.newReachabilityProber(webhooks)
+		if err := m.readyChecks.add(reachabilityCheckName, prober.check); err != nil {
+			return err
+		}
+		if err := m.KubeManager.Add(prober); err != nil {
+			return errors.Wrap(err, "adding the reachability prober to the manager")
 		}
 	}
 
@@ -498,25 +1127,77 @@ func (m *DefaultExtensionManager) LoadExtensions() error {
 			return err
 		}
 	}
+
+	m.extensionsLoaded = true
+	m.registration.done(nil)
+	for _, ref := range m.extensionRefs() {
+		extensionEnabled.WithLabelValues(ref.name, ref.kind, extensionVersion(ref.extension)).Set(1)
+	}
 	return nil
 }
 
+// registerWebhookConfigurations registers the webhook configurations of the default group and of the
+// WebhookGroups, unless RegisterWebHook is disabled
+func (m *DefaultExtensionManager) registerWebhookConfigurations() error {
+	if m.Options.RegisterWebHook != nil && !*m.Options.RegisterWebHook {
+		return nil
+	}
+
+	// The failure policy isn't patched while the configurations are registered, see SetFailurePolicy
+	m.failurePolicyMu.Lock()
+	defer m.failurePolicyMu.Unlock()
+
+	if err := m.WebhookConfig.registerWebhooks(m.Context, m.groups[0].webhooks); err != nil {
+		return errors.Wrap(err, "generating the webhook server configuration")
+	}
+	for _, g := range m.groups[1:] {
+		if err := g.config.registerWebhooks(m.Context, g.webhooks); err != nil {
+			return errors.Wrapf(err, "generating the webhook server configuration of the group %s", g.Name)
+		}
+	}
+	m.webhooksConfigured = true
+	return nil
+}
+
+// exportCertificateExpiry sets the expiry metric of the webhook server certificate, labeled with its secret name
+func (m *DefaultExtensionManager) exportCertificateExpiry(config *WebhookConfig) {
+	expiry, err := config.certificateExpiry()
+	if err != nil {
+		m.Logger.Debugf("Not exporting the expiry of the webhook certificate %s: %s", config.setupCertificateName, err.Error())
+		return
+	}
+	certificateExpiry.WithLabelValues(config.setupCertificateName).Set(float64(expiry.Unix()))
+}
+
 func (m *DefaultExtensionManager) generateManager() error {
-	m.Credsgen = inmemorycredgen.NewInMemoryGenerator(m.Logger)
+	if m.Credsgen == nil {
+		m.Credsgen = NewCredentialGenerator()
+	}
 	kubeConn, err := m.GetKubeConnection()
 	if err != nil {
 		return errors.Wrap(err, "Failed connecting to kubernetes cluster")
 	}
 
-	mgr, err := manager.New(
-		kubeConn,
-		manager.Options{
-			Namespace:          m.Options.Namespace,
-			MetricsBindAddress: "0",
-			LeaderElection:     false,
-			Port:               int(m.Options.Port),
-			Host:               m.Options.Host,
-		})
+	scheme := m.Options.Scheme
+	if scheme == nil {
+		if scheme, err = NewScheme(); err != nil {
+			return errors.Wrap(err, "building the manager scheme")
+		}
+	}
+
+	// The webhook servers are given the time to drain their in-flight requests when the manager stops
+	shutdownTimeout := m.Options.drainTimeout() + shutdownMargin
+	opts := manager.Options{
+		Scheme:                  scheme,
+		MetricsBindAddress:      m.Options.metricsBindAddress(),
+		HealthProbeBindAddress:  m.Options.HealthProbeBindAddress,
+		Port:                    int(m.Options.Port),
+		Host:                    m.Options.Host,
+		GracefulShutdownTimeout: &shutdownTimeout,
+	}
+	m.Options.setCacheNamespaces(&opts)
+	m.Options.setLeaderElection(&opts)
+	mgr, err := manager.New(kubeConn, opts)
 	if err != nil {
 		return err
 	}
@@ -534,12 +1215,20 @@ func (m *DefaultExtensionManager) HandleEvent(e watch.Event) {
 	}
 }
 
-// ReadWatcherEvent tries to read events from the watcher channel. It should be run in a loop.
+// ReadWatcherEvent tries to read events from the watcher channel. It should be run in a loop. With
+// ManagerOptions.WatcherQueue, the events are queued for each Watcher instead of being handled in turn.
 func (m *DefaultExtensionManager) ReadWatcherEvent(w watch.Interface) {
 	resultChannel := w.ResultChan()
+	queues := m.watcherQueues()
 
 	for e := range resultChannel {
-		m.HandleEvent(e)
+		if queues == nil {
+			m.HandleEvent(e)
+			continue
+		}
+		for _, q := range queues {
+			q.push(e)
+		}
 	}
 }
 
@@ -547,6 +1236,8 @@ func (m *DefaultExtensionManager) ReadWatcherEvent(w watch.Interface) {
 func (m *DefaultExtensionManager) Watch() error {
 	defer m.Logger.Sync()
 
+	m.setupContext()
+
 	client, err := m.GetKubeClient()
 	if err != nil {
 		return err
@@ -555,8 +1246,6 @@ func (m *DefaultExtensionManager) Watch() error {
 	if err != nil {
 		return err
 	}
-	m.Context = ctxlog.NewManagerContext(m.Logger)
-
 	m.watcher = watcher
 
 	m.ReadWatcherEvent(watcher)
@@ -564,34 +1253,80 @@ func (m *DefaultExtensionManager) Watch() error {
 	return &WatcherChannelClosedError{"Watcher channel closed"}
 }
 
-// Start starts the Manager infinite loop, and returns an error on failure
+// Start starts the Manager infinite loop, and returns an error on failure. It is StartContext with a context
+// which is never done: the Manager runs until Stop is called.
 func (m *DefaultExtensionManager) Start() error {
+	return m.StartContext(context.Background())
+}
+
+// run is the infinite loop of the Manager, until the stop channel is closed
+func (m *DefaultExtensionManager) run() error {
 	defer m.Logger.Sync()
 
-	if len(m.Watchers) >= 0 {
+	running := m.setRunning()
+	defer close(running)
+
+	// The context is set before the watchers and the extensions are started concurrently
+	m.setupContext()
+
+	if m.Options.PluginDir != "" {
+		if _, err := m.LoadPlugins(m.Options.PluginDir); err != nil {
+			m.registration.done(err)
+			return err
+		}
+	}
+
+	// The extensions are ordered before the watchers start handling events
+	if err := m.orderExtensions(); err != nil {
+		m.registration.done(err)
+		return err
+	}
+
+	if m.Options.WatcherMode {
+		return m.watchOnly()
+	}
+
+	// With leader election, the watchers run on the leader, see leaderSetup
+	if len(m.Watchers) > 0 && !m.Options.EnableLeaderElection {
 		go m.Watch()
 	}
 
 	if err := m.RegisterExtensions(); err != nil {
+		m.registration.done(err)
 		return err
 	}
 
 	return m.KubeManager.Start(m.stopChannel)
 }
 
-func (m *DefaultExtensionManager) Stop() {
-	defer m.Logger.Sync()
+func (o *ManagerOptions) getDefaultNamespaceLabel() string {
+	return o.resourceName(NamedNamespaceLabel, "")
+}
 
-	close(m.stopChannel)
-	if m.watcher != nil {
-		m.watcher.Stop()
+// operatorPodLabels returns the labels of the operator pods, defaulting to the selector of the Service
+func (o *ManagerOptions) operatorPodLabels() map[string]string {
+	if len(o.OperatorPodLabels) == 0 && o.Service != nil {
+		return o.Service.Selector
 	}
+	return o.OperatorPodLabels
 }
 
-func (o *ManagerOptions) getDefaultNamespaceLabel() string {
-	return fmt.Sprintf("%s-ns", o.OperatorFingerprint)
+// drainTimeout returns the time the webhook server waits for the in-flight requests when stopping
+func (o *ManagerOptions) drainTimeout() time.Duration {
+	if o.DrainTimeout == 0 {
+		return DefaultDrainTimeout
+	}
+	return o.DrainTimeout
+}
+
+// metricsBindAddress returns the address of the metrics endpoint of the kubernetes manager, "0" disabling it
+func (o *ManagerOptions) metricsBindAddress() string {
+	if o.MetricsBindAddress == "" {
+		return "0"
+	}
+	return o.MetricsBindAddress
 }
 
 func (o *ManagerOptions) getSetupCertificateName() string {
-	return fmt.Sprintf("%s-setupcertificate", o.OperatorFingerprint)
+	return o.resourceName(NamedSetupCertificate, "")
 }
@@ -8,9 +8,6 @@ import (
 	"path/filepath"
 	"time"
 
-	credsgen "code.cloudfoundry.org/quarks-utils/pkg/credsgen"
-	gfakes "code.cloudfoundry.org/quarks-utils/pkg/credsgen/fakes"
-
 	. "code.cloudfoundry.org/eirinix"
 	catalog "code.cloudfoundry.org/eirinix/testing"
 	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
@@ -18,7 +15,10 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/spf13/afero"
 
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -42,7 +42,7 @@ var _ = Describe("Extension Manager", func() {
 		manager                             *cfakes.FakeManager
 		client                              *cfakes.FakeClient
 		ctx                                 context.Context
-		generator                           *gfakes.FakeGenerator
+		generator                           *cfakes.FakeCredentialGenerator
 		eirinixcatalog                      catalog.Catalog
 		ServiceManager, Manager             Manager
 		eiriniServiceManager, eiriniManager *DefaultExtensionManager
@@ -65,8 +65,8 @@ var _ = Describe("Extension Manager", func() {
 		manager.GetRESTMapperReturns(restMapper)
 		manager.GetWebhookServerReturns(&webhook.Server{})
 
-		generator = &gfakes.FakeGenerator{}
-		generator.GenerateCertificateReturns(credsgen.Certificate{Certificate: []byte("thecert")}, nil)
+		generator = &cfakes.FakeCredentialGenerator{}
+		generator.GenerateCertificateReturns(Certificate{Certificate: []byte("thecert")}, nil)
 
 		ctx = catalog.NewContext()
 
@@ -96,6 +96,13 @@ var _ = Describe("Extension Manager", func() {
 			Expect(Manager.GetLogger()).ToNot(BeNil())
 			Expect(Manager.ListExtensions()).To(BeEmpty())
 		})
+		It("exposes the client and the scheme of the kubernetes manager", func() {
+			Expect(Manager.GetClient()).To(BeIdenticalTo(client))
+			Expect(Manager.GetScheme()).To(BeIdenticalTo(scheme.Scheme))
+
+			eiriniManager.KubeManager = nil
+			Expect(Manager.GetClient()).To(BeNil())
+		})
 		It("provides option setter", func() {
 			o := Manager.GetManagerOptions()
 			o.Namespace = "test"
@@ -142,6 +149,44 @@ var _ = Describe("Extension Manager", func() {
 			Expect(generator.GenerateCertificateCallCount()).To(Equal(2)) // Generate CA and certificate
 			Expect(client.CreateCallCount()).To(Equal(2))                 // Persist secret and the webhook config
 		})
+
+		It("stamps the versions on the generated objects", func() {
+			eiriniManager.Options.SetupCertificateName = "test-setupcert"
+			eiriniManager.Options.OperatorVersion = "1.2.3"
+			defer os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			Expect(client.CreateCallCount()).To(Equal(2))
+			for i := 0; i < 2; i++ {
+				_, object, _ := client.CreateArgsForCall(i)
+				annotations := object.(metav1.Object).GetAnnotations()
+				Expect(annotations).To(HaveKeyWithValue(AnnotationOperatorVersion, "1.2.3"))
+				Expect(annotations).To(HaveKeyWithValue(AnnotationVersion, Version()))
+			}
+		})
+
+		It("publishes the CA bundle", func() {
+			eiriniManager.Options.SetupCertificateName = "test-setupcert"
+			eiriniManager.Options.PublishCABundle = true
+			defer os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+
+			_, err := eiriniManager.GetCABundle()
+			Expect(err).To(HaveOccurred())
+
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+
+			caBundle, err := eiriniManager.GetCABundle()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(caBundle)).To(Equal("thecert"))
+
+			Expect(client.CreateCallCount()).To(Equal(2)) // Persist secret and the CA bundle
+			_, object, _ := client.CreateArgsForCall(1)
+			configMap := object.(*corev1.ConfigMap)
+			Expect(configMap.Name).To(Equal("eirini-x-ca-bundle"))
+			Expect(configMap.Data).To(HaveKeyWithValue(CABundleKey, "thecert"))
+		})
 	})
 
 	It("sets the operator namespace label", func() {
@@ -160,6 +205,175 @@ var _ = Describe("Extension Manager", func() {
 
 	})
 
+	It("sets the operator namespace label on every watched namespace", func() {
+		eiriniManager.Options.Namespaces = []string{"cf-workloads"}
+		var labeled []string
+		client.UpdateCalls(func(_ context.Context, object runtime.Object, _ ...crc.UpdateOption) error {
+			ns := object.(*unstructured.Unstructured)
+			labeled = append(labeled, ns.GetLabels()["eirini-x-ns"])
+			return nil
+		})
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(labeled).To(Equal([]string{"cf-workloads", "default"}))
+	})
+
+	It("waits for the namespace to be created", func() {
+		eiriniManager.Options.NamespaceWaitTimeout = time.Minute
+		client.GetReturnsOnCall(0, apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "default"))
+
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(client.GetCallCount()).To(BeNumerically(">=", 2))
+		Expect(client.UpdateCallCount()).To(Equal(1))
+	})
+
+	It("fails if the namespace doesn't exist and no wait is configured", func() {
+		client.GetReturnsOnCall(0, apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "default"))
+
+		err := eiriniManager.OperatorSetup()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("getting the namespace object"))
+	})
+
+	Context("when the webhook service is managed", func() {
+		BeforeEach(func() {
+			setupCertificate := false
+			eiriniManager.Options.SetupCertificate = &setupCertificate
+			eiriniManager.Options.Namespace = ""
+			eiriniManager.Options.ServiceName = "eirinix"
+			eiriniManager.Options.WebhookNamespace = "default"
+			eiriniManager.Options.Service = &ServiceOptions{
+				PortName:              "https-webhook",
+				InternalTrafficPolicy: "Local",
+				IPFamilyPolicy:        "PreferDualStack",
+				IPFamilies:            []string{"IPv4", "IPv6"},
+			}
+			client.GetCalls(func(_ context.Context, key types.NamespacedName, object runtime.Object) error {
+				return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+			})
+		})
+
+		It("creates the service and its endpoints", func() {
+			Expect(eiriniManager.Options.Validate()).To(Succeed())
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(client.CreateCallCount()).To(Equal(2))
+
+			_, object, _ := client.CreateArgsForCall(0)
+			service := object.(*unstructured.Unstructured)
+			Expect(service.GetKind()).To(Equal("Service"))
+			Expect(service.GetName()).To(Equal("eirinix"))
+			Expect(service.GetNamespace()).To(Equal("default"))
+			Expect(service.GetLabels()).To(HaveKeyWithValue(LabelManagedBy, "eirini-x"))
+			spec := service.Object["spec"].(map[string]interface{})
+			Expect(spec).To(HaveKeyWithValue("internalTrafficPolicy", "Local"))
+			Expect(spec).To(HaveKeyWithValue("ipFamilyPolicy", "PreferDualStack"))
+			Expect(spec["ipFamilies"]).To(Equal([]interface{}{"IPv4", "IPv6"}))
+			ports, _, _ := unstructured.NestedSlice(service.Object, "spec", "ports")
+			Expect(ports).To(HaveLen(1))
+			Expect(ports[0]).To(HaveKeyWithValue("name", "https-webhook"))
+			Expect(ports[0]).To(HaveKeyWithValue("port", int64(90)))
+
+			_, object, _ = client.CreateArgsForCall(1)
+			endpoints := object.(*unstructured.Unstructured)
+			Expect(endpoints.GetKind()).To(Equal("Endpoints"))
+			subsets, _, _ := unstructured.NestedSlice(endpoints.Object, "subsets")
+			Expect(subsets).To(HaveLen(1))
+			Expect(subsets[0].(map[string]interface{})["addresses"]).To(ConsistOf(HaveKeyWithValue("ip", "127.0.0.1")))
+		})
+
+		It("only creates the service when it selects the operator pods", func() {
+			eiriniManager.Options.Service.Selector = map[string]string{"app": "eirinix"}
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(client.CreateCallCount()).To(Equal(1))
+
+			_, object, _ := client.CreateArgsForCall(0)
+			spec := object.(*unstructured.Unstructured).Object["spec"].(map[string]interface{})
+			Expect(spec["selector"]).To(Equal(map[string]interface{}{"app": "eirinix"}))
+		})
+
+		It("declares the permissions to manage the service", func() {
+			Expect(eiriniManager.RequiredPermissions()).To(ContainElement(rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"endpoints", "services"},
+				Verbs:     []string{"create", "get", "update"},
+			}))
+		})
+
+		It("rejects invalid service options", func() {
+			eiriniManager.Options.Service.IPFamilyPolicy = "SingleStack"
+			eiriniManager.Options.Service.InternalTrafficPolicy = "Nearby"
+			err := eiriniManager.Options.Validate()
+			Expect(err).To(MatchError(ContainSubstring("service.ipFamilyPolicy")))
+			Expect(err).To(MatchError(ContainSubstring("service.internalTrafficPolicy")))
+		})
+	})
+
+	Context("when the operator is autoscaled", func() {
+		BeforeEach(func() {
+			setupCertificate := false
+			eiriniManager.Options.SetupCertificate = &setupCertificate
+			eiriniManager.Options.Namespace = ""
+			eiriniManager.Options.WebhookNamespace = "default"
+			eiriniManager.Options.Backpressure = &BackpressureOptions{MaxInFlight: 50}
+			eiriniManager.Options.Autoscaling = &AutoscalingOptions{Deployment: "eirinix", MaxReplicas: 5}
+			client.GetCalls(func(_ context.Context, key types.NamespacedName, object runtime.Object) error {
+				return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+			})
+		})
+
+		It("creates the autoscaler of the operator deployment", func() {
+			Expect(eiriniManager.Options.Validate()).To(Succeed())
+			Expect(eiriniManager.OperatorSetup()).To(Succeed())
+			Expect(client.CreateCallCount()).To(Equal(1))
+
+			_, object, _ := client.CreateArgsForCall(0)
+			hpa := object.(*unstructured.Unstructured)
+			Expect(hpa.GetKind()).To(Equal("HorizontalPodAutoscaler"))
+			Expect(hpa.GetName()).To(Equal("eirinix"))
+			Expect(hpa.GetNamespace()).To(Equal("default"))
+			Expect(hpa.GetLabels()).To(HaveKeyWithValue(LabelManagedBy, "eirini-x"))
+			spec := hpa.Object["spec"].(map[string]interface{})
+			Expect(spec["scaleTargetRef"]).To(HaveKeyWithValue("kind", "Deployment"))
+			Expect(spec).To(HaveKeyWithValue("minReplicas", int64(1)))
+			Expect(spec).To(HaveKeyWithValue("maxReplicas", int64(5)))
+			Expect(spec["metrics"]).To(HaveLen(1))
+			pods := spec["metrics"].([]interface{})[0].(map[string]interface{})["pods"].(map[string]interface{})
+			Expect(pods["metric"]).To(HaveKeyWithValue("name", "eirinix_admission_saturation_ratio"))
+			Expect(pods["target"]).To(HaveKeyWithValue("averageValue", "700m"))
+		})
+
+		It("declares the permissions to manage the autoscaler", func() {
+			Expect(eiriniManager.RequiredPermissions()).To(ContainElement(rbacv1.PolicyRule{
+				APIGroups: []string{"autoscaling"},
+				Resources: []string{"horizontalpodautoscalers"},
+				Verbs:     []string{"create", "get", "update"},
+			}))
+		})
+
+		It("requires the backpressure to export the saturation", func() {
+			eiriniManager.Options.Backpressure = nil
+			eiriniManager.Options.Autoscaling.MinReplicas = 10
+			err := eiriniManager.Options.Validate()
+			Expect(err).To(MatchError(ContainSubstring("backpressure")))
+			Expect(err).To(MatchError(ContainSubstring("autoscaling.maxReplicas")))
+		})
+	})
+
+	It("keeps the context of the manager across the setup", func() {
+		eiriniManager.Options.Namespace = ""
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.GetContext()).To(BeIdenticalTo(ctx))
+	})
+
+	It("builds a separate scheme for each manager", func() {
+		first, err := NewScheme()
+		Expect(err).ToNot(HaveOccurred())
+		second, err := NewScheme()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(first).ToNot(BeIdenticalTo(second))
+		Expect(first.Recognizes(corev1.SchemeGroupVersion.WithKind("Pod"))).To(BeTrue())
+		Expect(second.Recognizes(corev1.SchemeGroupVersion.WithKind("Pod"))).To(BeTrue())
+	})
+
 	It("doesn't set the operator namespace label if no namespace if defined", func() {
 		eiriniManager.Options.Namespace = ""
 		err := eiriniManager.OperatorSetup()
@@ -229,6 +443,76 @@ var _ = Describe("Extension Manager", func() {
 
 			Expect(Manager.ListExtensions()).ToNot(BeEmpty())
 		})
+
+		It("switches the failure policy of a live webhook", func() {
+			err := eiriniManager.OperatorSetup()
+			Expect(err).ToNot(HaveOccurred())
+			eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+			err = eiriniManager.LoadExtensions()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(eiriniManager.SetFailurePolicy("*testing.testExtension", admissionregistrationv1beta1.Ignore)).To(Succeed())
+			Expect(client.PatchCallCount()).To(Equal(1))
+			_, object, patch, _ := client.PatchArgsForCall(0)
+			Expect(object.(*admissionregistrationv1beta1.MutatingWebhookConfiguration).Name).To(Equal("eirini-x-mutating-hook"))
+			data, err := patch.Data(object)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(`{"op":"test","path":"/webhooks/0/name","value":"0.eirini-x.org"}`))
+			Expect(string(data)).To(ContainSubstring(`{"op":"replace","path":"/webhooks/0/failurePolicy","value":"Ignore"}`))
+
+			Expect(eiriniManager.SetFailurePolicy("*testing.testExtension", "Sometimes")).ToNot(Succeed())
+			Expect(eiriniManager.SetFailurePolicy("*unknown.Extension", admissionregistrationv1beta1.Ignore)).ToNot(Succeed())
+			Expect(client.PatchCallCount()).To(Equal(1))
+		})
+
+		Context("when the cluster serves the v1 admissionregistration API", func() {
+			var created []runtime.Object
+
+			BeforeEach(func() {
+				restMapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{})
+				restMapper.Add(admissionregistrationv1.SchemeGroupVersion.WithKind("MutatingWebhookConfiguration"), meta.RESTScopeRoot)
+				manager.GetRESTMapperReturns(restMapper)
+				created = nil
+				client.CreateCalls(func(_ context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+					created = append(created, object)
+					return nil
+				})
+			})
+
+			It("generates a v1 webhook configuration", func() {
+				Expect(eiriniManager.OperatorSetup()).To(Succeed())
+				eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+				Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+				Expect(created).To(HaveLen(1))
+				config := created[0].(*admissionregistrationv1.MutatingWebhookConfiguration)
+				Expect(config.Name).To(Equal("eirini-x-mutating-hook"))
+				Expect(config.Webhooks).To(HaveLen(1))
+				wh := config.Webhooks[0]
+				Expect(wh.Name).To(Equal("0.eirini-x.org"))
+				Expect(*wh.FailurePolicy).To(Equal(admissionregistrationv1.Fail))
+				Expect(*wh.SideEffects).To(Equal(admissionregistrationv1.SideEffectClassNoneOnDryRun))
+				Expect(wh.AdmissionReviewVersions).To(Equal([]string{"v1beta1"}))
+				Expect(*wh.MatchPolicy).To(Equal(admissionregistrationv1.Exact))
+				Expect(*wh.TimeoutSeconds).To(Equal(int32(30)))
+				Expect(wh.Rules[0].Resources).To(Equal([]string{"pods"}))
+				Expect(wh.ClientConfig.CABundle).To(ContainSubstring("the-ca-cert"))
+
+				Expect(eiriniManager.SetFailurePolicy("*testing.testExtension", admissionregistrationv1beta1.Ignore)).To(Succeed())
+				_, object, _, _ := client.PatchArgsForCall(0)
+				Expect(object.(*admissionregistrationv1.MutatingWebhookConfiguration).Name).To(Equal("eirini-x-mutating-hook"))
+			})
+
+			It("keeps the v1beta1 API when set in the options", func() {
+				eiriniManager.Options.AdmissionRegistrationAPI = AdmissionRegistrationV1Beta1
+				Expect(eiriniManager.OperatorSetup()).To(Succeed())
+				eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+				Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+				Expect(created).To(HaveLen(1))
+				Expect(created[0]).To(BeAssignableToTypeOf(&admissionregistrationv1beta1.MutatingWebhookConfiguration{}))
+			})
+		})
 	})
 
 	Context("Watchers", func() {
@@ -332,6 +616,54 @@ var _ = Describe("Extension Manager", func() {
 		})
 	})
 
+	Context("in watcher mode", func() {
+		BeforeEach(func() {
+			eiriniManager.Options.WatcherMode = true
+		})
+
+		It("runs the watchers without starting the webhook server", func() {
+			received := make(chan watch.Event)
+			eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcherWithChannel(received))
+
+			podWatch := watch.NewFake()
+			fakeCorev1 := &cfakes.FakeCoreV1Interface{}
+			fakePod := &cfakes.FakePodInterface{}
+			fakePod.WatchReturns(podWatch, nil)
+			fakeCorev1.PodsReturns(fakePod)
+			eiriniManager.SetKubeClient(fakeCorev1)
+
+			done := make(chan error)
+			go func() { done <- eiriniManager.Start() }()
+			Expect(eiriniManager.WaitForReady(context.Background())).To(Succeed())
+
+			go podWatch.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app", ResourceVersion: "2"}})
+			var e watch.Event
+			Eventually(received).Should(Receive(&e))
+			Expect(e.Type).To(Equal(watch.Added))
+			Expect(e.Object.(*corev1.Pod).Name).To(Equal("app"))
+
+			eiriniManager.Stop()
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(manager.StartCallCount()).To(Equal(0))
+			Expect(manager.AddCallCount()).To(Equal(0))
+			Expect(client.CreateCallCount()).To(Equal(0))
+		})
+
+		It("refuses the extensions served by the webhooks", func() {
+			eiriniManager.AddWatcher(eirinixcatalog.SimpleWatcher())
+			eiriniManager.AddExtension(eirinixcatalog.SimpleExtension())
+			err := eiriniManager.Start()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("The watcher mode only runs the Watchers"))
+			Expect(eiriniManager.WaitForReady(context.Background())).NotTo(Succeed())
+		})
+
+		It("requires a watcher", func() {
+			err := eiriniManager.Start()
+			Expect(err).To(MatchError("The watcher mode requires a Watcher"))
+		})
+	})
+
 	Context("Extensions with services", func() {
 		It("doesn't fail", func() {
 			Expect(eiriniServiceManager.Options.Port).To(Equal(int32(8001)))
@@ -0,0 +1,100 @@
+package extension
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// maxMatchConditions is the maximum number of match conditions of a webhook accepted by the API server
+const maxMatchConditions = 64
+
+// MatchCondition is a CEL expression the API server evaluates before calling the webhook of an extension, see
+// WebhookPolicy. The webhook is only called when all the conditions of the extension are true, e.g.
+// `has(object.metadata.labels) && 'cloudfoundry.org/app_guid' in object.metadata.labels`.
+//
+// The conditions are only supported by the v1 admissionregistration API, on Kubernetes 1.27 and later. The API
+// servers not supporting them drop them and call the webhook for every pod, so the extensions still have to
+// skip the irrelevant pods themselves.
+type MatchCondition struct {
+	// Name identifies the condition in the API server errors, a qualified name unique in the extension
+	Name string
+	// Expression is the CEL expression, evaluated with the object, oldObject, request and authorizer variables
+	Expression string
+}
+
+func validateMatchConditions(conditions []MatchCondition) error {
+	if len(conditions) > maxMatchConditions {
+		return errors.Errorf("Too many match conditions, at most %d are supported", maxMatchConditions)
+	}
+	names := map[string]bool{}
+	for _, c := range conditions {
+		if errs := validation.IsQualifiedName(c.Name); len(errs) > 0 {
+			return errors.Errorf("Invalid match condition name %q: %s", c.Name, strings.Join(errs, ", "))
+		}
+		if names[c.Name] {
+			return errors.Errorf("Duplicated match condition %q", c.Name)
+		}
+		names[c.Name] = true
+		if strings.TrimSpace(c.Expression) == "" {
+			return errors.Errorf("The match condition %q has no expression", c.Name)
+		}
+	}
+	return nil
+}
+
+// withMatchConditions adds the match conditions of the webhooks to the versioned configuration generated for
+// them. The Kubernetes API types the Manager is built with predate the conditions, so the configuration is
+// converted to an unstructured object holding them.
+func (f *WebhookConfig) withMatchConditions(config runtime.Object, webhooks []MutatingWebhook) (runtime.Object, error) {
+	found := false
+	for _, w := range webhooks {
+		found = found || len(w.GetMatchConditions()) > 0
+	}
+	if !found {
+		return config, nil
+	}
+	if f.APIVersion != AdmissionRegistrationV1 {
+		return nil, errors.Errorf("The webhook match conditions require the v1 admissionregistration API, the webhooks are registered with the %s one", f.APIVersion)
+	}
+
+	var kind string
+	switch config.(type) {
+	case *admissionregistrationv1.MutatingWebhookConfiguration:
+		kind = "MutatingWebhookConfiguration"
+	case *admissionregistrationv1.ValidatingWebhookConfiguration:
+		kind = "ValidatingWebhookConfiguration"
+	default:
+		return nil, errors.Errorf("Unsupported webhook configuration %T", config)
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "converting the webhook configuration")
+	}
+	entries, _, err := unstructured.NestedSlice(content, "webhooks")
+	if err != nil || len(entries) != len(webhooks) {
+		return nil, errors.Errorf("The webhook configuration doesn't match the %d webhooks", len(webhooks))
+	}
+	for i, w := range webhooks {
+		conditions := w.GetMatchConditions()
+		if len(conditions) == 0 {
+			continue
+		}
+		list := make([]interface{}, 0, len(conditions))
+		for _, c := range conditions {
+			list = append(list, map[string]interface{}{"name": c.Name, "expression": c.Expression})
+		}
+		entries[i].(map[string]interface{})["matchConditions"] = list
+	}
+	if err := unstructured.SetNestedSlice(content, entries, "webhooks"); err != nil {
+		return nil, errors.Wrap(err, "setting the webhook match conditions")
+	}
+
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(admissionregistrationv1.SchemeGroupVersion.WithKind(kind))
+	return u, nil
+}
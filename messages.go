@@ -0,0 +1,107 @@
+package extension
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// MessageCatalog holds the templates of the messages surfaced to the developers, e.g. the denial reasons of the
+// extensions, so that platform operators can brand or translate them. Templates use the text/template syntax,
+// and are looked up by locale, falling back to the language of the locale (e.g. fr for fr-CA), then to the
+// default template of the extension.
+type MessageCatalog struct {
+	mu        sync.RWMutex
+	templates map[string]map[string]*template.Template
+}
+
+// NewMessageCatalog returns an empty MessageCatalog
+func NewMessageCatalog() *MessageCatalog {
+	return &MessageCatalog{templates: map[string]map[string]*template.Template{}}
+}
+
+// Add sets the template of a message for a locale
+func (c *MessageCatalog) Add(locale, id, text string) error {
+	tmpl, err := template.New(id).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return errors.Wrapf(err, "parsing message %s for locale %s", id, locale)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.templates[locale] == nil {
+		c.templates[locale] = map[string]*template.Template{}
+	}
+	c.templates[locale][id] = tmpl
+	return nil
+}
+
+// LoadJSON adds the templates of a JSON document indexed by locale then by message id,
+// e.g. {"fr": {"registry.untrusted": "Images refusées : {{.Images}}"}}
+func (c *MessageCatalog) LoadJSON(r io.Reader) error {
+	messages := map[string]map[string]string{}
+	if err := json.NewDecoder(r).Decode(&messages); err != nil {
+		return errors.Wrap(err, "decoding the message catalog")
+	}
+	for locale, texts := range messages {
+		for id, text := range texts {
+			if err := c.Add(locale, id, text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *MessageCatalog) lookup(locale, id string) *template.Template {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if tmpl, ok := c.templates[locale][id]; ok {
+		return tmpl
+	}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		if tmpl, ok := c.templates[locale[:i]][id]; ok {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+// Render returns the message for the locale, rendered with data. defaultText is the template used when the
+// catalog has none for the message, or when the catalog template fails to render.
+func (c *MessageCatalog) Render(locale, id, defaultText string, data interface{}) (string, error) {
+	if c != nil {
+		if tmpl := c.lookup(locale, id); tmpl != nil {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, data); err == nil {
+				return buf.String(), nil
+			}
+		}
+	}
+
+	tmpl, err := template.New(id).Parse(defaultText)
+	if err != nil {
+		return defaultText, errors.Wrapf(err, "parsing the default text of message %s", id)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return defaultText, errors.Wrapf(err, "rendering message %s", id)
+	}
+	return buf.String(), nil
+}
+
+// Message renders a message surfaced to the developers with the MessageCatalog and the Locale of the
+// ManagerOptions. defaultText is the text/template of the message used when the catalog doesn't override it.
+func (m *DefaultExtensionManager) Message(id, defaultText string, data interface{}) string {
+	msg, err := m.Options.Messages.Render(m.Options.Locale, id, defaultText, data)
+	if err != nil {
+		m.Logger.Errorf("Failed rendering message: %s", err.Error())
+	}
+	return msg
+}
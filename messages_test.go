@@ -0,0 +1,57 @@
+package extension_test
+
+import (
+	"strings"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Message catalog", func() {
+	var (
+		messages      *MessageCatalog
+		eiriniManager *DefaultExtensionManager
+		data          = map[string]string{"Images": "busybox"}
+	)
+
+	BeforeEach(func() {
+		messages = NewMessageCatalog()
+		Expect(messages.LoadJSON(strings.NewReader(`{
+			"fr": {"registry.untrusted-images": "Images non autorisées : {{.Images}}"},
+			"en-GB": {"registry.untrusted-images": "Untrusted images, mate: {{.Images}}"}
+		}`))).To(Succeed())
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Options.Messages = messages
+	})
+
+	It("renders the default text without a catalog entry", func() {
+		eiriniManager.Options.Messages = nil
+		Expect(eiriniManager.Message("registry.untrusted-images", "untrusted: {{.Images}}", data)).To(Equal("untrusted: busybox"))
+
+		eiriniManager.Options.Messages = messages
+		Expect(eiriniManager.Message("other", "other message", nil)).To(Equal("other message"))
+	})
+
+	It("renders the template of the locale", func() {
+		eiriniManager.Options.Locale = "en-GB"
+		Expect(eiriniManager.Message("registry.untrusted-images", "untrusted: {{.Images}}", data)).To(Equal("Untrusted images, mate: busybox"))
+	})
+
+	It("falls back to the language of the locale", func() {
+		eiriniManager.Options.Locale = "fr-CA"
+		Expect(eiriniManager.Message("registry.untrusted-images", "untrusted: {{.Images}}", data)).To(Equal("Images non autorisées : busybox"))
+	})
+
+	It("falls back to the default text when the template fails", func() {
+		Expect(messages.Add("fr", "registry.untrusted-images", "{{.Missing}}")).To(Succeed())
+		eiriniManager.Options.Locale = "fr"
+		Expect(eiriniManager.Message("registry.untrusted-images", "untrusted: {{.Images}}", data)).To(Equal("untrusted: busybox"))
+	})
+
+	It("rejects invalid templates", func() {
+		Expect(messages.Add("fr", "broken", "{{.Images")).ToNot(Succeed())
+	})
+})
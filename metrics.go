@@ -0,0 +1,257 @@
+package extension
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "eirinix"
+
+// MetricType is the prometheus type of a metric
+type MetricType string
+
+const (
+	// MetricCounter is a prometheus counter
+	MetricCounter MetricType = "counter"
+	// MetricGauge is a prometheus gauge
+	MetricGauge MetricType = "gauge"
+	// MetricHistogram is a prometheus histogram
+	MetricHistogram MetricType = "histogram"
+)
+
+// MetricDescription describes a metric exported by eirinix, to generate dashboards and alerts
+// which follow the metric names and labels
+type MetricDescription struct {
+	// Name is the full name of the metric
+	Name string `json:"name"`
+	// Help is the metric description
+	Help string `json:"help"`
+	// Type is the prometheus type of the metric
+	Type MetricType `json:"type"`
+	// Labels are the metric labels
+	Labels []string `json:"labels,omitempty"`
+	// Unit is the Grafana unit of the metric values, e.g. "s"
+	Unit string `json:"unit,omitempty"`
+}
+
+var metricDescriptions []MetricDescription
+
+// MetricDescriptions returns the descriptions of the metrics exported by eirinix
+func MetricDescriptions() []MetricDescription {
+	descriptions := make([]MetricDescription, len(metricDescriptions))
+	copy(descriptions, metricDescriptions)
+	return descriptions
+}
+
+func describe(subsystem, name, help string, t MetricType, unit string, labels ...string) prometheus.Opts {
+	metricDescriptions = append(metricDescriptions, MetricDescription{
+		Name:   prometheus.BuildFQName(metricsNamespace, subsystem, name),
+		Help:   help,
+		Type:   t,
+		Labels: labels,
+		Unit:   unit,
+	})
+	return prometheus.Opts{Namespace: metricsNamespace, Subsystem: subsystem, Name: name, Help: help}
+}
+
+func newCounterVec(subsystem, name, help string, labels ...string) *prometheus.CounterVec {
+	opts := describe(subsystem, name, help, MetricCounter, "ops", labels...)
+	return prometheus.NewCounterVec(prometheus.CounterOpts(opts), labels)
+}
+
+func newGaugeVec(subsystem, name, help, unit string, labels ...string) *prometheus.GaugeVec {
+	opts := describe(subsystem, name, help, MetricGauge, unit, labels...)
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), labels)
+}
+
+func newHistogramVec(subsystem, name, help string, labels ...string) *prometheus.HistogramVec {
+	opts := describe(subsystem, name, help, MetricHistogram, "s", labels...)
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: opts.Namespace,
+		Subsystem: opts.Subsystem,
+		Name:      opts.Name,
+		Help:      opts.Help,
+		Buckets:   prometheus.DefBuckets,
+	}, labels)
+}
+
+var (
+	admissionRequests = newCounterVec("admission", "requests_total",
+		"Number of admission requests handled by the extensions, by extension, operation (CREATE, UPDATE, DELETE or CONNECT) and result (allowed, denied or errored).",
+		"extension", "operation", "result")
+
+	admissionDuration = newHistogramVec("admission", "duration_seconds",
+		"Time spent by the extensions handling admission requests, by extension and operation.",
+		"extension", "operation")
+
+	admissionPatchOperations = newCounterVec("admission", "patch_operations_total",
+		"Number of patch operations returned by the extensions on the admitted objects, by extension and operation.",
+		"extension", "operation")
+
+	decodeErrors = newCounterVec("admission", "decode_errors_total",
+		"Number of admission requests whose pod couldn't be decoded, by extension and decode error policy.",
+		"extension", "policy")
+
+	patchOperationsDropped = newCounterVec("admission", "patch_operations_dropped_total",
+		"Number of patch operations dropped because they didn't change the admitted object, by extension, see MinimizePatches.",
+		"extension")
+
+	admissionInFlight = newGaugeVec("admission", "in_flight",
+		"Number of admission requests being served by the replica, with backpressure enabled.",
+		"none")
+
+	admissionMaxInFlight = newGaugeVec("admission", "max_in_flight",
+		"Maximum number of admission requests served concurrently by the replica, see BackpressureOptions.",
+		"none")
+
+	admissionSaturation = newGaugeVec("admission", "saturation_ratio",
+		"Ratio of the in-flight admission requests to the maximum, between 0 and 1.",
+		"percentunit")
+
+	admissionThrottled = newCounterVec("admission", "throttled_total",
+		"Number of admission requests answered with a 429 because the replica was saturated.")
+
+	admissionDropped = newCounterVec("admission", "dropped_in_flight_total",
+		"Number of in-flight admission requests dropped because they didn't finish within the drain timeout when the webhook server stopped.")
+
+	admissionClientRejected = newCounterVec("admission", "client_certificates_rejected_total",
+		"Number of connections to the webhook servers rejected because of their client certificate, by reason (untrusted or name), see RequireClientCertificate.",
+		"reason")
+
+	extensionCPUSeconds = newCounterVec("extension", "cpu_seconds_total",
+		"CPU time spent by the extensions handling admission requests, with budgets enabled, see BudgetOptions.",
+		"extension")
+
+	extensionBudgetExceeded = newCounterVec("extension", "budget_exceeded_total",
+		"Number of admission requests whose handling exceeded the resource budget of the extension, by extension and resource (cpu or memory).",
+		"extension", "resource")
+
+	extensionBudgetTripped = newGaugeVec("extension", "budget_tripped",
+		"Whether the circuit breaker of an extension is open (1) after exceeding its resource budget, or closed (0).",
+		"none", "extension")
+
+	watcherQueueDepth = newGaugeVec("watcher", "queue_depth",
+		"Number of events waiting in the queue of a watcher, see WatcherQueueOptions.",
+		"none", "watcher")
+
+	watcherQueueCapacity = newGaugeVec("watcher", "queue_capacity",
+		"Number of events the queue of a watcher holds, see WatcherQueueOptions.",
+		"none", "watcher")
+
+	watcherQueueSaturation = newGaugeVec("watcher", "queue_saturation_ratio",
+		"Ratio of the events waiting in the queue of a watcher to its capacity, between 0 and 1.",
+		"percentunit", "watcher")
+
+	watcherEventsDropped = newCounterVec("watcher", "events_dropped_total",
+		"Number of events dropped because the queue of the watcher was full, by watcher and overflow policy (DropNewest or DropOldest).",
+		"watcher", "policy")
+
+	sloRatio = newGaugeVec("slo", "sli_ratio",
+		"Ratio of good admission requests over a rolling window, by extension, SLI (availability or latency) and window.",
+		"percentunit", "extension", "sli", "window")
+
+	sloBurnRate = newGaugeVec("slo", "burn_rate",
+		"Rate the error budget of an extension is consumed at over a rolling window, 1 consuming exactly the budget, by extension, SLI and window.",
+		"none", "extension", "sli", "window")
+
+	sloObjective = newGaugeVec("slo", "objective_ratio",
+		"Target ratio of good admission requests, by SLI.",
+		"percentunit", "sli")
+
+	chaosInjections = newCounterVec("chaos", "injections_total",
+		"Number of faults injected by the chaos mode, by extension and fault (latency, panic or decode_failure).",
+		"extension", "fault")
+
+	comparisonResults = newCounterVec("comparison", "results_total",
+		"Number of admission requests handled by both the current and the candidate implementations of an extension, by extension and result (match or mismatch).",
+		"extension", "result")
+
+	buildInfo = newGaugeVec("", "build_info",
+		"Always 1, labeled with the eirinix library version and the version of the operator embedding it.",
+		"none", "version", "operator_version")
+
+	leader = newGaugeVec("", "leader",
+		"Whether the replica is the elected leader (1), labeling the namespaces, registering the webhook configurations and running the watchers, see EnableLeaderElection.",
+		"none")
+
+	extensionEnabled = newGaugeVec("extension", "enabled",
+		"Always 1 for the extensions loaded by the Manager, by extension, kind (extension, watcher or reconciler) and version (see DescribedExtension).",
+		"none", "extension", "kind", "version")
+
+	certificateExpiry = newGaugeVec("webhook", "certificate_expiry_timestamp_seconds",
+		"Expiry time of the webhook server certificates, as a unix timestamp, by certificate secret (see SetupCertificateName and WebhookGroups).",
+		"dateTimeFromNow", "certificate")
+
+	webhookCertificateRejected = newCounterVec("webhook", "certificate_rejected_total",
+		"Number of TLS handshakes failed by the clients rejecting the webhook server certificate, e.g. because the CA bundle of the webhook configuration doesn't match it, by certificate secret and reason (unknown-authority, bad-certificate or expired-certificate).",
+		"certificate", "reason")
+
+	caBundleResyncs = newCounterVec("webhook", "ca_bundle_resyncs_total",
+		"Number of re-syncs of the CA bundle of the webhook configurations after the webhook server certificate was rejected, by certificate secret and result (success or failure).",
+		"certificate", "result")
+
+	certificateRotations = newCounterVec("webhook", "certificate_rotations_total",
+		"Number of renewals of the webhook server certificates before their expiry (see CertificateRotation), by certificate secret and result (success or failure).",
+		"certificate", "result")
+
+	auditEventsDropped = newCounterVec("audit", "events_dropped_total",
+		"Number of audit events dropped because the buffer of the sinks was full, see AuditOptions.")
+
+	auditSinkErrors = newCounterVec("audit", "sink_errors_total",
+		"Number of audit events a sink failed to deliver, by sink.",
+		"sink")
+
+	httpClientRequests = newCounterVec("http_client", "requests_total",
+		"Number of requests made by the HTTP clients returned by the Manager, by client and status code.",
+		"client", "code")
+
+	httpClientDuration = newHistogramVec("http_client", "request_duration_seconds",
+		"Duration of the requests made by the HTTP clients returned by the Manager, retries included.",
+		"client")
+
+	httpClientCircuitOpen = newGaugeVec("http_client", "circuit_open",
+		"Whether the circuit breaker of an HTTP client is open (1) or closed (0).",
+		"none", "client")
+)
+
+func init() {
+	// Metrics are registered to the controller-runtime registry, so they are served
+	// together with the kubernetes manager ones
+	crmetrics.Registry.MustRegister(
+		admissionRequests,
+		admissionDuration,
+		admissionPatchOperations,
+		decodeErrors,
+		patchOperationsDropped,
+		admissionInFlight,
+		admissionMaxInFlight,
+		admissionSaturation,
+		admissionThrottled,
+		admissionDropped,
+		admissionClientRejected,
+		extensionCPUSeconds,
+		extensionBudgetExceeded,
+		extensionBudgetTripped,
+		watcherQueueDepth,
+		watcherQueueCapacity,
+		watcherQueueSaturation,
+		watcherEventsDropped,
+		sloRatio,
+		sloBurnRate,
+		sloObjective,
+		chaosInjections,
+		comparisonResults,
+		buildInfo,
+		leader,
+		extensionEnabled,
+		certificateExpiry,
+		webhookCertificateRejected,
+		caBundleResyncs,
+		certificateRotations,
+		auditEventsDropped,
+		auditSinkErrors,
+		httpClientRequests,
+		httpClientDuration,
+		httpClientCircuitOpen,
+	)
+}
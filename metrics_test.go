@@ -0,0 +1,66 @@
+package extension_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var _ = Describe("Metrics", func() {
+	// scrape returns the metrics of the controller-runtime registry, served by the metrics endpoint
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		promhttp.HandlerFor(crmetrics.Registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		return rec.Body.String()
+	}
+
+	It("counts the admission requests and patch operations by extension and operation", func() {
+		req := httptest.NewRequest(http.MethodPost, "/review", bytes.NewReader(reviewBody()))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		AdmissionReviewHandler(newReviewWebhook(false)).ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		metrics := scrape()
+		Expect(metrics).To(ContainSubstring(`eirinix_admission_requests_total{extension="*testing.EditEnvExtension",operation="CREATE",result="allowed"}`))
+		Expect(metrics).To(ContainSubstring(`eirinix_admission_patch_operations_total{extension="*testing.EditEnvExtension",operation="CREATE"}`))
+		Expect(metrics).To(ContainSubstring(`eirinix_admission_duration_seconds_count{extension="*testing.EditEnvExtension",operation="CREATE"}`))
+	})
+
+	It("exports the expiry of the webhook server certificate", func() {
+		c := catalog.NewCatalog()
+		eiriniManager := c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.SetupCertificateName = "test-metrics-setupcert"
+		eiriniManager.Credsgen = NewCredentialGenerator()
+		defer os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+
+		kubeManager := &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(&cfakes.FakeClient{})
+		eiriniManager.KubeManager = kubeManager
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+
+		Expect(scrape()).To(ContainSubstring(`eirinix_webhook_certificate_expiry_timestamp_seconds{certificate="test-metrics-setupcert"}`))
+	})
+
+	It("validates the address of the metrics endpoint", func() {
+		opts := ManagerOptions{Namespace: "eirini", MetricsBindAddress: "8080"}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("metricsBindAddress: Invalid value"))
+
+		opts.MetricsBindAddress = ":8080"
+		Expect(opts.Validate()).To(Succeed())
+	})
+})
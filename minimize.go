@@ -0,0 +1,44 @@
+package extension
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// minimizePatches drops the operations of the response which don't change the admitted object, see
+// ManagerOptions.MinimizePatches. The response is returned unchanged if it can't be minimized.
+func (w *DefaultMutatingWebhook) minimizePatches(ctx context.Context, req admission.Request, res admission.Response) admission.Response {
+	if !res.Allowed || (len(res.Patches) == 0 && len(res.Patch) == 0) || len(req.Object.Raw) == 0 {
+		return res
+	}
+	ops, err := podwebhook.ResponsePatches(res)
+	if err != nil {
+		ctxlog.Debugf(ctx, "Not minimizing the patch of %s: %s", w.Name, err)
+		return res
+	}
+
+	newObject := func() interface{} { return &corev1.Pod{} }
+	if req.Kind.Kind != "" && req.Kind.Kind != "Pod" {
+		// The other objects are compared as JSON documents
+		newObject = func() interface{} { return &map[string]interface{}{} }
+	}
+	kept, err := podwebhook.MinimizePatches(req.Object.Raw, ops, newObject)
+	if err != nil {
+		ctxlog.Debugf(ctx, "Not minimizing the patch of %s: %s", w.Name, err)
+		return res
+	}
+	if dropped := len(ops) - len(kept); dropped > 0 {
+		patchOperationsDropped.WithLabelValues(extensionName(w.EiriniExtension)).Add(float64(dropped))
+	}
+
+	res.Patches = kept
+	res.Patch = nil
+	if len(kept) == 0 {
+		res.PatchType = nil
+	}
+	return res
+}
@@ -0,0 +1,83 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// defaultingExtension sets the image unconditionally, as the helpers setting defaults do
+type defaultingExtension struct {
+	labeled bool
+}
+
+func (e *defaultingExtension) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	ops := []jsonpatch.JsonPatchOperation{jsonpatch.NewOperation("replace", "/spec/containers/0/image", "eirini/dora")}
+	if e.labeled {
+		ops = append(ops, jsonpatch.NewOperation("add", "/metadata/labels", map[string]string{"defaulted": "true"}))
+	}
+	return admission.Patched("", ops...)
+}
+
+var _ = Describe("Patch minimization", func() {
+	var req admission.Request
+
+	BeforeEach(func() {
+		raw, _ := json.Marshal(&corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: "app-0", Namespace: "eirini"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "opi", Image: "eirini/dora"}}},
+		})
+		req = admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Operation: admissionv1beta1.Create,
+		}}
+		req.Object.Raw = raw
+	})
+
+	handle := func(e Extension, minimize bool) admission.Response {
+		failurePolicy := admissionregistrationv1beta1.Fail
+		c := catalog.NewCatalog()
+		w := NewWebhook(e, c.SimpleManager())
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+			ID:             "0",
+			ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, MinimizePatches: minimize},
+		})).To(Succeed())
+		decoder, err := admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.InjectDecoder(decoder)).To(Succeed())
+		return w.Handle(context.Background(), req)
+	}
+
+	It("drops the operations which don't change the pod", func() {
+		res := handle(&defaultingExtension{labeled: true}, true)
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Patches).To(HaveLen(1))
+		Expect(res.Patches[0].Path).To(Equal("/metadata/labels"))
+	})
+
+	It("admits the pod unchanged when no operation changes it", func() {
+		res := handle(&defaultingExtension{}, true)
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Patches).To(BeEmpty())
+		Expect(res.PatchType).To(BeNil())
+	})
+
+	It("keeps the patch as it is by default", func() {
+		res := handle(&defaultingExtension{labeled: true}, false)
+		Expect(res.Patches).To(HaveLen(2))
+	})
+})
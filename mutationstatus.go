@@ -0,0 +1,139 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// MutationsPath is the path of the status server answering whether the pods of an app were mutated by an
+	// extension, see MutationStatus
+	MutationsPath = "/mutations"
+
+	mutationsTimeout = 10 * time.Second
+)
+
+// ErrUnknownExtension is returned by MutationStatus when no configurable extension has the config key
+var ErrUnknownExtension = errors.New("No extension accepts the configuration")
+
+// MutationStatus tells whether the pods of an app were mutated by a ConfigurableExtension, and with which
+// configuration, from the configuration hashes stamped on the pods (see ManagerOptions.AnnotateConfigHash)
+type MutationStatus struct {
+	AppGUID string `json:"appGUID"`
+	// Extension is the config key of the extension
+	Extension string `json:"extension"`
+	// Pods are the pods of the app
+	Pods []PodMutationStatus `json:"pods"`
+	// Action and ActionDone tell whether the one-time action was done for the app, see Ledger.Once. They are
+	// only set when asked for.
+	Action     string `json:"action,omitempty"`
+	ActionDone bool   `json:"actionDone,omitempty"`
+}
+
+// PodMutationStatus tells whether a pod was mutated by an extension, and with which configuration
+type PodMutationStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Mutated is true if the pod is stamped with the configuration hash of the extension
+	Mutated bool `json:"mutated"`
+	// ConfigHash is the hash of the configuration the pod was mutated with
+	ConfigHash string `json:"configHash,omitempty"`
+	// CurrentConfigHash and CurrentConfig are the current configuration of the extension for the pod
+	CurrentConfigHash string          `json:"currentConfigHash"`
+	CurrentConfig     json.RawMessage `json:"currentConfig"`
+	// Stale is true if the pod was mutated with another configuration than the current one
+	Stale bool `json:"stale"`
+}
+
+// MutationStatus returns the mutation status of the pods of the app, in the watched namespaces, by the
+// extension with the config key. The pods are read from the API server, not from the cache.
+func (m *DefaultExtensionManager) MutationStatus(ctx context.Context, appGUID, key string) (*MutationStatus, error) {
+	found := false
+	for _, c := range m.configurableExtensions() {
+		found = found || c.ConfigKey() == key
+	}
+	if !found {
+		return nil, errors.Wrapf(ErrUnknownExtension, "querying the mutations by '%s'", key)
+	}
+
+	opts := []client.ListOption{client.MatchingLabels{m.EiriniLayout().LabelAppGUID: appGUID}}
+	if ns := m.Options.watchNamespace(); ns != "" {
+		opts = append(opts, client.InNamespace(ns))
+	}
+	pods := &corev1.PodList{}
+	if err := m.KubeManager.GetAPIReader().List(ctx, pods, opts...); err != nil {
+		return nil, errors.Wrapf(err, "listing the pods of app %s", appGUID)
+	}
+
+	status := &MutationStatus{AppGUID: appGUID, Extension: key, Pods: []PodMutationStatus{}}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !m.Options.WatchesNamespace(pod.Namespace) {
+			continue
+		}
+		config, err := m.ResolveConfig(key, pod)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := ConfigHash(config)
+		if err != nil {
+			return nil, err
+		}
+		stamped, mutated := pod.GetAnnotations()[AnnotationConfigHashPrefix+key]
+		status.Pods = append(status.Pods, PodMutationStatus{
+			Namespace:         pod.Namespace,
+			Name:              pod.Name,
+			Mutated:           mutated,
+			ConfigHash:        stamped,
+			CurrentConfigHash: hash,
+			CurrentConfig:     config,
+			Stale:             mutated && stamped != hash,
+		})
+	}
+	return status, nil
+}
+
+// mutationsHandler serves the MutationStatus of the app and extension of the app and extension query
+// parameters, with the one-time action of the action parameter if set
+func (m *DefaultExtensionManager) mutationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	app, key, action := query.Get("app"), query.Get("extension"), query.Get("action")
+	if app == "" || key == "" {
+		http.Error(w, "the app and extension parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), mutationsTimeout)
+	defer cancel()
+	status, err := m.MutationStatus(ctx, app, key)
+	if errors.Cause(err) == ErrUnknownExtension {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if action != "" {
+		status.Action = action
+		if status.ActionDone, err = m.Ledger().Done(ctx, app, action); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
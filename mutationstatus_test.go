@@ -0,0 +1,89 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Mutation status", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeClient    *cfakes.FakeClient
+		currentHash   string
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Options.ExtensionConfig = map[string]json.RawMessage{"sidecar": json.RawMessage(`{"image": "busybox"}`)}
+		Expect(eiriniManager.AddExtension(&sidecarExtension{})).To(Succeed())
+
+		var err error
+		currentHash, err = ConfigHash([]byte(`{"image": "busybox"}`))
+		Expect(err).ToNot(HaveOccurred())
+
+		kubeClient = &cfakes.FakeClient{}
+		kubeClient.ListCalls(func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+			list.(*corev1.PodList).Items = []corev1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "dora-0", Namespace: "namespace", Annotations: map[string]string{AnnotationConfigHashPrefix + "sidecar": currentHash}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "dora-1", Namespace: "namespace", Annotations: map[string]string{AnnotationConfigHashPrefix + "sidecar": "outdated"}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "dora-2", Namespace: "namespace"}},
+			}
+			return nil
+		})
+		kubeClient.GetCalls(func(_ context.Context, _ types.NamespacedName, obj runtime.Object) error {
+			entry := obj.(*unstructured.Unstructured)
+			entry.Object["status"] = map[string]interface{}{"phase": "Done"}
+			return nil
+		})
+		kubeManager := &cfakes.FakeManager{}
+		kubeManager.GetAPIReaderReturns(kubeClient)
+		kubeManager.GetClientReturns(kubeClient)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		eiriniManager.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, MutationsPath+query, nil))
+		return rec
+	}
+
+	It("reports the configuration the pods of the app were mutated with", func() {
+		rec := get("?app=guid&extension=sidecar&action=register")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		status := MutationStatus{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &status)).To(Succeed())
+		Expect(status.AppGUID).To(Equal("guid"))
+		Expect(status.ActionDone).To(BeTrue())
+		Expect(status.Pods).To(HaveLen(3))
+
+		Expect(status.Pods[0].Mutated).To(BeTrue())
+		Expect(status.Pods[0].Stale).To(BeFalse())
+		Expect(status.Pods[0].CurrentConfigHash).To(Equal(currentHash))
+		Expect(status.Pods[0].CurrentConfig).To(MatchJSON(`{"image": "busybox"}`))
+		Expect(status.Pods[1].Stale).To(BeTrue())
+		Expect(status.Pods[1].ConfigHash).To(Equal("outdated"))
+		Expect(status.Pods[2].Mutated).To(BeFalse())
+		Expect(status.Pods[2].Stale).To(BeFalse())
+	})
+
+	It("refuses the unknown extensions and the incomplete queries", func() {
+		Expect(get("?app=guid&extension=unknown").Code).To(Equal(http.StatusNotFound))
+		Expect(get("?app=guid").Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,99 @@
+package extension
+
+import (
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	crcache "sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// WatchedNamespaces returns the sorted namespaces where the pods trigger the extensions, Namespace and
+// Namespaces, or nil when the pods of all namespaces do
+func (o *ManagerOptions) WatchedNamespaces() []string {
+	if o.AllNamespaces {
+		return nil
+	}
+	seen := map[string]bool{}
+	var namespaces []string
+	for _, ns := range append([]string{o.Namespace}, o.Namespaces...) {
+		if ns != "" && !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// WatchesNamespace returns true if the pods of the namespace trigger the extensions, see WatchedNamespaces
+func (o *ManagerOptions) WatchesNamespace(namespace string) bool {
+	namespaces := o.WatchedNamespaces()
+	if len(namespaces) == 0 {
+		return true
+	}
+	for _, ns := range namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// NamespaceLabel returns the key of the label the Manager sets on the watched namespaces, named by the
+// NamingStrategy (NamedNamespaceLabel)
+func (o *ManagerOptions) NamespaceLabel() string {
+	return o.getDefaultNamespaceLabel()
+}
+
+// namespaceSelector returns the selector of the namespaces labeled by the Manager, or nil for all namespaces
+func (o *ManagerOptions) namespaceSelector() *metav1.LabelSelector {
+	namespaces := o.WatchedNamespaces()
+	switch len(namespaces) {
+	case 0:
+		return nil
+	case 1:
+		return &metav1.LabelSelector{MatchLabels: map[string]string{o.getDefaultNamespaceLabel(): namespaces[0]}}
+	}
+	return &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+		Key:      o.getDefaultNamespaceLabel(),
+		Operator: metav1.LabelSelectorOpIn,
+		Values:   namespaces,
+	}}}
+}
+
+// setCacheNamespaces restricts the cache of the kubernetes manager to the watched namespaces
+func (o *ManagerOptions) setCacheNamespaces(opts *manager.Options) {
+	namespaces := o.WatchedNamespaces()
+	switch len(namespaces) {
+	case 0:
+	case 1:
+		opts.Namespace = namespaces[0]
+	default:
+		opts.NewCache = crcache.MultiNamespacedCacheBuilder(namespaces)
+	}
+}
+
+// watchNamespace returns the namespace of the pod watch, empty when several namespaces are watched
+func (o *ManagerOptions) watchNamespace() string {
+	if namespaces := o.WatchedNamespaces(); len(namespaces) == 1 {
+		return namespaces[0]
+	}
+	return ""
+}
+
+// filterNamespaces drops the events of the pods outside of the watched namespaces, when several namespaces
+// are watched with a single cluster-wide watch
+func (o *ManagerOptions) filterNamespaces(w watch.Interface) watch.Interface {
+	if len(o.WatchedNamespaces()) < 2 {
+		return w
+	}
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		if obj, ok := e.Object.(metav1.Object); ok {
+			return e, o.WatchesNamespace(obj.GetNamespace())
+		}
+		// Errors and bookmarks are forwarded
+		return e, true
+	})
+}
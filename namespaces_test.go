@@ -0,0 +1,60 @@
+package extension_test
+
+import (
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var _ = Describe("Watched namespaces", func() {
+	It("merges Namespace and Namespaces", func() {
+		opts := ManagerOptions{Namespace: "eirini", Namespaces: []string{"cf-workloads", "eirini"}}
+		Expect(opts.WatchedNamespaces()).To(Equal([]string{"cf-workloads", "eirini"}))
+		Expect(opts.WatchesNamespace("cf-workloads")).To(BeTrue())
+		Expect(opts.WatchesNamespace("default")).To(BeFalse())
+	})
+
+	It("watches all namespaces", func() {
+		opts := ManagerOptions{}
+		Expect(opts.WatchedNamespaces()).To(BeEmpty())
+		Expect(opts.WatchesNamespace("default")).To(BeTrue())
+
+		opts = ManagerOptions{Namespace: "eirini", AllNamespaces: true}
+		Expect(opts.WatchedNamespaces()).To(BeEmpty())
+		Expect(opts.WatchesNamespace("default")).To(BeTrue())
+	})
+
+	It("selects the watched namespaces in the webhooks", func() {
+		failurePolicy := admissionregistrationv1beta1.Fail
+		opts := ManagerOptions{
+			FailurePolicy:       &failurePolicy,
+			Namespace:           "eirini",
+			Namespaces:          []string{"cf-workloads"},
+			OperatorFingerprint: "eirini-x",
+		}
+		w := NewWebhook(&catalog.EditEnvExtension{}, nil)
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: "volume", ManagerOptions: opts})).To(Succeed())
+		Expect(w.GetNamespaceSelector().MatchExpressions).To(Equal([]metav1.LabelSelectorRequirement{{
+			Key:      "eirini-x-ns",
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   []string{"cf-workloads", "eirini"},
+		}}))
+
+		opts.Namespaces = nil
+		opts.AllNamespaces = true
+		w = NewWebhook(&catalog.EditEnvExtension{}, nil)
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: "volume", ManagerOptions: opts})).To(Succeed())
+		Expect(w.GetNamespaceSelector()).To(BeNil())
+	})
+
+	It("rejects invalid namespaces", func() {
+		opts := ManagerOptions{Namespace: "eirini", Namespaces: []string{"Not_A_Namespace"}, AllNamespaces: true}
+		err := opts.Validate()
+		Expect(err).To(MatchError(ContainSubstring("namespaces[0]: Invalid value")))
+		Expect(err).To(MatchError(ContainSubstring("namespaces: Forbidden: not supported with allNamespaces")))
+	})
+})
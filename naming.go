@@ -0,0 +1,187 @@
+package extension
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// NamedResource identifies a resource named by the Manager
+type NamedResource string
+
+const (
+	// NamedWebhookConfiguration is the MutatingWebhookConfiguration of the extensions
+	NamedWebhookConfiguration NamedResource = "webhook-configuration"
+	// NamedValidatingWebhookConfiguration is the ValidatingWebhookConfiguration of the validating extensions,
+	// see ValidatingExtension
+	NamedValidatingWebhookConfiguration NamedResource = "validating-webhook-configuration"
+	// NamedWebhook is the webhook of an extension in the configuration, named after the extension ID: its index,
+	// or its name for a NamedExtension.
+	// Kubernetes requires a fully qualified name, e.g. <id>.<OperatorFingerprint>.org
+	NamedWebhook NamedResource = "webhook"
+	// NamedSetupCertificate is the secret holding the webhook server certificate, also naming the
+	// directory of the certificate files
+	NamedSetupCertificate NamedResource = "setup-certificate"
+	// NamedNamespaceLabel is the label key selecting the namespace of the apps
+	NamedNamespaceLabel NamedResource = "namespace-label"
+	// NamedCABundle is the ConfigMap the CA bundle is published to
+	NamedCABundle NamedResource = "ca-bundle"
+	// NamedHandoverLease is the Lease coordinating the handover between replicas
+	NamedHandoverLease NamedResource = "handover-lease"
+	// NamedLeaderElection is the lock of the leader election between replicas, see EnableLeaderElection
+	NamedLeaderElection NamedResource = "leader-election"
+
+	namingHashLength = 8
+)
+
+// NamedExtension is implemented by the extensions with a name, which is used instead of their type in the
+// logs, metrics and reports. The webhooks of the named Extensions are also identified by it instead of their
+// index: they are served on /<name> and named <name>.<OperatorFingerprint>.org by the DefaultNamingStrategy, so
+// that their entries can be told apart in the MutatingWebhookConfiguration. The names must be unique DNS-1123
+// labels, and not numbers, which are the IDs of the unnamed extensions. The DescribedExtensions are named by their
+// metadata.
+type NamedExtension interface {
+	GetName() string
+}
+
+// NamingStrategy names the resources generated by the Manager, for the operators with naming conventions
+// or length limits. The id is the extension ID for NamedWebhook, the WebhookGroup name for the
+// NamedWebhookConfiguration and NamedValidatingWebhookConfiguration of a group, and empty for the other kinds.
+type NamingStrategy interface {
+	Name(kind NamedResource, fingerprint, id string) string
+}
+
+// NamingStrategyFunc adapts a function to a NamingStrategy
+type NamingStrategyFunc func(kind NamedResource, fingerprint, id string) string
+
+// Name calls the function
+func (f NamingStrategyFunc) Name(kind NamedResource, fingerprint, id string) string {
+	return f(kind, fingerprint, id)
+}
+
+// DefaultNamingStrategy names the resources after the OperatorFingerprint, e.g. <OperatorFingerprint>-mutating-hook.
+// The webhook names are not salted nor shortened, to keep them fully qualified.
+type DefaultNamingStrategy struct {
+	// Salt, if set, suffixes the names with a short hash of the salt, so that several installations sharing
+	// a fingerprint don't share their resources
+	Salt string
+
+	// MaxLength, if set, shortens the longer names, replacing their end with a short hash of the full name
+	// to keep them unique. It must be greater than the hash length, 8.
+	MaxLength int
+}
+
+// Name returns the name of the resource
+func (s DefaultNamingStrategy) Name(kind NamedResource, fingerprint, id string) string {
+	var name string
+	switch kind {
+	case NamedWebhook:
+		return fmt.Sprintf("%s.%s.org", id, fingerprint)
+	case NamedWebhookConfiguration:
+		name = fingerprint + "-mutating-hook"
+		if id != "" {
+			name = name + "-" + id
+		}
+	case NamedValidatingWebhookConfiguration:
+		name = fingerprint + "-validating-hook"
+		if id != "" {
+			name = name + "-" + id
+		}
+	case NamedSetupCertificate:
+		name = fingerprint + "-setupcertificate"
+	case NamedNamespaceLabel:
+		name = fingerprint + "-ns"
+	case NamedCABundle:
+		name = fingerprint + "-ca-bundle"
+	case NamedHandoverLease:
+		name = fingerprint + "-handover"
+	case NamedLeaderElection:
+		name = fingerprint + "-leader"
+	default:
+		name = fingerprint + "-" + string(kind)
+	}
+
+	if s.Salt != "" {
+		name = name + "-" + namingHash(s.Salt+"/"+name)
+	}
+	if s.MaxLength > namingHashLength && len(name) > s.MaxLength {
+		name = strings.TrimRight(name[:s.MaxLength-namingHashLength-1], "-.") + "-" + namingHash(name)
+	}
+	return name
+}
+
+func namingHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:namingHashLength]
+}
+
+// resourceName returns the name of the resource with the NamingStrategy, or the DefaultNamingStrategy
+// if the options have none
+func (o *ManagerOptions) resourceName(kind NamedResource, id string) string {
+	if o.NamingStrategy == nil {
+		return DefaultNamingStrategy{}.Name(kind, o.OperatorFingerprint, id)
+	}
+	return o.NamingStrategy.Name(kind, o.OperatorFingerprint, id)
+}
+
+// declaredName returns the name of a NamedExtension or a DescribedExtension
+func declaredName(e interface{}) (string, bool) {
+	if n, ok := e.(NamedExtension); ok {
+		return n.GetName(), true
+	}
+	if d, ok := e.(DescribedExtension); ok {
+		return d.Metadata().Name, true
+	}
+	return "", false
+}
+
+// extensionName returns the name used to refer to an extension in reports, logs and metrics
+func extensionName(e interface{}) string {
+	if name, ok := declaredName(e); ok {
+		return name
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+// extensionID returns the ID of the webhook of the k-th Extension, its name if it declares one
+func extensionID(k int, e Extension) string {
+	if name, ok := declaredName(e); ok {
+		return name
+	}
+	return strconv.Itoa(k)
+}
+
+// validateExtensionName checks that the name declared by an extension can identify its webhook
+func validateExtensionName(name string) error {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return errors.Errorf("The extension name '%s' is invalid: %s", name, strings.Join(errs, ", "))
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return errors.Errorf("The extension name '%s' is invalid: must not be a number", name)
+	}
+	return nil
+}
+
+// validateExtensionNames checks that the names declared by the extensions are valid and unique
+func validateExtensionNames(extensions []interface{}) error {
+	seen := map[string]bool{}
+	for _, e := range extensions {
+		name, ok := declaredName(e)
+		if !ok {
+			continue
+		}
+		if err := validateExtensionName(name); err != nil {
+			return err
+		}
+		if seen[name] {
+			return errors.Errorf("Several extensions are named '%s'", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
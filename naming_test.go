@@ -0,0 +1,122 @@
+package extension_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+type namedExtension struct {
+	catalog.EditEnvExtension
+	name string
+}
+
+func (e *namedExtension) GetName() string { return e.name }
+
+var _ = Describe("Naming strategy", func() {
+	It("derives the names from the fingerprint by default", func() {
+		s := DefaultNamingStrategy{}
+		Expect(s.Name(NamedWebhookConfiguration, "eirini-x", "")).To(Equal("eirini-x-mutating-hook"))
+		Expect(s.Name(NamedWebhookConfiguration, "eirini-x", "best-effort")).To(Equal("eirini-x-mutating-hook-best-effort"))
+		Expect(s.Name(NamedValidatingWebhookConfiguration, "eirini-x", "")).To(Equal("eirini-x-validating-hook"))
+		Expect(s.Name(NamedSetupCertificate, "eirini-x", "")).To(Equal("eirini-x-setupcertificate"))
+		Expect(s.Name(NamedNamespaceLabel, "eirini-x", "")).To(Equal("eirini-x-ns"))
+		Expect(s.Name(NamedCABundle, "eirini-x", "")).To(Equal("eirini-x-ca-bundle"))
+		Expect(s.Name(NamedWebhook, "eirini-x", "volume")).To(Equal("volume.eirini-x.org"))
+	})
+
+	It("salts the names", func() {
+		name := DefaultNamingStrategy{Salt: "blue"}.Name(NamedWebhookConfiguration, "eirini-x", "")
+		Expect(name).To(MatchRegexp(`^eirini-x-mutating-hook-[0-9a-f]{8}$`))
+		Expect(DefaultNamingStrategy{Salt: "green"}.Name(NamedWebhookConfiguration, "eirini-x", "")).ToNot(Equal(name))
+		Expect(DefaultNamingStrategy{Salt: "blue"}.Name(NamedWebhook, "eirini-x", "volume")).To(Equal("volume.eirini-x.org"))
+	})
+
+	It("shortens the long names keeping them unique", func() {
+		s := DefaultNamingStrategy{MaxLength: 20}
+		setup := s.Name(NamedSetupCertificate, "eirini-x", "")
+		Expect(setup).To(HaveLen(20))
+		Expect(setup).To(MatchRegexp(`^eirini-x-se-[0-9a-f]{8}$`))
+		Expect(s.Name(NamedSetupCertificate, "eirini-y", "")).ToNot(Equal(setup))
+		Expect(s.Name(NamedNamespaceLabel, "eirini-x", "")).To(Equal("eirini-x-ns"))
+	})
+
+	It("names the resources of the Manager", func() {
+		m, err := NewManager(ManagerOptions{
+			Namespace: "eirini",
+			NamingStrategy: NamingStrategyFunc(func(kind NamedResource, fingerprint, id string) string {
+				if kind == NamedWebhook {
+					return id + ".hooks.example.com"
+				}
+				return "acme-" + string(kind)
+			}),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.GetManagerOptions().SetupCertificateName).To(Equal("acme-setup-certificate"))
+	})
+
+	It("rejects the invalid names", func() {
+		_, err := NewManager(ManagerOptions{
+			Namespace: "eirini",
+			NamingStrategy: NamingStrategyFunc(func(kind NamedResource, fingerprint, id string) string {
+				return "Not A Name"
+			}),
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("namingStrategy[setup-certificate]: Invalid value"))
+		Expect(err.Error()).To(ContainSubstring("namingStrategy[namespace-label]: Invalid value"))
+	})
+
+	Context("with named extensions", func() {
+		var eiriniManager *DefaultExtensionManager
+
+		BeforeEach(func() {
+			registerWebhooks := false
+			m, err := NewManager(ManagerOptions{Namespace: "eirini", RegisterWebHook: &registerWebhooks})
+			Expect(err).ToNot(HaveOccurred())
+			eiriniManager = m.(*DefaultExtensionManager)
+			eiriniManager.KubeManager = &cfakes.FakeManager{}
+			eiriniManager.WebhookServer = &webhook.Server{}
+		})
+
+		serve := func(path string) int {
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(reviewBody()))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			eiriniManager.WebhookServer.WebhookMux.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		It("serves the webhooks of the named extensions on their name", func() {
+			Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+			Expect(eiriniManager.AddExtension(&namedExtension{name: "env"})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+			Expect(serve("/0")).To(Equal(http.StatusOK))
+			Expect(serve("/env")).To(Equal(http.StatusOK))
+			Expect(serve("/1")).To(Equal(http.StatusNotFound))
+			Expect(eiriniManager.Status().Extensions).To(Equal([]string{"*testing.EditEnvExtension", "env"}))
+		})
+
+		It("rejects the invalid and duplicated names", func() {
+			Expect(eiriniManager.AddExtension(&namedExtension{name: "Env"})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(MatchError(ContainSubstring("The extension name 'Env' is invalid")))
+
+			eiriniManager.Extensions = nil
+			Expect(eiriniManager.AddExtension(&namedExtension{name: "1"})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(MatchError(ContainSubstring("must not be a number")))
+
+			eiriniManager.Extensions = nil
+			Expect(eiriniManager.AddExtension(&namedExtension{name: "env"})).To(Succeed())
+			Expect(eiriniManager.AddExtension(&namedExtension{name: "env"})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(MatchError("Several extensions are named 'env'"))
+		})
+	})
+})
@@ -0,0 +1,127 @@
+package extension
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var errKindNotRegistered = errors.New("The kind of the request object is not registered in the scheme")
+
+// SchemeExtension can be implemented by Extensions to register their types in the scheme of the Manager, e.g.
+// the types of a CRD with the AddToScheme function of its API package, along with the conversion functions
+// between their versions. The types are registered before the webhooks are, so that the ObjectHandlers receive
+// them typed instead of having to decode the request object.
+type SchemeExtension interface {
+	AddToScheme(s *runtime.Scheme) error
+}
+
+// ObjectHandler is implemented by the Extensions handling other objects than pods (see RuledExtension), e.g.
+// custom resources or pods/binding. HandleObject is called instead of Handle for the requests whose object is
+// not a pod, with the object decoded with the scheme of the Manager, defaulted and converted to the version
+// chosen by the extension (see VersionedObjectHandler). The requests whose kind isn't registered in the scheme
+// are handled as for a NonPodHandler.
+type ObjectHandler interface {
+	HandleObject(ctx context.Context, m Manager, obj runtime.Object, req admission.Request) admission.Response
+}
+
+// VersionedObjectHandler can be implemented by ObjectHandlers to receive the objects in a given version of
+// their API group, whatever the version of the request, e.g. when the webhook targets several versions of a
+// CRD. The conversion functions between the versions must be registered in the scheme, see SchemeExtension.
+// The objects of the other API groups are passed in the version of the request.
+type VersionedObjectHandler interface {
+	// ObjectVersions returns the versions the objects are converted to, at most one per API group
+	ObjectVersions() []schema.GroupVersion
+}
+
+// handlesObjects returns true if the extension accepts the typed objects which are not pods
+func handlesObjects(e Extension) bool {
+	_, ok := e.(ObjectHandler)
+	return ok
+}
+
+// addExtensionSchemes registers the types of the SchemeExtensions in the scheme of the kubernetes manager
+func (m *DefaultExtensionManager) addExtensionSchemes() error {
+	scheme := m.GetScheme()
+	if scheme == nil {
+		return nil
+	}
+	for _, e := range m.allExtensions() {
+		s, ok := e.(SchemeExtension)
+		if !ok {
+			continue
+		}
+		if err := s.AddToScheme(scheme); err != nil {
+			return errors.Wrapf(err, "adding the types of %s to the scheme", extensionName(s))
+		}
+	}
+	return nil
+}
+
+// objectCodecs returns the codecs of the scheme, created once per webhook
+func (w *DefaultMutatingWebhook) objectCodecs(scheme *runtime.Scheme) serializer.CodecFactory {
+	w.objectCodecsOnce.Do(func() {
+		var mutators []serializer.CodecFactoryOptionsMutator
+		if w.StrictDecoding {
+			mutators = append(mutators, serializer.EnableStrict)
+		}
+		w.codecs = serializer.NewCodecFactory(scheme, mutators...)
+	})
+	return w.codecs
+}
+
+// decodeObject decodes the request object with the scheme of the Manager, and converts it to the version
+// chosen by the extension or else keeps the version of the request
+func (w *DefaultMutatingWebhook) decodeObject(req admission.Request) (runtime.Object, error) {
+	if w.EiriniExtensionManager == nil || w.EiriniExtensionManager.GetScheme() == nil {
+		return nil, errKindNotRegistered
+	}
+	scheme := w.EiriniExtensionManager.GetScheme()
+	gvk := schema.GroupVersionKind{Group: req.Kind.Group, Version: req.Kind.Version, Kind: req.Kind.Kind}
+	if !scheme.Recognizes(gvk) {
+		return nil, errKindNotRegistered
+	}
+
+	// Without versions, the decoder would convert the object to its internal version
+	versions := []schema.GroupVersion{gvk.GroupVersion()}
+	if v, ok := w.EiriniExtension.(VersionedObjectHandler); ok && len(v.ObjectVersions()) > 0 {
+		versions = v.ObjectVersions()
+	}
+	obj, _, err := w.objectCodecs(scheme).UniversalDecoder(versions...).Decode(req.Object.Raw, &gvk, nil)
+	return obj, err
+}
+
+// handleObject decodes the request object which is not a pod, and calls the extension with it if it is an
+// ObjectHandler. The requests whose object can't be decoded follow the DecodeErrorPolicy.
+func (w *DefaultMutatingWebhook) handleObject(ctx context.Context, req admission.Request, reason string) admission.Response {
+	h, ok := w.EiriniExtension.(ObjectHandler)
+	if !ok || len(req.Object.Raw) == 0 {
+		return w.handleNonPod(ctx, req, reason)
+	}
+
+	obj, err := w.decodeObject(req)
+	if err == errKindNotRegistered {
+		return w.handleNonPod(ctx, req, reason)
+	}
+	if err != nil {
+		policy := w.decodeErrorPolicy()
+		decodeErrors.WithLabelValues(extensionName(w.EiriniExtension), string(policy)).Inc()
+		if w.EiriniExtensionManager.GetLogger() != nil {
+			w.EiriniExtensionManager.GetLogger().Warnf("Decoding %s %s/%s for %s (%s): %s", req.Kind.Kind, req.Namespace, req.Name, w.Name, policy, err)
+		}
+
+		switch policy {
+		case DecodeErrorAllow:
+			return admission.Allowed("object could not be decoded")
+		case DecodeErrorDeny:
+			return admission.Errored(http.StatusBadRequest, errors.Wrapf(err, "decoding the %s", req.Kind.Kind))
+		}
+		return w.handleNonPod(ctx, req, "object could not be decoded")
+	}
+	return h.HandleObject(ctx, w.extensionManager(req), obj, req)
+}
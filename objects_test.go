@@ -0,0 +1,226 @@
+package extension_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var (
+	widgetsV1 = schema.GroupVersion{Group: "example.com", Version: "v1"}
+	widgetsV2 = schema.GroupVersion{Group: "example.com", Version: "v2"}
+)
+
+type widgetV1 struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Size              string `json:"size"`
+}
+
+func (w *widgetV1) DeepCopyObject() runtime.Object {
+	c := *w
+	w.ObjectMeta.DeepCopyInto(&c.ObjectMeta)
+	return &c
+}
+
+type widgetV2 struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Sizes             []string `json:"sizes"`
+}
+
+func (w *widgetV2) DeepCopyObject() runtime.Object {
+	c := *w
+	w.ObjectMeta.DeepCopyInto(&c.ObjectMeta)
+	c.Sizes = append([]string(nil), w.Sizes...)
+	return &c
+}
+
+type widgetObserver struct {
+	resources []CustomResource
+	versions  []schema.GroupVersion
+	objects   []runtime.Object
+}
+
+func (e *widgetObserver) WebhookRules() WebhookRules {
+	return WebhookRules{Resources: []string{ResourcePodsBinding}, CustomResources: e.resources}
+}
+
+func (e *widgetObserver) AddToScheme(s *runtime.Scheme) error {
+	s.AddKnownTypeWithName(widgetsV1.WithKind("Widget"), &widgetV1{})
+	s.AddKnownTypeWithName(widgetsV2.WithKind("Widget"), &widgetV2{})
+	return s.AddConversionFunc((*widgetV1)(nil), (*widgetV2)(nil), func(a, b interface{}, _ conversion.Scope) error {
+		in, out := a.(*widgetV1), b.(*widgetV2)
+		out.ObjectMeta = in.ObjectMeta
+		out.Sizes = []string{in.Size}
+		return nil
+	})
+}
+
+func (e *widgetObserver) ObjectVersions() []schema.GroupVersion {
+	return e.versions
+}
+
+func (e *widgetObserver) Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response {
+	return admission.Denied("the pods are not handled")
+}
+
+func (e *widgetObserver) HandleObject(_ context.Context, _ Manager, obj runtime.Object, _ admission.Request) admission.Response {
+	e.objects = append(e.objects, obj)
+	return admission.Allowed("")
+}
+
+var _ = Describe("Typed objects", func() {
+	var (
+		ext           *widgetObserver
+		eiriniManager *DefaultExtensionManager
+		scheme        *runtime.Scheme
+		policy        DecodeErrorPolicy
+	)
+
+	BeforeEach(func() {
+		ext = &widgetObserver{resources: []CustomResource{
+			{Group: "example.com", Version: "v1", Resource: "widgets"},
+			{Group: "example.com", Version: "v2", Resource: "widgets"},
+		}}
+		policy = ""
+
+		var err error
+		scheme, err = NewScheme()
+		Expect(err).ToNot(HaveOccurred())
+		kubeManager := &cfakes.FakeManager{}
+		kubeManager.GetSchemeReturns(scheme)
+		kubeManager.GetClientReturns(&cfakes.FakeClient{})
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	register := func() (*DefaultMutatingWebhook, error) {
+		failurePolicy := admissionregistrationv1beta1.Fail
+		w := NewWebhook(ext, eiriniManager).(*DefaultMutatingWebhook)
+		return w, w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+			ID:             "widgets",
+			ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, DecodeErrorPolicy: policy},
+		})
+	}
+
+	widgetRequest := func(version, raw string) admission.Request {
+		req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Group: "example.com", Version: version, Kind: "Widget"},
+			Resource:  metav1.GroupVersionResource{Group: "example.com", Version: version, Resource: "widgets"},
+			Operation: admissionv1beta1.Create,
+		}}
+		req.Object.Raw = []byte(raw)
+		return req
+	}
+
+	It("generates the rules of the custom resources", func() {
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Rules).To(HaveLen(3))
+		Expect(w.Rules[1].APIGroups).To(Equal([]string{"example.com"}))
+		Expect(w.Rules[1].APIVersions).To(Equal([]string{"v1"}))
+		Expect(w.Rules[1].Resources).To(Equal([]string{"widgets"}))
+		Expect(*w.Rules[1].Scope).To(Equal(admissionregistrationv1beta1.AllScopes))
+		Expect(w.Rules[2].APIVersions).To(Equal([]string{"v2"}))
+
+		ext.resources = []CustomResource{{Group: "example.com", Resource: "widgets"}}
+		_, err = register()
+		Expect(err).To(MatchError(ContainSubstring("its group, version and resource are required")))
+	})
+
+	It("registers the types of the extensions in the scheme", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		eiriniManager.Options.Port = int32(listener.Addr().(*net.TCPAddr).Port)
+		Expect(listener.Close()).To(Succeed())
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.SetupCertificateName = "test-objects-setupcert"
+		eiriniManager.Credsgen = NewCredentialGenerator()
+		defer os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+
+		Expect(eiriniManager.AddExtension(ext)).To(Succeed())
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(scheme.Recognizes(widgetsV1.WithKind("Widget"))).To(BeTrue())
+	})
+
+	It("passes the objects typed, in the version of the request", func() {
+		Expect(ext.AddToScheme(scheme)).To(Succeed())
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+
+		res := w.Handle(context.Background(), widgetRequest("v1", `{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w"},"size":"large"}`))
+		Expect(res.Allowed).To(BeTrue())
+		Expect(ext.objects).To(HaveLen(1))
+		Expect(ext.objects[0].(*widgetV1).Size).To(Equal("large"))
+		Expect(ext.objects[0].(*widgetV1).Name).To(Equal("w"))
+	})
+
+	It("converts the objects to the versions of the extension", func() {
+		Expect(ext.AddToScheme(scheme)).To(Succeed())
+		ext.versions = []schema.GroupVersion{widgetsV2}
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+
+		res := w.Handle(context.Background(), widgetRequest("v1", `{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w"},"size":"large"}`))
+		Expect(res.Allowed).To(BeTrue())
+		Expect(ext.objects).To(HaveLen(1))
+		Expect(ext.objects[0].(*widgetV2).Sizes).To(Equal([]string{"large"}))
+		Expect(ext.objects[0].GetObjectKind().GroupVersionKind()).To(Equal(widgetsV2.WithKind("Widget")))
+	})
+
+	It("passes the kubernetes objects typed", func() {
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+
+		req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Kind:        metav1.GroupVersionKind{Version: "v1", Kind: "Binding"},
+			SubResource: "binding",
+			Operation:   admissionv1beta1.Create,
+		}}
+		req.Object.Raw = []byte(`{"apiVersion":"v1","kind":"Binding","metadata":{"name":"app-0"},"target":{"kind":"Node","name":"node-1"}}`)
+		Expect(w.Handle(context.Background(), req).Allowed).To(BeTrue())
+		Expect(ext.objects).To(HaveLen(1))
+		Expect(ext.objects[0].(*corev1.Binding).Target.Name).To(Equal("node-1"))
+	})
+
+	It("admits the objects whose kind isn't registered unchanged", func() {
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+
+		res := w.Handle(context.Background(), widgetRequest("v1", `{"apiVersion":"example.com/v1","kind":"Widget","size":"large"}`))
+		Expect(res.Allowed).To(BeTrue())
+		Expect(ext.objects).To(BeEmpty())
+	})
+
+	It("follows the decode error policy", func() {
+		Expect(ext.AddToScheme(scheme)).To(Succeed())
+		policy = DecodeErrorDeny
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+
+		res := w.Handle(context.Background(), widgetRequest("v1", `{"apiVersion":"example.com/v1","kind":"Widget","size":1}`))
+		Expect(res.Allowed).To(BeFalse())
+		Expect(res.Result.Code).To(Equal(int32(http.StatusBadRequest)))
+		Expect(ext.objects).To(BeEmpty())
+	})
+})
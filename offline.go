@@ -0,0 +1,99 @@
+package extension
+
+import (
+	"encoding/json"
+
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	jsonpatchapply "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/yaml"
+)
+
+// Patch is a JSON patch operation returned by an Extension
+type Patch = podwebhook.Patch
+
+// RunOffline runs the registered Extensions against a pod manifest (YAML or JSON) without connecting
+// to a cluster, and returns the resulting patches.
+//
+// Like with the kube api server, every Extension receives the pod as patched by the previous ones.
+// The patches of each Extension are sorted, so the output is stable across runs.
+func (m *DefaultExtensionManager) RunOffline(manifest []byte) ([]Patch, error) {
+	pod := &corev1.Pod{}
+	if err := yaml.Unmarshal(manifest, pod); err != nil {
+		return nil, errors.Wrap(err, "decoding the pod manifest")
+	}
+	// Normalize the pod, so that the patches only contain the changes made by the Extensions
+	podJSON, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := m.Context
+	if ctx == nil {
+		ctx = ctxlog.NewManagerContext(m.Logger)
+	}
+
+	dryRun := true
+	var patches []Patch
+	for i, e := range m.Extensions {
+		pod := &corev1.Pod{}
+		if err := json.Unmarshal(podJSON, pod); err != nil {
+			return nil, err
+		}
+		req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			UID:       "offline",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Operation: admissionv1beta1.Create,
+			Object:    runtime.RawExtension{Raw: podJSON},
+			DryRun:    &dryRun,
+		}}
+
+		res := e.Handle(ctx, m, pod, req)
+		if !res.Allowed {
+			msg := ""
+			if res.Result != nil {
+				msg = res.Result.Message
+			}
+			return patches, errors.Errorf("extension %d denied the pod: %s", i, msg)
+		}
+
+		ops, err := podwebhook.ResponsePatches(res)
+		if err != nil {
+			return patches, errors.Wrapf(err, "decoding the patch of extension %d", i)
+		}
+		if len(ops) == 0 {
+			continue
+		}
+		SortPatches(ops)
+
+		raw, err := json.Marshal(ops)
+		if err != nil {
+			return patches, err
+		}
+		p, err := jsonpatchapply.DecodePatch(raw)
+		if err != nil {
+			return patches, errors.Wrapf(err, "decoding the patch of extension %d", i)
+		}
+		podJSON, err = p.Apply(podJSON)
+		if err != nil {
+			return patches, errors.Wrapf(err, "applying the patch of extension %d", i)
+		}
+		patches = append(patches, ops...)
+	}
+	return patches, nil
+}
+
+// SortPatches sorts JSON patch operations by path, so that patches computed by diffing
+// two objects are stable, see podwebhook.SortPatches
+func SortPatches(ops []Patch) {
+	podwebhook.SortPatches(ops)
+}
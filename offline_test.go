@@ -0,0 +1,56 @@
+package extension_test
+
+import (
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Offline runs", func() {
+	var (
+		eirinixcatalog catalog.Catalog
+		m              Manager
+	)
+
+	BeforeEach(func() {
+		eirinixcatalog = catalog.NewCatalog()
+		m = eirinixcatalog.SimpleManager()
+	})
+
+	It("returns the patches of the extensions", func() {
+		Expect(m.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+
+		patches, err := m.RunOffline(eirinixcatalog.EiriniAppYaml())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(patches).To(HaveLen(1))
+		Expect(patches[0].Operation).To(Equal("add"))
+		Expect(patches[0].Path).To(Equal("/spec/containers/0/env/1"))
+	})
+
+	It("passes the patched pod to the next extension", func() {
+		Expect(m.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+		Expect(m.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+
+		patches, err := m.RunOffline(eirinixcatalog.EiriniAppYaml())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(patches).To(HaveLen(1))
+	})
+
+	It("fails with invalid manifests", func() {
+		_, err := m.RunOffline([]byte("- not a pod"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("sorts patches keeping the order of array operations", func() {
+		patches := []Patch{
+			{Operation: "remove", Path: "/spec/volumes/3"},
+			{Operation: "add", Path: "/metadata/labels/foo"},
+			{Operation: "remove", Path: "/spec/volumes/1"},
+		}
+		SortPatches(patches)
+		Expect(patches[0].Path).To(Equal("/metadata/labels/foo"))
+		Expect(patches[1].Path).To(Equal("/spec/volumes/3"))
+		Expect(patches[2].Path).To(Equal("/spec/volumes/1"))
+	})
+})
@@ -0,0 +1,192 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	jsonpatchapply "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// AuditAnnotationPipelineStages is the audit annotation listing the stages of a pipeline in the order they
+	// were invoked, e.g. sidecar,env
+	AuditAnnotationPipelineStages = "pipeline-stages"
+
+	// AuditAnnotationPipelineStagePrefix prefixes the audit annotations holding the result of each stage of a
+	// pipeline, by position, e.g. pipeline-stage-1: "sidecar: patched". The stages which didn't patch the object
+	// are allowed, denied or errored
+	AuditAnnotationPipelineStagePrefix = "pipeline-stage-"
+
+	pipelineStagePatched = "patched"
+
+	// maxWebhookTimeoutSeconds is the maximum timeout of a webhook accepted by the API server
+	maxWebhookTimeoutSeconds = 30
+)
+
+// NewPipeline returns an Extension running the stages in order behind a single webhook, so that the API server
+// makes one admission call for all of them and receives one merged patch. The patch of each stage is applied to
+// the object before the next stage is invoked, with the patched object in the request, so that the stages
+// build on each other's changes and the merged patch stays valid. The pipeline stops at the first stage denying
+// the request.
+//
+// The result of each stage is recorded in the audit annotations of the response, see
+// AuditAnnotationPipelineStages and AuditAnnotationPipelineStagePrefix. The pipeline is named, and merges the
+// webhook policies, permissions, capabilities and non-pod handling of its stages: it is reinvoked if one of
+// its stages needs to be, in which case all the stages run again in the same order.
+func NewPipeline(name string, stages ...Extension) Extension {
+	return &pipeline{name: name, stages: stages}
+}
+
+type pipeline struct {
+	name   string
+	stages []Extension
+}
+
+// GetName returns the name of the pipeline, identifying its webhook
+func (p *pipeline) GetName() string {
+	return p.name
+}
+
+// Handle invokes the stages in order, each with the object patched by the previous ones
+func (p *pipeline) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	raw := req.Object.Raw
+	annotations := map[string]string{}
+	var names, warnings []string
+	for i, stage := range p.stages {
+		if pod == nil && !handlesNonPods(stage) {
+			continue
+		}
+		name := extensionName(stage)
+		names = append(names, name)
+
+		stageReq := req
+		stageReq.Object.Raw = raw
+		var stagePod *corev1.Pod
+		if pod != nil {
+			stagePod = &corev1.Pod{}
+			if err := json.Unmarshal(raw, stagePod); err != nil {
+				return admission.Errored(http.StatusInternalServerError, errors.Wrapf(err, "decoding the pod patched by the stages before %s", name))
+			}
+		}
+
+		res := stage.Handle(ctx, m, stagePod, stageReq)
+		for k, v := range res.AuditAnnotations {
+			annotations[k] = v
+		}
+		warnings = append(warnings, res.Warnings...)
+		if !res.Allowed {
+			annotations[AuditAnnotationPipelineStagePrefix+fmt.Sprint(i+1)] = name + ": " + admissionResult(res)
+			return p.response(res, annotations, names, warnings)
+		}
+
+		ops, err := podwebhook.ResponsePatches(res)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, errors.Wrapf(err, "decoding the patch of the stage %s", name))
+		}
+		if len(ops) == 0 {
+			annotations[AuditAnnotationPipelineStagePrefix+fmt.Sprint(i+1)] = name + ": " + admissionResult(res)
+			continue
+		}
+		if raw, err = applyPatches(raw, ops); err != nil {
+			return admission.Errored(http.StatusInternalServerError, errors.Wrapf(err, "applying the patch of the stage %s", name))
+		}
+		annotations[AuditAnnotationPipelineStagePrefix+fmt.Sprint(i+1)] = name + ": " + pipelineStagePatched
+	}
+
+	res := admission.Allowed("")
+	if string(raw) != string(req.Object.Raw) {
+		res = admission.PatchResponseFromRaw(req.Object.Raw, raw)
+	}
+	return p.response(res, annotations, names, warnings)
+}
+
+// response sets the audit annotations and the warnings of the stages on the response of the pipeline
+func (p *pipeline) response(res admission.Response, annotations map[string]string, names, warnings []string) admission.Response {
+	annotations[AuditAnnotationPipelineStages] = strings.Join(names, ",")
+	res.AuditAnnotations = annotations
+	res.Warnings = warnings
+	return res
+}
+
+// applyPatches returns the JSON object patched with the operations
+func applyPatches(raw []byte, ops []Patch) ([]byte, error) {
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	p, err := jsonpatchapply.DecodePatch(patch)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding the patch")
+	}
+	return p.Apply(raw)
+}
+
+// HandlesNonPods returns true if one of the stages accepts to be called with a nil pod
+func (p *pipeline) HandlesNonPods() bool {
+	for _, stage := range p.stages {
+		if handlesNonPods(stage) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookPolicy merges the webhook policies of the stages: the pipeline fails closed if a stage does, waits
+// for the sum of the stage timeouts, and is reinvoked if a stage needs to be. The match conditions of the
+// stages are dropped, the pipeline is called for the pods of all of them.
+func (p *pipeline) WebhookPolicy() WebhookPolicy {
+	var policy WebhookPolicy
+	var timeout int32
+	for _, stage := range p.stages {
+		e, ok := stage.(PolicyExtension)
+		if !ok {
+			continue
+		}
+		sp := e.WebhookPolicy()
+		if sp.FailurePolicy != nil && (policy.FailurePolicy == nil || *sp.FailurePolicy == admissionregistrationv1beta1.Fail) {
+			policy.FailurePolicy = sp.FailurePolicy
+		}
+		if sp.TimeoutSeconds != nil {
+			timeout += *sp.TimeoutSeconds
+		}
+		if sp.ReinvocationPolicy != nil && *sp.ReinvocationPolicy == admissionregistrationv1beta1.IfNeededReinvocationPolicy {
+			policy.ReinvocationPolicy = sp.ReinvocationPolicy
+		}
+	}
+	if timeout > maxWebhookTimeoutSeconds {
+		timeout = maxWebhookTimeoutSeconds
+	}
+	if timeout > 0 {
+		policy.TimeoutSeconds = &timeout
+	}
+	return policy
+}
+
+// RequiredPermissions returns the permissions of the stages
+func (p *pipeline) RequiredPermissions() []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+	for _, stage := range p.stages {
+		if e, ok := stage.(PermissionedExtension); ok {
+			rules = append(rules, e.RequiredPermissions()...)
+		}
+	}
+	return rules
+}
+
+// Provides returns the capabilities of the stages, so that the extensions depending on them can be added
+func (p *pipeline) Provides() []string {
+	var capabilities []string
+	for _, stage := range p.stages {
+		capabilities = append(capabilities, providedCapabilities(stage)...)
+	}
+	return capabilities
+}
@@ -0,0 +1,119 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	jsonpatchapply "github.com/evanphx/json-patch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// envStage appends an environment variable named after it to the containers, recording the ones already set
+type envStage struct {
+	name   string
+	policy WebhookPolicy
+	seen   []string
+}
+
+func (s *envStage) GetName() string { return s.name }
+
+func (s *envStage) WebhookPolicy() WebhookPolicy { return s.policy }
+
+func (s *envStage) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	podCopy := pod.DeepCopy()
+	for i := range podCopy.Spec.Containers {
+		c := &podCopy.Spec.Containers[i]
+		for _, e := range c.Env {
+			s.seen = append(s.seen, e.Name)
+		}
+		c.Env = append(c.Env, corev1.EnvVar{Name: s.name})
+	}
+	return m.PatchFromPod(req, podCopy)
+}
+
+// denyingStage denies every request
+type denyingStage struct{}
+
+func (s *denyingStage) Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response {
+	return admission.Denied("not allowed")
+}
+
+var _ = Describe("Pipeline", func() {
+	var (
+		eiriniManager Manager
+		req           admission.Request
+		pod           *corev1.Pod
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager()
+		req = podRequest()
+		pod = &corev1.Pod{}
+		Expect(json.Unmarshal(req.Object.Raw, pod)).To(Succeed())
+	})
+
+	// patched returns the pod of the request patched by the response
+	patched := func(res admission.Response) *corev1.Pod {
+		ops, err := json.Marshal(res.Patches)
+		Expect(err).ToNot(HaveOccurred())
+		patch, err := jsonpatchapply.DecodePatch(ops)
+		Expect(err).ToNot(HaveOccurred())
+		raw, err := patch.Apply(req.Object.Raw)
+		Expect(err).ToNot(HaveOccurred())
+		p := &corev1.Pod{}
+		Expect(json.Unmarshal(raw, p)).To(Succeed())
+		return p
+	}
+
+	It("invokes each stage with the object patched by the previous ones, and merges the patches", func() {
+		first, second := &envStage{name: "FIRST"}, &envStage{name: "SECOND"}
+		res := NewPipeline("env", first, second).Handle(context.Background(), eiriniManager, pod, req)
+		Expect(res.Allowed).To(BeTrue())
+
+		Expect(first.seen).To(BeEmpty())
+		Expect(second.seen).To(Equal([]string{"FIRST"}))
+		Expect(patched(res).Spec.Containers[0].Env).To(Equal([]corev1.EnvVar{{Name: "FIRST"}, {Name: "SECOND"}}))
+
+		Expect(res.AuditAnnotations).To(Equal(map[string]string{
+			"pipeline-stages":  "FIRST,SECOND",
+			"pipeline-stage-1": "FIRST: patched",
+			"pipeline-stage-2": "SECOND: patched",
+		}))
+	})
+
+	It("stops at the first stage denying the request", func() {
+		last := &envStage{name: "LAST"}
+		res := NewPipeline("env", &envStage{name: "FIRST"}, &denyingStage{}, last).Handle(context.Background(), eiriniManager, pod, req)
+		Expect(res.Allowed).To(BeFalse())
+		Expect(res.Result.Reason).To(BeEquivalentTo("not allowed"))
+		Expect(res.Patches).To(BeEmpty())
+		Expect(last.seen).To(BeNil())
+
+		Expect(res.AuditAnnotations).To(HaveKeyWithValue("pipeline-stages", "FIRST,*extension_test.denyingStage"))
+		Expect(res.AuditAnnotations).To(HaveKeyWithValue("pipeline-stage-2", "*extension_test.denyingStage: denied"))
+	})
+
+	It("merges the webhook policies of the stages", func() {
+		ignore, fail := admissionregistrationv1beta1.Ignore, admissionregistrationv1beta1.Fail
+		ifNeeded := admissionregistrationv1beta1.IfNeededReinvocationPolicy
+		timeout := func(seconds int32) *int32 { return &seconds }
+
+		p := NewPipeline("env",
+			&envStage{name: "A", policy: WebhookPolicy{FailurePolicy: &ignore, TimeoutSeconds: timeout(20)}},
+			&envStage{name: "B", policy: WebhookPolicy{FailurePolicy: &fail, TimeoutSeconds: timeout(20), ReinvocationPolicy: &ifNeeded}},
+			&envStage{name: "C", policy: WebhookPolicy{FailurePolicy: &ignore}},
+		).(PolicyExtension)
+
+		policy := p.WebhookPolicy()
+		Expect(*policy.FailurePolicy).To(Equal(fail))
+		Expect(*policy.TimeoutSeconds).To(Equal(int32(30)))
+		Expect(*policy.ReinvocationPolicy).To(Equal(ifNeeded))
+	})
+})
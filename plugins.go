@@ -0,0 +1,84 @@
+package extension
+
+import (
+	"path/filepath"
+	"plugin"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// PluginSymbol is the function the extension plugins export, returning the Extension, Watcher or Reconciler
+// to add to the Manager. Its signature is one of:
+//
+//	func NewExtension() interface{}
+//	func NewExtension() (interface{}, error)
+//	func NewExtension() eirinix.Extension
+//	func NewExtension() eirinix.Watcher
+//	func NewExtension() eirinix.Reconciler
+const PluginSymbol = "NewExtension"
+
+// pluginPattern matches the plugin files in ManagerOptions.PluginDir
+const pluginPattern = "*.so"
+
+// LoadPlugins opens the Go plugins (the .so files built with -buildmode=plugin) of the directory, in
+// lexical order, and adds the extensions returned by their NewExtension function to the Manager. It returns
+// the paths of the loaded plugins.
+//
+// Go plugins are only supported on Linux, FreeBSD and macOS, and must be built with the same Go version and
+// versions of the shared packages (eirinix, controller-runtime, ...) as the operator binary.
+func (m *DefaultExtensionManager) LoadPlugins(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, pluginPattern))
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing the plugins of %s", dir)
+	}
+	sort.Strings(paths)
+
+	var loaded []string
+	for _, path := range paths {
+		p, err := plugin.Open(path)
+		if err != nil {
+			return loaded, errors.Wrapf(err, "opening plugin %s", path)
+		}
+		sym, err := p.Lookup(PluginSymbol)
+		if err != nil {
+			return loaded, errors.Wrapf(err, "resolving %s in plugin %s", PluginSymbol, path)
+		}
+		e, err := newPluginExtension(sym)
+		if err != nil {
+			return loaded, errors.Wrapf(err, "plugin %s", path)
+		}
+		if err := m.AddExtension(e); err != nil {
+			return loaded, errors.Wrapf(err, "adding the extension of plugin %s", path)
+		}
+		m.Logger.Infow("Loaded extension plugin", "plugin", path, "extension", extensionName(e))
+		loaded = append(loaded, path)
+	}
+	return loaded, nil
+}
+
+// newPluginExtension calls the NewExtension function exported by a plugin
+func newPluginExtension(sym plugin.Symbol) (interface{}, error) {
+	var e interface{}
+	switch f := sym.(type) {
+	case func() interface{}:
+		e = f()
+	case func() (interface{}, error):
+		var err error
+		if e, err = f(); err != nil {
+			return nil, errors.Wrap(err, "creating the extension")
+		}
+	case func() Extension:
+		e = f()
+	case func() Watcher:
+		e = f()
+	case func() Reconciler:
+		e = f()
+	default:
+		return nil, errors.Errorf("Unsupported %s signature %T", PluginSymbol, sym)
+	}
+	if e == nil {
+		return nil, errors.Errorf("%s returned no extension", PluginSymbol)
+	}
+	return e, nil
+}
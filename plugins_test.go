@@ -0,0 +1,47 @@
+package extension_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Extension plugins", func() {
+	var (
+		dir           string
+		eiriniManager *DefaultExtensionManager
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "eirinix-plugins")
+		Expect(err).ToNot(HaveOccurred())
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("ignores the files which are not plugins", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("plugins"), 0600)).To(Succeed())
+		loaded, err := eiriniManager.LoadPlugins(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded).To(BeEmpty())
+		Expect(eiriniManager.ListExtensions()).To(BeEmpty())
+	})
+
+	It("fails on invalid plugins", func() {
+		path := filepath.Join(dir, "broken.so")
+		Expect(ioutil.WriteFile(path, []byte("not a shared object"), 0600)).To(Succeed())
+		loaded, err := eiriniManager.LoadPlugins(dir)
+		Expect(err).To(MatchError(ContainSubstring("opening plugin " + path)))
+		Expect(loaded).To(BeEmpty())
+	})
+})
@@ -0,0 +1,94 @@
+package extension
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+const (
+	pingCheckName                 = "ping"
+	certificateCheckName          = "webhook-certificate"
+	webhookConfigurationCheckName = "webhook-configuration"
+	webhookServerCheckName        = "webhook-server"
+	extensionsCheckName           = "extensions"
+)
+
+var (
+	errWebhooksNotConfigured   = errors.New("The webhook configurations are not registered yet")
+	errWebhookServerNotServing = errors.New("The webhook server is not serving yet")
+)
+
+// addHealthProbes registers the liveness and readiness checks served by the health probe endpoint of the
+// kubernetes manager, see HealthProbeBindAddress
+func (m *DefaultExtensionManager) addHealthProbes() error {
+	if err := m.KubeManager.AddHealthzCheck(pingCheckName, healthz.Ping); err != nil {
+		return err
+	}
+	for _, c := range []struct {
+		name  string
+		check healthz.Checker
+	}{
+		{certificateCheckName, m.certificateReady},
+		{webhookConfigurationCheckName, m.webhookConfigurationReady},
+		{webhookServerCheckName, m.webhookServerReady},
+		{extensionsCheckName, func(r *http.Request) error { return m.ready(r.Context()) }},
+	} {
+		if err := m.KubeManager.AddReadyzCheck(c.name, c.check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// certificateReady checks that the certificates of the webhook servers are generated and not expired, unless
+// they are provided, see SetupCertificate
+func (m *DefaultExtensionManager) certificateReady(_ *http.Request) error {
+	if m.Options.SetupCertificate != nil && !*m.Options.SetupCertificate {
+		return nil
+	}
+	configs := []*WebhookConfig{m.WebhookConfig}
+	for _, g := range m.webhookGroups {
+		configs = append(configs, g.config)
+	}
+	for _, config := range configs {
+		if config == nil {
+			return errors.New("The webhook server certificate is not generated yet")
+		}
+		expiry, err := config.certificateExpiry()
+		if err != nil {
+			return errors.Wrapf(err, "reading the webhook server certificate %s", config.setupCertificateName)
+		}
+		if time.Now().After(expiry) {
+			return errors.Errorf("The webhook server certificate %s expired at %s", config.setupCertificateName, expiry.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// webhookConfigurationReady checks that the webhook configurations are registered, unless they are registered
+// by another binary (see RegisterWebHook) or by the leader (see EnableLeaderElection)
+func (m *DefaultExtensionManager) webhookConfigurationReady(_ *http.Request) error {
+	if (m.Options.RegisterWebHook != nil && !*m.Options.RegisterWebHook) || m.Options.EnableLeaderElection {
+		return nil
+	}
+	if !m.webhooksConfigured {
+		return errWebhooksNotConfigured
+	}
+	return nil
+}
+
+// webhookServerReady checks that the webhook servers accept TLS connections
+func (m *DefaultExtensionManager) webhookServerReady(_ *http.Request) error {
+	if len(m.admissionServers) == 0 {
+		return errWebhookServerNotServing
+	}
+	for _, s := range m.admissionServers {
+		if !s.isServing() {
+			return errWebhookServerNotServing
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package extension_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Health probes", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+	)
+
+	BeforeEach(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		port := listener.Addr().(*net.TCPAddr).Port
+		Expect(listener.Close()).To(Succeed())
+
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.Port = int32(port)
+		eiriniManager.Options.HealthProbeBindAddress = ":8081"
+		eiriniManager.Options.SetupCertificateName = "test-probes-setupcert"
+		eiriniManager.Credsgen = NewCredentialGenerator()
+
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(&cfakes.FakeClient{})
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+	})
+
+	// readyz returns the failing readiness checks registered to the kubernetes manager
+	readyz := func() map[string]error {
+		failing := map[string]error{}
+		for i := 0; i < kubeManager.AddReadyzCheckCallCount(); i++ {
+			name, check := kubeManager.AddReadyzCheckArgsForCall(i)
+			if err := check(httptest.NewRequest(http.MethodGet, "/readyz", nil)); err != nil {
+				failing[name] = err
+			}
+		}
+		return failing
+	}
+
+	It("reports ready once the webhook server serves TLS", func() {
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		Expect(kubeManager.AddHealthzCheckCallCount()).To(Equal(1))
+		_, ping := kubeManager.AddHealthzCheckArgsForCall(0)
+		Expect(ping(nil)).To(Succeed())
+
+		Expect(kubeManager.AddReadyzCheckCallCount()).To(Equal(4))
+		Expect(readyz()).To(HaveKeyWithValue("webhook-server", MatchError("The webhook server is not serving yet")))
+		Expect(readyz()).To(HaveLen(1))
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go kubeManager.AddArgsForCall(0).Start(stop)
+		Eventually(readyz).Should(BeEmpty())
+	})
+
+	It("reports not ready before the certificate is generated and the webhooks are registered", func() {
+		disabled := false
+		eiriniManager.Options.SetupCertificate = &disabled
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		enabled := true
+		eiriniManager.Options.SetupCertificate = &enabled
+		eiriniManager.Options.RegisterWebHook = &disabled
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		failing := readyz()
+		Expect(failing).To(HaveKey("webhook-certificate"))
+		Expect(failing).ToNot(HaveKey("webhook-configuration"))
+	})
+
+	It("aggregates the ready checks of the extensions", func() {
+		Expect(eiriniManager.AddReadyCheck("service", func(context.Context) error {
+			return errors.New("connection refused")
+		})).To(Succeed())
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		Expect(readyz()).To(HaveKeyWithValue("extensions", MatchError(ContainSubstring("service: connection refused"))))
+	})
+
+	It("validates the address of the probes", func() {
+		opts := ManagerOptions{Namespace: "eirini", HealthProbeBindAddress: "8081"}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("healthProbeBindAddress: Invalid value"))
+	})
+})
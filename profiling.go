@@ -0,0 +1,31 @@
+package extension
+
+import (
+	"context"
+	"runtime/pprof"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// ProfileLabelExtension is the pprof label holding the name of the extension handling an admission request
+	ProfileLabelExtension = "extension"
+	// ProfileLabelNamespace is the pprof label holding the namespace of the admitted pod
+	ProfileLabelNamespace = "namespace"
+)
+
+// handleProfiled handles the request in a goroutine tagged with the extension and namespace pprof labels,
+// see ManagerOptions.ProfilingLabels. The labels are also set on the context passed to the extension, and
+// inherited by the goroutines it starts.
+func (w *DefaultMutatingWebhook) handleProfiled(ctx context.Context, req admission.Request) admission.Response {
+	if !w.ProfilingLabels {
+		return w.handle(ctx, req)
+	}
+
+	var res admission.Response
+	labels := pprof.Labels(ProfileLabelExtension, extensionName(w.EiriniExtension), ProfileLabelNamespace, req.Namespace)
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		res = w.handle(ctx, req)
+	})
+	return res
+}
@@ -0,0 +1,58 @@
+package extension_test
+
+import (
+	"context"
+	"runtime/pprof"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type labelRecorder struct {
+	labels map[string]string
+}
+
+func (e *labelRecorder) Handle(ctx context.Context, _ Manager, _ *corev1.Pod, _ admission.Request) admission.Response {
+	e.labels = map[string]string{}
+	pprof.ForLabels(ctx, func(key, value string) bool {
+		e.labels[key] = value
+		return true
+	})
+	return admission.Allowed("")
+}
+
+var _ = Describe("Profiling labels", func() {
+	handle := func(profilingLabels bool) map[string]string {
+		ext := &labelRecorder{}
+		failurePolicy := admissionregistrationv1beta1.Fail
+		c := catalog.NewCatalog()
+		w := NewWebhook(ext, c.SimpleManager()).(*DefaultMutatingWebhook)
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+			ID:             "profiled",
+			ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, ProfilingLabels: profilingLabels},
+		})).To(Succeed())
+
+		injectDecoder(w)
+		req := podRequest()
+		req.Namespace = "space"
+		w.Handle(context.Background(), req)
+		return ext.labels
+	}
+
+	It("tags the requests with the extension and the namespace", func() {
+		Expect(handle(true)).To(Equal(map[string]string{
+			ProfileLabelExtension: "*extension_test.labelRecorder",
+			ProfileLabelNamespace: "space",
+		}))
+	})
+
+	It("doesn't tag the requests by default", func() {
+		Expect(handle(false)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,203 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// providedCertificateSyncInterval is the interval between the reloads of the certificate files of TLSOptions,
+// e.g. when the kubelet updates a mounted secret
+const providedCertificateSyncInterval = time.Minute
+
+// TLSOptions make the webhook servers serve a certificate provided by the operator, instead of generating one
+// with the CredentialGenerator: the certificate, its key and the CA signing it are read from the files of
+// CertDir, e.g. a mounted secret of type kubernetes.io/tls with the ca.crt key, or set as PEM data. The Manager
+// only sets the CA in the CA bundle of the webhook configurations. The files are reloaded when they change.
+//
+// The certificate must be valid for the service name of the webhook servers, or the webhook server host, and
+// is served by the servers of all the WebhookGroups.
+type TLSOptions struct {
+	// CertDir is the directory of the certificate files. Exclusive with the PEM data
+	CertDir string
+
+	// CertName, KeyName and CAName are the names of the files of the certificate, its key and the CA in CertDir.
+	// Optional, default to tls.crt, tls.key and ca.crt
+	CertName string
+	KeyName  string
+	CAName   string
+
+	// Certificate, Key and CACertificate are the PEM encoded certificate, its key and the CA, when CertDir is
+	// empty
+	Certificate   []byte
+	Key           []byte
+	CACertificate []byte
+}
+
+func (t *TLSOptions) validate(path *field.Path, o *ManagerOptions) field.ErrorList {
+	var errs field.ErrorList
+	pemData := len(t.Certificate) > 0 || len(t.Key) > 0 || len(t.CACertificate) > 0
+	switch {
+	case t.CertDir != "" && pemData:
+		errs = append(errs, field.Invalid(path.Child("certDir"), t.CertDir, "must be empty when the PEM data is set"))
+	case t.CertDir == "":
+		if len(t.Certificate) == 0 {
+			errs = append(errs, field.Required(path.Child("certificate"), "the certDir or the PEM data is required"))
+		}
+		if len(t.Key) == 0 {
+			errs = append(errs, field.Required(path.Child("key"), "the certDir or the PEM data is required"))
+		}
+		if len(t.CACertificate) == 0 {
+			errs = append(errs, field.Required(path.Child("caCertificate"), "the CA bundle of the webhook configurations"))
+		}
+		if len(errs) > 0 {
+			break
+		}
+		if _, err := tls.X509KeyPair(t.Certificate, t.Key); err != nil {
+			errs = append(errs, field.Invalid(path.Child("certificate"), "<PEM data>", err.Error()))
+		}
+		if block, _ := pem.Decode(t.CACertificate); block == nil {
+			errs = append(errs, field.Invalid(path.Child("caCertificate"), "<PEM data>", "no PEM data found"))
+		}
+	}
+	if o.CertManager != nil {
+		errs = append(errs, field.Forbidden(path, "not supported with certManager"))
+	}
+	if o.CertificateRotation != nil {
+		errs = append(errs, field.Forbidden(path, "not supported with certificateRotation, the provided certificate is not renewed"))
+	}
+	if o.SetupCertificate != nil && !*o.SetupCertificate {
+		errs = append(errs, field.Forbidden(path, "not supported with setupCertificate disabled"))
+	}
+	return errs
+}
+
+// useProvidedTLS makes the configuration serve the certificate of the TLSOptions, if set
+func (m *DefaultExtensionManager) useProvidedTLS(f *WebhookConfig) {
+	f.providedTLS = m.Options.TLS
+}
+
+// setupProvidedCertificate loads the provided certificate and writes it to disk for the webhook server
+func (f *WebhookConfig) setupProvidedCertificate() error {
+	if err := f.loadProvidedCertificate(); err != nil {
+		return err
+	}
+	if err := f.writeSecretFiles(); err != nil {
+		return errors.Wrap(err, "writing webhook certificate files to disk")
+	}
+	return nil
+}
+
+// loadProvidedCertificate reads the provided certificate, from the files of the CertDir or the PEM data
+func (f *WebhookConfig) loadProvidedCertificate() error {
+	t := f.providedTLS
+	cert, key, ca := t.Certificate, t.Key, t.CACertificate
+	if t.CertDir != "" {
+		files := []struct {
+			name, fallback string
+			data           *[]byte
+		}{
+			{t.CertName, "tls.crt", &cert},
+			{t.KeyName, "tls.key", &key},
+			{t.CAName, "ca.crt", &ca},
+		}
+		for _, file := range files {
+			name := file.name
+			if name == "" {
+				name = file.fallback
+			}
+			data, err := afero.ReadFile(f.config.Fs, filepath.Join(t.CertDir, name))
+			if err != nil {
+				return errors.Wrapf(err, "reading the provided certificate file %s", name)
+			}
+			*file.data = data
+		}
+	}
+
+	if _, err := tls.X509KeyPair(cert, key); err != nil {
+		return errors.Wrap(err, "loading the provided webhook server certificate")
+	}
+	if block, _ := pem.Decode(ca); block == nil {
+		return errors.New("No PEM data found in the provided CA certificate")
+	}
+	f.Certificate, f.Key = cert, key
+	f.CaCertificate, f.CaKey = ca, nil
+	return nil
+}
+
+// providedCertificateSync reloads the certificate files of the TLSOptions when they change
+type providedCertificateSync struct {
+	manager *DefaultExtensionManager
+	logger  *zap.SugaredLogger
+}
+
+// NeedLeaderElection makes every replica reload its certificates
+func (s *providedCertificateSync) NeedLeaderElection() bool {
+	return false
+}
+
+// Start reloads the certificates until the stop channel is closed
+func (s *providedCertificateSync) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	wait.Until(func() {
+		for _, g := range s.manager.groups {
+			if err := s.manager.reloadProvidedCertificate(ctx, g); err != nil {
+				s.logger.Errorf("Reloading the provided webhook server certificate of %s: %s", g.config.setupCertificateName, err.Error())
+			}
+		}
+	}, providedCertificateSyncInterval, stop)
+	return nil
+}
+
+// reloadProvidedCertificate reloads the provided certificate of the webhook server of the group if its files
+// changed. A new CA is set in the CA bundle of the webhook configurations before the certificate is written
+// to disk, where the webhook server picks it up.
+func (m *DefaultExtensionManager) reloadProvidedCertificate(ctx context.Context, g *webhookGroup) error {
+	// The configurations aren't registered again nor re-synced meanwhile, see resyncCABundle
+	m.failurePolicyMu.Lock()
+	defer m.failurePolicyMu.Unlock()
+
+	f := g.config
+	next := *f
+	if err := next.loadProvidedCertificate(); err != nil {
+		return err
+	}
+	if bytes.Equal(next.Certificate, f.Certificate) && bytes.Equal(next.CaCertificate, f.CaCertificate) {
+		return nil
+	}
+
+	if m.webhooksConfigured && !bytes.Equal(next.CaCertificate, f.CaCertificate) {
+		if err := next.patchCABundle(ctx, g.webhooks); err != nil {
+			return err
+		}
+	}
+	f.Certificate, f.Key = next.Certificate, next.Key
+	f.CaCertificate, f.CaKey = next.CaCertificate, next.CaKey
+	if err := f.writeSecretFiles(); err != nil {
+		return errors.Wrap(err, "writing webhook certificate files to disk")
+	}
+	m.exportCertificateExpiry(f)
+	m.Logger.Infof("Reloaded the provided webhook server certificate of %s", f.setupCertificateName)
+
+	if m.Options.PublishCABundle && f == m.WebhookConfig {
+		if err := m.publishCABundle(ctx); err != nil {
+			return errors.Wrap(err, "publishing the webhook CA bundle")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package extension_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+)
+
+var _ = Describe("Provided TLS certificates", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+		client        *cfakes.FakeClient
+		certDir       string
+		ca            Certificate
+	)
+
+	// writeCertificate generates a CA and a certificate for the webhook server, and writes them to certDir
+	writeCertificate := func() {
+		generator := NewCredentialGenerator()
+		var err error
+		ca, err = generator.GenerateCertificate("ca", CertificateRequest{CommonName: "operator CA", IsCA: true})
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := generator.GenerateCertificate("cert", CertificateRequest{CommonName: "127.0.0.1", CA: ca})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(certDir, "tls.crt"), cert.Certificate, 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(certDir, "tls.key"), cert.PrivateKey, 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(certDir, "ca.crt"), ca.Certificate, 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "eirinix-provided-tls")
+		Expect(err).ToNot(HaveOccurred())
+		writeCertificate()
+
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.SetupCertificateName = "test-provided-setupcert"
+		eiriniManager.Options.TLS = &TLSOptions{CertDir: certDir}
+		eiriniManager.Credsgen = &cfakes.FakeCredentialGenerator{}
+		Expect(eiriniManager.AddExtension(c.SimpleExtension())).To(Succeed())
+
+		client = &cfakes.FakeClient{}
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(certDir)
+		os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+	})
+
+	served := func() []byte {
+		crt, err := ioutil.ReadFile(filepath.Join(eiriniManager.WebhookConfig.CertDir, "tls.crt"))
+		Expect(err).ToNot(HaveOccurred())
+		return crt
+	}
+
+	It("serves the provided certificate and sets its CA in the webhook configuration", func() {
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.Credsgen.(*cfakes.FakeCredentialGenerator).GenerateCertificateCallCount()).To(Equal(0))
+		Expect(served()).To(Equal(eiriniManager.WebhookConfig.Certificate))
+		Expect(eiriniManager.GetCABundle()).To(Equal(ca.Certificate))
+
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		var config *admissionregistrationv1beta1.MutatingWebhookConfiguration
+		for i := 0; i < client.CreateCallCount(); i++ {
+			_, object, _ := client.CreateArgsForCall(i)
+			if c, ok := object.(*admissionregistrationv1beta1.MutatingWebhookConfiguration); ok {
+				config = c
+			}
+		}
+		Expect(config).ToNot(BeNil())
+		Expect(config.Webhooks).ToNot(BeEmpty())
+		for _, w := range config.Webhooks {
+			Expect(w.ClientConfig.CABundle).To(Equal(ca.Certificate))
+		}
+	})
+
+	It("reloads the certificate files when they change", func() {
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		writeCertificate()
+		crt, err := ioutil.ReadFile(filepath.Join(certDir, "tls.crt"))
+		Expect(err).ToNot(HaveOccurred())
+
+		stop := make(chan struct{})
+		defer close(stop)
+		for i := 0; i < kubeManager.AddCallCount(); i++ {
+			if r := kubeManager.AddArgsForCall(i); fmt.Sprintf("%T", r) == "*extension.providedCertificateSync" {
+				go r.Start(stop)
+			}
+		}
+
+		Eventually(served).Should(Equal(crt))
+		Expect(client.PatchCallCount()).To(Equal(1))
+		_, object, patch, _ := client.PatchArgsForCall(0)
+		data, err := patch.Data(object)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(base64.StdEncoding.EncodeToString(ca.Certificate)))
+	})
+
+	It("validates the provided certificate", func() {
+		opts := ManagerOptions{Namespace: "eirini", TLS: &TLSOptions{Certificate: []byte("certificate")}}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("tls.key: Required value"))
+		Expect(err.Error()).To(ContainSubstring("tls.caCertificate: Required value"))
+
+		opts.TLS = &TLSOptions{CertDir: certDir, CACertificate: ca.Certificate}
+		Expect(opts.Validate()).To(MatchError(ContainSubstring("tls.certDir: Invalid value")))
+	})
+})
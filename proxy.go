@@ -0,0 +1,323 @@
+package extension
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// proxyProtocolV1MaxLength is the maximum length of a v1 header, CRLF included
+	proxyProtocolV1MaxLength = 107
+
+	defaultProxyHeaderTimeout = 5 * time.Second
+)
+
+var (
+	proxyProtocolV1Prefix    = []byte("PROXY ")
+	proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// FrontProxyOptions configures the webhook server when it runs behind a front proxy or a load balancer
+type FrontProxyOptions struct {
+	// ProxyProtocol enables parsing of PROXY protocol (v1 and v2) headers on incoming connections.
+	// Connections which don't send a header (e.g. TCP health probes of the load balancer) are served as they are.
+	ProxyProtocol bool
+
+	// ForwardedHeaders enables honoring the X-Forwarded-For header to determine the client address
+	ForwardedHeaders bool
+
+	// TrustedCIDRs is the list of networks (or single IPs) of the proxies which are trusted to supply the
+	// client address. If omitted no peer is trusted, and the PROXY and X-Forwarded-For headers are ignored.
+	TrustedCIDRs []string
+
+	// HeaderTimeout is the maximum time to wait for a PROXY protocol header. Optional, defaults to 5 seconds
+	HeaderTimeout time.Duration
+}
+
+func (o *FrontProxyOptions) trustedNetworks() ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range o.TrustedCIDRs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, errors.Errorf("invalid trusted proxy address '%s'", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing trusted proxy network '%s'", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func isTrustedIP(ip net.IP, trusted []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func addrIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
+
+// NewProxyProtocolListener wraps a listener so that the client address advertised in PROXY protocol
+// headers is returned as RemoteAddr of the accepted connections.
+func NewProxyProtocolListener(l net.Listener, opts FrontProxyOptions) (net.Listener, error) {
+	trusted, err := opts.trustedNetworks()
+	if err != nil {
+		return nil, err
+	}
+	timeout := opts.HeaderTimeout
+	if timeout == 0 {
+		timeout = defaultProxyHeaderTimeout
+	}
+	return &proxyProtocolListener{Listener: l, trusted: trusted, headerTimeout: timeout}, nil
+}
+
+type proxyProtocolListener struct {
+	net.Listener
+	trusted       []*net.IPNet
+	headerTimeout time.Duration
+}
+
+// Accept waits for the next connection. The PROXY header is read lazily, on the first Read or RemoteAddr call,
+// so that a slow client can't block the accept loop.
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !isTrustedIP(addrIP(conn.RemoteAddr().String()), l.trusted) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn), headerTimeout: l.headerTimeout}, nil
+}
+
+type proxyConn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+
+	// readDeadline is the read deadline set by the server, restored once the header is read
+	mu           sync.Mutex
+	readDeadline time.Time
+}
+
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.mu.Lock()
+		previous := c.readDeadline
+		deadline := time.Now().Add(c.headerTimeout)
+		if !previous.IsZero() && previous.Before(deadline) {
+			deadline = previous
+		}
+		c.Conn.SetReadDeadline(deadline)
+		c.mu.Unlock()
+
+		c.remoteAddr, c.err = readProxyHeader(c.reader)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.Conn.SetReadDeadline(c.readDeadline)
+	})
+}
+
+// SetDeadline sets the read and write deadlines of the connection
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection, which applies to the PROXY header if it is earlier
+// than the header timeout
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+// Read reads from the connection, after the PROXY header has been consumed
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address sent by the proxy, or the peer address if none was sent
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader consumes a PROXY protocol header, if any. It returns a nil address when
+// no header was sent or when the proxy doesn't convey the client address (LOCAL/UNKNOWN).
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	if b, err := r.Peek(len(proxyProtocolV1Prefix)); err == nil && bytes.Equal(b, proxyProtocolV1Prefix) {
+		return readProxyHeaderV1(r)
+	}
+	if b, err := r.Peek(len(proxyProtocolV2Signature)); err == nil && bytes.Equal(b, proxyProtocolV2Signature) {
+		return readProxyHeaderV2(r)
+	}
+	return nil, nil
+}
+
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "reading PROXY protocol v1 header")
+	}
+	if len(line) > proxyProtocolV1MaxLength {
+		return nil, errors.New("PROXY protocol v1 header too long")
+	}
+
+	fields := strings.Fields(strings.TrimSuffix(string(line), "\r\n"))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.Errorf("invalid PROXY protocol v1 header '%s'", strings.TrimSpace(string(line)))
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, errors.Errorf("invalid PROXY protocol v1 source address '%s'", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid PROXY protocol v1 source port '%s'", fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyProtocolV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(err, "reading PROXY protocol v2 header")
+	}
+
+	verCmd := header[12]
+	if verCmd>>4 != 2 {
+		return nil, errors.Errorf("unsupported PROXY protocol version %d", verCmd>>4)
+	}
+	family := header[13] >> 4
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.Wrap(err, "reading PROXY protocol v2 addresses")
+	}
+
+	// LOCAL command: the connection was established by the proxy itself (e.g. health checks)
+	if verCmd&0x0F == 0 {
+		return nil, nil
+	}
+
+	switch family {
+	case 1: // AF_INET
+		if len(payload) < 12 {
+			return nil, errors.New("PROXY protocol v2 IPv4 address block too short")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, errors.New("PROXY protocol v2 IPv6 address block too short")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	return nil, nil
+}
+
+type sourceAddressKey struct{}
+
+// ContextWithSourceAddress returns a context carrying the client address of the admission request, once resolved
+// behind the front proxy. The Manager webhook server sets it for every request, and it is recorded in the
+// AuditEvent of the decision.
+func ContextWithSourceAddress(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, sourceAddressKey{}, addr)
+}
+
+// SourceAddressFromContext returns the client address of the admission request, or an empty string
+func SourceAddressFromContext(ctx context.Context) string {
+	addr, _ := ctx.Value(sourceAddressKey{}).(string)
+	return addr
+}
+
+// NewForwardedHeadersHandler wraps a handler so that the request RemoteAddr is the client address found in the
+// X-Forwarded-For header, if the request comes from a trusted proxy.
+func NewForwardedHeadersHandler(next http.Handler, opts FrontProxyOptions) (http.Handler, error) {
+	trusted, err := opts.trustedNetworks()
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded := r.Header["X-Forwarded-For"]
+		if len(forwarded) > 0 && isTrustedIP(addrIP(r.RemoteAddr), trusted) {
+			if ip := forwardedClientIP(forwarded, trusted); ip != nil {
+				port := r.Header.Get("X-Forwarded-Port")
+				if port == "" {
+					port = "0"
+				}
+				r.RemoteAddr = net.JoinHostPort(ip.String(), port)
+			}
+		}
+		next.ServeHTTP(w, r)
+	}), nil
+}
+
+// forwardedClientIP returns the right-most address of the X-Forwarded-For headers which isn't a trusted proxy:
+// every proxy appends the address of its peer, so the addresses on its left could be forged by the client. It
+// returns nil if that address is invalid.
+func forwardedClientIP(forwarded []string, trusted []*net.IPNet) net.IP {
+	var addresses []string
+	for _, header := range forwarded {
+		addresses = append(addresses, strings.Split(header, ",")...)
+	}
+	var ip net.IP
+	for i := len(addresses) - 1; i >= 0; i-- {
+		ip = net.ParseIP(strings.TrimSpace(addresses[i]))
+		if ip == nil || !isTrustedIP(ip, trusted) {
+			return ip
+		}
+	}
+	// All the addresses are trusted proxies, the left-most one is the closest to the client
+	return ip
+}
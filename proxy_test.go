@@ -0,0 +1,169 @@
+package extension_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PROXY protocol listener", func() {
+	var (
+		listener net.Listener
+		opts     FrontProxyOptions
+	)
+
+	BeforeEach(func() {
+		opts = FrontProxyOptions{ProxyProtocol: true, TrustedCIDRs: []string{"127.0.0.1"}}
+	})
+
+	JustBeforeEach(func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		listener, err = NewProxyProtocolListener(l, opts)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	send := func(payload []byte) net.Conn {
+		go func() {
+			defer GinkgoRecover()
+			c, err := net.Dial("tcp", listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = c.Write(payload)
+			Expect(err).ToNot(HaveOccurred())
+			c.Close()
+		}()
+		conn, err := listener.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		return conn
+	}
+
+	It("uses the client address of a v1 header", func() {
+		conn := send([]byte("PROXY TCP4 10.1.2.3 10.0.0.1 4242 443\r\nhello"))
+		defer conn.Close()
+
+		Expect(conn.RemoteAddr().String()).To(Equal("10.1.2.3:4242"))
+		data, err := ioutil.ReadAll(conn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("hello"))
+	})
+
+	It("uses the client address of a v2 header", func() {
+		header := []byte("\r\n\r\n\x00\r\nQUIT\n")
+		header = append(header, 0x21, 0x11, 0x00, 0x0C)
+		header = append(header, 10, 1, 2, 3, 10, 0, 0, 1, 0x10, 0x92, 0x01, 0xBB)
+		conn := send(append(header, []byte("hello")...))
+		defer conn.Close()
+
+		Expect(conn.RemoteAddr().String()).To(Equal("10.1.2.3:4242"))
+		data, err := ioutil.ReadAll(conn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("hello"))
+	})
+
+	It("serves connections without a header untouched", func() {
+		conn := send([]byte("GET /healthz HTTP/1.1\r\n\r\n"))
+		defer conn.Close()
+
+		Expect(conn.RemoteAddr().String()).To(HavePrefix("127.0.0.1:"))
+		data, err := ioutil.ReadAll(conn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("GET /healthz HTTP/1.1\r\n\r\n"))
+	})
+
+	It("keeps the read deadline of the server once the header is read", func() {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer client.Close()
+		_, err = client.Write([]byte("PROXY TCP4 10.1.2.3 10.0.0.1 4242 443\r\n"))
+		Expect(err).ToNot(HaveOccurred())
+		conn, err := listener.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		Expect(conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))).To(Succeed())
+		_, err = conn.Read(make([]byte, 1))
+		Expect(err).To(HaveOccurred())
+		Expect(err.(net.Error).Timeout()).To(BeTrue())
+		Expect(conn.RemoteAddr().String()).To(Equal("10.1.2.3:4242"))
+	})
+
+	Context("without trusted proxies", func() {
+		BeforeEach(func() {
+			opts.TrustedCIDRs = nil
+		})
+
+		It("ignores the header", func() {
+			conn := send([]byte("PROXY TCP4 10.1.2.3 10.0.0.1 4242 443\r\n"))
+			defer conn.Close()
+
+			Expect(conn.RemoteAddr().String()).To(HavePrefix("127.0.0.1:"))
+		})
+	})
+
+	Context("when the peer is not a trusted proxy", func() {
+		BeforeEach(func() {
+			opts.TrustedCIDRs = []string{"192.168.0.0/16"}
+		})
+
+		It("ignores the header", func() {
+			conn := send([]byte("PROXY TCP4 10.1.2.3 10.0.0.1 4242 443\r\n"))
+			defer conn.Close()
+
+			Expect(conn.RemoteAddr().String()).To(HavePrefix("127.0.0.1:"))
+		})
+	})
+
+	It("fails with invalid trusted networks", func() {
+		_, err := NewProxyProtocolListener(listener, FrontProxyOptions{TrustedCIDRs: []string{"foo"}})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Forwarded headers handler", func() {
+	var opts FrontProxyOptions
+
+	BeforeEach(func() {
+		opts = FrontProxyOptions{ForwardedHeaders: true, TrustedCIDRs: []string{"127.0.0.1", "10.0.0.0/24"}}
+	})
+
+	remoteAddr := func(forwarded ...string) string {
+		var addr string
+		h, err := NewForwardedHeadersHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			addr = r.RemoteAddr
+		}), opts)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest("POST", "/0", nil)
+		req.RemoteAddr = "127.0.0.1:4242"
+		for _, f := range forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		return addr
+	}
+
+	It("uses the right-most address which isn't a trusted proxy", func() {
+		Expect(remoteAddr("192.168.1.1")).To(Equal("192.168.1.1:0"))
+		Expect(remoteAddr("6.6.6.6, 192.168.1.1, 10.0.0.2")).To(Equal("192.168.1.1:0"))
+		Expect(remoteAddr("6.6.6.6", "192.168.1.1")).To(Equal("192.168.1.1:0"))
+		Expect(remoteAddr("10.0.0.3, 10.0.0.2")).To(Equal("10.0.0.3:0"))
+	})
+
+	It("keeps the peer address when the client address is invalid", func() {
+		Expect(remoteAddr("192.168.1.1, unknown")).To(Equal("127.0.0.1:4242"))
+	})
+
+	It("trusts no proxy without trusted networks", func() {
+		opts.TrustedCIDRs = nil
+		Expect(remoteAddr("192.168.1.1")).To(Equal("127.0.0.1:4242"))
+	})
+})
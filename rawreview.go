@@ -0,0 +1,66 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// RawHandler is implemented by the extensions needing the AdmissionReview as sent by the API server, e.g.
+// to read fields the typed request drops. HandleRaw is called instead of Handle, with the raw
+// AdmissionReview alongside the decoded pod, which is nil as for Handle if no pod could be decoded.
+//
+// The review is the body of the request when served by the Manager webhook server. Otherwise, e.g. when
+// the webhook is called directly, it is the request encoded in an AdmissionReview.
+type RawHandler interface {
+	HandleRaw(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request, review []byte) admission.Response
+}
+
+type rawReviewKey struct{}
+
+// withRawReview returns a context carrying the raw AdmissionReview of the request
+func withRawReview(ctx context.Context, review []byte) context.Context {
+	return context.WithValue(ctx, rawReviewKey{}, review)
+}
+
+// rawReview returns the raw AdmissionReview of the context, or encodes the request in one
+func rawReview(ctx context.Context, req admission.Request) ([]byte, error) {
+	if review, ok := ctx.Value(rawReviewKey{}).([]byte); ok {
+		return review, nil
+	}
+	return json.Marshal(admissionv1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1beta1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Request:  &req.AdmissionRequest,
+	})
+}
+
+// wantsRawReview returns true if the webhook calls a RawHandler, so that the review body is kept
+// for it instead of going back to the pool
+func wantsRawReview(wh *webhook.Admission) bool {
+	w, ok := wh.Handler.(*DefaultMutatingWebhook)
+	if !ok {
+		return false
+	}
+	_, ok = w.EiriniExtension.(RawHandler)
+	return ok
+}
+
+// handleExtension calls the extension, with the raw review if it is a RawHandler
+func (w *DefaultMutatingWebhook) handleExtension(ctx context.Context, pod *corev1.Pod, req admission.Request) admission.Response {
+	raw, ok := w.EiriniExtension.(RawHandler)
+	if !ok {
+		return w.EiriniExtension.Handle(ctx, w.extensionManager(req), pod, req)
+	}
+	review, err := rawReview(ctx, req)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, errors.Wrap(err, "encoding the admission review"))
+	}
+	return raw.HandleRaw(ctx, w.extensionManager(req), pod, req, review)
+}
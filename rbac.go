@@ -0,0 +1,486 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// RBACCheckMode defines what the Manager does when the service account it runs with
+// has broader permissions than the ones declared by the manager and its extensions
+type RBACCheckMode string
+
+const (
+	// RBACCheckDisabled skips the permissions check
+	RBACCheckDisabled RBACCheckMode = ""
+	// RBACCheckWarn logs the permissions exceeding the declared ones
+	RBACCheckWarn RBACCheckMode = "warn"
+	// RBACCheckEnforce refuses to start if the service account has undeclared permissions
+	RBACCheckEnforce RBACCheckMode = "enforce"
+)
+
+// PermissionedExtension can be implemented by Extensions, Watchers and Reconcilers
+// to declare the kubernetes permissions they need.
+type PermissionedExtension interface {
+	RequiredPermissions() []rbacv1.PolicyRule
+}
+
+// ExtensionPermissions are the permissions declared by a single extension
+type ExtensionPermissions struct {
+	// Extension is the extension name, "eirinix" for the permissions required by the Manager itself
+	Extension string
+	Rules     []rbacv1.PolicyRule
+}
+
+// PermissionsReport returns the permissions declared by the Manager and by each of the extensions
+func (m *DefaultExtensionManager) PermissionsReport() []ExtensionPermissions {
+	report := []ExtensionPermissions{{Extension: "eirinix", Rules: m.managerPermissions()}}
+
+	for _, e := range m.allExtensions() {
+		if p, ok := e.(PermissionedExtension); ok {
+			report = append(report, ExtensionPermissions{Extension: extensionName(e), Rules: p.RequiredPermissions()})
+		}
+	}
+	return report
+}
+
+// RequiredPermissions returns the minimal set of rules covering the permissions
+// declared by the Manager and all its extensions
+func (m *DefaultExtensionManager) RequiredPermissions() []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+	for _, p := range m.PermissionsReport() {
+		rules = append(rules, p.Rules...)
+	}
+	return MinimizeRules(rules)
+}
+
+// RBACManifest returns a ClusterRole manifest with the given name, granting the
+// permissions returned by RequiredPermissions
+func (m *DefaultExtensionManager) RBACManifest(name string) ([]byte, error) {
+	role := &rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "ClusterRole",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Rules:      m.RequiredPermissions(),
+	}
+	return yaml.Marshal(role)
+}
+
+func (m *DefaultExtensionManager) managerPermissions() []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+	if len(m.Options.WatchedNamespaces()) > 0 {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"namespaces"},
+			Verbs:     []string{"get", "update"},
+		})
+	}
+	// The provided certificates aren't stored in secrets, see TLSOptions
+	if (m.Options.SetupCertificate == nil || *m.Options.SetupCertificate) && m.Options.TLS == nil {
+		// The expired certificates are renewed, see resyncCABundle
+		verbs := []string{"get", "create", "delete"}
+		if m.Options.CertificateRotation != nil {
+			verbs = append(verbs, "update")
+		}
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     verbs,
+		})
+	}
+	if m.Options.RegisterWebHook == nil || *m.Options.RegisterWebHook {
+		validating := false
+		for _, e := range m.Extensions {
+			validating = validating || isValidating(e)
+		}
+		resources := []string{"mutatingwebhookconfigurations"}
+		if validating {
+			resources = append(resources, "validatingwebhookconfigurations")
+		}
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{"admissionregistration.k8s.io"},
+			Resources: resources,
+			Verbs:     []string{"create", "delete", "patch"},
+		})
+		if !validating {
+			// The validating configuration left by removed validating extensions is deleted on registration
+			rules = append(rules, rbacv1.PolicyRule{
+				APIGroups: []string{"admissionregistration.k8s.io"},
+				Resources: []string{"validatingwebhookconfigurations"},
+				Verbs:     []string{"delete"},
+			})
+		}
+	}
+	if m.Options.CertManager != nil {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{certificateGVK.Group},
+			Resources: []string{"certificates"},
+			Verbs:     []string{"get", "create", "update"},
+		})
+	}
+	if m.Options.PublishCABundle {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"create", "update"},
+		})
+	}
+	if m.Options.ServiceName != "" && m.Options.Service != nil {
+		resources := []string{"services"}
+		if len(m.Options.Service.Selector) == 0 {
+			resources = append(resources, "endpoints")
+		}
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: resources,
+			Verbs:     []string{"get", "create", "update"},
+		})
+	}
+	if m.Options.Autoscaling != nil {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{"autoscaling"},
+			Resources: []string{"horizontalpodautoscalers"},
+			Verbs:     []string{"get", "create", "update"},
+		})
+	}
+	if m.Options.ReportStatus {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{"apiextensions.k8s.io"},
+			Resources: []string{"customresourcedefinitions"},
+			Verbs:     []string{"get", "create", "update"},
+		}, rbacv1.PolicyRule{
+			APIGroups: []string{ledgerGroup},
+			Resources: []string{statusResource},
+			Verbs:     []string{"get", "create", "update"},
+		})
+	}
+	if m.Options.InstallLedgerCRD || m.Options.InstallStorageCRD {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{"apiextensions.k8s.io"},
+			Resources: []string{"customresourcedefinitions"},
+			Verbs:     []string{"get", "create", "update"},
+		})
+	}
+	if m.Options.EiriniCompatibility == EiriniCompatibilityAuto {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{"apps"},
+			Resources: []string{"statefulsets"},
+			Verbs:     []string{"list"},
+		})
+	}
+	if m.Options.PrewarmCache {
+		rules = append(rules, prewarmPermissions()...)
+	}
+	if m.Options.Handover != nil {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{"coordination.k8s.io"},
+			Resources: []string{"leases"},
+			Verbs:     []string{"get", "create", "update"},
+		})
+	}
+	if c := m.Options.RequireClientCertificate; c != nil && c.ClusterClientCA {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"configmaps"},
+			ResourceNames: []string{clusterAuthentication.Name},
+			Verbs:         []string{"get"},
+		})
+	}
+	if m.Options.EnableLeaderElection {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"get", "create", "update"},
+		}, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"events"},
+			Verbs:     []string{"create", "patch"},
+		})
+	}
+	if m.Options.VerifyReachability {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"create"},
+		}, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"events"},
+			Verbs:     []string{"create", "patch"},
+		})
+	}
+	if len(m.Watchers) > 0 {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"list", "watch"},
+		})
+	}
+	return rules
+}
+
+// MinimizeRules merges the rules targeting the same api groups, resources and resource names,
+// removing duplicated verbs. The result is sorted, to be stable across runs.
+func MinimizeRules(rules []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+	merged := map[string]*rbacv1.PolicyRule{}
+	var keys []string
+
+	for _, rule := range rules {
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				key := strings.Join([]string{group, resource, strings.Join(rule.ResourceNames, ",")}, "/")
+				r, ok := merged[key]
+				if !ok {
+					r = &rbacv1.PolicyRule{
+						APIGroups:     []string{group},
+						Resources:     []string{resource},
+						ResourceNames: rule.ResourceNames,
+					}
+					merged[key] = r
+					keys = append(keys, key)
+				}
+				r.Verbs = mergeVerbs(r.Verbs, rule.Verbs)
+			}
+		}
+	}
+
+	// Group back together resources of the same api group sharing the same verbs
+	grouped := map[string]*rbacv1.PolicyRule{}
+	var groupedKeys []string
+	sort.Strings(keys)
+	for _, key := range keys {
+		r := merged[key]
+		groupKey := strings.Join([]string{r.APIGroups[0], strings.Join(r.ResourceNames, ","), strings.Join(r.Verbs, ",")}, "/")
+		g, ok := grouped[groupKey]
+		if !ok {
+			grouped[groupKey] = r
+			groupedKeys = append(groupedKeys, groupKey)
+			continue
+		}
+		g.Resources = append(g.Resources, r.Resources...)
+	}
+
+	var result []rbacv1.PolicyRule
+	for _, key := range groupedKeys {
+		result = append(result, *grouped[key])
+	}
+	return result
+}
+
+func mergeVerbs(verbs, others []string) []string {
+	set := map[string]bool{}
+	for _, v := range append(verbs, others...) {
+		set[v] = true
+	}
+	if set[rbacv1.VerbAll] {
+		return []string{rbacv1.VerbAll}
+	}
+	result := make([]string, 0, len(set))
+	for v := range set {
+		result = append(result, v)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func ruleAllows(rule rbacv1.PolicyRule, group, resource, verb string) bool {
+	return containsOrWildcard(rule.APIGroups, group) &&
+		containsOrWildcard(rule.Resources, resource) &&
+		containsOrWildcard(rule.Verbs, verb)
+}
+
+func containsOrWildcard(list []string, s string) bool {
+	for _, l := range list {
+		if l == s || l == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcessPermissions returns the granted permissions which are not covered by the declared rules,
+// formatted as "verb group/resource". Permissions which every authenticated user has
+// (e.g. self subject reviews) are ignored.
+func ExcessPermissions(granted []authorizationv1.ResourceRule, declared []rbacv1.PolicyRule) []string {
+	var excess []string
+	seen := map[string]bool{}
+	for _, g := range granted {
+		for _, group := range g.APIGroups {
+			if group == "authorization.k8s.io" || group == "authentication.k8s.io" {
+				continue
+			}
+			for _, resource := range g.Resources {
+				for _, verb := range g.Verbs {
+					allowed := false
+					for _, d := range declared {
+						if ruleAllows(d, group, resource, verb) {
+							allowed = true
+							break
+						}
+					}
+					permission := fmt.Sprintf("%s %s/%s", verb, group, resource)
+					if !allowed && !seen[permission] {
+						seen[permission] = true
+						excess = append(excess, permission)
+					}
+				}
+			}
+		}
+	}
+	return excess
+}
+
+// clusterScopedResources are the cluster-scoped resources the Manager and the extensions may need, which are
+// reviewed without namespace by MissingPermissions
+var clusterScopedResources = map[string]bool{
+	"namespaces":                      true,
+	"nodes":                           true,
+	"persistentvolumes":               true,
+	"priorityclasses":                 true,
+	"customresourcedefinitions":       true,
+	"mutatingwebhookconfigurations":   true,
+	"validatingwebhookconfigurations": true,
+}
+
+// MissingPermissions reviews each permission of the rules with a SelfSubjectAccessReview, and returns the denied
+// ones formatted as "verb group/resource", followed by the namespace they were reviewed in for the namespaced
+// resources.
+func MissingPermissions(ctx context.Context, reviews authorizationv1client.SelfSubjectAccessReviewInterface, namespace string, rules []rbacv1.PolicyRule) ([]string, error) {
+	var missing []string
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		names := rule.ResourceNames
+		if len(names) == 0 {
+			names = []string{""}
+		}
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				parts := strings.SplitN(resource, "/", 2)
+				attributes := authorizationv1.ResourceAttributes{Group: group, Resource: parts[0]}
+				if len(parts) > 1 {
+					attributes.Subresource = parts[1]
+				}
+				if !clusterScopedResources[parts[0]] {
+					attributes.Namespace = namespace
+				}
+
+				for _, verb := range rule.Verbs {
+					for _, name := range names {
+						attributes.Verb, attributes.Name = verb, name
+						permission := fmt.Sprintf("%s %s/%s", verb, group, resource)
+						if name != "" {
+							permission += " " + name
+						}
+						if attributes.Namespace != "" {
+							permission += " in " + attributes.Namespace
+						}
+						if seen[permission] {
+							continue
+						}
+						seen[permission] = true
+
+						a := attributes
+						review, err := reviews.Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+							Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &a},
+						}, metav1.CreateOptions{})
+						if err != nil {
+							return nil, errors.Wrapf(err, "reviewing the %s permission", permission)
+						}
+						if !review.Status.Allowed {
+							missing = append(missing, permission)
+						}
+					}
+				}
+			}
+		}
+	}
+	return missing, nil
+}
+
+// authorizationClient returns the client reviewing the permissions of the service account
+func (m *DefaultExtensionManager) authorizationClient() (authorizationv1client.AuthorizationV1Interface, error) {
+	kubeConn, err := m.GetKubeConnection()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(kubeConn)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating the authorization client")
+	}
+	return clientset.AuthorizationV1(), nil
+}
+
+// permissionsNamespace is the namespace the permissions of the service account are reviewed in
+func (o *ManagerOptions) permissionsNamespace() string {
+	if o.WebhookNamespace != "" {
+		return o.WebhookNamespace
+	}
+	if o.Namespace != "" {
+		return o.Namespace
+	}
+	return "default"
+}
+
+// checkRequiredPermissions refuses to start, with StrictPermissions, if the service account lacks permissions
+// required by the Manager features or the extensions, before they fail mid-operation
+func (m *DefaultExtensionManager) checkRequiredPermissions() error {
+	if !m.Options.StrictPermissions {
+		return nil
+	}
+
+	client, err := m.authorizationClient()
+	if err != nil {
+		return err
+	}
+	missing, err := MissingPermissions(m.GetContext(), client.SelfSubjectAccessReviews(), m.Options.permissionsNamespace(), m.RequiredPermissions())
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("The service account is missing permissions required by the Manager and the extensions: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkPermissions compares the rules granted to the service account in the operator namespace
+// with the declared ones, and warns or fails according to the RBACCheck option
+func (m *DefaultExtensionManager) checkPermissions() error {
+	if m.Options.RBACCheck == RBACCheckDisabled {
+		return nil
+	}
+
+	client, err := m.authorizationClient()
+	if err != nil {
+		return err
+	}
+
+	review, err := client.SelfSubjectRulesReviews().Create(
+		m.GetContext(),
+		&authorizationv1.SelfSubjectRulesReview{Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: m.Options.permissionsNamespace()}},
+		metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrap(err, "reviewing the service account permissions")
+	}
+
+	excess := ExcessPermissions(review.Status.ResourceRules, m.RequiredPermissions())
+	if len(excess) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("The service account has permissions which are not declared by the extensions: %s", strings.Join(excess, ", "))
+	if m.Options.RBACCheck == RBACCheckEnforce {
+		return errors.New(msg)
+	}
+	m.Logger.Warn(msg)
+	return nil
+}
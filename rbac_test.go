@@ -0,0 +1,149 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type configMapReader struct{}
+
+func (e *configMapReader) Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response {
+	return admission.Allowed("")
+}
+
+func (e *configMapReader) RequiredPermissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list"}},
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+	}
+}
+
+var _ = Describe("RBAC permissions", func() {
+	var eiriniManager *DefaultExtensionManager
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+	})
+
+	It("aggregates the permissions of the manager and of the extensions", func() {
+		Expect(eiriniManager.AddExtension(&configMapReader{})).To(Succeed())
+
+		report := eiriniManager.PermissionsReport()
+		Expect(report).To(HaveLen(2))
+		Expect(report[0].Extension).To(Equal("eirinix"))
+		Expect(report[1].Rules).To(HaveLen(2))
+
+		Expect(eiriniManager.RequiredPermissions()).To(ConsistOf(
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list"}},
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "update"}},
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"create", "delete", "get"}},
+			rbacv1.PolicyRule{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"mutatingwebhookconfigurations"}, Verbs: []string{"create", "delete", "patch"}},
+			// The validating configuration of removed validating extensions is deleted
+			rbacv1.PolicyRule{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"validatingwebhookconfigurations"}, Verbs: []string{"delete"}},
+		))
+	})
+
+	It("generates a ClusterRole manifest", func() {
+		manifest, err := eiriniManager.RBACManifest("eirinix-operator")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(manifest)).To(ContainSubstring("kind: ClusterRole"))
+		Expect(string(manifest)).To(ContainSubstring("name: eirinix-operator"))
+		Expect(string(manifest)).To(ContainSubstring("mutatingwebhookconfigurations"))
+	})
+
+	It("merges resources sharing the same verbs", func() {
+		rules := MinimizeRules([]rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+			{APIGroups: []string{""}, Resources: []string{"secrets", "pods"}, Verbs: []string{"get"}},
+		})
+		Expect(rules).To(Equal([]rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"pods", "secrets"}, Verbs: []string{"get"}},
+		}))
+	})
+
+	It("reports granted permissions which were not declared", func() {
+		granted := []authorizationv1.ResourceRule{
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "delete"}},
+			{APIGroups: []string{"authorization.k8s.io"}, Resources: []string{"selfsubjectrulesreviews"}, Verbs: []string{"create"}},
+		}
+		declared := []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+		}
+		Expect(ExcessPermissions(granted, declared)).To(Equal([]string{"delete /secrets"}))
+	})
+
+	It("reports the required permissions which are denied", func() {
+		clientset := fake.NewSimpleClientset()
+		var reviewed []authorizationv1.ResourceAttributes
+		clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			attributes := review.Spec.ResourceAttributes
+			reviewed = append(reviewed, *attributes)
+			review.Status.Allowed = attributes.Resource != "mutatingwebhookconfigurations" && attributes.Verb != "update"
+			return true, review, nil
+		})
+
+		missing, err := MissingPermissions(context.Background(), clientset.AuthorizationV1().SelfSubjectAccessReviews(), "cf", []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "update"}},
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "create"}},
+			{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"mutatingwebhookconfigurations"}, Verbs: []string{"create"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(missing).To(Equal([]string{
+			"update /namespaces",
+			"create admissionregistration.k8s.io/mutatingwebhookconfigurations",
+		}))
+		Expect(reviewed).To(HaveLen(5))
+		Expect(reviewed[0].Namespace).To(BeEmpty())
+		Expect(reviewed[2].Namespace).To(Equal("cf"))
+	})
+
+	It("reviews the required permissions when the extensions are registered without starting", func() {
+		// The API server has no resource, and denies every access review
+		apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/api":
+				w.Write([]byte(`{"kind":"APIVersions","versions":["v1"]}`))
+			case "/apis":
+				w.Write([]byte(`{"kind":"APIGroupList","groups":[]}`))
+			case "/api/v1":
+				w.Write([]byte(`{"kind":"APIResourceList","groupVersion":"v1","resources":[]}`))
+			case "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
+				review := authorizationv1.SelfSubjectAccessReview{}
+				json.NewDecoder(r.Body).Decode(&review)
+				review.Status.Allowed = false
+				json.NewEncoder(w).Encode(&review)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer apiServer.Close()
+
+		eiriniManager.Context = nil
+		eiriniManager.Options.StrictPermissions = true
+		eiriniManager.SetKubeConnection(&rest.Config{Host: apiServer.URL})
+		Expect(eiriniManager.AddExtension(&configMapReader{})).To(Succeed())
+
+		err := eiriniManager.RegisterExtensions()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("The service account is missing permissions"))
+		Expect(err.Error()).To(ContainSubstring("configmaps"))
+	})
+})
@@ -0,0 +1,230 @@
+package extension
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// AnnotationReachablePrefix prefixes the annotations the webhooks set on the reachability probe pod, see
+	// ManagerOptions.VerifyReachability
+	AnnotationReachablePrefix = "reachable.eirinix.cloudfoundry.org/"
+
+	// ReasonWebhookUnreachable and ReasonWebhookReachable are the reasons of the events reporting the
+	// reachability of the webhooks from the API server
+	ReasonWebhookUnreachable = "WebhookUnreachable"
+	ReasonWebhookReachable   = "WebhookReachable"
+
+	reachabilityProbeName  = "eirinix-reachability-probe"
+	reachabilityProbeImage = "eirinix/reachability-probe"
+	reachabilityCheckName  = "webhook-reachability"
+
+	// reachabilityInterval is the interval between the probes until the webhooks are reached
+	reachabilityInterval = 10 * time.Second
+	// reachabilityGracePeriod is the time the API server is given to reach the webhooks, e.g. while the
+	// endpoints of the Service are updated, before the Manager reports not ready
+	reachabilityGracePeriod = time.Minute
+)
+
+// reachabilityProbe answers the dry-run creation of the probe pod with a patch setting the annotation of the
+// webhook, which tells the prober the API server reached it. It returns false for the other requests.
+func (w *DefaultMutatingWebhook) reachabilityProbe(req admission.Request) (admission.Response, bool) {
+	if req.Name != reachabilityProbeName || req.Operation != admissionv1beta1.Create || req.DryRun == nil || !*req.DryRun {
+		return admission.Response{}, false
+	}
+	key := AnnotationReachablePrefix + strings.TrimPrefix(w.Path, "/")
+	res := admission.Patched("", jsonpatch.NewOperation("add", "/metadata/annotations/"+podwebhook.EscapeJSONPointer(key), "true"))
+	pt := admissionv1beta1.PatchTypeJSONPatch
+	res.PatchType = &pt
+	return res, true
+}
+
+// admitsPodCreations returns true if the rules send the pod creations to the webhook
+func admitsPodCreations(rules []admissionregistrationv1beta1.RuleWithOperations) bool {
+	for _, r := range rules {
+		operation := false
+		for _, op := range r.Operations {
+			operation = operation || op == admissionregistrationv1beta1.Create || op == admissionregistrationv1beta1.OperationAll
+		}
+		for _, resource := range r.Resources {
+			if operation && (resource == "pods" || resource == "*") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reachabilityProber creates a probe pod with a dry-run request until the API server calls every webhook
+// admitting the pod creations, reporting the failures through the readiness and events
+type reachabilityProber struct {
+	client    client.Client
+	namespace string
+	labels    map[string]string
+	webhooks  []MutatingWebhook
+	recorder  record.EventRecorder
+	// configuration is the MutatingWebhookConfiguration the events are about
+	configuration *admissionregistrationv1beta1.MutatingWebhookConfiguration
+	logger        *zap.SugaredLogger
+
+	mu  sync.RWMutex
+	err error
+}
+
+func (m *DefaultExtensionManager) newReachabilityProber(webhooks []MutatingWebhook) *reachabilityProber {
+	p := &reachabilityProber{
+		client:    m.KubeManager.GetClient(),
+		namespace: m.Options.Namespace,
+		labels:    map[string]string{},
+		recorder:  m.KubeManager.GetEventRecorderFor(m.Options.OperatorFingerprint),
+		configuration: &admissionregistrationv1beta1.MutatingWebhookConfiguration{
+			TypeMeta:   metav1.TypeMeta{APIVersion: admissionregistrationv1beta1.SchemeGroupVersion.String(), Kind: "MutatingWebhookConfiguration"},
+			ObjectMeta: metav1.ObjectMeta{Name: m.Options.resourceName(NamedWebhookConfiguration, "")},
+		},
+		logger: m.Logger,
+	}
+	if m.WebhookConfig != nil && m.WebhookConfig.APIVersion == AdmissionRegistrationV1 {
+		// The events are about the v1 configuration
+		p.configuration.APIVersion = admissionregistrationv1.SchemeGroupVersion.String()
+	}
+	if !m.Options.WatchesNamespace(p.namespace) {
+		// Only Namespaces are watched
+		p.namespace = m.Options.WatchedNamespaces()[0]
+	}
+	if p.namespace == "" {
+		// The webhooks admit the pods of every namespace
+		p.namespace = m.Options.WebhookNamespace
+	}
+	for _, w := range webhooks {
+		// The validating webhooks can't annotate the probe pod
+		if !admitsPodCreations(w.GetRules()) || isValidatingWebhook(w) {
+			continue
+		}
+		p.webhooks = append(p.webhooks, w)
+		// The probe pod looks like an app to the webhooks filtering them
+		if selector := w.GetLabelSelector(); selector != nil {
+			for k, v := range selector.MatchLabels {
+				p.labels[k] = v
+			}
+		}
+	}
+	return p
+}
+
+// probe returns an error if the API server didn't call one of the webhooks
+func (p *reachabilityProber) probe(ctx context.Context) error {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      reachabilityProbeName,
+			Namespace: p.namespace,
+			Labels:    p.labels,
+			// The webhooks add their annotation to the existing ones
+			Annotations: map[string]string{AnnotationReachablePrefix + "probe": "true"},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "probe", Image: reachabilityProbeImage}}},
+	}
+	// With the Fail policy, the API server errors if it can't reach a webhook
+	if err := p.client.Create(ctx, pod, client.DryRunAll); err != nil {
+		return errors.Wrap(err, "creating the dry-run probe pod")
+	}
+
+	// With the Ignore policy, the webhooks it couldn't reach didn't annotate the pod
+	var unreached []string
+	for _, w := range p.webhooks {
+		if pod.Annotations[AnnotationReachablePrefix+strings.TrimPrefix(w.GetPath(), "/")] != "true" {
+			unreached = append(unreached, w.GetName())
+		}
+	}
+	if len(unreached) > 0 {
+		return errors.Errorf("The API server didn't call the webhooks %s, check the webhook service and the network policies", strings.Join(unreached, ", "))
+	}
+	return nil
+}
+
+// check is the ready check, failing once the grace period is over and until the webhooks are reached
+func (p *reachabilityProber) check(context.Context) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.err
+}
+
+// NeedLeaderElection makes every replica verify the webhooks, as the API server may reach any of them
+func (p *reachabilityProber) NeedLeaderElection() bool {
+	return false
+}
+
+// Start probes the webhooks until they are reached or the stop channel is closed
+func (p *reachabilityProber) Start(stop <-chan struct{}) error {
+	if len(p.webhooks) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	deadline := time.Now().Add(reachabilityGracePeriod)
+	ticker := time.NewTicker(reachabilityInterval)
+	defer ticker.Stop()
+	for {
+		err := p.probe(ctx)
+		if err == nil {
+			p.reached()
+			return nil
+		}
+		p.logger.Warnf("Verifying the reachability of the webhooks: %s", err)
+		if time.Now().After(deadline) {
+			p.unreached(err)
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *reachabilityProber) reached() {
+	p.mu.Lock()
+	failed := p.err != nil
+	p.err = nil
+	p.mu.Unlock()
+
+	p.logger.Info("The API server reaches the webhooks")
+	if failed {
+		p.recorder.Event(p.configuration, corev1.EventTypeNormal, ReasonWebhookReachable, "The API server reaches the webhooks")
+	}
+}
+
+// unreached reports the failure, with an event each time it changes
+func (p *reachabilityProber) unreached(err error) {
+	p.mu.Lock()
+	changed := p.err == nil || p.err.Error() != err.Error()
+	p.err = err
+	p.mu.Unlock()
+
+	if changed {
+		p.recorder.Event(p.configuration, corev1.EventTypeWarning, ReasonWebhookUnreachable, err.Error())
+	}
+}
@@ -0,0 +1,100 @@
+package extension_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Webhook reachability", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+		client        *cfakes.FakeClient
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		registerWebhooks := false
+		eiriniManager.Options.RegisterWebHook = &registerWebhooks
+		eiriniManager.Options.VerifyReachability = true
+		eiriniManager.WebhookServer = &webhook.Server{}
+
+		client = &cfakes.FakeClient{}
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+		kubeManager.GetEventRecorderForReturns(record.NewFakeRecorder(10))
+		eiriniManager.KubeManager = kubeManager
+		Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+	})
+
+	prober := func() manager.Runnable {
+		for i := 0; i < kubeManager.AddCallCount(); i++ {
+			if r := kubeManager.AddArgsForCall(i); fmt.Sprintf("%T", r) == "*extension.reachabilityProber" {
+				return r
+			}
+		}
+		return nil
+	}
+
+	It("answers the dry-run creation of the probe pod", func() {
+		ext := &catalog.EditEnvExtension{}
+		failurePolicy := admissionregistrationv1beta1.Ignore
+		w := NewWebhook(ext, eiriniManager)
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+			ID:             "0",
+			ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy},
+		})).To(Succeed())
+		dryRun := true
+		req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Name:      "eirinix-reachability-probe",
+			Operation: admissionv1beta1.Create,
+			DryRun:    &dryRun,
+		}}
+
+		res := w.Handle(context.Background(), req)
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Patches).To(HaveLen(1))
+		Expect(res.Patches[0].Path).To(Equal("/metadata/annotations/reachable.eirinix.cloudfoundry.org~10"))
+	})
+
+	It("verifies the API server calls the webhooks", func() {
+		client.CreateCalls(func(_ context.Context, obj runtime.Object, opts ...crc.CreateOption) error {
+			Expect(opts).To(ContainElement(crc.DryRunAll))
+			pod := obj.(*corev1.Pod)
+			Expect(pod.Namespace).To(Equal("namespace"))
+			Expect(pod.Labels).ToNot(BeEmpty())
+			pod.Annotations["reachable.eirinix.cloudfoundry.org/0"] = "true"
+			return nil
+		})
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		p := prober()
+		Expect(p).ToNot(BeNil())
+		stop := make(chan struct{})
+		defer close(stop)
+		Expect(p.Start(stop)).To(Succeed())
+		Expect(client.CreateCallCount()).To(Equal(1))
+
+		rec := httptest.NewRecorder()
+		eiriniManager.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+})
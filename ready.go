@@ -0,0 +1,152 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	readyPath = "/readyz"
+
+	readyPollInterval = 200 * time.Millisecond
+)
+
+// ReadyCheck returns an error while the component it checks can't serve, e.g. an external service an
+// extension depends on is unreachable
+type ReadyCheck func(ctx context.Context) error
+
+type readyCheck struct {
+	name  string
+	check ReadyCheck
+}
+
+// readyChecks are the checks registered by the extensions
+type readyChecks struct {
+	mu     sync.RWMutex
+	checks []readyCheck
+}
+
+func (c *readyChecks) add(name string, check ReadyCheck) error {
+	if name == "" {
+		return errors.New("Ready check name is empty")
+	}
+	if check == nil {
+		return errors.Errorf("Ready check %s is nil", name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rc := range c.checks {
+		if rc.name == name {
+			return errors.Errorf("Ready check %s is already registered", name)
+		}
+	}
+	c.checks = append(c.checks, readyCheck{name: name, check: check})
+	return nil
+}
+
+func (c *readyChecks) list() []readyCheck {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	checks := make([]readyCheck, len(c.checks))
+	copy(checks, c.checks)
+	return checks
+}
+
+// registration is closed once the extensions are registered, or their registration failed
+type registration struct {
+	init   sync.Once
+	finish sync.Once
+	ch     chan struct{}
+	err    error
+}
+
+func (r *registration) channel() chan struct{} {
+	r.init.Do(func() { r.ch = make(chan struct{}) })
+	return r.ch
+}
+
+func (r *registration) done(err error) {
+	ch := r.channel()
+	r.finish.Do(func() {
+		r.err = err
+		close(ch)
+	})
+}
+
+// AddReadyCheck registers a check aggregated into the readiness endpoint of the status server: the Manager
+// reports not ready while the check fails. Checks must be quick, as they run on every probe.
+func (m *DefaultExtensionManager) AddReadyCheck(name string, check ReadyCheck) error {
+	return m.readyChecks.add(name, check)
+}
+
+// ready returns nil once the cache is warm, with the handover enabled the admission server was verified,
+// and the ready checks of the extensions pass. The error lists every failing check.
+func (m *DefaultExtensionManager) ready(ctx context.Context) error {
+	if m.cacheWarmer != nil && !m.cacheWarmer.isWarm() {
+		return errCacheNotWarm
+	}
+	if m.handover != nil && !m.handover.isReady() {
+		return errAdmissionNotVerified
+	}
+
+	var failures []string
+	for _, rc := range m.readyChecks.list() {
+		if err := rc.check(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", rc.name, err.Error()))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("Ready checks failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (m *DefaultExtensionManager) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := m.ready(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// WaitForReady blocks until the extensions are registered (with the webhook certificate and configuration
+// installed), the cache is synced and the Manager is ready, see AddReadyCheck. It returns the registration
+// error if Start failed, or an error once the context is done. In watcher mode (see ManagerOptions.WatcherMode)
+// it only waits for the Watchers to be registered.
+func (m *DefaultExtensionManager) WaitForReady(ctx context.Context) error {
+	ch := m.registration.channel()
+	select {
+	case <-ch:
+		if m.registration.err != nil {
+			return errors.Wrap(m.registration.err, "registering the extensions")
+		}
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "waiting for the extensions registration")
+	}
+	if m.Options.WatcherMode {
+		return nil
+	}
+
+	if !m.KubeManager.GetCache().WaitForCacheSync(ctx.Done()) {
+		return errors.New("The cache was not synced before the context was done")
+	}
+
+	err := wait.PollImmediateUntil(readyPollInterval, func() (bool, error) {
+		return m.ready(ctx) == nil, nil
+	}, ctx.Done())
+	if err != nil {
+		if lastErr := m.ready(ctx); lastErr != nil {
+			return errors.Wrap(lastErr, "waiting for the manager to be ready")
+		}
+		return errors.Wrap(err, "waiting for the manager to be ready")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package extension_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var _ = Describe("Ready checks", func() {
+	var eiriniManager *DefaultExtensionManager
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+	})
+
+	readyz := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		eiriniManager.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec
+	}
+
+	It("reports ready while the checks pass", func() {
+		Expect(eiriniManager.AddReadyCheck("ok", func(context.Context) error { return nil })).To(Succeed())
+		Expect(readyz().Code).To(Equal(http.StatusOK))
+	})
+
+	It("reports not ready with the failing checks", func() {
+		serviceUp := false
+		Expect(eiriniManager.AddReadyCheck("ok", func(context.Context) error { return nil })).To(Succeed())
+		Expect(eiriniManager.AddReadyCheck("service", func(context.Context) error {
+			if !serviceUp {
+				return errors.New("connection refused")
+			}
+			return nil
+		})).To(Succeed())
+
+		rec := readyz()
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rec.Body.String()).To(ContainSubstring("service: connection refused"))
+		Expect(rec.Body.String()).ToNot(ContainSubstring("ok:"))
+
+		serviceUp = true
+		Expect(readyz().Code).To(Equal(http.StatusOK))
+	})
+
+	It("rejects invalid checks", func() {
+		check := func(context.Context) error { return nil }
+		Expect(eiriniManager.AddReadyCheck("", check)).ToNot(Succeed())
+		Expect(eiriniManager.AddReadyCheck("nil", nil)).ToNot(Succeed())
+		Expect(eiriniManager.AddReadyCheck("twice", check)).To(Succeed())
+		Expect(eiriniManager.AddReadyCheck("twice", check)).To(MatchError(ContainSubstring("already registered")))
+	})
+
+	Context("waiting for the Manager to be ready", func() {
+		var synced bool
+
+		BeforeEach(func() {
+			synced = true
+			kubeManager := &cfakes.FakeManager{}
+			informers := &cfakes.FakeCache{}
+			informers.WaitForCacheSyncCalls(func(<-chan struct{}) bool { return synced })
+			kubeManager.GetCacheReturns(informers)
+			eiriniManager.KubeManager = kubeManager
+			eiriniManager.WebhookServer = &webhook.Server{}
+			disabled := false
+			eiriniManager.Options.RegisterWebHook = &disabled
+		})
+
+		It("returns once the extensions are registered and the checks pass", func() {
+			var serviceUp int32
+			Expect(eiriniManager.AddReadyCheck("service", func(context.Context) error {
+				if atomic.LoadInt32(&serviceUp) == 0 {
+					return errors.New("connection refused")
+				}
+				return nil
+			})).To(Succeed())
+
+			done := make(chan error, 1)
+			go func() { done <- eiriniManager.WaitForReady(context.Background()) }()
+			Consistently(done, "300ms").ShouldNot(Receive())
+
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+			Consistently(done, "300ms").ShouldNot(Receive())
+
+			atomic.StoreInt32(&serviceUp, 1)
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		It("fails when the context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			Expect(eiriniManager.WaitForReady(ctx)).To(MatchError(ContainSubstring("waiting for the extensions registration")))
+
+			synced = false
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+			Expect(eiriniManager.WaitForReady(context.Background())).To(MatchError(ContainSubstring("cache was not synced")))
+		})
+	})
+})
@@ -0,0 +1,252 @@
+package extension
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// LabelRecording is set on the ConfigMaps storing recorded traffic, to the prefix of the storage
+	LabelRecording = "eirinix.cloudfoundry.org/recording"
+
+	// DefaultRecordingSegmentSize is the default size of the recorded data after which a segment is rotated
+	DefaultRecordingSegmentSize = 512 * 1024
+
+	// recordingConfigMapKey is the key of the segment in the ConfigMaps
+	recordingConfigMapKey = "segment"
+	// maxConfigMapSegmentSize keeps the segments under the 1MiB limit of the ConfigMaps, with room for the metadata
+	maxConfigMapSegmentSize = 1000 * 1000
+	// recordingListPageSize is the number of ConfigMaps listed per request
+	recordingListPageSize = 100
+)
+
+// RecordingStorage stores the segments of the recorded traffic, e.g. the JSON lines of NewJSONLinesRecorder.
+// It is implemented by the Storage backends, and can be implemented to store them elsewhere.
+type RecordingStorage interface {
+	// Put stores a segment
+	Put(ctx context.Context, name string, data []byte) error
+	// List returns the names of the stored segments
+	List(ctx context.Context) ([]string, error)
+	// Delete removes a segment
+	Delete(ctx context.Context, name string) error
+}
+
+// RecordingOptions are the compression, rotation and retention of the recorded traffic
+type RecordingOptions struct {
+	// Compress gzips the segments
+	Compress bool
+
+	// MaxSegmentSize is the size of the recorded data after which a segment is stored and a new one started.
+	// Optional, defaults to DefaultRecordingSegmentSize
+	MaxSegmentSize int
+
+	// MaxSegments is the number of segments kept, the oldest ones are deleted. Optional, 0 keeps them all
+	MaxSegments int
+
+	// MaxAge is the age after which the segments are deleted. Optional, 0 keeps them all
+	MaxAge time.Duration
+}
+
+// RecordingWriter is an io.WriteCloser storing what is written in segments, rotated by size and deleted by
+// the retention policy, so that long-running operators don't fill their storage with recorded traffic.
+// A segment is stored once it reaches the maximum size, on Flush and on Close.
+type RecordingWriter struct {
+	storage RecordingStorage
+	options RecordingOptions
+
+	mu      sync.Mutex
+	segment bytes.Buffer
+	last    int64
+	now     func() time.Time
+}
+
+// NewRecordingWriter returns a RecordingWriter storing the segments in the storage
+func NewRecordingWriter(storage RecordingStorage, opts RecordingOptions) *RecordingWriter {
+	if opts.MaxSegmentSize <= 0 {
+		opts.MaxSegmentSize = DefaultRecordingSegmentSize
+	}
+	return &RecordingWriter{storage: storage, options: opts, now: time.Now}
+}
+
+// Write appends the data to the current segment, and stores the segment once it is full
+func (w *RecordingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.segment.Write(p)
+	if w.segment.Len() < w.options.MaxSegmentSize {
+		return len(p), nil
+	}
+	// the data is kept in the segment if it can't be stored, so it's written anyway
+	if err := w.rotate(context.Background()); err != nil {
+		return len(p), err
+	}
+	return len(p), nil
+}
+
+// Flush stores the current segment, if not empty
+func (w *RecordingWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate(context.Background())
+}
+
+// Close stores the current segment
+func (w *RecordingWriter) Close() error {
+	return w.Flush()
+}
+
+// rotate stores the current segment and applies the retention policy
+func (w *RecordingWriter) rotate(ctx context.Context) error {
+	if w.segment.Len() == 0 {
+		return nil
+	}
+
+	// the segments are named after the time they are stored, kept increasing so that they don't collide
+	now := w.now()
+	if now.UnixNano() <= w.last {
+		now = time.Unix(0, w.last+1)
+	}
+	name := fmt.Sprintf("%020d.jsonl", now.UnixNano())
+	data := w.segment.Bytes()
+	if w.options.Compress {
+		name += ".gz"
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		if _, err := zw.Write(data); err != nil {
+			return errors.Wrap(err, "compressing the recording segment")
+		}
+		if err := zw.Close(); err != nil {
+			return errors.Wrap(err, "compressing the recording segment")
+		}
+		data = compressed.Bytes()
+	}
+
+	if err := w.storage.Put(ctx, name, data); err != nil {
+		return errors.Wrapf(err, "storing the recording segment %s", name)
+	}
+	w.segment.Reset()
+	w.last = now.UnixNano()
+
+	return w.prune(ctx, now)
+}
+
+// prune deletes the segments beyond the retention policy
+func (w *RecordingWriter) prune(ctx context.Context, now time.Time) error {
+	if w.options.MaxSegments <= 0 && w.options.MaxAge <= 0 {
+		return nil
+	}
+
+	names, err := w.storage.List(ctx)
+	if err != nil {
+		return errors.Wrap(err, "listing the recording segments")
+	}
+	var segments []string
+	for _, name := range names {
+		if _, ok := segmentTime(name); ok {
+			segments = append(segments, name)
+		}
+	}
+	// the names are zero padded timestamps, so the oldest sort first
+	sort.Strings(segments)
+
+	for i, name := range segments {
+		t, _ := segmentTime(name)
+		expired := w.options.MaxAge > 0 && now.Sub(t) > w.options.MaxAge
+		extra := w.options.MaxSegments > 0 && len(segments)-i > w.options.MaxSegments
+		if !expired && !extra {
+			continue
+		}
+		if err := w.storage.Delete(ctx, name); err != nil {
+			return errors.Wrapf(err, "deleting the recording segment %s", name)
+		}
+	}
+	return nil
+}
+
+// segmentTime returns the time a segment was stored, from its name
+func segmentTime(name string) (time.Time, bool) {
+	i := strings.Index(name, ".")
+	if i < 0 {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(name[:i], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// NewFileRecordingStorage returns a RecordingStorage writing the segments as files of a directory, see NewFileStorage
+func NewFileRecordingStorage(fs afero.Fs, dir string) RecordingStorage {
+	return NewFileStorage(fs, dir)
+}
+
+// NewConfigMapRecordingStorage returns a RecordingStorage writing each segment in a ConfigMap named
+// <prefix>-<segment>. The segments must fit in a ConfigMap, so they should be compressed or smaller than 1MB.
+func NewConfigMapRecordingStorage(c client.Client, namespace, prefix string) RecordingStorage {
+	return &configMapRecordingStorage{client: c, namespace: namespace, prefix: prefix}
+}
+
+type configMapRecordingStorage struct {
+	client            client.Client
+	namespace, prefix string
+}
+
+func (s *configMapRecordingStorage) Put(ctx context.Context, name string, data []byte) error {
+	if len(data) > maxConfigMapSegmentSize {
+		return errors.Errorf("The segment is %d bytes, larger than the %d bytes a ConfigMap can store", len(data), maxConfigMapSegmentSize)
+	}
+	return s.client.Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.prefix + "-" + name,
+			Namespace: s.namespace,
+			Labels:    map[string]string{LabelRecording: s.prefix},
+		},
+		BinaryData: map[string][]byte{recordingConfigMapKey: data},
+	})
+}
+
+// List pages through the ConfigMaps of the storage, which can be many with a long retention
+func (s *configMapRecordingStorage) List(ctx context.Context) ([]string, error) {
+	var names []string
+	opts := []client.ListOption{
+		client.InNamespace(s.namespace),
+		client.MatchingLabels{LabelRecording: s.prefix},
+		client.Limit(recordingListPageSize),
+	}
+	for cont := ""; ; {
+		configMaps := &corev1.ConfigMapList{}
+		if err := s.client.List(ctx, configMaps, append(opts, client.Continue(cont))...); err != nil {
+			return nil, err
+		}
+		for _, cm := range configMaps.Items {
+			names = append(names, strings.TrimPrefix(cm.Name, s.prefix+"-"))
+		}
+		if cont = configMaps.Continue; cont == "" {
+			return names, nil
+		}
+	}
+}
+
+func (s *configMapRecordingStorage) Delete(ctx context.Context, name string) error {
+	err := s.client.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: s.prefix + "-" + name, Namespace: s.namespace}})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
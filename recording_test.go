@@ -0,0 +1,114 @@
+package extension_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"strings"
+
+	. "code.cloudfoundry.org/eirinix"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Recording", func() {
+	var (
+		fs      afero.Fs
+		storage RecordingStorage
+		ctx     = context.Background()
+	)
+
+	BeforeEach(func() {
+		fs = afero.NewMemMapFs()
+		storage = NewFileRecordingStorage(fs, "/recordings")
+	})
+
+	It("rotates the segments by size", func() {
+		w := NewRecordingWriter(storage, RecordingOptions{MaxSegmentSize: 10})
+		_, err := w.Write([]byte("0123456789\n"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w.Write([]byte("abc\n"))
+		Expect(err).ToNot(HaveOccurred())
+
+		names, err := storage.List(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(HaveLen(1))
+		Expect(names[0]).To(HaveSuffix(".jsonl"))
+
+		Expect(w.Close()).To(Succeed())
+		names, err = storage.List(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(HaveLen(2))
+	})
+
+	It("compresses the segments", func() {
+		w := NewRecordingWriter(storage, RecordingOptions{Compress: true})
+		line := strings.Repeat(`{"extension":"volume","currentAllowed":true}`, 100) + "\n"
+		_, err := w.Write([]byte(line))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Flush()).To(Succeed())
+
+		names, err := storage.List(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(HaveLen(1))
+		Expect(names[0]).To(HaveSuffix(".jsonl.gz"))
+
+		data, err := afero.ReadFile(fs, "/recordings/"+names[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(data)).To(BeNumerically("<", len(line)))
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(zr)).To(Equal([]byte(line)))
+	})
+
+	It("keeps the most recent segments", func() {
+		w := NewRecordingWriter(storage, RecordingOptions{MaxSegments: 2})
+		for i := 0; i < 5; i++ {
+			_, err := w.Write([]byte("line\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Flush()).To(Succeed())
+		}
+		Expect(afero.WriteFile(fs, "/recordings/notes.txt", []byte("kept"), 0600)).To(Succeed())
+
+		names, err := storage.List(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(HaveLen(3))
+		Expect(names).To(ContainElement("notes.txt"))
+	})
+
+	It("pages through the ConfigMaps of the storage", func() {
+		client := &cfakes.FakeClient{}
+		client.ListCalls(func(_ context.Context, list runtime.Object, opts ...crc.ListOption) error {
+			listOpts := &crc.ListOptions{}
+			listOpts.ApplyOptions(opts)
+			Expect(listOpts.Namespace).To(Equal("eirini"))
+			Expect(listOpts.Limit).To(BeNumerically(">", 0))
+
+			configMaps := list.(*corev1.ConfigMapList)
+			if listOpts.Continue == "" {
+				configMaps.Items = []corev1.ConfigMap{{ObjectMeta: metav1.ObjectMeta{Name: "traffic-1.jsonl"}}}
+				configMaps.Continue = "page-2"
+				return nil
+			}
+			configMaps.Items = []corev1.ConfigMap{{ObjectMeta: metav1.ObjectMeta{Name: "traffic-2.jsonl"}}}
+			return nil
+		})
+
+		names, err := NewConfigMapRecordingStorage(client, "eirini", "traffic").List(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(Equal([]string{"1.jsonl", "2.jsonl"}))
+		Expect(client.ListCallCount()).To(Equal(2))
+	})
+
+	It("refuses segments larger than a ConfigMap", func() {
+		storage := NewConfigMapRecordingStorage(&cfakes.FakeClient{}, "eirini", "traffic")
+		Expect(storage.Put(ctx, "1.jsonl", make([]byte, 2*1024*1024))).ToNot(Succeed())
+	})
+})
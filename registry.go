@@ -0,0 +1,138 @@
+package extension
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// semverPattern matches the semantic versions, with an optional v prefix as in the Go module versions
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+// ExtensionMetadata describes an extension, see DescribedExtension
+type ExtensionMetadata struct {
+	// Name identifies the extension like the name of a NamedExtension
+	Name string `json:"name"`
+	// Version is the semantic version of the extension, e.g. 1.2.0
+	Version string `json:"version"`
+	// Description tells what the extension does. Optional
+	Description string `json:"description,omitempty"`
+	// Requires are the capabilities the extension depends on, like the ones of a DependentExtension. Optional
+	Requires []string `json:"requires,omitempty"`
+
+	// Kind (extension, watcher or reconciler) and Type (the Go type) are set by Manager.Describe
+	Kind string `json:"kind,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+func (d ExtensionMetadata) validate() error {
+	if err := validateExtensionName(d.Name); err != nil {
+		return err
+	}
+	if !semverPattern.MatchString(d.Version) {
+		return errors.Errorf("The version '%s' of the extension %s is not a semantic version", d.Version, d.Name)
+	}
+	return nil
+}
+
+// DescribedExtension is implemented by the Extensions, Watchers and Reconcilers describing themselves. Their
+// name is used like the one of a NamedExtension, which takes precedence, and their version labels the
+// eirinix_extension_enabled metric.
+type DescribedExtension interface {
+	Metadata() ExtensionMetadata
+}
+
+// ExtensionFactory returns a new instance of a registered extension, see Register
+type ExtensionFactory func() interface{}
+
+var registry = struct {
+	sync.Mutex
+	factories map[string]ExtensionFactory
+	metadata  map[string]ExtensionMetadata
+}{factories: map[string]ExtensionFactory{}, metadata: map[string]ExtensionMetadata{}}
+
+// Register records an extension in the registry of the binary, usually from the init function of its package,
+// so that the operator adds it by name with AddRegisteredExtensions and lists it without instantiating it. The
+// instances returned by the factory must be DescribedExtensions. Register panics if the extension is invalid or
+// if its name is already registered, like database/sql.Register.
+func Register(factory ExtensionFactory) {
+	d, ok := factory().(DescribedExtension)
+	if !ok {
+		panic("eirinix: Register of an extension not implementing DescribedExtension")
+	}
+	meta := d.Metadata()
+	if err := meta.validate(); err != nil {
+		panic(fmt.Sprintf("eirinix: Register of an invalid extension: %s", err))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, dup := registry.factories[meta.Name]; dup {
+		panic(fmt.Sprintf("eirinix: Register called twice for the extension %s", meta.Name))
+	}
+	registry.factories[meta.Name] = factory
+	registry.metadata[meta.Name] = meta
+}
+
+// Registered returns the metadata of the registered extensions, sorted by name
+func Registered() []ExtensionMetadata {
+	registry.Lock()
+	defer registry.Unlock()
+	registered := make([]ExtensionMetadata, 0, len(registry.metadata))
+	for _, meta := range registry.metadata {
+		registered = append(registered, meta)
+	}
+	sort.Slice(registered, func(i, j int) bool { return registered[i].Name < registered[j].Name })
+	return registered
+}
+
+// AddRegisteredExtensions adds new instances of the registered extensions with the names to the Manager, or of
+// all the registered extensions without names, in the order of their names
+func (m *DefaultExtensionManager) AddRegisteredExtensions(names ...string) error {
+	if len(names) == 0 {
+		for _, meta := range Registered() {
+			names = append(names, meta.Name)
+		}
+	}
+	for _, name := range names {
+		registry.Lock()
+		factory, ok := registry.factories[name]
+		registry.Unlock()
+		if !ok {
+			return errors.Errorf("No extension named '%s' is registered", name)
+		}
+		if err := m.AddExtension(factory()); err != nil {
+			return errors.Wrapf(err, "adding the registered extension %s", name)
+		}
+	}
+	return nil
+}
+
+// Describe returns the metadata of the Extensions, Watchers and Reconcilers added to the Manager. The ones
+// which are not DescribedExtensions are described by their name and requirements only.
+func (m *DefaultExtensionManager) Describe() []ExtensionMetadata {
+	descriptions := []ExtensionMetadata{}
+	for _, ref := range m.extensionRefs() {
+		var meta ExtensionMetadata
+		if d, ok := ref.extension.(DescribedExtension); ok {
+			meta = d.Metadata()
+		}
+		meta.Name = ref.name
+		meta.Requires = requirements(ref.extension)
+		meta.Kind = ref.kind
+		meta.Type = fmt.Sprintf("%T", ref.extension)
+		descriptions = append(descriptions, meta)
+	}
+	return descriptions
+}
+
+// extensionVersion returns the version of a DescribedExtension, for the metrics
+func extensionVersion(e interface{}) string {
+	if d, ok := e.(DescribedExtension); ok {
+		return d.Metadata().Version
+	}
+	return unknownVersion
+}
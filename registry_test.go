@@ -0,0 +1,76 @@
+package extension_test
+
+import (
+	"encoding/json"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type describedExtension struct {
+	catalog.EditEnvExtension
+	metadata ExtensionMetadata
+}
+
+func (e *describedExtension) Metadata() ExtensionMetadata { return e.metadata }
+
+func describedFactory(meta ExtensionMetadata) ExtensionFactory {
+	return func() interface{} { return &describedExtension{metadata: meta} }
+}
+
+var _ = Describe("Extension registry", func() {
+	var m Manager
+
+	BeforeEach(func() {
+		var err error
+		m, err = NewManager(ManagerOptions{Namespace: "eirini", KubeConfig: "/nonexistent/kubeconfig"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("adds the registered extensions by name", func() {
+		Register(describedFactory(ExtensionMetadata{Name: "registry-env", Version: "1.2.0", Description: "Sets the env"}))
+		Register(describedFactory(ExtensionMetadata{Name: "registry-volumes", Version: "v0.1.0-rc.1"}))
+
+		Expect(Registered()).To(ContainElement(ExtensionMetadata{Name: "registry-env", Version: "1.2.0", Description: "Sets the env"}))
+		Expect(m.AddRegisteredExtensions("registry-volumes")).To(Succeed())
+		Expect(m.AddRegisteredExtensions("registry-unknown")).To(MatchError("No extension named 'registry-unknown' is registered"))
+
+		Expect(m.Describe()).To(Equal([]ExtensionMetadata{
+			{Name: "registry-volumes", Version: "v0.1.0-rc.1", Kind: "extension", Type: "*extension_test.describedExtension"},
+		}))
+	})
+
+	It("refuses the invalid and duplicated extensions", func() {
+		Expect(func() { Register(func() interface{} { return &catalog.EditEnvExtension{} }) }).To(Panic())
+		Expect(func() { Register(describedFactory(ExtensionMetadata{Name: "registry-invalid", Version: "1.2"})) }).To(Panic())
+		Expect(func() { Register(describedFactory(ExtensionMetadata{Name: "Registry", Version: "1.2.0"})) }).To(Panic())
+
+		Register(describedFactory(ExtensionMetadata{Name: "registry-twice", Version: "1.0.0"}))
+		Expect(func() { Register(describedFactory(ExtensionMetadata{Name: "registry-twice", Version: "2.0.0"})) }).To(Panic())
+	})
+
+	It("describes the extensions in the status", func() {
+		Expect(m.AddExtension(&describedExtension{metadata: ExtensionMetadata{Name: "env", Version: "1.0.0", Requires: []string{"secrets"}}})).To(Succeed())
+		Expect(m.AddExtension(&dependentExtension{name: "secrets", requires: []string{CapabilityCacheWarmup}})).To(Succeed())
+
+		status := m.Status()
+		Expect(status.Extensions).To(Equal([]string{"env", "*extension_test.dependentExtension"}))
+
+		b, err := json.Marshal(status.Metadata)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b).To(MatchJSON(`[
+			{"name": "env", "version": "1.0.0", "requires": ["secrets"], "kind": "extension", "type": "*extension_test.describedExtension"},
+			{"name": "*extension_test.dependentExtension", "version": "", "requires": ["cache-warmup"], "kind": "extension", "type": "*extension_test.dependentExtension"}
+		]`))
+	})
+
+	It("checks the requirements of the metadata", func() {
+		Expect(m.AddExtension(&describedExtension{metadata: ExtensionMetadata{Name: "env", Version: "1.0.0", Requires: []string{"sidecar-injector"}}})).To(Succeed())
+
+		err := m.Start()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`env requires "sidecar-injector"`))
+	})
+})
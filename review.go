@@ -0,0 +1,177 @@
+package extension
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// maxPooledBufferSize is the capacity above which buffers are not returned to the pool,
+// so that a few huge pods don't pin memory
+const maxPooledBufferSize = 1 << 20
+
+var (
+	errBadContentType = errors.New("Content-Type must be application/json")
+	errEmptyBody      = errors.New("Request body is empty")
+	errEmptyRequest   = errors.New("AdmissionReview has no request")
+	errUIDMismatch    = errors.New("The response UID doesn't match the request UID")
+)
+
+// admissionReviewKind is the kind of the reviews, in the supported admission API versions
+const admissionReviewKind = "AdmissionReview"
+
+// validateReview checks the fields every API server sets, so that the requests of nonconforming clients and
+// proxies are rejected before reaching the extensions
+func validateReview(review *admissionv1beta1.AdmissionReview) error {
+	if review.Kind != admissionReviewKind {
+		return errors.Errorf("Unsupported kind %q, must be %s", review.Kind, admissionReviewKind)
+	}
+	switch review.APIVersion {
+	case "admission.k8s.io/v1", "admission.k8s.io/v1beta1":
+	default:
+		return errors.Errorf("Unsupported apiVersion %q, must be admission.k8s.io/v1 or admission.k8s.io/v1beta1", review.APIVersion)
+	}
+
+	req := review.Request
+	if req == nil {
+		return errEmptyRequest
+	}
+	var missing []string
+	if req.UID == "" {
+		missing = append(missing, "uid")
+	}
+	if req.Kind.Kind == "" || req.Kind.Version == "" {
+		missing = append(missing, "kind")
+	}
+	switch req.Operation {
+	case admissionv1beta1.Create, admissionv1beta1.Update:
+		if len(req.Object.Raw) == 0 {
+			missing = append(missing, "object")
+		}
+	case admissionv1beta1.Delete, admissionv1beta1.Connect:
+	case "":
+		missing = append(missing, "operation")
+	default:
+		return errors.Errorf("Unsupported operation %q", req.Operation)
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("AdmissionReview request is missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+var (
+	reviewBufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	podPool          = sync.Pool{New: func() interface{} { return &corev1.Pod{} }}
+)
+
+func getBuffer() *bytes.Buffer {
+	buf := reviewBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		reviewBufferPool.Put(buf)
+	}
+}
+
+func getPod() *corev1.Pod {
+	return podPool.Get().(*corev1.Pod)
+}
+
+func putPod(pod *corev1.Pod) {
+	*pod = corev1.Pod{}
+	podPool.Put(pod)
+}
+
+// AdmissionReviewHandler returns an http.Handler serving the admission webhook. It replaces the
+// controller-runtime webhook ServeHTTP in the Manager webhook server, reading and writing the
+// AdmissionReviews with pooled buffers to reduce the GC pressure when many pods are admitted at once.
+func AdmissionReviewHandler(wh *webhook.Admission) http.Handler {
+	return &reviewHandler{webhook: wh}
+}
+
+type reviewHandler struct {
+	webhook *webhook.Admission
+}
+
+func (h *reviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		h.write(w, nil, admission.Errored(http.StatusBadRequest, errBadContentType))
+		return
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if r.Body == nil {
+		h.write(w, nil, admission.Errored(http.StatusBadRequest, errEmptyBody))
+		return
+	}
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		h.write(w, nil, admission.Errored(http.StatusBadRequest, err))
+		return
+	}
+	if buf.Len() == 0 {
+		h.write(w, nil, admission.Errored(http.StatusBadRequest, errEmptyBody))
+		return
+	}
+
+	// The raw object is copied out of the buffer by RawExtension.UnmarshalJSON, so the
+	// buffer can be reused once decoded
+	review := admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(buf.Bytes(), &review); err != nil {
+		h.write(w, nil, admission.Errored(http.StatusBadRequest, err))
+		return
+	}
+	if err := validateReview(&review); err != nil {
+		res := admission.Errored(http.StatusBadRequest, err)
+		if review.Request != nil {
+			res.UID = review.Request.UID
+		}
+		h.write(w, &review.TypeMeta, res)
+		return
+	}
+
+	ctx := r.Context()
+	if wantsRawReview(h.webhook) {
+		ctx = withRawReview(ctx, append([]byte(nil), buf.Bytes()...))
+	}
+	res := h.webhook.Handle(ctx, admission.Request{AdmissionRequest: *review.Request})
+
+	// The API server rejects the responses which don't correlate with the request
+	if res.UID != review.Request.UID {
+		if res.UID != "" {
+			res = admission.Errored(http.StatusInternalServerError, errUIDMismatch)
+		}
+		res.UID = review.Request.UID
+	}
+	h.write(w, &review.TypeMeta, res)
+}
+
+func (h *reviewHandler) write(w http.ResponseWriter, typeMeta *metav1.TypeMeta, res admission.Response) {
+	review := admissionv1beta1.AdmissionReview{Response: &res.AdmissionResponse}
+	if typeMeta != nil {
+		review.TypeMeta = *typeMeta
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := json.NewEncoder(buf).Encode(review); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf.Bytes()) // nolint:errcheck
+}
@@ -0,0 +1,34 @@
+package extension_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "code.cloudfoundry.org/eirinix"
+)
+
+func benchmarkReview(b *testing.B, h http.Handler) {
+	body := reviewBody()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/review", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+// BenchmarkControllerRuntimeReview is the baseline, served by the controller-runtime webhook
+func BenchmarkControllerRuntimeReview(b *testing.B) {
+	benchmarkReview(b, newReviewWebhook(false))
+}
+
+func BenchmarkPooledReview(b *testing.B) {
+	benchmarkReview(b, AdmissionReviewHandler(newReviewWebhook(false)))
+}
+
+func BenchmarkPooledReviewReusePods(b *testing.B) {
+	benchmarkReview(b, AdmissionReviewHandler(newReviewWebhook(true)))
+}
@@ -0,0 +1,94 @@
+package extension_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+
+	. "code.cloudfoundry.org/eirinix"
+	fuzz "github.com/google/gofuzz"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// fuzzIterations is the number of malformed reviews served by each fuzz test
+const fuzzIterations = 500
+
+var _ = Describe("AdmissionReview fuzzing", func() {
+	var h http.Handler
+
+	BeforeEach(func() {
+		h = AdmissionReviewHandler(newReviewWebhook(false))
+	})
+
+	// expectReviewResponse checks the handler answered with a review, correlated with the request if it had a UID
+	expectReviewResponse := func(body []byte) {
+		rec := postReview(h, body, "application/json")
+		Expect(rec.Code).To(Equal(http.StatusOK), string(body))
+
+		response := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed(), string(body))
+		Expect(response.Response).ToNot(BeNil(), string(body))
+
+		request := admissionv1beta1.AdmissionReview{}
+		if json.Unmarshal(body, &request) == nil && request.Request != nil {
+			Expect(response.Response.UID).To(Equal(request.Request.UID), string(body))
+		}
+	}
+
+	It("answers the reviews with random fields", func() {
+		pod := reviewBody()
+		f := fuzz.NewWithSeed(GinkgoRandomSeed()).NilChance(0.2).Funcs(
+			func(e *runtime.RawExtension, c fuzz.Continue) {
+				switch c.Intn(3) {
+				case 0:
+					review := admissionv1beta1.AdmissionReview{}
+					Expect(json.Unmarshal(pod, &review)).To(Succeed())
+					e.Raw = review.Request.Object.Raw
+				case 1:
+					e.Raw = []byte(`{"kind":"Pod","spec":` + c.RandString() + `}`)
+				}
+			},
+			func(o *admissionv1beta1.Operation, c fuzz.Continue) {
+				operations := []admissionv1beta1.Operation{admissionv1beta1.Create, admissionv1beta1.Update, admissionv1beta1.Delete, ""}
+				*o = operations[c.Intn(len(operations))]
+			},
+		)
+
+		for i := 0; i < fuzzIterations; i++ {
+			review := admissionv1beta1.AdmissionReview{}
+			f.Fuzz(&review)
+			if i%4 != 0 {
+				review.TypeMeta = metav1.TypeMeta{APIVersion: "admission.k8s.io/v1beta1", Kind: "AdmissionReview"}
+			}
+			if review.Request != nil {
+				review.Request.OldObject = runtime.RawExtension{}
+			}
+			body, err := json.Marshal(review)
+			if err != nil {
+				// e.g. the raw objects which are not JSON
+				continue
+			}
+			expectReviewResponse(body)
+		}
+	})
+
+	It("answers the corrupted reviews", func() {
+		r := rand.New(rand.NewSource(GinkgoRandomSeed())) // nolint:gosec
+		valid := reviewBody()
+
+		for i := 0; i < fuzzIterations; i++ {
+			body := append([]byte(nil), valid...)
+			for n := r.Intn(8) + 1; n > 0; n-- {
+				body[r.Intn(len(body))] = byte(r.Intn(256))
+			}
+			if r.Intn(4) == 0 {
+				body = body[:r.Intn(len(body))]
+			}
+			expectReviewResponse(body)
+		}
+	})
+})
@@ -0,0 +1,260 @@
+package extension_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newReviewWebhook(reusePods bool) *webhook.Admission {
+	return newExtensionReviewWebhook(&catalog.EditEnvExtension{}, reusePods)
+}
+
+func newExtensionReviewWebhook(e Extension, reusePods bool) *webhook.Admission {
+	c := catalog.NewCatalog()
+	failurePolicy := admissionregistrationv1beta1.Fail
+	w := NewWebhook(e, c.SimpleManager()).(*DefaultMutatingWebhook)
+	err := w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+		ID:             "review",
+		ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy, ReusePodObjects: reusePods},
+	})
+	if err != nil {
+		panic(err)
+	}
+	decoder, err := admission.NewDecoder(scheme.Scheme)
+	if err != nil {
+		panic(err)
+	}
+	if err := w.InjectDecoder(decoder); err != nil {
+		panic(err)
+	}
+	return w.GetWebhook()
+}
+
+func reviewBody() []byte {
+	pod, _ := json.Marshal(&corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "app-0", Namespace: "eirini"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "opi", Image: "eirini/dora"}},
+		},
+	})
+	review := admissionv1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1beta1", Kind: "AdmissionReview"},
+		Request: &admissionv1beta1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Operation: admissionv1beta1.Create,
+		},
+	}
+	review.Request.Object.Raw = pod
+	body, _ := json.Marshal(review)
+	return body
+}
+
+// podRequest returns the admission request of the pod of reviewBody
+func podRequest() admission.Request {
+	review := admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(reviewBody(), &review); err != nil {
+		panic(err)
+	}
+	return admission.Request{AdmissionRequest: *review.Request}
+}
+
+// injectDecoder injects the decoder of the pods into the webhook
+func injectDecoder(w MutatingWebhook) {
+	decoder, err := admission.NewDecoder(scheme.Scheme)
+	if err != nil {
+		panic(err)
+	}
+	if err := w.InjectDecoder(decoder); err != nil {
+		panic(err)
+	}
+}
+
+type warningExtension struct{}
+
+func (e *warningExtension) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	pod.Labels = map[string]string{"warned": "true"}
+	return podwebhook.PatchPod(req, pod).WithWarning("%s has no memory limit", pod.Name).Response()
+}
+
+type rawExtension struct {
+	review []byte
+	pod    *corev1.Pod
+}
+
+func (e *rawExtension) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	return admission.Denied("the raw handler must be called")
+}
+
+func (e *rawExtension) HandleRaw(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request, review []byte) admission.Response {
+	e.review, e.pod = review, pod
+	return admission.Allowed("")
+}
+
+func postReview(h http.Handler, body []byte, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/review", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+var _ = Describe("AdmissionReviewHandler", func() {
+	for _, reuse := range []bool{false, true} {
+		reuse := reuse
+
+		It("serves the admission reviews", func() {
+			h := AdmissionReviewHandler(newReviewWebhook(reuse))
+
+			for i := 0; i < 3; i++ {
+				rec := postReview(h, reviewBody(), "application/json")
+				Expect(rec.Code).To(Equal(http.StatusOK))
+
+				review := admissionv1beta1.AdmissionReview{}
+				Expect(json.Unmarshal(rec.Body.Bytes(), &review)).To(Succeed())
+				Expect(review.Kind).To(Equal("AdmissionReview"))
+				Expect(review.Response.UID).To(BeEquivalentTo("uid"))
+				Expect(review.Response.Allowed).To(BeTrue())
+				Expect(string(review.Response.Patch)).To(ContainSubstring("STICKY_MESSAGE"))
+			}
+		})
+	}
+
+	It("serves admission v1 reviews with warnings", func() {
+		h := AdmissionReviewHandler(newExtensionReviewWebhook(&warningExtension{}, false))
+
+		body := bytes.Replace(reviewBody(), []byte("admission.k8s.io/v1beta1"), []byte("admission.k8s.io/v1"), 1)
+		rec := postReview(h, body, "application/json")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		review := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &review)).To(Succeed())
+		Expect(review.APIVersion).To(Equal("admission.k8s.io/v1"))
+		Expect(review.Response.Allowed).To(BeTrue())
+		Expect(review.Response.Warnings).To(ConsistOf("app-0 has no memory limit"))
+		Expect(review.Response.PatchType).ToNot(BeNil())
+		Expect(*review.Response.PatchType).To(Equal(admissionv1beta1.PatchTypeJSONPatch))
+	})
+
+	It("passes the raw review to the raw handlers", func() {
+		e := &rawExtension{}
+		wh := newExtensionReviewWebhook(e, false)
+
+		body := bytes.Replace(reviewBody(), []byte(`"operation"`), []byte(`"fieldManager":"kubectl","operation"`), 1)
+		rec := postReview(AdmissionReviewHandler(wh), body, "application/json")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(e.review).To(Equal(body))
+		Expect(e.pod).ToNot(BeNil())
+		Expect(e.pod.Name).To(Equal("app-0"))
+
+		review := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(reviewBody(), &review)).To(Succeed())
+		res := wh.Handle(context.Background(), admission.Request{AdmissionRequest: *review.Request})
+		Expect(res.Allowed).To(BeTrue())
+		Expect(string(e.review)).To(ContainSubstring(`"uid":"uid"`))
+		Expect(string(e.review)).To(ContainSubstring(`"kind":"AdmissionReview"`))
+	})
+
+	It("rejects invalid requests", func() {
+		h := AdmissionReviewHandler(newReviewWebhook(false))
+
+		for _, rec := range []*httptest.ResponseRecorder{
+			postReview(h, reviewBody(), "text/plain"),
+			postReview(h, []byte{}, "application/json"),
+			postReview(h, []byte(`{"kind": "AdmissionReview"}`), "application/json"),
+			postReview(h, bytes.Replace(reviewBody(), []byte(`"kind":"AdmissionReview"`), []byte(`"kind":"Review"`), 1), "application/json"),
+			postReview(h, bytes.Replace(reviewBody(), []byte(`"operation":"CREATE"`), []byte(`"operation":"PATCH"`), 1), "application/json"),
+		} {
+			review := admissionv1beta1.AdmissionReview{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &review)).To(Succeed())
+			Expect(review.Response.Allowed).To(BeFalse())
+			Expect(review.Response.Result.Code).To(BeEquivalentTo(http.StatusBadRequest))
+		}
+	})
+})
+
+var _ = Describe("AdmissionReview validation", func() {
+	It("rejects the requests missing required fields, keeping their UID", func() {
+		review := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(reviewBody(), &review)).To(Succeed())
+		review.Request.Kind = metav1.GroupVersionKind{}
+		review.Request.Object.Raw = nil
+		body, err := json.Marshal(review)
+		Expect(err).ToNot(HaveOccurred())
+
+		rec := postReview(AdmissionReviewHandler(newReviewWebhook(false)), body, "application/json")
+		response := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed())
+		Expect(response.Response.Allowed).To(BeFalse())
+		Expect(response.Response.UID).To(BeEquivalentTo("uid"))
+		Expect(response.Response.Result.Message).To(ContainSubstring("missing kind, object"))
+	})
+
+	It("answers with the request UID", func() {
+		review := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(reviewBody(), &review)).To(Succeed())
+		review.Request.UID = "f0b2a1e8-2a6c-4bd6-9e8b-7c3f7d0a5a11"
+		body, err := json.Marshal(review)
+		Expect(err).ToNot(HaveOccurred())
+
+		rec := postReview(AdmissionReviewHandler(newReviewWebhook(false)), body, "application/json")
+		response := admissionv1beta1.AdmissionReview{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed())
+		Expect(response.Response.UID).To(Equal(review.Request.UID))
+	})
+})
+
+var _ = Describe("Operator pods", func() {
+	operatorPodRequest := func(pod *corev1.Pod) admission.Request {
+		raw, _ := json.Marshal(pod)
+		return admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "cf",
+			Operation: admissionv1beta1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	It("admits the operator pods unchanged", func() {
+		e := &rawExtension{}
+		wh := newExtensionReviewWebhook(e, false)
+		w := wh.Handler.(*DefaultMutatingWebhook)
+		w.OperatorPodLabels = map[string]string{"app": "eirini-x"}
+		w.OperatorServiceAccount = "eirini-x"
+		w.OperatorNamespace = "cf"
+
+		byLabels := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "eirini-x-0", Labels: map[string]string{"app": "eirini-x"}}}
+		res := wh.Handle(context.Background(), operatorPodRequest(byLabels))
+		Expect(res.Allowed).To(BeTrue())
+		Expect(e.pod).To(BeNil())
+
+		byServiceAccount := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "eirini-x-1"}, Spec: corev1.PodSpec{ServiceAccountName: "eirini-x"}}
+		res = wh.Handle(context.Background(), operatorPodRequest(byServiceAccount))
+		Expect(res.Allowed).To(BeTrue())
+		Expect(e.pod).To(BeNil())
+
+		app := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app-0", Namespace: "eirini"}, Spec: corev1.PodSpec{ServiceAccountName: "eirini-x"}}
+		wh.Handle(context.Background(), operatorPodRequest(app))
+		Expect(e.pod).ToNot(BeNil())
+		Expect(e.pod.Name).To(Equal("app-0"))
+	})
+})
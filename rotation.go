@@ -0,0 +1,228 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const defaultCertificateRotationInterval = time.Minute
+
+// CertificateRotationOptions renew the webhook server certificates generated by the Manager before they expire,
+// without restarting the operator. The Manager registering the webhook configurations renews the CA and the
+// certificate in their secret, and sets the new CA in the CA bundle of the configurations, next to the previous
+// one, before serving the new certificate. Every replica checks the secrets and reloads the renewed certificates,
+// which the webhook servers pick up from disk.
+type CertificateRotationOptions struct {
+	// RenewBefore is how long before its expiry a certificate is renewed. Optional, defaults to a third of the
+	// lifetime of the certificate
+	RenewBefore time.Duration
+
+	// Interval is the interval between the checks of the certificate secrets. Optional, defaults to 1 minute
+	Interval time.Duration
+}
+
+func (c *CertificateRotationOptions) validate(path *field.Path, o *ManagerOptions) field.ErrorList {
+	var errs field.ErrorList
+	if c.RenewBefore < 0 {
+		errs = append(errs, field.Invalid(path.Child("renewBefore"), c.RenewBefore.String(), "must not be negative"))
+	}
+	if c.Interval < 0 {
+		errs = append(errs, field.Invalid(path.Child("interval"), c.Interval.String(), "must not be negative"))
+	}
+	if o.CertManager != nil {
+		errs = append(errs, field.Forbidden(path, "not supported with certManager, which renews the certificates"))
+	}
+	if o.SetupCertificate != nil && !*o.SetupCertificate {
+		errs = append(errs, field.Forbidden(path, "not supported with setupCertificate disabled"))
+	}
+	return errs
+}
+
+// certificateRotator renews the webhook server certificates before they expire, and reloads the ones renewed by
+// the other replicas
+type certificateRotator struct {
+	manager *DefaultExtensionManager
+	options *CertificateRotationOptions
+	logger  *zap.SugaredLogger
+}
+
+// NeedLeaderElection makes every replica reload its certificates
+func (r *certificateRotator) NeedLeaderElection() bool {
+	return false
+}
+
+// Start checks the certificates until the stop channel is closed
+func (r *certificateRotator) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	interval := r.options.Interval
+	if interval == 0 {
+		interval = defaultCertificateRotationInterval
+	}
+	wait.Until(func() {
+		for _, g := range r.manager.groups {
+			if err := r.manager.rotateCertificate(ctx, g, r.options.RenewBefore); err != nil {
+				certificateRotations.WithLabelValues(g.config.setupCertificateName, "failure").Inc()
+				r.logger.Errorf("Rotating the webhook server certificate %s: %s", g.config.setupCertificateName, err.Error())
+			}
+		}
+	}, interval, stop)
+	return nil
+}
+
+// rotateCertificate renews the certificate of the webhook server of the group if it is due, or reloads it if it
+// was renewed by another replica. The CA bundle of the webhook configurations trusts the new CA before the
+// certificate is written to disk, where the webhook server picks it up.
+func (m *DefaultExtensionManager) rotateCertificate(ctx context.Context, g *webhookGroup, renewBefore time.Duration) error {
+	// The configurations aren't registered again nor re-synced meanwhile, see resyncCABundle
+	m.failurePolicyMu.Lock()
+	defer m.failurePolicyMu.Unlock()
+
+	f := g.config
+	secret := &unstructured.Unstructured{}
+	secret.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Secret"})
+	key := machinerytypes.NamespacedName{Name: f.setupCertificateName, Namespace: f.webhookNamespace}
+	if err := f.client.Get(ctx, key, secret); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "reading the webhook server certificate secret")
+	}
+
+	next := *f
+	exists := secret.GetName() != ""
+	if exists {
+		if err := next.loadCertificateSecret(secret); err != nil {
+			return errors.Wrap(err, "decoding the webhook server certificate secret")
+		}
+	}
+
+	if !exists || bytes.Equal(next.Certificate, f.Certificate) {
+		// Only the Manager registering the configurations renews the certificates, as it patches their CA bundle
+		if !m.webhooksConfigured {
+			return nil
+		}
+		if exists {
+			due, err := next.renewalDue(renewBefore, time.Now())
+			if err != nil || !due {
+				return err
+			}
+		}
+		err := next.renewCertificateSecret(ctx, secret, f.CaCertificate)
+		if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+			// Another replica renewed the certificate meanwhile, it is reloaded on the next check
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "renewing the webhook server certificate")
+		}
+		certificateRotations.WithLabelValues(f.setupCertificateName, "success").Inc()
+		if expiry, err := next.certificateExpiry(); err == nil {
+			m.Logger.Infof("Renewed the webhook server certificate %s, now expiring at %s", f.setupCertificateName, expiry.UTC().Format(time.RFC3339))
+		}
+	} else {
+		m.Logger.Infof("Reloading the webhook server certificate %s renewed by another replica", f.setupCertificateName)
+	}
+
+	if m.webhooksConfigured && !bytes.Equal(next.CaCertificate, f.CaCertificate) {
+		if err := next.patchCABundle(ctx, g.webhooks); err != nil {
+			return err
+		}
+	}
+
+	f.Certificate, f.Key = next.Certificate, next.Key
+	f.CaCertificate, f.CaKey = next.CaCertificate, next.CaKey
+	if err := f.writeSecretFiles(); err != nil {
+		return errors.Wrap(err, "writing webhook certificate files to disk")
+	}
+	m.exportCertificateExpiry(f)
+
+	if m.Options.PublishCABundle && f == m.WebhookConfig {
+		if err := m.publishCABundle(ctx); err != nil {
+			return errors.Wrap(err, "publishing the webhook CA bundle")
+		}
+	}
+	return nil
+}
+
+// renewalDue returns whether the webhook server certificate expires within renewBefore, or within a third of its
+// lifetime if renewBefore is zero
+func (f *WebhookConfig) renewalDue(renewBefore time.Duration, now time.Time) (bool, error) {
+	cert, err := f.parseCertificate()
+	if err != nil {
+		return false, err
+	}
+	if renewBefore == 0 {
+		renewBefore = cert.NotAfter.Sub(cert.NotBefore) / 3
+	}
+	return !now.Before(cert.NotAfter.Add(-renewBefore)), nil
+}
+
+// renewCertificateSecret generates a new CA and webhook server certificate, and stores them in the secret, which
+// is created if it doesn't exist. The CA bundle keeps the current CA of previousBundle for the transition, so
+// that the replicas still serving the previous certificate remain trusted. The secret is only updated if it
+// wasn't renewed meanwhile.
+func (f *WebhookConfig) renewCertificateSecret(ctx context.Context, secret *unstructured.Unstructured, previousBundle []byte) error {
+	caCert, cert, err := f.generateCertificates()
+	if err != nil {
+		return err
+	}
+	caBundle := append(append([]byte{}, caCert.Certificate...), currentCA(previousBundle)...)
+	data := map[string][]byte{
+		"certificate":    cert.Certificate,
+		"private_key":    cert.PrivateKey,
+		"ca_certificate": caBundle,
+		"ca_private_key": caCert.PrivateKey,
+	}
+
+	if secret.GetName() == "" {
+		err = f.client.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        f.setupCertificateName,
+				Namespace:   f.webhookNamespace,
+				Annotations: f.Annotations,
+			},
+			Data: data,
+		})
+	} else {
+		encoded := map[string]interface{}{}
+		for k, v := range data {
+			encoded[k] = base64.StdEncoding.EncodeToString(v)
+		}
+		secret.Object["data"] = encoded
+		// The resource version of the secret makes the update fail if another replica renewed it
+		err = f.client.Update(ctx, secret)
+	}
+	if err != nil {
+		return err
+	}
+
+	f.Certificate, f.Key = cert.Certificate, cert.PrivateKey
+	f.CaCertificate, f.CaKey = caBundle, caCert.PrivateKey
+	return nil
+}
+
+// currentCA returns the first certificate of the CA bundle, the CA signing the webhook server certificate
+func currentCA(bundle []byte) []byte {
+	block, _ := pem.Decode(bundle)
+	if block == nil {
+		return nil
+	}
+	return pem.EncodeToMemory(block)
+}
@@ -0,0 +1,151 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Certificate rotation", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+		client        *cfakes.FakeClient
+		stored        map[string]interface{}
+		updates       int
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.SetupCertificateName = "test-rotation-setupcert"
+		eiriniManager.Credsgen = NewCredentialGenerator()
+		Expect(eiriniManager.AddExtension(c.SimpleExtension())).To(Succeed())
+
+		// The fake client stores the certificate secret
+		stored, updates = nil, 0
+		client = &cfakes.FakeClient{}
+		client.GetCalls(func(_ context.Context, key crc.ObjectKey, object runtime.Object) error {
+			if u, ok := object.(*unstructured.Unstructured); ok && u.GetKind() == "Secret" && stored != nil {
+				u.SetName(key.Name)
+				u.Object["data"] = stored
+			}
+			return nil
+		})
+		client.CreateCalls(func(_ context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+			if secret, ok := object.(*corev1.Secret); ok {
+				stored = map[string]interface{}{}
+				for k, v := range secret.Data {
+					stored[k] = base64.StdEncoding.EncodeToString(v)
+				}
+			}
+			return nil
+		})
+		client.UpdateCalls(func(_ context.Context, object runtime.Object, _ ...crc.UpdateOption) error {
+			if u, ok := object.(*unstructured.Unstructured); ok && u.GetKind() == "Secret" {
+				stored = u.Object["data"].(map[string]interface{})
+				updates++
+			}
+			return nil
+		})
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+	})
+
+	startRotator := func(stop chan struct{}) {
+		for i := 0; i < kubeManager.AddCallCount(); i++ {
+			if r := kubeManager.AddArgsForCall(i); fmt.Sprintf("%T", r) == "*extension.certificateRotator" {
+				go r.Start(stop)
+				return
+			}
+		}
+		Fail("the certificate rotator was not added to the manager")
+	}
+
+	certificate := func() []byte {
+		crt, err := ioutil.ReadFile(filepath.Join(eiriniManager.WebhookConfig.CertDir, "tls.crt"))
+		Expect(err).ToNot(HaveOccurred())
+		return crt
+	}
+
+	It("renews the certificate before it expires, trusting both CAs during the transition", func() {
+		eiriniManager.Options.CertificateRotation = &CertificateRotationOptions{RenewBefore: 2 * 365 * 24 * time.Hour, Interval: time.Hour}
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		previous, previousCA := certificate(), eiriniManager.WebhookConfig.CaCertificate
+
+		stop := make(chan struct{})
+		defer close(stop)
+		startRotator(stop)
+
+		Eventually(certificate).ShouldNot(Equal(previous))
+		Expect(updates).To(Equal(1))
+
+		bundle := eiriniManager.WebhookConfig.CaCertificate
+		block, rest := pem.Decode(bundle)
+		Expect(block).ToNot(BeNil())
+		Expect(rest).To(Equal(previousCA))
+		Expect(stored["ca_certificate"]).To(Equal(base64.StdEncoding.EncodeToString(bundle)))
+
+		Expect(client.PatchCallCount()).To(Equal(1))
+		_, object, patch, _ := client.PatchArgsForCall(0)
+		data, err := patch.Data(object)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(base64.StdEncoding.EncodeToString(bundle)))
+	})
+
+	It("reloads the certificate renewed by another replica", func() {
+		eiriniManager.Options.CertificateRotation = &CertificateRotationOptions{Interval: time.Hour}
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		generator := NewCredentialGenerator()
+		ca, err := generator.GenerateCertificate("ca", CertificateRequest{CommonName: "other CA", IsCA: true})
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := generator.GenerateCertificate("cert", CertificateRequest{CommonName: "127.0.0.1", CA: ca})
+		Expect(err).ToNot(HaveOccurred())
+		stored = map[string]interface{}{
+			"certificate":    base64.StdEncoding.EncodeToString(cert.Certificate),
+			"private_key":    base64.StdEncoding.EncodeToString(cert.PrivateKey),
+			"ca_certificate": base64.StdEncoding.EncodeToString(ca.Certificate),
+			"ca_private_key": base64.StdEncoding.EncodeToString(ca.PrivateKey),
+		}
+
+		stop := make(chan struct{})
+		defer close(stop)
+		startRotator(stop)
+
+		Eventually(certificate).Should(Equal(cert.Certificate))
+		Expect(updates).To(Equal(0))
+		Expect(eiriniManager.WebhookConfig.CaCertificate).To(Equal(ca.Certificate))
+	})
+
+	It("doesn't renew the certificates issued by cert-manager", func() {
+		opts := ManagerOptions{Namespace: "eirini", WebhookNamespace: "eirini", CertificateRotation: &CertificateRotationOptions{},
+			CertManager: &CertManagerOptions{IssuerName: "eirini-ca"}}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("certificateRotation: Forbidden"))
+	})
+})
@@ -0,0 +1,207 @@
+package extension
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ResourcePods targets the pods themselves
+	ResourcePods = "pods"
+	// ResourcePodsStatus targets the status updates of the pods
+	ResourcePodsStatus = "pods/status"
+	// ResourcePodsBinding targets the scheduling decisions, the request object is a Binding
+	ResourcePodsBinding = "pods/binding"
+
+	// ResourceNamespaces targets the namespaces, e.g. the ones of the CF spaces
+	ResourceNamespaces = "namespaces"
+	// ResourcePersistentVolumes targets the persistent volumes, e.g. the ones provisioned for the app volume services
+	ResourcePersistentVolumes = "persistentvolumes"
+	// ResourcePriorityClasses targets the priority classes of the pods
+	ResourcePriorityClasses = "priorityclasses"
+)
+
+// clusterResources are the cluster-scoped resources the webhooks can target, by API group
+var clusterResources = map[string]schema.GroupVersion{
+	ResourceNamespaces:        {Version: "v1"},
+	ResourcePersistentVolumes: {Version: "v1"},
+	ResourcePriorityClasses:   {Group: "scheduling.k8s.io", Version: "v1"},
+}
+
+// WebhookRules are the resources, operations and scope the webhook of an extension is called for
+type WebhookRules struct {
+	// Resources are the pod resource and sub-resources, e.g. ResourcePods and ResourcePodsStatus, or the
+	// cluster-scoped resources, e.g. ResourcePersistentVolumes. Optional, defaults to pods
+	Resources []string
+
+	// Operations are the operations on the resources. Optional, defaults to CREATE and UPDATE
+	Operations []admissionregistrationv1beta1.OperationType
+
+	// Scope is the scope of the rules. Optional, defaults to all scopes for the pods and to the cluster
+	// scope for the cluster-scoped resources
+	Scope admissionregistrationv1beta1.ScopeType
+
+	// CustomResources are the resources of the other API groups, e.g. the ones of a CRD, whose objects can be
+	// decoded with the types the extension registers in the scheme, see ObjectHandler. Optional
+	CustomResources []CustomResource
+}
+
+// CustomResource is a resource targeted by the webhook rules besides the pods and the cluster resources
+type CustomResource struct {
+	// Group and Version are the API group and version of the resource, e.g. "example.com" and "v1"
+	Group   string
+	Version string
+	// Resource is the plural name of the resource or sub-resource, e.g. "widgets"
+	Resource string
+	// ClusterScoped is true for the cluster-scoped resources
+	ClusterScoped bool
+}
+
+// RuledExtension can be implemented by Extensions to choose the rules of their webhook, e.g. to observe the
+// status updates or the binding decisions of the pods rather than their creation, or to mutate cluster-scoped
+// resources.
+//
+// For sub-resources whose request object is not a Pod (e.g. pods/binding) and for the cluster-scoped resources,
+// Handle is called with a nil pod and the object must be decoded from the request, which the extension accepts
+// by implementing NonPodHandler. As the webhook object
+// selector is evaluated on the request object, FilterEiriniApps should be disabled for the pod sub-resources,
+// and it is not applied to the webhooks targeting only cluster-scoped resources.
+type RuledExtension interface {
+	WebhookRules() WebhookRules
+}
+
+// NonPodHandler is implemented by the Extensions accepting to be called with a nil pod: for the requests whose
+// object is not a pod (see RuledExtension), without an object, or whose pod couldn't be decoded at all with the
+// pass-through DecodeErrorPolicy. The other extensions are only called with a pod, and the requests they can't
+// be passed one are admitted unchanged.
+type NonPodHandler interface {
+	HandlesNonPods() bool
+}
+
+// handlesNonPods returns true if the extension accepts to be called with a nil pod
+func handlesNonPods(e Extension) bool {
+	h, ok := e.(NonPodHandler)
+	return ok && h.HandlesNonPods()
+}
+
+// nonPodResources returns the resources of the rules whose request object is not a pod
+func (r WebhookRules) nonPodResources() []string {
+	var resources []string
+	for _, res := range r.Resources {
+		if res != ResourcePods && res != ResourcePodsStatus {
+			resources = append(resources, res)
+		}
+	}
+	for _, cr := range r.CustomResources {
+		resources = append(resources, cr.Resource)
+	}
+	return resources
+}
+
+// resourceGroupVersion returns the API group and version of a resource or sub-resource, and whether it is
+// cluster-scoped
+func resourceGroupVersion(resource string) (schema.GroupVersion, bool, error) {
+	base := strings.SplitN(resource, "/", 2)[0]
+	if base == ResourcePods {
+		return schema.GroupVersion{Version: "v1"}, false, nil
+	}
+	if gv, ok := clusterResources[base]; ok {
+		return gv, true, nil
+	}
+	return schema.GroupVersion{}, false, errors.Errorf("Unsupported webhook resource %q, only pods and their sub-resources, namespaces, persistentvolumes and priorityclasses can be targeted", resource)
+}
+
+// targetsPods returns true if the rules target pods or their sub-resources
+func (r WebhookRules) targetsPods() bool {
+	if len(r.Resources) == 0 && len(r.CustomResources) == 0 {
+		return true
+	}
+	for _, res := range r.Resources {
+		if strings.SplitN(res, "/", 2)[0] == ResourcePods {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesWithOperations returns the admission rules, with the defaults applied. The resources are grouped in a
+// rule per API group and scope, as a rule applies to all the combinations of its groups and resources.
+func (r WebhookRules) rulesWithOperations() ([]admissionregistrationv1beta1.RuleWithOperations, error) {
+	resources := r.Resources
+	if len(resources) == 0 && len(r.CustomResources) == 0 {
+		resources = []string{ResourcePods}
+	}
+
+	operations := r.Operations
+	if len(operations) == 0 {
+		operations = []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.Create, admissionregistrationv1beta1.Update}
+	}
+
+	switch r.Scope {
+	case "", admissionregistrationv1beta1.AllScopes, admissionregistrationv1beta1.NamespacedScope, admissionregistrationv1beta1.ClusterScope:
+	default:
+		return nil, errors.Errorf("Unsupported webhook scope %q", r.Scope)
+	}
+
+	type ruleKey struct {
+		gv    schema.GroupVersion
+		scope admissionregistrationv1beta1.ScopeType
+	}
+	type target struct {
+		resource string
+		gv       schema.GroupVersion
+		cluster  bool
+	}
+	var targets []target
+	for _, res := range resources {
+		gv, cluster, err := resourceGroupVersion(res)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target{resource: res, gv: gv, cluster: cluster})
+	}
+	for _, cr := range r.CustomResources {
+		if cr.Group == "" || cr.Version == "" || cr.Resource == "" {
+			return nil, errors.Errorf("Unsupported custom resource %q, its group, version and resource are required", cr.Resource)
+		}
+		targets = append(targets, target{resource: cr.Resource, gv: schema.GroupVersion{Group: cr.Group, Version: cr.Version}, cluster: cr.ClusterScoped})
+	}
+
+	var rules []admissionregistrationv1beta1.RuleWithOperations
+	index := map[ruleKey]int{}
+	for _, t := range targets {
+		res, gv, cluster := t.resource, t.gv, t.cluster
+
+		scope := r.Scope
+		switch {
+		case scope == "" && cluster:
+			scope = admissionregistrationv1beta1.ClusterScope
+		case scope == "":
+			scope = admissionregistrationv1beta1.AllScopes
+		case scope == admissionregistrationv1beta1.NamespacedScope && cluster:
+			return nil, errors.Errorf("Unsupported webhook scope %q, %s are cluster-scoped", scope, res)
+		case scope == admissionregistrationv1beta1.ClusterScope && !cluster:
+			return nil, errors.Errorf("Unsupported webhook scope %q, %s are namespaced", scope, res)
+		}
+
+		key := ruleKey{gv: gv, scope: scope}
+		if i, ok := index[key]; ok {
+			rules[i].Resources = append(rules[i].Resources, res)
+			continue
+		}
+		index[key] = len(rules)
+		rules = append(rules, admissionregistrationv1beta1.RuleWithOperations{
+			Rule: admissionregistrationv1beta1.Rule{
+				APIGroups:   []string{gv.Group},
+				APIVersions: []string{gv.Version},
+				Resources:   []string{res},
+				Scope:       &scope,
+			},
+			Operations: operations,
+		})
+	}
+	return rules, nil
+}
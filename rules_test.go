@@ -0,0 +1,142 @@
+package extension_test
+
+import (
+	"context"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type bindingObserver struct {
+	rules   WebhookRules
+	nonPods bool
+	pods    []*corev1.Pod
+}
+
+func (e *bindingObserver) WebhookRules() WebhookRules {
+	return e.rules
+}
+
+func (e *bindingObserver) HandlesNonPods() bool {
+	return e.nonPods
+}
+
+func (e *bindingObserver) Handle(_ context.Context, _ Manager, pod *corev1.Pod, _ admission.Request) admission.Response {
+	e.pods = append(e.pods, pod)
+	return admission.Allowed("")
+}
+
+var _ = Describe("Webhook rules", func() {
+	var ext *bindingObserver
+
+	register := func() (*DefaultMutatingWebhook, error) {
+		failurePolicy := admissionregistrationv1beta1.Fail
+		c := catalog.NewCatalog()
+		w := NewWebhook(ext, c.SimpleManager()).(*DefaultMutatingWebhook)
+		return w, w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{
+			ID:             "rules",
+			ManagerOptions: ManagerOptions{FailurePolicy: &failurePolicy},
+		})
+	}
+
+	BeforeEach(func() {
+		ext = &bindingObserver{nonPods: true, rules: WebhookRules{
+			Resources:  []string{ResourcePodsBinding},
+			Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.Create},
+			Scope:      admissionregistrationv1beta1.NamespacedScope,
+		}}
+	})
+
+	It("uses the rules of the extension", func() {
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Rules).To(HaveLen(1))
+		Expect(w.Rules[0].Resources).To(Equal([]string{"pods/binding"}))
+		Expect(w.Rules[0].Operations).To(Equal([]admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.Create}))
+		Expect(*w.Rules[0].Scope).To(Equal(admissionregistrationv1beta1.NamespacedScope))
+	})
+
+	It("defaults the omitted fields", func() {
+		ext.rules = WebhookRules{Resources: []string{ResourcePods, ResourcePodsStatus}}
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Rules[0].Resources).To(Equal([]string{"pods", "pods/status"}))
+		Expect(w.Rules[0].Operations).To(ConsistOf(admissionregistrationv1beta1.Create, admissionregistrationv1beta1.Update))
+		Expect(*w.Rules[0].Scope).To(Equal(admissionregistrationv1beta1.AllScopes))
+	})
+
+	It("requires the extensions targeting other objects than pods to handle them", func() {
+		ext.nonPods = false
+		_, err := register()
+		Expect(err).To(MatchError(ContainSubstring("targets pods/binding, whose objects are not pods, and must implement NonPodHandler")))
+
+		ext.rules = WebhookRules{Resources: []string{ResourcePods, ResourcePodsStatus}}
+		_, err = register()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("rejects resources other than pods", func() {
+		ext.rules = WebhookRules{Resources: []string{"secrets"}}
+		_, err := register()
+		Expect(err).To(MatchError(ContainSubstring("secrets")))
+	})
+
+	It("generates cluster-scoped rules for the cluster resources", func() {
+		ext.rules = WebhookRules{Resources: []string{ResourcePods, ResourcePersistentVolumes, ResourceNamespaces, ResourcePriorityClasses}}
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Rules).To(HaveLen(3))
+
+		Expect(w.Rules[0].Resources).To(Equal([]string{"pods"}))
+		Expect(*w.Rules[0].Scope).To(Equal(admissionregistrationv1beta1.AllScopes))
+
+		Expect(w.Rules[1].APIGroups).To(Equal([]string{""}))
+		Expect(w.Rules[1].Resources).To(Equal([]string{"persistentvolumes", "namespaces"}))
+		Expect(*w.Rules[1].Scope).To(Equal(admissionregistrationv1beta1.ClusterScope))
+
+		Expect(w.Rules[2].APIGroups).To(Equal([]string{"scheduling.k8s.io"}))
+		Expect(w.Rules[2].Resources).To(Equal([]string{"priorityclasses"}))
+		Expect(*w.Rules[2].Scope).To(Equal(admissionregistrationv1beta1.ClusterScope))
+		Expect(w.FilterEiriniApps).To(BeTrue())
+	})
+
+	It("doesn't filter the Eirini apps when targeting only cluster resources", func() {
+		ext.rules = WebhookRules{Resources: []string{ResourcePersistentVolumes}}
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.FilterEiriniApps).To(BeFalse())
+		Expect(w.GetLabelSelector()).To(BeNil())
+	})
+
+	It("rejects scopes the resources can't have", func() {
+		ext.rules = WebhookRules{Resources: []string{ResourcePersistentVolumes}, Scope: admissionregistrationv1beta1.NamespacedScope}
+		_, err := register()
+		Expect(err).To(MatchError(ContainSubstring("cluster-scoped")))
+
+		ext.rules = WebhookRules{Resources: []string{ResourcePods}, Scope: admissionregistrationv1beta1.ClusterScope}
+		_, err = register()
+		Expect(err).To(MatchError(ContainSubstring("namespaced")))
+	})
+
+	It("calls the extension with no pod for the binding requests", func() {
+		w, err := register()
+		Expect(err).ToNot(HaveOccurred())
+
+		req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Kind:        metav1.GroupVersionKind{Version: "v1", Kind: "Binding"},
+			SubResource: "binding",
+			Operation:   admissionv1beta1.Create,
+		}}
+		req.Object.Raw = []byte(`{"apiVersion":"v1","kind":"Binding","metadata":{"name":"app-0"},"target":{"kind":"Node","name":"node-1"}}`)
+		Expect(w.Handle(context.Background(), req).Allowed).To(BeTrue())
+		Expect(ext.pods).To(Equal([]*corev1.Pod{nil}))
+	})
+})
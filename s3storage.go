@@ -0,0 +1,300 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultS3Region is the region used to sign the requests, which most S3-compatible storages ignore
+	defaultS3Region = "us-east-1"
+	// s3ErrorBodySize is the size of the error responses kept in the errors
+	s3ErrorBodySize = 512
+
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+	s3TimeFormat       = "20060102T150405Z"
+)
+
+// S3StorageOptions are the location and the credentials of an S3-compatible object storage, e.g. AWS S3,
+// MinIO or Ceph
+type S3StorageOptions struct {
+	// Endpoint is the URL of the storage, e.g. https://s3.eu-west-1.amazonaws.com or http://minio.minio:9000
+	Endpoint string
+
+	// Region is the region of the bucket. Optional, defaults to us-east-1
+	Region string
+
+	// Bucket is the bucket storing the objects. The requests are path-style (<endpoint>/<bucket>/<key>)
+	Bucket string
+
+	// Prefix is prepended to the keys of the objects, e.g. eirinix/production/. Optional
+	Prefix string
+
+	// AccessKeyID and SecretAccessKey are the credentials signing the requests, with SessionToken for the
+	// temporary ones
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// HTTPClient sends the requests. Optional, defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// NewS3Storage returns a Storage writing the objects in a bucket of an S3-compatible object storage, with
+// requests signed with AWS Signature Version 4. Storage.Create relies on conditional writes (If-None-Match),
+// which older S3-compatible storages may ignore.
+func NewS3Storage(opts S3StorageOptions) (Storage, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.Errorf("Invalid S3 endpoint %q, must be http(s)://host[:port]", opts.Endpoint)
+	}
+	if opts.Bucket == "" {
+		return nil, errors.New("The S3 bucket is required")
+	}
+	if opts.Region == "" {
+		opts.Region = defaultS3Region
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &s3Storage{options: opts, endpoint: u, now: time.Now}, nil
+}
+
+type s3Storage struct {
+	options  S3StorageOptions
+	endpoint *url.URL
+	now      func() time.Time
+}
+
+// s3ListResult is the response of ListObjectsV2
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3Storage) Put(ctx context.Context, name string, data []byte) error {
+	res, err := s.do(ctx, http.MethodPut, s.options.Prefix+name, nil, nil, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return s3Error(res, http.MethodPut, name)
+}
+
+func (s *s3Storage) Get(ctx context.Context, name string) ([]byte, error) {
+	res, err := s.do(ctx, http.MethodGet, s.options.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrStorageObjectNotFound
+	}
+	if err := s3Error(res, http.MethodGet, name); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+func (s *s3Storage) Create(ctx context.Context, name string, data []byte) error {
+	res, err := s.do(ctx, http.MethodPut, s.options.Prefix+name, nil, http.Header{"If-None-Match": {"*"}}, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusPreconditionFailed || res.StatusCode == http.StatusConflict {
+		return ErrStorageObjectExists
+	}
+	return s3Error(res, http.MethodPut, name)
+}
+
+func (s *s3Storage) List(ctx context.Context) ([]string, error) {
+	var names []string
+	for cont := ""; ; {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.options.Prefix}}
+		if cont != "" {
+			query.Set("continuation-token", cont)
+		}
+		res, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		result := s3ListResult{}
+		err = s3Error(res, http.MethodGet, "")
+		if err == nil {
+			err = errors.Wrap(xml.NewDecoder(res.Body).Decode(&result), "decoding the S3 objects")
+		}
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range result.Contents {
+			names = append(names, strings.TrimPrefix(c.Key, s.options.Prefix))
+		}
+		if cont = result.NextContinuationToken; !result.IsTruncated || cont == "" {
+			return names, nil
+		}
+	}
+}
+
+func (s *s3Storage) Delete(ctx context.Context, name string) error {
+	res, err := s.do(ctx, http.MethodDelete, s.options.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return s3Error(res, http.MethodDelete, name)
+}
+
+// do sends a signed request for the key of the bucket, or the bucket itself if the key is empty
+func (s *s3Storage) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.options.Bucket
+	u.RawPath = s3EscapePath(s.endpoint.Path) + "/" + s3EscapePath(s.options.Bucket)
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + s3EscapePath(key)
+	}
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, body)
+
+	res, err := s.options.HTTPClient.Do(req)
+	return res, errors.Wrapf(err, "sending the S3 %s request", method)
+}
+
+// sign adds the AWS Signature Version 4 of the request, see
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (s *s3Storage) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	date := now.Format("20060102")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.options.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.options.SessionToken)
+	}
+
+	// the host and the x-amz-* headers are signed
+	signed := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			signed[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for k := range signed {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, signed[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, s.options.Region, "s3", "aws4_request"}, "/")
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3SigningAlgorithm, now.Format(s3TimeFormat), scope, hex.EncodeToString(hashed[:])}, "\n")
+
+	key := []byte("AWS4" + s.options.SecretAccessKey)
+	for _, part := range []string{date, s.options.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, s.options.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape encodes the characters other than the unreserved ones, as required by the signature
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(p string) string {
+	return s3Escape(p, true)
+}
+
+// s3CanonicalQuery encodes the query sorted by parameter, as required by the signature
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// s3Error returns an error with the beginning of the response body if the request failed
+func s3Error(res *http.Response, method, name string) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, s3ErrorBodySize))
+	return errors.Errorf("The S3 %s request of %q failed with %s: %s", method, name, res.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,128 @@
+package extension
+
+import (
+	"encoding/json"
+	"sort"
+
+	jsonpatchapply "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// AnnotationConfigPrefix prefixes the app pod annotations overriding the configuration of an extension for
+// the app, e.g. config.eirinix.cloudfoundry.org/memory: {"defaultLimit": "2Gi"}
+const AnnotationConfigPrefix = "config.eirinix.cloudfoundry.org/"
+
+// ScopedExtensionConfig overrides the ExtensionConfig of the ManagerOptions for the apps of some orgs and
+// spaces, e.g. so that platform admins raise the default memory limit of a space. The overrides are JSON
+// merge patches (RFC 7386) of the configuration of each extension, indexed by its ConfigKey: the objects are
+// merged, null removes a field and the other values replace the inherited ones.
+type ScopedExtensionConfig struct {
+	// Orgs are the overrides of the apps of each org, by org name
+	Orgs map[string]map[string]json.RawMessage
+
+	// Spaces are the overrides of the apps of each space, by space GUID, applied over the ones of the org
+	Spaces map[string]map[string]json.RawMessage
+}
+
+// ResolveConfig returns the configuration of the extension with the config key for the app of the pod,
+// resolved from the ExtensionConfig of the ManagerOptions overridden by the ScopedConfig of its org and
+// space, and by the AnnotationConfigPrefix annotation of the pod. The resolved configuration is validated
+// against the schema of the extension.
+func (m *DefaultExtensionManager) ResolveConfig(key string, pod *corev1.Pod) ([]byte, error) {
+	var extension ConfigurableExtension
+	for _, c := range m.configurableExtensions() {
+		if c.ConfigKey() == key {
+			extension = c
+			break
+		}
+	}
+	if extension == nil {
+		return nil, errors.Errorf("No extension accepts the configuration '%s'", key)
+	}
+
+	layout := m.EiriniLayout()
+	config, err := resolveConfig(configFor(m.Options.ExtensionConfig, extension), m.configOverrides(key, layout.OrgName(pod), layout.SpaceGUID(pod)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving the configuration '%s'", key)
+	}
+	if pod != nil {
+		if override, ok := pod.GetAnnotations()[AnnotationConfigPrefix+key]; ok {
+			if config, err = jsonpatchapply.MergePatch(config, []byte(override)); err != nil {
+				return nil, errors.Wrapf(err, "applying the annotation %s%s of the pod", AnnotationConfigPrefix, key)
+			}
+		}
+	}
+
+	if err := extension.ConfigSchema().Validate(config); err != nil {
+		return nil, errors.Wrapf(err, "invalid configuration for '%s'", key)
+	}
+	return config, nil
+}
+
+// configOverrides returns the overrides of the configuration of the org and of the space, in order
+func (m *DefaultExtensionManager) configOverrides(key, org, space string) []json.RawMessage {
+	scoped := m.Options.ScopedConfig
+	if scoped == nil {
+		return nil
+	}
+	var overrides []json.RawMessage
+	if o, ok := scoped.Orgs[org][key]; ok && org != "" {
+		overrides = append(overrides, o)
+	}
+	if o, ok := scoped.Spaces[space][key]; ok && space != "" {
+		overrides = append(overrides, o)
+	}
+	return overrides
+}
+
+// resolveConfig applies the overrides to the configuration
+func resolveConfig(config []byte, overrides []json.RawMessage) ([]byte, error) {
+	for _, o := range overrides {
+		var err error
+		if config, err = jsonpatchapply.MergePatch(config, o); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// validateScopedConfig checks that the configuration of each org and space, once applied to the global one,
+// satisfies the schema of the extensions. The space overrides are checked on their own, as the org of a space
+// is only known from the app pods.
+func (m *DefaultExtensionManager) validateScopedConfig(extensionConfig map[string]json.RawMessage) error {
+	scoped := m.Options.ScopedConfig
+	if scoped == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, scope := range []struct {
+		kind      string
+		overrides map[string]map[string]json.RawMessage
+	}{{"org", scoped.Orgs}, {"space", scoped.Spaces}} {
+		names := make([]string, 0, len(scope.overrides))
+		for name := range scope.overrides {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			for _, c := range m.configurableExtensions() {
+				o, ok := scope.overrides[name][c.ConfigKey()]
+				if !ok {
+					continue
+				}
+				config, err := resolveConfig(configFor(extensionConfig, c), []json.RawMessage{o})
+				if err == nil {
+					err = c.ConfigSchema().Validate(config)
+				}
+				if err != nil {
+					errs = append(errs, errors.Wrapf(err, "invalid configuration for '%s' in the %s %s", c.ConfigKey(), scope.kind, name))
+				}
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
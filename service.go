@@ -0,0 +1,251 @@
+package extension
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultServicePortName   = "webhook"
+	serviceReconcileInterval = time.Minute
+
+	// LabelManagedBy is set on the objects owned by the Manager, to the OperatorFingerprint
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+)
+
+// ServiceOptions make the Manager own the Service the webhooks are registered with, when ServiceName is set.
+//
+// The Service is written as an unstructured object, so that the fields which are newer than the kubernetes
+// types the operator is built with (internalTrafficPolicy, ipFamilyPolicy, ipFamilies) are passed through
+// to the API server.
+type ServiceOptions struct {
+	// Selector selects the operator pods. Optional, if omitted the Manager also owns the Endpoints of the
+	// Service, pointing to Host, e.g. when the operator runs outside the cluster
+	Selector map[string]string
+
+	// Labels are added to the Service. Optional
+	Labels map[string]string
+
+	// PortName is the name of the Service port. Optional, defaults to webhook
+	PortName string
+
+	// TargetPort is the name of the operator container port the Service forwards to. Optional, defaults
+	// to the number of the webhook server port
+	TargetPort string
+
+	// InternalTrafficPolicy is Cluster or Local, requires kubernetes 1.21. Optional
+	InternalTrafficPolicy string
+
+	// IPFamilyPolicy is SingleStack, PreferDualStack or RequireDualStack, requires kubernetes 1.20. Optional
+	IPFamilyPolicy string
+
+	// IPFamilies are the IP families of the Service, e.g. IPv4 and IPv6, requires kubernetes 1.20. Optional
+	IPFamilies []string
+}
+
+var (
+	serviceGVK   = schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+	endpointsGVK = schema.GroupVersionKind{Version: "v1", Kind: "Endpoints"}
+)
+
+func (m *DefaultExtensionManager) serviceLabels() map[string]interface{} {
+	labels := map[string]interface{}{LabelManagedBy: m.Options.OperatorFingerprint}
+	for k, v := range m.Options.Service.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+func (m *DefaultExtensionManager) servicePort() map[string]interface{} {
+	opts := m.Options.Service
+	name := opts.PortName
+	if name == "" {
+		name = defaultServicePortName
+	}
+	port := map[string]interface{}{
+		"name":       name,
+		"protocol":   "TCP",
+		"port":       int64(m.Options.Port),
+		"targetPort": int64(m.Options.Port),
+	}
+	if opts.TargetPort != "" {
+		port["targetPort"] = opts.TargetPort
+	}
+	return port
+}
+
+// desiredServiceSpec returns the fields of the Service spec owned by the Manager. The other fields,
+// e.g. the clusterIP allocated by the API server, are kept as they are
+func (m *DefaultExtensionManager) desiredServiceSpec() map[string]interface{} {
+	opts := m.Options.Service
+	ports := []interface{}{m.servicePort()}
+	for _, g := range m.Options.WebhookGroups {
+		// The webhook configurations of the groups reference the Service with the port of their server
+		ports = append(ports, map[string]interface{}{
+			"name":       defaultServicePortName + "-" + g.Name,
+			"protocol":   "TCP",
+			"port":       int64(g.Port),
+			"targetPort": int64(g.Port),
+		})
+	}
+	spec := map[string]interface{}{
+		"type":  "ClusterIP",
+		"ports": ports,
+	}
+	if len(opts.Selector) > 0 {
+		selector := map[string]interface{}{}
+		for k, v := range opts.Selector {
+			selector[k] = v
+		}
+		spec["selector"] = selector
+	}
+	if opts.InternalTrafficPolicy != "" {
+		spec["internalTrafficPolicy"] = opts.InternalTrafficPolicy
+	}
+	if opts.IPFamilyPolicy != "" {
+		spec["ipFamilyPolicy"] = opts.IPFamilyPolicy
+	}
+	if len(opts.IPFamilies) > 0 {
+		families := make([]interface{}, len(opts.IPFamilies))
+		for i, f := range opts.IPFamilies {
+			families[i] = f
+		}
+		spec["ipFamilies"] = families
+	}
+	return spec
+}
+
+// reconcileService creates the webhook Service, or brings it back to the desired state
+func (m *DefaultExtensionManager) reconcileService(ctx context.Context) error {
+	c := m.KubeManager.GetClient()
+	key := machinerytypes.NamespacedName{Name: m.Options.ServiceName, Namespace: m.Options.WebhookNamespace}
+
+	service := &unstructured.Unstructured{}
+	service.SetGroupVersionKind(serviceGVK)
+	err := c.Get(ctx, key, service)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "getting the webhook service")
+	}
+	create := apierrors.IsNotFound(err)
+	if create {
+		service = &unstructured.Unstructured{Object: map[string]interface{}{}}
+		service.SetGroupVersionKind(serviceGVK)
+		service.SetName(key.Name)
+		service.SetNamespace(key.Namespace)
+	}
+	before := service.DeepCopy()
+
+	labels := service.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range m.serviceLabels() {
+		labels[k] = v.(string)
+	}
+	service.SetLabels(labels)
+
+	spec, _, _ := unstructured.NestedMap(service.Object, "spec")
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	for k, v := range m.desiredServiceSpec() {
+		spec[k] = v
+	}
+	if len(m.Options.Service.Selector) == 0 {
+		delete(spec, "selector")
+	}
+	if err := unstructured.SetNestedMap(service.Object, spec, "spec"); err != nil {
+		return errors.Wrap(err, "setting the webhook service spec")
+	}
+
+	if create {
+		if err := c.Create(ctx, service); err != nil {
+			return errors.Wrap(err, "creating the webhook service")
+		}
+	} else if !reflect.DeepEqual(before.Object, service.Object) {
+		if err := c.Update(ctx, service); err != nil {
+			return errors.Wrap(err, "updating the webhook service")
+		}
+	}
+
+	if len(m.Options.Service.Selector) == 0 {
+		return m.reconcileEndpoints(ctx, c, key)
+	}
+	return nil
+}
+
+// reconcileEndpoints points the Service without selector to the webhook server Host
+func (m *DefaultExtensionManager) reconcileEndpoints(ctx context.Context, c client.Client, key machinerytypes.NamespacedName) error {
+	if net.ParseIP(m.Options.Host) == nil {
+		return errors.Errorf("The webhook service endpoints need Host to be an IP address, got %q", m.Options.Host)
+	}
+	port := m.servicePort()
+	desired := []interface{}{map[string]interface{}{
+		"addresses": []interface{}{map[string]interface{}{"ip": m.Options.Host}},
+		"ports": []interface{}{map[string]interface{}{
+			"name":     port["name"],
+			"protocol": "TCP",
+			"port":     int64(m.Options.Port),
+		}},
+	}}
+
+	endpoints := &unstructured.Unstructured{}
+	endpoints.SetGroupVersionKind(endpointsGVK)
+	err := c.Get(ctx, key, endpoints)
+	if apierrors.IsNotFound(err) {
+		endpoints = &unstructured.Unstructured{Object: map[string]interface{}{"subsets": desired}}
+		endpoints.SetGroupVersionKind(endpointsGVK)
+		endpoints.SetName(key.Name)
+		endpoints.SetNamespace(key.Namespace)
+		endpoints.SetLabels(map[string]string{LabelManagedBy: m.Options.OperatorFingerprint})
+		return errors.Wrap(c.Create(ctx, endpoints), "creating the webhook service endpoints")
+	}
+	if err != nil {
+		return errors.Wrap(err, "getting the webhook service endpoints")
+	}
+
+	if reflect.DeepEqual(endpoints.Object["subsets"], desired) {
+		return nil
+	}
+	endpoints.Object["subsets"] = desired
+	return errors.Wrap(c.Update(ctx, endpoints), "updating the webhook service endpoints")
+}
+
+// serviceReconciler periodically reconciles the webhook Service, restoring it if it was changed or deleted
+type serviceReconciler struct {
+	manager *DefaultExtensionManager
+	logger  *zap.SugaredLogger
+}
+
+// NeedLeaderElection makes the reconciler run on every replica, as the Service is the same for all of them
+func (r *serviceReconciler) NeedLeaderElection() bool {
+	return false
+}
+
+// Start reconciles the Service until the stop channel is closed
+func (r *serviceReconciler) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	wait.Until(func() {
+		if err := r.manager.reconcileService(ctx); err != nil {
+			r.logger.Errorf("Reconciling the webhook service: %s", err.Error())
+		}
+	}, serviceReconcileInterval, stop)
+	return nil
+}
@@ -0,0 +1,139 @@
+package extension
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// shutdownMargin is the time given to the runnables of the kubernetes manager to stop, on top of the
+	// DrainTimeout of the webhook servers
+	shutdownMargin = 5 * time.Second
+
+	// cleanupTimeout is the maximum time spent removing the webhook configurations and the namespace labels,
+	// see CleanupOnStop
+	cleanupTimeout = 10 * time.Second
+)
+
+// setRunning returns the channel to close once the Manager loop returns
+func (m *DefaultExtensionManager) setRunning() chan struct{} {
+	m.runningMu.Lock()
+	defer m.runningMu.Unlock()
+	m.running = make(chan struct{})
+	return m.running
+}
+
+// waitStopped blocks until the Manager loop returned, if it was started
+func (m *DefaultExtensionManager) waitStopped() {
+	m.runningMu.Lock()
+	running := m.running
+	m.runningMu.Unlock()
+	if running != nil {
+		<-running
+	}
+}
+
+// StartContext starts the Manager, and stops it like Stop once the context is done, e.g. in the programs and
+// tests embedding the Manager. It is the preferred entry point, Start being StartContext with a context which is
+// never done. It returns once the Manager stopped, with the error of the Manager loop.
+func (m *DefaultExtensionManager) StartContext(ctx context.Context) error {
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.Stop()
+		case <-m.stopChannel:
+		}
+	}()
+	err := m.run()
+	m.Stop()
+	return err
+}
+
+// Stop stops the Manager started by Start: the webhook servers stop accepting connections and drain their
+// in-flight admission requests for up to DrainTimeout, and Stop returns once Start returned. With
+// CleanupOnStop, the webhook configurations are removed first and the namespace labels last. Stop can be
+// called several times, the later calls waiting for the first one.
+func (m *DefaultExtensionManager) Stop() {
+	defer m.Logger.Sync()
+
+	m.stopOnce.Do(func() {
+		cleanup := m.Options.CleanupOnStop && m.KubeManager != nil
+		if cleanup {
+			if err := m.unregisterWebhookConfigurations(); err != nil {
+				m.Logger.Errorf("Failed removing the webhook configurations: %s", err.Error())
+			}
+		}
+
+		close(m.stopChannel)
+		if m.watcher != nil {
+			m.watcher.Stop()
+		}
+		m.waitStopped()
+
+		if cleanup {
+			if err := m.removeNamespaceLabels(); err != nil {
+				m.Logger.Errorf("Failed removing the namespace labels: %s", err.Error())
+			}
+		}
+	})
+}
+
+// unregisterWebhookConfigurations deletes the webhook configurations registered by the Manager
+func (m *DefaultExtensionManager) unregisterWebhookConfigurations() error {
+	if !m.webhooksConfigured {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	m.failurePolicyMu.Lock()
+	defer m.failurePolicyMu.Unlock()
+
+	if err := m.WebhookConfig.unregisterWebhooks(ctx); err != nil {
+		return err
+	}
+	for _, g := range m.webhookGroups {
+		if err := g.config.unregisterWebhooks(ctx); err != nil {
+			return errors.Wrapf(err, "removing the webhook configuration of the group %s", g.Name)
+		}
+	}
+	m.webhooksConfigured = false
+	m.Logger.Info("Removed the webhook configurations")
+	return nil
+}
+
+// removeNamespaceLabels removes the operator namespace label from the watched namespaces, see labelNamespaces
+func (m *DefaultExtensionManager) removeNamespaceLabels() error {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	c := m.KubeManager.GetClient()
+	label := m.Options.getDefaultNamespaceLabel()
+	for _, namespace := range m.Options.WatchedNamespaces() {
+		ns := &unstructured.Unstructured{}
+		ns.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"})
+		if err := c.Get(ctx, machinerytypes.NamespacedName{Name: namespace}, ns); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return errors.Wrapf(err, "getting the namespace %s", namespace)
+			}
+			continue
+		}
+
+		labels := ns.GetLabels()
+		if _, ok := labels[label]; !ok {
+			continue
+		}
+		delete(labels, label)
+		ns.SetLabels(labels)
+		if err := c.Update(ctx, ns); err != nil {
+			return errors.Wrapf(err, "removing the operator namespace label of %s", namespace)
+		}
+	}
+	return nil
+}
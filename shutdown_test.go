@@ -0,0 +1,127 @@
+package extension_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Shutdown", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		client        *cfakes.FakeClient
+		deleted       []runtime.Object
+		labels        []map[string]string
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.Context = catalog.NewContext()
+		eiriniManager.Options.CleanupOnStop = true
+		eiriniManager.Options.SetupCertificateName = "test-shutdown-setupcert"
+		eiriniManager.Credsgen = NewCredentialGenerator()
+
+		client = &cfakes.FakeClient{}
+		deleted, labels = nil, nil
+		client.GetCalls(func(_ context.Context, _ crc.ObjectKey, object runtime.Object) error {
+			if u, ok := object.(*unstructured.Unstructured); ok && u.GetKind() == "Namespace" {
+				u.SetLabels(map[string]string{"eirini-x-ns": "namespace", "team": "apps"})
+			}
+			return nil
+		})
+		client.UpdateCalls(func(_ context.Context, object runtime.Object, _ ...crc.UpdateOption) error {
+			labels = append(labels, object.(*unstructured.Unstructured).GetLabels())
+			return nil
+		})
+		kubeManager := &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+		eiriniManager.KubeManager = kubeManager
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Join(os.TempDir(), eiriniManager.Options.SetupCertificateName))
+	})
+
+	It("removes the webhook configuration and the namespace labels", func() {
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		client.DeleteCalls(func(_ context.Context, object runtime.Object, _ ...crc.DeleteOption) error {
+			deleted = append(deleted, object)
+			return nil
+		})
+
+		eiriniManager.Stop()
+		Expect(deleted).To(HaveLen(1))
+		Expect(deleted[0].(*admissionregistrationv1beta1.MutatingWebhookConfiguration).Name).To(Equal(eiriniManager.WebhookConfig.ConfigName))
+		Expect(labels[len(labels)-1]).To(Equal(map[string]string{"team": "apps"}))
+
+		// Stopping again is a no-op
+		eiriniManager.Stop()
+		Expect(deleted).To(HaveLen(1))
+	})
+
+	It("removes the validating webhook configuration it registered", func() {
+		Expect(eiriniManager.AddExtension(&policyExtension{})).To(Succeed())
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		client.DeleteCalls(func(_ context.Context, object runtime.Object, _ ...crc.DeleteOption) error {
+			deleted = append(deleted, object)
+			return nil
+		})
+
+		eiriniManager.Stop()
+		Expect(deleted).To(HaveLen(2))
+		Expect(deleted[1].(*admissionregistrationv1beta1.ValidatingWebhookConfiguration).Name).To(Equal(eiriniManager.WebhookConfig.ValidatingConfigName))
+	})
+
+	It("keeps the webhook configuration registered by another binary", func() {
+		disabled := false
+		eiriniManager.Options.RegisterWebHook = &disabled
+		Expect(eiriniManager.OperatorSetup()).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		eiriniManager.Stop()
+		Expect(client.DeleteCallCount()).To(Equal(0))
+	})
+
+	It("returns the error of Start once stopped", func() {
+		m, err := NewManager(ManagerOptions{Namespace: "eirini", KubeConfig: "/nonexistent/kubeconfig"})
+		Expect(err).ToNot(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		Expect(m.StartContext(ctx)).ToNot(Succeed())
+		m.Stop()
+	})
+
+	It("stops the Manager once Start returns, like StartContext", func() {
+		m, err := NewManager(ManagerOptions{Namespace: "eirini", KubeConfig: "/nonexistent/kubeconfig"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(m.Start()).ToNot(Succeed())
+		stopped := make(chan struct{})
+		go func() {
+			m.Stop()
+			close(stopped)
+		}()
+		Eventually(stopped).Should(BeClosed())
+	})
+
+	It("is not supported with leader election", func() {
+		opts := ManagerOptions{Namespace: "eirini", EnableLeaderElection: true, CleanupOnStop: true}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("cleanupOnStop: Forbidden"))
+	})
+})
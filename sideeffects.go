@@ -0,0 +1,127 @@
+package extension
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const sideEffectMaxRetries = 5
+
+// SideEffect is a unit of work triggered by an admission request, which is executed
+// asynchronously so that it doesn't delay the admission response.
+type SideEffect func(ctx context.Context) error
+
+type sideEffectEntry struct {
+	effect     SideEffect
+	generation int64
+}
+
+// dryRunManager is the Manager handed to the extensions for the dry-run requests: the API server only sends
+// them to the webhooks without side effects on dry-run, so the side effects enqueued for them are dropped.
+type dryRunManager struct {
+	Manager
+}
+
+// EnqueueSideEffect drops the side effect
+func (m dryRunManager) EnqueueSideEffect(key string, _ SideEffect) {
+	if m.GetLogger() != nil {
+		m.GetLogger().Debugf("Skipping side effect '%s' of a dry-run request", key)
+	}
+}
+
+// extensionManager returns the Manager to hand to the extension for the request
+func (w *DefaultMutatingWebhook) extensionManager(req admission.Request) Manager {
+	if w.EiriniExtensionManager == nil || req.DryRun == nil || !*req.DryRun {
+		return w.EiriniExtensionManager
+	}
+	return dryRunManager{w.EiriniExtensionManager}
+}
+
+// sideEffectQueue runs the enqueued side effects with retries. Side effects are
+// deduplicated by key: if a key is enqueued again before being processed, only the
+// latest side effect runs.
+type sideEffectQueue struct {
+	queue  workqueue.RateLimitingInterface
+	logger *zap.SugaredLogger
+
+	mu         sync.Mutex
+	effects    map[string]sideEffectEntry
+	generation int64
+}
+
+func newSideEffectQueue(logger *zap.SugaredLogger) *sideEffectQueue {
+	return &sideEffectQueue{
+		queue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "eirinix-side-effects"),
+		logger:  logger,
+		effects: map[string]sideEffectEntry{},
+	}
+}
+
+func (q *sideEffectQueue) add(key string, effect SideEffect) {
+	q.mu.Lock()
+	q.generation++
+	q.effects[key] = sideEffectEntry{effect: effect, generation: q.generation}
+	q.mu.Unlock()
+
+	q.queue.Add(key)
+}
+
+// NeedLeaderElection makes side effects run on every replica, as they are triggered by the
+// admission requests served by that replica
+func (q *sideEffectQueue) NeedLeaderElection() bool {
+	return false
+}
+
+// Start processes the queue until the stop channel is closed
+func (q *sideEffectQueue) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-stop
+		cancel()
+		q.queue.ShutDown()
+	}()
+
+	for q.processNext(ctx) {
+	}
+	return nil
+}
+
+func (q *sideEffectQueue) processNext(ctx context.Context) bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+
+	key := item.(string)
+	q.mu.Lock()
+	entry, ok := q.effects[key]
+	q.mu.Unlock()
+	if !ok {
+		q.queue.Forget(item)
+		return true
+	}
+
+	if err := entry.effect(ctx); err != nil {
+		if q.queue.NumRequeues(item) < sideEffectMaxRetries {
+			q.logger.Debugf("Side effect '%s' failed, retrying: %s", key, err.Error())
+			q.queue.AddRateLimited(item)
+			return true
+		}
+		q.logger.Errorf("Side effect '%s' failed, giving up: %s", key, err.Error())
+	}
+
+	q.queue.Forget(item)
+	q.mu.Lock()
+	if current, ok := q.effects[key]; ok && current.generation == entry.generation {
+		delete(q.effects, key)
+	}
+	q.mu.Unlock()
+	return true
+}
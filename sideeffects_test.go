@@ -0,0 +1,49 @@
+package extension_test
+
+import (
+	"context"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// sideEffectExtension enqueues a side effect for every pod
+type sideEffectExtension struct{}
+
+func (e *sideEffectExtension) Handle(_ context.Context, m Manager, pod *corev1.Pod, _ admission.Request) admission.Response {
+	m.EnqueueSideEffect("side-effect/"+pod.Name, func(context.Context) error { return nil })
+	return admission.Allowed("")
+}
+
+// sideEffectRecorder records the keys of the side effects enqueued to the Manager
+type sideEffectRecorder struct {
+	Manager
+	keys []string
+}
+
+func (m *sideEffectRecorder) EnqueueSideEffect(key string, _ SideEffect) {
+	m.keys = append(m.keys, key)
+}
+
+var _ = Describe("Side effects", func() {
+	It("drops the side effects of the dry-run requests", func() {
+		c := catalog.NewCatalog()
+		recorder := &sideEffectRecorder{Manager: c.SimpleManager()}
+		w := NewWebhook(&sideEffectExtension{}, recorder)
+		injectDecoder(w)
+
+		req := podRequest()
+		dryRun := true
+		req.DryRun = &dryRun
+		Expect(w.Handle(context.Background(), req).Allowed).To(BeTrue())
+		Expect(recorder.keys).To(BeEmpty())
+
+		dryRun = false
+		Expect(w.Handle(context.Background(), req).Allowed).To(BeTrue())
+		Expect(recorder.keys).To(Equal([]string{"side-effect/app-0"}))
+	})
+})
@@ -0,0 +1,255 @@
+package extension
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// SLIAvailability is the ratio of the admission requests which didn't error
+	SLIAvailability = "availability"
+	// SLILatency is the ratio of the admission requests served within the latency threshold
+	SLILatency = "latency"
+
+	defaultAvailabilityObjective = 0.999
+	defaultLatencyObjective      = 0.99
+	defaultLatencyThreshold      = 500 * time.Millisecond
+
+	// sloBucketWidth is the resolution of the rolling windows
+	sloBucketWidth = 10 * time.Second
+	// sloReportInterval is the interval between the updates of the SLO metrics
+	sloReportInterval = 15 * time.Second
+)
+
+// defaultSLOWindows are the windows of the multiwindow burn rate alerts: 5m and 1h for the fast burns,
+// 30m and 6h for the slow ones
+var defaultSLOWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+// SLOOptions enable the service level objectives of the webhooks. The Manager computes the availability and
+// latency SLIs of each extension over rolling windows, and exports them with their error budget burn rates as
+// the eirinix_slo_* metrics, to alert on the burn rates and decide when to switch the failure policy (see
+// Manager.SetFailurePolicy) or roll an extension back.
+type SLOOptions struct {
+	// AvailabilityObjective is the target ratio of admission requests which don't error, e.g. 0.999.
+	// Optional, defaults to 0.999
+	AvailabilityObjective float64
+
+	// LatencyObjective is the target ratio of admission requests served within LatencyThreshold, e.g. 0.99.
+	// Optional, defaults to 0.99
+	LatencyObjective float64
+
+	// LatencyThreshold is the latency above which an admission request is slow. Optional, defaults to 500ms
+	LatencyThreshold time.Duration
+
+	// Windows are the rolling windows the SLIs are computed over, at least one minute long. Optional, defaults
+	// to 5m, 30m, 1h and 6h
+	Windows []time.Duration
+}
+
+func (o *SLOOptions) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if o.AvailabilityObjective < 0 || o.AvailabilityObjective >= 1 {
+		errs = append(errs, field.Invalid(path.Child("availabilityObjective"), o.AvailabilityObjective, "must be between 0 and 1, excluded"))
+	}
+	if o.LatencyObjective < 0 || o.LatencyObjective >= 1 {
+		errs = append(errs, field.Invalid(path.Child("latencyObjective"), o.LatencyObjective, "must be between 0 and 1, excluded"))
+	}
+	if o.LatencyThreshold < 0 {
+		errs = append(errs, field.Invalid(path.Child("latencyThreshold"), o.LatencyThreshold.String(), "must not be negative"))
+	}
+	for i, w := range o.Windows {
+		if w < time.Minute {
+			errs = append(errs, field.Invalid(path.Child("windows").Index(i), w.String(), "must be at least one minute"))
+		}
+	}
+	return errs
+}
+
+func (o SLOOptions) withDefaults() SLOOptions {
+	if o.AvailabilityObjective == 0 {
+		o.AvailabilityObjective = defaultAvailabilityObjective
+	}
+	if o.LatencyObjective == 0 {
+		o.LatencyObjective = defaultLatencyObjective
+	}
+	if o.LatencyThreshold == 0 {
+		o.LatencyThreshold = defaultLatencyThreshold
+	}
+	if len(o.Windows) == 0 {
+		o.Windows = defaultSLOWindows
+	}
+	return o
+}
+
+// SLIReport is the value of an SLI of an extension over a window
+type SLIReport struct {
+	Extension string `json:"extension"`
+	// SLI is SLIAvailability or SLILatency
+	SLI    string        `json:"sli"`
+	Window time.Duration `json:"window"`
+	// Requests is the number of admission requests in the window
+	Requests int64 `json:"requests"`
+	// Ratio is the ratio of good requests, 1 without requests
+	Ratio float64 `json:"ratio"`
+	// Objective is the target ratio
+	Objective float64 `json:"objective"`
+	// BurnRate is the rate the error budget is consumed at: 1 consumes exactly the budget over the SLO period
+	BurnRate float64 `json:"burnRate"`
+}
+
+// sloBucket counts the requests of an extension during sloBucketWidth
+type sloBucket struct {
+	index             int64
+	total, errs, slow int64
+}
+
+// sloTracker keeps the admission results of the extensions in rings of buckets covering the longest window
+type sloTracker struct {
+	options SLOOptions
+
+	mu      sync.Mutex
+	buckets map[string][]sloBucket
+}
+
+func newSLOTracker(opts SLOOptions) *sloTracker {
+	return &sloTracker{options: opts.withDefaults(), buckets: map[string][]sloBucket{}}
+}
+
+func (t *sloTracker) ringSize() int {
+	longest := time.Duration(0)
+	for _, w := range t.options.Windows {
+		if w > longest {
+			longest = w
+		}
+	}
+	return int(longest/sloBucketWidth) + 1
+}
+
+// record counts the response of an extension
+func (t *sloTracker) record(extension string, res admission.Response, latency time.Duration, now time.Time) {
+	if t == nil {
+		return
+	}
+	index := now.UnixNano() / int64(sloBucketWidth)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ring, ok := t.buckets[extension]
+	if !ok {
+		ring = make([]sloBucket, t.ringSize())
+		t.buckets[extension] = ring
+	}
+	b := &ring[index%int64(len(ring))]
+	if b.index != index {
+		*b = sloBucket{index: index}
+	}
+	b.total++
+	if admissionResult(res) == "errored" {
+		b.errs++
+	}
+	if latency > t.options.LatencyThreshold {
+		b.slow++
+	}
+}
+
+// report returns the SLIs of the extensions over each window, sorted by extension
+func (t *sloTracker) report(now time.Time) []SLIReport {
+	if t == nil {
+		return nil
+	}
+	current := now.UnixNano() / int64(sloBucketWidth)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	extensions := make([]string, 0, len(t.buckets))
+	for e := range t.buckets {
+		extensions = append(extensions, e)
+	}
+	sort.Strings(extensions)
+
+	var reports []SLIReport
+	for _, e := range extensions {
+		for _, w := range t.options.Windows {
+			oldest := current - int64(w/sloBucketWidth) + 1
+			var total, errs, slow int64
+			for _, b := range t.buckets[e] {
+				if b.index >= oldest && b.index <= current {
+					total, errs, slow = total+b.total, errs+b.errs, slow+b.slow
+				}
+			}
+			reports = append(reports,
+				newSLIReport(e, SLIAvailability, w, total, errs, t.options.AvailabilityObjective),
+				newSLIReport(e, SLILatency, w, total, slow, t.options.LatencyObjective))
+		}
+	}
+	return reports
+}
+
+func newSLIReport(extension, sli string, window time.Duration, total, bad int64, objective float64) SLIReport {
+	r := SLIReport{Extension: extension, SLI: sli, Window: window, Requests: total, Ratio: 1, Objective: objective}
+	if total > 0 {
+		r.Ratio = float64(total-bad) / float64(total)
+		r.BurnRate = (1 - r.Ratio) / (1 - objective)
+	}
+	return r
+}
+
+// windowLabel formats a window as in the prometheus range selectors, e.g. 5m or 6h
+func windowLabel(w time.Duration) string {
+	switch {
+	case w%time.Hour == 0:
+		return strconv.FormatInt(int64(w/time.Hour), 10) + "h"
+	case w%time.Minute == 0:
+		return strconv.FormatInt(int64(w/time.Minute), 10) + "m"
+	default:
+		return strconv.FormatInt(int64(w/time.Second), 10) + "s"
+	}
+}
+
+// sloReporter updates the SLO metrics periodically
+type sloReporter struct {
+	tracker *sloTracker
+	logger  *zap.SugaredLogger
+}
+
+// NeedLeaderElection makes every replica report the SLIs of the requests it served
+func (r *sloReporter) NeedLeaderElection() bool {
+	return false
+}
+
+// Start updates the metrics until the stop channel is closed
+func (r *sloReporter) Start(stop <-chan struct{}) error {
+	sloObjective.WithLabelValues(SLIAvailability).Set(r.tracker.options.AvailabilityObjective)
+	sloObjective.WithLabelValues(SLILatency).Set(r.tracker.options.LatencyObjective)
+
+	ticker := time.NewTicker(sloReportInterval)
+	defer ticker.Stop()
+	for {
+		r.update(time.Now())
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *sloReporter) update(now time.Time) {
+	for _, report := range r.tracker.report(now) {
+		window := windowLabel(report.Window)
+		sloRatio.WithLabelValues(report.Extension, report.SLI, window).Set(report.Ratio)
+		sloBurnRate.WithLabelValues(report.Extension, report.SLI, window).Set(report.BurnRate)
+	}
+}
+
+// SLOs returns the SLIs of the extensions over the windows of ManagerOptions.SLO, as served by the replica,
+// or nil if SLO is not set
+func (m *DefaultExtensionManager) SLOs() []SLIReport {
+	return m.slo.report(time.Now())
+}
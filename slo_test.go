@@ -0,0 +1,75 @@
+package extension_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var _ = Describe("SLOs", func() {
+	var eiriniManager *DefaultExtensionManager
+
+	BeforeEach(func() {
+		registerWebhooks := false
+		m, err := NewManager(ManagerOptions{
+			Namespace:       "eirini",
+			Host:            "127.0.0.1",
+			Port:            4545,
+			RegisterWebHook: &registerWebhooks,
+			// No decoder is injected, so the webhooks error
+			DecodeErrorPolicy: DecodeErrorDeny,
+			SLO:               &SLOOptions{AvailabilityObjective: 0.99, Windows: []time.Duration{5 * time.Minute}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		eiriniManager = m.(*DefaultExtensionManager)
+		eiriniManager.KubeManager = &cfakes.FakeManager{}
+		eiriniManager.WebhookServer = &webhook.Server{}
+	})
+
+	It("reports the SLIs and burn rates of the extensions", func() {
+		Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(eiriniManager.SLOs()).To(BeEmpty())
+
+		// No decoder is injected, so the webhook errors
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/0", bytes.NewReader(reviewBody()))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			eiriniManager.WebhookServer.WebhookMux.ServeHTTP(rec, req)
+			Expect(rec.Body.String()).To(ContainSubstring("No decoder injected"))
+		}
+
+		slos := eiriniManager.SLOs()
+		Expect(slos).To(HaveLen(2))
+		Expect(slos[0].Extension).To(Equal("*testing.EditEnvExtension"))
+		Expect(slos[0].SLI).To(Equal(SLIAvailability))
+		Expect(slos[0].Window).To(Equal(5 * time.Minute))
+		Expect(slos[0].Requests).To(Equal(int64(2)))
+		Expect(slos[0].Ratio).To(Equal(0.0))
+		Expect(slos[0].BurnRate).To(BeNumerically("~", 100))
+
+		Expect(slos[1].SLI).To(Equal(SLILatency))
+		Expect(slos[1].Ratio).To(Equal(1.0))
+		Expect(slos[1].BurnRate).To(Equal(0.0))
+		Expect(eiriniManager.Status().SLOs).To(HaveLen(2))
+	})
+
+	It("rejects invalid objectives", func() {
+		opts := ManagerOptions{Namespace: "eirini", Host: "127.0.0.1", Port: 4545, SLO: &SLOOptions{
+			AvailabilityObjective: 1,
+			Windows:               []time.Duration{time.Second},
+		}}
+		err := opts.Validate()
+		Expect(err).To(MatchError(ContainSubstring("slo.availabilityObjective")))
+		Expect(err).To(MatchError(ContainSubstring("slo.windows[0]")))
+	})
+})
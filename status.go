@@ -0,0 +1,108 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Status is a snapshot of the Manager state, served as JSON on the status endpoint
+type Status struct {
+	// OperatorFingerprint is the fingerprint of the Manager
+	OperatorFingerprint string `json:"operatorFingerprint"`
+
+	// Extensions, Watchers and Reconcilers are the names of the registered extensions
+	Extensions  []string `json:"extensions"`
+	Watchers    []string `json:"watchers"`
+	Reconcilers []string `json:"reconcilers"`
+
+	// ConfigSchema is the schema of the extensions configuration, see ConfigurableExtension
+	ConfigSchema *ConfigSchema `json:"configSchema,omitempty"`
+
+	// SLOs are the SLIs of the extensions, see ManagerOptions.SLO
+	SLOs []SLIReport `json:"slos,omitempty"`
+
+	// Metadata describes the extensions, see Manager.Describe
+	Metadata []ExtensionMetadata `json:"metadata"`
+}
+
+// Status returns the current status of the Manager
+func (m *DefaultExtensionManager) Status() Status {
+	status := Status{
+		OperatorFingerprint: m.Options.OperatorFingerprint,
+		Extensions:          []string{},
+		Watchers:            []string{},
+		Reconcilers:         []string{},
+		ConfigSchema:        m.ConfigSchema(),
+		SLOs:                m.SLOs(),
+		Metadata:            m.Describe(),
+	}
+	for _, e := range m.Extensions {
+		status.Extensions = append(status.Extensions, extensionName(e))
+	}
+	for _, w := range m.Watchers {
+		status.Watchers = append(status.Watchers, extensionName(w))
+	}
+	for _, r := range m.Reconcilers {
+		status.Reconcilers = append(status.Reconcilers, extensionName(r))
+	}
+	return status
+}
+
+// StatusHandler returns an http.Handler serving the Manager status
+func (m *DefaultExtensionManager) StatusHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(m.Status()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc(readyPath, m.readyHandler)
+	mux.HandleFunc(MutationsPath, m.mutationsHandler)
+	if m.handover != nil {
+		mux.HandleFunc(handoverPreStopPath, m.handover.preStopHandler)
+	}
+	if m.Options.Exemplars {
+		mux.Handle(exemplarMetricsPath, exemplarMetricsHandler())
+	}
+	return mux
+}
+
+// statusServer serves the status endpoint over plain HTTP
+type statusServer struct {
+	addr    string
+	handler http.Handler
+	logger  *zap.SugaredLogger
+}
+
+// NeedLeaderElection makes every replica serve its own status
+func (s *statusServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves the status endpoint until the stop channel is closed
+func (s *statusServer) Start(stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return errors.Wrap(err, "starting the status server listener")
+	}
+
+	srv := &http.Server{Handler: s.handler}
+	go func() {
+		<-stop
+		if err := srv.Shutdown(context.Background()); err != nil {
+			s.logger.Errorf("Failed shutting down the status server: %s", err.Error())
+		}
+	}()
+
+	s.logger.Infof("Serving the status on %s", listener.Addr().String())
+	if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
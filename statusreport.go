@@ -0,0 +1,265 @@
+package extension
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	statusResource       = "eirinixstatuses"
+	statusReportInterval = 30 * time.Second
+
+	// ConditionRegistered is true once the extension is loaded into the Manager
+	ConditionRegistered = "Registered"
+	// ConditionCertReady is true while the webhook server certificate is valid
+	ConditionCertReady = "CertReady"
+	// ConditionWebhookConfigured is true once the MutatingWebhookConfiguration of the extension is registered
+	ConditionWebhookConfigured = "WebhookConfigured"
+	// ConditionDegraded is true while the Manager reports not ready, see AddReadyCheck
+	ConditionDegraded = "Degraded"
+)
+
+var statusGVK = schema.GroupVersionKind{Group: ledgerGroup, Version: "v1alpha1", Kind: "EirinixStatus"}
+
+// StatusCRD is the manifest of the EirinixStatus CustomResourceDefinition, installed by the Manager with ReportStatus
+const StatusCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: eirinixstatuses.eirinix.cloudfoundry.org
+spec:
+  group: eirinix.cloudfoundry.org
+  scope: Namespaced
+  names:
+    kind: EirinixStatus
+    listKind: EirinixStatusList
+    plural: eirinixstatuses
+    singular: eirinixstatus
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    additionalPrinterColumns:
+    - name: Ready
+      type: boolean
+      jsonPath: .status.ready
+    - name: Version
+      type: string
+      jsonPath: .status.version
+    - name: Updated
+      type: date
+      jsonPath: .status.updated
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          status:
+            type: object
+            x-kubernetes-preserve-unknown-fields: true
+`
+
+// extensionRef is an extension, watcher or reconciler loaded into the Manager
+type extensionRef struct {
+	name      string
+	kind      string
+	extension interface{}
+}
+
+func (m *DefaultExtensionManager) extensionRefs() []extensionRef {
+	var refs []extensionRef
+	for _, e := range m.Extensions {
+		refs = append(refs, extensionRef{name: extensionName(e), kind: "extension", extension: e})
+	}
+	for _, w := range m.Watchers {
+		refs = append(refs, extensionRef{name: extensionName(w), kind: "watcher", extension: w})
+	}
+	for _, r := range m.Reconcilers {
+		refs = append(refs, extensionRef{name: extensionName(r), kind: "reconciler", extension: r})
+	}
+	return refs
+}
+
+func condition(conditionType string, status bool, reason, message string) map[string]interface{} {
+	s := "False"
+	if status {
+		s = "True"
+	}
+	return map[string]interface{}{"type": conditionType, "status": s, "reason": reason, "message": message}
+}
+
+func unknownCondition(conditionType, reason string) map[string]interface{} {
+	return map[string]interface{}{"type": conditionType, "status": "Unknown", "reason": reason, "message": ""}
+}
+
+// managerConditions returns the conditions shared by all the webhook extensions, and the Degraded condition
+func (m *DefaultExtensionManager) managerConditions(ctx context.Context) (cert, webhook, degraded map[string]interface{}) {
+	if m.Options.SetupCertificate != nil && !*m.Options.SetupCertificate {
+		cert = unknownCondition(ConditionCertReady, "NotManaged")
+	} else if m.WebhookConfig == nil {
+		cert = unknownCondition(ConditionCertReady, "Pending")
+	} else if expiry, err := m.WebhookConfig.certificateExpiry(); err != nil {
+		cert = condition(ConditionCertReady, false, "NotFound", err.Error())
+	} else if time.Now().After(expiry) {
+		cert = condition(ConditionCertReady, false, "Expired", "expired at "+expiry.UTC().Format(time.RFC3339))
+	} else {
+		cert = condition(ConditionCertReady, true, "Valid", "expires at "+expiry.UTC().Format(time.RFC3339))
+	}
+
+	switch {
+	case m.Options.RegisterWebHook != nil && !*m.Options.RegisterWebHook:
+		webhook = unknownCondition(ConditionWebhookConfigured, "NotManaged")
+	case m.webhooksConfigured:
+		webhook = condition(ConditionWebhookConfigured, true, "Registered", "")
+	default:
+		webhook = condition(ConditionWebhookConfigured, false, "Pending", "")
+	}
+
+	if err := m.ready(ctx); err != nil {
+		degraded = condition(ConditionDegraded, true, "NotReady", err.Error())
+	} else {
+		degraded = condition(ConditionDegraded, false, "Ready", "")
+	}
+	return cert, webhook, degraded
+}
+
+// keepTransitionTimes sets the lastTransitionTime of the conditions, keeping the previous one of the
+// conditions whose status didn't change
+func keepTransitionTimes(conditions []interface{}, previous []interface{}, now string) {
+	for _, c := range conditions {
+		cond := c.(map[string]interface{})
+		cond["lastTransitionTime"] = now
+		for _, p := range previous {
+			prev, ok := p.(map[string]interface{})
+			if ok && prev["type"] == cond["type"] && prev["status"] == cond["status"] && prev["lastTransitionTime"] != nil {
+				cond["lastTransitionTime"] = prev["lastTransitionTime"]
+			}
+		}
+	}
+}
+
+// desiredStatus returns the status of the EirinixStatus, given the previous one
+func (m *DefaultExtensionManager) desiredStatus(ctx context.Context, previous map[string]interface{}) map[string]interface{} {
+	now := time.Now().UTC().Format(time.RFC3339)
+	cert, webhook, degraded := m.managerConditions(ctx)
+
+	previousConditions := map[string][]interface{}{}
+	if list, ok := previous["extensions"].([]interface{}); ok {
+		for _, e := range list {
+			if ext, ok := e.(map[string]interface{}); ok {
+				name, _ := ext["name"].(string)
+				previousConditions[name], _ = ext["conditions"].([]interface{})
+			}
+		}
+	}
+
+	extensions := []interface{}{}
+	for _, ref := range m.extensionRefs() {
+		conditions := []interface{}{condition(ConditionRegistered, m.extensionsLoaded, "Loaded", "")}
+		if ref.kind == "extension" {
+			conditions = append(conditions, copyCondition(cert), copyCondition(webhook))
+		}
+		conditions = append(conditions, copyCondition(degraded))
+		keepTransitionTimes(conditions, previousConditions[ref.name], now)
+		extensions = append(extensions, map[string]interface{}{
+			"name":       ref.name,
+			"kind":       ref.kind,
+			"conditions": conditions,
+		})
+	}
+
+	status := map[string]interface{}{
+		"ready":      degraded["status"] == "False",
+		"version":    Version(),
+		"extensions": extensions,
+		"updated":    previous["updated"],
+	}
+	if !reflect.DeepEqual(previous["extensions"], extensions) || previous["ready"] != status["ready"] || previous["version"] != status["version"] {
+		status["updated"] = now
+	}
+	return status
+}
+
+func copyCondition(c map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(c))
+	for k, v := range c {
+		copied[k] = v
+	}
+	return copied
+}
+
+// reportStatus creates or updates the EirinixStatus of the Manager, named after the OperatorFingerprint
+func (m *DefaultExtensionManager) reportStatus(ctx context.Context) error {
+	c := m.KubeManager.GetClient()
+	namespace := m.Options.WebhookNamespace
+	if namespace == "" {
+		namespace = m.Options.Namespace
+	}
+	key := machinerytypes.NamespacedName{Name: m.Options.OperatorFingerprint, Namespace: namespace}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(statusGVK)
+	err := c.Get(ctx, key, obj)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "getting the eirinix status")
+	}
+	create := apierrors.IsNotFound(err)
+	if create {
+		obj = &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetGroupVersionKind(statusGVK)
+		obj.SetName(key.Name)
+		obj.SetNamespace(key.Namespace)
+		obj.SetLabels(map[string]string{LabelManagedBy: m.Options.OperatorFingerprint})
+	}
+
+	previous, _, _ := unstructured.NestedMap(obj.Object, "status")
+	if previous == nil {
+		previous = map[string]interface{}{}
+	}
+	status := m.desiredStatus(ctx, previous)
+
+	if create {
+		obj.Object["status"] = status
+		return errors.Wrap(c.Create(ctx, obj), "creating the eirinix status")
+	}
+	if reflect.DeepEqual(previous, status) {
+		return nil
+	}
+	obj.Object["status"] = status
+	return errors.Wrap(c.Update(ctx, obj), "updating the eirinix status")
+}
+
+// statusReporter periodically reports the status of the Manager in its EirinixStatus
+type statusReporter struct {
+	manager *DefaultExtensionManager
+	logger  *zap.SugaredLogger
+}
+
+// NeedLeaderElection makes the reporter run on the leader only
+func (r *statusReporter) NeedLeaderElection() bool {
+	return true
+}
+
+// Start reports the status until the stop channel is closed
+func (r *statusReporter) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	wait.Until(func() {
+		if err := r.manager.reportStatus(ctx); err != nil {
+			r.logger.Errorf("Reporting the eirinix status: %s", err.Error())
+		}
+	}, statusReportInterval, stop)
+	return nil
+}
@@ -0,0 +1,91 @@
+package extension_test
+
+import (
+	"fmt"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var _ = Describe("Status report", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+		store         map[string]*unstructured.Unstructured
+	)
+
+	BeforeEach(func() {
+		client := &cfakes.FakeClient{}
+		store = fakeLedgerStore(client)
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		eiriniManager.KubeManager = kubeManager
+		eiriniManager.WebhookServer = &webhook.Server{}
+		disabled := false
+		eiriniManager.Options.RegisterWebHook = &disabled
+		eiriniManager.Options.SetupCertificate = &disabled
+		eiriniManager.Options.WebhookNamespace = "default"
+		eiriniManager.Options.ReportStatus = true
+	})
+
+	reporter := func() manager.Runnable {
+		for i := 0; i < kubeManager.AddCallCount(); i++ {
+			if r := kubeManager.AddArgsForCall(i); fmt.Sprintf("%T", r) == "*extension.statusReporter" {
+				return r
+			}
+		}
+		return nil
+	}
+
+	conditions := func(status map[string]interface{}) map[string]string {
+		byType := map[string]string{}
+		ext := status["extensions"].([]interface{})[0].(map[string]interface{})
+		for _, c := range ext["conditions"].([]interface{}) {
+			cond := c.(map[string]interface{})
+			byType[cond["type"].(string)] = cond["status"].(string)
+		}
+		return byType
+	}
+
+	It("reports the conditions of the extensions", func() {
+		Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		r := reporter()
+		Expect(r).ToNot(BeNil())
+
+		stop := make(chan struct{})
+		go r.Start(stop) // nolint:errcheck
+		defer close(stop)
+		Eventually(func() int { return len(store) }).Should(Equal(1))
+
+		obj := store["default/eirini-x"]
+		Expect(obj).ToNot(BeNil())
+		Expect(obj.GetKind()).To(Equal("EirinixStatus"))
+		status := obj.Object["status"].(map[string]interface{})
+		Expect(status["ready"]).To(BeTrue())
+		Expect(conditions(status)).To(Equal(map[string]string{
+			ConditionRegistered:        "True",
+			ConditionCertReady:         "Unknown",
+			ConditionWebhookConfigured: "Unknown",
+			ConditionDegraded:          "False",
+		}))
+	})
+
+	It("declares the permissions to report the status", func() {
+		Expect(eiriniManager.RequiredPermissions()).To(ContainElement(rbacv1.PolicyRule{
+			APIGroups: []string{"eirinix.cloudfoundry.org"},
+			Resources: []string{"eirinixstatuses"},
+			Verbs:     []string{"create", "get", "update"},
+		}))
+	})
+})
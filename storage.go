@@ -0,0 +1,322 @@
+package extension
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	machinerytypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// LabelStorage is set on the StorageObjects, to the prefix of the storage
+	LabelStorage = "eirinix.cloudfoundry.org/storage"
+
+	storageResource = "storageobjects"
+	// maxStorageObjectSize keeps the StorageObjects under the 1.5MiB limit of the etcd values, once base64 encoded
+	maxStorageObjectSize = 1000 * 1000
+)
+
+var (
+	// ErrStorageObjectNotFound is returned by Storage.Get for the objects which don't exist
+	ErrStorageObjectNotFound = errors.New("The object doesn't exist in the storage")
+	// ErrStorageObjectExists is returned by Storage.Create for the objects which already exist
+	ErrStorageObjectExists = errors.New("The object already exists in the storage")
+)
+
+var storageObjectGVK = schema.GroupVersionKind{Group: ledgerGroup, Version: "v1alpha1", Kind: "StorageObject"}
+
+// StorageObjectCRD is the manifest of the StorageObject CustomResourceDefinition used by NewCRDStorage,
+// installed by the Manager with InstallStorageCRD
+const StorageObjectCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: storageobjects.eirinix.cloudfoundry.org
+spec:
+  group: eirinix.cloudfoundry.org
+  scope: Namespaced
+  names:
+    kind: StorageObject
+    listKind: StorageObjectList
+    plural: storageobjects
+    singular: storageobject
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          data:
+            type: string
+            format: byte
+`
+
+// Storage stores the operational data of the Manager: the recorded traffic (see RecordingWriter) and the
+// ledger of the one-time actions when ManagerOptions.Storage is set. The names of the objects are valid
+// object names, e.g. 00001601308800000000.jsonl.gz.
+//
+// NewFileStorage, NewCRDStorage and NewS3Storage store the objects in a directory (e.g. of a persistent
+// volume), in StorageObject custom resources and in an S3-compatible object storage.
+type Storage interface {
+	RecordingStorage
+
+	// Get returns the data of an object, or ErrStorageObjectNotFound
+	Get(ctx context.Context, name string) ([]byte, error)
+	// Create stores an object, or returns ErrStorageObjectExists if it already exists
+	Create(ctx context.Context, name string, data []byte) error
+}
+
+// IsStorageObjectNotFound returns true if the error is, or wraps, ErrStorageObjectNotFound
+func IsStorageObjectNotFound(err error) bool {
+	return errors.Cause(err) == ErrStorageObjectNotFound
+}
+
+// IsStorageObjectExists returns true if the error is, or wraps, ErrStorageObjectExists
+func IsStorageObjectExists(err error) bool {
+	return errors.Cause(err) == ErrStorageObjectExists
+}
+
+// NewSubStorage returns a Storage keeping its objects apart from the other ones of the storage, by prefixing
+// their names with <name>-
+func NewSubStorage(s Storage, name string) Storage {
+	return &subStorage{storage: s, prefix: name + "-"}
+}
+
+type subStorage struct {
+	storage Storage
+	prefix  string
+}
+
+func (s *subStorage) Put(ctx context.Context, name string, data []byte) error {
+	return s.storage.Put(ctx, s.prefix+name, data)
+}
+
+func (s *subStorage) Get(ctx context.Context, name string) ([]byte, error) {
+	return s.storage.Get(ctx, s.prefix+name)
+}
+
+func (s *subStorage) Create(ctx context.Context, name string, data []byte) error {
+	return s.storage.Create(ctx, s.prefix+name, data)
+}
+
+func (s *subStorage) List(ctx context.Context) ([]string, error) {
+	all, err := s.storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range all {
+		if strings.HasPrefix(name, s.prefix) {
+			names = append(names, strings.TrimPrefix(name, s.prefix))
+		}
+	}
+	return names, nil
+}
+
+func (s *subStorage) Delete(ctx context.Context, name string) error {
+	return s.storage.Delete(ctx, s.prefix+name)
+}
+
+// Storage returns the storage of ManagerOptions.Storage reserved to a subsystem, e.g. a recording, or nil if
+// no storage is set
+func (m *DefaultExtensionManager) Storage(name string) Storage {
+	if m.Options.Storage == nil {
+		return nil
+	}
+	return NewSubStorage(m.Options.Storage, name)
+}
+
+// NewFileStorage returns a Storage writing the objects as files of a directory, e.g. the mount point of a
+// persistent volume
+func NewFileStorage(fs afero.Fs, dir string) Storage {
+	return &fileStorage{fs: fs, dir: dir}
+}
+
+type fileStorage struct {
+	fs  afero.Fs
+	dir string
+}
+
+func (s *fileStorage) Put(_ context.Context, name string, data []byte) error {
+	if err := s.fs.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	return afero.WriteFile(s.fs, path.Join(s.dir, name), data, 0600)
+}
+
+func (s *fileStorage) Get(_ context.Context, name string) ([]byte, error) {
+	data, err := afero.ReadFile(s.fs, path.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrStorageObjectNotFound
+	}
+	return data, err
+}
+
+// Create relies on O_EXCL, so that only one replica sharing the volume creates the file
+func (s *fileStorage) Create(_ context.Context, name string, data []byte) error {
+	if err := s.fs.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	f, err := s.fs.OpenFile(path.Join(s.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return ErrStorageObjectExists
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *fileStorage) List(_ context.Context) ([]string, error) {
+	infos, err := afero.ReadDir(s.fs, s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *fileStorage) Delete(_ context.Context, name string) error {
+	err := s.fs.Remove(path.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// StoragePermissions returns the permissions needed by NewCRDStorage
+func StoragePermissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{{
+		APIGroups: []string{ledgerGroup},
+		Resources: []string{storageResource},
+		Verbs:     []string{"get", "list", "create", "update", "delete"},
+	}}
+}
+
+// NewCRDStorage returns a Storage writing each object in a StorageObject custom resource named
+// <prefix>-<object>. The objects must be smaller than 1MB, so the recordings should be compressed.
+func NewCRDStorage(c client.Client, namespace, prefix string) Storage {
+	return &crdStorage{client: c, namespace: namespace, prefix: prefix}
+}
+
+type crdStorage struct {
+	client            client.Client
+	namespace, prefix string
+}
+
+func (s *crdStorage) object(name string, data []byte) (*unstructured.Unstructured, error) {
+	if len(data) > maxStorageObjectSize {
+		return nil, errors.Errorf("The object is %d bytes, larger than the %d bytes a StorageObject can store", len(data), maxStorageObjectSize)
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetGroupVersionKind(storageObjectGVK)
+	obj.SetName(s.prefix + "-" + name)
+	obj.SetNamespace(s.namespace)
+	obj.SetLabels(map[string]string{LabelStorage: s.prefix})
+	if data != nil {
+		obj.Object["data"] = base64.StdEncoding.EncodeToString(data)
+	}
+	return obj, nil
+}
+
+func (s *crdStorage) Put(ctx context.Context, name string, data []byte) error {
+	obj, err := s.object(name, data)
+	if err != nil {
+		return err
+	}
+	err = s.client.Create(ctx, obj)
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(storageObjectGVK)
+	if err := s.client.Get(ctx, machinerytypes.NamespacedName{Namespace: s.namespace, Name: obj.GetName()}, existing); err != nil {
+		return err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	return s.client.Update(ctx, obj)
+}
+
+func (s *crdStorage) Get(ctx context.Context, name string) ([]byte, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(storageObjectGVK)
+	err := s.client.Get(ctx, machinerytypes.NamespacedName{Namespace: s.namespace, Name: s.prefix + "-" + name}, obj)
+	if apierrors.IsNotFound(err) {
+		return nil, ErrStorageObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return storageObjectData(obj)
+}
+
+func (s *crdStorage) Create(ctx context.Context, name string, data []byte) error {
+	obj, err := s.object(name, data)
+	if err != nil {
+		return err
+	}
+	err = s.client.Create(ctx, obj)
+	if apierrors.IsAlreadyExists(err) {
+		return ErrStorageObjectExists
+	}
+	return err
+}
+
+// List pages through the StorageObjects of the storage
+func (s *crdStorage) List(ctx context.Context) ([]string, error) {
+	var names []string
+	opts := []client.ListOption{
+		client.InNamespace(s.namespace),
+		client.MatchingLabels{LabelStorage: s.prefix},
+		client.Limit(recordingListPageSize),
+	}
+	for cont := ""; ; {
+		objects := &unstructured.UnstructuredList{}
+		objects.SetGroupVersionKind(storageObjectGVK.GroupVersion().WithKind("StorageObjectList"))
+		if err := s.client.List(ctx, objects, append(opts, client.Continue(cont))...); err != nil {
+			return nil, err
+		}
+		for _, obj := range objects.Items {
+			names = append(names, strings.TrimPrefix(obj.GetName(), s.prefix+"-"))
+		}
+		if cont = objects.GetContinue(); cont == "" {
+			return names, nil
+		}
+	}
+}
+
+func (s *crdStorage) Delete(ctx context.Context, name string) error {
+	obj, _ := s.object(name, nil)
+	return client.IgnoreNotFound(s.client.Delete(ctx, obj))
+}
+
+// storageObjectData decodes the base64 data of a StorageObject
+func storageObjectData(obj *unstructured.Unstructured) ([]byte, error) {
+	data, _, err := unstructured.NestedString(obj.Object, "data")
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading the data of %s", obj.GetName())
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	return decoded, errors.Wrapf(err, "decoding the data of %s", obj.GetName())
+}
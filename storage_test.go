@@ -0,0 +1,130 @@
+package extension_test
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/afero"
+)
+
+// fakeS3 is an in-memory S3 bucket, checking that the requests are signed
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	Expect(r.Header.Get("Authorization")).To(HavePrefix("AWS4-HMAC-SHA256 Credential=access/"))
+	Expect(r.Header.Get("Authorization")).To(ContainSubstring("SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/bucket":
+		type contents struct {
+			Key string
+		}
+		result := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []contents
+		}{}
+		for k := range s.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				result.Contents = append(result.Contents, contents{Key: k})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		Expect(xml.NewEncoder(w).Encode(result)).To(Succeed())
+	case r.Method == http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodPut:
+		if _, ok := s.objects[key]; ok && r.Header.Get("If-None-Match") == "*" {
+			http.Error(w, "PreconditionFailed", http.StatusPreconditionFailed)
+			return
+		}
+		s.objects[key], _ = ioutil.ReadAll(r.Body)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+var _ = Describe("Storage", func() {
+	ctx := context.Background()
+
+	// behaves checks the semantics shared by the storages
+	behaves := func(storage Storage) {
+		_, err := storage.Get(ctx, "missing.json")
+		Expect(IsStorageObjectNotFound(err)).To(BeTrue())
+
+		Expect(storage.Create(ctx, "app-1.json", []byte("one"))).To(Succeed())
+		Expect(IsStorageObjectExists(storage.Create(ctx, "app-1.json", []byte("two")))).To(BeTrue())
+		Expect(storage.Put(ctx, "app-1.json", []byte("two"))).To(Succeed())
+		Expect(storage.Get(ctx, "app-1.json")).To(Equal([]byte("two")))
+
+		sub := NewSubStorage(storage, "ledger")
+		Expect(sub.Put(ctx, "app-2.json", []byte("three"))).To(Succeed())
+		Expect(sub.List(ctx)).To(ConsistOf("app-2.json"))
+		Expect(storage.List(ctx)).To(ConsistOf("app-1.json", "ledger-app-2.json"))
+
+		Expect(storage.Delete(ctx, "app-1.json")).To(Succeed())
+		Expect(storage.Delete(ctx, "app-1.json")).To(Succeed())
+		Expect(storage.List(ctx)).To(ConsistOf("ledger-app-2.json"))
+	}
+
+	It("stores the objects in files", func() {
+		behaves(NewFileStorage(afero.NewMemMapFs(), "/data"))
+	})
+
+	It("stores the objects in an S3 bucket", func() {
+		server := httptest.NewServer(&fakeS3{objects: map[string][]byte{"other/object": []byte("kept")}})
+		defer server.Close()
+
+		storage, err := NewS3Storage(S3StorageOptions{
+			Endpoint:        server.URL,
+			Bucket:          "bucket",
+			Prefix:          "eirinix/",
+			AccessKeyID:     "access",
+			SecretAccessKey: "secret",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		behaves(storage)
+
+		_, err = NewS3Storage(S3StorageOptions{Endpoint: "s3.amazonaws.com", Bucket: "bucket"})
+		Expect(err).To(MatchError(ContainSubstring("Invalid S3 endpoint")))
+	})
+
+	It("stores the ledger", func() {
+		runs := 0
+		action := func(context.Context) error { runs++; return nil }
+		storage := NewFileStorage(afero.NewMemMapFs(), "/data")
+
+		for i := 0; i < 2; i++ {
+			c := catalog.NewCatalog()
+			eiriniManager := c.SimpleManager().(*DefaultExtensionManager)
+			eiriniManager.Options.Storage = storage
+			ran, err := eiriniManager.Ledger().Once(ctx, "guid-1", "create-db-user", action)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ran).To(Equal(i == 0))
+		}
+		Expect(runs).To(Equal(1))
+		Expect(NewSubStorage(storage, "ledger").List(ctx)).To(HaveLen(1))
+	})
+})
@@ -48,19 +48,26 @@ func (c *Catalog) SimpleReconciler() eirinix.Reconciler {
 	return &testReconciler{}
 }
 
+func mustManager(m eirinix.Manager, err error) eirinix.Manager {
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
 // SimpleManager returns a dummy Extensions manager
 func (c *Catalog) SimpleManager() eirinix.Manager {
-	return eirinix.NewManager(
+	return mustManager(eirinix.NewManager(
 		eirinix.ManagerOptions{
 			Namespace: "namespace",
 			Host:      "127.0.0.1",
 			Port:      90,
-		})
+		}))
 }
 
 // IntegrationManager returns an Extensions manager which is used by integration tests
 func (c *Catalog) IntegrationManager() eirinix.Manager {
-	return eirinix.NewManager(
+	return mustManager(eirinix.NewManager(
 		eirinix.ManagerOptions{
 			Namespace:        "default",
 			Host:             c.KindHost,
@@ -68,12 +75,12 @@ func (c *Catalog) IntegrationManager() eirinix.Manager {
 			KubeConfig:       os.Getenv("KUBECONFIG"),
 			ServiceName:      "eirinix",
 			WebhookNamespace: "default",
-		})
+		}))
 }
 
 // IntegrationManagerFiltered returns an Extensions manager which is used by integration tests which filters or not eirini apps
 func (c *Catalog) IntegrationManagerFiltered(b bool, n string) eirinix.Manager {
-	return eirinix.NewManager(
+	return mustManager(eirinix.NewManager(
 		eirinix.ManagerOptions{
 			Namespace:        n,
 			Host:             c.KindHost,
@@ -82,13 +89,13 @@ func (c *Catalog) IntegrationManagerFiltered(b bool, n string) eirinix.Manager {
 			ServiceName:      "eirinix",
 			WebhookNamespace: "default",
 			FilterEiriniApps: &b,
-		})
+		}))
 }
 
 // IntegrationManagerNoRegister returns an Extensions manager which is used by integration tests, which doesn't register extensions again
 func (c *Catalog) IntegrationManagerNoRegister() eirinix.Manager {
 	RegisterWebhooks := false
-	return eirinix.NewManager(
+	return mustManager(eirinix.NewManager(
 		eirinix.ManagerOptions{
 			Namespace:        "default",
 			Host:             c.KindHost,
@@ -97,7 +104,7 @@ func (c *Catalog) IntegrationManagerNoRegister() eirinix.Manager {
 			ServiceName:      "eirinix",
 			WebhookNamespace: "default",
 			RegisterWebHook:  &RegisterWebhooks,
-		})
+		}))
 }
 
 // ServiceYaml returns the yaml of the endpoint + service used to reach eiriniX returned in IntegrationManager
@@ -165,6 +172,57 @@ spec:
 `)
 }
 
+// EiriniReleaseAppYaml returns an app instance pod as created by an Eirini release, labeled
+// and laid out like the release does
+func (c *Catalog) EiriniReleaseAppYaml(release eirinix.EiriniCompatibility) []byte {
+	switch release {
+	case eirinix.EiriniCompatibilityController:
+		return []byte(`
+apiVersion: v1
+kind: Pod
+metadata:
+  name: dora-space-1a2b3c4d5e-0
+  labels:
+    workloads.cloudfoundry.org/guid: 3f6a9d1e-4b53-4bc1-9a1c-63b7ab2e2c11
+    workloads.cloudfoundry.org/version: 0d1e2c4f-6b08-4f0e-9c3a-4b4b5c2a0c55
+    workloads.cloudfoundry.org/app_guid: 9a7a2c4e-7a4e-4bde-8e2e-d4a0d1a4a6f2
+    workloads.cloudfoundry.org/process_type: web
+    workloads.cloudfoundry.org/source_type: APP
+  annotations:
+    workloads.cloudfoundry.org/app_name: dora
+    workloads.cloudfoundry.org/space_name: space
+    workloads.cloudfoundry.org/space_guid: 5e1f7b4c-2f44-4c3e-bb0c-7a1b6f3d9e21
+    workloads.cloudfoundry.org/org_name: org
+spec:
+  containers:
+  - name: opi
+    image: eirini/dorini
+`)
+	default:
+		return []byte(`
+apiVersion: v1
+kind: Pod
+metadata:
+  name: dora-space-1a2b3c4d5e-0
+  labels:
+    ` + eirinix.LabelGUID + `: 3f6a9d1e-4b53-4bc1-9a1c-63b7ab2e2c11
+    ` + eirinix.LabelVersion + `: 0d1e2c4f-6b08-4f0e-9c3a-4b4b5c2a0c55
+    ` + eirinix.LabelAppGUID + `: 9a7a2c4e-7a4e-4bde-8e2e-d4a0d1a4a6f2
+    ` + eirinix.LabelProcessType + `: web
+    ` + eirinix.LabelSourceType + `: APP
+  annotations:
+    cloudfoundry.org/application_name: dora
+    cloudfoundry.org/space_name: space
+    cloudfoundry.org/space_guid: 5e1f7b4c-2f44-4c3e-bb0c-7a1b6f3d9e21
+    cloudfoundry.org/org_name: org
+spec:
+  containers:
+  - name: opi
+    image: eirini/dorini
+`)
+	}
+}
+
 // RegisterEiriniXService register the service generated in ServiceYaml()
 func (c *Catalog) RegisterEiriniXService() error {
 
@@ -253,14 +311,14 @@ func (c *Catalog) StartEiriniStagingAppInNamespace(n string) (*EiriniApp, error)
 
 // SimpleManagerService returns a dummy Extensions manager configured to run as a service
 func (c *Catalog) SimpleManagerService() eirinix.Manager {
-	return eirinix.NewManager(
+	return mustManager(eirinix.NewManager(
 		eirinix.ManagerOptions{
 			Namespace:        "eirini",
 			Host:             "0.0.0.0",
 			Port:             8001,
 			ServiceName:      "extension",
 			WebhookNamespace: "cf",
-		})
+		}))
 }
 
 type SimpleWatch struct {
@@ -6,7 +6,7 @@ import (
 	"time"
 
 	eirinix "code.cloudfoundry.org/eirinix"
-	log "code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+	log "code.cloudfoundry.org/eirinix/util/ctxlog"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -23,7 +23,8 @@ type testReconciler struct {
 }
 
 func (r *testReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
-	ctx := log.NewContextWithRecorder(r.mgr.GetContext(), "test-reconciler", r.mgr.GetKubeManager().GetEventRecorderFor("test-recorder"))
+	ctx := log.NewReconcilerContext(r.mgr.GetContext(), "test-reconciler")
+	recorder := r.mgr.GetKubeManager().GetEventRecorderFor("test-recorder")
 	pod := &corev1.Pod{}
 
 	// Set the ctx to be Background, as the top-level context for incoming requests.
@@ -39,7 +40,8 @@ func (r *testReconciler) Reconcile(request reconcile.Request) (reconcile.Result,
 	pod.ObjectMeta.Annotations["touched"] = "yes"
 	err := r.mgr.GetKubeManager().GetClient().Update(ctx, pod)
 	if err != nil {
-		log.WithEvent(pod, "UpdateError").Errorf(ctx, "Failed to update pod annotation '%s/%s' (%v): %s", pod.Namespace, pod.Name, pod.ResourceVersion, err)
+		recorder.Eventf(pod, corev1.EventTypeWarning, "UpdateError", "Failed to update pod annotation '%s/%s' (%v): %s", pod.Namespace, pod.Name, pod.ResourceVersion, err)
+		log.Errorf(ctx, "Failed to update pod annotation '%s/%s' (%v): %s", pod.Namespace, pod.Name, pod.ResourceVersion, err)
 		return reconcile.Result{Requeue: true}, nil
 	}
 	return reconcile.Result{}, nil
@@ -87,7 +89,8 @@ type EditImageReconciler struct {
 }
 
 func (r *EditImageReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
-	ctx := log.NewContextWithRecorder(r.mgr.GetContext(), "test-reconciler", r.mgr.GetKubeManager().GetEventRecorderFor("test-recorder"))
+	ctx := log.NewReconcilerContext(r.mgr.GetContext(), "test-reconciler")
+	recorder := r.mgr.GetKubeManager().GetEventRecorderFor("test-recorder")
 	pod := &corev1.Pod{}
 
 	// Set the ctx to be Background, as the top-level context for incoming requests.
@@ -103,7 +106,8 @@ func (r *EditImageReconciler) Reconcile(request reconcile.Request) (reconcile.Re
 	err := r.mgr.GetKubeManager().GetClient().Update(ctx, pod)
 	if err != nil {
 		fmt.Println("Error during pod update", err)
-		log.WithEvent(pod, "UpdateError").Errorf(ctx, "Failed to update pod annotation '%s/%s' (%v): %s", pod.Namespace, pod.Name, pod.ResourceVersion, err)
+		recorder.Eventf(pod, corev1.EventTypeWarning, "UpdateError", "Failed to update pod annotation '%s/%s' (%v): %s", pod.Namespace, pod.Name, pod.ResourceVersion, err)
+		log.Errorf(ctx, "Failed to update pod annotation '%s/%s' (%v): %s", pod.Namespace, pod.Name, pod.ResourceVersion, err)
 		return reconcile.Result{Requeue: true}, nil
 	}
 	return reconcile.Result{}, nil
@@ -0,0 +1,190 @@
+// Package affinity contains helpers for extensions adding affinity and anti-affinity rules to the
+// app pods, merging them with the rules already set by Eirini or by other extensions.
+//
+// All the helpers are idempotent: a term which is already present is not added twice, so they are
+// safe to use in extensions which are called again on pod updates.
+package affinity
+
+import (
+	eirinix "code.cloudfoundry.org/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// TopologyZone is the well-known node label holding the zone of the node
+	TopologyZone = "topology.kubernetes.io/zone"
+	// TopologyHostname is the well-known node label holding the hostname of the node
+	TopologyHostname = "kubernetes.io/hostname"
+)
+
+func ensureAffinity(pod *corev1.Pod) *corev1.Affinity {
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	return pod.Spec.Affinity
+}
+
+func ensurePodAffinity(pod *corev1.Pod) *corev1.PodAffinity {
+	a := ensureAffinity(pod)
+	if a.PodAffinity == nil {
+		a.PodAffinity = &corev1.PodAffinity{}
+	}
+	return a.PodAffinity
+}
+
+func ensurePodAntiAffinity(pod *corev1.Pod) *corev1.PodAntiAffinity {
+	a := ensureAffinity(pod)
+	if a.PodAntiAffinity == nil {
+		a.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	return a.PodAntiAffinity
+}
+
+func ensureNodeAffinity(pod *corev1.Pod) *corev1.NodeAffinity {
+	a := ensureAffinity(pod)
+	if a.NodeAffinity == nil {
+		a.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	return a.NodeAffinity
+}
+
+func addPodAffinityTerm(terms []corev1.PodAffinityTerm, term corev1.PodAffinityTerm) []corev1.PodAffinityTerm {
+	for _, t := range terms {
+		if equality.Semantic.DeepEqual(t, term) {
+			return terms
+		}
+	}
+	return append(terms, term)
+}
+
+// addWeightedPodAffinityTerm adds the term to the terms, merging the identical terms into the first of them with
+// the highest of their weights, so that the result doesn't depend on the order the terms were added in
+func addWeightedPodAffinityTerm(terms []corev1.WeightedPodAffinityTerm, term corev1.WeightedPodAffinityTerm) []corev1.WeightedPodAffinityTerm {
+	merged := make([]corev1.WeightedPodAffinityTerm, 0, len(terms)+1)
+	all := append(append(make([]corev1.WeightedPodAffinityTerm, 0, len(terms)+1), terms...), term)
+	for _, t := range all {
+		found := false
+		for i := range merged {
+			if equality.Semantic.DeepEqual(merged[i].PodAffinityTerm, t.PodAffinityTerm) {
+				if t.Weight > merged[i].Weight {
+					merged[i].Weight = t.Weight
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
+
+// AddRequiredPodAffinity adds a required pod affinity term to the pod
+func AddRequiredPodAffinity(pod *corev1.Pod, term corev1.PodAffinityTerm) {
+	a := ensurePodAffinity(pod)
+	a.RequiredDuringSchedulingIgnoredDuringExecution = addPodAffinityTerm(a.RequiredDuringSchedulingIgnoredDuringExecution, term)
+}
+
+// AddPreferredPodAffinity adds a preferred pod affinity term to the pod. The identical terms are merged keeping
+// the highest weight.
+func AddPreferredPodAffinity(pod *corev1.Pod, term corev1.WeightedPodAffinityTerm) {
+	a := ensurePodAffinity(pod)
+	a.PreferredDuringSchedulingIgnoredDuringExecution = addWeightedPodAffinityTerm(a.PreferredDuringSchedulingIgnoredDuringExecution, term)
+}
+
+// AddRequiredPodAntiAffinity adds a required pod anti-affinity term to the pod
+func AddRequiredPodAntiAffinity(pod *corev1.Pod, term corev1.PodAffinityTerm) {
+	a := ensurePodAntiAffinity(pod)
+	a.RequiredDuringSchedulingIgnoredDuringExecution = addPodAffinityTerm(a.RequiredDuringSchedulingIgnoredDuringExecution, term)
+}
+
+// AddPreferredPodAntiAffinity adds a preferred pod anti-affinity term to the pod. The identical terms are merged
+// keeping the highest weight.
+func AddPreferredPodAntiAffinity(pod *corev1.Pod, term corev1.WeightedPodAffinityTerm) {
+	a := ensurePodAntiAffinity(pod)
+	a.PreferredDuringSchedulingIgnoredDuringExecution = addWeightedPodAffinityTerm(a.PreferredDuringSchedulingIgnoredDuringExecution, term)
+}
+
+// RequireNodeSelectorRequirement restricts the nodes the pod can run on. The node selector terms are ORed,
+// so the requirement is added to every existing term, keeping the pod as restricted as before.
+func RequireNodeSelectorRequirement(pod *corev1.Pod, req corev1.NodeSelectorRequirement) {
+	a := ensureNodeAffinity(pod)
+	if a.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		a.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	selector := a.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(selector.NodeSelectorTerms) == 0 {
+		selector.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+
+	for i := range selector.NodeSelectorTerms {
+		term := &selector.NodeSelectorTerms[i]
+		if !containsRequirement(term.MatchExpressions, req) {
+			term.MatchExpressions = append(term.MatchExpressions, req)
+		}
+	}
+}
+
+// AddPreferredNodeAffinity adds a preferred node scheduling term to the pod. If the pod already prefers the same
+// term, the highest weight is kept.
+func AddPreferredNodeAffinity(pod *corev1.Pod, term corev1.PreferredSchedulingTerm) {
+	a := ensureNodeAffinity(pod)
+	for i, t := range a.PreferredDuringSchedulingIgnoredDuringExecution {
+		if equality.Semantic.DeepEqual(t.Preference, term.Preference) {
+			if term.Weight > t.Weight {
+				a.PreferredDuringSchedulingIgnoredDuringExecution[i].Weight = term.Weight
+			}
+			return
+		}
+	}
+	a.PreferredDuringSchedulingIgnoredDuringExecution = append(a.PreferredDuringSchedulingIgnoredDuringExecution, term)
+}
+
+func containsRequirement(reqs []corev1.NodeSelectorRequirement, req corev1.NodeSelectorRequirement) bool {
+	for _, r := range reqs {
+		if equality.Semantic.DeepEqual(r, req) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTopologySpreadConstraint adds a topology spread constraint to the pod. If the pod already spreads over
+// the same topology key and label selector, the constraints are merged keeping the lowest max skew and
+// the hard constraint (DoNotSchedule) if any of them is one.
+func AddTopologySpreadConstraint(pod *corev1.Pod, constraint corev1.TopologySpreadConstraint) {
+	for i, c := range pod.Spec.TopologySpreadConstraints {
+		if c.TopologyKey != constraint.TopologyKey || !equality.Semantic.DeepEqual(c.LabelSelector, constraint.LabelSelector) {
+			continue
+		}
+		existing := &pod.Spec.TopologySpreadConstraints[i]
+		if constraint.MaxSkew < existing.MaxSkew {
+			existing.MaxSkew = constraint.MaxSkew
+		}
+		if constraint.WhenUnsatisfiable == corev1.DoNotSchedule {
+			existing.WhenUnsatisfiable = corev1.DoNotSchedule
+		}
+		return
+	}
+	pod.Spec.TopologySpreadConstraints = append(pod.Spec.TopologySpreadConstraints, constraint)
+}
+
+// SpreadAppInstances makes the scheduler prefer placing the instances of the app of the pod, identified by
+// its app GUID label, on different domains of the topology key, e.g. TopologyZone. Pods without an app GUID
+// are left unchanged.
+func SpreadAppInstances(pod *corev1.Pod, topologyKey string, weight int32) {
+	guid, ok := pod.GetLabels()[eirinix.LabelAppGUID]
+	if !ok {
+		return
+	}
+	AddPreferredPodAntiAffinity(pod, corev1.WeightedPodAffinityTerm{
+		Weight: weight,
+		PodAffinityTerm: corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{eirinix.LabelAppGUID: guid}},
+			TopologyKey:   topologyKey,
+		},
+	})
+}
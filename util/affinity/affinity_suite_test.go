@@ -0,0 +1,13 @@
+package affinity_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAffinity(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Affinity Suite")
+}
@@ -0,0 +1,348 @@
+package affinity_test
+
+import (
+	"math/rand"
+	"reflect"
+	"testing/quick"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/util/affinity"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Small alphabets, so that the generated terms often collide with the existing ones
+var (
+	guids        = []string{"a", "b", "c"}
+	topologyKeys = []string{TopologyZone, TopologyHostname}
+	nodeKeys     = []string{"zone", "os", "pool"}
+)
+
+func pick(r *rand.Rand, values []string) string {
+	return values[r.Intn(len(values))]
+}
+
+func randomTerm(r *rand.Rand) corev1.PodAffinityTerm {
+	return corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{eirinix.LabelAppGUID: pick(r, guids)}},
+		TopologyKey:   pick(r, topologyKeys),
+	}
+}
+
+func randomWeightedTerm(r *rand.Rand) corev1.WeightedPodAffinityTerm {
+	return corev1.WeightedPodAffinityTerm{Weight: int32(1 + r.Intn(100)), PodAffinityTerm: randomTerm(r)}
+}
+
+func randomRequirement(r *rand.Rand) corev1.NodeSelectorRequirement {
+	return corev1.NodeSelectorRequirement{
+		Key:      pick(r, nodeKeys),
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{pick(r, guids)},
+	}
+}
+
+// podGen generates pods with random, possibly empty, affinities
+type podGen struct {
+	Pod *corev1.Pod
+}
+
+func (podGen) Generate(r *rand.Rand, _ int) reflect.Value {
+	pod := &corev1.Pod{}
+	if r.Intn(4) == 0 {
+		return reflect.ValueOf(podGen{pod})
+	}
+	pod.Spec.Affinity = &corev1.Affinity{}
+	if r.Intn(2) == 0 {
+		anti := &corev1.PodAntiAffinity{}
+		for i := r.Intn(4); i > 0; i-- {
+			anti.PreferredDuringSchedulingIgnoredDuringExecution = append(anti.PreferredDuringSchedulingIgnoredDuringExecution, randomWeightedTerm(r))
+		}
+		for i := r.Intn(3); i > 0; i-- {
+			anti.RequiredDuringSchedulingIgnoredDuringExecution = append(anti.RequiredDuringSchedulingIgnoredDuringExecution, randomTerm(r))
+		}
+		pod.Spec.Affinity.PodAntiAffinity = anti
+	}
+	if r.Intn(2) == 0 {
+		selector := &corev1.NodeSelector{}
+		for i := r.Intn(3); i > 0; i-- {
+			term := corev1.NodeSelectorTerm{}
+			for j := r.Intn(3); j > 0; j-- {
+				term.MatchExpressions = append(term.MatchExpressions, randomRequirement(r))
+			}
+			selector.NodeSelectorTerms = append(selector.NodeSelectorTerms, term)
+		}
+		pod.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: selector}
+	}
+	return reflect.ValueOf(podGen{pod})
+}
+
+func randomSpreadConstraint(r *rand.Rand) corev1.TopologySpreadConstraint {
+	when := corev1.ScheduleAnyway
+	if r.Intn(2) == 0 {
+		when = corev1.DoNotSchedule
+	}
+	return corev1.TopologySpreadConstraint{
+		MaxSkew:           int32(1 + r.Intn(3)),
+		TopologyKey:       pick(r, topologyKeys),
+		WhenUnsatisfiable: when,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{eirinix.LabelAppGUID: pick(r, guids)}},
+	}
+}
+
+type spreadGen struct {
+	Pod         *corev1.Pod
+	Constraints []corev1.TopologySpreadConstraint
+}
+
+func (spreadGen) Generate(r *rand.Rand, _ int) reflect.Value {
+	pod := &corev1.Pod{}
+	for i := r.Intn(4); i > 0; i-- {
+		AddTopologySpreadConstraint(pod, randomSpreadConstraint(r))
+	}
+	var constraints []corev1.TopologySpreadConstraint
+	for i := 1 + r.Intn(3); i > 0; i-- {
+		constraints = append(constraints, randomSpreadConstraint(r))
+	}
+	return reflect.ValueOf(spreadGen{pod, constraints})
+}
+
+// spreadOf returns the constraint over the same topology key and selector as c, or nil
+func spreadOf(pod *corev1.Pod, c corev1.TopologySpreadConstraint) *corev1.TopologySpreadConstraint {
+	for i, existing := range pod.Spec.TopologySpreadConstraints {
+		if existing.TopologyKey == c.TopologyKey && equality.Semantic.DeepEqual(existing.LabelSelector, c.LabelSelector) {
+			return &pod.Spec.TopologySpreadConstraints[i]
+		}
+	}
+	return nil
+}
+
+type weightedTermGen struct {
+	Term corev1.WeightedPodAffinityTerm
+}
+
+func (weightedTermGen) Generate(r *rand.Rand, _ int) reflect.Value {
+	return reflect.ValueOf(weightedTermGen{randomWeightedTerm(r)})
+}
+
+type requirementGen struct {
+	Req corev1.NodeSelectorRequirement
+}
+
+func (requirementGen) Generate(r *rand.Rand, _ int) reflect.Value {
+	return reflect.ValueOf(requirementGen{randomRequirement(r)})
+}
+
+func preferredAnti(pod *corev1.Pod) []corev1.WeightedPodAffinityTerm {
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.PodAntiAffinity == nil {
+		return nil
+	}
+	return pod.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+}
+
+func nodeTerms(pod *corev1.Pod) []corev1.NodeSelectorTerm {
+	a := pod.Spec.Affinity
+	if a == nil || a.NodeAffinity == nil || a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+	return a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+}
+
+// weightOf returns the weight of the term in terms, or 0 if it's missing
+func weightOf(terms []corev1.WeightedPodAffinityTerm, term corev1.PodAffinityTerm) int32 {
+	for _, t := range terms {
+		if equality.Semantic.DeepEqual(t.PodAffinityTerm, term) {
+			return t.Weight
+		}
+	}
+	return 0
+}
+
+func hasRequirement(term corev1.NodeSelectorTerm, req corev1.NodeSelectorRequirement) bool {
+	for _, r := range term.MatchExpressions {
+		if equality.Semantic.DeepEqual(r, req) {
+			return true
+		}
+	}
+	return false
+}
+
+var quickConfig = &quick.Config{MaxCount: 500}
+
+var _ = Describe("Affinity helpers", func() {
+	Context("merging preferred pod anti-affinity terms", func() {
+		It("keeps the existing terms, with at least their weight", func() {
+			Expect(quick.Check(func(p podGen, t weightedTermGen) bool {
+				before := preferredAnti(p.Pod.DeepCopy())
+				AddPreferredPodAntiAffinity(p.Pod, t.Term)
+				for _, term := range before {
+					if weightOf(preferredAnti(p.Pod), term.PodAffinityTerm) < term.Weight {
+						return false
+					}
+				}
+				return true
+			}, quickConfig)).To(Succeed())
+		})
+
+		It("adds the term without duplicates", func() {
+			Expect(quick.Check(func(p podGen, t weightedTermGen) bool {
+				AddPreferredPodAntiAffinity(p.Pod, t.Term)
+				count := 0
+				for _, term := range preferredAnti(p.Pod) {
+					if equality.Semantic.DeepEqual(term.PodAffinityTerm, t.Term.PodAffinityTerm) {
+						count++
+					}
+				}
+				return count >= 1 && weightOf(preferredAnti(p.Pod), t.Term.PodAffinityTerm) >= t.Term.Weight
+			}, quickConfig)).To(Succeed())
+		})
+
+		It("is idempotent", func() {
+			Expect(quick.Check(func(p podGen, t weightedTermGen) bool {
+				AddPreferredPodAntiAffinity(p.Pod, t.Term)
+				once := p.Pod.DeepCopy()
+				AddPreferredPodAntiAffinity(p.Pod, t.Term)
+				return equality.Semantic.DeepEqual(once, p.Pod)
+			}, quickConfig)).To(Succeed())
+		})
+
+		It("doesn't depend on the order the terms are added in", func() {
+			Expect(quick.Check(func(p podGen, a, b weightedTermGen) bool {
+				ab := p.Pod.DeepCopy()
+				AddPreferredPodAntiAffinity(ab, a.Term)
+				AddPreferredPodAntiAffinity(ab, b.Term)
+				ba := p.Pod.DeepCopy()
+				AddPreferredPodAntiAffinity(ba, b.Term)
+				AddPreferredPodAntiAffinity(ba, a.Term)
+
+				if len(preferredAnti(ab)) != len(preferredAnti(ba)) {
+					return false
+				}
+				for _, term := range preferredAnti(ab) {
+					if weightOf(preferredAnti(ba), term.PodAffinityTerm) != term.Weight {
+						return false
+					}
+				}
+				return true
+			}, quickConfig)).To(Succeed())
+		})
+
+		It("leaves the other rules untouched", func() {
+			Expect(quick.Check(func(p podGen, t weightedTermGen) bool {
+				before := p.Pod.DeepCopy()
+				AddPreferredPodAntiAffinity(p.Pod, t.Term)
+				return equality.Semantic.DeepEqual(nodeTerms(before), nodeTerms(p.Pod)) &&
+					(before.Spec.Affinity == nil || before.Spec.Affinity.PodAntiAffinity == nil ||
+						equality.Semantic.DeepEqual(before.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+							p.Pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution))
+			}, quickConfig)).To(Succeed())
+		})
+	})
+
+	Context("requiring node selector requirements", func() {
+		It("adds the requirement to every term, keeping the existing ones", func() {
+			Expect(quick.Check(func(p podGen, r requirementGen) bool {
+				before := nodeTerms(p.Pod.DeepCopy())
+				RequireNodeSelectorRequirement(p.Pod, r.Req)
+				after := nodeTerms(p.Pod)
+
+				if len(before) == 0 {
+					return len(after) == 1 && reflect.DeepEqual(after[0].MatchExpressions, []corev1.NodeSelectorRequirement{r.Req})
+				}
+				if len(after) != len(before) {
+					return false
+				}
+				for i := range after {
+					if !hasRequirement(after[i], r.Req) {
+						return false
+					}
+					for _, req := range before[i].MatchExpressions {
+						if !hasRequirement(after[i], req) {
+							return false
+						}
+					}
+				}
+				return true
+			}, quickConfig)).To(Succeed())
+		})
+
+		It("is idempotent", func() {
+			Expect(quick.Check(func(p podGen, r requirementGen) bool {
+				RequireNodeSelectorRequirement(p.Pod, r.Req)
+				once := p.Pod.DeepCopy()
+				RequireNodeSelectorRequirement(p.Pod, r.Req)
+				return equality.Semantic.DeepEqual(once, p.Pod)
+			}, quickConfig)).To(Succeed())
+		})
+	})
+
+	Context("merging topology spread constraints", func() {
+		It("keeps each constraint at most as loose as before", func() {
+			Expect(quick.Check(func(g spreadGen) bool {
+				before := g.Pod.DeepCopy()
+				for _, c := range g.Constraints {
+					AddTopologySpreadConstraint(g.Pod, c)
+				}
+				for _, c := range append(before.Spec.TopologySpreadConstraints, g.Constraints...) {
+					merged := spreadOf(g.Pod, c)
+					if merged == nil || merged.MaxSkew > c.MaxSkew {
+						return false
+					}
+					if c.WhenUnsatisfiable == corev1.DoNotSchedule && merged.WhenUnsatisfiable != corev1.DoNotSchedule {
+						return false
+					}
+				}
+				return true
+			}, quickConfig)).To(Succeed())
+		})
+
+		It("is idempotent and doesn't depend on the order", func() {
+			Expect(quick.Check(func(g spreadGen) bool {
+				forward := g.Pod.DeepCopy()
+				for _, c := range g.Constraints {
+					AddTopologySpreadConstraint(forward, c)
+				}
+				once := forward.DeepCopy()
+				for _, c := range g.Constraints {
+					AddTopologySpreadConstraint(forward, c)
+				}
+
+				backward := g.Pod.DeepCopy()
+				for i := len(g.Constraints) - 1; i >= 0; i-- {
+					AddTopologySpreadConstraint(backward, g.Constraints[i])
+				}
+				if len(backward.Spec.TopologySpreadConstraints) != len(forward.Spec.TopologySpreadConstraints) {
+					return false
+				}
+				for _, c := range backward.Spec.TopologySpreadConstraints {
+					if !equality.Semantic.DeepEqual(spreadOf(forward, c), &c) {
+						return false
+					}
+				}
+				return equality.Semantic.DeepEqual(once, forward)
+			}, quickConfig)).To(Succeed())
+		})
+	})
+
+	Context("spreading app instances", func() {
+		It("prefers spreading the instances of the same app", func() {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{eirinix.LabelAppGUID: "a"}}}
+			SpreadAppInstances(pod, TopologyZone, 50)
+			SpreadAppInstances(pod, TopologyZone, 50)
+
+			terms := preferredAnti(pod)
+			Expect(terms).To(HaveLen(1))
+			Expect(terms[0].Weight).To(Equal(int32(50)))
+			Expect(terms[0].PodAffinityTerm.TopologyKey).To(Equal(TopologyZone))
+			Expect(terms[0].PodAffinityTerm.LabelSelector.MatchLabels).To(Equal(map[string]string{eirinix.LabelAppGUID: "a"}))
+		})
+
+		It("ignores the pods without an app GUID", func() {
+			pod := &corev1.Pod{}
+			SpreadAppInstances(pod, TopologyZone, 50)
+			Expect(pod.Spec.Affinity).To(BeNil())
+		})
+	})
+})
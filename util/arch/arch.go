@@ -0,0 +1,191 @@
+// Package arch contains helpers for extensions injecting containers in clusters mixing node architectures,
+// e.g. amd64 and arm64 nodes, to select the image variant of the injected sidecars matching the node of the
+// app pods.
+package arch
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// LabelArch is the well-known node label holding the node architecture
+	LabelArch = "kubernetes.io/arch"
+	// LabelArchBeta is the deprecated version of LabelArch, still used by older Eirini releases
+	LabelArchBeta = "beta.kubernetes.io/arch"
+
+	// AMD64 and ARM64 are the values of LabelArch on the amd64 and arm64 nodes
+	AMD64 = "amd64"
+	ARM64 = "arm64"
+)
+
+// Permissions returns the permissions needed to read the nodes of the bound pods and the ConfigMap of the
+// image variants, see NodeArchitecture and LoadImageVariants
+func Permissions() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get"}},
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}},
+	}
+}
+
+// PodArchitecture returns the architecture the pod is constrained to by its node selector or its required node
+// affinity, and false if it can be scheduled on nodes of several architectures
+func PodArchitecture(pod *corev1.Pod) (string, bool) {
+	if pod == nil {
+		return "", false
+	}
+
+	for _, label := range []string{LabelArch, LabelArchBeta} {
+		if arch := pod.Spec.NodeSelector[label]; arch != "" {
+			return arch, true
+		}
+	}
+
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return "", false
+	}
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) == 0 {
+		return "", false
+	}
+	// Terms are ORed: the pod is constrained to an architecture only if every term requires the same one
+	arch := ""
+	for _, term := range terms {
+		a, ok := termArchitecture(term)
+		if !ok || (arch != "" && a != arch) {
+			return "", false
+		}
+		arch = a
+	}
+	return arch, true
+}
+
+func termArchitecture(term corev1.NodeSelectorTerm) (string, bool) {
+	for _, req := range term.MatchExpressions {
+		if req.Key != LabelArch && req.Key != LabelArchBeta {
+			continue
+		}
+		if req.Operator == corev1.NodeSelectorOpIn && len(req.Values) == 1 {
+			return req.Values[0], true
+		}
+	}
+	return "", false
+}
+
+// NodeArchitecture returns the architecture of the node, from its labels or its status
+func NodeArchitecture(ctx context.Context, c client.Client, name string) (string, error) {
+	node := &corev1.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, node); err != nil {
+		return "", errors.Wrapf(err, "getting the node %s", name)
+	}
+	for _, label := range []string{LabelArch, LabelArchBeta} {
+		if arch := node.Labels[label]; arch != "" {
+			return arch, nil
+		}
+	}
+	if arch := node.Status.NodeInfo.Architecture; arch != "" {
+		return arch, nil
+	}
+	return "", errors.Errorf("The architecture of the node %s is unknown", name)
+}
+
+// ImageVariants are the images of a sidecar built for each architecture, e.g. sidecar:1.0 for amd64 and
+// sidecar:1.0-arm64 for arm64. Multi-architecture images don't need variants.
+type ImageVariants struct {
+	// Images are the images indexed by architecture
+	Images map[string]string
+
+	// Default is the architecture of the pods which are neither bound to a node nor constrained to an
+	// architecture. Optional, defaults to amd64
+	Default string
+
+	// Pin constrains the pods which aren't constrained to an architecture to the Default one with a node
+	// selector, so that they are scheduled on a node the selected image runs on. Optional, defaults to false
+	Pin bool
+}
+
+// ImageVariantsFromConfigMap returns the image variants held by the ConfigMap, with an architecture per key,
+// e.g. amd64: sidecar:1.0
+func ImageVariantsFromConfigMap(cm *corev1.ConfigMap) *ImageVariants {
+	v := &ImageVariants{Images: map[string]string{}}
+	for arch, image := range cm.Data {
+		if image = strings.TrimSpace(image); image != "" {
+			v.Images[arch] = image
+		}
+	}
+	return v
+}
+
+// LoadImageVariants returns the image variants of the ConfigMap, see ImageVariantsFromConfigMap
+func LoadImageVariants(ctx context.Context, c client.Client, key types.NamespacedName) (*ImageVariants, error) {
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, key, cm); err != nil {
+		return nil, errors.Wrapf(err, "getting the image variants %s", key)
+	}
+	return ImageVariantsFromConfigMap(cm), nil
+}
+
+func (v *ImageVariants) defaultArchitecture() string {
+	if v.Default == "" {
+		return AMD64
+	}
+	return v.Default
+}
+
+// Architecture returns the architecture the pod runs on: the one of its node if it is bound to one, the one it
+// is constrained to, or the Default one. The returned bool is false when the pod isn't bound nor constrained.
+func (v *ImageVariants) Architecture(ctx context.Context, c client.Client, pod *corev1.Pod) (string, bool, error) {
+	if pod.Spec.NodeName != "" {
+		arch, err := NodeArchitecture(ctx, c, pod.Spec.NodeName)
+		return arch, true, err
+	}
+	if arch, ok := PodArchitecture(pod); ok {
+		return arch, true, nil
+	}
+	return v.defaultArchitecture(), false, nil
+}
+
+// Image returns the image variant for the architecture
+func (v *ImageVariants) Image(arch string) (string, error) {
+	image, ok := v.Images[arch]
+	if !ok {
+		archs := make([]string, 0, len(v.Images))
+		for a := range v.Images {
+			archs = append(archs, a)
+		}
+		sort.Strings(archs)
+		return "", errors.Errorf("No image variant for the architecture %s, only for %s", arch, strings.Join(archs, ", "))
+	}
+	return image, nil
+}
+
+// SetImage sets the image of the container injected in the pod to the variant for the architecture of the pod,
+// see Architecture, and pins the pod to the Default architecture if Pin is set and the pod isn't constrained.
+// The client is only used to read the node of the pods already bound to one.
+func (v *ImageVariants) SetImage(ctx context.Context, c client.Client, pod *corev1.Pod, container *corev1.Container) error {
+	arch, constrained, err := v.Architecture(ctx, c, pod)
+	if err != nil {
+		return err
+	}
+	image, err := v.Image(arch)
+	if err != nil {
+		return err
+	}
+	container.Image = image
+
+	if !constrained && v.Pin {
+		if pod.Spec.NodeSelector == nil {
+			pod.Spec.NodeSelector = map[string]string{}
+		}
+		pod.Spec.NodeSelector[LabelArch] = arch
+	}
+	return nil
+}
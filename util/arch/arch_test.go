@@ -0,0 +1,113 @@
+package arch_test
+
+import (
+	"context"
+
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "code.cloudfoundry.org/eirinix/util/arch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Architecture helpers", func() {
+	var (
+		pod      *corev1.Pod
+		sidecar  *corev1.Container
+		client   *cfakes.FakeClient
+		variants *ImageVariants
+	)
+
+	armTerm := corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+		{Key: LabelArch, Operator: corev1.NodeSelectorOpIn, Values: []string{ARM64}},
+	}}
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		sidecar = &corev1.Container{Name: "sidecar"}
+		client = &cfakes.FakeClient{}
+		variants = &ImageVariants{Images: map[string]string{AMD64: "sidecar:1.0", ARM64: "sidecar:1.0-arm64"}}
+	})
+
+	It("detects the architecture from the node selector", func() {
+		_, ok := PodArchitecture(pod)
+		Expect(ok).To(BeFalse())
+
+		pod.Spec.NodeSelector = map[string]string{LabelArchBeta: ARM64}
+		arch, ok := PodArchitecture(pod)
+		Expect(ok).To(BeTrue())
+		Expect(arch).To(Equal(ARM64))
+	})
+
+	It("detects the architecture required by the node affinity", func() {
+		pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{armTerm},
+			},
+		}}
+		arch, ok := PodArchitecture(pod)
+		Expect(ok).To(BeTrue())
+		Expect(arch).To(Equal(ARM64))
+
+		terms := &pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		*terms = append(*terms, corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+			{Key: LabelArch, Operator: corev1.NodeSelectorOpIn, Values: []string{AMD64}},
+		}})
+		_, ok = PodArchitecture(pod)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("reads the architecture of the node of the bound pods", func() {
+		client.GetCalls(func(_ context.Context, key crc.ObjectKey, object runtime.Object) error {
+			Expect(key.Name).To(Equal("node-1"))
+			object.(*corev1.Node).Status.NodeInfo.Architecture = ARM64
+			return nil
+		})
+		pod.Spec.NodeName = "node-1"
+
+		Expect(variants.SetImage(context.Background(), client, pod, sidecar)).To(Succeed())
+		Expect(sidecar.Image).To(Equal("sidecar:1.0-arm64"))
+		Expect(pod.Spec.NodeSelector).To(BeEmpty())
+	})
+
+	It("selects the image of the architecture the pod is constrained to", func() {
+		pod.Spec.NodeSelector = map[string]string{LabelArch: ARM64}
+		Expect(variants.SetImage(context.Background(), client, pod, sidecar)).To(Succeed())
+		Expect(sidecar.Image).To(Equal("sidecar:1.0-arm64"))
+		Expect(client.GetCallCount()).To(Equal(0))
+	})
+
+	It("pins the unconstrained pods to the default architecture", func() {
+		Expect(variants.SetImage(context.Background(), client, pod, sidecar)).To(Succeed())
+		Expect(sidecar.Image).To(Equal("sidecar:1.0"))
+		Expect(pod.Spec.NodeSelector).To(BeEmpty())
+
+		variants.Default = ARM64
+		variants.Pin = true
+		Expect(variants.SetImage(context.Background(), client, pod, sidecar)).To(Succeed())
+		Expect(sidecar.Image).To(Equal("sidecar:1.0-arm64"))
+		Expect(pod.Spec.NodeSelector).To(Equal(map[string]string{LabelArch: ARM64}))
+	})
+
+	It("fails without a variant for the architecture", func() {
+		pod.Spec.NodeSelector = map[string]string{LabelArch: "s390x"}
+		err := variants.SetImage(context.Background(), client, pod, sidecar)
+		Expect(err).To(MatchError("No image variant for the architecture s390x, only for amd64, arm64"))
+		Expect(sidecar.Image).To(BeEmpty())
+	})
+
+	It("loads the variants from a config map", func() {
+		client.GetCalls(func(_ context.Context, key crc.ObjectKey, object runtime.Object) error {
+			Expect(key).To(Equal(types.NamespacedName{Namespace: "eirini", Name: "sidecar-images"}))
+			object.(*corev1.ConfigMap).Data = map[string]string{AMD64: " sidecar:2.0\n", ARM64: "sidecar:2.0-arm64", "ppc64le": ""}
+			return nil
+		})
+
+		loaded, err := LoadImageVariants(context.Background(), client, types.NamespacedName{Namespace: "eirini", Name: "sidecar-images"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded.Images).To(Equal(map[string]string{AMD64: "sidecar:2.0", ARM64: "sidecar:2.0-arm64"}))
+	})
+})
@@ -1,3 +1,11 @@
+// Package ctxlog carries the loggers in the contexts. The context passed to the Handle function of the
+// extensions holds a logger scoped to the admission request, named after the extension and with the
+// namespace, pod and admission uid fields, so that the extensions log with:
+//
+//	ctxlog.Infof(ctx, "Mounting %s", volume)
+//	ctxlog.ExtractLogger(ctx).Infow("Mounted the volume", "volume", volume)
+//
+// NewObservedContext captures the log output in the tests of the extensions.
 package ctxlog
 
 import (
@@ -6,6 +14,14 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	// KeyNamespace, KeyPod and KeyUID are the fields of the loggers of the admission requests, set to the
+	// namespace and name of the pod and to the uid of the request
+	KeyNamespace = "namespace"
+	KeyPod       = "pod"
+	KeyUID       = "uid"
+)
+
 type ctxLogger struct{}
 
 // key must be comparable and should not be of type string
@@ -21,6 +37,28 @@ func NewManagerContext(log *zap.SugaredLogger) context.Context {
 	return ctx
 }
 
+// WithLogger returns a new context with the logger
+func WithLogger(ctx context.Context, log *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, ctxLoggerKey, log)
+}
+
+// WithValues returns a new context whose logger adds the fields, as alternating keys and values
+func WithValues(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	return WithLogger(ctx, ExtractLogger(ctx).With(keysAndValues...))
+}
+
+// NewAdmissionContext returns a new context with the logger of an admission request: named after the
+// extension, with the namespace and name of the pod and the uid of the request. The empty fields are omitted.
+func NewAdmissionContext(ctx context.Context, log *zap.SugaredLogger, extension, namespace, pod, uid string) context.Context {
+	var fields []interface{}
+	for _, f := range [][2]string{{KeyNamespace, namespace}, {KeyPod, pod}, {KeyUID, uid}} {
+		if f[1] != "" {
+			fields = append(fields, f[0], f[1])
+		}
+	}
+	return WithLogger(ctx, log.Named(extension).With(fields...))
+}
+
 // NewReconcilerContext includes a named logger for the reconciler
 func NewReconcilerContext(ctx context.Context, name string) context.Context {
 	log := ExtractLogger(ctx)
@@ -51,6 +89,12 @@ func Info(ctx context.Context, v ...interface{}) {
 	log.Info(v...)
 }
 
+// Warn uses the stored zap logger
+func Warn(ctx context.Context, v ...interface{}) {
+	log := ExtractLogger(ctx)
+	log.Warn(v...)
+}
+
 // Error uses the stored zap logger
 func Error(ctx context.Context, v ...interface{}) {
 	log := ExtractLogger(ctx)
@@ -69,6 +113,12 @@ func Infof(ctx context.Context, format string, v ...interface{}) {
 	log.Infof(format, v...)
 }
 
+// Warnf uses the stored zap logger
+func Warnf(ctx context.Context, format string, v ...interface{}) {
+	log := ExtractLogger(ctx)
+	log.Warnf(format, v...)
+}
+
 // Errorf uses the stored zap logger
 func Errorf(ctx context.Context, format string, v ...interface{}) {
 	log := ExtractLogger(ctx)
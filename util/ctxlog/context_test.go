@@ -0,0 +1,37 @@
+package ctxlog_test
+
+import (
+	"context"
+
+	. "code.cloudfoundry.org/eirinix/util/ctxlog"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap/zapcore"
+)
+
+var _ = Describe("Context logger", func() {
+	It("doesn't log without logger", func() {
+		Expect(ExtractLogger(context.Background())).ToNot(BeNil())
+		Info(context.Background(), "dropped")
+	})
+
+	It("derives the loggers of the admission requests", func() {
+		ctx, logs := NewObservedContext(zapcore.InfoLevel)
+		ctx = NewAdmissionContext(ctx, ExtractLogger(ctx), "volume", "space", "", "b3b4c6a1")
+		ctx = WithValues(ctx, "volume", "data")
+
+		Debugf(ctx, "ignored")
+		Warnf(ctx, "Mounting %s", "data")
+
+		entries := logs.AllUntimed()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Message).To(Equal("Mounting data"))
+		Expect(entries[0].Level).To(Equal(zapcore.WarnLevel))
+		Expect(entries[0].LoggerName).To(Equal("volume"))
+		Expect(entries[0].ContextMap()).To(Equal(map[string]interface{}{
+			KeyNamespace: "space",
+			KeyUID:       "b3b4c6a1",
+			"volume":     "data",
+		}))
+	})
+})
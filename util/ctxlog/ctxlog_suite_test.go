@@ -0,0 +1,13 @@
+package ctxlog_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCtxlog(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ctxlog Suite")
+}
@@ -0,0 +1,20 @@
+package ctxlog
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// NewObservedContext returns a context whose logger records the entries at or above the level, for the tests
+// of the extensions:
+//
+//	ctx, logs := ctxlog.NewObservedContext(zapcore.InfoLevel)
+//	ext.Handle(ctx, manager, pod, req)
+//	Expect(logs.FilterMessage("Mounted the volume").Len()).To(Equal(1))
+func NewObservedContext(level zapcore.LevelEnabler) (context.Context, *observer.ObservedLogs) {
+	core, logs := observer.New(level)
+	return NewManagerContext(zap.New(core).Sugar()), logs
+}
@@ -0,0 +1,176 @@
+// Package grafana generates Grafana dashboards out of the descriptions of the metrics exported by eirinix,
+// so that the dashboards follow the metric names and labels instead of being maintained by hand.
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+)
+
+const (
+	panelWidth    = 12
+	panelHeight   = 8
+	rateInterval  = "5m"
+	schemaVersion = 27
+)
+
+var quantiles = []float64{0.5, 0.95, 0.99}
+
+// Dashboard is a Grafana dashboard
+type Dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          TimeRange  `json:"time"`
+	Templating    Templating `json:"templating"`
+	Panels        []Panel    `json:"panels"`
+}
+
+// TimeRange is the default time range of the dashboard
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Templating contains the dashboard variables
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+// Variable is a dashboard variable
+type Variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+// Panel is a dashboard panel
+type Panel struct {
+	ID          int         `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Type        string      `json:"type"`
+	Datasource  string      `json:"datasource"`
+	GridPos     GridPos     `json:"gridPos"`
+	Targets     []Target    `json:"targets"`
+	FieldConfig FieldConfig `json:"fieldConfig"`
+}
+
+// GridPos is the position of a panel
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Target is a prometheus query of a panel
+type Target struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	RefID        string `json:"refId"`
+}
+
+// FieldConfig contains the display options of a panel
+type FieldConfig struct {
+	Defaults FieldDefaults `json:"defaults"`
+}
+
+// FieldDefaults are the default display options of the panel fields
+type FieldDefaults struct {
+	Unit string `json:"unit,omitempty"`
+}
+
+// NewDashboard returns a dashboard with a panel for each metric, using the $datasource variable
+func NewDashboard(title string, metrics []eirinix.MetricDescription) *Dashboard {
+	d := &Dashboard{
+		UID:           strings.ToLower(strings.ReplaceAll(title, " ", "-")),
+		Title:         title,
+		Tags:          []string{"eirinix"},
+		SchemaVersion: schemaVersion,
+		Refresh:       "30s",
+		Time:          TimeRange{From: "now-6h", To: "now"},
+		Templating: Templating{List: []Variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+		}},
+	}
+
+	for i, m := range metrics {
+		d.Panels = append(d.Panels, Panel{
+			ID:          i + 1,
+			Title:       panelTitle(m),
+			Description: m.Help,
+			Type:        panelType(m),
+			Datasource:  "$datasource",
+			GridPos:     GridPos{H: panelHeight, W: panelWidth, X: (i % 2) * panelWidth, Y: (i / 2) * panelHeight},
+			Targets:     targets(m),
+			FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: m.Unit}},
+		})
+	}
+	return d
+}
+
+// Generate returns the JSON of the dashboard for the metrics exported by eirinix
+func Generate(title string) ([]byte, error) {
+	return json.MarshalIndent(NewDashboard(title, eirinix.MetricDescriptions()), "", "  ")
+}
+
+func panelTitle(m eirinix.MetricDescription) string {
+	title := strings.TrimPrefix(m.Name, "eirinix_")
+	title = strings.TrimSuffix(title, "_total")
+	title = strings.ReplaceAll(title, "_", " ")
+	if len(m.Labels) > 0 {
+		title += " by " + m.Labels[0]
+	}
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+func panelType(m eirinix.MetricDescription) string {
+	if m.Type == eirinix.MetricGauge && len(m.Labels) == 0 {
+		return "stat"
+	}
+	return "graph"
+}
+
+func legend(labels []string) string {
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf("{{%s}}", l)
+	}
+	return strings.Join(parts, " ")
+}
+
+func targets(m eirinix.MetricDescription) []Target {
+	by := strings.Join(m.Labels, ", ")
+
+	switch m.Type {
+	case eirinix.MetricCounter:
+		return []Target{{
+			Expr:         fmt.Sprintf("sum by (%s) (rate(%s[%s]))", by, m.Name, rateInterval),
+			LegendFormat: legend(m.Labels),
+			RefID:        "A",
+		}}
+	case eirinix.MetricHistogram:
+		var t []Target
+		for i, q := range quantiles {
+			t = append(t, Target{
+				Expr:         fmt.Sprintf("histogram_quantile(%g, sum by (%s) (rate(%s_bucket[%s])))", q, strings.Join(append([]string{"le"}, m.Labels...), ", "), m.Name, rateInterval),
+				LegendFormat: strings.TrimSpace(fmt.Sprintf("p%g %s", q*100, legend(m.Labels))),
+				RefID:        string(rune('A' + i)),
+			})
+		}
+		return t
+	default:
+		return []Target{{
+			Expr:         m.Name,
+			LegendFormat: legend(m.Labels),
+			RefID:        "A",
+		}}
+	}
+}
@@ -0,0 +1,45 @@
+package grafana_test
+
+import (
+	"encoding/json"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/util/grafana"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Grafana dashboards", func() {
+	It("generates a panel for each exported metric", func() {
+		b, err := Generate("EiriniX")
+		Expect(err).ToNot(HaveOccurred())
+
+		d := &Dashboard{}
+		Expect(json.Unmarshal(b, d)).To(Succeed())
+		Expect(d.UID).To(Equal("eirinix"))
+		Expect(d.Panels).To(HaveLen(len(eirinix.MetricDescriptions())))
+
+		var exprs []string
+		for _, p := range d.Panels {
+			for _, t := range p.Targets {
+				exprs = append(exprs, t.Expr)
+			}
+		}
+		Expect(exprs).To(ContainElement("sum by (extension, operation, result) (rate(eirinix_admission_requests_total[5m]))"))
+		Expect(exprs).To(ContainElement("histogram_quantile(0.95, sum by (le, extension, operation) (rate(eirinix_admission_duration_seconds_bucket[5m])))"))
+		Expect(exprs).To(ContainElement("eirinix_webhook_certificate_expiry_timestamp_seconds"))
+	})
+
+	It("lays out the panels on two columns", func() {
+		d := NewDashboard("Extensions", []eirinix.MetricDescription{
+			{Name: "a_total", Type: eirinix.MetricCounter},
+			{Name: "b", Type: eirinix.MetricGauge},
+			{Name: "c", Type: eirinix.MetricGauge, Labels: []string{"client"}},
+		})
+		Expect(d.Panels[1].GridPos).To(Equal(GridPos{H: 8, W: 12, X: 12, Y: 0}))
+		Expect(d.Panels[2].GridPos).To(Equal(GridPos{H: 8, W: 12, X: 0, Y: 8}))
+		Expect(d.Panels[1].Type).To(Equal("stat"))
+		Expect(d.Panels[2].Type).To(Equal("graph"))
+		Expect(d.Panels[2].Title).To(Equal("C by client"))
+	})
+})
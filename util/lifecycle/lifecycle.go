@@ -0,0 +1,188 @@
+// Package lifecycle contains helpers for extensions setting the probes and the lifecycle hooks of the
+// app containers, e.g. to drain the connections of an app instance before it is stopped.
+//
+// Eirini already defines some of them, so every helper takes a Policy choosing what happens to a probe
+// or a hook which is already set.
+package lifecycle
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// AppContainerName is the name of the container running the app in the pods created by Eirini
+const AppContainerName = "opi"
+
+// Policy chooses how a probe or a hook already set on the container is treated
+type Policy int
+
+const (
+	// KeepExisting leaves a probe or a hook which is already set untouched
+	KeepExisting Policy = iota
+	// Merge keeps the handler of an existing probe and sets the non-zero timings of the new one. For hooks,
+	// two exec handlers are chained, the existing one running first, and other handlers are kept
+	Merge
+	// Replace replaces the existing probe or hook
+	Replace
+)
+
+// AppContainer returns the container running the app, or nil if the pod has none
+func AppContainer(pod *corev1.Pod) *corev1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == AppContainerName {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+// mergeProbe returns the probe to set on the container, given the current one
+func mergeProbe(current *corev1.Probe, probe corev1.Probe, policy Policy) *corev1.Probe {
+	if current == nil || policy == Replace {
+		return &probe
+	}
+	if policy == KeepExisting {
+		return current
+	}
+
+	merged := current.DeepCopy()
+	if probe.InitialDelaySeconds != 0 {
+		merged.InitialDelaySeconds = probe.InitialDelaySeconds
+	}
+	if probe.TimeoutSeconds != 0 {
+		merged.TimeoutSeconds = probe.TimeoutSeconds
+	}
+	if probe.PeriodSeconds != 0 {
+		merged.PeriodSeconds = probe.PeriodSeconds
+	}
+	if probe.SuccessThreshold != 0 {
+		merged.SuccessThreshold = probe.SuccessThreshold
+	}
+	if probe.FailureThreshold != 0 {
+		merged.FailureThreshold = probe.FailureThreshold
+	}
+	return merged
+}
+
+func setProbe(target **corev1.Probe, probe corev1.Probe, policy Policy) bool {
+	merged := mergeProbe(*target, probe, policy)
+	if equality.Semantic.DeepEqual(*target, merged) {
+		return false
+	}
+	*target = merged
+	return true
+}
+
+// SetReadinessProbe sets the readiness probe of the container, and returns true if it changed
+func SetReadinessProbe(c *corev1.Container, probe corev1.Probe, policy Policy) bool {
+	return setProbe(&c.ReadinessProbe, probe, policy)
+}
+
+// SetLivenessProbe sets the liveness probe of the container, and returns true if it changed
+func SetLivenessProbe(c *corev1.Container, probe corev1.Probe, policy Policy) bool {
+	return setProbe(&c.LivenessProbe, probe, policy)
+}
+
+// SetStartupProbe sets the startup probe of the container, and returns true if it changed
+func SetStartupProbe(c *corev1.Container, probe corev1.Probe, policy Policy) bool {
+	return setProbe(&c.StartupProbe, probe, policy)
+}
+
+// shellQuote quotes an argument for /bin/sh
+func shellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
+
+func shellCommand(command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// chainExec returns an exec handler running the commands of a and b one after the other. A command which
+// is already chained is not added again, so that chaining is idempotent.
+func chainExec(a, b *corev1.ExecAction) *corev1.ExecAction {
+	first, second := shellCommand(a.Command), shellCommand(b.Command)
+	if len(a.Command) == 3 && a.Command[0] == "/bin/sh" && a.Command[1] == "-c" {
+		first = a.Command[2]
+	}
+	if strings.Contains(first, second) {
+		return a
+	}
+	return &corev1.ExecAction{Command: []string{"/bin/sh", "-c", fmt.Sprintf("%s; %s", first, second)}}
+}
+
+// mergeHandler returns the hook handler to set on the container, given the current one
+func mergeHandler(current *corev1.Handler, handler corev1.Handler, policy Policy) *corev1.Handler {
+	if current == nil || policy == Replace {
+		return &handler
+	}
+	if policy == KeepExisting || current.Exec == nil || handler.Exec == nil {
+		return current
+	}
+	return &corev1.Handler{Exec: chainExec(current.Exec, handler.Exec)}
+}
+
+func ensureLifecycle(c *corev1.Container) *corev1.Lifecycle {
+	if c.Lifecycle == nil {
+		c.Lifecycle = &corev1.Lifecycle{}
+	}
+	return c.Lifecycle
+}
+
+// SetPreStop sets the preStop hook of the container, and returns true if it changed
+func SetPreStop(c *corev1.Container, handler corev1.Handler, policy Policy) bool {
+	var current *corev1.Handler
+	if c.Lifecycle != nil {
+		current = c.Lifecycle.PreStop
+	}
+	merged := mergeHandler(current, handler, policy)
+	if equality.Semantic.DeepEqual(current, merged) {
+		return false
+	}
+	ensureLifecycle(c).PreStop = merged
+	return true
+}
+
+// SetPostStart sets the postStart hook of the container, and returns true if it changed
+func SetPostStart(c *corev1.Container, handler corev1.Handler, policy Policy) bool {
+	var current *corev1.Handler
+	if c.Lifecycle != nil {
+		current = c.Lifecycle.PostStart
+	}
+	merged := mergeHandler(current, handler, policy)
+	if equality.Semantic.DeepEqual(current, merged) {
+		return false
+	}
+	ensureLifecycle(c).PostStart = merged
+	return true
+}
+
+// AddPreStopSleep delays the termination of the container by the given seconds, so that it keeps serving
+// while the endpoints are updated and the routers stop sending it traffic. The sleep runs after an existing
+// exec preStop hook, other existing hooks are kept, and the termination grace period of the pod is raised
+// to cover it.
+func AddPreStopSleep(pod *corev1.Pod, c *corev1.Container, seconds int64) bool {
+	sleep := corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"sleep", fmt.Sprint(seconds)}}}
+	changed := SetPreStop(c, sleep, Merge)
+	return EnsureTerminationGracePeriod(pod, seconds) || changed
+}
+
+// EnsureTerminationGracePeriod raises the termination grace period of the pod to at least the given seconds,
+// and returns true if it changed
+func EnsureTerminationGracePeriod(pod *corev1.Pod, seconds int64) bool {
+	current := int64(corev1.DefaultTerminationGracePeriodSeconds)
+	if pod.Spec.TerminationGracePeriodSeconds != nil {
+		current = *pod.Spec.TerminationGracePeriodSeconds
+	}
+	if current >= seconds {
+		return false
+	}
+	pod.Spec.TerminationGracePeriodSeconds = &seconds
+	return true
+}
@@ -0,0 +1,95 @@
+package lifecycle_test
+
+import (
+	. "code.cloudfoundry.org/eirinix/util/lifecycle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("Lifecycle helpers", func() {
+	var (
+		pod *corev1.Pod
+		app *corev1.Container
+	)
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "sidecar"},
+			{
+				Name: AppContainerName,
+				ReadinessProbe: &corev1.Probe{
+					Handler:          corev1.Handler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(8080)}},
+					FailureThreshold: 1,
+				},
+			},
+		}}}
+		app = AppContainer(pod)
+	})
+
+	It("finds the app container", func() {
+		Expect(app).ToNot(BeNil())
+		Expect(app.Name).To(Equal(AppContainerName))
+		Expect(AppContainer(&corev1.Pod{})).To(BeNil())
+	})
+
+	Context("probes", func() {
+		httpProbe := corev1.Probe{
+			Handler:          corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/health", Port: intstr.FromInt(8080)}},
+			FailureThreshold: 5,
+		}
+
+		It("keeps an existing probe", func() {
+			Expect(SetReadinessProbe(app, httpProbe, KeepExisting)).To(BeFalse())
+			Expect(app.ReadinessProbe.TCPSocket).ToNot(BeNil())
+		})
+
+		It("merges the timings into an existing probe", func() {
+			Expect(SetReadinessProbe(app, httpProbe, Merge)).To(BeTrue())
+			Expect(app.ReadinessProbe.TCPSocket).ToNot(BeNil())
+			Expect(app.ReadinessProbe.HTTPGet).To(BeNil())
+			Expect(app.ReadinessProbe.FailureThreshold).To(Equal(int32(5)))
+			Expect(SetReadinessProbe(app, httpProbe, Merge)).To(BeFalse())
+		})
+
+		It("replaces an existing probe", func() {
+			Expect(SetReadinessProbe(app, httpProbe, Replace)).To(BeTrue())
+			Expect(app.ReadinessProbe.HTTPGet.Path).To(Equal("/health"))
+		})
+
+		It("sets a missing probe whatever the policy", func() {
+			Expect(SetLivenessProbe(app, httpProbe, KeepExisting)).To(BeTrue())
+			Expect(SetStartupProbe(app, httpProbe, Merge)).To(BeTrue())
+			Expect(app.LivenessProbe.HTTPGet.Path).To(Equal("/health"))
+			Expect(app.StartupProbe.HTTPGet.Path).To(Equal("/health"))
+		})
+	})
+
+	Context("hooks", func() {
+		drain := corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"/usr/bin/drain", "it's done"}}}
+
+		It("chains exec hooks", func() {
+			Expect(SetPreStop(app, drain, Merge)).To(BeTrue())
+			Expect(AddPreStopSleep(pod, app, 10)).To(BeTrue())
+
+			Expect(app.Lifecycle.PreStop.Exec.Command).To(Equal([]string{"/bin/sh", "-c", `'/usr/bin/drain' 'it'"'"'s done'; 'sleep' '10'`}))
+			Expect(AddPreStopSleep(pod, app, 10)).To(BeFalse())
+			Expect(SetPreStop(app, drain, Merge)).To(BeFalse())
+		})
+
+		It("keeps the hooks which can't be chained", func() {
+			get := corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/drain", Port: intstr.FromInt(8080)}}
+			Expect(SetPostStart(app, get, Merge)).To(BeTrue())
+			Expect(SetPostStart(app, drain, Merge)).To(BeFalse())
+			Expect(SetPostStart(app, drain, Replace)).To(BeTrue())
+			Expect(app.Lifecycle.PostStart.Exec).ToNot(BeNil())
+		})
+
+		It("raises the termination grace period to cover the sleep", func() {
+			Expect(AddPreStopSleep(pod, app, 45)).To(BeTrue())
+			Expect(*pod.Spec.TerminationGracePeriodSeconds).To(Equal(int64(45)))
+			Expect(EnsureTerminationGracePeriod(pod, 20)).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,87 @@
+// Package mutationclient queries the status server of an eirinix operator, from other platform services, for
+// whether the pods of an app were mutated by an extension and with which configuration, and whether a one-time
+// action was done for the app.
+package mutationclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"github.com/pkg/errors"
+)
+
+// Client queries the mutations endpoint of the status server of an operator, see ManagerOptions.StatusBindAddress
+type Client struct {
+	// BaseURL is the URL of the status server, e.g. http://eirini-x.cf.svc:8080
+	BaseURL string
+	// HTTPClient sends the requests. Optional, defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the status server at the base URL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL}
+}
+
+// Mutations returns the mutation status of the pods of the app by the extension with the config key
+func (c *Client) Mutations(ctx context.Context, appGUID, extension string) (*eirinix.MutationStatus, error) {
+	return c.get(ctx, url.Values{"app": {appGUID}, "extension": {extension}})
+}
+
+// ActionDone returns the mutation status of the pods of the app by the extension with the config key, and
+// whether the one-time action was done for the app, see Ledger.Once
+func (c *Client) ActionDone(ctx context.Context, appGUID, extension, action string) (*eirinix.MutationStatus, error) {
+	return c.get(ctx, url.Values{"app": {appGUID}, "extension": {extension}, "action": {action}})
+}
+
+func (c *Client) get(ctx context.Context, query url.Values) (*eirinix.MutationStatus, error) {
+	u := strings.TrimSuffix(c.BaseURL, "/") + eirinix.MutationsPath + "?" + query.Encode()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "building the request")
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "querying the mutations")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the mutations")
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &StatusError{Code: res.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	status := &eirinix.MutationStatus{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return nil, errors.Wrap(err, "decoding the mutations")
+	}
+	return status, nil
+}
+
+// StatusError is returned when the status server answers with an error, e.g. a 404 for an unknown extension
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("The status server answered %d: %s", e.Code, e.Message)
+}
+
+// IsUnknownExtension returns true if the error tells that no extension of the operator has the config key
+func IsUnknownExtension(err error) bool {
+	e, ok := errors.Cause(err).(*StatusError)
+	return ok && e.Code == http.StatusNotFound
+}
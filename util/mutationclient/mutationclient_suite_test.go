@@ -0,0 +1,13 @@
+package mutationclient_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMutationclient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Mutationclient Suite")
+}
@@ -0,0 +1,63 @@
+package mutationclient_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	. "code.cloudfoundry.org/eirinix/util/mutationclient"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mutation client", func() {
+	var (
+		server *httptest.Server
+		query  url.Values
+		client *Client
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal(eirinix.MutationsPath))
+			query = r.URL.Query()
+			if query.Get("extension") != "sidecar" {
+				http.Error(w, "no extension", http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"appGUID": "guid", "extension": "sidecar", "action": "register", "actionDone": true,
+				"pods": [{"namespace": "eirini", "name": "dora-0", "mutated": true, "configHash": "old", "currentConfigHash": "new", "stale": true}]}`))
+		}))
+		client = New(server.URL + "/")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("decodes the mutation status of the app", func() {
+		status, err := client.Mutations(context.Background(), "guid", "sidecar")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(query.Get("app")).To(Equal("guid"))
+		Expect(query.Get("action")).To(BeEmpty())
+		Expect(status.Pods).To(HaveLen(1))
+		Expect(status.Pods[0].Name).To(Equal("dora-0"))
+		Expect(status.Pods[0].Stale).To(BeTrue())
+	})
+
+	It("asks whether the action was done", func() {
+		status, err := client.ActionDone(context.Background(), "guid", "sidecar", "register")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(query.Get("action")).To(Equal("register"))
+		Expect(status.ActionDone).To(BeTrue())
+	})
+
+	It("tells the unknown extensions apart", func() {
+		_, err := client.Mutations(context.Background(), "guid", "unknown")
+		Expect(err).To(HaveOccurred())
+		Expect(IsUnknownExtension(err)).To(BeTrue())
+		Expect(err.(*StatusError).Message).To(Equal("no extension"))
+	})
+})
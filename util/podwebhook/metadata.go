@@ -0,0 +1,132 @@
+package podwebhook
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// TotalAnnotationSizeLimit is the maximum size of the annotations of a pod, keys and values included, enforced
+// by the API server
+const TotalAnnotationSizeLimit = 256 * 1024
+
+// ReservedDomains are the domains whose label and annotation key prefixes (including their subdomains) are
+// reserved to the kubernetes components
+var ReservedDomains = []string{"kubernetes.io", "k8s.io"}
+
+// IsReservedKey returns true if the prefix of the label or annotation key is in one of the ReservedDomains
+func IsReservedKey(key string) bool {
+	i := strings.Index(key, "/")
+	if i < 0 {
+		return false
+	}
+	prefix := key[:i]
+	for _, domain := range ReservedDomains {
+		if prefix == domain || strings.HasSuffix(prefix, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateLabel returns an error listing why the API server would reject the label: the key must be a
+// qualified name, e.g. eirinix.cloudfoundry.org/sidecar, outside of the ReservedDomains, and the value at
+// most 63 alphanumeric characters, '-', '_' or '.'
+func ValidateLabel(key, value string) error {
+	msgs := validateKey(key)
+	for _, msg := range validation.IsValidLabelValue(value) {
+		msgs = append(msgs, "value: "+msg)
+	}
+	if len(msgs) > 0 {
+		return errors.Errorf("Invalid label %s=%q: %s", key, value, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// ValidateAnnotation returns an error listing why the API server would reject the annotation key, which must
+// be a qualified name outside of the ReservedDomains. The size of the values is checked by SetAnnotation.
+func ValidateAnnotation(key string) error {
+	if msgs := validateKey(key); len(msgs) > 0 {
+		return errors.Errorf("Invalid annotation %s: %s", key, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+func validateKey(key string) []string {
+	var msgs []string
+	for _, msg := range validation.IsQualifiedName(key) {
+		msgs = append(msgs, "key: "+msg)
+	}
+	if IsReservedKey(key) {
+		msgs = append(msgs, "key: the prefix is reserved to the kubernetes components ("+strings.Join(ReservedDomains, ", ")+")")
+	}
+	return msgs
+}
+
+// SetLabel sets the label of the pod, or returns the error of ValidateLabel leaving the pod unchanged
+func SetLabel(pod *corev1.Pod, key, value string) error {
+	if err := ValidateLabel(key, value); err != nil {
+		return err
+	}
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[key] = value
+	return nil
+}
+
+// SetAnnotation sets the annotation of the pod, or returns an error leaving the pod unchanged if the key is
+// invalid or the annotations would exceed TotalAnnotationSizeLimit
+func SetAnnotation(pod *corev1.Pod, key, value string) error {
+	if err := ValidateAnnotation(key); err != nil {
+		return err
+	}
+	size := len(key) + len(value)
+	for k, v := range pod.Annotations {
+		if k != key {
+			size += len(k) + len(v)
+		}
+	}
+	if size > TotalAnnotationSizeLimit {
+		return errors.Errorf("Setting the annotation %s would make the annotations of the pod %d bytes, larger than the %d bytes the API server accepts", key, size, TotalAnnotationSizeLimit)
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[key] = value
+	return nil
+}
+
+// LabelPatch returns the patch operation setting the label on the pod, once validated like SetLabel. The
+// operation adds the whole labels map if the pod has none.
+func LabelPatch(pod *corev1.Pod, key, value string) (Patch, error) {
+	if err := ValidateLabel(key, value); err != nil {
+		return Patch{}, err
+	}
+	return metadataPatch("labels", pod.Labels, key, value), nil
+}
+
+// AnnotationPatch returns the patch operation setting the annotation on the pod, once validated like
+// SetAnnotation. The operation adds the whole annotations map if the pod has none.
+func AnnotationPatch(pod *corev1.Pod, key, value string) (Patch, error) {
+	if err := SetAnnotation(pod.DeepCopy(), key, value); err != nil {
+		return Patch{}, err
+	}
+	return metadataPatch("annotations", pod.Annotations, key, value), nil
+}
+
+func metadataPatch(field string, existing map[string]string, key, value string) Patch {
+	if len(existing) == 0 {
+		return jsonpatch.NewOperation("add", "/metadata/"+field, map[string]string{key: value})
+	}
+	return jsonpatch.NewOperation("add", "/metadata/"+field+"/"+EscapeJSONPointer(key), value)
+}
+
+// EscapeJSONPointer escapes a map key, e.g. a label or annotation key, to be used in the path of a patch
+// operation
+func EscapeJSONPointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
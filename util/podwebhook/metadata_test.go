@@ -0,0 +1,81 @@
+package podwebhook_test
+
+import (
+	"strings"
+
+	. "code.cloudfoundry.org/eirinix/util/podwebhook"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Pod metadata helpers", func() {
+	var pod *corev1.Pod
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+	})
+
+	It("validates the labels", func() {
+		Expect(ValidateLabel("eirinix.cloudfoundry.org/sidecar", "enabled")).To(Succeed())
+		Expect(ValidateLabel("sidecar", "")).To(Succeed())
+
+		err := ValidateLabel("not a key", strings.Repeat("a", 64))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("key: name part must consist of alphanumeric characters"))
+		Expect(err.Error()).To(ContainSubstring("value: must be no more than 63 characters"))
+
+		Expect(ValidateLabel("app", "my app")).To(MatchError(ContainSubstring("value: a valid label must be")))
+	})
+
+	It("refuses the reserved prefixes", func() {
+		Expect(IsReservedKey("kubernetes.io/hostname")).To(BeTrue())
+		Expect(IsReservedKey("node.kubernetes.io/instance-type")).To(BeTrue())
+		Expect(IsReservedKey("k8s.io/name")).To(BeTrue())
+		Expect(IsReservedKey("notkubernetes.io/name")).To(BeFalse())
+		Expect(IsReservedKey("kubernetes.io")).To(BeFalse())
+
+		Expect(ValidateAnnotation("node.kubernetes.io/sidecar")).To(MatchError(ContainSubstring("the prefix is reserved")))
+		Expect(ValidateAnnotation("eirinix.cloudfoundry.org/sidecar")).To(Succeed())
+	})
+
+	It("sets the valid labels and annotations only", func() {
+		Expect(SetLabel(pod, "eirinix.cloudfoundry.org/sidecar", "enabled")).To(Succeed())
+		Expect(SetLabel(pod, "eirinix.cloudfoundry.org/sidecar", "not valid")).NotTo(Succeed())
+		Expect(pod.Labels).To(Equal(map[string]string{"eirinix.cloudfoundry.org/sidecar": "enabled"}))
+
+		Expect(SetAnnotation(pod, "eirinix.cloudfoundry.org/config", "{}")).To(Succeed())
+		Expect(SetAnnotation(pod, "kubernetes.io/config", "{}")).NotTo(Succeed())
+		Expect(pod.Annotations).To(Equal(map[string]string{"eirinix.cloudfoundry.org/config": "{}"}))
+	})
+
+	It("keeps the annotations under the size limit", func() {
+		half := strings.Repeat("a", TotalAnnotationSizeLimit/2)
+		Expect(SetAnnotation(pod, "first", half)).To(Succeed())
+		err := SetAnnotation(pod, "second", half)
+		Expect(err).To(MatchError(ContainSubstring("larger than the 262144 bytes the API server accepts")))
+		Expect(pod.Annotations).To(HaveLen(1))
+
+		// Replacing an annotation doesn't count its previous value
+		Expect(SetAnnotation(pod, "first", half)).To(Succeed())
+	})
+
+	It("builds the patch operations", func() {
+		op, err := LabelPatch(pod, "eirinix.cloudfoundry.org/sidecar", "enabled")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(op.Path).To(Equal("/metadata/labels"))
+		Expect(op.Value).To(Equal(map[string]string{"eirinix.cloudfoundry.org/sidecar": "enabled"}))
+
+		pod.Annotations = map[string]string{"existing": "true"}
+		op, err = AnnotationPatch(pod, "eirinix.cloudfoundry.org/sidecar", "enabled")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(op.Operation).To(Equal("add"))
+		Expect(op.Path).To(Equal("/metadata/annotations/eirinix.cloudfoundry.org~1sidecar"))
+		Expect(op.Value).To(Equal("enabled"))
+		Expect(pod.Annotations).To(HaveLen(1))
+
+		_, err = LabelPatch(pod, "kubernetes.io/sidecar", "enabled")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,51 @@
+package podwebhook
+
+import (
+	"encoding/json"
+
+	jsonpatchapply "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+)
+
+// MinimizePatches drops the operations of a patch which don't change the object, e.g. the ones setting a
+// field to its current value, or adding an empty field the object type omits. The operations are applied
+// one by one to the original object, which is decoded into a new object (e.g. a *corev1.Pod) after each of
+// them and compared with the previous one, so that the differences of JSON representation are ignored.
+//
+// If an operation can't be applied once a previous one was dropped, the patch is returned whole.
+func MinimizePatches(original []byte, ops []Patch, newObject func() interface{}) ([]Patch, error) {
+	current := newObject()
+	if err := json.Unmarshal(original, current); err != nil {
+		return nil, errors.Wrap(err, "decoding the original object")
+	}
+
+	doc := original
+	kept := make([]Patch, 0, len(ops))
+	for _, op := range ops {
+		raw, err := json.Marshal([]Patch{op})
+		if err != nil {
+			return nil, errors.Wrapf(err, "encoding the %s operation of %s", op.Operation, op.Path)
+		}
+		p, err := jsonpatchapply.DecodePatch(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding the %s operation of %s", op.Operation, op.Path)
+		}
+		patched, err := p.Apply(doc)
+		if err != nil {
+			return ops, nil
+		}
+
+		next := newObject()
+		if err := json.Unmarshal(patched, next); err != nil {
+			// The API server rejects the object the same way, which the whole patch shows
+			return ops, nil
+		}
+		if apiequality.Semantic.DeepEqual(current, next) {
+			continue
+		}
+		kept = append(kept, op)
+		doc, current = patched, next
+	}
+	return kept, nil
+}
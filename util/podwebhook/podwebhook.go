@@ -0,0 +1,139 @@
+// Package podwebhook contains the helpers used by the eirinix webhooks to decode the admitted pods, compute
+// the patches of the extensions and build the admission responses.
+//
+// It only depends on the kubernetes types and on the controller-runtime admission package, so that webhooks
+// which are not built with eirinix can reuse it without pulling in the dependencies of the Manager.
+package podwebhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Patch is a JSON patch operation
+type Patch = jsonpatch.JsonPatchOperation
+
+// ErrNoDecoder is returned by DecodePod when no decoder is given
+var ErrNoDecoder = errors.New("No decoder injected")
+
+// DecodePod decodes the pod of the request. In strict mode, fields unknown to the pod type are an error,
+// e.g. when the cluster is newer than the types the webhook was built with.
+func DecodePod(decoder *admission.Decoder, strict bool, req admission.Request, pod *corev1.Pod) error {
+	if decoder == nil {
+		return ErrNoDecoder
+	}
+	if !strict {
+		return decoder.Decode(req, pod)
+	}
+	if len(req.Object.Raw) == 0 {
+		return errors.New("There is no content to decode")
+	}
+
+	d := json.NewDecoder(bytes.NewReader(req.Object.Raw))
+	d.DisallowUnknownFields()
+	return errors.Wrap(d.Decode(pod), "strict decoding")
+}
+
+// PatchFromPod returns a response admitting the request with the patch turning its pod into the given one
+func PatchFromPod(req admission.Request, pod *corev1.Pod) admission.Response {
+	return PatchFromObject(req, pod)
+}
+
+// PatchFromObject returns a response admitting the request with the patch turning its object into the given
+// one, e.g. a PersistentVolume decoded from the request of a cluster-scoped webhook
+func PatchFromObject(req admission.Request, obj interface{}) admission.Response {
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	marshaled, err = normalizeCreationTimestamp(req.Object.Raw, marshaled)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// normalizeCreationTimestamp drops the null creationTimestamp the zero metav1.Time is encoded to, when the
+// original object has none, so that the patch doesn't carry an operation adding it
+func normalizeCreationTimestamp(original, marshaled []byte) ([]byte, error) {
+	if !bytes.Contains(marshaled, []byte(`"creationTimestamp":null`)) {
+		return marshaled, nil
+	}
+	var previous struct {
+		Metadata map[string]json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal(original, &previous); err != nil {
+		// The original object can't be diffed either, PatchResponseFromRaw returns the error
+		return marshaled, nil
+	}
+	if _, ok := previous.Metadata["creationTimestamp"]; ok {
+		return marshaled, nil
+	}
+
+	var object, metadata map[string]json.RawMessage
+	if err := json.Unmarshal(marshaled, &object); err != nil {
+		return nil, errors.Wrap(err, "decoding the marshaled object")
+	}
+	if err := json.Unmarshal(object["metadata"], &metadata); err != nil {
+		return nil, errors.Wrap(err, "decoding the metadata of the marshaled object")
+	}
+	if string(metadata["creationTimestamp"]) != "null" {
+		return marshaled, nil
+	}
+	delete(metadata, "creationTimestamp")
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	object["metadata"] = raw
+	return json.Marshal(object)
+}
+
+// ResponsePatches returns the patch operations of the response, decoding its raw patch if needed
+func ResponsePatches(res admission.Response) ([]Patch, error) {
+	ops := res.Patches
+	if len(ops) == 0 && len(res.Patch) > 0 {
+		if err := json.Unmarshal(res.Patch, &ops); err != nil {
+			return nil, err
+		}
+	}
+	return ops, nil
+}
+
+// SortPatches sorts JSON patch operations by path, so that patches computed by diffing
+// two objects are stable. The relative order of operations on the elements of a same
+// array is kept, as their indexes depend on each other.
+func SortPatches(ops []Patch) {
+	sort.SliceStable(ops, func(i, j int) bool {
+		a := strings.Split(ops[i].Path, "/")
+		b := strings.Split(ops[j].Path, "/")
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] == b[k] {
+				continue
+			}
+			if isArrayIndex(a[k]) && isArrayIndex(b[k]) {
+				return false
+			}
+			return a[k] < b[k]
+		}
+		return false
+	})
+}
+
+func isArrayIndex(segment string) bool {
+	if segment == "-" {
+		return true
+	}
+	_, err := strconv.Atoi(segment)
+	return err == nil
+}
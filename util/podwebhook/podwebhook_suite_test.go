@@ -0,0 +1,13 @@
+package podwebhook_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPodWebhook(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "PodWebhook Suite")
+}
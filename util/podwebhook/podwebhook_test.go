@@ -0,0 +1,100 @@
+package podwebhook_test
+
+import (
+	. "code.cloudfoundry.org/eirinix/util/podwebhook"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Pod webhook helpers", func() {
+	var (
+		req     admission.Request
+		decoder *admission.Decoder
+	)
+
+	BeforeEach(func() {
+		raw := []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"app-0"},"spec":{"containers":[{"name":"opi","image":"busybox"}],"newField":true}}`)
+		req = admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{Object: runtime.RawExtension{Raw: raw}}}
+		var err error
+		decoder, err = admission.NewDecoder(scheme.Scheme)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("decodes the pod leniently or strictly", func() {
+		pod := &corev1.Pod{}
+		Expect(DecodePod(decoder, false, req, pod)).To(Succeed())
+		Expect(pod.Name).To(Equal("app-0"))
+
+		err := DecodePod(decoder, true, req, &corev1.Pod{})
+		Expect(err).To(MatchError(ContainSubstring("newField")))
+		Expect(DecodePod(nil, false, req, pod)).To(Equal(ErrNoDecoder))
+	})
+
+	It("computes sorted patches from the updated pod", func() {
+		pod := &corev1.Pod{}
+		Expect(DecodePod(decoder, false, req, pod)).To(Succeed())
+		pod.Labels = map[string]string{"patched": "yes"}
+		pod.Spec.Containers[0].Image = "alpine"
+
+		res := PatchFromPod(req, pod)
+		Expect(res.Allowed).To(BeTrue())
+		ops, err := ResponsePatches(res)
+		Expect(err).ToNot(HaveOccurred())
+		SortPatches(ops)
+
+		var paths []string
+		for _, op := range ops {
+			paths = append(paths, op.Path)
+		}
+		Expect(paths).To(ContainElement("/metadata/labels"))
+		Expect(paths).To(ContainElement("/spec/containers/0/image"))
+		Expect(paths).ToNot(ContainElement("/metadata/creationTimestamp"))
+		Expect(paths[0]).To(Equal("/metadata/labels"))
+	})
+
+	It("decodes the raw patch of a response", func() {
+		res := admission.Response{AdmissionResponse: admissionv1beta1.AdmissionResponse{
+			Patch: []byte(`[{"op":"add","path":"/metadata/labels","value":{"a":"b"}}]`),
+		}}
+		ops, err := ResponsePatches(res)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ops).To(HaveLen(1))
+		Expect(ops[0].Operation).To(Equal("add"))
+	})
+
+	Context("minimizing the patches", func() {
+		newPod := func() interface{} { return &corev1.Pod{} }
+
+		It("drops the operations which don't change the pod", func() {
+			ops := []Patch{
+				{Operation: "replace", Path: "/spec/containers/0/image", Value: "busybox"},
+				{Operation: "add", Path: "/spec/containers/0/resources", Value: map[string]interface{}{}},
+				{Operation: "add", Path: "/metadata/labels", Value: map[string]interface{}{"patched": "yes"}},
+				{Operation: "remove", Path: "/spec/newField"},
+			}
+			kept, err := MinimizePatches(req.Object.Raw, ops, newPod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kept).To(Equal([]Patch{ops[2]}))
+		})
+
+		It("keeps the whole patch when an operation depends on a dropped one", func() {
+			ops := []Patch{
+				{Operation: "add", Path: "/metadata/annotations", Value: map[string]interface{}{}},
+				{Operation: "add", Path: "/metadata/annotations/patched", Value: "yes"},
+			}
+			kept, err := MinimizePatches(req.Object.Raw, ops, newPod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(kept).To(Equal(ops))
+		})
+
+		It("fails with an invalid original object", func() {
+			_, err := MinimizePatches([]byte("{"), nil, newPod)
+			Expect(err).To(MatchError(ContainSubstring("decoding the original object")))
+		})
+	})
+})
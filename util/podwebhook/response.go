@@ -0,0 +1,132 @@
+package podwebhook
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// MaxWarningLength is the length above which the warnings are truncated, as the API server may drop them
+const MaxWarningLength = 256
+
+// ResponseBuilder builds admission responses using the whole AdmissionReview response surface:
+// warnings shown by kubectl, a structured status with reason and causes, audit annotations and patches
+type ResponseBuilder struct {
+	res admission.Response
+}
+
+// Allow starts building a response admitting the request unchanged
+func Allow() *ResponseBuilder {
+	return &ResponseBuilder{res: admission.Allowed("")}
+}
+
+// Deny starts building a response denying the request with a 403 status
+func Deny(reason metav1.StatusReason, message string) *ResponseBuilder {
+	return &ResponseBuilder{res: admission.Response{AdmissionResponse: admissionv1beta1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusForbidden,
+			Reason:  reason,
+			Message: message,
+		},
+	}}}
+}
+
+// PatchPod starts building a response admitting the request with the patch turning its pod into the given one
+func PatchPod(req admission.Request, pod *corev1.Pod) *ResponseBuilder {
+	return &ResponseBuilder{res: PatchFromPod(req, pod)}
+}
+
+// FromResponse starts building on top of an existing response, e.g. the one of PatchFromPod
+func FromResponse(res admission.Response) *ResponseBuilder {
+	return &ResponseBuilder{res: res}
+}
+
+// WithCode sets the HTTP code of the response status
+func (b *ResponseBuilder) WithCode(code int32) *ResponseBuilder {
+	b.status().Code = code
+	return b
+}
+
+// WithMessage sets the message of the response status
+func (b *ResponseBuilder) WithMessage(message string) *ResponseBuilder {
+	b.status().Message = message
+	return b
+}
+
+// WithCause adds a cause to the details of the response status, pointing the developer at the field to fix
+func (b *ResponseBuilder) WithCause(field string, causeType metav1.CauseType, message string) *ResponseBuilder {
+	status := b.status()
+	if status.Details == nil {
+		status.Details = &metav1.StatusDetails{}
+	}
+	status.Details.Causes = append(status.Details.Causes, metav1.StatusCause{Type: causeType, Field: field, Message: message})
+	return b
+}
+
+// WithWarning adds a warning, shown to the client even when the request is admitted. Warnings are
+// trimmed to a single printable line of at most MaxWarningLength characters, and empty ones are dropped.
+func (b *ResponseBuilder) WithWarning(format string, args ...interface{}) *ResponseBuilder {
+	if w := sanitizeWarning(fmt.Sprintf(format, args...)); w != "" {
+		b.res.Warnings = append(b.res.Warnings, w)
+	}
+	return b
+}
+
+// WithAuditAnnotation adds an annotation to the audit event of the request
+func (b *ResponseBuilder) WithAuditAnnotation(key, value string) *ResponseBuilder {
+	if b.res.AuditAnnotations == nil {
+		b.res.AuditAnnotations = map[string]string{}
+	}
+	b.res.AuditAnnotations[key] = value
+	return b
+}
+
+// Response returns the built response. Responses with patches always have a patch type, which the
+// admission v1 API requires.
+func (b *ResponseBuilder) Response() admission.Response {
+	res := b.res
+	if (len(res.Patches) > 0 || len(res.Patch) > 0) && res.PatchType == nil {
+		pt := admissionv1beta1.PatchTypeJSONPatch
+		res.PatchType = &pt
+	}
+	return res
+}
+
+func (b *ResponseBuilder) status() *metav1.Status {
+	if b.res.Result == nil {
+		b.res.Result = &metav1.Status{}
+	}
+	if b.res.Result.Status == "" {
+		b.res.Result.Status = metav1.StatusSuccess
+		if !b.res.Allowed {
+			b.res.Result.Status = metav1.StatusFailure
+		}
+	}
+	return b.res.Result
+}
+
+func sanitizeWarning(w string) string {
+	w = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return ' '
+		}
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, w)
+	w = strings.TrimSpace(w)
+
+	if runes := []rune(w); len(runes) > MaxWarningLength {
+		w = string(runes[:MaxWarningLength-3]) + "..."
+	}
+	return w
+}
@@ -0,0 +1,80 @@
+package podwebhook_test
+
+import (
+	"net/http"
+	"strings"
+
+	. "code.cloudfoundry.org/eirinix/util/podwebhook"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Response builder", func() {
+	It("denies with a structured status", func() {
+		res := Deny(metav1.StatusReasonInvalid, "image not allowed").
+			WithCode(http.StatusUnprocessableEntity).
+			WithCause("spec.containers[0].image", metav1.CauseTypeFieldValueNotSupported, "registry.example.com is not trusted").
+			Response()
+
+		Expect(res.Allowed).To(BeFalse())
+		Expect(res.Result.Status).To(Equal(metav1.StatusFailure))
+		Expect(res.Result.Code).To(Equal(int32(http.StatusUnprocessableEntity)))
+		Expect(res.Result.Reason).To(Equal(metav1.StatusReasonInvalid))
+		Expect(res.Result.Message).To(Equal("image not allowed"))
+		Expect(res.Result.Details.Causes).To(Equal([]metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldValueNotSupported,
+			Field:   "spec.containers[0].image",
+			Message: "registry.example.com is not trusted",
+		}}))
+	})
+
+	It("allows with warnings and audit annotations", func() {
+		res := Allow().
+			WithWarning("memory limit %dMi is below the recommended %dMi", 64, 256).
+			WithWarning(" \n ").
+			WithAuditAnnotation("eirinix/checked", "true").
+			Response()
+
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Warnings).To(Equal([]string{"memory limit 64Mi is below the recommended 256Mi"}))
+		Expect(res.AuditAnnotations).To(HaveKeyWithValue("eirinix/checked", "true"))
+		Expect(res.PatchType).To(BeNil())
+	})
+
+	It("keeps the warnings on a single line of bounded length", func() {
+		res := Allow().WithWarning("first line\nsecond\x07line " + strings.Repeat("x", 300)).Response()
+
+		Expect(res.Warnings).To(HaveLen(1))
+		Expect(res.Warnings[0]).To(HavePrefix("first line secondline x"))
+		Expect(res.Warnings[0]).To(HaveSuffix("..."))
+		Expect([]rune(res.Warnings[0])).To(HaveLen(MaxWarningLength))
+	})
+
+	It("sets the patch type of the patches", func() {
+		raw := []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"app-0"},"spec":{"containers":[{"name":"opi","image":"busybox"}]}}`)
+		req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{Object: runtime.RawExtension{Raw: raw}}}
+		pod := &corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: "app-0", Labels: map[string]string{"patched": "true"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "opi", Image: "busybox"}}},
+		}
+
+		res := PatchPod(req, pod).WithWarning("labels patched").Response()
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Patches).ToNot(BeEmpty())
+		Expect(res.PatchType).ToNot(BeNil())
+		Expect(*res.PatchType).To(Equal(admissionv1beta1.PatchTypeJSONPatch))
+		Expect(res.Warnings).To(ConsistOf("labels patched"))
+	})
+
+	It("builds on top of an existing response", func() {
+		res := FromResponse(admission.Denied("no")).WithMessage("denied by policy").Response()
+		Expect(res.Allowed).To(BeFalse())
+		Expect(res.Result.Message).To(Equal("denied by policy"))
+	})
+})
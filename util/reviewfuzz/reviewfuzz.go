@@ -0,0 +1,256 @@
+// Package reviewfuzz generates randomized Eirini-like pods and admission requests, and runs them against an
+// extension, reporting the panics and the invalid patches. It can be used from a property-based test, with
+// Run, or from go-fuzz and the native fuzzing of go test, with Fuzz and Check.
+package reviewfuzz
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
+	jsonpatchapply "github.com/evanphx/json-patch"
+	fuzz "github.com/google/gofuzz"
+	"github.com/pkg/errors"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// nilChance is the probability of the optional fields of the generated pods to be left empty
+	nilChance = 0.3
+	// maxDepth bounds the nesting of the generated pods
+	maxDepth = 8
+)
+
+// Fuzzer runs an extension against randomized requests, built from pods looking like the ones of the Eirini
+// release of the Manager: app or staging pods, with the Eirini labels and annotations and the app container,
+// and random specs.
+type Fuzzer struct {
+	manager   eirinix.Manager
+	extension eirinix.Extension
+}
+
+// New returns a Fuzzer for the extension, called with the Manager. The Manager doesn't need to be started.
+func New(m eirinix.Manager, e eirinix.Extension) *Fuzzer {
+	return &Fuzzer{manager: m, extension: e}
+}
+
+// Failure is the error returned when the extension panicked or answered with an invalid patch
+type Failure struct {
+	// Reason describes the failure
+	Reason string
+	// Request is the request the extension failed on
+	Request admission.Request
+	// Stack is the stack of the panic, if the extension panicked
+	Stack []byte
+}
+
+func (f *Failure) Error() string {
+	request, _ := json.Marshal(f.Request.AdmissionRequest)
+	if len(f.Stack) > 0 {
+		return fmt.Sprintf("%s, on request %s\n%s", f.Reason, request, f.Stack)
+	}
+	return fmt.Sprintf("%s, on request %s", f.Reason, request)
+}
+
+// Run runs the extension against a number of requests generated from the seed, and returns the first
+// failure. The same seed generates the same requests.
+func (f *Fuzzer) Run(seed int64, iterations int) error {
+	fz := newFuzzer(fuzz.NewWithSeed(seed), f.manager.EiriniLayout())
+	for i := 0; i < iterations; i++ {
+		if err := f.review(fz); err != nil {
+			return errors.Wrapf(err, "iteration %d", i)
+		}
+	}
+	return nil
+}
+
+// Check runs the extension against the request generated from the fuzzing data, e.g. from the function
+// passed to testing.F.Fuzz, and returns the failure
+func (f *Fuzzer) Check(data []byte) error {
+	return f.review(newFuzzer(fuzz.NewFromGoFuzz(data), f.manager.EiriniLayout()))
+}
+
+// Fuzz is the go-fuzz entry point: it panics with the failure, and returns 1 if the extension patched the
+// pod, to give the input priority
+func (f *Fuzzer) Fuzz(data []byte) int {
+	fz := newFuzzer(fuzz.NewFromGoFuzz(data), f.manager.EiriniLayout())
+	req, err := fz.request()
+	if err != nil {
+		panic(err)
+	}
+	res, err := f.handle(req)
+	if err != nil {
+		panic(err)
+	}
+	if len(res.Patches) > 0 || len(res.Patch) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Request returns the request generated from the fuzzing data, e.g. to reproduce a failure
+func (f *Fuzzer) Request(data []byte) (admission.Request, error) {
+	return newFuzzer(fuzz.NewFromGoFuzz(data), f.manager.EiriniLayout()).request()
+}
+
+func (f *Fuzzer) review(fz *podFuzzer) error {
+	req, err := fz.request()
+	if err != nil {
+		return err
+	}
+	_, err = f.handle(req)
+	return err
+}
+
+// handle calls the extension and checks its response: the patch must apply to the pod, and result in a pod
+func (f *Fuzzer) handle(req admission.Request) (res admission.Response, err error) {
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
+		return res, errors.Wrap(err, "decoding the generated pod")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &Failure{Reason: fmt.Sprintf("The extension panicked: %v", r), Request: req, Stack: debug.Stack()}
+		}
+	}()
+	ctx := ctxlog.NewManagerContext(f.manager.GetLogger())
+	res = f.extension.Handle(ctx, f.manager, pod, req)
+
+	if !res.Allowed {
+		return res, nil
+	}
+	ops, err := podwebhook.ResponsePatches(res)
+	if err != nil {
+		return res, &Failure{Reason: fmt.Sprintf("The patch can't be decoded: %s", err), Request: req}
+	}
+	if len(ops) == 0 {
+		return res, nil
+	}
+	raw, err := json.Marshal(ops)
+	if err != nil {
+		return res, &Failure{Reason: fmt.Sprintf("The patch can't be encoded: %s", err), Request: req}
+	}
+	patch, err := jsonpatchapply.DecodePatch(raw)
+	if err != nil {
+		return res, &Failure{Reason: fmt.Sprintf("The patch is invalid: %s", err), Request: req}
+	}
+	patched, err := patch.Apply(req.Object.Raw)
+	if err != nil {
+		return res, &Failure{Reason: fmt.Sprintf("The patch doesn't apply to the pod: %s", err), Request: req}
+	}
+	if err := json.Unmarshal(patched, &corev1.Pod{}); err != nil {
+		return res, &Failure{Reason: fmt.Sprintf("The patched object is not a pod: %s", err), Request: req}
+	}
+	return res, nil
+}
+
+// podFuzzer generates the pods and the requests
+type podFuzzer struct {
+	fuzzer *fuzz.Fuzzer
+	layout eirinix.EiriniLayout
+}
+
+func newFuzzer(f *fuzz.Fuzzer, layout eirinix.EiriniLayout) *podFuzzer {
+	f = f.NilChance(nilChance).MaxDepth(maxDepth).Funcs(
+		// The random quantities, int-or-strings, times and managed fields can't be encoded, the generated
+		// pods are limited to the ones serializing
+		func(q *resource.Quantity, c fuzz.Continue) {
+			*q = *resource.NewQuantity(c.Int63n(1<<30), resource.DecimalSI)
+		},
+		func(i *intstr.IntOrString, c fuzz.Continue) {
+			if c.RandBool() {
+				*i = intstr.FromInt(c.Intn(65536))
+			} else {
+				*i = intstr.FromString(c.RandString())
+			}
+		},
+		func(q *metav1.Time, c fuzz.Continue) {
+			*q = metav1.Unix(c.Int63n(1<<31), 0)
+		},
+		func(f *metav1.FieldsV1, c fuzz.Continue) {
+			f.Raw = []byte(`{"f:metadata":{}}`)
+		},
+	)
+	return &podFuzzer{fuzzer: f, layout: layout}
+}
+
+// pod returns a random pod, with the labels, annotations and app container of an Eirini pod
+func (p *podFuzzer) pod() *corev1.Pod {
+	pod := &corev1.Pod{}
+	p.fuzzer.Fuzz(pod)
+	pod.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"}
+
+	var guid, space string
+	p.fuzzer.Fuzz(&guid)
+	p.fuzzer.Fuzz(&space)
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	sourceType := p.layout.SourceTypeApp
+	if len(guid)%4 == 0 {
+		sourceType = p.layout.SourceTypeStaging
+	}
+	pod.Labels[p.layout.LabelSourceType] = sourceType
+	pod.Labels[p.layout.LabelGUID] = guid
+	pod.Labels[p.layout.LabelAppGUID] = guid
+	pod.Labels[p.layout.LabelProcessType] = "web"
+	pod.Annotations[p.layout.AnnotationAppName] = pod.Name
+	pod.Annotations[p.layout.AnnotationSpaceGUID] = space
+	pod.Annotations[p.layout.AnnotationSpaceName] = space
+	pod.Annotations[p.layout.AnnotationOrgName] = space
+
+	app := corev1.Container{}
+	p.fuzzer.Fuzz(&app)
+	app.Name = p.layout.AppContainerName
+	pod.Spec.Containers = append([]corev1.Container{app}, pod.Spec.Containers...)
+	return pod
+}
+
+// request returns the creation or the update of a random pod
+func (p *podFuzzer) request() (admission.Request, error) {
+	pod := p.pod()
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Request{}, errors.Wrap(err, "encoding the generated pod")
+	}
+
+	var uid types.UID
+	p.fuzzer.Fuzz(&uid)
+	req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+		UID:       uid,
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Operation: admissionv1beta1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+
+	var update bool
+	p.fuzzer.Fuzz(&update)
+	if update {
+		old := p.pod()
+		old.Name, old.Namespace = pod.Name, pod.Namespace
+		oldRaw, err := json.Marshal(old)
+		if err != nil {
+			return admission.Request{}, errors.Wrap(err, "encoding the generated old pod")
+		}
+		req.Operation = admissionv1beta1.Update
+		req.OldObject = runtime.RawExtension{Raw: oldRaw}
+	}
+	return req, nil
+}
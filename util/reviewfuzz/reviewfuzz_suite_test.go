@@ -0,0 +1,13 @@
+package reviewfuzz_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestReviewFuzz(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ReviewFuzz Suite")
+}
@@ -0,0 +1,82 @@
+package reviewfuzz_test
+
+import (
+	"context"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "code.cloudfoundry.org/eirinix/util/reviewfuzz"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const iterations = 200
+
+type extensionFunc func(*corev1.Pod, admission.Request) admission.Response
+
+func (f extensionFunc) Handle(_ context.Context, _ eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	return f(pod, req)
+}
+
+var _ = Describe("Fuzzer", func() {
+	var m eirinix.Manager
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		m = c.SimpleManager()
+	})
+
+	It("passes the extensions patching the pods", func() {
+		Expect(New(m, &catalog.EditEnvExtension{}).Run(GinkgoRandomSeed(), iterations)).To(Succeed())
+	})
+
+	It("generates Eirini pods", func() {
+		var pods []*corev1.Pod
+		f := New(m, extensionFunc(func(pod *corev1.Pod, req admission.Request) admission.Response {
+			pods = append(pods, pod)
+			return admission.Allowed("")
+		}))
+		Expect(f.Run(GinkgoRandomSeed(), iterations)).To(Succeed())
+
+		layout := m.EiriniLayout()
+		Expect(pods).To(HaveLen(iterations))
+		for _, pod := range pods {
+			Expect(layout.IsApp(pod) || layout.IsStaging(pod)).To(BeTrue())
+			Expect(layout.AppContainer(pod)).NotTo(BeNil())
+		}
+	})
+
+	It("reports the panics", func() {
+		f := New(m, extensionFunc(func(pod *corev1.Pod, req admission.Request) admission.Response {
+			_ = pod.Spec.Containers[1]
+			return admission.Allowed("")
+		}))
+		err := f.Run(GinkgoRandomSeed(), iterations)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("The extension panicked"))
+		Expect(err.Error()).To(ContainSubstring("index out of range"))
+	})
+
+	It("reports the patches which don't apply", func() {
+		f := New(m, extensionFunc(func(pod *corev1.Pod, req admission.Request) admission.Response {
+			return admission.Patched("", jsonpatch.NewOperation("replace", "/spec/missing/0", "value"))
+		}))
+		err := f.Run(GinkgoRandomSeed(), iterations)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("The patch doesn't apply to the pod"))
+	})
+
+	It("checks the requests generated from the fuzzing data", func() {
+		f := New(m, &catalog.EditEnvExtension{})
+		for _, data := range [][]byte{nil, []byte("eirini"), []byte("\x00\xff\x10\x20\x30\x40\x50\x60")} {
+			Expect(f.Check(data)).To(Succeed())
+			Expect(f.Fuzz(data)).To(Equal(1))
+			req, err := f.Request(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f.Request(data)).To(Equal(req))
+		}
+	})
+})
@@ -0,0 +1,245 @@
+// Package routing contains helpers for extensions reading and mutating the routes of the app pods and the
+// ports exposed by their app container, e.g. to register the routes in a custom ingress or onboard the apps
+// in a service mesh.
+//
+// Eirini sets the routes of the app as a JSON list in the AnnotationRoutes annotation of the pods. The helpers
+// decode and encode it in one place, keep the order and the formatting stable so that the patches only carry
+// actual changes, and are idempotent, so that they are safe to use in extensions which are called again on
+// pod updates.
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/eirinix/util/lifecycle"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// AnnotationRoutes is the annotation of the app pods holding the routes of the app, as a JSON list of Route
+const AnnotationRoutes = "cloudfoundry.org/routes"
+
+// Route is a route of the app: the requests to Hostname are sent to Port of the app container
+type Route struct {
+	Hostname string `json:"hostname"`
+	Port     int32  `json:"port"`
+}
+
+// Routes returns the routes of the pod, or none if it isn't annotated with AnnotationRoutes
+func Routes(pod *corev1.Pod) ([]Route, error) {
+	value, ok := pod.GetAnnotations()[AnnotationRoutes]
+	if !ok || value == "" {
+		return nil, nil
+	}
+	var routes []Route
+	if err := json.Unmarshal([]byte(value), &routes); err != nil {
+		return nil, errors.Wrapf(err, "decoding the %s annotation of the pod", AnnotationRoutes)
+	}
+	return routes, nil
+}
+
+// SetRoutes sets the routes of the pod, and returns true if they changed. The annotation is removed if there
+// are no routes.
+func SetRoutes(pod *corev1.Pod, routes []Route) (bool, error) {
+	for _, r := range routes {
+		if err := validateRoute(r); err != nil {
+			return false, err
+		}
+	}
+	current, err := Routes(pod)
+	if err == nil && equalRoutes(current, routes) {
+		return false, nil
+	}
+
+	if len(routes) == 0 {
+		delete(pod.Annotations, AnnotationRoutes)
+		return true, nil
+	}
+	value, err := json.Marshal(routes)
+	if err != nil {
+		return false, errors.Wrapf(err, "encoding the %s annotation of the pod", AnnotationRoutes)
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[AnnotationRoutes] = string(value)
+	return true, nil
+}
+
+// AddRoute adds the route to the routes of the pod, and returns true if it wasn't there already
+func AddRoute(pod *corev1.Pod, route Route) (bool, error) {
+	routes, err := Routes(pod)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range routes {
+		if r == route {
+			return false, nil
+		}
+	}
+	return SetRoutes(pod, append(routes, route))
+}
+
+// RemoveRoutes removes the routes of the pod to the hostname, and returns true if there were any
+func RemoveRoutes(pod *corev1.Pod, hostname string) (bool, error) {
+	routes, err := Routes(pod)
+	if err != nil {
+		return false, err
+	}
+	kept := make([]Route, 0, len(routes))
+	for _, r := range routes {
+		if r.Hostname != hostname {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == len(routes) {
+		return false, nil
+	}
+	return SetRoutes(pod, kept)
+}
+
+// RoutedPorts returns the ports of the app container the routes of the pod send the requests to, in the order
+// of the routes and without duplicates
+func RoutedPorts(pod *corev1.Pod) ([]int32, error) {
+	routes, err := Routes(pod)
+	if err != nil {
+		return nil, err
+	}
+	var ports []int32
+	seen := map[int32]bool{}
+	for _, r := range routes {
+		if !seen[r.Port] {
+			seen[r.Port] = true
+			ports = append(ports, r.Port)
+		}
+	}
+	return ports, nil
+}
+
+// ContainerPorts returns the ports exposed by the app container of the pod, or none if it has no app container
+func ContainerPorts(pod *corev1.Pod) []corev1.ContainerPort {
+	if c := lifecycle.AppContainer(pod); c != nil {
+		return c.Ports
+	}
+	return nil
+}
+
+// ExposePort adds the port to the ports of the app container, and returns true if it wasn't exposed already.
+// The protocol defaults to TCP, and a port already exposed with another name or a name already used by another
+// port is an error, as the API server would reject it.
+func ExposePort(pod *corev1.Pod, port corev1.ContainerPort) (bool, error) {
+	c := lifecycle.AppContainer(pod)
+	if c == nil {
+		return false, errors.Errorf("The pod %s has no app container", pod.GetName())
+	}
+	if port.ContainerPort <= 0 || port.ContainerPort > 65535 {
+		return false, errors.Errorf("Invalid container port %d, must be between 1 and 65535", port.ContainerPort)
+	}
+	if port.Name != "" {
+		if msgs := validation.IsValidPortName(port.Name); len(msgs) > 0 {
+			return false, errors.Errorf("Invalid port name %q: %s", port.Name, strings.Join(msgs, "; "))
+		}
+	}
+	if port.Protocol == "" {
+		port.Protocol = corev1.ProtocolTCP
+	}
+
+	if p := findPort(c, port.ContainerPort, port.Protocol); p != nil {
+		if port.Name != "" && p.Name != port.Name {
+			return false, errors.Errorf("The port %d/%s is already exposed as %q", p.ContainerPort, port.Protocol, p.Name)
+		}
+		return false, nil
+	}
+	for _, p := range c.Ports {
+		if port.Name != "" && p.Name == port.Name {
+			return false, errors.Errorf("The port name %q is already used by the port %d/%s", p.Name, p.ContainerPort, protocol(p))
+		}
+	}
+	c.Ports = append(c.Ports, port)
+	return true, nil
+}
+
+// UnexposePort removes the TCP port from the ports of the app container, and returns true if it was exposed
+func UnexposePort(pod *corev1.Pod, containerPort int32) bool {
+	c := lifecycle.AppContainer(pod)
+	if c == nil {
+		return false
+	}
+	for i, p := range c.Ports {
+		if p.ContainerPort == containerPort && protocol(p) == corev1.ProtocolTCP {
+			c.Ports = append(c.Ports[:i], c.Ports[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ExposeRoutedPorts exposes the ports of the routes of the pod which aren't exposed yet on the app container,
+// named with the given prefix and the port number if prefix isn't empty, e.g. http-8080, and returns true if
+// any was added
+func ExposeRoutedPorts(pod *corev1.Pod, prefix string) (bool, error) {
+	ports, err := RoutedPorts(pod)
+	if err != nil {
+		return false, err
+	}
+	c := lifecycle.AppContainer(pod)
+	changed := false
+	for _, p := range ports {
+		if c != nil && findPort(c, p, corev1.ProtocolTCP) != nil {
+			continue
+		}
+		port := corev1.ContainerPort{ContainerPort: p}
+		if prefix != "" {
+			port.Name = fmt.Sprintf("%s-%d", prefix, p)
+		}
+		added, err := ExposePort(pod, port)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || added
+	}
+	return changed, nil
+}
+
+// findPort returns the port of the container exposed with the protocol, or nil
+func findPort(c *corev1.Container, containerPort int32, proto corev1.Protocol) *corev1.ContainerPort {
+	for i := range c.Ports {
+		if c.Ports[i].ContainerPort == containerPort && protocol(c.Ports[i]) == proto {
+			return &c.Ports[i]
+		}
+	}
+	return nil
+}
+
+// protocol returns the protocol of the port, which defaults to TCP
+func protocol(p corev1.ContainerPort) corev1.Protocol {
+	if p.Protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return p.Protocol
+}
+
+func validateRoute(r Route) error {
+	if r.Hostname == "" {
+		return errors.New("The hostname of the route is required")
+	}
+	if r.Port <= 0 || r.Port > 65535 {
+		return errors.Errorf("Invalid port %d of the route %s, must be between 1 and 65535", r.Port, r.Hostname)
+	}
+	return nil
+}
+
+func equalRoutes(a, b []Route) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package routing_test
+
+import (
+	"code.cloudfoundry.org/eirinix/util/lifecycle"
+	. "code.cloudfoundry.org/eirinix/util/routing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Routing helpers", func() {
+	var pod *corev1.Pod
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "app-0",
+				Annotations: map[string]string{AnnotationRoutes: `[{"hostname":"app.example.com","port":8080}]`},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  lifecycle.AppContainerName,
+				Ports: []corev1.ContainerPort{{ContainerPort: 8080}},
+			}}},
+		}
+	})
+
+	Context("routes", func() {
+		It("reads the routes annotation", func() {
+			routes, err := Routes(pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(routes).To(Equal([]Route{{Hostname: "app.example.com", Port: 8080}}))
+
+			routes, err = Routes(&corev1.Pod{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(routes).To(BeEmpty())
+
+			pod.Annotations[AnnotationRoutes] = "app.example.com"
+			_, err = Routes(pod)
+			Expect(err).To(MatchError(ContainSubstring("decoding the cloudfoundry.org/routes annotation")))
+		})
+
+		It("adds and removes routes idempotently", func() {
+			changed, err := AddRoute(pod, Route{Hostname: "admin.example.com", Port: 9090})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(pod.Annotations[AnnotationRoutes]).To(Equal(`[{"hostname":"app.example.com","port":8080},{"hostname":"admin.example.com","port":9090}]`))
+
+			changed, err = AddRoute(pod, Route{Hostname: "admin.example.com", Port: 9090})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeFalse())
+
+			changed, err = RemoveRoutes(pod, "app.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(pod.Annotations[AnnotationRoutes]).To(Equal(`[{"hostname":"admin.example.com","port":9090}]`))
+
+			changed, err = RemoveRoutes(pod, "admin.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(pod.Annotations).ToNot(HaveKey(AnnotationRoutes))
+
+			changed, err = RemoveRoutes(pod, "admin.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeFalse())
+		})
+
+		It("rejects invalid routes", func() {
+			_, err := SetRoutes(pod, []Route{{Hostname: "app.example.com"}})
+			Expect(err).To(MatchError(ContainSubstring("Invalid port 0 of the route app.example.com")))
+			_, err = AddRoute(pod, Route{Port: 8080})
+			Expect(err).To(MatchError(ContainSubstring("hostname of the route is required")))
+			Expect(pod.Annotations[AnnotationRoutes]).To(Equal(`[{"hostname":"app.example.com","port":8080}]`))
+		})
+
+		It("lists the routed ports without duplicates", func() {
+			_, err := SetRoutes(pod, []Route{
+				{Hostname: "app.example.com", Port: 8080},
+				{Hostname: "admin.example.com", Port: 9090},
+				{Hostname: "app.example.org", Port: 8080},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(RoutedPorts(pod)).To(Equal([]int32{8080, 9090}))
+		})
+	})
+
+	Context("ports", func() {
+		It("exposes the ports on the app container", func() {
+			changed, err := ExposePort(pod, corev1.ContainerPort{Name: "metrics", ContainerPort: 9102})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(ContainerPorts(pod)).To(ContainElement(corev1.ContainerPort{Name: "metrics", ContainerPort: 9102, Protocol: corev1.ProtocolTCP}))
+
+			changed, err = ExposePort(pod, corev1.ContainerPort{Name: "metrics", ContainerPort: 9102})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeFalse())
+
+			_, err = ExposePort(pod, corev1.ContainerPort{Name: "metrics", ContainerPort: 9103})
+			Expect(err).To(MatchError(ContainSubstring(`The port name "metrics" is already used by the port 9102/TCP`)))
+			_, err = ExposePort(pod, corev1.ContainerPort{Name: "admin", ContainerPort: 9102})
+			Expect(err).To(MatchError(ContainSubstring(`The port 9102/TCP is already exposed as "metrics"`)))
+			_, err = ExposePort(pod, corev1.ContainerPort{Name: "a-very-long-port-name", ContainerPort: 9104})
+			Expect(err).To(MatchError(ContainSubstring("Invalid port name")))
+			_, err = ExposePort(&corev1.Pod{}, corev1.ContainerPort{ContainerPort: 9102})
+			Expect(err).To(MatchError(ContainSubstring("has no app container")))
+
+			Expect(UnexposePort(pod, 9102)).To(BeTrue())
+			Expect(UnexposePort(pod, 9102)).To(BeFalse())
+			Expect(ContainerPorts(pod)).To(Equal([]corev1.ContainerPort{{ContainerPort: 8080}}))
+		})
+
+		It("exposes the routed ports which aren't exposed yet", func() {
+			_, err := AddRoute(pod, Route{Hostname: "admin.example.com", Port: 9090})
+			Expect(err).ToNot(HaveOccurred())
+
+			changed, err := ExposeRoutedPorts(pod, "http")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(ContainerPorts(pod)).To(Equal([]corev1.ContainerPort{
+				{ContainerPort: 8080},
+				{Name: "http-9090", ContainerPort: 9090, Protocol: corev1.ProtocolTCP},
+			}))
+
+			changed, err = ExposeRoutedPorts(pod, "http")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,125 @@
+// Package windows contains helpers for extensions running in mixed-OS clusters, to detect
+// Windows-targeted app pods and to keep the injected containers schedulable on Windows nodes.
+package windows
+
+import (
+	"context"
+
+	eirinix "code.cloudfoundry.org/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// LabelOS is the well-known node label holding the node operating system
+	LabelOS = "kubernetes.io/os"
+	// LabelOSBeta is the deprecated version of LabelOS, still used by older Eirini releases
+	LabelOSBeta = "beta.kubernetes.io/os"
+	// OSWindows is the value of LabelOS on Windows nodes
+	OSWindows = "windows"
+)
+
+// IsWindowsPod returns true if the pod can only be scheduled on Windows nodes, either via its
+// node selector, its required node affinity or the Windows options of its security context
+func IsWindowsPod(pod *corev1.Pod) bool {
+	if pod == nil {
+		return false
+	}
+
+	for _, label := range []string{LabelOS, LabelOSBeta} {
+		if pod.Spec.NodeSelector[label] == OSWindows {
+			return true
+		}
+	}
+
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.WindowsOptions != nil {
+		return true
+	}
+
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return false
+	}
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) == 0 {
+		return false
+	}
+	// Terms are ORed: the pod targets Windows only if every term does
+	for _, term := range terms {
+		if !termRequiresWindows(term) {
+			return false
+		}
+	}
+	return true
+}
+
+func termRequiresWindows(term corev1.NodeSelectorTerm) bool {
+	for _, req := range term.MatchExpressions {
+		if req.Key != LabelOS && req.Key != LabelOSBeta {
+			continue
+		}
+		if req.Operator == corev1.NodeSelectorOpIn && len(req.Values) == 1 && req.Values[0] == OSWindows {
+			return true
+		}
+	}
+	return false
+}
+
+// AdaptContainer removes from the container security context the fields which are not supported
+// on Windows nodes (e.g. SELinux options, capabilities or Linux user ids), which would otherwise
+// make the pod fail to start. It's a no-op for pods which don't target Windows.
+func AdaptContainer(pod *corev1.Pod, c *corev1.Container) {
+	if !IsWindowsPod(pod) || c.SecurityContext == nil {
+		return
+	}
+
+	sc := c.SecurityContext
+	sc.SELinuxOptions = nil
+	sc.Capabilities = nil
+	sc.Privileged = nil
+	sc.AllowPrivilegeEscalation = nil
+	sc.ReadOnlyRootFilesystem = nil
+	sc.ProcMount = nil
+	sc.SeccompProfile = nil
+	sc.RunAsUser = nil
+	sc.RunAsGroup = nil
+}
+
+// AdaptPod applies AdaptContainer to all the containers and init containers of the pod, and removes
+// the unsupported fields of the pod security context
+func AdaptPod(pod *corev1.Pod) {
+	if !IsWindowsPod(pod) {
+		return
+	}
+	for i := range pod.Spec.InitContainers {
+		AdaptContainer(pod, &pod.Spec.InitContainers[i])
+	}
+	for i := range pod.Spec.Containers {
+		AdaptContainer(pod, &pod.Spec.Containers[i])
+	}
+	if sc := pod.Spec.SecurityContext; sc != nil {
+		sc.SELinuxOptions = nil
+		sc.RunAsUser = nil
+		sc.RunAsGroup = nil
+		sc.FSGroup = nil
+		sc.Sysctls = nil
+		sc.SeccompProfile = nil
+	}
+}
+
+// SkipWindowsPods wraps an Extension so that pods targeting Windows nodes are admitted without
+// being passed to it, for extensions injecting Linux-only containers.
+func SkipWindowsPods(e eirinix.Extension) eirinix.Extension {
+	return &skipWindows{Extension: e}
+}
+
+type skipWindows struct {
+	eirinix.Extension
+}
+
+func (s *skipWindows) Handle(ctx context.Context, m eirinix.Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if IsWindowsPod(pod) {
+		return admission.Allowed("Windows pods are not mutated")
+	}
+	return s.Extension.Handle(ctx, m, pod, req)
+}
@@ -0,0 +1,13 @@
+package windows_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestWindows(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Windows Suite")
+}
@@ -0,0 +1,58 @@
+package windows_test
+
+import (
+	. "code.cloudfoundry.org/eirinix/util/windows"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Windows helpers", func() {
+	var pod *corev1.Pod
+
+	BeforeEach(func() {
+		privileged := true
+		user := int64(1000)
+		pod = &corev1.Pod{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "app",
+				SecurityContext: &corev1.SecurityContext{
+					Privileged: &privileged,
+					RunAsUser:  &user,
+				},
+			}},
+		}}
+	})
+
+	It("detects pods with a Windows node selector", func() {
+		Expect(IsWindowsPod(pod)).To(BeFalse())
+		pod.Spec.NodeSelector = map[string]string{LabelOS: OSWindows}
+		Expect(IsWindowsPod(pod)).To(BeTrue())
+	})
+
+	It("detects pods requiring Windows nodes via affinity", func() {
+		windowsTerm := corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+			{Key: LabelOS, Operator: corev1.NodeSelectorOpIn, Values: []string{OSWindows}},
+		}}
+		pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{windowsTerm},
+			},
+		}}
+		Expect(IsWindowsPod(pod)).To(BeTrue())
+
+		terms := &pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		*terms = append(*terms, corev1.NodeSelectorTerm{})
+		Expect(IsWindowsPod(pod)).To(BeFalse())
+	})
+
+	It("removes the Linux only security context fields on Windows pods", func() {
+		AdaptPod(pod)
+		Expect(pod.Spec.Containers[0].SecurityContext.Privileged).ToNot(BeNil())
+
+		pod.Spec.NodeSelector = map[string]string{LabelOS: OSWindows}
+		AdaptPod(pod)
+		Expect(pod.Spec.Containers[0].SecurityContext.Privileged).To(BeNil())
+		Expect(pod.Spec.Containers[0].SecurityContext.RunAsUser).To(BeNil())
+	})
+})
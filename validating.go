@@ -0,0 +1,54 @@
+package extension
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ValidatingExtension is implemented by the Extensions which only accept or deny the requests, e.g. to enforce
+// policies on the Eirini apps. When Validating returns true, the webhook of the extension is registered in the
+// ValidatingWebhookConfiguration (see NamedValidatingWebhookConfiguration) instead of the mutating one, so that
+// the API server calls it with the pod as mutated by every mutating webhook. The patches of its responses are
+// dropped.
+type ValidatingExtension interface {
+	Validating() bool
+}
+
+// isValidating returns true if the extension is registered in the ValidatingWebhookConfiguration
+func isValidating(e Extension) bool {
+	v, ok := e.(ValidatingExtension)
+	return ok && v.Validating()
+}
+
+// isValidatingWebhook returns true if the webhook is registered in the ValidatingWebhookConfiguration
+func isValidatingWebhook(w MutatingWebhook) bool {
+	dw, ok := w.(*DefaultMutatingWebhook)
+	return ok && dw.Validating
+}
+
+// splitWebhooks returns the webhooks of the MutatingWebhookConfiguration and of the
+// ValidatingWebhookConfiguration
+func splitWebhooks(webhooks []MutatingWebhook) (mutating, validating []MutatingWebhook) {
+	for _, w := range webhooks {
+		if isValidatingWebhook(w) {
+			validating = append(validating, w)
+		} else {
+			mutating = append(mutating, w)
+		}
+	}
+	return mutating, validating
+}
+
+// dropPatches removes the patch of the response of a validating webhook, which the API server doesn't apply
+func (w *DefaultMutatingWebhook) dropPatches(ctx context.Context, res admission.Response) admission.Response {
+	if len(res.Patches) == 0 && len(res.Patch) == 0 {
+		return res
+	}
+	ctxlog.Warnf(ctx, "Dropping the patch of the validating webhook %s", w.Name)
+	res.Patches = nil
+	res.Patch = nil
+	res.PatchType = nil
+	return res
+}
@@ -0,0 +1,126 @@
+package extension_test
+
+import (
+	"context"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// policyExtension denies the pods without image, and tries to label the other ones
+type policyExtension struct{}
+
+func (e *policyExtension) Handle(ctx context.Context, m Manager, pod *corev1.Pod, req admission.Request) admission.Response {
+	if pod.Spec.Containers[0].Image == "" {
+		return admission.Denied("the app has no image")
+	}
+	mutated := pod.DeepCopy()
+	mutated.Labels = map[string]string{"validated": "true"}
+	return m.PatchFromPod(req, mutated)
+}
+
+func (e *policyExtension) Validating() bool {
+	return true
+}
+
+var _ = Describe("Validating extensions", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		client        *cfakes.FakeClient
+		created       []runtime.Object
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		client = &cfakes.FakeClient{}
+		created = nil
+		client.CreateCalls(func(_ context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+			created = append(created, object)
+			return nil
+		})
+		kubeManager := &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+		eiriniManager.KubeManager = kubeManager
+		eiriniManager.GenWebHookServer()
+		eiriniManager.WebhookConfig.CaCertificate = []byte("the-ca-cert")
+
+		Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+		Expect(eiriniManager.AddExtension(&policyExtension{})).To(Succeed())
+	})
+
+	It("registers them in the validating webhook configuration", func() {
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(created).To(HaveLen(2))
+
+		mutating := created[0].(*admissionregistrationv1beta1.MutatingWebhookConfiguration)
+		Expect(mutating.Name).To(Equal("eirini-x-mutating-hook"))
+		Expect(mutating.Webhooks).To(HaveLen(1))
+		Expect(mutating.Webhooks[0].Name).To(Equal("0.eirini-x.org"))
+
+		validating := created[1].(*admissionregistrationv1beta1.ValidatingWebhookConfiguration)
+		Expect(validating.Name).To(Equal("eirini-x-validating-hook"))
+		Expect(validating.Webhooks).To(HaveLen(1))
+		Expect(validating.Webhooks[0].Name).To(Equal("1.eirini-x.org"))
+		Expect(validating.Webhooks[0].ClientConfig.CABundle).To(Equal([]byte("the-ca-cert")))
+		Expect(*validating.Webhooks[0].ClientConfig.URL).To(HaveSuffix("/1"))
+	})
+
+	It("only creates the validating webhook configuration for validating extensions", func() {
+		eiriniManager.Extensions = eiriniManager.Extensions[:1]
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(created).To(HaveLen(1))
+
+		// The configuration of the removed validating extensions is deleted
+		var deleted []string
+		for i := 0; i < client.DeleteCallCount(); i++ {
+			if _, object, _ := client.DeleteArgsForCall(i); object != nil {
+				if config, ok := object.(*admissionregistrationv1beta1.ValidatingWebhookConfiguration); ok {
+					deleted = append(deleted, config.Name)
+				}
+			}
+		}
+		Expect(deleted).To(Equal([]string{"eirini-x-validating-hook"}))
+	})
+
+	It("switches the failure policy in the validating webhook configuration", func() {
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(eiriniManager.SetFailurePolicy("*extension_test.policyExtension", admissionregistrationv1beta1.Ignore)).To(Succeed())
+
+		Expect(client.PatchCallCount()).To(Equal(1))
+		_, object, patch, _ := client.PatchArgsForCall(0)
+		Expect(object.(*admissionregistrationv1beta1.ValidatingWebhookConfiguration).Name).To(Equal("eirini-x-validating-hook"))
+		data, err := patch.Data(object)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`{"op":"test","path":"/webhooks/0/name","value":"1.eirini-x.org"}`))
+	})
+
+	It("requires the permissions on the validating webhook configurations", func() {
+		Expect(eiriniManager.RequiredPermissions()).To(ContainElement(rbacv1.PolicyRule{
+			APIGroups: []string{"admissionregistration.k8s.io"},
+			Resources: []string{"mutatingwebhookconfigurations", "validatingwebhookconfigurations"},
+			Verbs:     []string{"create", "delete", "patch"},
+		}))
+	})
+
+	It("drops the patches of the validating webhooks", func() {
+		w := NewWebhook(&policyExtension{}, eiriniManager)
+		Expect(w.RegisterAdmissionWebHook(&webhook.Server{}, WebhookOptions{ID: "policy", ManagerOptions: eiriniManager.Options})).To(Succeed())
+		injectDecoder(w)
+
+		res := w.Handle(context.Background(), podRequest())
+		Expect(res.Allowed).To(BeTrue())
+		Expect(res.Patches).To(BeEmpty())
+		Expect(res.Patch).To(BeEmpty())
+	})
+})
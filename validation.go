@@ -0,0 +1,284 @@
+package extension
+
+import (
+	"net"
+	"strings"
+
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Validate checks the options, and returns an aggregated error listing every invalid field
+func (o *ManagerOptions) Validate() error {
+	var errs field.ErrorList
+
+	if o.Namespace != "" {
+		errs = append(errs, validateDNSLabel(field.NewPath("namespace"), o.Namespace)...)
+	}
+	for i, ns := range o.Namespaces {
+		errs = append(errs, validateDNSLabel(field.NewPath("namespaces").Index(i), ns)...)
+	}
+	if o.AllNamespaces && len(o.Namespaces) > 0 {
+		errs = append(errs, field.Forbidden(field.NewPath("namespaces"), "not supported with allNamespaces"))
+	}
+	if o.WebhookNamespace != "" {
+		errs = append(errs, validateDNSLabel(field.NewPath("webhookNamespace"), o.WebhookNamespace)...)
+	}
+
+	if o.NamespaceWaitTimeout < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("namespaceWaitTimeout"), o.NamespaceWaitTimeout.String(), "must not be negative"))
+	}
+
+	if o.DrainTimeout < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("drainTimeout"), o.DrainTimeout.String(), "must not be negative"))
+	}
+
+	if o.Host != "" && net.ParseIP(o.Host) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(o.Host) {
+			errs = append(errs, field.Invalid(field.NewPath("host"), o.Host, "must be an IP address or a hostname: "+msg))
+		}
+	}
+	if o.Port < 0 || o.Port > 65535 {
+		errs = append(errs, field.Invalid(field.NewPath("port"), o.Port, "must be between 0 and 65535"))
+	}
+
+	if o.OperatorFingerprint != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(o.OperatorFingerprint) {
+			errs = append(errs, field.Invalid(field.NewPath("operatorFingerprint"), o.OperatorFingerprint, msg))
+		}
+	}
+
+	if o.NamingStrategy != nil {
+		errs = append(errs, o.validateNames(field.NewPath("namingStrategy"))...)
+	}
+
+	if o.ServiceName != "" {
+		for _, msg := range validation.IsDNS1035Label(o.ServiceName) {
+			errs = append(errs, field.Invalid(field.NewPath("serviceName"), o.ServiceName, msg))
+		}
+		if o.WebhookNamespace == "" {
+			errs = append(errs, field.Required(field.NewPath("webhookNamespace"), "required when serviceName is set"))
+		}
+	}
+
+	if o.Service != nil {
+		errs = append(errs, o.Service.validate(field.NewPath("service"), o)...)
+	}
+	for k, v := range o.OperatorPodLabels {
+		for _, msg := range validation.IsQualifiedName(k) {
+			errs = append(errs, field.Invalid(field.NewPath("operatorPodLabels").Key(k), k, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(v) {
+			errs = append(errs, field.Invalid(field.NewPath("operatorPodLabels").Key(k), v, msg))
+		}
+	}
+	if o.OperatorServiceAccount != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(o.OperatorServiceAccount) {
+			errs = append(errs, field.Invalid(field.NewPath("operatorServiceAccount"), o.OperatorServiceAccount, msg))
+		}
+	}
+
+	if o.FailurePolicy != nil {
+		switch *o.FailurePolicy {
+		case admissionregistrationv1beta1.Fail, admissionregistrationv1beta1.Ignore:
+		default:
+			errs = append(errs, field.NotSupported(field.NewPath("failurePolicy"), *o.FailurePolicy,
+				[]string{string(admissionregistrationv1beta1.Fail), string(admissionregistrationv1beta1.Ignore)}))
+		}
+	}
+
+	errs = append(errs, o.validateWebhookGroups(field.NewPath("webhookGroups"))...)
+
+	switch o.RBACCheck {
+	case RBACCheckDisabled, RBACCheckWarn, RBACCheckEnforce:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("rbacCheck"), o.RBACCheck,
+			[]string{string(RBACCheckWarn), string(RBACCheckEnforce)}))
+	}
+
+	switch o.DecodeErrorPolicy {
+	case "", DecodeErrorPassThrough, DecodeErrorAllow, DecodeErrorDeny:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("decodeErrorPolicy"), o.DecodeErrorPolicy,
+			[]string{string(DecodeErrorPassThrough), string(DecodeErrorAllow), string(DecodeErrorDeny)}))
+	}
+
+	switch o.EiriniCompatibility {
+	case "", EiriniCompatibilityLegacy, EiriniCompatibilityController, EiriniCompatibilityAuto:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("eiriniCompatibility"), o.EiriniCompatibility,
+			[]string{string(EiriniCompatibilityLegacy), string(EiriniCompatibilityController), string(EiriniCompatibilityAuto)}))
+	}
+
+	switch o.AdmissionRegistrationAPI {
+	case "", AdmissionRegistrationV1Beta1, AdmissionRegistrationV1, AdmissionRegistrationAuto:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("admissionRegistrationAPI"), o.AdmissionRegistrationAPI,
+			[]string{string(AdmissionRegistrationV1Beta1), string(AdmissionRegistrationV1), string(AdmissionRegistrationAuto)}))
+	}
+
+	if o.Chaos != nil {
+		errs = append(errs, o.Chaos.validate(field.NewPath("chaos"))...)
+	}
+
+	if o.FrontProxy != nil {
+		if _, err := o.FrontProxy.trustedNetworks(); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("frontProxy", "trustedCIDRs"), strings.Join(o.FrontProxy.TrustedCIDRs, ","), err.Error()))
+		}
+	}
+
+	if o.RequireClientCertificate != nil {
+		errs = append(errs, o.RequireClientCertificate.validate(field.NewPath("requireClientCertificate"))...)
+	}
+
+	if o.WatcherQueue != nil {
+		errs = append(errs, o.WatcherQueue.validate(field.NewPath("watcherQueue"))...)
+	}
+	if o.Backpressure != nil {
+		errs = append(errs, o.Backpressure.validate(field.NewPath("backpressure"))...)
+	}
+	if o.SLO != nil {
+		errs = append(errs, o.SLO.validate(field.NewPath("slo"))...)
+	}
+	if o.Budget != nil {
+		errs = append(errs, o.Budget.validate(field.NewPath("budget"))...)
+	}
+	if o.Audit != nil {
+		errs = append(errs, o.Audit.validate(field.NewPath("audit"))...)
+	}
+	if o.Autoscaling != nil {
+		errs = append(errs, o.Autoscaling.validate(field.NewPath("autoscaling"), o)...)
+	}
+	if o.CertManager != nil {
+		errs = append(errs, o.CertManager.validate(field.NewPath("certManager"), o)...)
+	}
+	if o.CertificateRotation != nil {
+		errs = append(errs, o.CertificateRotation.validate(field.NewPath("certificateRotation"), o)...)
+	}
+	if o.TLS != nil {
+		errs = append(errs, o.TLS.validate(field.NewPath("tls"), o)...)
+	}
+
+	if o.ReportStatus && o.WebhookNamespace == "" && o.Namespace == "" {
+		errs = append(errs, field.Required(field.NewPath("webhookNamespace"), "required when reportStatus is set"))
+	}
+	if o.EnableLeaderElection && o.CleanupOnStop {
+		errs = append(errs, field.Forbidden(field.NewPath("cleanupOnStop"), "not supported with enableLeaderElection, the other replicas keep serving"))
+	}
+	if o.EnableLeaderElection && o.WebhookNamespace == "" && o.Namespace == "" {
+		errs = append(errs, field.Required(field.NewPath("webhookNamespace"), "required when enableLeaderElection is set"))
+	}
+
+	statusEnabled := o.StatusBindAddress != "" && o.StatusBindAddress != "0"
+	if statusEnabled {
+		if _, _, err := net.SplitHostPort(o.StatusBindAddress); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("statusBindAddress"), o.StatusBindAddress, err.Error()))
+		}
+	}
+	if o.MetricsBindAddress != "" && o.MetricsBindAddress != "0" {
+		if _, _, err := net.SplitHostPort(o.MetricsBindAddress); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("metricsBindAddress"), o.MetricsBindAddress, err.Error()))
+		}
+	}
+	if o.HealthProbeBindAddress != "" && o.HealthProbeBindAddress != "0" {
+		if _, _, err := net.SplitHostPort(o.HealthProbeBindAddress); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("healthProbeBindAddress"), o.HealthProbeBindAddress, err.Error()))
+		}
+	}
+	if o.Handover != nil && !statusEnabled {
+		errs = append(errs, field.Required(field.NewPath("statusBindAddress"), "required when handover is enabled"))
+	}
+
+	if o.WatcherMode {
+		// The watcher mode serves no webhook
+		for _, opt := range []struct {
+			name string
+			set  bool
+		}{
+			{"webhookGroups", len(o.WebhookGroups) > 0},
+			{"service", o.Service != nil},
+			{"handover", o.Handover != nil},
+			{"requireClientCertificate", o.RequireClientCertificate != nil},
+			{"verifyReachability", o.VerifyReachability},
+			{"enableLeaderElection", o.EnableLeaderElection},
+			{"metricsBindAddress", o.MetricsBindAddress != "" && o.MetricsBindAddress != "0"},
+			{"healthProbeBindAddress", o.HealthProbeBindAddress != "" && o.HealthProbeBindAddress != "0"},
+			{"cleanupOnStop", o.CleanupOnStop},
+		} {
+			if opt.set {
+				errs = append(errs, field.Forbidden(field.NewPath(opt.name), "not supported in watcher mode"))
+			}
+		}
+	}
+
+	return errs.ToAggregate()
+}
+
+func (s *ServiceOptions) validate(path *field.Path, o *ManagerOptions) field.ErrorList {
+	var errs field.ErrorList
+	if o.ServiceName == "" {
+		errs = append(errs, field.Required(field.NewPath("serviceName"), "required when service is set"))
+	}
+	if len(s.Selector) == 0 && net.ParseIP(o.Host) == nil {
+		errs = append(errs, field.Invalid(field.NewPath("host"), o.Host, "must be an IP address when the service has no selector"))
+	}
+	if s.PortName != "" {
+		for _, msg := range validation.IsValidPortName(s.PortName) {
+			errs = append(errs, field.Invalid(path.Child("portName"), s.PortName, msg))
+		}
+	}
+	if s.TargetPort != "" {
+		for _, msg := range validation.IsValidPortName(s.TargetPort) {
+			errs = append(errs, field.Invalid(path.Child("targetPort"), s.TargetPort, msg))
+		}
+	}
+	switch s.InternalTrafficPolicy {
+	case "", "Cluster", "Local":
+	default:
+		errs = append(errs, field.NotSupported(path.Child("internalTrafficPolicy"), s.InternalTrafficPolicy, []string{"Cluster", "Local"}))
+	}
+	switch s.IPFamilyPolicy {
+	case "", "SingleStack", "PreferDualStack", "RequireDualStack":
+	default:
+		errs = append(errs, field.NotSupported(path.Child("ipFamilyPolicy"), s.IPFamilyPolicy, []string{"SingleStack", "PreferDualStack", "RequireDualStack"}))
+	}
+	if len(s.IPFamilies) > 2 {
+		errs = append(errs, field.TooMany(path.Child("ipFamilies"), len(s.IPFamilies), 2))
+	}
+	for i, f := range s.IPFamilies {
+		if f != "IPv4" && f != "IPv6" {
+			errs = append(errs, field.NotSupported(path.Child("ipFamilies").Index(i), f, []string{"IPv4", "IPv6"}))
+		}
+	}
+	if len(s.IPFamilies) == 2 && s.IPFamilyPolicy == "SingleStack" {
+		errs = append(errs, field.Invalid(path.Child("ipFamilyPolicy"), s.IPFamilyPolicy, "must be dual stack with two ipFamilies"))
+	}
+	return errs
+}
+
+func validateDNSLabel(path *field.Path, value string) field.ErrorList {
+	var errs field.ErrorList
+	for _, msg := range validation.IsDNS1123Label(value) {
+		errs = append(errs, field.Invalid(path, value, msg))
+	}
+	return errs
+}
+
+// validateNames checks the names generated by the NamingStrategy
+func (o *ManagerOptions) validateNames(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for _, kind := range []NamedResource{NamedWebhookConfiguration, NamedValidatingWebhookConfiguration, NamedSetupCertificate, NamedCABundle, NamedHandoverLease, NamedLeaderElection} {
+		name := o.resourceName(kind, "")
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			errs = append(errs, field.Invalid(path.Key(string(kind)), name, msg))
+		}
+	}
+	if len(o.WatchedNamespaces()) > 0 {
+		label := o.resourceName(NamedNamespaceLabel, "")
+		for _, msg := range validation.IsQualifiedName(label) {
+			errs = append(errs, field.Invalid(path.Key(string(NamedNamespaceLabel)), label, msg))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,59 @@
+package extension_test
+
+import (
+	. "code.cloudfoundry.org/eirinix"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Manager options validation", func() {
+	It("accepts valid options", func() {
+		opts := ManagerOptions{
+			Namespace:        "eirini",
+			Host:             "0.0.0.0",
+			Port:             8889,
+			ServiceName:      "extension",
+			WebhookNamespace: "cf",
+		}
+		Expect(opts.Validate()).To(Succeed())
+
+		opts.Host = "listening.eirini-x.org"
+		Expect(opts.Validate()).To(Succeed())
+	})
+
+	It("reports all the invalid fields", func() {
+		opts := ManagerOptions{
+			Namespace:   "Not_A_Namespace",
+			Host:        "not a host",
+			Port:        70000,
+			ServiceName: "extension",
+			Handover:    &HandoverOptions{},
+		}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("namespace: Invalid value"))
+		Expect(err.Error()).To(ContainSubstring("host: Invalid value"))
+		Expect(err.Error()).To(ContainSubstring("port: Invalid value"))
+		Expect(err.Error()).To(ContainSubstring("webhookNamespace: Required value"))
+		Expect(err.Error()).To(ContainSubstring("statusBindAddress: Required value"))
+	})
+
+	It("forbids the webhook options in watcher mode", func() {
+		opts := ManagerOptions{
+			Namespace:          "eirini",
+			WatcherMode:        true,
+			WebhookGroups:      []WebhookGroup{{Name: "critical", Port: 8890}},
+			VerifyReachability: true,
+		}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("webhookGroups: Forbidden: not supported in watcher mode"))
+		Expect(err.Error()).To(ContainSubstring("verifyReachability: Forbidden: not supported in watcher mode"))
+	})
+
+	It("is enforced by NewManager", func() {
+		_, err := NewManager(ManagerOptions{Port: -1})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid manager options"))
+	})
+})
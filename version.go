@@ -0,0 +1,52 @@
+package extension
+
+import (
+	"runtime/debug"
+)
+
+const (
+	// AnnotationVersion is set on the objects generated by the Manager to the eirinix library version
+	AnnotationVersion = "eirinix.cloudfoundry.org/version"
+	// AnnotationOperatorVersion is set on the objects generated by the Manager to ManagerOptions.OperatorVersion
+	AnnotationOperatorVersion = "eirinix.cloudfoundry.org/operator-version"
+
+	modulePath     = "code.cloudfoundry.org/eirinix"
+	unknownVersion = "unknown"
+)
+
+// Version returns the version of the eirinix library the operator is built with, read from the
+// module information embedded in the binary
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return unknownVersion
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return unknownVersion
+}
+
+func (o *ManagerOptions) operatorVersion() string {
+	if o.OperatorVersion == "" {
+		return unknownVersion
+	}
+	return o.OperatorVersion
+}
+
+// versionAnnotations returns the annotations stamped on the generated webhook configuration and secrets
+func (o *ManagerOptions) versionAnnotations() map[string]string {
+	return map[string]string{
+		AnnotationVersion:         Version(),
+		AnnotationOperatorVersion: o.operatorVersion(),
+	}
+}
@@ -0,0 +1,54 @@
+package extension
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// watchRestartDelay is the time the watcher mode waits before watching again the pods once the watcher
+// channel closed
+const watchRestartDelay = time.Second
+
+// watchOnly runs the Watchers until the Manager is stopped, without the webhook server, the certificate and
+// the webhook configuration. The pods are watched again when the watcher channel closes, e.g. once the
+// resource version expired.
+func (m *DefaultExtensionManager) watchOnly() error {
+	if len(m.Extensions) > 0 || len(m.Reconcilers) > 0 {
+		err := errors.Errorf("The watcher mode only runs the Watchers, but %d Extensions and %d Reconcilers were added", len(m.Extensions), len(m.Reconcilers))
+		m.registration.done(err)
+		return err
+	}
+	if len(m.Watchers) == 0 {
+		err := errors.New("The watcher mode requires a Watcher")
+		m.registration.done(err)
+		return err
+	}
+
+	m.extensionsLoaded = true
+	m.registration.done(nil)
+	for _, ref := range m.extensionRefs() {
+		extensionEnabled.WithLabelValues(ref.name, ref.kind, extensionVersion(ref.extension)).Set(1)
+	}
+
+	for {
+		err := m.Watch()
+		select {
+		case <-m.stopChannel:
+			return nil
+		default:
+		}
+		if _, closed := err.(*WatcherChannelClosedError); !closed {
+			return err
+		}
+
+		// The resource version the watch started from may have expired, the pods are listed again
+		m.Logger.Info("The watcher channel closed, watching the pods again")
+		m.Options.WatcherStartRV = ""
+		select {
+		case <-m.stopChannel:
+			return nil
+		case <-time.After(watchRestartDelay):
+		}
+	}
+}
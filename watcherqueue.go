@@ -0,0 +1,154 @@
+package extension
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// WatcherOverflowPolicy tells which event a full watcher queue drops
+type WatcherOverflowPolicy string
+
+const (
+	// DropNewest drops the incoming events while the queue is full, keeping the oldest ones
+	DropNewest WatcherOverflowPolicy = "DropNewest"
+	// DropOldest drops the oldest queued event to make room for the incoming one, for the watchers caring about
+	// the latest state of the pods
+	DropOldest WatcherOverflowPolicy = "DropOldest"
+)
+
+// WatcherQueueOptions hand the pod events to each Watcher through its own bounded queue, so that a slow
+// Watcher neither holds the other ones back nor grows the memory of the operator without bound during mass
+// app restarts. The events of a full queue are dropped following the Overflow policy and counted in the
+// eirinix_watcher_events_dropped_total metric, and the depth and saturation of the queues are exported as
+// metrics. A Watcher still handles its events one at a time, in order.
+type WatcherQueueOptions struct {
+	// Size is the number of events each queue holds
+	Size int
+
+	// Overflow is the policy of the full queues, DropNewest or DropOldest. Optional, defaults to DropNewest
+	Overflow WatcherOverflowPolicy
+}
+
+func (o *WatcherQueueOptions) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if o.Size <= 0 {
+		errs = append(errs, field.Invalid(path.Child("size"), o.Size, "must be positive"))
+	}
+	switch o.Overflow {
+	case "", DropNewest, DropOldest:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("overflow"), o.Overflow, []string{string(DropNewest), string(DropOldest)}))
+	}
+	return errs
+}
+
+// watcherQueue is the bounded queue of the events of a Watcher
+type watcherQueue struct {
+	name     string
+	watcher  Watcher
+	size     int
+	overflow WatcherOverflowPolicy
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []watch.Event
+	closed bool
+}
+
+func newWatcherQueue(w Watcher, opts WatcherQueueOptions) *watcherQueue {
+	q := &watcherQueue{name: extensionName(w), watcher: w, size: opts.Size, overflow: opts.Overflow}
+	if q.overflow == "" {
+		q.overflow = DropNewest
+	}
+	q.cond = sync.NewCond(&q.mu)
+	watcherQueueCapacity.WithLabelValues(q.name).Set(float64(q.size))
+	return q
+}
+
+// push queues the event, dropping an event if the queue is full. It never blocks.
+func (q *watcherQueue) push(e watch.Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	if len(q.events) >= q.size {
+		watcherEventsDropped.WithLabelValues(q.name, string(q.overflow)).Inc()
+		if q.overflow == DropNewest {
+			return
+		}
+		q.events[0] = watch.Event{}
+		q.events = q.events[1:]
+	}
+	q.events = append(q.events, e)
+	q.observe()
+	q.cond.Signal()
+}
+
+// pop returns the oldest event, blocking until there is one. It returns false once the queue is closed.
+func (q *watcherQueue) pop() (watch.Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.events) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return watch.Event{}, false
+	}
+	e := q.events[0]
+	q.events[0] = watch.Event{}
+	q.events = q.events[1:]
+	q.observe()
+	return e, true
+}
+
+// observe exports the depth of the queue, with q.mu held
+func (q *watcherQueue) observe() {
+	watcherQueueDepth.WithLabelValues(q.name).Set(float64(len(q.events)))
+	watcherQueueSaturation.WithLabelValues(q.name).Set(float64(len(q.events)) / float64(q.size))
+}
+
+// close drops the queued events and stops run
+func (q *watcherQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.events = nil
+	q.observe()
+	q.cond.Broadcast()
+}
+
+// run hands the queued events to the Watcher until the queue is closed
+func (q *watcherQueue) run(m Manager) {
+	for {
+		e, ok := q.pop()
+		if !ok {
+			return
+		}
+		q.watcher.Handle(m, e)
+	}
+}
+
+// watcherQueues returns the queues of the Watchers, started on the first call and closed when the Manager
+// stops, or nil without ManagerOptions.WatcherQueue
+func (m *DefaultExtensionManager) watcherQueues() []*watcherQueue {
+	if m.Options.WatcherQueue == nil {
+		return nil
+	}
+	m.watcherQueuesOnce.Do(func() {
+		for _, w := range m.Watchers {
+			q := newWatcherQueue(w, *m.Options.WatcherQueue)
+			m.queues = append(m.queues, q)
+			go q.run(m)
+		}
+		go func() {
+			<-m.stopChannel
+			for _, q := range m.queues {
+				q.close()
+			}
+		}()
+	})
+	return m.queues
+}
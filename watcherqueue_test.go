@@ -0,0 +1,85 @@
+package extension_test
+
+import (
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// gatedWatcher reports the pods of the events it handles, then waits for the gate to open
+type gatedWatcher struct {
+	handled chan string
+	gate    chan struct{}
+}
+
+func (w *gatedWatcher) Handle(_ Manager, e watch.Event) {
+	w.handled <- e.Object.(*corev1.Pod).Name
+	<-w.gate
+}
+
+var _ = Describe("Watcher queues", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		watcher       *gatedWatcher
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		watcher = &gatedWatcher{handled: make(chan string), gate: make(chan struct{})}
+		eiriniManager.AddWatcher(watcher)
+	})
+
+	AfterEach(func() {
+		eiriniManager.Stop()
+	})
+
+	// burst sends the pods a to d while the watcher is stuck handling a, and returns the pods it handles next
+	burst := func() []string {
+		podWatch := watch.NewFake()
+		done := make(chan struct{})
+		go func() {
+			eiriniManager.ReadWatcherEvent(podWatch)
+			close(done)
+		}()
+
+		podWatch.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a"}})
+		Eventually(watcher.handled).Should(Receive(Equal("a")))
+		for _, name := range []string{"b", "c", "d"} {
+			podWatch.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		}
+		podWatch.Stop()
+		Eventually(done).Should(BeClosed())
+
+		close(watcher.gate)
+		var handled []string
+		for i := 0; i < 2; i++ {
+			var name string
+			Eventually(watcher.handled).Should(Receive(&name))
+			handled = append(handled, name)
+		}
+		Consistently(watcher.handled).ShouldNot(Receive())
+		return handled
+	}
+
+	It("drops the newest events of the full queues", func() {
+		eiriniManager.Options.WatcherQueue = &WatcherQueueOptions{Size: 2}
+		Expect(burst()).To(Equal([]string{"b", "c"}))
+	})
+
+	It("drops the oldest events of the full queues", func() {
+		eiriniManager.Options.WatcherQueue = &WatcherQueueOptions{Size: 2, Overflow: DropOldest}
+		Expect(burst()).To(Equal([]string{"c", "d"}))
+	})
+
+	It("validates the options", func() {
+		_, err := NewManager(ManagerOptions{Namespace: "eirini", WatcherQueue: &WatcherQueueOptions{Overflow: "DropAll"}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("watcherQueue.size: Invalid value"))
+		Expect(err.Error()).To(ContainSubstring(`watcherQueue.overflow: Unsupported value: "DropAll"`))
+	})
+})
@@ -3,12 +3,20 @@ package extension
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"code.cloudfoundry.org/eirinix/util/ctxlog"
+	"code.cloudfoundry.org/eirinix/util/podwebhook"
 	"github.com/pkg/errors"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -31,7 +39,48 @@ type DefaultMutatingWebhook struct {
 
 	// FilterEiriniApps indicates if the webhook will filter Eirini apps or not.
 	FilterEiriniApps bool
-	setReference     setReferenceFunc
+	// EiriniLayout is the layout of the Eirini app pods filtered by the webhook, see ManagerOptions.
+	EiriniLayout EiriniLayout
+	setReference setReferenceFunc
+
+	// ReusePodObjects makes the webhook decode the pods into pooled objects, see ManagerOptions.
+	ReusePodObjects bool
+
+	// StrictDecoding makes the webhook fail to decode the pods with unknown fields, see ManagerOptions.
+	StrictDecoding bool
+	// DecodeErrorPolicy is what the webhook does when the pod can't be decoded, see ManagerOptions.
+	DecodeErrorPolicy DecodeErrorPolicy
+
+	// MinimizePatches drops the patch operations which don't change the object, see ManagerOptions.
+	MinimizePatches bool
+
+	// AnnotateConfigHash stamps the mutated pods with the hash of the extension configuration, see ManagerOptions.
+	AnnotateConfigHash bool
+
+	// Validating registers the webhook in the ValidatingWebhookConfiguration, see ValidatingExtension.
+	Validating bool
+
+	// Chaos injects faults into the webhook, see ChaosOptions.
+	Chaos *ChaosOptions
+
+	// ProfilingLabels tags the goroutines handling the requests with pprof labels, see ManagerOptions.
+	ProfilingLabels bool
+
+	// OperatorPodLabels, OperatorServiceAccount and OperatorNamespace identify the operator pods, which are
+	// excluded from the webhook, see ManagerOptions.
+	OperatorPodLabels      map[string]string
+	OperatorServiceAccount string
+	OperatorNamespace      string
+
+	// slo records the responses for the SLIs, see ManagerOptions.SLO
+	slo *sloTracker
+	// audit streams the decisions to the audit sinks, see ManagerOptions.Audit
+	audit *auditLog
+	// budget enforces the resource budget of the extension, see ManagerOptions.Budget
+	budget *budgetEnforcer
+	// codecs decode the objects passed to an ObjectHandler, see objectCodecs
+	codecs           serializer.CodecFactory
+	objectCodecsOnce sync.Once
 
 	// Name is the name of the webhook
 	Name string
@@ -43,6 +92,12 @@ type DefaultMutatingWebhook struct {
 	// This optional. If not set, will be defaulted to Ignore (fail-open) by the server.
 	// More details: https://github.com/kubernetes/api/blob/f5c295feaba2cbc946f0bbb8b535fc5f6a0345ee/admissionregistration/v1beta1/types.go#L144-L147
 	FailurePolicy admissionregistrationv1beta1.FailurePolicyType
+	// TimeoutSeconds and ReinvocationPolicy map to the fields of admissionregistrationv1beta1.MutatingWebhook,
+	// see PolicyExtension. Optional.
+	TimeoutSeconds     *int32
+	ReinvocationPolicy *admissionregistrationv1beta1.ReinvocationPolicyType
+	// MatchConditions are added to the v1 webhook configurations, see PolicyExtension. Optional.
+	MatchConditions []MatchCondition
 	// NamespaceSelector maps to the NamespaceSelector field in admissionregistrationv1beta1.Webhook
 	// This optional.
 	NamespaceSelector *metav1.LabelSelector
@@ -68,17 +123,75 @@ func (w *DefaultMutatingWebhook) GetFailurePolicy() admissionregistrationv1beta1
 	return w.FailurePolicy
 }
 
+func (w *DefaultMutatingWebhook) GetTimeoutSeconds() *int32 {
+	return w.TimeoutSeconds
+}
+
+func (w *DefaultMutatingWebhook) GetReinvocationPolicy() *admissionregistrationv1beta1.ReinvocationPolicyType {
+	return w.ReinvocationPolicy
+}
+
+func (w *DefaultMutatingWebhook) GetMatchConditions() []MatchCondition {
+	return w.MatchConditions
+}
+
 func (w *DefaultMutatingWebhook) GetNamespaceSelector() *metav1.LabelSelector {
 	return w.NamespaceSelector
 }
 
 func (w *DefaultMutatingWebhook) GetLabelSelector() *metav1.LabelSelector {
+	var selector *metav1.LabelSelector
 	if w.FilterEiriniApps {
-		return &metav1.LabelSelector{
-			MatchLabels: map[string]string{LabelSourceType: "APP"},
+		layout := w.EiriniLayout
+		if layout.Release == "" {
+			layout = legacyLayout
+		}
+		selector = &metav1.LabelSelector{
+			MatchLabels: layout.AppSelector(),
 		}
 	}
-	return nil
+	if len(w.OperatorPodLabels) == 0 {
+		return selector
+	}
+
+	// The expressions are ANDed, so the pods with any of the operator labels are excluded
+	if selector == nil {
+		selector = &metav1.LabelSelector{}
+	}
+	keys := make([]string, 0, len(w.OperatorPodLabels))
+	for k := range w.OperatorPodLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      k,
+			Operator: metav1.LabelSelectorOpNotIn,
+			Values:   []string{w.OperatorPodLabels[k]},
+		})
+	}
+	return selector
+}
+
+// isOperatorPod returns true if the pod belongs to the operator. It guards against self-mutation when the
+// object selector is not applied, e.g. by clusters without object selector support.
+func (w *DefaultMutatingWebhook) isOperatorPod(pod *corev1.Pod, namespace string) bool {
+	if pod.Namespace != "" {
+		namespace = pod.Namespace
+	}
+	if w.OperatorServiceAccount != "" && pod.Spec.ServiceAccountName == w.OperatorServiceAccount &&
+		(w.OperatorNamespace == "" || namespace == w.OperatorNamespace) {
+		return true
+	}
+	if len(w.OperatorPodLabels) == 0 {
+		return false
+	}
+	for k, v := range w.OperatorPodLabels {
+		if pod.Labels[k] != v {
+			return false
+		}
+	}
+	return true
 }
 
 func (w *DefaultMutatingWebhook) GetHandler() admission.Handler {
@@ -95,11 +208,11 @@ func (w *DefaultMutatingWebhook) GetPath() string {
 
 // GetPod retrieves a pod from a types.Request
 func (w *DefaultMutatingWebhook) GetPod(req admission.Request) (*corev1.Pod, error) {
-	pod := &corev1.Pod{}
 	if w.decoder == nil {
-		return nil, errors.New("No decoder injected")
+		return nil, podwebhook.ErrNoDecoder
 	}
-	err := w.decoder.Decode(req, pod)
+	pod := &corev1.Pod{}
+	err := podwebhook.DecodePod(w.decoder, w.StrictDecoding, req, pod)
 	return pod, err
 }
 
@@ -109,6 +222,11 @@ type WebhookOptions struct {
 	MatchLabels    map[string]string
 	Manager        manager.Manager
 	ManagerOptions ManagerOptions
+	// EiriniLayout is the layout of the Eirini app pods. Optional, defaults to the legacy one
+	EiriniLayout EiriniLayout
+
+	slo   *sloTracker
+	audit *auditLog
 }
 
 // NewWebhook returns a MutatingWebhook out of an Eirini Extension
@@ -118,11 +236,7 @@ func NewWebhook(e Extension, m Manager) MutatingWebhook {
 
 func (w *DefaultMutatingWebhook) getNamespaceSelector(opts WebhookOptions) *metav1.LabelSelector {
 	if len(opts.MatchLabels) == 0 {
-		return &metav1.LabelSelector{
-			MatchLabels: map[string]string{
-				opts.ManagerOptions.getDefaultNamespaceLabel(): opts.ManagerOptions.Namespace,
-			},
-		}
+		return opts.ManagerOptions.namespaceSelector()
 	}
 	return &metav1.LabelSelector{MatchLabels: opts.MatchLabels}
 }
@@ -137,33 +251,61 @@ func (w *DefaultMutatingWebhook) RegisterAdmissionWebHook(server *webhook.Server
 	} else {
 		w.FilterEiriniApps = true
 	}
+	w.ReusePodObjects = opts.ManagerOptions.ReusePodObjects
+	w.StrictDecoding = opts.ManagerOptions.StrictDecoding
+	w.DecodeErrorPolicy = opts.ManagerOptions.DecodeErrorPolicy
+	w.MinimizePatches = opts.ManagerOptions.MinimizePatches
+	w.AnnotateConfigHash = opts.ManagerOptions.AnnotateConfigHash
+	w.Validating = isValidating(w.EiriniExtension)
+	w.Chaos = opts.ManagerOptions.Chaos
+	w.ProfilingLabels = opts.ManagerOptions.ProfilingLabels
+	w.EiriniLayout = opts.EiriniLayout
+	w.OperatorPodLabels = opts.ManagerOptions.operatorPodLabels()
+	w.OperatorServiceAccount = opts.ManagerOptions.OperatorServiceAccount
+	w.OperatorNamespace = opts.ManagerOptions.WebhookNamespace
+	w.slo = opts.slo
+	w.audit = opts.audit
+	if opts.ManagerOptions.Budget != nil {
+		w.budget = newBudgetEnforcer(*opts.ManagerOptions.Budget, extensionName(w.EiriniExtension))
+	}
 
-	globalScopeType := admissionregistrationv1beta1.ScopeType("*")
+	var rules WebhookRules
+	if r, ok := w.EiriniExtension.(RuledExtension); ok {
+		rules = r.WebhookRules()
+	}
+	var err error
+	w.Rules, err = rules.rulesWithOperations()
+	if err != nil {
+		return errors.Wrapf(err, "generating the webhook rules of %s", extensionName(w.EiriniExtension))
+	}
+	if resources := rules.nonPodResources(); len(resources) > 0 && !handlesNonPods(w.EiriniExtension) && !handlesObjects(w.EiriniExtension) {
+		return errors.Errorf("The extension %s targets %s, whose objects are not pods, and must implement NonPodHandler or ObjectHandler", extensionName(w.EiriniExtension), strings.Join(resources, ", "))
+	}
+	if !rules.targetsPods() {
+		// The Eirini app labels are only set on the pods
+		w.FilterEiriniApps = false
+	}
 
 	w.FailurePolicy = *opts.ManagerOptions.FailurePolicy
-	w.Rules = []admissionregistrationv1beta1.RuleWithOperations{
-		{
-			Rule: admissionregistrationv1beta1.Rule{
-				APIGroups:   []string{""},
-				APIVersions: []string{"v1"},
-				Resources:   []string{"pods"},
-				Scope:       &globalScopeType,
-			},
-			Operations: []admissionregistrationv1beta1.OperationType{
-				"CREATE",
-				"UPDATE",
-			},
-		},
+	if err := w.applyWebhookPolicy(); err != nil {
+		return err
 	}
 	w.Path = fmt.Sprintf("/%s", opts.ID)
 
-	w.Name = fmt.Sprintf("%s.%s.org", opts.ID, opts.ManagerOptions.OperatorFingerprint)
-	if opts.ManagerOptions.Namespace != "" {
+	w.Name = opts.ManagerOptions.resourceName(NamedWebhook, opts.ID)
+	if len(opts.ManagerOptions.WatchedNamespaces()) > 0 {
 		w.NamespaceSelector = w.getNamespaceSelector(opts)
 	}
 	w.Webhook = &admission.Webhook{
 		Handler: w,
 	}
+	// The webhook logs with the Manager logger until the kubernetes manager injects its own, so that it can
+	// already serve requests through the mux of the webhook server
+	if opts.ManagerOptions.Logger != nil {
+		if err := w.Webhook.InjectLogger(NewLogrFromZap(opts.ManagerOptions.Logger)); err != nil {
+			return errors.Wrapf(err, "injecting the logger into webhook %s", w.Name)
+		}
+	}
 
 	if server == nil {
 		return errors.New("The Mutating webhook needs a Webhook server to register to")
@@ -186,6 +328,117 @@ func (w *DefaultMutatingWebhook) InjectDecoder(d *admission.Decoder) error {
 
 // Handle delegates the Handle function to the Eirini Extension
 func (w *DefaultMutatingWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
-	pod, _ := w.GetPod(req)
-	return w.EiriniExtension.Handle(ctx, w.EiriniExtensionManager, pod, req)
+	if res, ok := w.reachabilityProbe(req); ok {
+		return res
+	}
+	if res, ok := w.handoverCheck(req); ok {
+		return res
+	}
+
+	start := time.Now()
+	name := extensionName(w.EiriniExtension)
+	if w.EiriniExtensionManager != nil && w.EiriniExtensionManager.GetLogger() != nil {
+		ctx = ctxlog.NewAdmissionContext(ctx, w.EiriniExtensionManager.GetLogger(), name, req.Namespace, req.Name, string(req.UID))
+	}
+
+	res := w.handleBudgeted(ctx, req)
+	if w.Validating {
+		res = w.dropPatches(ctx, res)
+	}
+	if w.MinimizePatches && !w.Validating {
+		res = w.minimizePatches(ctx, req, res)
+	}
+	if w.AnnotateConfigHash && !w.Validating {
+		res = w.annotateConfigHash(ctx, req, res)
+	}
+	if w.EiriniExtensionManager != nil {
+		annotateGeneration(&res, w.EiriniExtensionManager.ConfigGeneration())
+	}
+
+	latency := time.Since(start)
+	operation := string(req.Operation)
+	observeDuration(ctx, admissionDuration.WithLabelValues(name, operation), latency.Seconds())
+	w.slo.record(name, res, latency, start.Add(latency))
+	if w.audit != nil {
+		w.audit.record(w.auditEvent(ctx, req, res, start, latency))
+	}
+	admissionRequests.WithLabelValues(name, operation, admissionResult(res)).Inc()
+	if ops, err := podwebhook.ResponsePatches(res); err == nil && len(ops) > 0 {
+		admissionPatchOperations.WithLabelValues(name, operation).Add(float64(len(ops)))
+	}
+	return res
+}
+
+// handleNonPod calls the extension with a nil pod if it is a NonPodHandler, and admits the request
+// unchanged otherwise
+func (w *DefaultMutatingWebhook) handleNonPod(ctx context.Context, req admission.Request, reason string) admission.Response {
+	if handlesNonPods(w.EiriniExtension) {
+		return w.handleExtension(ctx, nil, req)
+	}
+	return admission.Allowed(reason)
+}
+
+// decodeErrorPolicy returns the DecodeErrorPolicy of the webhook, with the default applied
+func (w *DefaultMutatingWebhook) decodeErrorPolicy() DecodeErrorPolicy {
+	if w.DecodeErrorPolicy == "" {
+		return DecodeErrorPassThrough
+	}
+	return w.DecodeErrorPolicy
+}
+
+// admissionResult classifies the response for the metrics
+func admissionResult(res admission.Response) string {
+	switch {
+	case res.Allowed:
+		return "allowed"
+	case res.Result == nil || res.Result.Code == 0 || res.Result.Code == http.StatusForbidden:
+		return "denied"
+	default:
+		return "errored"
+	}
+}
+
+func (w *DefaultMutatingWebhook) handle(ctx context.Context, req admission.Request) admission.Response {
+	decodeFailure := w.Chaos.inject(ctx, extensionName(w.EiriniExtension))
+
+	if req.Kind.Kind != "" && req.Kind.Kind != "Pod" {
+		// Sub-resources like pods/binding and the other resources don't carry a pod
+		return w.handleObject(ctx, req, "the request object is not a pod")
+	}
+	if len(req.Object.Raw) == 0 {
+		// e.g. the deletions
+		return w.handleNonPod(ctx, req, "the request has no pod")
+	}
+
+	pod := &corev1.Pod{}
+	if w.ReusePodObjects {
+		pod = getPod()
+		defer putPod(pod)
+	}
+
+	err := podwebhook.DecodePod(w.decoder, w.StrictDecoding, req, pod)
+	if decodeFailure {
+		err = errChaosDecodeFailure
+	}
+	if err != nil {
+		policy := w.decodeErrorPolicy()
+		decodeErrors.WithLabelValues(extensionName(w.EiriniExtension), string(policy)).Inc()
+		if w.EiriniExtensionManager != nil && w.EiriniExtensionManager.GetLogger() != nil {
+			w.EiriniExtensionManager.GetLogger().Warnf("Decoding pod %s/%s for %s (%s): %s", req.Namespace, req.Name, w.Name, policy, err)
+		}
+
+		switch policy {
+		case DecodeErrorAllow:
+			return admission.Allowed("pod could not be decoded")
+		case DecodeErrorDeny:
+			return admission.Errored(http.StatusBadRequest, errors.Wrap(err, "decoding the pod"))
+		}
+		if err == podwebhook.ErrNoDecoder || err == errChaosDecodeFailure {
+			return w.handleNonPod(ctx, req, "pod could not be decoded")
+		}
+	}
+	if w.isOperatorPod(pod, req.Namespace) {
+		return admission.Allowed("operator pods are not mutated")
+	}
+	return w.handleExtension(ctx, pod, req)
 }
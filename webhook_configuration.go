@@ -2,15 +2,18 @@ package extension
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
 	"path"
 	"strconv"
+	"time"
 
-	"code.cloudfoundry.org/quarks-utils/pkg/credsgen"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
@@ -18,6 +21,7 @@ import (
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	machinerytypes "k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -27,23 +31,44 @@ import (
 
 // WebhookConfig generates certificates and the configuration for the webhook server
 type WebhookConfig struct {
-	ConfigName    string
+	ConfigName string
+	// ValidatingConfigName is the name of the ValidatingWebhookConfiguration of the validating webhooks, see
+	// ValidatingExtension. Optional, the validating webhooks are not registered if empty
+	ValidatingConfigName string
+
 	CertDir       string
 	Certificate   []byte
 	Key           []byte
 	CaCertificate []byte
 	CaKey         []byte
 
+	// Annotations are set on the generated secret and webhook configuration
+	Annotations map[string]string
+
+	// APIVersion is the admissionregistration API version of the configurations, AdmissionRegistrationV1Beta1
+	// or AdmissionRegistrationV1. Optional, defaults to AdmissionRegistrationV1Beta1
+	APIVersion AdmissionRegistrationAPI
+
 	serviceName, webhookNamespace string
 	setupCertificateName          string
 
 	client    client.Client
 	config    *Config
-	generator credsgen.Generator
+	generator CredentialGenerator
+
+	// certManager makes cert-manager issue the certificate instead of the generator, see CertManagerOptions
+	certManager *CertManagerOptions
+
+	// providedTLS makes the webhook server serve the certificate provided by the operator, see TLSOptions
+	providedTLS *TLSOptions
+
+	// mutatingRegistered and validatingRegistered are set while the configurations created by registerWebhooks
+	// exist, so that unregisterWebhooks only deletes those
+	mutatingRegistered, validatingRegistered bool
 }
 
 // NewWebhookConfig returns a new WebhookConfig
-func NewWebhookConfig(c client.Client, config *Config, generator credsgen.Generator, configName string, setupCertificateName string, serviceName string, webhookNamespace string) *WebhookConfig {
+func NewWebhookConfig(c client.Client, config *Config, generator CredentialGenerator, configName string, setupCertificateName string, serviceName string, webhookNamespace string) *WebhookConfig {
 	return &WebhookConfig{
 		ConfigName:           configName,
 		CertDir:              path.Join(os.TempDir(), setupCertificateName),
@@ -59,6 +84,13 @@ func NewWebhookConfig(c client.Client, config *Config, generator credsgen.Genera
 // SetupCertificate ensures that a CA and a certificate is available for the
 // webhook server
 func (f *WebhookConfig) setupCertificate(ctx context.Context) error {
+	if f.certManager != nil {
+		return f.setupIssuedCertificate(ctx)
+	}
+	if f.providedTLS != nil {
+		return f.setupProvidedCertificate()
+	}
+
 	secretNamespacedName := machinerytypes.NamespacedName{
 		Name:      f.setupCertificateName,
 		Namespace: f.webhookNamespace,
@@ -79,70 +111,22 @@ func (f *WebhookConfig) setupCertificate(ctx context.Context) error {
 
 	if secret.GetName() != "" {
 		ctxlog.Info(ctx, "Not creating the webhook server certificate because it already exists")
-		data := secret.Object["data"].(map[string]interface{})
-		caKey, err := base64.StdEncoding.DecodeString(data["ca_private_key"].(string))
-		if err != nil {
+		if err := f.loadCertificateSecret(secret); err != nil {
 			return err
 		}
-		caCert, err := base64.StdEncoding.DecodeString(data["ca_certificate"].(string))
-		if err != nil {
-			return err
-		}
-		key, err := base64.StdEncoding.DecodeString(data["private_key"].(string))
-		if err != nil {
-			return err
-		}
-		cert, err := base64.StdEncoding.DecodeString(data["certificate"].(string))
-		if err != nil {
-			return err
-		}
-
-		f.CaKey = caKey
-		f.CaCertificate = caCert
-		f.Key = key
-		f.Certificate = cert
 	} else {
 		ctxlog.Info(ctx, "Creating webhook server certificate")
 
-		// Generate CA
-		caRequest := credsgen.CertificateGenerationRequest{
-			CommonName:       "SCF CA",
-			IsCA:             true,
-			AlternativeNames: []string{f.config.WebhookServerHost},
-		}
-
-		caCert, err := f.generator.GenerateCertificate("webhook-server-ca", caRequest)
-		if err != nil {
-			return err
-		}
-
-		commonName := f.config.WebhookServerHost
-		if len(f.serviceName) > 0 {
-			if len(f.webhookNamespace) == 0 {
-				return errors.New("No webhook namespace defined. If you run the extension under a service, you need to specify the service namespace")
-			}
-			commonName = fmt.Sprintf("%s.%s.svc", f.serviceName, f.webhookNamespace)
-		}
-
-		// Generate Certificate
-		request := credsgen.CertificateGenerationRequest{
-			IsCA:       false,
-			CommonName: commonName,
-			CA: credsgen.Certificate{
-				IsCA:        true,
-				PrivateKey:  caCert.PrivateKey,
-				Certificate: caCert.Certificate,
-			},
-		}
-		cert, err := f.generator.GenerateCertificate("webhook-server-cert", request)
+		caCert, cert, err := f.generateCertificates()
 		if err != nil {
 			return err
 		}
 
 		newSecret := &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      secretNamespacedName.Name,
-				Namespace: secretNamespacedName.Namespace,
+				Name:        secretNamespacedName.Name,
+				Namespace:   secretNamespacedName.Namespace,
+				Annotations: f.Annotations,
 			},
 			Data: map[string][]byte{
 				"certificate":    cert.Certificate,
@@ -152,6 +136,10 @@ func (f *WebhookConfig) setupCertificate(ctx context.Context) error {
 			},
 		}
 		err = f.client.Create(ctx, newSecret)
+		if k8serrors.IsAlreadyExists(err) {
+			// Another replica created the certificate meanwhile, it is used instead
+			return f.setupCertificate(ctx)
+		}
 		if err != nil {
 			return err
 		}
@@ -170,72 +158,295 @@ func (f *WebhookConfig) setupCertificate(ctx context.Context) error {
 	return nil
 }
 
+// generateCertificates generates a CA and the webhook server certificate it signs
+func (f *WebhookConfig) generateCertificates() (Certificate, Certificate, error) {
+	// Generate CA
+	caRequest := CertificateRequest{
+		CommonName:       "SCF CA",
+		IsCA:             true,
+		AlternativeNames: []string{f.config.WebhookServerHost},
+	}
+
+	caCert, err := f.generator.GenerateCertificate("webhook-server-ca", caRequest)
+	if err != nil {
+		return Certificate{}, Certificate{}, err
+	}
+
+	commonName, err := f.serverName()
+	if err != nil {
+		return Certificate{}, Certificate{}, err
+	}
+
+	// Generate Certificate
+	request := CertificateRequest{
+		IsCA:       false,
+		CommonName: commonName,
+		CA: Certificate{
+			IsCA:        true,
+			PrivateKey:  caCert.PrivateKey,
+			Certificate: caCert.Certificate,
+		},
+	}
+	cert, err := f.generator.GenerateCertificate("webhook-server-cert", request)
+	if err != nil {
+		return Certificate{}, Certificate{}, err
+	}
+	return caCert, cert, nil
+}
+
+// loadCertificateSecret sets the certificates of the configuration from the data of their secret
+func (f *WebhookConfig) loadCertificateSecret(secret *unstructured.Unstructured) error {
+	data := secret.Object["data"].(map[string]interface{})
+	caKey, err := base64.StdEncoding.DecodeString(data["ca_private_key"].(string))
+	if err != nil {
+		return err
+	}
+	caCert, err := base64.StdEncoding.DecodeString(data["ca_certificate"].(string))
+	if err != nil {
+		return err
+	}
+	key, err := base64.StdEncoding.DecodeString(data["private_key"].(string))
+	if err != nil {
+		return err
+	}
+	cert, err := base64.StdEncoding.DecodeString(data["certificate"].(string))
+	if err != nil {
+		return err
+	}
+
+	f.CaKey = caKey
+	f.CaCertificate = caCert
+	f.Key = key
+	f.Certificate = cert
+	return nil
+}
+
+// serverName returns the name the API server reaches the webhook server with: the name of the service, or the
+// webhook server host
+func (f *WebhookConfig) serverName() (string, error) {
+	if len(f.serviceName) == 0 {
+		return f.config.WebhookServerHost, nil
+	}
+	if len(f.webhookNamespace) == 0 {
+		return "", errors.New("No webhook namespace defined. If you run the extension under a service, you need to specify the service namespace")
+	}
+	return fmt.Sprintf("%s.%s.svc", f.serviceName, f.webhookNamespace), nil
+}
+
+// renewCertificate deletes the secret of the webhook server certificate, e.g. once it expired, and generates a
+// new one. The secret is only deleted if it wasn't replaced meanwhile, so that the replicas renewing it
+// concurrently all use the first new one.
+func (f *WebhookConfig) renewCertificate(ctx context.Context) error {
+	secret := &unstructured.Unstructured{}
+	secret.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Secret"})
+	key := machinerytypes.NamespacedName{Name: f.setupCertificateName, Namespace: f.webhookNamespace}
+	if err := f.client.Get(ctx, key, secret); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	if secret.GetName() != "" {
+		uid := secret.GetUID()
+		err := f.client.Delete(ctx, secret, client.Preconditions{UID: &uid})
+		if client.IgnoreNotFound(err) != nil && !k8serrors.IsConflict(err) {
+			return errors.Wrap(err, "deleting the webhook server certificate")
+		}
+	}
+	return f.setupCertificate(ctx)
+}
+
+// certificateExpiry returns the expiry time of the webhook server certificate
+func (f *WebhookConfig) certificateExpiry() (time.Time, error) {
+	cert, err := f.parseCertificate()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// parseCertificate parses the webhook server certificate
+func (f *WebhookConfig) parseCertificate() (*x509.Certificate, error) {
+	block, _ := pem.Decode(f.Certificate)
+	if block == nil {
+		return nil, errors.New("No PEM data found in the webhook server certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing the webhook server certificate")
+	}
+	return cert, nil
+}
+
+// clientConfig returns how the API server reaches the webhook: through the service, or the webhook server host
+func (f *WebhookConfig) clientConfig(webhook MutatingWebhook) admissionregistrationv1beta1.WebhookClientConfig {
+	if f.serviceName != "" {
+		p := webhook.GetPath()
+		return admissionregistrationv1beta1.WebhookClientConfig{
+			CABundle: f.CaCertificate,
+			Service: &admissionregistrationv1beta1.ServiceReference{
+				Name:      f.serviceName,
+				Namespace: f.webhookNamespace,
+				Path:      &p,
+				Port:      &f.config.WebhookServerPort,
+			},
+		}
+	}
+	url := url.URL{
+		Scheme: "https",
+		Host:   net.JoinHostPort(f.config.WebhookServerHost, strconv.Itoa(int(f.config.WebhookServerPort))),
+		Path:   webhook.GetPath(),
+	}
+	urlString := url.String()
+	return admissionregistrationv1beta1.WebhookClientConfig{
+		CABundle: f.CaCertificate,
+		URL:      &urlString,
+	}
+}
+
 func (f *WebhookConfig) GenerateAdmissionWebhook(webhooks []MutatingWebhook) []admissionregistrationv1beta1.MutatingWebhook {
 
 	var mutatingHooks []admissionregistrationv1beta1.MutatingWebhook
 
 	for _, webhook := range webhooks {
-		var clientConfig admissionregistrationv1beta1.WebhookClientConfig
-		if f.serviceName != "" {
-			p := webhook.GetPath()
-			clientConfig = admissionregistrationv1beta1.WebhookClientConfig{
-				CABundle: f.CaCertificate,
-				Service: &admissionregistrationv1beta1.ServiceReference{
-					Name:      f.serviceName,
-					Namespace: f.webhookNamespace,
-					Path:      &p,
-					Port:      &f.config.WebhookServerPort,
-				},
-			}
-		} else {
-			url := url.URL{
-				Scheme: "https",
-				Host:   net.JoinHostPort(f.config.WebhookServerHost, strconv.Itoa(int(f.config.WebhookServerPort))),
-				Path:   webhook.GetPath(),
-			}
-			urlString := url.String()
-			clientConfig = admissionregistrationv1beta1.WebhookClientConfig{
-				CABundle: f.CaCertificate,
-				URL:      &urlString,
-			}
-		}
 		p := webhook.GetFailurePolicy()
 		wh := admissionregistrationv1beta1.MutatingWebhook{
+			Name:               webhook.GetName(),
+			Rules:              webhook.GetRules(),
+			FailurePolicy:      &p,
+			NamespaceSelector:  webhook.GetNamespaceSelector(),
+			ClientConfig:       f.clientConfig(webhook),
+			ObjectSelector:     webhook.GetLabelSelector(),
+			TimeoutSeconds:     webhook.GetTimeoutSeconds(),
+			ReinvocationPolicy: webhook.GetReinvocationPolicy(),
+		}
+
+		mutatingHooks = append(mutatingHooks, wh)
+	}
+	return mutatingHooks
+}
+
+// GenerateValidatingWebhook returns the entries of the ValidatingWebhookConfiguration of the webhooks
+func (f *WebhookConfig) GenerateValidatingWebhook(webhooks []MutatingWebhook) []admissionregistrationv1beta1.ValidatingWebhook {
+	var validatingHooks []admissionregistrationv1beta1.ValidatingWebhook
+	for _, webhook := range webhooks {
+		p := webhook.GetFailurePolicy()
+		validatingHooks = append(validatingHooks, admissionregistrationv1beta1.ValidatingWebhook{
 			Name:              webhook.GetName(),
 			Rules:             webhook.GetRules(),
 			FailurePolicy:     &p,
 			NamespaceSelector: webhook.GetNamespaceSelector(),
-			ClientConfig:      clientConfig,
+			ClientConfig:      f.clientConfig(webhook),
 			ObjectSelector:    webhook.GetLabelSelector(),
-		}
-
-		mutatingHooks = append(mutatingHooks, wh)
+			TimeoutSeconds:    webhook.GetTimeoutSeconds(),
+		})
 	}
-	return mutatingHooks
+	return validatingHooks
 }
 
+// registerWebhooks creates the MutatingWebhookConfiguration, and the ValidatingWebhookConfiguration if some of
+// the webhooks are validating ones
 func (f *WebhookConfig) registerWebhooks(ctx context.Context, webhooks []MutatingWebhook) error {
 	if len(f.CaCertificate) == 0 {
 		return errors.New("Can not create a webhook server config with an empty ca certificate")
 	}
+	mutating, validating := splitWebhooks(webhooks)
+	if f.ValidatingConfigName == "" {
+		mutating = webhooks
+	}
 
 	config := &admissionregistrationv1beta1.MutatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      f.ConfigName,
-			Namespace: f.config.Namespace,
+			Name:        f.ConfigName,
+			Namespace:   f.config.Namespace,
+			Annotations: f.Annotations,
 		},
-		Webhooks: f.GenerateAdmissionWebhook(webhooks),
+		Webhooks: f.GenerateAdmissionWebhook(mutating),
 	}
 
-	f.client.Delete(ctx, config)
-	err := f.client.Create(ctx, config)
+	versioned, err := f.versioned(config)
 	if err != nil {
+		return err
+	}
+	if versioned, err = f.withMatchConditions(versioned, mutating); err != nil {
+		return err
+	}
+	f.client.Delete(ctx, versioned)
+	if err := f.client.Create(ctx, versioned); err != nil {
 		return errors.Wrap(err, "generating the webhook configuration")
 	}
+	f.mutatingRegistered = true
+
+	if f.ValidatingConfigName == "" {
+		return nil
+	}
+	validatingConfig := &admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        f.ValidatingConfigName,
+			Annotations: f.Annotations,
+		},
+		Webhooks: f.GenerateValidatingWebhook(validating),
+	}
+	versioned, err = f.versioned(validatingConfig)
+	if err != nil {
+		return err
+	}
+	if versioned, err = f.withMatchConditions(versioned, validating); err != nil {
+		return err
+	}
+	// The configuration of the validating extensions which were removed is deleted
+	f.client.Delete(ctx, versioned)
+	f.validatingRegistered = false
+	if len(validating) == 0 {
+		return nil
+	}
+	if err := f.client.Create(ctx, versioned); err != nil {
+		return errors.Wrap(err, "generating the validating webhook configuration")
+	}
+	f.validatingRegistered = true
+	return nil
+}
 
+// unregisterWebhooks deletes the MutatingWebhookConfiguration and the ValidatingWebhookConfiguration created by
+// registerWebhooks
+func (f *WebhookConfig) unregisterWebhooks(ctx context.Context) error {
+	var configs []runtime.Object
+	if f.mutatingRegistered {
+		configs = append(configs, &admissionregistrationv1beta1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: f.ConfigName}})
+	}
+	if f.validatingRegistered {
+		configs = append(configs, &admissionregistrationv1beta1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: f.ValidatingConfigName}})
+	}
+	for _, config := range configs {
+		versioned, err := f.versioned(config)
+		if err != nil {
+			return err
+		}
+		if err := f.client.Delete(ctx, versioned); client.IgnoreNotFound(err) != nil {
+			return errors.Wrap(err, "deleting the webhook configuration")
+		}
+	}
+	f.mutatingRegistered, f.validatingRegistered = false, false
 	return nil
 }
 
+// patchFailurePolicy sets the failure policy of the webhook at the index of the live mutating or validating
+// configuration, checking that the webhook there is the expected one
+func (f *WebhookConfig) patchFailurePolicy(ctx context.Context, validating bool, index int, name string, policy admissionregistrationv1beta1.FailurePolicyType) error {
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": fmt.Sprintf("/webhooks/%d/name", index), "value": name},
+		{"op": "replace", "path": fmt.Sprintf("/webhooks/%d/failurePolicy", index), "value": policy},
+	})
+	if err != nil {
+		return err
+	}
+	var config runtime.Object = &admissionregistrationv1beta1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: f.ConfigName}}
+	if validating {
+		config = &admissionregistrationv1beta1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: f.ValidatingConfigName}}
+	}
+	if config, err = f.versioned(config); err != nil {
+		return err
+	}
+	return f.client.Patch(ctx, config, client.RawPatch(machinerytypes.JSONPatchType, patch))
+}
+
 func (f *WebhookConfig) writeSecretFiles() error {
 	if exists, _ := afero.DirExists(f.config.Fs, f.CertDir); !exists {
 		err := f.config.Fs.Mkdir(f.CertDir, 0700)
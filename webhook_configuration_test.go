@@ -6,8 +6,6 @@ import (
 	. "code.cloudfoundry.org/eirinix"
 	catalog "code.cloudfoundry.org/eirinix/testing"
 	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
-	credsgen "code.cloudfoundry.org/quarks-utils/pkg/credsgen"
-	gfakes "code.cloudfoundry.org/quarks-utils/pkg/credsgen/fakes"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gstruct"
@@ -24,7 +22,7 @@ var _ = Describe("Webhook configuration implementation", func() {
 		manager                             *cfakes.FakeManager
 		client                              *cfakes.FakeClient
 		ctx                                 context.Context
-		generator                           *gfakes.FakeGenerator
+		generator                           *cfakes.FakeCredentialGenerator
 		eirinixcatalog                      catalog.Catalog
 		ServiceManager, Manager             Manager
 		eiriniServiceManager, eiriniManager *DefaultExtensionManager
@@ -49,8 +47,8 @@ var _ = Describe("Webhook configuration implementation", func() {
 		manager.GetRESTMapperReturns(restMapper)
 		manager.GetWebhookServerReturns(&webhook.Server{})
 
-		generator = &gfakes.FakeGenerator{}
-		generator.GenerateCertificateReturns(credsgen.Certificate{Certificate: []byte("thecert")}, nil)
+		generator = &cfakes.FakeCredentialGenerator{}
+		generator.GenerateCertificateReturns(Certificate{Certificate: []byte("thecert")}, nil)
 
 		ctx = catalog.NewContext()
 
@@ -127,4 +125,31 @@ var _ = Describe("Webhook configuration implementation", func() {
 			})))
 		})
 	})
+
+	Context("with the operator pod labels", func() {
+		It("excludes the operator pods from the ObjectSelector", func() {
+			w := NewWebhook(eirinixcatalog.SimpleExtension(), eiriniServiceManager)
+
+			filter := false
+			err := w.RegisterAdmissionWebHook(eiriniManager.WebhookServer, WebhookOptions{ID: "volume", ManagerOptions: ManagerOptions{
+				FailurePolicy:       &failurePolicy,
+				Namespace:           "eirini",
+				OperatorFingerprint: "eirini-x",
+				FilterEiriniApps:    &filter,
+				Service:             &ServiceOptions{Selector: map[string]string{"app": "eirini-x"}},
+			}})
+			Expect(err).ToNot(HaveOccurred())
+			eiriniServiceManager.GenWebHookServer()
+			admissions := eiriniServiceManager.WebhookConfig.GenerateAdmissionWebhook([]MutatingWebhook{w})
+
+			Expect(admissions).To(HaveLen(1))
+			Expect(admissions[0].ObjectSelector).To(PointTo(Equal(metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      "app",
+					Operator: metav1.LabelSelectorOpNotIn,
+					Values:   []string{"eirini-x"},
+				}},
+			})))
+		})
+	})
 })
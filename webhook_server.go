@@ -0,0 +1,209 @@
+package extension
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/eirinix/internal/certwatcher"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// admissionServer serves the admission webhooks registered to a webhook.Server.
+//
+// It takes the place of the controller-runtime webhook server runnable, so that the manager
+// controls the listener and the handler chain in front of the webhooks.
+type admissionServer struct {
+	host    string
+	port    int
+	certDir string
+
+	server   *webhook.Server
+	webhooks []MutatingWebhook
+
+	frontProxy   *FrontProxyOptions
+	clientAuth   *clientAuthenticator
+	backpressure *BackpressureOptions
+	drainTimeout time.Duration
+	exemplars    bool
+	logger       *zap.SugaredLogger
+
+	setFields inject.Func
+
+	// certificate is the secret of the server certificate, and onCertificateRejected is called when a client
+	// rejects it in the TLS handshake, see tlsErrorWriter
+	certificate           string
+	onCertificateRejected func(reason string)
+
+	// serving is set while the server accepts TLS connections, see isServing
+	serving int32
+}
+
+func newAdmissionServer(server *webhook.Server, webhooks []MutatingWebhook, opts ManagerOptions, logger *zap.SugaredLogger) *admissionServer {
+	return &admissionServer{
+		host:         server.Host,
+		port:         server.Port,
+		certDir:      server.CertDir,
+		server:       server,
+		webhooks:     webhooks,
+		frontProxy:   opts.FrontProxy,
+		backpressure: opts.Backpressure,
+		drainTimeout: opts.drainTimeout(),
+		exemplars:    opts.Exemplars,
+		logger:       logger,
+	}
+}
+
+// InjectFunc is called by the kubernetes manager when the server is added to it
+func (s *admissionServer) InjectFunc(f inject.Func) error {
+	s.setFields = f
+	return nil
+}
+
+// NeedLeaderElection makes every replica serve admission requests
+func (s *admissionServer) NeedLeaderElection() bool {
+	return false
+}
+
+func (s *admissionServer) listen() (net.Listener, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(s.host, strconv.Itoa(s.port)))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.frontProxy != nil && s.frontProxy.ProxyProtocol {
+		listener, err = NewProxyProtocolListener(listener, *s.frontProxy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+func (s *admissionServer) handler() (http.Handler, error) {
+	// WebhookMux is only set once a handler is registered to the webhook server, the other paths are answered
+	// with 404
+	fallback := http.NotFoundHandler()
+	if s.server.WebhookMux != nil {
+		fallback = s.server.WebhookMux
+	}
+
+	// The Eirini webhooks are served with pooled buffers, other handlers registered to the
+	// webhook server are served as they are
+	mux := http.NewServeMux()
+	mux.Handle("/", fallback)
+	for _, w := range s.webhooks {
+		if w.GetWebhook() != nil {
+			mux.Handle(w.GetPath(), AdmissionReviewHandler(w.GetWebhook()))
+		}
+	}
+	var h http.Handler = mux
+	if s.backpressure != nil {
+		h = NewBackpressureHandler(h, *s.backpressure)
+	}
+
+	if s.exemplars {
+		h = traceIDHandler(h)
+	}
+
+	// The client address is the one resolved by the front proxy handler, if any
+	inner := h
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Debugf("Received admission request on %s from %s", r.URL.Path, r.RemoteAddr)
+		inner.ServeHTTP(w, r.WithContext(ContextWithSourceAddress(r.Context(), r.RemoteAddr)))
+	})
+
+	if s.frontProxy != nil && s.frontProxy.ForwardedHeaders {
+		var err error
+		if h, err = NewForwardedHeadersHandler(h, *s.frontProxy); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// isServing returns true once the server listens for TLS connections, until it stops
+func (s *admissionServer) isServing() bool {
+	return atomic.LoadInt32(&s.serving) == 1
+}
+
+// Start runs the server until the stop channel is closed
+func (s *admissionServer) Start(stop <-chan struct{}) error {
+	for _, w := range s.webhooks {
+		if s.setFields == nil {
+			break
+		}
+		if err := s.setFields(w.GetWebhook()); err != nil {
+			return errors.Wrapf(err, "injecting dependencies into webhook %s", w.GetName())
+		}
+	}
+
+	certWatcher, err := certwatcher.New(filepath.Join(s.certDir, "tls.crt"), filepath.Join(s.certDir, "tls.key"))
+	if err != nil {
+		return errors.Wrap(err, "loading the webhook server certificate")
+	}
+	certWatcher.OnError = func(err error) {
+		s.logger.Errorf("Reloading the webhook server certificate: %s", err.Error())
+	}
+	go func() {
+		if err := certWatcher.Start(stop); err != nil {
+			s.logger.Errorf("Certificate watcher failed: %s", err.Error())
+		}
+	}()
+
+	handler, err := s.handler()
+	if err != nil {
+		return err
+	}
+
+	listener, err := s.listen()
+	if err != nil {
+		return errors.Wrap(err, "starting the webhook server listener")
+	}
+	config := &tls.Config{
+		NextProtos:     []string{"h2"},
+		GetCertificate: certWatcher.GetCertificate,
+	}
+	if s.clientAuth != nil {
+		config = s.clientAuth.tlsConfig(config)
+	}
+	listener = tls.NewListener(listener, config)
+
+	s.logger.Infof("Serving webhooks on %s", listener.Addr().String())
+	atomic.StoreInt32(&s.serving, 1)
+	defer atomic.StoreInt32(&s.serving, 0)
+
+	// The in-flight requests are drained on stop, so that rolling restarts don't fail admissions mid-request
+	draining := NewDrainingHandler(handler)
+	errorLog := &tlsErrorWriter{logger: s.logger, certificate: s.certificate, onRejected: s.onCertificateRejected}
+	srv := &http.Server{Handler: draining, ErrorLog: log.New(errorLog, "", 0)}
+	idleConnsClosed := make(chan struct{})
+	go func() {
+		<-stop
+		s.logger.Infof("Draining the webhook server, waiting up to %s for %d in-flight requests", s.drainTimeout, draining.InFlight())
+		dropped, err := draining.Drain(srv, s.drainTimeout)
+		if dropped > 0 {
+			admissionDropped.WithLabelValues().Add(float64(dropped))
+			s.logger.Errorf("Dropped %d in-flight admission requests after waiting %s", dropped, s.drainTimeout)
+		}
+		if err != nil {
+			s.logger.Errorf("Failed shutting down the webhook server: %s", err.Error())
+		}
+		close(idleConnsClosed)
+	}()
+
+	if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	<-idleConnsClosed
+	return nil
+}
@@ -3,8 +3,6 @@ package extension_test
 import (
 	"context"
 
-	credsgen "code.cloudfoundry.org/quarks-utils/pkg/credsgen"
-	gfakes "code.cloudfoundry.org/quarks-utils/pkg/credsgen/fakes"
 	. "code.cloudfoundry.org/eirinix"
 	catalog "code.cloudfoundry.org/eirinix/testing"
 	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
@@ -15,7 +13,6 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
-	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 var _ = Describe("Webhook implementation", func() {
@@ -23,7 +20,7 @@ var _ = Describe("Webhook implementation", func() {
 		manager                             *cfakes.FakeManager
 		client                              *cfakes.FakeClient
 		ctx                                 context.Context
-		generator                           *gfakes.FakeGenerator
+		generator                           *cfakes.FakeCredentialGenerator
 		eirinixcatalog                      catalog.Catalog
 		ServiceManager, Manager             Manager
 		eiriniServiceManager, eiriniManager *DefaultExtensionManager
@@ -48,8 +45,8 @@ var _ = Describe("Webhook implementation", func() {
 		manager.GetRESTMapperReturns(restMapper)
 		manager.GetWebhookServerReturns(&webhook.Server{})
 
-		generator = &gfakes.FakeGenerator{}
-		generator.GenerateCertificateReturns(credsgen.Certificate{Certificate: []byte("thecert")}, nil)
+		generator = &cfakes.FakeCredentialGenerator{}
+		generator.GenerateCertificateReturns(Certificate{Certificate: []byte("thecert")}, nil)
 
 		ctx = catalog.NewContext()
 
@@ -80,8 +77,8 @@ var _ = Describe("Webhook implementation", func() {
 
 		It("Delegates to the Extension the handler", func() {
 			ctx := context.Background()
-			t := admission.Request{}
-			res := w.Handle(ctx, t)
+			injectDecoder(w)
+			res := w.Handle(ctx, podRequest())
 			annotations := res.AdmissionResponse.AuditAnnotations
 			v, ok := annotations["name"]
 			Expect(ok).To(Equal(true))
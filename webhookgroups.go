@@ -0,0 +1,136 @@
+package extension
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// WebhookGroup serves the extensions assigned to it (see GroupedExtension) on a separate webhook server, with
+// its own port, certificate, failure policy and webhook configurations, so that e.g. the critical
+// mutations can be isolated from the best-effort ones while sharing the caches and the configuration of the
+// Manager. The extensions not assigned to a group are served by the default webhook server, on Port.
+type WebhookGroup struct {
+	// Name identifies the group in the names of its webhook configuration and certificate secret, e.g.
+	// best-effort for <OperatorFingerprint>-mutating-hook-best-effort. It must be a DNS label
+	Name string
+
+	// Port is the port of the webhook server of the group, different from the other ones
+	Port int32
+
+	// FailurePolicy is the failure policy of the webhooks of the group. Optional, defaults to the FailurePolicy
+	// of the ManagerOptions
+	FailurePolicy *admissionregistrationv1beta1.FailurePolicyType
+}
+
+// GroupedExtension is implemented by the Extensions served by a WebhookGroup of the ManagerOptions
+type GroupedExtension interface {
+	// WebhookGroup returns the name of the group
+	WebhookGroup() string
+}
+
+// webhookGroup is a group of webhooks served together, with its webhook server and configuration. The group
+// without name is the default one.
+type webhookGroup struct {
+	WebhookGroup
+
+	config   *WebhookConfig
+	server   *webhook.Server
+	webhooks []MutatingWebhook
+}
+
+func (g *WebhookGroup) validate(path *field.Path, o *ManagerOptions) field.ErrorList {
+	errs := validateDNSLabel(path.Child("name"), g.Name)
+	if g.Port <= 0 || g.Port > 65535 {
+		errs = append(errs, field.Invalid(path.Child("port"), g.Port, "must be between 1 and 65535"))
+	} else if g.Port == o.Port {
+		errs = append(errs, field.Invalid(path.Child("port"), g.Port, "must be different from the port of the default webhook server"))
+	}
+	if g.FailurePolicy != nil {
+		switch *g.FailurePolicy {
+		case admissionregistrationv1beta1.Fail, admissionregistrationv1beta1.Ignore:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("failurePolicy"), *g.FailurePolicy,
+				[]string{string(admissionregistrationv1beta1.Fail), string(admissionregistrationv1beta1.Ignore)}))
+		}
+	}
+	return errs
+}
+
+// validateWebhookGroups checks the groups, and that their names and ports are unique
+func (o *ManagerOptions) validateWebhookGroups(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	names := map[string]bool{}
+	ports := map[int32]bool{}
+	for i := range o.WebhookGroups {
+		g := &o.WebhookGroups[i]
+		errs = append(errs, g.validate(path.Index(i), o)...)
+		if names[g.Name] {
+			errs = append(errs, field.Duplicate(path.Index(i).Child("name"), g.Name))
+		}
+		if ports[g.Port] {
+			errs = append(errs, field.Duplicate(path.Index(i).Child("port"), g.Port))
+		}
+		names[g.Name] = true
+		ports[g.Port] = true
+	}
+	return errs
+}
+
+// genWebhookGroups creates the webhook servers and configurations of the WebhookGroups
+func (m *DefaultExtensionManager) genWebhookGroups() {
+	m.webhookGroups = nil
+	for _, g := range m.Options.WebhookGroups {
+		config := NewWebhookConfig(
+			m.KubeManager.GetClient(),
+			&Config{
+				CtxTimeOut:        10 * time.Second,
+				Namespace:         m.Options.Namespace,
+				WebhookServerHost: m.Options.Host,
+				WebhookServerPort: g.Port,
+				Fs:                afero.NewOsFs(),
+			},
+			m.Credsgen,
+			m.Options.resourceName(NamedWebhookConfiguration, g.Name),
+			m.Options.SetupCertificateName+"-"+g.Name,
+			m.Options.ServiceName,
+			m.Options.WebhookNamespace)
+		config.ValidatingConfigName = m.Options.resourceName(NamedValidatingWebhookConfiguration, g.Name)
+		config.Annotations = m.Options.versionAnnotations()
+		m.useCertManager(config)
+		m.useProvidedTLS(config)
+
+		m.webhookGroups = append(m.webhookGroups, &webhookGroup{
+			WebhookGroup: g,
+			config:       config,
+			server: &webhook.Server{
+				CertDir: config.CertDir,
+				Port:    int(g.Port),
+				Host:    m.Options.Host,
+			},
+		})
+	}
+}
+
+// servingGroups returns the default group, served by WebhookServer, followed by the WebhookGroups
+func (m *DefaultExtensionManager) servingGroups() []*webhookGroup {
+	return append([]*webhookGroup{{config: m.WebhookConfig, server: m.WebhookServer}}, m.webhookGroups...)
+}
+
+// extensionGroup returns the group serving the extension
+func extensionGroup(groups []*webhookGroup, e Extension) (*webhookGroup, error) {
+	name := ""
+	if g, ok := e.(GroupedExtension); ok {
+		name = g.WebhookGroup()
+	}
+	for _, g := range groups {
+		if g.Name == name {
+			return g, nil
+		}
+	}
+	return nil, errors.Errorf("The extension %s is served by the webhook group %s, which is not in the ManagerOptions", extensionName(e), name)
+}
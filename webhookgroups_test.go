@@ -0,0 +1,104 @@
+package extension_test
+
+import (
+	"context"
+	"fmt"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type bestEffortExtension struct{}
+
+func (e *bestEffortExtension) Handle(context.Context, Manager, *corev1.Pod, admission.Request) admission.Response {
+	return admission.Allowed("")
+}
+
+func (e *bestEffortExtension) WebhookGroup() string {
+	return "best-effort"
+}
+
+var _ = Describe("Webhook groups", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		kubeManager   *cfakes.FakeManager
+	)
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		registerWebhooks := false
+		eiriniManager.Options.RegisterWebHook = &registerWebhooks
+		ignore := admissionregistrationv1beta1.Ignore
+		eiriniManager.Options.WebhookGroups = []WebhookGroup{{Name: "best-effort", Port: 91, FailurePolicy: &ignore}}
+
+		kubeManager = &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(&cfakes.FakeClient{})
+		eiriniManager.KubeManager = kubeManager
+		eiriniManager.GenWebHookServer()
+	})
+
+	admissionServers := func() int {
+		servers := 0
+		for i := 0; i < kubeManager.AddCallCount(); i++ {
+			if fmt.Sprintf("%T", kubeManager.AddArgsForCall(i)) == "*extension.admissionServer" {
+				servers++
+			}
+		}
+		return servers
+	}
+
+	It("serves the grouped extensions on a separate webhook server", func() {
+		Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+		Expect(eiriniManager.AddExtension(&bestEffortExtension{})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(admissionServers()).To(Equal(2))
+	})
+
+	It("only serves the groups with extensions", func() {
+		Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(admissionServers()).To(Equal(1))
+	})
+
+	It("changes the failure policy of the grouped extensions", func() {
+		Expect(eiriniManager.AddExtension(&bestEffortExtension{})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(eiriniManager.SetFailurePolicy("*extension_test.bestEffortExtension", admissionregistrationv1beta1.Fail)).To(Succeed())
+	})
+
+	It("fails with the extensions of an unknown group", func() {
+		eiriniManager.Options.WebhookGroups = nil
+		eiriniManager.GenWebHookServer()
+		Expect(eiriniManager.AddExtension(&bestEffortExtension{})).To(Succeed())
+		err := eiriniManager.LoadExtensions()
+		Expect(err).To(MatchError(ContainSubstring("webhook group best-effort")))
+	})
+
+	It("validates the groups", func() {
+		invalid := admissionregistrationv1beta1.FailurePolicyType("Retry")
+		opts := ManagerOptions{
+			Port: 90,
+			WebhookGroups: []WebhookGroup{
+				{Name: "Best_Effort", Port: 90},
+				{Name: "critical", Port: 0, FailurePolicy: &invalid},
+				{Name: "critical", Port: 92},
+				{Name: "audit", Port: 92},
+			},
+		}
+		err := opts.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("webhookGroups[0].name: Invalid value"))
+		Expect(err.Error()).To(ContainSubstring("webhookGroups[0].port: Invalid value"))
+		Expect(err.Error()).To(ContainSubstring("webhookGroups[1].port: Invalid value"))
+		Expect(err.Error()).To(ContainSubstring("webhookGroups[1].failurePolicy: Unsupported value"))
+		Expect(err.Error()).To(ContainSubstring("webhookGroups[2].name: Duplicate value"))
+		Expect(err.Error()).To(ContainSubstring("webhookGroups[3].port: Duplicate value"))
+	})
+})
@@ -0,0 +1,75 @@
+package extension
+
+import (
+	"github.com/pkg/errors"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+)
+
+// WebhookPolicy overrides the admission settings of the webhook of an extension, e.g. so that a best-effort
+// labeling extension is ignored when it fails while a security extension keeps rejecting the pods
+type WebhookPolicy struct {
+	// FailurePolicy is the failure policy of the webhook. Optional, defaults to the FailurePolicy of the
+	// WebhookGroup of the extension or of the ManagerOptions
+	FailurePolicy *admissionregistrationv1beta1.FailurePolicyType
+
+	// TimeoutSeconds is the time the API server waits for the webhook, between 1 and 30. Optional, defaults to
+	// the API server default, 30s
+	TimeoutSeconds *int32
+
+	// ReinvocationPolicy tells whether the webhook is called again when a webhook called after it modified the
+	// pod, Never or IfNeeded. It is only supported by the mutating extensions. Optional, defaults to Never
+	ReinvocationPolicy *admissionregistrationv1beta1.ReinvocationPolicyType
+
+	// MatchConditions are the CEL conditions the API server checks before calling the webhook, so that it
+	// isn't called at all for the irrelevant pods. They require the v1 admissionregistration API, see
+	// MatchCondition. Optional
+	MatchConditions []MatchCondition
+}
+
+// PolicyExtension is implemented by the Extensions overriding the admission settings of their webhook
+type PolicyExtension interface {
+	WebhookPolicy() WebhookPolicy
+}
+
+func (p WebhookPolicy) validate(validating bool) error {
+	if p.FailurePolicy != nil {
+		switch *p.FailurePolicy {
+		case admissionregistrationv1beta1.Fail, admissionregistrationv1beta1.Ignore:
+		default:
+			return errors.Errorf("Unsupported failure policy %q, must be %s or %s", *p.FailurePolicy, admissionregistrationv1beta1.Fail, admissionregistrationv1beta1.Ignore)
+		}
+	}
+	if p.TimeoutSeconds != nil && (*p.TimeoutSeconds < 1 || *p.TimeoutSeconds > 30) {
+		return errors.Errorf("Unsupported timeout of %ds, must be between 1 and 30", *p.TimeoutSeconds)
+	}
+	if p.ReinvocationPolicy != nil {
+		switch *p.ReinvocationPolicy {
+		case admissionregistrationv1beta1.NeverReinvocationPolicy, admissionregistrationv1beta1.IfNeededReinvocationPolicy:
+		default:
+			return errors.Errorf("Unsupported reinvocation policy %q, must be %s or %s", *p.ReinvocationPolicy, admissionregistrationv1beta1.NeverReinvocationPolicy, admissionregistrationv1beta1.IfNeededReinvocationPolicy)
+		}
+		if validating {
+			return errors.New("The validating extensions can't set a reinvocation policy")
+		}
+	}
+	return validateMatchConditions(p.MatchConditions)
+}
+
+// applyWebhookPolicy sets the admission settings of the PolicyExtensions on their webhook
+func (w *DefaultMutatingWebhook) applyWebhookPolicy() error {
+	e, ok := w.EiriniExtension.(PolicyExtension)
+	if !ok {
+		return nil
+	}
+	p := e.WebhookPolicy()
+	if err := p.validate(w.Validating); err != nil {
+		return errors.Wrapf(err, "the webhook policy of %s is invalid", extensionName(w.EiriniExtension))
+	}
+	if p.FailurePolicy != nil {
+		w.FailurePolicy = *p.FailurePolicy
+	}
+	w.TimeoutSeconds = p.TimeoutSeconds
+	w.ReinvocationPolicy = p.ReinvocationPolicy
+	w.MatchConditions = p.MatchConditions
+	return nil
+}
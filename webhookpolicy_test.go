@@ -0,0 +1,145 @@
+package extension_test
+
+import (
+	"context"
+
+	. "code.cloudfoundry.org/eirinix"
+	catalog "code.cloudfoundry.org/eirinix/testing"
+	cfakes "code.cloudfoundry.org/eirinix/testing/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// labelingExtension is a best-effort extension with its own webhook policy
+type labelingExtension struct {
+	catalog.EditEnvExtension
+	policy WebhookPolicy
+}
+
+func (e *labelingExtension) WebhookPolicy() WebhookPolicy { return e.policy }
+
+type validatingLabelingExtension struct {
+	labelingExtension
+}
+
+func (e *validatingLabelingExtension) Validating() bool { return true }
+
+var _ = Describe("Webhook policies", func() {
+	var (
+		eiriniManager *DefaultExtensionManager
+		created       []runtime.Object
+		ignore        = admissionregistrationv1beta1.Ignore
+		ifNeeded      = admissionregistrationv1beta1.IfNeededReinvocationPolicy
+	)
+
+	timeout := func(seconds int32) *int32 { return &seconds }
+
+	BeforeEach(func() {
+		c := catalog.NewCatalog()
+		eiriniManager = c.SimpleManager().(*DefaultExtensionManager)
+		client := &cfakes.FakeClient{}
+		created = nil
+		client.CreateCalls(func(_ context.Context, object runtime.Object, _ ...crc.CreateOption) error {
+			created = append(created, object)
+			return nil
+		})
+		kubeManager := &cfakes.FakeManager{}
+		kubeManager.GetClientReturns(client)
+		eiriniManager.KubeManager = kubeManager
+		eiriniManager.GenWebHookServer()
+		eiriniManager.WebhookConfig.CaCertificate = []byte("the-ca-cert")
+	})
+
+	It("overrides the admission settings of the extensions", func() {
+		Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+		Expect(eiriniManager.AddExtension(&labelingExtension{policy: WebhookPolicy{
+			FailurePolicy:      &ignore,
+			TimeoutSeconds:     timeout(5),
+			ReinvocationPolicy: &ifNeeded,
+		}})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+		Expect(created).To(HaveLen(1))
+
+		webhooks := created[0].(*admissionregistrationv1beta1.MutatingWebhookConfiguration).Webhooks
+		Expect(webhooks).To(HaveLen(2))
+		Expect(*webhooks[0].FailurePolicy).To(Equal(admissionregistrationv1beta1.Fail))
+		Expect(webhooks[0].TimeoutSeconds).To(BeNil())
+		Expect(webhooks[0].ReinvocationPolicy).To(BeNil())
+		Expect(*webhooks[1].FailurePolicy).To(Equal(admissionregistrationv1beta1.Ignore))
+		Expect(*webhooks[1].TimeoutSeconds).To(Equal(int32(5)))
+		Expect(*webhooks[1].ReinvocationPolicy).To(Equal(ifNeeded))
+	})
+
+	It("sets the timeout of the validating extensions", func() {
+		Expect(eiriniManager.AddExtension(&validatingLabelingExtension{labelingExtension{policy: WebhookPolicy{TimeoutSeconds: timeout(3)}}})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(Succeed())
+
+		var webhooks []admissionregistrationv1beta1.ValidatingWebhook
+		for _, object := range created {
+			if config, ok := object.(*admissionregistrationv1beta1.ValidatingWebhookConfiguration); ok {
+				webhooks = config.Webhooks
+			}
+		}
+		Expect(webhooks).To(HaveLen(1))
+		Expect(*webhooks[0].TimeoutSeconds).To(Equal(int32(3)))
+		Expect(*webhooks[0].FailurePolicy).To(Equal(admissionregistrationv1beta1.Fail))
+	})
+
+	Context("with match conditions", func() {
+		appPods := []MatchCondition{{Name: "app-pods", Expression: "'cloudfoundry.org/app_guid' in object.metadata.labels"}}
+
+		It("adds them to the v1 webhook configurations", func() {
+			eiriniManager.WebhookConfig.APIVersion = AdmissionRegistrationV1
+			Expect(eiriniManager.AddExtension(&catalog.EditEnvExtension{})).To(Succeed())
+			Expect(eiriniManager.AddExtension(&labelingExtension{policy: WebhookPolicy{MatchConditions: appPods}})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(Succeed())
+			Expect(created).To(HaveLen(1))
+
+			config := created[0].(*unstructured.Unstructured)
+			Expect(config.GetAPIVersion()).To(Equal("admissionregistration.k8s.io/v1"))
+			Expect(config.GetKind()).To(Equal("MutatingWebhookConfiguration"))
+			Expect(config.GetName()).To(Equal("eirini-x-mutating-hook"))
+			webhooks, _, err := unstructured.NestedSlice(config.Object, "webhooks")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(webhooks).To(HaveLen(2))
+			Expect(webhooks[0]).ToNot(HaveKey("matchConditions"))
+			Expect(webhooks[1]).To(HaveKeyWithValue("matchConditions", []interface{}{
+				map[string]interface{}{"name": "app-pods", "expression": "'cloudfoundry.org/app_guid' in object.metadata.labels"},
+			}))
+			Expect(webhooks[1]).To(HaveKeyWithValue("sideEffects", "NoneOnDryRun"))
+		})
+
+		It("refuses them with the v1beta1 API", func() {
+			eiriniManager.WebhookConfig.APIVersion = AdmissionRegistrationV1Beta1
+			Expect(eiriniManager.AddExtension(&labelingExtension{policy: WebhookPolicy{MatchConditions: appPods}})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(MatchError(ContainSubstring("require the v1 admissionregistration API")))
+			Expect(created).To(BeEmpty())
+		})
+
+		It("refuses the invalid ones", func() {
+			Expect(eiriniManager.AddExtension(&labelingExtension{policy: WebhookPolicy{MatchConditions: []MatchCondition{{Name: "app pods", Expression: "true"}}}})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(MatchError(ContainSubstring(`Invalid match condition name "app pods"`)))
+
+			eiriniManager.Extensions = nil
+			Expect(eiriniManager.AddExtension(&labelingExtension{policy: WebhookPolicy{MatchConditions: append(appPods, appPods...)}})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(MatchError(ContainSubstring(`Duplicated match condition "app-pods"`)))
+
+			eiriniManager.Extensions = nil
+			Expect(eiriniManager.AddExtension(&labelingExtension{policy: WebhookPolicy{MatchConditions: []MatchCondition{{Name: "empty"}}}})).To(Succeed())
+			Expect(eiriniManager.LoadExtensions()).To(MatchError(ContainSubstring(`The match condition "empty" has no expression`)))
+		})
+	})
+
+	It("refuses the invalid policies", func() {
+		Expect(eiriniManager.AddExtension(&labelingExtension{policy: WebhookPolicy{TimeoutSeconds: timeout(31)}})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(MatchError(ContainSubstring("must be between 1 and 30")))
+
+		eiriniManager.Extensions = nil
+		Expect(eiriniManager.AddExtension(&validatingLabelingExtension{labelingExtension{policy: WebhookPolicy{ReinvocationPolicy: &ifNeeded}}})).To(Succeed())
+		Expect(eiriniManager.LoadExtensions()).To(MatchError(ContainSubstring("can't set a reinvocation policy")))
+	})
+})